@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ## Review annotations
+
+// Automated checks look at the numbers before anybody else does. When
+// a check finds a figure suspicious, it can say so right on the report:
+// it writes its findings to a JSON file, and the report is made with
+// `-annotations`:
+//
+//	pdf -config daily.json -annotations findings.json today.csv
+//
+// The file lists the notes, each with the page, the region of the page
+// that the note is about, and who wrote it:
+//
+//	[
+//	  {"page": 2, "rect": [20, 84, 35, 7], "note": "Up 300% since yesterday", "author": "qa-revenue"}
+//	]
+//
+// The region is x, y, width, and height in mm from the top left corner
+// of the page. It gets a red frame, and the note a yellow box beside it,
+// with a line from the box to the frame. Unlike comments in a PDF
+// viewer, the notes are stamped onto the pages: they are part of the
+// content, print along, and cannot be closed or removed. In tagged
+// reports, they are artifacts, and in split reports, every part gets
+// them. A note for a page that the report does not have is an error.
+
+// Annotation is a note on a region of a page.
+type Annotation struct {
+	// Page is the page, counted from 1.
+	Page int `json:"page"`
+
+	// Rect is the region: x, y, width, and height in mm.
+	Rect [4]float64 `json:"rect"`
+
+	// Note is the text of the note.
+	Note string `json:"note"`
+
+	// Author is who or what wrote the note.
+	Author string `json:"author"`
+}
+
+// loadAnnotations reads the annotations of a report.
+func loadAnnotations(fsys FileSystem, path string) ([]Annotation, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var notes []Annotation
+	if err := dec.Decode(&notes); err != nil {
+		return nil, err
+	}
+	for i, a := range notes {
+		switch {
+		case a.Page < 1:
+			return nil, fmt.Errorf("annotation %d: page must be 1 or more", i+1)
+		case a.Rect[2] <= 0 || a.Rect[3] <= 0:
+			return nil, fmt.Errorf("annotation %d: width and height must be positive", i+1)
+		case a.Note == "":
+			return nil, fmt.Errorf("annotation %d: note required", i+1)
+		}
+	}
+	return notes, nil
+}
+
+// stampAnnotations draws the annotations of cfg onto their pages.
+func stampAnnotations(pdf *Fpdf, cfg *Config) *Fpdf {
+	if len(cfg.annotations) == 0 {
+		return pdf
+	}
+	last := pdf.PageNo()
+	lastX, lastY := pdf.GetXY()
+	auto, margin := pdf.GetAutoPageBreak()
+	pdf.SetAutoPageBreak(false, 0)
+	loc := cfg.locale()
+	const boxWidth, pad, lh, gap = 50, 2, 4, 4
+	for i, a := range cfg.annotations {
+		if a.Page > pdf.PageCount() {
+			pdf.SetErrorf("annotation %d: the report has no page %d", i+1, a.Page)
+			break
+		}
+		// The content of a tagged report is in an artifact until the page
+		// is complete; see tagger.
+		pdf.SetPage(a.Page)
+		artifact := cfg.Tagged != nil && a.Page != last
+		if artifact {
+			pdf.RawWriteStr("/Artifact BMC")
+		}
+		w, h, _ := pdf.PageSize(a.Page)
+		x, y, rw, rh := a.Rect[0], a.Rect[1], a.Rect[2], a.Rect[3]
+
+		// The box goes to the right of the region if there is room, and
+		// to its left otherwise, level with its top.
+		pdf.SetFont("Times", "", 9)
+		lines := pdf.SplitText(loc.print(a.Note), boxWidth-2*pad)
+		if a.Author != "" {
+			lines = append([]string{loc.print(a.Author) + ":"}, lines...)
+		}
+		bh := float64(len(lines))*lh + 2*pad
+		bx := x + rw + gap
+		if bx+boxWidth > w {
+			bx = math.Max(0, x-gap-boxWidth)
+		}
+		by := math.Max(0, math.Min(y, h-bh))
+
+		pdf.SetLineWidth(0.6)
+		pdf.SetDrawColor(220, 0, 0)
+		pdf.Rect(x, y, rw, rh, "D")
+		pdf.SetLineWidth(0.3)
+		if bx > x {
+			pdf.Line(x+rw, y+rh/2, bx, by+lh/2+pad)
+		} else {
+			pdf.Line(x, y+rh/2, bx+boxWidth, by+lh/2+pad)
+		}
+		pdf.SetFillColor(255, 245, 170)
+		pdf.Rect(bx, by, boxWidth, bh, "FD")
+		for n, l := range lines {
+			if n == 0 && a.Author != "" {
+				pdf.SetFont("Times", "B", 9)
+			} else {
+				pdf.SetFont("Times", "", 9)
+			}
+			pdf.SetXY(bx+pad, by+pad+float64(n)*lh)
+			pdf.CellFormat(boxWidth-2*pad, lh, l, "", 0, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+		}
+		if artifact {
+			pdf.RawWriteStr("EMC")
+		}
+	}
+	pdf.SetPage(last)
+	pdf.SetXY(lastX, lastY)
+	pdf.SetAutoPageBreak(auto, margin)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetFillColor(255, 255, 255)
+	return pdf
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAnnotations(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{`[{"page": 2, "rect": [20, 84, 35, 7], "note": "Up", "author": "qa"}]`, ""},
+		{`[]`, ""},
+		{`[{"page": 0, "rect": [20, 84, 35, 7], "note": "Up"}]`, "annotation 1: page must be 1 or more"},
+		{`[{"page": 1, "rect": [20, 84, 35, 7], "note": "Up"}, {"page": 1, "rect": [20, 84, 0, 7], "note": "Up"}]`, "annotation 2: width and height must be positive"},
+		{`[{"page": 1, "rect": [20, 84, 35, 7]}]`, "annotation 1: note required"},
+		{`[{"page": 1, "rect": [20, 84, 35, 7], "note": "Up", "color": "red"}]`, `json: unknown field "color"`},
+		{`{"page": 1}`, "json: cannot unmarshal object"},
+	}
+	for _, tt := range tests {
+		fsys := NewMemFS(map[string][]byte{"notes.json": []byte(tt.file)})
+		_, err := loadAnnotations(fsys, "notes.json")
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.file, err)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.file, err, tt.err)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": longCSV(50),
+		"notes.json": `[{"page": 2, "rect": [20, 84, 35, 7], "note": "Up 300% since yesterday", "author": "qa-revenue"},
+			{"page": 1, "rect": [250, 30, 20, 7], "note": "Low"}]`,
+		"late.json": `[{"page": 4, "rect": [20, 84, 35, 7], "note": "Up"}]`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Annotations: "notes.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, s := range []string{
+		// The note beside a region at the right edge of the page goes to
+		// its left.
+		"0.863 0.000 0.000 RG\n708.66 526.96 56.69 -19.84 re S\n0.85 w\n708.66 517.04 m 697.32 515.62 l S\n1.000 0.961 0.667 rg\n555.59 526.96 141.73 -22.68 re B\n",
+		"BT 564.09 512.92 Td (Low)Tj",
+		// Other notes go to the right, below their author.
+		"167.24 373.89 141.73 -34.02 re B\n",
+		"BT 175.75 359.85 Td (qa-revenue:)Tj",
+		"BT 175.75 348.51 Td (Up 300% since yesterday)Tj",
+	} {
+		if !strings.Contains(content, s) {
+			t.Errorf("missing %q", s)
+		}
+	}
+
+	err := generate(env, &Job{Input: "in.csv", Annotations: "late.json", Output: "late.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "annotation 1: the report has no page 4") {
+		t.Errorf("a note for a missing page: %v", err)
+	}
+	err = generate(env, &Job{Input: "in.csv", Annotations: "missing.json", Output: "missing.pdf"})
+	if err == nil || !strings.HasPrefix(err.Error(), "cannot load annotations: ") {
+		t.Errorf("a missing file: %v", err)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ## Job API
+
+// Large reports take longer than any sensible HTTP timeout. In daemon
+// mode, the job API therefore accepts report jobs and runs them in the
+// background:
+//
+//	POST   /reports           a Job as JSON; responds 202 with the job ID
+//	GET    /jobs/{id}         the job's status and, when done, the result URL
+//	GET    /jobs/{id}/result  the finished PDF
+//	DELETE /jobs/{id}         cancels the job
+//
+// Clients poll the status until the job is done or failed. Clients
+// that would rather wait post to `/reports?wait=1`, which responds with
+// the finished PDF, and cancels the job if they disconnect; see
+// GenerateContext.
+
+// APIConfig enables the job API on the daemon's listen address.
+type APIConfig struct {
+	// Root is the directory that inputs and configurations are read
+	// from. Paths in a job are relative to it and must not leave it.
+	Root string `json:"root"`
+
+	// OutputDir receives the finished reports, named by job ID.
+	OutputDir string `json:"outputDir"`
+
+	// Workers is the number of jobs that run at the same time.
+	// Default: 2.
+	Workers int `json:"workers"`
+
+	// Keep is the number of finished jobs that are remembered.
+	// Default: 100.
+	Keep int `json:"keep"`
+
+	// CacheTTL is how long a result is reused for identical jobs, as a
+	// duration such as "15m". Jobs are identical if their settings and
+	// the contents of their files are. Empty disables the cache.
+	CacheTTL string `json:"cacheTTL"`
+}
+
+// apiJob is the state of a job submitted through the API.
+type apiJob struct {
+	ID       string    `json:"id"`
+	Status   string    `json:"status"` // queued, running, done, failed, or canceled
+	Error    string    `json:"error,omitempty"`
+	Result   string    `json:"result,omitempty"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished"`
+
+	output string
+	key    string // cache key, if cached
+
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the job has finished
+}
+
+// jobAPI serves the job API.
+type jobAPI struct {
+	cfg  *APIConfig
+	env  *Env
+	sem  chan struct{}
+	mu   sync.Mutex
+	jobs map[string]*apiJob
+	done []string // IDs of finished jobs, oldest first
+
+	ttl   time.Duration
+	cache map[string]*apiJob // jobs by cache key
+}
+
+// register adds the API's handlers to mux and returns the API.
+func (ac *APIConfig) register(mux *http.ServeMux, env *Env) *jobAPI {
+	workers := ac.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+	api := &jobAPI{cfg: ac, env: env, sem: make(chan struct{}, workers), jobs: map[string]*apiJob{}, cache: map[string]*apiJob{}}
+	if ac.CacheTTL != "" {
+		// loadDaemonConfig has checked the duration.
+		api.ttl, _ = time.ParseDuration(ac.CacheTTL)
+	}
+	mux.HandleFunc("/reports", api.submit)
+	mux.HandleFunc("/jobs/", api.job)
+	return api
+}
+
+// submit accepts a new job.
+func (api *jobAPI) submit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	job := &Job{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(job); err != nil {
+		http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.confine(job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wait := r.URL.Query().Get("wait") != ""
+
+	// Identical jobs share one result while it is fresh.
+	var key string
+	if api.ttl > 0 {
+		var err error
+		if key, err = api.cacheKey(job); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if st, ok := api.cached(key); ok && (!wait || st.Status == "done") {
+			w.Header().Set("Location", "/jobs/"+st.ID)
+			if wait {
+				api.result(w, st)
+				return
+			}
+			writeJSON(w, http.StatusOK, st)
+			return
+		}
+	}
+
+	// A job that the client waits for ends with the request.
+	ctx := context.Background()
+	if wait {
+		ctx = r.Context()
+	}
+	aj, err := api.start(ctx, job, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+aj.ID)
+	if wait {
+		<-aj.done
+		st := api.snapshot(aj)
+		if st.Status != "done" {
+			http.Error(w, "job "+st.Status+": "+st.Error, http.StatusInternalServerError)
+			return
+		}
+		api.result(w, st)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, api.snapshot(aj))
+}
+
+// start queues a job under a new ID. The job is canceled when ctx is
+// done.
+func (api *jobAPI) start(ctx context.Context, job *Job, key string) (*apiJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job.Name = id
+	job.Output = filepath.Join(api.cfg.OutputDir, id+".pdf")
+	aj := &apiJob{ID: id, Status: "queued", Created: api.env.Clock.Now(), output: job.Output, key: key, done: make(chan struct{})}
+	ctx, aj.cancel = context.WithCancel(ctx)
+
+	api.mu.Lock()
+	api.jobs[id] = aj
+	if key != "" {
+		api.cache[key] = aj
+	}
+	api.mu.Unlock()
+	go api.run(ctx, aj, job)
+	return aj, nil
+}
+
+// confine makes the job's paths relative to the root and rejects paths
+// outside of it. Jobs with several outputs are rejected, as are jobs
+// that write files other than the report; see supports.
+func (api *jobAPI) confine(job *Job) error {
+	for _, p := range []*string{&job.Input, &job.Config, &job.Invoice, &job.Previous, &job.Annotations} {
+		if *p == "" {
+			continue
+		}
+		clean := filepath.Clean(*p)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("path %q is outside the API root", *p)
+		}
+		*p = filepath.Join(api.cfg.Root, clean)
+	}
+	if job.Input == "" && job.Invoice == "" {
+		return errors.New("job has no input")
+	}
+	if job.Summary != "" {
+		return errors.New("summaries are not supported by the API")
+	}
+	if job.Golden != "" || job.UpdateGolden {
+		return errors.New("golden files are not supported by the API")
+	}
+	return api.supports(job)
+}
+
+// supports rejects jobs with more than one output: split, merge, and
+// recipients jobs write a file per part, which the job ID cannot name.
+// Label jobs put all labels into one document and are supported.
+func (api *jobAPI) supports(job *Job) error {
+	if job.Config == "" {
+		return nil
+	}
+	cfg, err := loadConfig(api.env.FS, job.Config)
+	if err != nil {
+		return fmt.Errorf("cannot load configuration: %w", err)
+	}
+	var mode string
+	switch {
+	case cfg.Split != nil:
+		mode = "split"
+	case cfg.Merge != nil:
+		mode = "merge"
+	case cfg.Recipients != nil:
+		mode = "recipients"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s jobs are not supported by the API; they write one file per part", mode)
+}
+
+// run generates the report, waiting for a free worker first, unless
+// the job is canceled before.
+func (api *jobAPI) run(ctx context.Context, aj *apiJob, job *Job) {
+	defer close(aj.done)
+	defer aj.cancel()
+	select {
+	case api.sem <- struct{}{}:
+		defer func() { <-api.sem }()
+	case <-ctx.Done():
+		api.setStatus(aj, "canceled", ctx.Err())
+		return
+	}
+	api.setStatus(aj, "running", nil)
+	err := GenerateContext(ctx, api.env, job)
+	switch {
+	case err != nil && ctx.Err() == context.Canceled:
+		api.env.Log.Info("API job canceled", "id", aj.ID)
+		api.setStatus(aj, "canceled", err)
+	case err != nil:
+		api.env.Log.Error("API job failed", "id", aj.ID, "err", err)
+		api.setStatus(aj, "failed", err)
+	default:
+		api.setStatus(aj, "done", nil)
+	}
+}
+
+// snapshot returns the current status of a job.
+func (api *jobAPI) snapshot(aj *apiJob) apiJob {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return *aj
+}
+
+// cancel cancels a queued or running job, and reports whether there was
+// one.
+func (api *jobAPI) cancel(id string) (apiJob, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	aj, ok := api.jobs[id]
+	if !ok {
+		return apiJob{}, false
+	}
+	if aj.Status == "queued" || aj.Status == "running" {
+		aj.cancel()
+	}
+	return *aj, true
+}
+
+func (api *jobAPI) setStatus(aj *apiJob, status string, err error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	aj.Status = status
+	if err != nil {
+		aj.Error = err.Error()
+	}
+	if status != "done" && status != "failed" && status != "canceled" {
+		return
+	}
+	aj.Finished = api.env.Clock.Now()
+	if status == "done" {
+		aj.Result = "/jobs/" + aj.ID + "/result"
+	} else if aj.key != "" && api.cache[aj.key] == aj {
+		// Failures and canceled jobs are not cached.
+		delete(api.cache, aj.key)
+	}
+
+	// Only the latest finished jobs are remembered.
+	api.done = append(api.done, aj.ID)
+	keep := api.cfg.Keep
+	if keep <= 0 {
+		keep = 100
+	}
+	for len(api.done) > keep {
+		if old := api.jobs[api.done[0]]; old != nil && api.cache[old.key] == old {
+			delete(api.cache, old.key)
+		}
+		delete(api.jobs, api.done[0])
+		api.done = api.done[1:]
+	}
+}
+
+// cacheKey hashes the job's settings and the contents of its files.
+func (api *jobAPI) cacheKey(job *Job) (string, error) {
+	h := sha256.New()
+	settings, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	h.Write(settings)
+	for _, path := range []string{job.Input, job.Config, job.Invoice, job.Previous, job.Annotations} {
+		if path == "" {
+			continue
+		}
+		data, err := readFile(api.env.FS, path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\x00%d\x00", len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cached returns the status of a job with the given key that is still
+// running or finished less than the TTL ago.
+func (api *jobAPI) cached(key string) (apiJob, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	aj, ok := api.cache[key]
+	if !ok {
+		return apiJob{}, false
+	}
+	if aj.Status == "done" && api.env.Clock.Now().Sub(aj.Finished) > api.ttl {
+		delete(api.cache, key)
+		return apiJob{}, false
+	}
+	return *aj, true
+}
+
+// status returns the status of a job.
+func (api *jobAPI) status(id string) (apiJob, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	aj, ok := api.jobs[id]
+	if !ok {
+		return apiJob{}, false
+	}
+	return *aj, true
+}
+
+// job reports the status of a job, serves its result, or cancels it.
+func (api *jobAPI) job(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	id := strings.TrimSuffix(rest, "/result")
+	if r.Method == http.MethodDelete && rest == id {
+		st, ok := api.cancel(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, st)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	st, ok := api.status(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if rest == id {
+		writeJSON(w, http.StatusOK, st)
+		return
+	}
+	if st.Status != "done" {
+		http.Error(w, "job is "+st.Status, http.StatusConflict)
+		return
+	}
+	api.result(w, st)
+}
+
+// result serves the PDF of a finished job.
+func (api *jobAPI) result(w http.ResponseWriter, st apiJob) {
+	f, err := api.env.FS.Open(st.output)
+	if err != nil {
+		http.Error(w, "result not available", http.StatusGone)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/pdf")
+	io.Copy(w, f)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
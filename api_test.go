@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfine(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{
+		filepath.Join("in", "plain.json"):      []byte(`{"rounding": "halfEven"}`),
+		filepath.Join("in", "split.json"):      []byte(`{"split": {"column": "Region"}}`),
+		filepath.Join("in", "merge.json"):      []byte(`{"merge": {"template": "{{.Name}}"}}`),
+		filepath.Join("in", "recipients.json"): []byte(`{"recipients": {"file": "recipients.csv"}, "delivery": {"email": {"host": "mail.example.com"}}}`),
+		filepath.Join("in", "labels.json"):     []byte(`{"labels": {"format": "avery-5160", "template": "{{.Name}}"}}`),
+	})
+	api := &jobAPI{cfg: &APIConfig{Root: "in"}, env: &Env{FS: fsys}}
+	in := func(p string) string { return filepath.Join("in", p) }
+	tests := []struct {
+		job  Job
+		want Job    // the paths after confine
+		err  string // "" if the job is accepted
+	}{
+		{job: Job{Input: "sales.csv"}, want: Job{Input: in("sales.csv")}},
+		{job: Job{Input: "2024/../sales.csv"}, want: Job{Input: in("sales.csv")}},
+		{job: Job{Input: "./q1/sales.csv", Config: "plain.json"}, want: Job{Input: in("q1/sales.csv"), Config: in("plain.json")}},
+		{job: Job{Invoice: "invoice.json"}, want: Job{Invoice: in("invoice.json")}},
+		{job: Job{Input: "sales.csv", Previous: "last.csv", Annotations: "notes.json"},
+			want: Job{Input: in("sales.csv"), Previous: in("last.csv"), Annotations: in("notes.json")}},
+		{job: Job{Input: "..dots.csv"}, want: Job{Input: in("..dots.csv")}},
+		{job: Job{Input: "../sales.csv"}, err: `path "../sales.csv" is outside the API root`},
+		{job: Job{Input: ".."}, err: "outside the API root"},
+		{job: Job{Input: "q1/../../sales.csv"}, err: "outside the API root"},
+		{job: Job{Input: "/etc/passwd"}, err: "outside the API root"},
+		{job: Job{Input: "sales.csv", Config: "../cfg.json"}, err: "outside the API root"},
+		{job: Job{Input: "sales.csv", Previous: "/tmp/last.csv"}, err: "outside the API root"},
+		{job: Job{Input: "sales.csv", Annotations: "../notes.json"}, err: "outside the API root"},
+		{job: Job{Config: "plain.json"}, err: "job has no input"},
+		{job: Job{Input: "sales.csv", Summary: "summary.pdf"}, err: "summaries are not supported"},
+		{job: Job{Input: "sales.csv", Golden: "golden.pdf"}, err: "golden files are not supported"},
+		{job: Job{Input: "sales.csv", UpdateGolden: true}, err: "golden files are not supported"},
+		{job: Job{Input: "sales.csv", Config: "labels.json"}, want: Job{Input: in("sales.csv"), Config: in("labels.json")}},
+		{job: Job{Input: "sales.csv", Config: "split.json"}, err: "split jobs are not supported"},
+		{job: Job{Input: "sales.csv", Config: "merge.json"}, err: "merge jobs are not supported"},
+		{job: Job{Input: "sales.csv", Config: "recipients.json"}, err: "recipients jobs are not supported"},
+		{job: Job{Input: "sales.csv", Config: "missing.json"}, err: "cannot load configuration"},
+	}
+	for _, tt := range tests {
+		job := tt.job
+		err := api.confine(&job)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("confine(%q): %v", jobPaths(tt.job), err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("confine(%q) = %v, want an error with %q", jobPaths(tt.job), err, tt.err)
+		case tt.err == "":
+			if got, want := jobPaths(job), jobPaths(tt.want); got != want {
+				t.Errorf("confine(%q) = %q, want %q", jobPaths(tt.job), got, want)
+			}
+		}
+	}
+}
+
+// jobPaths returns the paths that confine changes.
+func jobPaths(job Job) [5]string {
+	return [5]string{job.Input, job.Config, job.Invoice, job.Previous, job.Annotations}
+}
+
+func TestMultiOutputJobsRejected(t *testing.T) {
+	env := testEnv(map[string]string{
+		filepath.Join("in", "sales.csv"):       "Region,Total\nNorth,1\n",
+		filepath.Join("in", "recipients.json"): `{"recipients": {"file": "recipients.csv"}, "delivery": {"email": {"host": "mail.example.com"}}}`,
+	})
+	mux := http.NewServeMux()
+	api := (&APIConfig{Root: "in", OutputDir: "out"}).register(mux, env)
+	profile := &ScheduledJob{Job: Job{Input: filepath.Join("in", "sales.csv"), Config: filepath.Join("in", "recipients.json")}}
+	(&PortalConfig{}).register(mux, []*ScheduledJob{profile}, api)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("POST", "/reports", strings.NewReader(`{"input": "sales.csv", "config": "recipients.json"}`)),
+		httptest.NewRequest("POST", "/portal/run", strings.NewReader("profile=0")),
+	} {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "recipients jobs are not supported") {
+			t.Errorf("%s: %d %s", r.URL, w.Code, w.Body)
+		}
+	}
+	if len(api.jobs) != 0 {
+		t.Errorf("%d jobs started", len(api.jobs))
+	}
+}
+
+// serve sends a request with the given body to mux.
+func serve(mux *http.ServeMux, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return w
+}
+
+// poll returns the status of a job once it has finished.
+func poll(t *testing.T, mux *http.ServeMux, location string) apiJob {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		w := serve(mux, "GET", location, "")
+		var st apiJob
+		if err := json.Unmarshal(w.Body.Bytes(), &st); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("GET %s: %d %s", location, w.Code, w.Body)
+		}
+		if st.Status != "queued" && st.Status != "running" {
+			return st
+		}
+	}
+	t.Fatalf("%s did not finish", location)
+	return apiJob{}
+}
+
+func TestJobAPI(t *testing.T) {
+	env := testEnv(map[string]string{filepath.Join("in", "sales.csv"): "Region,Total\nNorth,1\n"})
+	mux := http.NewServeMux()
+	(&APIConfig{Root: "in", OutputDir: "out"}).register(mux, env)
+
+	// A job is queued and polled until its result is ready.
+	w := serve(mux, "POST", "/reports", `{"input": "sales.csv"}`)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusAccepted || !strings.HasPrefix(location, "/jobs/") {
+		t.Fatalf("POST /reports: %d %s, Location %q", w.Code, w.Body, location)
+	}
+	st := poll(t, mux, location)
+	if st.Status != "done" || st.Result != location+"/result" || st.Error != "" {
+		t.Fatalf("job finished with %+v", st)
+	}
+	w = serve(mux, "GET", st.Result, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(w.Body.String(), "%PDF-") {
+		t.Errorf("GET %s: %d %s %.20q", st.Result, w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if testFile(t, env, filepath.Join("out", st.ID+".pdf")) != w.Body.String() {
+		t.Error("the result differs from the output file")
+	}
+
+	// A client can wait for the result instead.
+	w = serve(mux, "POST", "/reports?wait=1", `{"input": "sales.csv"}`)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "%PDF-") || w.Header().Get("Location") == location {
+		t.Errorf("POST /reports?wait=1: %d %.20q, Location %q", w.Code, w.Body, w.Header().Get("Location"))
+	}
+
+	// Failed jobs report their error and have no result.
+	w = serve(mux, "POST", "/reports", `{"input": "missing.csv"}`)
+	st = poll(t, mux, w.Header().Get("Location"))
+	if st.Status != "failed" || !strings.Contains(st.Error, "missing.csv") || st.Result != "" {
+		t.Errorf("job with a missing input finished with %+v", st)
+	}
+	if w = serve(mux, "GET", "/jobs/"+st.ID+"/result", ""); w.Code != http.StatusConflict {
+		t.Errorf("result of a failed job: %d %s", w.Code, w.Body)
+	}
+
+	for _, tt := range []struct {
+		method, url, body string
+		code              int
+	}{
+		{"GET", "/reports", "", http.StatusMethodNotAllowed},
+		{"POST", "/reports", `{"input": "sales.csv", "color": "red"}`, http.StatusBadRequest},
+		{"POST", "/reports", `{"input": "../sales.csv"}`, http.StatusBadRequest},
+		{"GET", "/jobs/nonexistent", "", http.StatusNotFound},
+		{"GET", "/jobs/nonexistent/result", "", http.StatusNotFound},
+		{"PUT", location, "", http.StatusMethodNotAllowed},
+	} {
+		if w := serve(mux, tt.method, tt.url, tt.body); w.Code != tt.code {
+			t.Errorf("%s %s: %d %s, want %d", tt.method, tt.url, w.Code, w.Body, tt.code)
+		}
+	}
+}
+
+func TestJobAPICache(t *testing.T) {
+	env := testEnv(map[string]string{
+		filepath.Join("in", "sales.csv"): "Region,Total\nNorth,1\n",
+		filepath.Join("in", "short.csv"): "Region,Total\nNorth\n",
+	})
+	now := testTime
+	env.Clock = ClockFunc(func() time.Time { return now })
+	mux := http.NewServeMux()
+	(&APIConfig{Root: "in", OutputDir: "out", CacheTTL: "15m"}).register(mux, env)
+
+	// submit runs a job to its end and returns its location.
+	submit := func(body string) string {
+		t.Helper()
+		w := serve(mux, "POST", "/reports", body)
+		location := w.Header().Get("Location")
+		if w.Code != http.StatusAccepted && w.Code != http.StatusOK {
+			t.Fatalf("POST /reports: %d %s", w.Code, w.Body)
+		}
+		poll(t, mux, location)
+		return location
+	}
+	first := submit(`{"input": "sales.csv"}`)
+	if again := submit(`{"input": "sales.csv"}`); again != first {
+		t.Errorf("an identical job ran again as %s", again)
+	}
+	if other := submit(`{"input": "sales.csv", "grayscale": true}`); other == first {
+		t.Error("a job with other settings was taken from the cache")
+	}
+
+	// Changed input data is a different job.
+	f, err := env.FS.Create(filepath.Join("in", "sales.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("Region,Total\nNorth,2\n"))
+	f.Close()
+	changed := submit(`{"input": "sales.csv"}`)
+	if changed == first {
+		t.Error("a job with changed input was taken from the cache")
+	}
+
+	// Results expire after the TTL. No job is running.
+	now = now.Add(16 * time.Minute)
+	if expired := submit(`{"input": "sales.csv"}`); expired == changed {
+		t.Error("an expired result was taken from the cache")
+	}
+
+	// Failures are not cached.
+	failed := submit(`{"input": "short.csv"}`)
+	if again := submit(`{"input": "short.csv"}`); again == failed {
+		t.Error("a failed job was taken from the cache")
+	}
+}
+
+func TestPortal(t *testing.T) {
+	env := testEnv(map[string]string{
+		filepath.Join("in", "sales.csv"): "Date,Region,Total\n2024-03-14,North,1\n2024-03-14,East,3\n2024-03-15,South,2\n",
+	})
+	mux := http.NewServeMux()
+	api := (&APIConfig{Root: "in", OutputDir: "out"}).register(mux, env)
+	profiles := []*ScheduledJob{
+		{Job: Job{Name: "Daily sales", Input: filepath.Join("in", "sales.csv"), DateRange: DateRange{Column: "Date", Range: "mtd"}}},
+		{Job: Job{Name: "All regions", Input: filepath.Join("in", "sales.csv"), Filter: `Total > 0`}},
+	}
+	(&PortalConfig{Title: "Sales reports"}).register(mux, profiles, api)
+
+	// The index offers the profiles with their settings.
+	w := serve(mux, "GET", "/portal/", "")
+	for _, s := range []string{
+		"<title>Sales reports</title>",
+		"<h2>Daily sales</h2>",
+		"<option selected>mtd</option>",
+		"<h2>All regions</h2>",
+		`value="Total &gt; 0"`,
+	} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("the index lacks %q", s)
+		}
+	}
+	if strings.Count(w.Body.String(), `name="range"`) != 1 {
+		t.Error("a profile without a date column offers date ranges")
+	}
+
+	// A report runs with the settings of the form, and its page shows
+	// the result.
+	r := httptest.NewRequest("POST", "/portal/run", strings.NewReader(`profile=0&range=yesterday&filter=Region+%3D+%22North%22`))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusSeeOther || !strings.HasPrefix(location, "/portal/jobs/") {
+		t.Fatalf("POST /portal/run: %d %s, Location %q", w.Code, w.Body, location)
+	}
+	st := poll(t, mux, strings.TrimPrefix(location, "/portal"))
+	if st.Status != "done" {
+		t.Fatalf("job finished with %+v", st)
+	}
+	w = serve(mux, "GET", location, "")
+	if !strings.Contains(w.Body.String(), `<iframe src="`+st.Result+`">`) || strings.Contains(w.Body.String(), "refresh") {
+		t.Errorf("the job page does not show the result:\n%s", w.Body)
+	}
+	content := pageContents(t, serve(mux, "GET", st.Result, "").Body.Bytes())
+	if !strings.Contains(content, "(North)Tj") || strings.Contains(content, "(East)Tj") || strings.Contains(content, "(South)Tj") {
+		t.Error("the report ignores the range and the filter of the form")
+	}
+	if profiles[0].Filter != "" || profiles[0].DateRange.Range != "mtd" {
+		t.Error("the form changed the profile")
+	}
+
+	for _, tt := range []struct {
+		method, url, body string
+		code              int
+	}{
+		{"GET", "/portal/run", "", http.StatusMethodNotAllowed},
+		{"POST", "/portal/run", "", http.StatusBadRequest},
+		{"POST", "/portal/run?profile=2", "", http.StatusBadRequest},
+		{"GET", "/portal/other", "", http.StatusNotFound},
+		{"GET", "/portal/jobs/nonexistent", "", http.StatusNotFound},
+	} {
+		if w := serve(mux, tt.method, tt.url, tt.body); w.Code != tt.code {
+			t.Errorf("%s %s: %d %s, want %d", tt.method, tt.url, w.Code, w.Body, tt.code)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## PDF/A archival mode
+
+// Archived reports must be readable decades from now. PDF/A guarantees
+// that by requiring embedded fonts, XMP metadata, and a color profile,
+// and by banning features such as encryption and JavaScript.
+//
+// gofpdf gets us most of the way: TrueType fonts are embedded, and XMP
+// metadata can be attached. The missing pieces -- the output intent with
+// its ICC profile, the document ID, and the binary header comment -- are
+// added to the finished file. A final check fails loudly if the result
+// does not meet the requirements that can be verified here.
+//
+// PDF/A-3 also allows embedded files that are associated with the
+// document, such as the XML data of an electronic invoice; see
+// EInvoiceConfig.
+
+// ArchiveConfig enables the archival mode.
+type ArchiveConfig struct {
+	// Level is the PDF/A conformance level, "2b" (default), "1b", or
+	// "3b".
+	Level string `json:"level"`
+
+	// Fonts overrides the fonts of the document; see Config.Fonts.
+	// PDF/A requires embedded fonts, so one of both must be set.
+	Fonts map[string]string `json:"fonts"`
+
+	// ICCProfile is the path of an RGB ICC profile, usually sRGB, that
+	// becomes the output intent.
+	ICCProfile string `json:"iccProfile"`
+
+	// Title is the document title stored in the metadata.
+	// Default: "Daily Report".
+	Title string `json:"title"`
+
+	xmpExtension string        // additional XMP metadata
+	files        []archiveFile // associated files, PDF/A-3 only
+}
+
+// archiveFile is a file embedded in the document and associated with it.
+type archiveFile struct {
+	name, description string
+	mimeType          string // such as "text/xml"
+	relationship      string // how the file relates to the document, such as "Data"
+	data              []byte
+	modified          time.Time
+}
+
+const archiveProducer = "appliedgo/pdf"
+
+// part returns the PDF/A part number and conformance letter.
+func (ac *ArchiveConfig) part() (string, string, error) {
+	switch ac.Level {
+	case "", "2b":
+		return "2", "B", nil
+	case "1b":
+		return "1", "B", nil
+	case "3b":
+		return "3", "B", nil
+	}
+	return "", "", fmt.Errorf("unsupported PDF/A level %q; use 1b, 2b, or 3b", ac.Level)
+}
+
+// setup sets the metadata. It runs before anything is written to the
+// document, after setupDocument has embedded the fonts.
+func (ac *ArchiveConfig) setup(pdf *Fpdf, now time.Time, extension string) {
+	part, conformance, err := ac.part()
+	if err != nil {
+		pdf.SetError(err)
+		return
+	}
+	title := orDefault(ac.Title, "Daily Report")
+	pdf.SetTitle(title, true)
+	pdf.SetProducer(archiveProducer, true)
+	pdf.SetCreationDate(now)
+	pdf.SetModificationDate(now)
+	pdf.SetXmpMetadata(xmpPacket(part, conformance, title, now, ac.xmpExtension+extension))
+}
+
+// xmpPacket returns the XMP metadata, followed by the descriptions in
+// extension. The dates have no time zone, to match the dates gofpdf
+// writes into the document information.
+func xmpPacket(part, conformance, title string, now time.Time, extension string) []byte {
+	date := now.Format("2006-01-02T15:04:05")
+	var esc bytes.Buffer
+	xmlEscape(&esc, title)
+	return []byte(`<?xpacket begin="` + "\xef\xbb\xbf" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>` + part + `</pdfaid:part>
+<pdfaid:conformance>` + conformance + `</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + esc.String() + `</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<xmp:CreateDate>` + date + `</xmp:CreateDate>
+<xmp:ModifyDate>` + date + `</xmp:ModifyDate>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdf:Producer>` + archiveProducer + `</pdf:Producer>
+</rdf:Description>
+` + extension + `</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
+
+func xmlEscape(buf *bytes.Buffer, s string) {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	buf.WriteString(r.Replace(s))
+}
+
+// finisher returns the post-processing step for savePDF.
+func (ac *ArchiveConfig) finisher(fsys FileSystem) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		icc, err := readFile(fsys, ac.ICCProfile)
+		if err != nil {
+			return nil, fmt.Errorf("archive: ICC profile: %w", err)
+		}
+		data, err = addArchiveObjects(data, icc, ac.files)
+		if err != nil {
+			return nil, fmt.Errorf("archive: %w", err)
+		}
+		part, conformance, _ := ac.part()
+		if err := validateArchive(data, part); err != nil {
+			return nil, fmt.Errorf("PDF/A-%s%s compliance not met: %w", part, strings.ToLower(conformance), err)
+		}
+		return data, nil
+	}
+}
+
+var (
+	reStartXref = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n?$`)
+	reRoot      = regexp.MustCompile(`/Root (\d+) 0 R`)
+	reInfo      = regexp.MustCompile(`/Info (\d+) 0 R`)
+	reSize      = regexp.MustCompile(`/Size (\d+)`)
+	rePrev      = regexp.MustCompile(`/Prev (\d+)`)
+	reMetadata  = regexp.MustCompile(`\n(\d+) 0 obj\n<< /Type /Metadata /Subtype /XML`)
+)
+
+// binaryComment follows the header line, so that file transfer tools
+// treat the file as binary.
+const binaryComment = "%\xe2\xe3\xcf\xd3\n"
+
+// addArchiveObjects inserts the binary header comment and appends an
+// incremental update with the output intent, the ICC profile, the
+// associated files, a catalog that references them and the XMP metadata,
+// and the document ID.
+func addArchiveObjects(data, icc []byte, files []archiveFile) ([]byte, error) {
+	data, err := insertBinaryComment(data)
+	if err != nil {
+		return nil, err
+	}
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	prev := string(m[1])
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	meta := reMetadata.FindSubmatch(data)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	if meta == nil {
+		return nil, errors.New("XMP metadata missing")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+	rootObj := string(root[1])
+
+	// The catalog's dictionary is copied and extended. A tagged report
+	// has replaced it already, and may have referenced the metadata.
+	obj := pdfObject(data, rootObj)
+	if obj == nil {
+		return nil, errors.New("cannot find catalog")
+	}
+	dict := obj[bytes.Index(obj, []byte("<<"))+2 : bytes.LastIndex(obj, []byte(">>"))]
+	if !bytes.Contains(dict, []byte("/Metadata ")) {
+		dict = append(append([]byte{}, dict...), fmt.Sprintf("/Metadata %s 0 R\n", meta[1])...)
+	}
+
+	// gofpdf always writes a name tree of embedded files, which is empty
+	// because archival mode does not allow attachments.
+	embedded := bytes.Index(dict, []byte(embeddedFilesTree))
+	if len(files) > 0 && embedded < 0 {
+		return nil, errors.New("cannot find the embedded files of the catalog")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	var offsets []int // of the new objects, numbered from size on
+	newObj := func() int {
+		offsets = append(offsets, buf.Len())
+		return size + len(offsets) - 1
+	}
+
+	iccObj := newObj()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /N 3 /Length %d >>\nstream\n", iccObj, len(icc))
+	buf.Write(icc)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	intentObj := newObj()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>\nendobj\n", intentObj, iccObj)
+
+	var specs, names []string
+	for _, f := range files {
+		name := pdfString(f.name)
+		fileObj := newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /EmbeddedFile /Subtype /%s /Params << /ModDate (D:%s) /Size %d >> /Length %d >>\nstream\n",
+			fileObj, strings.Replace(f.mimeType, "/", "#2F", -1), f.modified.Format("20060102150405"), len(f.data), len(f.data))
+		buf.Write(f.data)
+		buf.WriteString("\nendstream\nendobj\n")
+		specObj := newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Filespec /F %s /UF %s /EF << /F %d 0 R /UF %d 0 R >> /Desc %s /AFRelationship /%s >>\nendobj\n",
+			specObj, name, name, fileObj, fileObj, pdfString(f.description), f.relationship)
+		specs = append(specs, fmt.Sprintf("%d 0 R", specObj))
+		names = append(names, fmt.Sprintf("%s %d 0 R", name, specObj))
+	}
+	if len(files) > 0 {
+		at := embedded + len(embeddedFilesTree)
+		extended := append([]byte{}, dict[:at]...)
+		extended = append(extended, " "+strings.Join(names, " ")...)
+		extended = append(extended, dict[at:]...)
+		dict = append(extended, fmt.Sprintf("/AF [%s]\n", strings.Join(specs, " "))...)
+	}
+
+	rootNum, _ := strconv.Atoi(rootObj)
+	rootOffset := buf.Len()
+	fmt.Fprintf(&buf, "%d 0 obj\n<<%s/OutputIntents [%d 0 R]\n>>\nendobj\n", rootNum, dict, intentObj)
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", rootNum, rootOffset)
+	fmt.Fprintf(&buf, "%d %d\n", size, len(offsets))
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	id := fmt.Sprintf("%x", md5.Sum(data))
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n/ID [<%s> <%s>]\n>>\nstartxref\n%d\n%%%%EOF\n",
+		size+len(offsets), rootObj, info[1], prev, id, id, xref)
+	return buf.Bytes(), nil
+}
+
+// embeddedFilesTree starts the array of embedded files in the catalog
+// that gofpdf writes.
+const embeddedFilesTree = "/EmbeddedFiles << /Names ["
+
+// pdfString returns s as a PDF literal string.
+func pdfString(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+}
+
+// insertBinaryComment adds the comment after the header line and shifts
+// all offsets accordingly: those in the cross-reference tables of the
+// document and of its incremental updates, and those in their trailers.
+func insertBinaryComment(data []byte) ([]byte, error) {
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 || !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	shift := len(binaryComment)
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+
+	// The tables are found from the last one on, through the /Prev
+	// entries of the trailers. Entries are "oooooooooo ggggg n \n".
+	var offsets [][2]int // start and end of every offset in data
+	xref, _ := strconv.Atoi(string(m[1]))
+	for {
+		if xref <= nl || xref >= len(data) || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+			return nil, errors.New("cannot find cross-reference table")
+		}
+		end := bytes.Index(data[xref:], []byte("startxref\n"))
+		if end < 0 {
+			return nil, errors.New("cannot find cross-reference table")
+		}
+		pos := xref
+		for _, line := range bytes.SplitAfter(data[xref:xref+end], []byte("\n")) {
+			if len(line) == 20 && line[10] == ' ' && line[17] == 'n' {
+				offsets = append(offsets, [2]int{pos, pos + 10})
+			}
+			pos += len(line)
+		}
+		start := xref + end + len("startxref\n")
+		offsets = append(offsets, [2]int{start, start + bytes.IndexByte(data[start:], '\n')})
+		prev := rePrev.FindSubmatchIndex(data[xref : xref+end])
+		if prev == nil {
+			break
+		}
+		offsets = append(offsets, [2]int{xref + prev[2], xref + prev[3]})
+		xref, _ = strconv.Atoi(string(data[xref+prev[2] : xref+prev[3]]))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i][0] < offsets[j][0] })
+
+	var out bytes.Buffer
+	out.Write(data[:nl+1])
+	out.WriteString(binaryComment)
+	last := nl + 1
+	for _, o := range offsets {
+		out.Write(data[last:o[0]])
+		off, err := strconv.Atoi(string(data[o[0]:o[1]]))
+		if err != nil {
+			return nil, errors.New("malformed cross-reference entry")
+		}
+		if o[1]-o[0] == 10 {
+			fmt.Fprintf(&out, "%010d", off+shift)
+		} else {
+			fmt.Fprintf(&out, "%d", off+shift)
+		}
+		last = o[1]
+	}
+	out.Write(data[last:])
+	return out.Bytes(), nil
+}
+
+// validateArchive checks the finished file for everything PDF/A
+// requires that can be verified without a full PDF parser.
+func validateArchive(data []byte, part string) error {
+	var problems []string
+	check := func(ok bool, msg string) {
+		if !ok {
+			problems = append(problems, msg)
+		}
+	}
+	has := func(s string) bool { return bytes.Contains(data, []byte(s)) }
+
+	check(bytes.HasPrefix(data[bytes.IndexByte(data, '\n')+1:], []byte(binaryComment)), "binary header comment missing")
+	check(!has("/Subtype /Type1"), "non-embedded standard font used")
+	check(bytes.Count(data, []byte("/Type /FontDescriptor")) ==
+		bytes.Count(data, []byte("/FontFile")), "font without embedded font program")
+	check(!has("/Encrypt"), "encryption is not allowed")
+	check(!has("/JavaScript"), "JavaScript is not allowed")
+	if part == "3" {
+		check(bytes.Count(data, []byte("/Type /Filespec")) == bytes.Count(data, []byte("/AFRelationship")),
+			"embedded files must be associated with the document")
+	} else {
+		check(!has("/Type /EmbeddedFile"), "file attachments are not allowed")
+	}
+	check(has("/OutputIntents"), "output intent missing")
+	check(has("/ID ["), "document ID missing")
+	check(has("/Metadata "), "XMP metadata not referenced from catalog")
+	if part == "1" {
+		check(!has("/SMask"), "transparency (e.g. images with alpha channel) is not allowed in PDF/A-1")
+		check(!has("/CIDFontType2") || has("/CIDSet"), "PDF/A-1 requires CIDSet streams, which gofpdf does not write; use level 2b")
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// readFile returns the contents of the named file.
+func readFile(fsys FileSystem, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFont returns a TrueType font that gofpdf ships, such as
+// "DejaVuSansCondensed.ttf", from the module cache. Tests that need it
+// are skipped if it cannot be found.
+func testFont(t *testing.T, name string) string {
+	t.Helper()
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		cache = filepath.Join(build.Default.GOPATH, "pkg", "mod")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cache, "github.com", "jung-kurt", "gofpdf@v1.16.2", "font", name))
+	if err != nil {
+		t.Skipf("no TrueType font for the test: %v", err)
+	}
+	return string(data)
+}
+
+func TestArchive(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":     "Item,Total\nÄpfel,10\n",
+		"font.ttf":   testFont(t, "DejaVuSansCondensed.ttf"),
+		"sRGB.icc":   "profile",
+		"cfg.json":   `{"archive": {"fonts": {"": "font.ttf"}, "iccProfile": "sRGB.icc", "title": "Sales & Costs"}}`,
+		"cfg1b.json": `{"archive": {"level": "1b", "fonts": {"": "font.ttf"}, "iccProfile": "sRGB.icc"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(testFile(t, env, "out.pdf"))
+	if _, err := readPDF(data); err != nil {
+		t.Fatalf("the archived document cannot be read: %v", err)
+	}
+	if header := data[:bytes.IndexByte(data, '\n')+1]; !bytes.HasPrefix(data[len(header):], []byte(binaryComment)) {
+		t.Errorf("no binary comment after the header %q", header)
+	}
+	for _, want := range []string{
+		"<pdfaid:part>2</pdfaid:part>",
+		"<pdfaid:conformance>B</pdfaid:conformance>",
+		"<rdf:li xml:lang=\"x-default\">Sales &amp; Costs</rdf:li>",
+		"/Type /OutputIntent /S /GTS_PDFA1",
+		"stream\nprofile\nendstream",
+		"/OutputIntents [",
+		"/ID [<",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("the document lacks %q", want)
+		}
+	}
+	if err := validateArchive(data, "2"); err != nil {
+		t.Errorf("validateArchive = %v", err)
+	}
+
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg1b.json", Output: "out1b.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "PDF/A-1b compliance not met: PDF/A-1 requires CIDSet streams") {
+		t.Errorf("PDF/A-1b with a TrueType font: %v", err)
+	}
+}
+
+func TestValidateArchive(t *testing.T) {
+	valid := "%PDF-1.4\n" + binaryComment + "1 0 obj\n<< /Type /Catalog /Metadata 2 0 R /OutputIntents [3 0 R] >>\ntrailer\n<< /ID [<a> <a>] >>\n"
+	if err := validateArchive([]byte(valid), "2"); err != nil {
+		t.Errorf("validateArchive = %v", err)
+	}
+	for _, tt := range []struct {
+		doc, part, err string
+	}{
+		{strings.Replace(valid, binaryComment, "", 1), "2", "binary header comment missing"},
+		{valid + "<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>", "2", "non-embedded standard font used"},
+		{valid + "<< /Type /FontDescriptor >>", "2", "font without embedded font program"},
+		{valid + "/Encrypt 9 0 R", "2", "encryption is not allowed"},
+		{valid + "<< /S /JavaScript >>", "2", "JavaScript is not allowed"},
+		{valid + "<< /Type /EmbeddedFile >>", "2", "file attachments are not allowed"},
+		{valid + "<< /Type /Filespec >>", "3", "embedded files must be associated with the document"},
+		{valid + "<< /SMask 5 0 R >>", "1", "transparency"},
+		{strings.Replace(valid, "/OutputIntents", "", 1), "2", "output intent missing"},
+		{strings.Replace(valid, "/ID [", "", 1), "2", "document ID missing"},
+	} {
+		if err := validateArchive([]byte(tt.doc), tt.part); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("validateArchive = %v, want an error with %q", err, tt.err)
+		}
+	}
+	if err := validateArchive([]byte(valid+"<< /Type /Filespec /AFRelationship /Data >>"), "3"); err != nil {
+		t.Errorf("PDF/A-3 with an associated file: %v", err)
+	}
+}
+
+func TestArchiveConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"archive": {"level": "4", "fonts": {"": "f.ttf"}, "iccProfile": "p.icc"}}`, `unsupported PDF/A level "4"`},
+		{`{"archive": {"iccProfile": "p.icc"}}`, "PDF/A requires embedded fonts"},
+		{`{"archive": {"fonts": {"": "f.ttf"}}}`, "iccProfile is required"},
+	} {
+		env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n", "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), "archive: "+tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ## Encrypted artifacts
+
+// Besides the report, a run leaves files behind: layout snapshots, width
+// locks, the delivery state. They hold column names, row counts, and
+// hashes of the reports -- little, but more than a reporting host should
+// keep in the clear when the reports are confidential. With an artifact
+// key, these files are encrypted with AES-256-GCM:
+//
+//	"artifactKey": "$REPORT_ARTIFACT_KEY"
+//
+// The key is 32 random bytes in base64, such as `openssl rand -base64 32`
+// prints. Environment variables are expanded, so the key need not be
+// stored in the configuration. Files that are still unencrypted are read
+// as they are and encrypted the next time they are written.
+//
+// The report itself is not encrypted; it is meant to be read. A transfer
+// to Azure storage keeps it in a temporary file only while the upload
+// runs.
+
+// artifactMagic starts every encrypted artifact.
+const artifactMagic = "appliedgo/pdf encrypted\n"
+
+// parseArtifactKey decodes the base64 key, after expanding environment
+// variables.
+func parseArtifactKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(os.ExpandEnv(s))
+	if err != nil {
+		return nil, fmt.Errorf("artifactKey: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("artifactKey: want 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// sealArtifact encrypts data with key. Without a key, it returns data
+// unchanged.
+func sealArtifact(key, data []byte) ([]byte, error) {
+	if key == nil {
+		return data, nil
+	}
+	gcm, err := artifactCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append([]byte(artifactMagic), nonce...)
+	return gcm.Seal(sealed, nonce, data, []byte(artifactMagic)), nil
+}
+
+// openArtifact decrypts data if it is encrypted.
+func openArtifact(key, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(artifactMagic)) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, errors.New("the file is encrypted, but no artifactKey is configured")
+	}
+	gcm, err := artifactCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(artifactMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("the encrypted file is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(artifactMagic))
+	if err != nil {
+		return nil, errors.New("cannot decrypt the file; wrong artifactKey?")
+	}
+	return plain, nil
+}
+
+func artifactCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeArtifact stores data at path, encrypted if key is not nil.
+func writeArtifact(fsys FileSystem, key []byte, path string, data []byte) error {
+	sealed, err := sealArtifact(key, data)
+	if err != nil {
+		return err
+	}
+	return writeOutput(fsys, path, sealed)
+}
+
+// readArtifact reads the file at path and decrypts it if necessary. A
+// missing file returns an error for which os.IsNotExist is true.
+func readArtifact(fsys FileSystem, key []byte, path string) ([]byte, error) {
+	data, err := readFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return openArtifact(key, data)
+}
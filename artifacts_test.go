@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestArtifactEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	other := bytes.Repeat([]byte{8}, 32)
+	data := []byte(`{"rows": 3}`)
+
+	sealed, err := sealArtifact(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, []byte(artifactMagic)) || bytes.Contains(sealed, data) {
+		t.Fatalf("sealed artifact %q", sealed)
+	}
+	again, _ := sealArtifact(key, data)
+	if bytes.Equal(sealed, again) {
+		t.Error("two encryptions of the same data are equal")
+	}
+	if plain, err := openArtifact(key, sealed); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("openArtifact = %q, %v", plain, err)
+	}
+	// Files written before the key was set are read as they are.
+	if plain, err := openArtifact(key, data); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("openArtifact of plain data = %q, %v", plain, err)
+	}
+	if plain, _ := sealArtifact(nil, data); !bytes.Equal(plain, data) {
+		t.Error("sealArtifact without a key changed the data")
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	for _, tt := range []struct {
+		key  []byte
+		data []byte
+		err  string
+	}{
+		{nil, sealed, "the file is encrypted, but no artifactKey is configured"},
+		{other, sealed, "cannot decrypt the file; wrong artifactKey?"},
+		{key, tampered, "cannot decrypt the file; wrong artifactKey?"},
+		{key, sealed[:len(artifactMagic)+5], "the encrypted file is truncated"},
+	} {
+		if _, err := openArtifact(tt.key, tt.data); err == nil || err.Error() != tt.err {
+			t.Errorf("openArtifact = %v, want %q", err, tt.err)
+		}
+	}
+}
+
+func TestParseArtifactKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	defer os.Setenv("ARTIFACT_KEY", os.Getenv("ARTIFACT_KEY"))
+	os.Setenv("ARTIFACT_KEY", base64.StdEncoding.EncodeToString(key))
+	if got, err := parseArtifactKey("$ARTIFACT_KEY"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("parseArtifactKey = %x, %v", got, err)
+	}
+	for _, tt := range []struct{ s, err string }{
+		{"not base64!", "artifactKey: illegal base64 data"},
+		{base64.StdEncoding.EncodeToString(key[:16]), "artifactKey: want 32 bytes, got 16"},
+		{"$NO_SUCH_ARTIFACT_KEY", "artifactKey: want 32 bytes, got 0"},
+	} {
+		if _, err := parseArtifactKey(tt.s); err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("parseArtifactKey(%q) = %v, want %q", tt.s, err, tt.err)
+		}
+	}
+}
+
+func TestEncryptedSnapshot(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Total\nNorth,1\n",
+		"cfg.json": `{"artifactKey": "` + base64.StdEncoding.EncodeToString(key) + `"}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Snapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	sealed := testFile(t, env, "out.layout.json")
+	if !strings.HasPrefix(sealed, artifactMagic) {
+		t.Fatalf("the snapshot is not encrypted: %.40q", sealed)
+	}
+	data, err := readArtifact(env.FS, key, "out.layout.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ls layoutSnapshot
+	if err := json.Unmarshal(data, &ls); err != nil || len(ls.Rows) != 1 {
+		t.Errorf("decrypted snapshot %s, %v", data, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ## Attaching the data
+
+// Sooner or later, a reader of the report asks for the numbers in a
+// spreadsheet. The report can carry them itself, as a CSV file attached
+// to the PDF that every PDF reader can save:
+//
+//	"attach": {"data": "report"}
+//
+// "report" attaches the rows of the report -- filtered, validated, with
+// computed columns, and in a split run only those of the part. "original"
+// attaches the input file as it was read; because it holds all rows, it
+// is available for single reports from a file only.
+//
+// PDF/A documents cannot carry arbitrary attachments, so attaching is not
+// available in archival mode.
+
+// AttachConfig attaches the data to the report.
+type AttachConfig struct {
+	// Data is "report" (default) or "original".
+	Data string `json:"data"`
+
+	// Name is the file name of the attachment. Default: the name of the
+	// report or, for "original", of the input file, with the extension
+	// ".csv".
+	Name string `json:"name"`
+
+	// Description is shown by some PDF readers next to the attachment.
+	Description string `json:"description"`
+}
+
+func (ac *AttachConfig) prepare(c *Config) error {
+	switch ac.Data {
+	case "", "report":
+	case "original":
+		if c.Source != nil || c.Split != nil || c.Recipients != nil || c.Pivot != nil {
+			return fmt.Errorf("original data can be attached to single reports from a file only")
+		}
+	default:
+		return fmt.Errorf("unknown data %q; use report or original", ac.Data)
+	}
+	if c.Archive != nil {
+		return fmt.Errorf("PDF/A does not allow attachments")
+	}
+	return nil
+}
+
+// fileName returns the file name of the attachment to the report of
+// part p.
+func (ac *AttachConfig) fileName(job *Job, p *part) string {
+	if ac.Name != "" {
+		return ac.Name
+	}
+	name := p.output
+	if ac.Data == "original" {
+		name = job.Input
+	}
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)) + ".csv"
+}
+
+// attach adds the data of the report of part p to the document.
+func (ac *AttachConfig) attach(env *Env, job *Job, pdf *Fpdf, hdr []string, rows [][]string, p *part) error {
+	var data []byte
+	if ac.Data == "original" {
+		var err error
+		if data, err = readFile(env.FS, job.Input); err != nil {
+			return fmt.Errorf("cannot attach '%s': %w", job.Input, err)
+		}
+	} else {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(hdr)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("cannot attach the data: %w", err)
+		}
+		data = buf.Bytes()
+	}
+	pdf.SetAttachments([]Attachment{{Content: data, Filename: ac.fileName(job, p), Description: ac.Description}})
+	return nil
+}
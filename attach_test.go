@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// attachedFile returns the content of the file attached to a document
+// and the Filespec dictionary that names it.
+func attachedFile(t *testing.T, data []byte) (content string, spec []byte) {
+	t.Helper()
+	doc, err := readPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range doc.objects {
+		switch {
+		case bytes.Contains(o.dict, []byte("/Type /EmbeddedFile")):
+			r, err := zlib.NewReader(bytes.NewReader(o.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content = string(b)
+		case bytes.Contains(o.dict, []byte("/Type /Filespec")):
+			spec = o.dict
+		}
+	}
+	return content, spec
+}
+
+// utf16Name returns an ASCII name as a PDF text string in UTF-16.
+func utf16Name(name string) []byte {
+	b := []byte("(\xfe\xff")
+	for _, c := range []byte(name) {
+		b = append(b, 0, c)
+	}
+	return append(b, ')')
+}
+
+func TestAttachReportData(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Item,Total\nNorth,Apples,10\nSouth,\"Pears, green\",5\nNorth,Plums,3\n",
+		"cfg.json": `{"split": {"column": "Region"}, "attach": {"description": "Data"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "sales.pdf", Filter: "Total > 4"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		file, csv, name string
+	}{
+		{"sales-North.pdf", "Region,Item,Total\nNorth,Apples,10\n", "sales-North.csv"},
+		{"sales-South.pdf", "Region,Item,Total\nSouth,\"Pears, green\",5\n", "sales-South.csv"},
+	} {
+		content, spec := attachedFile(t, []byte(testFile(t, env, tt.file)))
+		if content != tt.csv {
+			t.Errorf("%s: attached %q, want %q", tt.file, content, tt.csv)
+		}
+		if !bytes.Contains(spec, utf16Name(tt.name)) || !bytes.Contains(spec, utf16Name("Data")) {
+			t.Errorf("%s: the attachment is not named %s: %q", tt.file, tt.name, spec)
+		}
+	}
+}
+
+func TestAttachOriginal(t *testing.T) {
+	input := "# export\nItem;Total\nApples;10\n"
+	env := testEnv(map[string]string{
+		"in.csv":   input,
+		"cfg.json": `{"attach": {"data": "original", "name": "export.txt"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Dialect: csvDialect{Delimiter: ";", Comment: "#"}}); err != nil {
+		t.Fatal(err)
+	}
+	content, spec := attachedFile(t, []byte(testFile(t, env, "out.pdf")))
+	if content != input || !bytes.Contains(spec, utf16Name("export.txt")) {
+		t.Errorf("attached %q as %q, want the input file as export.txt", content, spec)
+	}
+
+	ac := &AttachConfig{Data: "original"}
+	if got := ac.fileName(&Job{Input: "data/sales.tsv"}, &part{output: "out.pdf"}); got != "sales.csv" {
+		t.Errorf("fileName = %q, want sales.csv", got)
+	}
+}
+
+func TestAttachConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"attach": {"data": "all"}}`, `unknown data "all"; use report or original`},
+		{`{"attach": {"data": "original"}, "split": {"column": "Region"}}`, "original data can be attached to single reports from a file only"},
+		{`{"attach": {}, "archive": {}}`, "PDF/A does not allow attachments"},
+	} {
+		env := testEnv(map[string]string{"in.csv": "Region,Total\nNorth,1\n", "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), "attach: "+tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+// Backend is what the table is drawn with: `header()`, `table()`, the
+// cells they print, and cell renderers use these methods of the
+// document only. The *Fpdf of either backend implements it.
+type Backend interface {
+	// Pages
+	AddPageFormat(orientationStr string, size SizeType)
+	PageNo() int
+	GetPageSize() (width, height float64)
+	GetMargins() (left, top, right, bottom float64)
+	GetAutoPageBreak() (auto bool, margin float64)
+	SetAutoPageBreak(auto bool, margin float64)
+	GetConversionRatio() float64
+
+	// The current position
+	GetX() float64
+	GetY() float64
+	GetXY() (float64, float64)
+	SetX(x float64)
+	SetXY(x, y float64)
+	Ln(h float64)
+
+	// Cells and text
+	CellFormat(w, h float64, txtStr, borderStr string, ln int, alignStr string, fill bool, link int, linkStr string)
+	GetCellMargin() float64
+	SetCellMargin(margin float64)
+	Text(x, y float64, txtStr string)
+	SplitLines(txt []byte, w float64) [][]byte
+	GetStringWidth(s string) float64
+	SetFont(familyStr, styleStr string, size float64)
+	SetFontStyle(styleStr string)
+	SetFontSize(size float64)
+	GetFontSize() (ptSize, unitSize float64)
+	LinkString(x, y, w, h float64, linkStr string)
+	RawWriteStr(str string)
+
+	// Shapes
+	Line(x1, y1, x2, y2 float64)
+	Rect(x, y, w, h float64, styleStr string)
+	RoundedRect(x, y, w, h, r float64, corners string, stylestr string)
+	Circle(x, y, r float64, styleStr string)
+	Polygon(points []PointType, styleStr string)
+	TransformBegin()
+	TransformRotate(angle, x, y float64)
+	TransformEnd()
+
+	// Colors and lines
+	GetDrawColor() (int, int, int)
+	SetDrawColor(r, g, b int)
+	GetFillColor() (int, int, int)
+	SetFillColor(r, g, b int)
+	GetTextColor() (int, int, int)
+	SetTextColor(r, g, b int)
+	GetLineWidth() float64
+	SetLineWidth(width float64)
+	SetDashPattern(dashArray []float64, dashPhase float64)
+
+	// Errors
+	Err() bool
+	SetError(err error)
+}
+
+var _ Backend = (*Fpdf)(nil)
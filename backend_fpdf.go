@@ -0,0 +1,25 @@
+//go:build fpdf
+// +build fpdf
+
+package main
+
+import (
+	"github.com/go-pdf/fpdf"
+)
+
+// The go-pdf/fpdf backend; see backend_gofpdf.go.
+
+// The types of the backend that the report uses.
+type (
+	Fpdf         = fpdf.Fpdf
+	PointType    = fpdf.PointType
+	SizeType     = fpdf.SizeType
+	ImageOptions = fpdf.ImageOptions
+	Attachment   = fpdf.Attachment
+)
+
+// newPDF creates a document; see fpdf.New.
+var newPDF = fpdf.New
+
+// fastCells disables cellWriter, which knows the output of gofpdf only.
+const fastCells = false
@@ -0,0 +1,49 @@
+//go:build !fpdf
+// +build !fpdf
+
+package main
+
+import (
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ## Backends
+
+// gofpdf is archived: it gets no more fixes. Its maintained fork,
+// go-pdf/fpdf, has the same API under another import path, so the
+// report needs no changes to use it -- only other names for the types
+// and the constructor. The report code uses the names below, and the
+// build selects the package behind them:
+//
+//	go build -tags fpdf
+//
+// Without the tag, the tool is built with gofpdf, as before.
+//
+// The table is drawn through an interface, `Backend`, with the methods
+// it needs, so that the table code does not depend on either package.
+// Cell renderers get a Backend as well. The rest of the document, such
+// as the images, the templates, and the pages of render hooks, uses an
+// `*Fpdf` of the selected package: those methods take and return the
+// package's own types, such as ImageOptions, so no interface covers
+// both packages without wrapping them. For the same reason, the backend
+// is chosen at build time, not at runtime. The engine "gofpdf" of
+// `-engine` means the layout engine of the selected backend. Libraries
+// with other models, such as pdfcpu, which edits PDF files rather than
+// drawing them, or maroto, which lays out grids on top of gofpdf, would
+// need a report written for them and are not backends.
+
+// The types of the backend that the report uses.
+type (
+	Fpdf         = gofpdf.Fpdf
+	PointType    = gofpdf.PointType
+	SizeType     = gofpdf.SizeType
+	ImageOptions = gofpdf.ImageOptions
+	Attachment   = gofpdf.Attachment
+)
+
+// newPDF creates a document; see gofpdf.New.
+var newPDF = gofpdf.New
+
+// fastCells enables cellWriter, which writes table cells the way gofpdf
+// does.
+const fastCells = true
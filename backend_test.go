@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lineRecorder is a Backend that records the lines it moves down by.
+type lineRecorder struct {
+	Backend
+	lines []float64
+}
+
+func (lr *lineRecorder) Ln(h float64) {
+	lr.lines = append(lr.lines, h)
+	lr.Backend.Ln(h)
+}
+
+func TestTableBackend(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"columns": [{"name": "Comment", "width": 30, "overflow": "wrap"}]}`)})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := []string{"Item", "Comment"}
+	if err := cfg.resolve(hdr); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{{"Apples", strings.Repeat("late again ", 4)}, {"Pears", "fine"}}
+
+	pdf := newPDF("P", "mm", "A4", "")
+	pdf.AddPage()
+	rec := &lineRecorder{Backend: pdf}
+	prog := &progress{}
+	header(rec, hdr, cfg, prog)
+	table(rec, rows, cfg, nil, prog)
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	pdf.SetFont("Times", "", 16)
+	_, wrapped := wrapRow(pdf, cfg, rows[0], 7)
+	if want := []float64{-1, wrapped, 7}; !reflect.DeepEqual(rec.lines, want) || wrapped <= 7 {
+		t.Errorf("the table moved down by %v, want %v", rec.lines, want)
+	}
+}
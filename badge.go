@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ## Status badges
+
+// Columns with a small set of values, such as an order status, read
+// best as colored badges, the way our web UI shows them. A column's
+// badge map assigns a color and, optionally, a label to each value;
+// values without an entry are printed as plain text.
+//
+//	"badges": {"shipped": {"color": "#2e7d32"}, "hold": {"color": "#c62828", "label": "On hold"}}
+
+// Badge describes the badge of one value.
+type Badge struct {
+	// Color is the background color as "#rrggbb".
+	Color string `json:"color"`
+
+	// TextColor is the text color. Default: white or black, whichever
+	// contrasts better with Color.
+	TextColor string `json:"textColor"`
+
+	// Label replaces the value. Default: the value itself.
+	Label string `json:"label"`
+
+	bg, fg [3]int
+}
+
+// prepare parses the colors.
+func (b *Badge) prepare() error {
+	var err error
+	if b.bg, err = parseColor(b.Color); err != nil {
+		return err
+	}
+	if b.TextColor == "" {
+		b.fg = contrastColor(b.bg)
+		return nil
+	}
+	b.fg, err = parseColor(b.TextColor)
+	return err
+}
+
+// contrastColor returns black or white, whichever is easier to read on bg.
+func contrastColor(bg [3]int) [3]int {
+	// Perceived brightness, see https://www.w3.org/TR/AERT/#color-contrast
+	if (bg[0]*299+bg[1]*587+bg[2]*114)/1000 > 150 {
+		return [3]int{0, 0, 0}
+	}
+	return [3]int{255, 255, 255}
+}
+
+// parseColor parses a color written as "#rrggbb".
+func parseColor(s string) ([3]int, error) {
+	var c [3]int
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 || !strings.HasPrefix(s, "#") {
+		return c, fmt.Errorf("color %q: use the form #rrggbb", s)
+	}
+	for i := range c {
+		v, err := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return c, fmt.Errorf("color %q: use the form #rrggbb", s)
+		}
+		c[i] = int(v)
+	}
+	return c, nil
+}
+
+// badgeCell prints a table cell with a rounded badge inside, aligned
+// within the cell like text.
+func badgeCell(pdf Backend, b Badge, w, h float64, value, border, align string, fill bool) {
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+
+	label := b.Label
+	if label == "" {
+		label = value
+	}
+	size, _ := pdf.GetFontSize()
+	pdf.SetFontSize(size * 0.75)
+	pw := pdf.GetStringWidth(label) + 4
+	ph := h - 2
+	px := x + 1
+	switch align {
+	case "C":
+		px = x + (w-pw)/2
+	case "R":
+		px = x + w - pw - 1
+	}
+
+	fr, fg, fb := pdf.GetFillColor()
+	tr, tg, tb := pdf.GetTextColor()
+	pdf.SetFillColor(b.bg[0], b.bg[1], b.bg[2])
+	pdf.RoundedRect(px, y+1, pw, ph, ph/2, "1234", "F")
+	pdf.SetTextColor(b.fg[0], b.fg[1], b.fg[2])
+	pdf.SetXY(px, y+1)
+	pdf.CellFormat(pw, ph, label, "", 0, "C", false, 0, "")
+
+	pdf.SetFillColor(fr, fg, fb)
+	pdf.SetTextColor(tr, tg, tb)
+	pdf.SetFontSize(size)
+	pdf.SetXY(x+w, y)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string][3]int{"#2e7d32": {46, 125, 50}, "#FFFFFF": {255, 255, 255}, "#000000": {}} {
+		if got, err := parseColor(s); err != nil || got != want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "2e7d32", "#2e7d3", "#2e7d3g", "#+1+1+1", "red"} {
+		if _, err := parseColor(s); err == nil || !strings.Contains(err.Error(), "use the form #rrggbb") {
+			t.Errorf("parseColor(%q): %v", s, err)
+		}
+	}
+}
+
+func TestContrastColor(t *testing.T) {
+	white, black := [3]int{255, 255, 255}, [3]int{}
+	for bg, want := range map[[3]int][3]int{
+		{46, 125, 50}:   white, // dark green
+		{198, 40, 40}:   white, // red
+		{255, 235, 59}:  black, // yellow
+		{240, 240, 240}: black,
+	} {
+		if got := contrastColor(bg); got != want {
+			t.Errorf("contrastColor(%v) = %v, want %v", bg, got, want)
+		}
+	}
+}
+
+func TestBadges(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Status\nApples,shipped\nPears,hold\nPlums,open\n",
+		"cfg.json": `{"columns": [{"name": "Status", "badges": {
+			"shipped": {"color": "#2e7d32"},
+			"hold": {"color": "#ffeb3b", "label": "On hold"}}}]}`,
+		"bad.json": `{"columns": [{"name": "Status", "badges": {"hold": {"color": "#ffeb3b", "textColor": "black"}}}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, want := range []string{
+		// Green and yellow badges, and plain text for a value without
+		// a badge.
+		"0.180 0.490 0.196 rg",
+		"1.000 0.922 0.231 rg",
+		"(open)Tj",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the report lacks %q", want)
+		}
+	}
+	// White text on green, black text on yellow.
+	for _, re := range []string{`q 1\.000 g BT [\d. ]+ Td \(shipped\)Tj`, `q 0\.000 g BT [\d. ]+ Td \(On hold\)Tj`} {
+		if !regexp.MustCompile(re).MatchString(content) {
+			t.Errorf("the report lacks %s", re)
+		}
+	}
+	if strings.Contains(content, "(hold)Tj") {
+		t.Error("the label does not replace the value")
+	}
+	if !strings.Contains(content, " c \n") {
+		t.Error("the badges are not rounded")
+	}
+
+	err := generate(env, &Job{Input: "in.csv", Config: "bad.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), `column "Status": badge "hold": color "black": use the form #rrggbb`) {
+		t.Errorf("invalid text color: %v", err)
+	}
+}
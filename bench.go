@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// ## Benchmarks
+
+// Large tables take a while, and whether a change makes them faster or
+// slower is hard to tell from a single run. The `bench` subcommand
+// renders a table of made-up rows, entirely in memory, and reports how
+// many rows per second it managed:
+//
+//	pdf bench                                200,000 rows, 20 columns
+//	pdf bench -rows 50000 -columns 8 -runs 3
+//	pdf bench -config daily.json -cpuprofile cpu.out
+//
+// The rows mix text, numbers, and dates, and repeat their values the way
+// real data does. Their columns are named "Column 1", "Column 2", and so
+// on. With -config, the table is rendered with that configuration, which
+// may use fonts and other files from disk. -engine selects the engine
+// as in a normal run; it defaults to gofpdf, because the direct engine
+// is fast anyway. `go test -bench .` runs the same tables, smaller, as
+// benchmarks, along with benchmarks of single cells.
+
+// benchCommand runs the bench subcommand and writes the results to w.
+func benchCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	rows := fs.Int("rows", 200000, "number of rows")
+	cols := fs.Int("columns", 20, "number of columns")
+	runs := fs.Int("runs", 1, "number of runs")
+	config := fs.String("config", "", "render with this JSON report configuration")
+	engine := fs.String("engine", "gofpdf", "PDF engine: gofpdf, direct, or auto")
+	cpuProfile := fs.String("cpuprofile", "", "write a CPU profile of the runs to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *rows < 1 || *cols < 1 || *runs < 1 {
+		return fmt.Errorf("rows, columns, and runs must be 1 or more")
+	}
+
+	files := map[string][]byte{"bench.csv": benchCSV(*rows, *cols), "stats.png": benchPNG()}
+	if *config != "" {
+		data, err := ioutil.ReadFile(*config)
+		if err != nil {
+			return err
+		}
+		files["bench.json"] = data
+	}
+	fsys := NewMemFS(files)
+	env := &Env{Clock: FixedClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), FS: benchFS{fsys}, Stdout: ioutil.Discard,
+		Resources: NewResourceCache()}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+	}
+	fmt.Fprintf(w, "%d rows, %d columns, engine %s\n", *rows, *cols, *engine)
+	for i := 1; i <= *runs; i++ {
+		job := &Job{Input: "bench.csv", Output: "bench.pdf", Engine: *engine}
+		if *config != "" {
+			job.Config = "bench.json"
+		}
+		start := time.Now()
+		if err := generate(env, job); err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+		data, _ := fsys.File("bench.pdf")
+		fmt.Fprintf(w, "run %d: %v, %.0f rows/s, %.0f cells/s, %d KB\n", i, elapsed.Round(time.Millisecond),
+			float64(*rows)/elapsed.Seconds(), float64(*rows**cols)/elapsed.Seconds(), len(data)/1024)
+	}
+	return nil
+}
+
+// benchFS keeps the files of a benchmark in memory, and reads other
+// files, such as the fonts of the configuration, from disk.
+type benchFS struct {
+	*MemFS
+}
+
+func (b benchFS) Open(name string) (io.ReadCloser, error) {
+	if _, ok := b.File(name); ok {
+		return b.MemFS.Open(name)
+	}
+	return os.Open(name)
+}
+
+// benchCSV returns a CSV table with the given numbers of rows and
+// columns. Every fourth column holds numbers, every fourth dates, and the
+// others words from a small vocabulary.
+func benchCSV(rows, cols int) []byte {
+	words := []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo", "Foxtrot", "Golf", "Hotel", "India", "Juliett", "Kilo", "Lima"}
+	rnd := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, cols)
+	for c := range record {
+		record[c] = "Column " + strconv.Itoa(c+1)
+	}
+	w.Write(record)
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for r := 0; r < rows; r++ {
+		for c := range record {
+			switch c % 4 {
+			case 1:
+				record[c] = strconv.FormatFloat(float64(rnd.Intn(1000000))/100, 'f', 2, 64)
+			case 2:
+				record[c] = day.AddDate(0, 0, rnd.Intn(365)).Format("2006-01-02")
+			case 3:
+				record[c] = strconv.Itoa(rnd.Intn(100))
+			default:
+				record[c] = words[rnd.Intn(len(words))]
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// benchPNG returns a small image in place of the chart of the report.
+func benchPNG() []byte {
+	img := stdimage.NewGray(stdimage.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.Set(4, 4, color.Black)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
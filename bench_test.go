@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// The benchmarks measure what `pdf bench` does, for `go test -bench`:
+//
+//	go test -bench . -benchmem
+//	go test -tags fpdf -bench Cell
+//
+// BenchmarkCellWriter and BenchmarkCellFormat print the same cells; the
+// first with cellWriter, and the second the long way. With the fpdf
+// tag, cellWriter is disabled and both take the long way.
+
+// benchmarkTable renders a table of rows made-up rows with 20 columns
+// with the given engine.
+func benchmarkTable(b *testing.B, rows int, engine string) {
+	fsys := NewMemFS(map[string][]byte{"bench.csv": benchCSV(rows, 20), "stats.png": benchPNG()})
+	env := &Env{Clock: FixedClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), FS: fsys, Stdout: ioutil.Discard,
+		Resources: NewResourceCache()}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := generate(env, &Job{Input: "bench.csv", Output: "bench.pdf", Engine: engine}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTableGofpdf(b *testing.B) { benchmarkTable(b, 10000, "gofpdf") }
+func BenchmarkTableDirect(b *testing.B) { benchmarkTable(b, 10000, "direct") }
+
+// benchmarkCells prints rows of 20 cells, with cellWriter if fast is
+// true, until the page is full, and then starts a new page.
+func benchmarkCells(b *testing.B, fast bool) {
+	pdf := newPDF("L", "mm", "A4", "")
+	pdf.SetFont("Times", "", 8)
+	pdf.SetFillColor(240, 240, 240)
+	cw := newCellWriter(pdf, &Config{})
+	texts := []string{"Alpha", "1234.56", "2024-01-02", "42"}
+	aligns := []string{"L", "R", "C", "R"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%20 == 0 {
+			if pdf.GetY() > 180 || i == 0 {
+				pdf.AddPage()
+			}
+			pdf.Ln(-1)
+			cw.row()
+		}
+		text, align := texts[i%4], aligns[i%4]
+		if !fast || !cw.cell("", 13, 5, text, "1", align, i%40 < 20) {
+			pdf.CellFormat(13, 5, text, "1", 0, align, i%40 < 20, 0, "")
+		}
+	}
+	if err := pdf.Error(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkCellWriter(b *testing.B) { benchmarkCells(b, true) }
+func BenchmarkCellFormat(b *testing.B) { benchmarkCells(b, false) }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ## Transform caches
+
+// A column of customer cities holds the same few dozen names on every
+// page, and geocoding each cell again would dominate the time a report
+// takes. A column's cache keeps the result of its transformations per
+// input value, across the rows of a report and, with a file, across
+// runs:
+//
+//	{"name": "City", "transform": [{"op": "fetch", "url": "..."}],
+//	 "cache": {"file": "city.cache.json", "ttl": "720h"}}
+//
+// Entries expire after the TTL; without one, they are kept for good.
+// Columns that fetch are cached in memory even without a cache setting.
+// Failed lookups leave the value unchanged and are not stored, so they
+// are tried again in the next run. A cache file belongs to one column,
+// and it starts over when the column's transformations change. Like
+// width locks, cache files are encrypted with the artifact key.
+
+// TransformCache caches the transformations of a column.
+type TransformCache struct {
+	// File is the path of the cache file. Default: memory only.
+	File string `json:"file"`
+
+	// TTL is how long entries are valid, such as "24h".
+	TTL string `json:"ttl"`
+
+	ttl         time.Duration
+	fingerprint string
+	now         time.Time
+	limit       int // of entries in memory; see cacheLimit
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	changed bool
+	failed  int
+	lastErr error
+}
+
+// cacheEntry is a cached result.
+type cacheEntry struct {
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+
+	failed bool
+}
+
+// cacheFile is the content of a cache file. Transform is a hash of the
+// transformations the entries come from.
+type cacheFile struct {
+	Transform string                `json:"transform"`
+	Entries   map[string]cacheEntry `json:"entries"`
+}
+
+// prepareCache checks the cache settings of a column and sets up a
+// memory cache for columns that fetch.
+func (cc *ColumnConfig) prepareCache() error {
+	if cc.Cache == nil {
+		for _, t := range cc.Transform {
+			if t.Op == "fetch" {
+				cc.Cache = &TransformCache{}
+				break
+			}
+		}
+	}
+	tc := cc.Cache
+	if tc == nil {
+		return nil
+	}
+	if tc.TTL != "" {
+		d, err := time.ParseDuration(tc.TTL)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("cache: invalid ttl %q", tc.TTL)
+		}
+		tc.ttl = d
+	}
+	b, err := json.Marshal(cc.Transform)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	tc.fingerprint = hex.EncodeToString(sum[:])
+	tc.entries = map[string]cacheEntry{}
+	return nil
+}
+
+// loadCaches reads the cache files of the columns. Missing files are
+// not an error.
+func (c *Config) loadCaches(env *Env) error {
+	n := 0
+	for _, cc := range c.Columns {
+		if cc.Cache != nil {
+			n++
+		}
+	}
+	for _, cc := range c.Columns {
+		tc := cc.Cache
+		if tc == nil {
+			continue
+		}
+		tc.now = env.Clock.Now()
+		tc.limit = env.cacheLimit(n)
+		if tc.File == "" {
+			continue
+		}
+		data, err := readArtifact(env.FS, c.artifactKey, tc.File)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read cache '%s': %w", tc.File, err)
+		}
+		var file cacheFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("cannot read cache '%s': %w", tc.File, err)
+		}
+		if file.Transform != tc.fingerprint {
+			env.Log.Info("transformations changed, cache starts over", "cache", tc.File)
+			continue
+		}
+		for value, e := range file.Entries {
+			if tc.valid(e) && !tc.full() {
+				tc.entries[value] = e
+			}
+		}
+	}
+	return nil
+}
+
+// saveCaches writes the cache files that have new entries and reports
+// failed lookups.
+func (c *Config) saveCaches(env *Env) {
+	for _, cc := range c.Columns {
+		tc := cc.Cache
+		if tc == nil {
+			continue
+		}
+		if tc.failed > 0 {
+			env.Log.Warn("transformations failed, values left unchanged", "column", cc.label(), "values", tc.failed, "err", tc.lastErr)
+		}
+		if tc.File == "" || !tc.changed {
+			continue
+		}
+		file := cacheFile{Transform: tc.fingerprint, Entries: map[string]cacheEntry{}}
+		for value, e := range tc.entries {
+			if !e.failed {
+				file.Entries[value] = e
+			}
+		}
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err == nil {
+			err = writeArtifact(env.FS, c.artifactKey, tc.File, data)
+		}
+		if err != nil {
+			env.Log.Warn("cannot save cache", "cache", tc.File, "err", err)
+		}
+	}
+}
+
+// full reports whether the cache may not take more entries.
+func (tc *TransformCache) full() bool {
+	return tc.limit > 0 && len(tc.entries) >= tc.limit
+}
+
+// valid reports whether e has not expired.
+func (tc *TransformCache) valid(e cacheEntry) bool {
+	return tc.ttl == 0 || tc.now.Sub(e.Time) < tc.ttl
+}
+
+// transform applies ts to str, or returns the cached result.
+func (tc *TransformCache) transform(str string, ts []TextTransform) string {
+	if tc == nil {
+		out, _ := transformText(str, ts)
+		return out
+	}
+	tc.mu.Lock()
+	e, ok := tc.entries[str]
+	tc.mu.Unlock()
+	if ok {
+		return e.Value
+	}
+
+	// Lookups run outside the lock; parts of a split report may ask for
+	// the same value at the same time, which costs a second lookup only.
+	out, err := transformText(str, ts)
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if err != nil {
+		// Failures are remembered for this run only.
+		tc.failed++
+		tc.lastErr = err
+		if !tc.full() {
+			tc.entries[str] = cacheEntry{Value: out, failed: true}
+		}
+		return out
+	}
+	if tc.full() {
+		return out
+	}
+	tc.entries[str] = cacheEntry{Value: out, Time: tc.now}
+	tc.changed = true
+	return out
+}
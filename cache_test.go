@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// geoServer looks up the country of a few cities and counts the
+// lookups of each.
+type geoServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	lookups map[string]int
+}
+
+func newGeoServer() *geoServer {
+	gs := &geoServer{lookups: map[string]int{}}
+	countries := map[string]string{"Paris": "FR", "Berlin": "DE"}
+	gs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		city := r.URL.Query().Get("q")
+		gs.mu.Lock()
+		gs.lookups[city]++
+		gs.mu.Unlock()
+		country, ok := countries[city]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"country": %q}]}`, country)
+	}))
+	return gs
+}
+
+// calls returns and forgets the lookups so far.
+func (gs *geoServer) calls() map[string]int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	calls := gs.lookups
+	gs.lookups = map[string]int{}
+	return calls
+}
+
+func TestTransformCache(t *testing.T) {
+	gs := newGeoServer()
+	defer gs.Close()
+	config := func(ttl string) string {
+		return `{"columns": [{"name": "City", "transform": [{"op": "fetch", "url": "` + gs.URL + `/geo?q={value}", "path": "results.0.country"}],
+			"cache": {"file": "city.cache.json", "ttl": "` + ttl + `"}}], "textVersion": {"format": "text"}}`
+	}
+	env := testEnv(map[string]string{
+		"in.csv":   "City,Total\nParis,1\nBerlin,2\nParis,3\nAtlantis,4\nAtlantis,5\n",
+		"cfg.json": config("24h"),
+	})
+	run := func() {
+		t.Helper()
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func() []string {
+		t.Helper()
+		var file cacheFile
+		if err := json.Unmarshal([]byte(testFile(t, env, "city.cache.json")), &file); err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for k, e := range file.Entries {
+			values = append(values, k+"="+e.Value)
+		}
+		sort.Strings(values)
+		return values
+	}
+
+	run()
+	if got, want := gs.calls(), map[string]int{"Paris": 1, "Berlin": 1, "Atlantis": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first run looked up %v, want %v", got, want)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"FR", "DE", "Atlantis"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+	if got, want := cached(), []string{"Berlin=DE", "Paris=FR"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cache file holds %q, want %q", got, want)
+	}
+
+	// Failed lookups are tried again, cached ones are not.
+	run()
+	if got, want := gs.calls(), map[string]int{"Atlantis": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second run looked up %v, want %v", got, want)
+	}
+
+	// Entries expire after the TTL.
+	env.Clock = FixedClock(testTime.Add(25 * time.Hour))
+	run()
+	if got, want := gs.calls(), map[string]int{"Paris": 1, "Berlin": 1, "Atlantis": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("run after the TTL looked up %v, want %v", got, want)
+	}
+
+	// Changed transformations start over.
+	f, err := env.FS.Create("cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(strings.Replace(config("48h"), `"path"`, `"headers": {"Accept": "application/json"}, "path"`, 1)))
+	f.Close()
+	run()
+	if got, want := gs.calls(), map[string]int{"Paris": 1, "Berlin": 1, "Atlantis": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("run with new transformations looked up %v, want %v", got, want)
+	}
+}
+
+func TestTransformCacheConfig(t *testing.T) {
+	cc := &ColumnConfig{Transform: []TextTransform{{Op: "upper"}}}
+	if err := cc.prepareCache(); err != nil || cc.Cache != nil {
+		t.Errorf("a column without fetch has a cache: %v", err)
+	}
+	cc = &ColumnConfig{Transform: []TextTransform{{Op: "fetch", URL: "http://x/{value}"}}}
+	if err := cc.prepareCache(); err != nil || cc.Cache == nil || cc.Cache.File != "" {
+		t.Errorf("a column that fetches has no memory cache: %v", err)
+	}
+	for _, ttl := range []string{"soon", "-1h", "0s"} {
+		cc := &ColumnConfig{Cache: &TransformCache{TTL: ttl}}
+		if err := cc.prepareCache(); err == nil || !strings.Contains(err.Error(), "cache: invalid ttl") {
+			t.Errorf("ttl %q: %v", ttl, err)
+		}
+	}
+}
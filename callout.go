@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ## Callouts
+
+// A reader who sees a grand total of 9,200 may not remember that the
+// target was 10,000. A callout says so, in a box after the table that
+// shows only when its condition holds:
+//
+//	"callouts": [
+//	  {"when": "total(Total) < 10000", "text": "Revenue below target: {value}", "style": "error"},
+//	  {"when": "count(Total) > 500", "text": "A record month!", "style": "info"}]
+//
+// Conditions compare two expressions over the aggregated data, with <,
+// <=, >, >=, =, or !=. The expressions are those of computed columns,
+// but every column must be inside one of the functions total, avg, min,
+// max, or count. {value} in the text is replaced with the value of the
+// left expression. The style is "info" (default), "warning", or
+// "error", in blue, orange, and red -- or, in grayscale reports, with a
+// thin, a dashed, and a thick border.
+
+// CalloutConfig defines a callout.
+type CalloutConfig struct {
+	When  string `json:"when"`
+	Text  string `json:"text"`
+	Style string `json:"style"`
+
+	left, right exprNode
+	op          string
+}
+
+// calloutStyles are the fill and border colors of the styles.
+var calloutStyles = map[string][2][3]int{
+	"info":    {{225, 235, 250}, {60, 110, 190}},
+	"warning": {{255, 243, 205}, {220, 150, 0}},
+	"error":   {{250, 220, 220}, {200, 30, 30}},
+}
+
+func (cc *CalloutConfig) prepare() error {
+	if cc.Style == "" {
+		cc.Style = "info"
+	}
+	if _, ok := calloutStyles[cc.Style]; !ok {
+		return fmt.Errorf("unknown style %q; use info, warning, or error", cc.Style)
+	}
+	if cc.Text == "" {
+		return fmt.Errorf("text is required")
+	}
+	return nil
+}
+
+// resolve parses the condition. hdr includes the computed columns.
+func (cc *CalloutConfig) resolve(hdr []string, renamed map[string]string) error {
+	ops := []string{"<=", ">=", "!=", "==", "<", ">", "="}
+	depth, at := 0, -1
+	for i := 0; i < len(cc.When) && at < 0; i++ {
+		switch cc.When[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '<', '>', '=', '!':
+			if depth == 0 {
+				at = i
+			}
+		}
+	}
+	if at < 0 {
+		return fmt.Errorf("%q: missing comparison", cc.When)
+	}
+	for _, op := range ops {
+		if strings.HasPrefix(cc.When[at:], op) {
+			cc.op = op
+			break
+		}
+	}
+	if cc.op == "" {
+		return fmt.Errorf("%q: invalid comparison at position %d", cc.When, at+1)
+	}
+	var err error
+	for _, side := range []struct {
+		node *exprNode
+		src  string
+	}{{&cc.left, cc.When[:at]}, {&cc.right, cc.When[at+len(cc.op):]}} {
+		p := &exprParser{src: side.src, hdr: hdr, renamed: renamed}
+		if *side.node, err = p.parse(); err != nil {
+			return fmt.Errorf("%q: %s", cc.When, err)
+		}
+		if !aggregated(*side.node) {
+			return fmt.Errorf("%q: columns must be inside total, avg, min, max, or count", cc.When)
+		}
+	}
+	return nil
+}
+
+// aggregated reports whether n has the same value for all rows.
+func aggregated(n exprNode) bool {
+	switch n := n.(type) {
+	case columnNode:
+		return false
+	case binaryNode:
+		return aggregated(n.l) && aggregated(n.r)
+	case funcNode:
+		return aggregates[n.name]
+	}
+	return true
+}
+
+// holds evaluates the condition over rows and returns the value of the
+// left expression.
+func (cc *CalloutConfig) holds(rows [][]string) (bool, float64) {
+	// Without rows, the aggregates are those of a single empty row:
+	// zero for totals and counts.
+	if len(rows) == 0 {
+		rows = [][]string{nil}
+	}
+	l, r := cc.left.eval(rows)[0], cc.right.eval(rows)[0]
+	if math.IsNaN(l) || math.IsNaN(r) {
+		return cc.op == "!=", l
+	}
+	switch cc.op {
+	case "<":
+		return l < r, l
+	case "<=":
+		return l <= r, l
+	case ">":
+		return l > r, l
+	case ">=":
+		return l >= r, l
+	case "!=":
+		return l != r, l
+	}
+	return l == r, l
+}
+
+// message returns the text of the callout if its condition holds.
+func (cc *CalloutConfig) message(loc *locale, rows [][]string) (string, bool) {
+	ok, v := cc.holds(rows)
+	if !ok {
+		return "", false
+	}
+	value := ""
+	if !math.IsNaN(v) && !math.IsInf(v, 0) {
+		value = loc.number(loc.rounding.format(ratFromFloat(v), 2))
+	}
+	return strings.Replace(cc.Text, "{value}", value, -1), true
+}
+
+// callouts prints the callouts whose conditions hold.
+func callouts(pdf *Fpdf, cfg *Config, rows [][]string) *Fpdf {
+	loc := cfg.locale()
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	w := pageWidth - left - right
+	const pad, lh = 3, 6
+	for k := range cfg.Callouts {
+		cc := &cfg.Callouts[k]
+		text, ok := cc.message(loc, rows)
+		if !ok {
+			continue
+		}
+		text = loc.print(text)
+
+		pdf.SetFont("Times", "B", 12)
+		lines := pdf.SplitText(text, w-2*pad)
+		h := float64(len(lines))*lh + 2*pad
+		if h+4 > spaceLeft(pdf) {
+			addPage(pdf, "")
+		}
+		pdf.Ln(4)
+		colors := calloutStyles[cc.Style]
+		y := pdf.GetY()
+		pdf.SetFillColor(colors[0][0], colors[0][1], colors[0][2])
+		pdf.SetDrawColor(colors[1][0], colors[1][1], colors[1][2])
+		pdf.SetLineWidth(0.5)
+		if cfg.Grayscale {
+			calloutBorder(pdf, cc.Style)
+		}
+		pdf.RoundedRect(left, y, w, h, 3, "1234", "FD")
+		pdf.SetLineWidth(0.2)
+		if cfg.Grayscale {
+			pdf.SetDashPattern([]float64{}, 0)
+		}
+		pdf.SetDrawColor(0, 0, 0)
+		pdf.SetTextColor(colors[1][0], colors[1][1], colors[1][2])
+		for n, l := range lines {
+			pdf.SetXY(left+pad, y+pad+float64(n)*lh)
+			pdf.CellFormat(w-2*pad, lh, l, "", 0, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+		}
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetXY(left, y+h)
+	}
+	return pdf
+}
+
+// calloutBorder sets the border of a style for grayscale reports, where
+// the colors of the styles look alike.
+func calloutBorder(pdf *Fpdf, style string) {
+	switch style {
+	case "info":
+		pdf.SetLineWidth(0.3)
+	case "warning":
+		pdf.SetDashPattern([]float64{2, 1}, 0)
+	case "error":
+		pdf.SetLineWidth(1.2)
+	}
+}
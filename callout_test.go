@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalloutConfig(t *testing.T) {
+	hdr := []string{"Item", "Total", "Unit Price"}
+	tests := []struct {
+		cc  CalloutConfig
+		err string
+	}{
+		{CalloutConfig{When: "total(Total) < 10000", Text: "low"}, ""},
+		{CalloutConfig{When: "avg([Unit Price]) >= max(Total) / 2", Text: "high"}, ""},
+		{CalloutConfig{When: "count(Item) = 0", Text: "none", Style: "warning"}, ""},
+		{CalloutConfig{When: "total(Total) < 1", Text: "low", Style: "loud"}, `unknown style "loud"`},
+		{CalloutConfig{When: "total(Total) < 1"}, "text is required"},
+		{CalloutConfig{When: "total(Total)", Text: "t"}, `"total(Total)": missing comparison`},
+		{CalloutConfig{When: "total(Total) ! 1", Text: "t"}, `"total(Total) ! 1": invalid comparison at position 14`},
+		{CalloutConfig{When: "Total > 1", Text: "t"}, `"Total > 1": columns must be inside total, avg, min, max, or count`},
+		{CalloutConfig{When: "total(Total) > Total", Text: "t"}, `"total(Total) > Total": columns must be inside`},
+		{CalloutConfig{When: "total(Price) > 1", Text: "t"}, `"total(Price) > 1": `},
+	}
+	for _, tt := range tests {
+		cc := tt.cc
+		err := cc.prepare()
+		if err == nil {
+			err = cc.resolve(hdr, nil)
+		}
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tt.cc.When, err)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.cc.When, err, tt.err)
+		}
+	}
+	cc := CalloutConfig{Text: "t"}
+	if cc.prepare(); cc.Style != "info" {
+		t.Errorf("default style %q", cc.Style)
+	}
+}
+
+func TestCalloutMessage(t *testing.T) {
+	hdr := []string{"Item", "Total"}
+	rows := [][]string{{"a", "1234.5"}, {"b", "2"}, {"c", "n/a"}}
+	loc, err := newLocale("en", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		when   string
+		rows   [][]string
+		want   string
+		showed bool
+	}{
+		{"total(Total) < 10000", rows, "1236.50", true},
+		{"total(Total) > 10000", rows, "", false},
+		{"total(Total) <= 1236.5", rows, "1236.50", true},
+		{"min(Total) >= 2", rows, "2.00", true},
+		{"max(Total) == 1234.5", rows, "1234.50", true},
+		{"max(Total) = 1234.5", rows, "1234.50", true},
+		{"count(Total) != 2", rows, "", false},
+		{"avg(Total) > 0", rows, "618.25", true},
+		{"total(Total) = 0", nil, "0.00", true},
+		{"avg(Total) = 0", [][]string{{"a", "x"}}, "", false},
+		{"avg(Total) != 0", [][]string{{"a", "x"}}, "", true},
+	}
+	for _, tt := range tests {
+		cc := CalloutConfig{When: tt.when, Text: "value {value}"}
+		if err := cc.resolve(hdr, nil); err != nil {
+			t.Fatal(err)
+		}
+		text, ok := cc.message(loc, tt.rows)
+		if ok != tt.showed || (ok && text != "value "+tt.want) {
+			t.Errorf("%q: got %q, %v, want %q, %v", tt.when, text, ok, "value "+tt.want, tt.showed)
+		}
+	}
+}
+
+func TestCallouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		grayscale bool
+		want      []string
+	}{
+		{"color", false, []string{
+			"0.980 0.863 0.863 rg\n0.784 0.118 0.118 RG\n1.42 w\n",
+			"q 0.784 0.118 0.118 rg BT 39.69 401.47 Td (Below target: 1236.50)Tj",
+		}},
+		{"grayscale", true, []string{"3.40 w\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv(map[string]string{
+				"in.csv": "Item,Total\na,1234.5\nb,2\n",
+				"cfg.json": `{"callouts": [{"when": "total(Total) < 10000", "text": "Below target: {value}", "style": "error"},
+					{"when": "count(Total) > 5", "text": "Many rows"}]}`,
+			})
+			if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Grayscale: tt.grayscale}); err != nil {
+				t.Fatal(err)
+			}
+			content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+			for _, s := range tt.want {
+				if !strings.Contains(content, s) {
+					t.Errorf("missing %q in\n%s", s, content)
+				}
+			}
+			if !strings.Contains(content, "(Below target: 1236.50)Tj") || strings.Contains(content, "Many rows") {
+				t.Error("not only the callout whose condition holds is shown")
+			}
+		})
+	}
+}
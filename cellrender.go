@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ## Cell renderers
+
+// Badges, heat maps, and sparklines are built in; a traffic light for a
+// project status or a thermometer for a fill level is not, and should
+// not need a fork of the table code. A cell renderer draws the cells of
+// a column in its own way:
+//
+//	{"name": "Rating", "renderer": {"type": "stars", "settings": {"max": 5}}}
+//	{"name": "Done", "renderer": {"type": "progress", "settings": {"max": 100, "color": "#2e7d32"}}}
+//
+// "stars" draws a rating as filled and empty stars, "progress" a
+// value as a bar, with the value on it. A file of its own in this
+// package adds further types, like delivery targets:
+//
+//	func init() {
+//		RegisterCellRenderer("status", func(settings json.RawMessage) (CellRenderer, error) {
+//			return statusLights{}, nil
+//		})
+//	}
+//
+//	func (statusLights) RenderCell(pdf Backend, r CellRect, value string, ctx CellContext) {
+//		pdf.SetFillColor(...)
+//		pdf.Circle(r.X+r.W/2, r.Y+r.H/2, r.H/4, "F")
+//	}
+//
+// The table draws the border and the fill of the cell first; the
+// renderer draws the content. Colors, the line width, and the font may
+// be changed freely; the table restores them afterwards.
+
+// CellRect is the box of a cell in mm.
+type CellRect struct {
+	X, Y, W, H float64
+}
+
+// CellContext tells a renderer where the cell is.
+type CellContext struct {
+	Row    int      // the index of the row in the table
+	Column int      // the index of the column in Line
+	Line   []string // the values of the row
+	Text   string   // the value, formatted like a text cell
+	Align  string   // "L", "C", or "R"
+}
+
+// CellRenderer draws the content of table cells.
+type CellRenderer interface {
+	RenderCell(pdf Backend, r CellRect, value string, ctx CellContext)
+}
+
+// CellRendererFactory creates a CellRenderer from its settings.
+type CellRendererFactory func(settings json.RawMessage) (CellRenderer, error)
+
+// cellRenderers holds the renderer types by name.
+var cellRenderers = map[string]CellRendererFactory{}
+
+// RegisterCellRenderer adds a renderer type. It panics if the name is
+// taken.
+func RegisterCellRenderer(name string, f CellRendererFactory) {
+	if _, ok := cellRenderers[name]; ok {
+		panic(fmt.Sprintf("cell renderer %q registered twice", name))
+	}
+	cellRenderers[name] = f
+}
+
+func init() {
+	RegisterCellRenderer("stars", func(settings json.RawMessage) (CellRenderer, error) {
+		sr := starRenderer{Max: 5, Color: "#f5a623"}
+		if err := DecodeSettings(settings, &sr); err != nil {
+			return nil, err
+		}
+		if sr.Max <= 0 || sr.Max > 20 {
+			return nil, fmt.Errorf("max must be between 1 and 20")
+		}
+		var err error
+		sr.color, err = parseColor(sr.Color)
+		return &sr, err
+	})
+	RegisterCellRenderer("progress", func(settings json.RawMessage) (CellRenderer, error) {
+		pr := progressRenderer{Max: 100, Color: "#1976d2"}
+		if err := DecodeSettings(settings, &pr); err != nil {
+			return nil, err
+		}
+		if pr.Max <= 0 {
+			return nil, fmt.Errorf("max must be positive")
+		}
+		var err error
+		pr.color, err = parseColor(pr.Color)
+		return &pr, err
+	})
+}
+
+// RendererConfig selects the renderer of a column.
+type RendererConfig struct {
+	Type     string          `json:"type"`
+	Settings json.RawMessage `json:"settings"`
+
+	renderer CellRenderer
+}
+
+func (rc *RendererConfig) prepare() error {
+	f, ok := cellRenderers[rc.Type]
+	if !ok {
+		var names []string
+		for name := range cellRenderers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown renderer %q; use one of %s", rc.Type, strings.Join(names, ", "))
+	}
+	var err error
+	rc.renderer, err = f(rc.Settings)
+	return err
+}
+
+// renderedCell prints a table cell whose content a renderer draws.
+func renderedCell(pdf Backend, rc *RendererConfig, w, h float64, value, border string, fill bool, ctx CellContext) {
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+
+	dr, dg, db := pdf.GetDrawColor()
+	fr, fg, fb := pdf.GetFillColor()
+	tr, tg, tb := pdf.GetTextColor()
+	lw := pdf.GetLineWidth()
+	size, _ := pdf.GetFontSize()
+	rc.renderer.RenderCell(pdf, CellRect{X: x, Y: y, W: w, H: h}, value, ctx)
+	pdf.SetDrawColor(dr, dg, db)
+	pdf.SetFillColor(fr, fg, fb)
+	pdf.SetTextColor(tr, tg, tb)
+	pdf.SetLineWidth(lw)
+	pdf.SetFont("Times", "", size)
+	pdf.SetXY(x+w, y)
+}
+
+// starRenderer draws a rating as stars.
+type starRenderer struct {
+	// Max is the number of stars. Default: 5.
+	Max int `json:"max"`
+
+	// Color is the color of the stars. Default: "#f5a623".
+	Color string `json:"color"`
+
+	color [3]int
+}
+
+func (sr *starRenderer) RenderCell(pdf Backend, r CellRect, value string, ctx CellContext) {
+	v, ok := cellNumber(ctx.Line, ctx.Column)
+	if !ok {
+		return
+	}
+	n := int(math.Round(math.Max(0, math.Min(v, float64(sr.Max)))))
+	d := math.Min(r.H-2, (r.W-2)/float64(sr.Max))
+	x := r.X + 1
+	switch ctx.Align {
+	case "C":
+		x = r.X + (r.W-d*float64(sr.Max))/2
+	case "R":
+		x = r.X + r.W - 1 - d*float64(sr.Max)
+	}
+	pdf.SetDrawColor(sr.color[0], sr.color[1], sr.color[2])
+	pdf.SetFillColor(sr.color[0], sr.color[1], sr.color[2])
+	pdf.SetLineWidth(0.2)
+	for k := 0; k < sr.Max; k++ {
+		style := "D"
+		if k < n {
+			style = "FD"
+		}
+		pdf.Polygon(starPoints(x+d*(float64(k)+0.5), r.Y+r.H/2, d*0.45), style)
+	}
+}
+
+// starPoints returns the corners of a five-pointed star around cx, cy
+// with the outer radius r.
+func starPoints(cx, cy, r float64) []PointType {
+	pts := make([]PointType, 10)
+	for k := range pts {
+		rk := r
+		if k%2 == 1 {
+			rk = r * 0.4
+		}
+		a := -math.Pi/2 + float64(k)*math.Pi/5
+		pts[k] = PointType{X: cx + rk*math.Cos(a), Y: cy + rk*math.Sin(a)}
+	}
+	return pts
+}
+
+// progressRenderer draws a value as a bar.
+type progressRenderer struct {
+	// Max is the value of a full bar. Default: 100.
+	Max float64 `json:"max"`
+
+	// Color is the color of the bar. Default: "#1976d2".
+	Color string `json:"color"`
+
+	color [3]int
+}
+
+func (pr *progressRenderer) RenderCell(pdf Backend, r CellRect, value string, ctx CellContext) {
+	v, ok := cellNumber(ctx.Line, ctx.Column)
+	if !ok {
+		return
+	}
+	share := math.Max(0, math.Min(v/pr.Max, 1))
+	bx, by, bw, bh := r.X+1, r.Y+1.5, r.W-2, r.H-3
+	pdf.SetFillColor(230, 230, 230)
+	pdf.Rect(bx, by, bw, bh, "F")
+	pdf.SetFillColor(pr.color[0], pr.color[1], pr.color[2])
+	if share > 0 {
+		pdf.Rect(bx, by, bw*share, bh, "F")
+	}
+	size, _ := pdf.GetFontSize()
+	pdf.SetFontSize(size * 0.7)
+	fg := contrastColor(pr.color)
+	if share < 0.5 {
+		fg = [3]int{0, 0, 0}
+	}
+	pdf.SetTextColor(fg[0], fg[1], fg[2])
+	pdf.SetXY(bx, by)
+	pdf.CellFormat(bw, bh, ctx.Text, "", 0, "C", false, 0, "")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// contextRenderer records the cells it renders and draws in red.
+type contextRenderer struct {
+	cells []CellContext
+}
+
+func (cr *contextRenderer) RenderCell(pdf Backend, r CellRect, value string, ctx CellContext) {
+	cr.cells = append(cr.cells, ctx)
+	pdf.SetDrawColor(255, 0, 0)
+	pdf.SetFillColor(255, 0, 0)
+	pdf.SetTextColor(255, 0, 0)
+	pdf.SetLineWidth(1)
+	pdf.SetFont("Courier", "B", 8)
+	pdf.Rect(r.X+1, r.Y+1, r.W-2, r.H-2, "F")
+}
+
+// testRenderer is the renderer of type "test".
+var testRenderer = &contextRenderer{}
+
+func init() {
+	RegisterCellRenderer("test", func(settings json.RawMessage) (CellRenderer, error) {
+		return testRenderer, nil
+	})
+}
+
+func TestRendererConfig(t *testing.T) {
+	tests := []struct {
+		renderer string
+		err      string
+	}{
+		{`{"type": "stars"}`, ""},
+		{`{"type": "stars", "settings": {"max": 10, "color": "#000000"}}`, ""},
+		{`{"type": "progress", "settings": {"max": 1}}`, ""},
+		{`{"type": "lights"}`, `unknown renderer "lights"; use one of progress, stars, test`},
+		{`{"type": "stars", "settings": {"max": 21}}`, "max must be between 1 and 20"},
+		{`{"type": "stars", "settings": {"color": "gold"}}`, "*"},
+		{`{"type": "stars", "settings": {"size": 3}}`, "*"},
+		{`{"type": "progress", "settings": {"max": 0}}`, "max must be positive"},
+	}
+	for _, tt := range tests {
+		var rc RendererConfig
+		if err := json.Unmarshal([]byte(tt.renderer), &rc); err != nil {
+			t.Fatal(err)
+		}
+		err := rc.prepare()
+		switch {
+		case tt.err == "*":
+			if err == nil {
+				t.Errorf("%s is accepted", tt.renderer)
+			}
+		case tt.err == "":
+			if err != nil || rc.renderer == nil {
+				t.Errorf("%s: %v", tt.renderer, err)
+			}
+		case err == nil || !strings.HasPrefix(err.Error(), tt.err):
+			t.Errorf("%s: got error %v, want %q", tt.renderer, err, tt.err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a renderer was registered twice")
+		}
+	}()
+	RegisterCellRenderer("stars", nil)
+}
+
+// polygonRecorder is a Backend that records the styles of the polygons
+// it draws, and the x of their first point.
+type polygonRecorder struct {
+	Backend
+	styles []string
+	xs     []float64
+}
+
+func (pr *polygonRecorder) Polygon(points []PointType, style string) {
+	pr.styles = append(pr.styles, style)
+	pr.xs = append(pr.xs, points[0].X)
+}
+
+func TestStarRenderer(t *testing.T) {
+	// A cell 40 x 7 mm at (10, 20) has stars 5 mm wide, with a margin of
+	// 1 mm. The first point of a star is its top, above its center.
+	tests := []struct {
+		value, align string
+		filled       int
+		first        float64
+	}{
+		{"3", "L", 3, 13.5},
+		{"3.5", "C", 4, 20},
+		{"2.4", "R", 2, 26.5},
+		{"9", "L", 5, 13.5},
+		{"-1", "L", 0, 13.5},
+		{"n/a", "L", -1, 0},
+	}
+	sr := &starRenderer{Max: 5}
+	for _, tt := range tests {
+		rec := &polygonRecorder{Backend: newPDF("P", "mm", "A4", "")}
+		sr.RenderCell(rec, CellRect{X: 10, Y: 20, W: 40, H: 7}, tt.value, CellContext{Line: []string{"a", tt.value}, Column: 1, Align: tt.align})
+		if tt.filled < 0 {
+			if len(rec.styles) != 0 {
+				t.Errorf("%q: stars for a value that is not a number", tt.value)
+			}
+			continue
+		}
+		want := make([]string, 5)
+		for k := range want {
+			want[k] = "D"
+			if k < tt.filled {
+				want[k] = "FD"
+			}
+		}
+		if !reflect.DeepEqual(rec.styles, want) || !approx(rec.xs[0], tt.first) {
+			t.Errorf("%q, %s: stars %v from %g, want %v from %g", tt.value, tt.align, rec.styles, rec.xs[0], want, tt.first)
+		}
+	}
+}
+
+func TestProgressRenderer(t *testing.T) {
+	// The bar of a cell 40 x 7 mm at (10, 20) is 38 x 4 mm at (11, 21.5).
+	tests := []struct {
+		value string
+		bars  [][4]float64
+	}{
+		{"25", [][4]float64{{11, 21.5, 38, 4}, {11, 21.5, 9.5, 4}}},
+		{"150", [][4]float64{{11, 21.5, 38, 4}, {11, 21.5, 38, 4}}},
+		{"0", [][4]float64{{11, 21.5, 38, 4}}},
+		{"n/a", nil},
+	}
+	pr := &progressRenderer{Max: 100}
+	for _, tt := range tests {
+		pdf := newPDF("P", "mm", "A4", "")
+		pdf.AddPage()
+		pdf.SetFont("Times", "", 12)
+		rec := &chartRecorder{Backend: pdf}
+		pr.RenderCell(rec, CellRect{X: 10, Y: 20, W: 40, H: 7}, tt.value, CellContext{Line: []string{tt.value}, Text: tt.value})
+		if !approxShapes(rec.bars, tt.bars) {
+			t.Errorf("%q: bars %v, want %v", tt.value, rec.bars, tt.bars)
+		}
+	}
+}
+
+func TestCellRenderer(t *testing.T) {
+	testRenderer.cells = nil
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Done\nApples,1\nPears,20\n",
+		"cfg.json": `{"columns": [{"name": "Done", "renderer": {"type": "test"}, "align": "C"}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []CellContext{
+		{Row: 0, Column: 1, Line: []string{"Apples", "1"}, Text: "1", Align: "C"},
+		{Row: 1, Column: 1, Line: []string{"Pears", "20"}, Text: "20", Align: "C"},
+	}
+	if !reflect.DeepEqual(testRenderer.cells, want) {
+		t.Errorf("rendered %+v, want %+v", testRenderer.cells, want)
+	}
+	// The renderer draws instead of the text.
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	if strings.Contains(content, "(20)Tj") || !strings.Contains(content, "1.000 0.000 0.000 rg") {
+		t.Error("the value is printed as text")
+	}
+}
+
+func TestRenderedCell(t *testing.T) {
+	pdf := newPDF("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Times", "", 12)
+	pdf.SetDrawColor(1, 2, 3)
+	pdf.SetFillColor(4, 5, 6)
+	pdf.SetTextColor(7, 8, 9)
+	pdf.SetLineWidth(0.3)
+	pdf.SetXY(10, 20)
+	renderedCell(pdf, &RendererConfig{renderer: &contextRenderer{}}, 30, 7, "1", "1", false, CellContext{})
+
+	// The table gets its style back and continues after the cell.
+	got := [][3]int{}
+	for _, f := range []func() (int, int, int){pdf.GetDrawColor, pdf.GetFillColor, pdf.GetTextColor} {
+		r, g, b := f()
+		got = append(got, [3]int{r, g, b})
+	}
+	if want := [][3]int{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("colors %v, want %v", got, want)
+	}
+	if size, _ := pdf.GetFontSize(); pdf.GetLineWidth() != 0.3 || size != 12 {
+		t.Errorf("line width %g, font size %g", pdf.GetLineWidth(), size)
+	}
+	if x, y := pdf.GetXY(); x != 40 || y != 20 {
+		t.Errorf("the cell ends at %g, %g, want 40, 20", x, y)
+	}
+}
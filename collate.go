@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+
+	textcollate "golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// ## Sorting text
+
+// Sorting text by its bytes puts "Zürich" before "apple" and "Österreich"
+// after "Zypern": capitals come before small letters, and letters with
+// accents after all others. People sort differently. They compare the
+// letters first, regardless of accents and case; only between words that
+// are otherwise equal, the word without accents comes first, then the
+// one in small letters:
+//
+//	eclair, Eclair, éclair, Österreich, Zürich, Zypern
+//
+// This is the Unicode Collation Algorithm, which golang.org/x/text/collate
+// implements with the orders of the Unicode Common Locale Data
+// Repository for each language, for all scripts. Pivot tables and sorted
+// groups sort in the order of the language of the report's locale;
+// filters compare text in the root order, which English, German, and
+// French share.
+
+// collator compares text in the order of a language. The Collator of
+// golang.org/x/text keeps buffers of its own, so it serves one
+// comparison at a time.
+type collator struct {
+	mu sync.Mutex
+	c  *textcollate.Collator
+}
+
+// collators are the collators by language, shared by all reports.
+var collators = struct {
+	sync.Mutex
+	m map[language.Tag]*collator
+}{m: map[language.Tag]*collator{}}
+
+// collatorFor returns the collator of a language.
+func collatorFor(tag language.Tag) *collator {
+	collators.Lock()
+	defer collators.Unlock()
+	c, ok := collators.m[tag]
+	if !ok {
+		c = &collator{c: textcollate.New(tag)}
+		collators.m[tag] = c
+	}
+	return c
+}
+
+// localeLanguages are the languages of the locales, for collation.
+var localeLanguages = map[string]language.Tag{
+	"en": language.English,
+	"de": language.German,
+	"fr": language.French,
+}
+
+// rootCollator compares text in the root order.
+var rootCollator = collatorFor(language.Und)
+
+// compare compares a and b and returns -1, 0, or 1. It returns 0 only
+// if a and b are equal.
+func (c *collator) compare(a, b string) int {
+	if a == b {
+		return 0
+	}
+	c.mu.Lock()
+	r := c.c.CompareString(a, b)
+	c.mu.Unlock()
+	if r != 0 {
+		return r
+	}
+	// Equal at all levels, such as two different spellings of the same
+	// accented letter: fall back to the bytes.
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// collate compares a and b in the root order and returns -1, 0, or 1.
+// It returns 0 only if a and b are equal.
+func collate(a, b string) int {
+	return rootCollator.compare(a, b)
+}
+
+// collate compares a and b in the order of the language of l, or in
+// the root order if l has none.
+func (l *locale) collate(a, b string) int {
+	if l == nil || l.collator == nil {
+		return collate(a, b)
+	}
+	return l.collator.compare(a, b)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollate(t *testing.T) {
+	want := []string{"eclair", "Eclair", "éclair", "Österreich", "Zürich", "Zypern"}
+	words := []string{"Zypern", "éclair", "Zürich", "Eclair", "Österreich", "eclair"}
+	sort.Slice(words, func(i, j int) bool { return collate(words[i], words[j]) < 0 })
+	if !reflect.DeepEqual(words, want) {
+		t.Errorf("sorted as %q, want %q", words, want)
+	}
+
+	// Composed and decomposed accents are equal to the collator, but
+	// not the same text.
+	if a, b := "éclair", "e\u0301clair"; collate(a, b) == 0 || collate(a, b) != -collate(b, a) {
+		t.Errorf("collate(%q, %q) = %d, collate(%q, %q) = %d", a, b, collate(a, b), b, a, collate(b, a))
+	}
+	if collate("x", "x") != 0 {
+		t.Error("equal text compared unequal")
+	}
+}
+
+func TestCollatePivot(t *testing.T) {
+	hdr := []string{"City", "Product", "Sales"}
+	rows := [][]string{{"Zürich", "b", "1"}, {"apple", "b", "1"}, {"Österreich", "b", "1"}, {"Zypern", "b", "1"}}
+	l, err := newLocale("de", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := &PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 0}, Values: ColumnRef{Index: 2}}
+	got, _ := pc.apply(hdr, rows, nil, l)
+	if want := []string{"Product", "apple", "Österreich", "Zürich", "Zypern"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pivot columns %q, want %q", got, want)
+	}
+}
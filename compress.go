@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// ## Output size
+
+// Reports go out by mail, and mailboxes have limits. Most of the size of
+// a large report is in its images and in its streams, which gofpdf
+// compresses for speed rather than size. The report can be made smaller:
+//
+//	"compression": {"imageDPI": 150, "jpegQuality": 80, "level": "best"}
+//
+// ImageDPI downsamples images that have more pixels than they need at
+// the size they are printed; 150 dpi is plenty for office printers, 96
+// for screens. JPEGQuality recompresses images without transparency as
+// JPEG, which suits photos; charts with sharp edges and few colors are
+// smaller as PNG, and stay so. Level "best" compresses all streams again
+// with the best compression of zlib, instead of gofpdf's fastest. All
+// of this happens to the finished document, so images drawn by cell
+// renderers and render hooks get smaller, too. Images and streams that
+// would not get smaller stay as they are. The document is written anew,
+// without the incremental updates that grayscale printing and tagging
+// leave behind.
+//
+// Fonts need no setting: gofpdf embeds only the characters that a
+// report uses of a TrueType font, and does not embed the core fonts.
+//
+// When it is not known which settings a report needs, a size limit
+// picks them:
+//
+//	pdf -max-size 5MB -config sales.json sales.csv
+//
+// The settings of the configuration are applied first. If the report is
+// larger than the limit, stricter settings are tried in turn, from the
+// best stream compression alone to JPEG images at 72 dpi. A report that
+// is still too large is written anyway, with a warning in the log.
+
+// CompressionConfig makes the report smaller.
+type CompressionConfig struct {
+	// ImageDPI is the highest resolution of images at their printed
+	// size. Default: 0, keep all pixels.
+	ImageDPI int `json:"imageDPI"`
+
+	// JPEGQuality, from 1 to 100, recompresses images without
+	// transparency as JPEG. Default: 0, keep their format.
+	JPEGQuality int `json:"jpegQuality"`
+
+	// Level is the compression of streams: "fast" (default) or "best".
+	Level string `json:"level"`
+}
+
+func (cc *CompressionConfig) prepare() error {
+	switch cc.Level {
+	case "":
+		cc.Level = "fast"
+	case "fast", "best":
+	default:
+		return fmt.Errorf("unknown level %q; use fast or best", cc.Level)
+	}
+	if cc.ImageDPI < 0 {
+		return errors.New("imageDPI must not be negative")
+	}
+	if cc.JPEGQuality < 0 || cc.JPEGQuality > 100 {
+		return errors.New("jpegQuality must be between 1 and 100")
+	}
+	return nil
+}
+
+// sizeSteps are the settings that a size limit tries, from the mildest
+// to the strictest.
+var sizeSteps = []CompressionConfig{
+	{Level: "best"},
+	{Level: "best", ImageDPI: 150},
+	{Level: "best", ImageDPI: 150, JPEGQuality: 85},
+	{Level: "best", ImageDPI: 96, JPEGQuality: 75},
+	{Level: "best", ImageDPI: 72, JPEGQuality: 60},
+}
+
+// stricter returns the settings of step, made as strict as those of cc
+// where these are stricter. cc may be nil.
+func (cc *CompressionConfig) stricter(step CompressionConfig) *CompressionConfig {
+	if cc == nil {
+		return &step
+	}
+	if cc.Level == "best" {
+		step.Level = "best"
+	}
+	if cc.ImageDPI > 0 && (step.ImageDPI == 0 || cc.ImageDPI < step.ImageDPI) {
+		step.ImageDPI = cc.ImageDPI
+	}
+	if cc.JPEGQuality > 0 && (step.JPEGQuality == 0 || cc.JPEGQuality < step.JPEGQuality) {
+		step.JPEGQuality = cc.JPEGQuality
+	}
+	return &step
+}
+
+// compressionFinisher returns the post-processing step for savePDF that
+// makes the document smaller: with the settings of cc, and, if it is
+// still larger than maxSize bytes, with stricter ones. cc may be nil,
+// and maxSize 0 for no limit. It must run before the steps of archival
+// mode.
+func compressionFinisher(env *Env, cc *CompressionConfig, maxSize int64) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		out := data
+		var err error
+		if cc != nil {
+			if out, err = compressPDF(data, cc); err != nil {
+				return nil, fmt.Errorf("compression: %s", err)
+			}
+		}
+		for i := 0; maxSize > 0 && int64(len(out)) > maxSize && i < len(sizeSteps); i++ {
+			if out, err = compressPDF(data, cc.stricter(sizeSteps[i])); err != nil {
+				return nil, fmt.Errorf("compression: %s", err)
+			}
+		}
+		if maxSize > 0 && int64(len(out)) > maxSize {
+			env.Log.Warn("report larger than the size limit", "bytes", len(out), "limit", maxSize)
+		}
+		return out, nil
+	}
+}
+
+// compressPDF writes the document anew, with its images and streams
+// compressed as cc says.
+func compressPDF(data []byte, cc *CompressionConfig) ([]byte, error) {
+	doc, err := readPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if cc.ImageDPI > 0 || cc.JPEGQuality > 0 {
+		if err := doc.compressImages(cc); err != nil {
+			return nil, err
+		}
+	}
+	if cc.Level == "best" {
+		for num, o := range doc.objects {
+			if o.stream == nil || o.filter() != "FlateDecode" {
+				continue
+			}
+			raw, err := inflate(o.stream)
+			if err != nil {
+				return nil, fmt.Errorf("stream %d: %s", num, err)
+			}
+			if z := deflateBest(raw); len(z) < len(o.stream) {
+				o.setStream(z)
+			}
+		}
+	}
+	return doc.bytes(), nil
+}
+
+// pdfDocument is a document read object by object, with only the last
+// definition of every object.
+type pdfDocument struct {
+	header     []byte // the first line
+	objects    map[int]*pdfObj
+	size       int // of the cross-reference table
+	root, info string
+}
+
+// pdfObj is an object of a pdfDocument.
+type pdfObj struct {
+	dict   []byte // the object, or the dictionary of a stream
+	stream []byte // the data of a stream, nil for other objects
+}
+
+var (
+	reStreamStart    = regexp.MustCompile(`>>\s*stream\r?\n`)
+	reWidth          = regexp.MustCompile(`/Width (\d+)`)
+	reHeight         = regexp.MustCompile(`/Height (\d+)`)
+	reIndirectLength = regexp.MustCompile(`/Length \d+\s+\d+\s+R`)
+	reDecodeParms    = regexp.MustCompile(`\s*/DecodeParms\s*<<[^>]*>>`)
+	reSMask          = regexp.MustCompile(`/SMask (\d+) 0 R`)
+	rePage           = regexp.MustCompile(`/Type\s*/Page\b`)
+	reImageType      = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	reXObjects       = regexp.MustCompile(`/XObject\s*<<([^>]*)>>`)
+	reNamedRef       = regexp.MustCompile(`/(\S+)\s+(\d+) 0 R`)
+	reImageUse       = regexp.MustCompile(`([\d.]+) 0 0 ([\d.]+) -?[\d.]+ -?[\d.]+ cm\s*/(\S+) Do`)
+)
+
+// filter returns the filter of a stream, or "" for none or several.
+func (o *pdfObj) filter() string {
+	if m := reFilter.FindSubmatch(o.dict); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// setStream replaces the data of a stream.
+func (o *pdfObj) setStream(data []byte) {
+	o.stream = data
+	o.dict = reLength.ReplaceAll(o.dict, []byte(fmt.Sprintf("/Length %d", len(data))))
+}
+
+// readPDF reads the objects of a document through its cross-reference
+// tables, those of incremental updates first.
+func readPDF(data []byte) (*pdfDocument, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	size := reSize.FindSubmatch(trailer)
+	if root == nil || size == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	doc := &pdfDocument{header: data[:bytes.IndexByte(data, '\n')+1], objects: map[int]*pdfObj{}, root: string(root[1])}
+	doc.size, _ = strconv.Atoi(string(size[1]))
+	if info != nil {
+		doc.info = string(info[1])
+	}
+
+	offsets := map[int]int{} // -1 for free objects
+	seen := map[int]bool{}
+	xref, _ := strconv.Atoi(string(m[1]))
+	for {
+		if seen[xref] || xref < 0 || xref >= len(data) || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+			return nil, errors.New("cannot find cross-reference table")
+		}
+		seen[xref] = true
+		end := bytes.Index(data[xref:], []byte("trailer"))
+		if end < 0 {
+			return nil, errors.New("cannot parse cross-reference table")
+		}
+		num := 0
+		for _, line := range bytes.Split(data[xref+len("xref\n"):xref+end], []byte("\n")) {
+			f := bytes.Fields(line)
+			switch len(f) {
+			case 2:
+				num, _ = strconv.Atoi(string(f[0]))
+			case 3:
+				if _, ok := offsets[num]; !ok {
+					offsets[num] = -1
+					if string(f[2]) == "n" {
+						offsets[num], _ = strconv.Atoi(string(f[0]))
+					}
+				}
+				num++
+			}
+		}
+		t := data[xref+end:]
+		if i := bytes.Index(t, []byte("startxref")); i >= 0 {
+			t = t[:i]
+		}
+		prev := rePrev.FindSubmatch(t)
+		if prev == nil {
+			break
+		}
+		xref, _ = strconv.Atoi(string(prev[1]))
+	}
+
+	for num, off := range offsets {
+		head := []byte(fmt.Sprintf("%d 0 obj", num))
+		if off < 0 {
+			continue
+		}
+		if off >= len(data) || !bytes.HasPrefix(data[off:], head) {
+			return nil, fmt.Errorf("cannot find object %d", num)
+		}
+		body := data[off+len(head):]
+		end := bytes.Index(body, []byte("endobj"))
+		if end < 0 {
+			return nil, fmt.Errorf("cannot parse object %d", num)
+		}
+		o := &pdfObj{dict: body[:end]}
+		if s := reStreamStart.FindIndex(body[:end]); s != nil {
+			o.dict = body[:s[0]+2]
+			l := reLength.FindSubmatch(o.dict)
+			if l == nil || reIndirectLength.Match(o.dict) {
+				return nil, fmt.Errorf("object %d: stream without a direct length", num)
+			}
+			n, _ := strconv.Atoi(string(l[1]))
+			if s[1]+n > len(body) {
+				return nil, fmt.Errorf("object %d: stream too short", num)
+			}
+			o.stream = body[s[1] : s[1]+n]
+		}
+		doc.objects[num] = o
+	}
+	return doc, nil
+}
+
+// bytes returns the document, with a single cross-reference table.
+func (doc *pdfDocument) bytes() []byte {
+	var buf bytes.Buffer
+	buf.Write(doc.header)
+	offsets := make([]int, doc.size)
+	for num := 1; num < doc.size; num++ {
+		o, ok := doc.objects[num]
+		if !ok {
+			continue
+		}
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj", num)
+		buf.Write(o.dict)
+		if o.stream != nil {
+			buf.WriteString("\nstream\n")
+			buf.Write(o.stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n", doc.size)
+	for _, off := range offsets {
+		if off == 0 {
+			buf.WriteString("0000000000 65535 f \n")
+		} else {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+		}
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n", doc.size, doc.root)
+	if doc.info != "" {
+		fmt.Fprintf(&buf, "/Info %s 0 R\n", doc.info)
+	}
+	fmt.Fprintf(&buf, ">>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+// imageSizes returns the largest size in points at which each image is
+// printed on a page.
+func (doc *pdfDocument) imageSizes() map[int][2]float64 {
+	sizes := map[int][2]float64{}
+	for _, page := range doc.objects {
+		if page.stream != nil || !rePage.Match(page.dict) {
+			continue
+		}
+		res := page.dict
+		if m := reRes.FindSubmatch(page.dict); m != nil {
+			n, _ := strconv.Atoi(string(m[1]))
+			if o, ok := doc.objects[n]; ok {
+				res = o.dict
+			}
+		}
+		names := map[string]int{}
+		if m := reXObjects.FindSubmatch(res); m != nil {
+			for _, ref := range reNamedRef.FindAllSubmatch(m[1], -1) {
+				names[string(ref[1])], _ = strconv.Atoi(string(ref[2]))
+			}
+		}
+		m := reContents.FindSubmatch(page.dict)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(string(m[1]))
+		c, ok := doc.objects[n]
+		if !ok || c.stream == nil {
+			continue
+		}
+		content := c.stream
+		if c.filter() == "FlateDecode" {
+			var err error
+			if content, err = inflate(content); err != nil {
+				continue
+			}
+		}
+		for _, use := range reImageUse.FindAllSubmatch(content, -1) {
+			num, ok := names[string(use[3])]
+			if !ok {
+				continue
+			}
+			w, _ := strconv.ParseFloat(string(use[1]), 64)
+			h, _ := strconv.ParseFloat(string(use[2]), 64)
+			s := sizes[num]
+			sizes[num] = [2]float64{math.Max(s[0], w), math.Max(s[1], h)}
+		}
+	}
+	return sizes
+}
+
+// compressImages downsamples the images that are printed with more
+// pixels than cc.ImageDPI allows, and recompresses opaque images as JPEG
+// if cc.JPEGQuality is set. Soft masks are downsampled with their
+// images.
+func (doc *pdfDocument) compressImages(cc *CompressionConfig) error {
+	sizes := doc.imageSizes()
+	masks := map[string]bool{}
+	for _, o := range doc.objects {
+		if m := reSMask.FindSubmatch(o.dict); m != nil {
+			masks[string(m[1])] = true
+		}
+	}
+	for num, o := range doc.objects {
+		if o.stream == nil || !reImageType.Match(o.dict) || masks[strconv.Itoa(num)] {
+			continue
+		}
+		img, err := decodeImage(o)
+		if err != nil {
+			return fmt.Errorf("image %d: %s", num, err)
+		}
+		if img == nil {
+			continue
+		}
+		var mask *pdfObj
+		var maskImg stdimage.Image
+		if m := reSMask.FindSubmatch(o.dict); m != nil {
+			n, _ := strconv.Atoi(string(m[1]))
+			if mask = doc.objects[n]; mask == nil || mask.stream == nil {
+				continue
+			}
+			if maskImg, err = decodeImage(mask); err != nil {
+				return fmt.Errorf("image %d: %s", n, err)
+			}
+			if maskImg == nil {
+				continue
+			}
+		}
+
+		b := img.Bounds()
+		w, h := b.Dx(), b.Dy()
+		if _, ok := sizes[num]; ok && cc.ImageDPI > 0 {
+			printed := sizes[num][0] / 72 * float64(cc.ImageDPI)
+			if tw := int(math.Ceil(printed)); tw > 0 && tw < w {
+				h = maxInt(1, int(math.Round(float64(h)*float64(tw)/float64(w))))
+				w = tw
+			}
+		}
+		resized := w != b.Dx()
+		if resized {
+			img = shrinkImage(img, w, h)
+		}
+		if mask == nil && cc.JPEGQuality > 0 {
+			var jb bytes.Buffer
+			if err := jpeg.Encode(&jb, img, &jpeg.Options{Quality: cc.JPEGQuality}); err != nil {
+				return fmt.Errorf("image %d: %s", num, err)
+			}
+			if resized || jb.Len() < len(o.stream) {
+				setImage(o, jb.Bytes(), "DCTDecode", w, h)
+				continue
+			}
+		}
+		if resized {
+			setImage(o, deflateBest(imageSamples(img)), "FlateDecode", w, h)
+			if mask != nil {
+				setImage(mask, deflateBest(imageSamples(shrinkImage(maskImg, w, h))), "FlateDecode", w, h)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeImage returns the pixels of an image object, or nil if it is of
+// a kind that is kept as it is: other than 8 bits of gray or RGB, or with
+// a color key mask.
+func decodeImage(o *pdfObj) (stdimage.Image, error) {
+	d := o.dict
+	if !bytes.Contains(d, []byte("/BitsPerComponent 8")) || bytes.Contains(d, []byte("/Mask")) || bytes.Contains(d, []byte("/Decode ")) {
+		return nil, nil
+	}
+	gray := bytes.Contains(d, []byte("/ColorSpace /DeviceGray"))
+	if !gray && !bytes.Contains(d, []byte("/ColorSpace /DeviceRGB")) {
+		return nil, nil
+	}
+	switch o.filter() {
+	case "DCTDecode":
+		return jpeg.Decode(bytes.NewReader(o.stream))
+	case "FlateDecode":
+	default:
+		return nil, nil
+	}
+	w, _ := strconv.Atoi(string(reWidth.FindSubmatch(d)[1]))
+	h, _ := strconv.Atoi(string(reHeight.FindSubmatch(d)[1]))
+	colors := 3
+	if gray {
+		colors = 1
+	}
+	raw, err := inflate(o.stream)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(d, []byte("/Predictor")) {
+		if raw, err = unpredict(raw, colors, w, h); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) < w*h*colors {
+		return nil, errors.New("too little data")
+	}
+	if gray {
+		return &stdimage.Gray{Pix: raw, Stride: w, Rect: stdimage.Rect(0, 0, w, h)}, nil
+	}
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		copy(img.Pix[4*i:], raw[3*i:3*i+3])
+		img.Pix[4*i+3] = 255
+	}
+	return img, nil
+}
+
+// unpredict reverses the PNG filters of image data with the given number
+// of 8-bit color components.
+func unpredict(data []byte, colors, w, h int) ([]byte, error) {
+	stride := colors * w
+	if len(data) < (stride+1)*h {
+		return nil, errors.New("too little data")
+	}
+	out := make([]byte, stride*h)
+	prev := make([]byte, stride)
+	for y := 0; y < h; y++ {
+		in := data[y*(stride+1)+1 : (y+1)*(stride+1)]
+		row := out[y*stride : (y+1)*stride]
+		for i := range row {
+			var left, upLeft byte
+			if i >= colors {
+				left, upLeft = row[i-colors], prev[i-colors]
+			}
+			up := prev[i]
+			switch data[y*(stride+1)] {
+			case 0:
+				row[i] = in[i]
+			case 1:
+				row[i] = in[i] + left
+			case 2:
+				row[i] = in[i] + up
+			case 3:
+				row[i] = in[i] + byte((int(left)+int(up))/2)
+			case 4:
+				row[i] = in[i] + paeth(left, up, upLeft)
+			default:
+				return nil, errors.New("unknown PNG filter")
+			}
+		}
+		prev = row
+	}
+	return out, nil
+}
+
+// paeth is the Paeth predictor of PNG.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// shrinkImage returns img at w × h pixels, fewer than it has, with every
+// pixel the average of those it covers.
+func shrinkImage(img stdimage.Image, w, h int) stdimage.Image {
+	b := img.Bounds()
+	_, gray := img.(*stdimage.Gray)
+	var out stdimage.Image
+	var set func(x, y int, r, g, bl uint32)
+	if gray {
+		g := stdimage.NewGray(stdimage.Rect(0, 0, w, h))
+		out = g
+		set = func(x, y int, r, _, _ uint32) { g.SetGray(x, y, color.Gray{Y: uint8(r >> 8)}) }
+	} else {
+		c := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+		out = c
+		set = func(x, y int, r, g, bl uint32) {
+			c.SetNRGBA(x, y, color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(bl >> 8), A: 255})
+		}
+	}
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+cr, g+cg, bl+cb, n+1
+				}
+			}
+			set(x, y, r/n, g/n, bl/n)
+		}
+	}
+	return out
+}
+
+// imageSamples returns the 8-bit samples of a gray or opaque RGB image,
+// row by row.
+func imageSamples(img stdimage.Image) []byte {
+	b := img.Bounds()
+	if g, ok := img.(*stdimage.Gray); ok {
+		return g.Pix[:b.Dx()*b.Dy()]
+	}
+	out := make([]byte, 0, 3*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out = append(out, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+	}
+	return out
+}
+
+// setImage replaces the data of an image object.
+func setImage(o *pdfObj, data []byte, filter string, w, h int) {
+	d := reDecodeParms.ReplaceAll(o.dict, nil)
+	d = reFilter.ReplaceAll(d, []byte("/Filter /"+filter))
+	d = reWidth.ReplaceAll(d, []byte(fmt.Sprintf("/Width %d", w)))
+	o.dict = reHeight.ReplaceAll(d, []byte(fmt.Sprintf("/Height %d", h)))
+	o.setStream(data)
+}
+
+// deflateBest compresses a stream for the FlateDecode filter, as small
+// as zlib can.
+func deflateBest(data []byte) []byte {
+	var b bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&b, zlib.BestCompression)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a document of the given objects, numbered from 1,
+// with a cross-reference table and a trailer with the root 1 and the
+// given entries. "{xref}" in the entries is replaced with the offset of
+// the table.
+func buildPDF(trailer string, objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	trailer = strings.Replace(trailer, "{xref}", fmt.Sprint(xref), -1)
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// testPDF returns a document of the given number of A4 pages with a
+// red rectangle on each.
+func testPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	pdf := newPDF("P", "pt", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.SetFillColor(200, 0, 0)
+	for i := 0; i < pages; i++ {
+		pdf.AddPage()
+		pdf.Rect(50, 50, 100, 40, "F")
+		pdf.Text(50, 120, "Page")
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// update appends an incremental update to data that replaces object num.
+func update(data []byte, num int, obj string) []byte {
+	prev := reStartXref.FindSubmatch(data)[1]
+	size := reSize.FindSubmatch(data[bytes.LastIndex(data, []byte("trailer")):])[1]
+	buf := bytes.NewBuffer(append([]byte(nil), data...))
+	off := buf.Len()
+	fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", num, obj)
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n%d 1\n%010d 00000 n \ntrailer\n<< /Size %s /Root 1 0 R /Prev %s >>\nstartxref\n%d\n%%%%EOF\n",
+		num, off, size, prev, xref)
+	return buf.Bytes()
+}
+
+func TestReadPDF(t *testing.T) {
+	catalog := "<< /Type /Catalog /Pages 2 0 R >>"
+	pages := "<< /Type /Pages /Kids [] /Count 0 >>"
+	stream := "<< /Length 5 >>\nstream\nhello\nendstream"
+	plain := buildPDF(" /Info 3 0 R", catalog, pages, "<< /Title (T) >>", stream)
+	tests := []struct {
+		name   string
+		data   []byte
+		object int    // an object to look at
+		want   string // in its dictionary
+		stream string // its stream
+	}{
+		{"plain", plain, 1, "/Type /Catalog", ""},
+		{"stream", plain, 4, "/Length 5", "hello"},
+		{"updated", update(plain, 2, "<< /Type /Pages /Kids [] /Count 0 /Updated true >>"), 2, "/Updated true", ""},
+		{"updated twice", update(update(plain, 4, "<< /Length 3 >>\nstream\nold\nendstream"), 4,
+			"<< /Length 3 >>\nstream\nnew\nendstream"), 4, "/Length 3", "new"},
+		{"gofpdf", testPDF(t, 2), 1, "/Type /Pages", ""},
+	}
+	for _, tt := range tests {
+		doc, err := readPDF(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.HasPrefix(doc.header, []byte("%PDF-1.")) {
+			t.Errorf("%s: header %q", tt.name, doc.header)
+		}
+		if root, _ := strconv.Atoi(doc.root); doc.objects[root] == nil {
+			t.Errorf("%s: root %s not read", tt.name, doc.root)
+		}
+		o, ok := doc.objects[tt.object]
+		if !ok {
+			t.Errorf("%s: object %d not read", tt.name, tt.object)
+			continue
+		}
+		if !bytes.Contains(o.dict, []byte(tt.want)) || string(o.stream) != tt.stream {
+			t.Errorf("%s: object %d = %q, stream %q; want %q, stream %q", tt.name, tt.object, o.dict, o.stream, tt.want, tt.stream)
+		}
+	}
+	if doc, err := readPDF(plain); err == nil && (doc.size != 5 || doc.info != "3") {
+		t.Errorf("plain: size %d, info %q, want 5 and 3", doc.size, doc.info)
+	}
+}
+
+func TestReadPDFErrors(t *testing.T) {
+	catalog := "<< /Type /Catalog >>"
+	plain := buildPDF("", catalog)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "cannot find cross-reference table"},
+		{"no startxref", bytes.Replace(plain, []byte("startxref"), []byte("startref"), 1), "cannot find cross-reference table"},
+		{"no root", bytes.Replace(plain, []byte("/Root"), []byte("/Rut"), 1), "cannot parse trailer"},
+		{"bad startxref", bytes.Replace(plain, []byte("startxref\n"), []byte("startxref\n1"), 1), "cannot find cross-reference table"},
+		{"loop", buildPDF(" /Prev {xref}", catalog), "cannot find cross-reference table"},
+		{"bad offset", bytes.Replace(plain, []byte("1 0 obj"), []byte("1 0 job"), 1), "cannot find object 1"},
+		{"no endobj", bytes.Replace(plain, []byte("endobj"), []byte("end_bj"), 1), "cannot parse object 1"},
+		{"indirect length", buildPDF("", "<< /Length 2 0 R >>\nstream\nabc\nendstream", "3"), "stream without a direct length"},
+		{"short stream", buildPDF("", "<< /Length 9999 >>\nstream\nabc\nendstream"), "stream too short"},
+	}
+	for _, tt := range tests {
+		_, err := readPDF(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: readPDF = %v, want an error with %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ## Computed columns
+
+// Some columns are better computed than exported: a line total, a
+// running total, a share of the grand total. Computed columns are
+// appended to the table and evaluated when a report is rendered, from
+// expressions over other columns:
+//
+//	{"name": "Line Total", "expr": "Quantity * [Unit Price]"}
+//	{"name": "Running", "expr": "cumsum(Total)"}
+//	{"name": "Share %", "expr": "pct(Total)"}
+//
+// Expressions know + - * /, parentheses, numbers, and column names.
+// Names that are not identifiers go in brackets. The functions cumsum,
+// total, and pct compute the running sum, the sum over all rows, and the
+// percentage of the sum over all rows, respectively; avg, min, max, and
+// count compute the average, the extremes, and the number of the
+// numbers over all rows. A computed column can use the columns computed
+// before it. Cells that are not numbers count as zero in sums and leave
+// other results empty.
+//
+// Instead of an expression, a computed column may classify the trend of
+// a metric; see `TrendConfig`.
+
+// ComputedColumn defines a computed column.
+type ComputedColumn struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+
+	// Decimals is the number of decimal places. Default: 2.
+	Decimals *int `json:"decimals"`
+
+	// Trend, in place of Expr, classifies the trend of a metric; see
+	// TrendConfig.
+	Trend *TrendConfig `json:"trend"`
+
+	expr exprNode
+}
+
+// withComputed returns hdr followed by the names of the computed columns.
+func (c *Config) withComputed(hdr []string) []string {
+	full := append([]string{}, hdr...)
+	for _, cc := range c.Computed {
+		full = append(full, cc.Name)
+	}
+	return full
+}
+
+// compileComputed parses the expressions. hdr must include the computed
+// columns; each expression sees the columns before its own.
+func (c *Config) compileComputed(hdr []string) error {
+	base := len(hdr) - len(c.Computed)
+	for k := range c.Computed {
+		cc := &c.Computed[k]
+		if cc.Trend != nil {
+			if cc.Expr != "" {
+				return fmt.Errorf("computed column %q: use either expr or trend", cc.Name)
+			}
+			if err := cc.Trend.resolve(hdr[:base+k]); err != nil {
+				return fmt.Errorf("computed column %q: trend: %s", cc.Name, err)
+			}
+			continue
+		}
+		p := &exprParser{src: cc.Expr, hdr: hdr[:base+k], renamed: c.renamed}
+		node, err := p.parse()
+		if err != nil {
+			return fmt.Errorf("computed column %q: %s", cc.Name, err)
+		}
+		cc.expr = node
+	}
+	return nil
+}
+
+// computeRows returns a copy of rows with the computed columns appended.
+// hdr includes the computed columns.
+func (c *Config) computeRows(hdr []string, rows [][]string) [][]string {
+	if len(c.Computed) == 0 {
+		return rows
+	}
+	ncols := len(hdr) - len(c.Computed)
+	out := make([][]string, len(rows))
+	for r, line := range rows {
+		out[r] = make([]string, ncols, ncols+len(c.Computed))
+		copy(out[r], line)
+	}
+	for _, cc := range c.Computed {
+		if cc.Trend != nil {
+			for r := range out {
+				out[r] = append(out[r], cc.Trend.classify(out[r]))
+			}
+			continue
+		}
+		decimals := 2
+		if cc.Decimals != nil {
+			decimals = *cc.Decimals
+		}
+		for r, v := range cc.expr.eval(out) {
+			str := ""
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				str = c.locale().rounding.format(ratFromFloat(v), decimals)
+			}
+			out[r] = append(out[r], str)
+		}
+	}
+	return out
+}
+
+// An exprNode evaluates to one value per row. Non-numeric values are NaN.
+type exprNode interface {
+	eval(rows [][]string) []float64
+}
+
+type numberNode float64
+
+func (n numberNode) eval(rows [][]string) []float64 {
+	vs := make([]float64, len(rows))
+	for i := range vs {
+		vs[i] = float64(n)
+	}
+	return vs
+}
+
+type columnNode int
+
+func (n columnNode) eval(rows [][]string) []float64 {
+	vs := make([]float64, len(rows))
+	for i, line := range rows {
+		v, ok := cellNumber(line, int(n))
+		if !ok {
+			v = math.NaN()
+		}
+		vs[i] = v
+	}
+	return vs
+}
+
+type binaryNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binaryNode) eval(rows [][]string) []float64 {
+	l, r := n.l.eval(rows), n.r.eval(rows)
+	for i := range l {
+		switch n.op {
+		case '+':
+			l[i] += r[i]
+		case '-':
+			l[i] -= r[i]
+		case '*':
+			l[i] *= r[i]
+		case '/':
+			l[i] /= r[i]
+		}
+	}
+	return l
+}
+
+type funcNode struct {
+	name string
+	arg  exprNode
+}
+
+var exprFuncs = map[string]bool{"cumsum": true, "total": true, "pct": true, "avg": true, "min": true, "max": true, "count": true}
+
+// aggregates are the functions whose value is the same for all rows.
+var aggregates = map[string]bool{"total": true, "avg": true, "min": true, "max": true, "count": true}
+
+func (n funcNode) eval(rows [][]string) []float64 {
+	vs := n.arg.eval(rows)
+	var total decimalSum
+	lo, hi := math.NaN(), math.NaN()
+	for _, v := range vs {
+		if !math.IsNaN(v) {
+			total.addFloat(v)
+			if !(v >= lo) {
+				lo = v
+			}
+			if !(v <= hi) {
+				hi = v
+			}
+		}
+	}
+	var sum decimalSum
+	for i, v := range vs {
+		switch n.name {
+		case "cumsum":
+			if !math.IsNaN(v) {
+				sum.addFloat(v)
+			}
+			vs[i] = sum.float()
+		case "total":
+			vs[i] = total.float()
+		case "pct":
+			vs[i] = v / total.float() * 100
+		case "avg":
+			vs[i] = total.float() / float64(total.n)
+		case "min":
+			vs[i] = lo
+		case "max":
+			vs[i] = hi
+		case "count":
+			vs[i] = float64(total.n)
+		}
+	}
+	return vs
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	src string
+	pos int
+	hdr []string
+
+	// renamed maps disambiguated column names to their originals; see
+	// uniqueHeader.
+	renamed map[string]string
+}
+
+func (p *exprParser) parse() (exprNode, error) {
+	n, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos:], p.pos+1)
+	}
+	return n, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (exprNode, error) {
+	n, err := p.product()
+	for err == nil && (p.peek() == '+' || p.peek() == '-') {
+		op := p.src[p.pos]
+		p.pos++
+		var r exprNode
+		if r, err = p.product(); err == nil {
+			n = binaryNode{op, n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *exprParser) product() (exprNode, error) {
+	n, err := p.unary()
+	for err == nil && (p.peek() == '*' || p.peek() == '/') {
+		op := p.src[p.pos]
+		p.pos++
+		var r exprNode
+		if r, err = p.unary(); err == nil {
+			n = binaryNode{op, n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		n, err := p.unary()
+		return binaryNode{'-', numberNode(0), n}, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		n, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(')')
+	case c == '[':
+		end := strings.IndexByte(p.src[p.pos:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("missing ] after position %d", p.pos+1)
+		}
+		name := p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return p.column(name)
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return numberNode(v), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() != '(' {
+			return p.column(name)
+		}
+		if !exprFuncs[name] {
+			return nil, fmt.Errorf("unknown function %q", name)
+		}
+		p.pos++
+		arg, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return funcNode{name, arg}, p.expect(')')
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *exprParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("missing %q at position %d", c, p.pos+1)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) column(name string) (exprNode, error) {
+	i, err := p.index(name)
+	return columnNode(i), err
+}
+
+// index returns the index of the named column. The original name of
+// duplicate columns is ambiguous: the expression must say which of the
+// columns it means, as Total_1 for the first column named Total.
+func (p *exprParser) index(name string) (int, error) {
+	i := indexOf(p.hdr, name)
+	if orig := strings.TrimSuffix(name, "_1"); i < 0 && orig != name && duplicates(p.renamed, orig) != nil {
+		i = indexOf(p.hdr, orig)
+	}
+	if i < 0 {
+		return -1, fmt.Errorf("column %q not found", name)
+	}
+	if dups := duplicates(p.renamed, name); dups != nil {
+		return -1, fmt.Errorf("column %q is ambiguous; use %s", name, strings.Join(dups, ", "))
+	}
+	return i, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExprParser(t *testing.T) {
+	hdr := []string{"Price", "Qty", "Unit Cost", "Note"}
+	rows := [][]string{
+		{"10", "2", "4", "a"},
+		{"2.5", "4", "1", "b"},
+		{"n/a", "1", "1", "c"},
+	}
+	nan := math.NaN()
+	tests := []struct {
+		src  string
+		want []float64
+	}{
+		{"Price * Qty", []float64{20, 10, nan}},
+		{"Price*Qty - [Unit Cost]*Qty", []float64{12, 6, nan}},
+		{"1 + 2 * 3", []float64{7, 7, 7}},
+		{"(1 + 2) * 3", []float64{9, 9, 9}},
+		{"10 - 4 - 3", []float64{3, 3, 3}},
+		{"12 / 4 / 3", []float64{1, 1, 1}},
+		{"-Qty", []float64{-2, -4, -1}},
+		{"--Qty", []float64{2, 4, 1}},
+		{"2 * -Qty", []float64{-4, -8, -2}},
+		{".5 * Qty", []float64{1, 2, 0.5}},
+		{"Note", []float64{nan, nan, nan}},
+		{"total(Qty)", []float64{7, 7, 7}},
+		{"cumsum(Qty)", []float64{2, 6, 7}},
+		{"cumsum(Price)", []float64{10, 12.5, 12.5}},
+		{"pct(Qty) * 7", []float64{200, 400, 100}},
+		{"avg(Price)", []float64{6.25, 6.25, 6.25}},
+		{"min(Price)", []float64{2.5, 2.5, 2.5}},
+		{"max(Price)", []float64{10, 10, 10}},
+		{"count(Price)", []float64{2, 2, 2}},
+		{"Qty / total(Qty) * 100", []float64{200.0 / 7, 400.0 / 7, 100.0 / 7}},
+	}
+	for _, tt := range tests {
+		p := &exprParser{src: tt.src, hdr: hdr}
+		n, err := p.parse()
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.src, err)
+			continue
+		}
+		got := n.eval(rows)
+		for i, v := range got {
+			w := tt.want[i]
+			if math.IsNaN(w) && !math.IsNaN(v) || !math.IsNaN(w) && math.Abs(v-w) > 1e-9 {
+				t.Errorf("%q = %v, want %v", tt.src, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestExprParserErrors(t *testing.T) {
+	hdr := []string{"Price", "Qty"}
+	tests := []struct {
+		src, want string
+	}{
+		{"", "unexpected end of expression"},
+		{"Price +", "unexpected end of expression"},
+		{"Price Qty", `unexpected "Qty" at position 7`},
+		{"(Price", "missing ')' at position 7"},
+		{"total(Price", "missing ')' at position 12"},
+		{"[Price", "missing ] after position 1"},
+		{"Cost * Qty", `column "Cost" not found`},
+		{"sum(Price)", `unknown function "sum"`},
+		{"1.2.3", `invalid number "1.2.3"`},
+		{"Price % 2", `unexpected "% 2" at position 7`},
+		{"Price * #", `unexpected '#' at position 9`},
+	}
+	for _, tt := range tests {
+		p := &exprParser{src: tt.src, hdr: hdr}
+		_, err := p.parse()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parse(%q) = %v, want an error with %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,727 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ## Report configuration
+
+// Not every report looks the same. Settings that go beyond the defaults
+// are read from an optional JSON file passed via the `-config` flag.
+type Config struct {
+	// Source replaces the CSV file with another data source.
+	Source *SourceConfig `json:"source"`
+
+	// Locale selects the language and the date and number conventions:
+	// "en" (default), "de", or "fr".
+	Locale string `json:"locale"`
+
+	// Messages override texts of the locale; see englishMessages.
+	Messages map[string]string `json:"messages"`
+
+	// Rounding is the rounding mode for sums and amounts; see
+	// roundingMode. Default: "halfUp".
+	Rounding roundingMode `json:"rounding"`
+
+	// Direction is the text direction of the document, "ltr" (default)
+	// or "rtl"; see locale.visual.
+	Direction string `json:"direction"`
+
+	// Fonts maps font styles ("", "B", "I", "BI") to TrueType files that
+	// replace the built-in Times font, which knows only Western European
+	// letters. Styles without a file use the regular ("") font.
+	Fonts map[string]string `json:"fonts"`
+
+	// FallbackFonts print the characters that Fonts lacks; see
+	// fontChain. Each maps styles to files like Fonts.
+	FallbackFonts []map[string]string `json:"fallbackFonts"`
+
+	// FontCheck reports characters of the data that the fonts lack.
+	FontCheck *FontCheckConfig `json:"fontCheck"`
+
+	// FontDir is the directory of the font files. Default: the working
+	// directory.
+	FontDir string `json:"fontDir"`
+
+	// Narrative is a text/template printed below the title.
+	Narrative string `json:"narrative"`
+
+	// Dashboard fills the title page with a grid of KPI tiles, charts,
+	// and top lists.
+	Dashboard *DashboardConfig `json:"dashboard"`
+
+	Columns []ColumnConfig `json:"columns"`
+
+	// Pivot reshapes the rows into a cross-tab.
+	Pivot *PivotConfig `json:"pivot"`
+
+	// Enrich appends columns looked up by key.
+	Enrich []EnrichConfig `json:"enrich"`
+
+	// Computed appends columns computed from other columns.
+	Computed []ComputedColumn `json:"computed"`
+
+	// Rank adds a computed rank column in front of the table.
+	Rank *RankConfig `json:"rank"`
+
+	// Schema, if set, validates the input rows.
+	Schema *SchemaConfig `json:"schema"`
+
+	// Group adds subtotal rows after each group of rows.
+	Group *GroupConfig `json:"group"`
+
+	// Split generates one report per value of a column.
+	Split *SplitConfig `json:"split"`
+
+	// Recipients generates one personalized report per recipient.
+	Recipients *RecipientsConfig `json:"recipients"`
+
+	// Merge renders one document per row from a template.
+	Merge *MergeConfig `json:"merge"`
+
+	// Labels prints one label per row on label sheets.
+	Labels *LabelsConfig `json:"labels"`
+
+	// Link adds a link into the source system to each row.
+	Link *LinkConfig `json:"link"`
+
+	// Footnotes turns [^...] in cells and the narrative into footnotes.
+	Footnotes *FootnoteConfig `json:"footnotes"`
+
+	// Freshness prints when the data of each section was refreshed.
+	Freshness *FreshnessConfig `json:"freshness"`
+
+	// Deterministic makes the same data produce the same bytes, which
+	// skipping unchanged reports requires; see setupDocument.
+	Deterministic bool `json:"deterministic"`
+
+	// Grayscale makes the report for printers without color; see
+	// grayscaleFinisher.
+	Grayscale bool `json:"grayscale"`
+
+	// Delivery sends the finished reports.
+	Delivery *DeliveryConfig `json:"delivery"`
+
+	// Archive produces PDF/A documents for long-term archival.
+	Archive *ArchiveConfig `json:"archive"`
+
+	// Limits caps the size of the report.
+	Limits *LimitsConfig `json:"limits"`
+
+	// Callouts are boxes after the table that show when their
+	// conditions hold.
+	Callouts []CalloutConfig `json:"callouts"`
+
+	// Empty says what to do with reports without rows.
+	Empty *EmptyConfig `json:"empty"`
+
+	// Attach embeds the data of the report as a CSV file.
+	Attach *AttachConfig `json:"attach"`
+
+	// RawData adds an appendix with the unformatted rows.
+	RawData *RawDataConfig `json:"rawData"`
+
+	// Diff matches the rows with those of the previous input.
+	Diff *DiffConfig `json:"diff"`
+
+	// Freeze prints tables that are too wide for the page in bands of
+	// columns, repeating the key columns.
+	Freeze *FreezeConfig `json:"freeze"`
+
+	// Stationery prints the pages of the report on a letterhead.
+	Stationery *StationeryConfig `json:"stationery"`
+
+	// Form adds fillable fields.
+	Form *FormConfig `json:"form"`
+
+	// SignOff adds a block for the signatures of the people who check
+	// the report.
+	SignOff *SignOffConfig `json:"signOff"`
+
+	// Insert puts the pages of other PDF files before and after the
+	// report.
+	Insert *InsertConfig `json:"insert"`
+
+	// ContactSheet adds pages with thumbnails of all pages.
+	ContactSheet *ContactSheetConfig `json:"contactSheet"`
+
+	// Previews writes images of the pages next to the report.
+	Previews *PreviewConfig `json:"previews"`
+
+	// TextVersion writes the content of the report as HTML or plain
+	// text next to it.
+	TextVersion *TextVersionConfig `json:"textVersion"`
+
+	// Tagged makes the report accessible, as a tagged PDF.
+	Tagged *TaggedConfig `json:"tagged"`
+
+	// Output says how a report replaces an earlier one.
+	Output *OutputConfig `json:"output"`
+
+	// Manifest embeds what the report was made from into its metadata.
+	Manifest *ManifestConfig `json:"manifest"`
+
+	// Compression makes the report smaller.
+	Compression *CompressionConfig `json:"compression"`
+
+	// Orientation sets the page orientation per section of the report.
+	Orientation *OrientationConfig `json:"orientation"`
+
+	// EInvoice embeds the invoice data as Factur-X XML in invoice mode.
+	EInvoice *EInvoiceConfig `json:"eInvoice"`
+
+	// AutoWidth fits column widths to their contents.
+	AutoWidth *AutoWidthConfig `json:"autoWidth"`
+
+	// CellStyle sets the borders and the padding of table cells.
+	CellStyle *CellStyleConfig `json:"cellStyle"`
+
+	// RotateHeader prints long column names at an angle.
+	RotateHeader *RotateHeaderConfig `json:"rotateHeader"`
+
+	// HeaderGroups are labels above groups of columns.
+	HeaderGroups []HeaderGroup `json:"headerGroups"`
+
+	// ArtifactKey encrypts the files that a run leaves besides the
+	// report; see sealArtifact.
+	ArtifactKey string `json:"artifactKey"`
+
+	// widths holds the fitted column widths, if any.
+	widths []float64
+
+	// band lists the columns to print, if the table is split into bands;
+	// see FreezeConfig.
+	band []int
+
+	artifactKey []byte
+
+	// maxSize is the size limit of Job.MaxSize.
+	maxSize int64
+
+	// noClobber forbids replacing an existing report; see clobberPolicy.
+	noClobber bool
+
+	// annotations are the review notes of Job.Annotations.
+	annotations []Annotation
+
+	// manifest describes the input of the report, if Manifest is set.
+	manifest *manifest
+
+	// renamed maps the disambiguated names of duplicate input columns to
+	// their original names; see uniqueHeader.
+	renamed map[string]string
+
+	loc      *locale
+	fallback *fontChain
+}
+
+// ColumnConfig describes how the values of a single table column are
+// rendered. Columns are referenced by their header name or, if no name
+// is given, by their zero-based index.
+type ColumnConfig struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+
+	// Align is "L", "C", or "R".
+	Align string `json:"align"`
+
+	// Width is the column width in mm. Default: 40.
+	Width float64 `json:"width"`
+
+	// Format selects a number format: "" (as is), "sci" (scientific
+	// notation), or "eng" (engineering notation).
+	Format string `json:"format"`
+
+	// Digits is the number of significant digits for "sci" and "eng".
+	Digits int `json:"digits"`
+
+	// Overflow says what to do with values wider than the column:
+	// "wrap", "shrink", or "truncate". Default: let them overlap the
+	// next cell.
+	Overflow string `json:"overflow"`
+
+	// MinFontSize is the smallest font size in points that "shrink"
+	// goes down to. Default: 8.
+	MinFontSize float64 `json:"minFontSize"`
+
+	// Highlight marks the column's minimum and maximum values, either
+	// "bold" or "outline".
+	Highlight string `json:"highlight"`
+
+	// Date reformats date values.
+	Date *DateFormat `json:"date"`
+
+	// Transform lists text transformations applied to each value.
+	Transform []TextTransform `json:"transform"`
+
+	// Cache keeps the results of Transform.
+	Cache *TransformCache `json:"cache"`
+
+	// Badges prints the listed values as colored badges.
+	Badges map[string]Badge `json:"badges"`
+
+	// HeatMap colors each cell by its value.
+	HeatMap *HeatMapConfig `json:"heatMap"`
+
+	// Sparkline draws a small chart into each cell.
+	Sparkline *SparklineConfig `json:"sparkline"`
+
+	// Renderer draws the cells; see CellRenderer.
+	Renderer *RendererConfig `json:"renderer"`
+
+	// Direction is the text direction of the values, "ltr" or "rtl".
+	// Default: the direction of the document, or in left-to-right
+	// documents the direction of the first letter of each value.
+	Direction string `json:"direction"`
+
+	// Footnote is a note on the column header. It requires footnotes to
+	// be enabled.
+	Footnote string `json:"footnote"`
+}
+
+// loadConfig reads the configuration file at path. An empty path
+// returns the default configuration.
+func loadConfig(fsys FileSystem, path string) (*Config, error) {
+	cfg := &Config{}
+	if path != "" {
+		f, err := fsys.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.prepare(); err != nil {
+		return nil, err
+	}
+	var err error
+	if cfg.fallback, err = cfg.loadFontChain(fsys); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// prepare checks the settings and precomputes whatever rendering needs.
+func (c *Config) prepare() error {
+	var err error
+	if c.loc, err = newLocale(c.Locale, c.Messages, len(c.fonts()) > 0); err != nil {
+		return err
+	}
+	if err := c.Rounding.check(); err != nil {
+		return err
+	}
+	c.loc.rounding = c.Rounding
+	if err := checkDirection(c.Direction); err != nil {
+		return err
+	}
+	c.loc.rtl = c.Direction == "rtl"
+	if len(c.FallbackFonts) > 0 && len(c.fonts()) == 0 {
+		return fmt.Errorf("fallbackFonts require fonts")
+	}
+	if c.FontCheck != nil {
+		if err := c.FontCheck.prepare(c); err != nil {
+			return fmt.Errorf("fontCheck: %s", err)
+		}
+	}
+	for i, cc := range c.Columns {
+		switch cc.Align {
+		case "", "L", "C", "R":
+		default:
+			return fmt.Errorf("column %s: alignment must be L, C, or R", cc.label())
+		}
+		switch cc.Overflow {
+		case "", "wrap", "shrink", "truncate":
+		default:
+			return fmt.Errorf("column %s: overflow must be wrap, shrink, or truncate", cc.label())
+		}
+		switch cc.Format {
+		case "", "sci", "eng":
+		default:
+			return fmt.Errorf("column %s: format must be sci or eng", cc.label())
+		}
+		switch cc.Highlight {
+		case "", "bold", "outline":
+		default:
+			return fmt.Errorf("column %s: highlight must be bold or outline", cc.label())
+		}
+		if cc.MinFontSize < 0 {
+			return fmt.Errorf("column %s: minFontSize must not be negative", cc.label())
+		}
+		if err := checkDirection(cc.Direction); err != nil {
+			return fmt.Errorf("column %s: %s", cc.label(), err)
+		}
+		if cc.Date != nil {
+			if err := cc.Date.prepare(); err != nil {
+				return fmt.Errorf("column %s: %s", cc.label(), err)
+			}
+		}
+		for i := range cc.Transform {
+			if err := cc.Transform[i].prepare(); err != nil {
+				return fmt.Errorf("column %s: %s", cc.label(), err)
+			}
+		}
+		if err := c.Columns[i].prepareCache(); err != nil {
+			return fmt.Errorf("column %s: %s", cc.label(), err)
+		}
+		if cc.HeatMap != nil {
+			if err := cc.HeatMap.prepare(); err != nil {
+				return fmt.Errorf("column %s: %s", cc.label(), err)
+			}
+		}
+		if cc.Sparkline != nil {
+			if err := cc.Sparkline.prepare(); err != nil {
+				return fmt.Errorf("column %s: %s", cc.label(), err)
+			}
+		}
+		if cc.Renderer != nil {
+			if err := cc.Renderer.prepare(); err != nil {
+				return fmt.Errorf("column %s: %s", cc.label(), err)
+			}
+		}
+		for value, b := range cc.Badges {
+			if err := b.prepare(); err != nil {
+				return fmt.Errorf("column %s: badge %q: %s", cc.label(), value, err)
+			}
+			cc.Badges[value] = b
+		}
+	}
+	if c.Source != nil {
+		if err := c.Source.prepare(); err != nil {
+			return fmt.Errorf("source: %s", err)
+		}
+	}
+	if c.Schema != nil {
+		if err := c.Schema.prepare(); err != nil {
+			return fmt.Errorf("schema: %s", err)
+		}
+	}
+	if c.Pivot != nil {
+		if err := c.Pivot.prepare(); err != nil {
+			return fmt.Errorf("pivot: %s", err)
+		}
+	}
+	if c.Footnotes != nil {
+		switch c.Footnotes.Placement {
+		case "", "page", "end":
+		default:
+			return fmt.Errorf("footnotes: placement must be page or end")
+		}
+	}
+	if c.Freshness != nil {
+		c.Freshness.loc = c.loc
+	}
+	if c.Stationery != nil {
+		if err := c.Stationery.prepare(); err != nil {
+			return fmt.Errorf("stationery: %s", err)
+		}
+	}
+	if c.SignOff != nil {
+		if err := c.SignOff.prepare(c); err != nil {
+			return fmt.Errorf("signOff: %s", err)
+		}
+	}
+	if c.Form != nil {
+		if err := c.Form.prepare(c); err != nil {
+			return fmt.Errorf("form: %s", err)
+		}
+	}
+	if c.Insert != nil {
+		if err := c.Insert.prepare(c); err != nil {
+			return fmt.Errorf("insert: %s", err)
+		}
+	}
+	if c.ContactSheet != nil {
+		if err := c.ContactSheet.prepare(c); err != nil {
+			return fmt.Errorf("contactSheet: %s", err)
+		}
+	}
+	if c.Previews != nil {
+		if err := c.Previews.prepare(); err != nil {
+			return fmt.Errorf("previews: %s", err)
+		}
+	}
+	if c.TextVersion != nil {
+		if err := c.TextVersion.prepare(); err != nil {
+			return fmt.Errorf("textVersion: %s", err)
+		}
+	}
+	if c.Compression != nil {
+		if err := c.Compression.prepare(); err != nil {
+			return fmt.Errorf("compression: %s", err)
+		}
+	}
+	if c.Orientation != nil {
+		if err := c.Orientation.prepare(); err != nil {
+			return fmt.Errorf("orientation: %s", err)
+		}
+	}
+	if c.CellStyle != nil {
+		if err := c.CellStyle.prepare(); err != nil {
+			return fmt.Errorf("cellStyle: %s", err)
+		}
+	}
+	if c.RotateHeader != nil {
+		if err := c.RotateHeader.prepare(); err != nil {
+			return fmt.Errorf("rotateHeader: %s", err)
+		}
+	}
+	if c.Attach != nil {
+		if err := c.Attach.prepare(c); err != nil {
+			return fmt.Errorf("attach: %w", err)
+		}
+	}
+	if c.RawData != nil {
+		if err := c.RawData.prepare(c); err != nil {
+			return fmt.Errorf("rawData: %s", err)
+		}
+	}
+	if c.Dashboard != nil {
+		if err := c.Dashboard.prepare(); err != nil {
+			return fmt.Errorf("dashboard: %s", err)
+		}
+	}
+	if c.Diff != nil {
+		if err := c.Diff.prepare(c); err != nil {
+			return fmt.Errorf("diff: %s", err)
+		}
+	}
+	if c.Empty != nil {
+		if err := c.Empty.prepare(); err != nil {
+			return fmt.Errorf("empty: %s", err)
+		}
+	}
+	for i := range c.Callouts {
+		if err := c.Callouts[i].prepare(); err != nil {
+			return fmt.Errorf("callout %d: %s", i+1, err)
+		}
+	}
+	for i := range c.Enrich {
+		if err := c.Enrich[i].prepare(); err != nil {
+			return fmt.Errorf("enrich: %s: %s", c.Enrich[i].Provider, err)
+		}
+	}
+	if c.ArtifactKey != "" {
+		if c.artifactKey, err = parseArtifactKey(c.ArtifactKey); err != nil {
+			return err
+		}
+	}
+	if c.Delivery != nil {
+		c.Delivery.artifactKey = c.artifactKey
+		for i := range c.Delivery.Targets {
+			if err := c.Delivery.Targets[i].prepare(); err != nil {
+				return fmt.Errorf("delivery: targets: %s: %s", c.Delivery.Targets[i].Type, err)
+			}
+		}
+	}
+	if c.Recipients != nil {
+		switch {
+		case c.Recipients.File == "":
+			return fmt.Errorf("recipients: file is required")
+		case c.Split != nil:
+			return fmt.Errorf("recipients: cannot be combined with split")
+		case c.Delivery == nil || c.Delivery.Email == nil:
+			return fmt.Errorf("recipients: requires email delivery")
+		}
+	}
+	if c.Delivery != nil && c.Delivery.SkipUnchanged != nil {
+		if err := c.Delivery.SkipUnchanged.prepare(c.Deterministic); err != nil {
+			return fmt.Errorf("delivery: skipUnchanged: %s", err)
+		}
+	}
+	if c.Labels != nil {
+		if _, err := c.Labels.geometry(); err != nil {
+			return fmt.Errorf("labels: %s", err)
+		}
+	}
+	if c.Archive != nil {
+		if _, _, err := c.Archive.part(); err != nil {
+			return fmt.Errorf("archive: %s", err)
+		}
+		if c.fonts()[""] == "" {
+			return fmt.Errorf("archive: PDF/A requires embedded fonts; configure at least a regular (\"\") font")
+		}
+		if c.Archive.ICCProfile == "" {
+			return fmt.Errorf("archive: iccProfile is required")
+		}
+	}
+	if c.EInvoice != nil {
+		if err := c.EInvoice.prepare(c.Archive); err != nil {
+			return fmt.Errorf("eInvoice: %s", err)
+		}
+	}
+	if c.Tagged != nil {
+		if err := c.Tagged.prepare(c); err != nil {
+			return fmt.Errorf("tagged: %s", err)
+		}
+	}
+	return nil
+}
+
+// resolve turns all column references into indexes into hdr, which
+// includes the computed columns; see withComputed. It fails
+// if a referenced column does not exist, so that a report does not
+// silently print the wrong data after the input columns were reordered.
+func (c *Config) resolve(hdr []string) error {
+	if err := c.compileComputed(hdr); err != nil {
+		return err
+	}
+	if err := c.trendBadges(hdr); err != nil {
+		return err
+	}
+	for i := range c.Columns {
+		cc := &c.Columns[i]
+		ref := ColumnRef{Name: cc.Name, Index: cc.Index}
+		if err := ref.resolve(hdr); err != nil {
+			return err
+		}
+		cc.Index = ref.Index
+		if cc.Sparkline != nil {
+			if err := cc.Sparkline.resolve(hdr); err != nil {
+				return fmt.Errorf("column %s: sparkline: %s", cc.label(), err)
+			}
+		}
+	}
+	if c.Rank != nil {
+		if err := c.Rank.Column.resolve(hdr); err != nil {
+			return fmt.Errorf("rank: %s", err)
+		}
+	}
+	if c.Group != nil {
+		if err := c.Group.Column.resolve(hdr); err != nil {
+			return fmt.Errorf("group: %s", err)
+		}
+		for i := range c.Group.Sum {
+			if err := c.Group.Sum[i].resolve(hdr); err != nil {
+				return fmt.Errorf("group sum: %s", err)
+			}
+		}
+	}
+	if c.Split != nil {
+		if err := c.Split.Column.resolve(hdr); err != nil {
+			return fmt.Errorf("split: %s", err)
+		}
+	}
+	if c.Freeze != nil {
+		if err := c.Freeze.resolve(hdr); err != nil {
+			return fmt.Errorf("freeze: %s", err)
+		}
+	}
+	if c.RotateHeader != nil {
+		if err := c.RotateHeader.resolve(hdr); err != nil {
+			return fmt.Errorf("rotateHeader: %s", err)
+		}
+	}
+	if err := resolveHeaderGroups(c.HeaderGroups, hdr); err != nil {
+		return fmt.Errorf("headerGroups: %s", err)
+	}
+	if c.Dashboard != nil {
+		if err := c.Dashboard.resolve(hdr); err != nil {
+			return fmt.Errorf("dashboard: %s", err)
+		}
+	}
+	for i := range c.Callouts {
+		if err := c.Callouts[i].resolve(hdr, c.renamed); err != nil {
+			return fmt.Errorf("callout %d: %s", i+1, err)
+		}
+	}
+	if c.Link != nil {
+		if err := c.Link.resolve(hdr); err != nil {
+			return fmt.Errorf("link: %s", err)
+		}
+	}
+	if c.Merge != nil && c.Merge.Key != nil {
+		if err := c.Merge.Key.resolve(hdr); err != nil {
+			return fmt.Errorf("merge key: %s", err)
+		}
+	}
+	if c.Delivery != nil && c.Delivery.Email != nil && c.Delivery.Email.RecipientColumn != nil {
+		if err := c.Delivery.Email.RecipientColumn.resolve(hdr); err != nil {
+			return fmt.Errorf("email recipient: %s", err)
+		}
+	}
+	if c.Delivery != nil {
+		for _, t := range c.Delivery.Targets {
+			if ec, ok := t.deliverer.(*EmailConfig); ok && ec.RecipientColumn != nil {
+				if err := ec.RecipientColumn.resolve(hdr); err != nil {
+					return fmt.Errorf("email recipient: %s", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ColumnRef references a column by header name or by zero-based index.
+// In JSON, it is written as a string or a number, respectively.
+type ColumnRef struct {
+	Name  string
+	Index int
+}
+
+// UnmarshalJSON accepts a column name or index.
+func (r *ColumnRef) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &r.Name)
+	}
+	return json.Unmarshal(b, &r.Index)
+}
+
+// MarshalJSON writes the name, if known, or else the index.
+func (r ColumnRef) MarshalJSON() ([]byte, error) {
+	if r.Name != "" {
+		return json.Marshal(r.Name)
+	}
+	return json.Marshal(r.Index)
+}
+
+// resolve sets r.Index to the position of r.Name in hdr, or checks that
+// r.Index is within range if r has no name.
+func (r *ColumnRef) resolve(hdr []string) error {
+	if r.Name != "" {
+		i := indexOf(hdr, r.Name)
+		if i < 0 {
+			return fmt.Errorf("column %q not found in header", r.Name)
+		}
+		r.Index = i
+		return nil
+	}
+	if r.Index < 0 || r.Index >= len(hdr) {
+		return fmt.Errorf("column index %d out of range; the input has %d columns", r.Index, len(hdr))
+	}
+	return nil
+}
+
+// label identifies the column in error messages.
+func (cc ColumnConfig) label() string {
+	if cc.Name != "" {
+		return fmt.Sprintf("%q", cc.Name)
+	}
+	return fmt.Sprint(cc.Index)
+}
+
+// width returns the width of column i in mm.
+func (c *Config) width(i int) float64 {
+	if w := c.column(i).Width; w > 0 {
+		return w
+	}
+	if i < len(c.widths) {
+		return c.widths[i]
+	}
+	return 40
+}
+
+// column returns the settings for column i, or the zero value if the
+// column is not configured.
+func (c *Config) column(i int) ColumnConfig {
+	for _, cc := range c.Columns {
+		if cc.Index == i {
+			return cc
+		}
+	}
+	return ColumnConfig{Index: i}
+}
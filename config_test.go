@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestColumnRef(t *testing.T) {
+	hdr := []string{"Item", "Total", "Date"}
+	tests := []struct {
+		json  string
+		index int
+		err   string
+	}{
+		{`"Total"`, 1, ""},
+		{`"Date"`, 2, ""},
+		{`0`, 0, ""},
+		{`2`, 2, ""},
+		{`"total"`, 0, `column "total" not found in header`},
+		{`3`, 0, "column index 3 out of range; the input has 3 columns"},
+		{`-1`, 0, "column index -1 out of range; the input has 3 columns"},
+	}
+	for _, tt := range tests {
+		var ref ColumnRef
+		if err := json.Unmarshal([]byte(tt.json), &ref); err != nil {
+			t.Fatalf("%s: %v", tt.json, err)
+		}
+		err := ref.resolve(hdr)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: resolve = %v, want %q", tt.json, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || ref.Index != tt.index {
+			t.Errorf("%s: resolve = %d, %v; want %d", tt.json, ref.Index, err, tt.index)
+		}
+		b, err := json.Marshal(ref)
+		if err != nil || string(b) != tt.json {
+			t.Errorf("%s: marshaled as %s, %v", tt.json, b, err)
+		}
+	}
+}
+
+func TestColumnsByName(t *testing.T) {
+	// The same configuration works after the columns were reordered.
+	cfg := `{"columns": [{"name": "Shipped", "date": {"format": "02.01.2006"}}],
+		"rank": {"column": "Total"}, "textVersion": {"format": "text"}}`
+	for _, input := range []string{
+		"Item,Total,Shipped\nApples,10,2024-03-07\nPears,20,2024-03-08\n",
+		"Shipped,Item,Total\n2024-03-07,Apples,10\n2024-03-08,Pears,20\n",
+	} {
+		env := testEnv(map[string]string{"in.csv": input, "cfg.json": cfg})
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+		text := testFile(t, env, "out.txt")
+		for _, want := range []string{"07.03.2024", "08.03.2024"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("%q: text version lacks %q:\n%s", input, want, text)
+			}
+		}
+	}
+
+	env := testEnv(map[string]string{"in.csv": "Item,Sum\nApples,10\n", "cfg.json": cfg})
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), `column "Shipped" not found in header`) {
+		t.Errorf("missing column: %v", err)
+	}
+}
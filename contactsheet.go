@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ## Contact sheets
+
+// A printed pack of a hundred pages is hard to find one's way in. A
+// contact sheet helps: a page with small pictures of all pages and their
+// numbers, which shows at a glance where the tables, the charts, and the
+// appendix are:
+//
+//	"contactSheet": {"columns": 5}
+//
+// The sheets follow the last page of the report. With "separate", they
+// go to a file of their own instead, next to the report:
+// report.pdf gets report.contact.pdf.
+//
+// The thumbnails are not images; each one draws the page itself, scaled
+// down, so they stay sharp in print. gofpdf cannot draw its pages a
+// second time, so the sheets are added to the finished document, like
+// the objects of archival mode.
+
+// ContactSheetConfig adds pages with thumbnails of all pages.
+type ContactSheetConfig struct {
+	// Columns is the number of thumbnails per row. Default: 4.
+	Columns int `json:"columns"`
+
+	// Separate writes the sheets to a file of their own instead of
+	// appending them to the report.
+	Separate bool `json:"separate"`
+}
+
+func (cs *ContactSheetConfig) prepare(c *Config) error {
+	if cs.Columns < 0 {
+		return errors.New("columns must not be negative")
+	}
+	if c.Archive != nil {
+		return errors.New("PDF/A requires embedded fonts, which contact sheets do not use")
+	}
+	return nil
+}
+
+// contactSheetPath returns the path of the separate contact sheet for a
+// PDF path.
+func contactSheetPath(pdfPath string) string {
+	return strings.TrimSuffix(pdfPath, ".pdf") + ".contact.pdf"
+}
+
+// finisher returns the post-processing step for savePDF that appends
+// the sheets.
+func (cs *ContactSheetConfig) finisher() func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return cs.add(data, false)
+	}
+}
+
+var (
+	rePages    = regexp.MustCompile(`/Pages (\d+) 0 R`)
+	reKids     = regexp.MustCompile(`/Kids \[([^\]]*)\]`)
+	reRef      = regexp.MustCompile(`(\d+) 0 R`)
+	reCount    = regexp.MustCompile(`/Count (\d+)`)
+	reMediaBox = regexp.MustCompile(`/MediaBox \[([-\d. ]+)\]`)
+	reRes      = regexp.MustCompile(`/Resources (\d+) 0 R`)
+	reContents = regexp.MustCompile(`/Contents (\d+) 0 R`)
+	reLength   = regexp.MustCompile(`/Length (\d+)`)
+	reFilter   = regexp.MustCompile(`/Filter /(\w+)`)
+)
+
+// sheetPage is a page of the report, as far as a thumbnail needs it.
+type sheetPage struct {
+	w, h      float64 // in points
+	resources string  // object number of the resources
+	filter    string  // of the content stream, if any
+	content   []byte
+}
+
+// add appends an incremental update with the contact sheets to data.
+// Each page of the report becomes a form XObject that the sheets draw.
+// If separate is true, the sheets replace the pages of the document.
+func (cs *ContactSheetConfig) add(data []byte, separate bool) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("contact sheet: cannot find cross-reference table")
+	}
+	prev := string(m[1])
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("contact sheet: cannot parse trailer")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+
+	catalog := pdfObject(data, string(root[1]))
+	pagesRef := rePages.FindSubmatch(catalog)
+	if pagesRef == nil {
+		return nil, errors.New("contact sheet: cannot find the page tree")
+	}
+	pagesNum := string(pagesRef[1])
+	pagesObj := pdfObject(data, pagesNum)
+	kids := reKids.FindSubmatch(pagesObj)
+	box := reMediaBox.FindSubmatch(pagesObj)
+	if kids == nil || box == nil {
+		return nil, errors.New("contact sheet: cannot parse the page tree")
+	}
+	sheetW, sheetH := mediaBoxSize(string(box[1]))
+
+	var pages []sheetPage
+	for _, ref := range reRef.FindAllSubmatch(kids[1], -1) {
+		obj := pdfObject(data, string(ref[1]))
+		p := sheetPage{w: sheetW, h: sheetH}
+		if b := reMediaBox.FindSubmatch(obj); b != nil {
+			p.w, p.h = mediaBoxSize(string(b[1]))
+		}
+		res, contents := reRes.FindSubmatch(obj), reContents.FindSubmatch(obj)
+		if res == nil || contents == nil {
+			return nil, fmt.Errorf("contact sheet: cannot parse page object %s", ref[1])
+		}
+		p.resources = string(res[1])
+		var err error
+		if p.content, p.filter, err = contentStream(data, string(contents[1])); err != nil {
+			return nil, fmt.Errorf("contact sheet: %s", err)
+		}
+		pages = append(pages, p)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	var offsets []int // of the new objects, numbered from size on
+	newObj := func() int {
+		offsets = append(offsets, buf.Len())
+		return size + len(offsets) - 1
+	}
+
+	// Every page becomes a form.
+	forms := make([]int, len(pages))
+	for i, p := range pages {
+		forms[i] = newObj()
+		filter := ""
+		if p.filter != "" {
+			filter = " /Filter /" + p.filter
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Resources %s 0 R%s /Length %d >>\nstream\n",
+			forms[i], p.w, p.h, p.resources, filter, len(p.content))
+		buf.Write(p.content)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+	font := newObj()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\nendobj\n", font)
+
+	// The sheets. Thumbnails of all pages have the same box, so that
+	// portrait and landscape pages line up.
+	const margin, gap, label = 36.0, 12.0, 14.0
+	cols := cs.Columns
+	if cols == 0 {
+		cols = 4
+	}
+	ratio := 0.0
+	for _, p := range pages {
+		ratio = math.Max(ratio, p.h/p.w)
+	}
+	cellW := (sheetW - 2*margin - float64(cols-1)*gap) / float64(cols)
+	cellH := cellW * ratio
+	rows := int((sheetH - 2*margin + gap) / (cellH + label + gap))
+	if rows < 1 {
+		rows = 1
+		cellH = sheetH - 2*margin - label
+	}
+	perSheet := rows * cols
+
+	// A separate document gets a page tree of its own, which is written
+	// after the sheets that refer to it.
+	pagesNumber, _ := strconv.Atoi(pagesNum)
+	if separate {
+		pagesNumber = newObj()
+	}
+	var sheets []int
+	for first := 0; first < len(pages); first += perSheet {
+		var content bytes.Buffer
+		var xobjects []string
+		for i := first; i < len(pages) && i < first+perSheet; i++ {
+			p := pages[i]
+			col, row := (i-first)%cols, (i-first)/cols
+			s := math.Min(cellW/p.w, cellH/p.h)
+			w, h := p.w*s, p.h*s
+			x := margin + float64(col)*(cellW+gap) + (cellW-w)/2
+			top := sheetH - margin - float64(row)*(cellH+label+gap)
+			y := top - h
+			fmt.Fprintf(&content, "q %.4f 0 0 %.4f %.2f %.2f cm /P%d Do Q\n", s, s, x, y, i+1)
+			fmt.Fprintf(&content, "q 0.6 G 0.5 w %.2f %.2f %.2f %.2f re S Q\n", x, y, w, h)
+			num := strconv.Itoa(i + 1)
+			fmt.Fprintf(&content, "BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET\n", x+w/2-float64(len(num))*2.22, top-cellH-10, num)
+			xobjects = append(xobjects, fmt.Sprintf("/P%d %d 0 R", i+1, forms[i]))
+		}
+		contentObj := newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d >>\nstream\n", contentObj, content.Len())
+		buf.Write(content.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+		sheet := newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << %s >> /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			sheet, pagesNumber, sheetW, sheetH, strings.Join(xobjects, " "), font, contentObj)
+		sheets = append(sheets, sheet)
+	}
+	var sheetRefs []string
+	for _, s := range sheets {
+		sheetRefs = append(sheetRefs, fmt.Sprintf("%d 0 R", s))
+	}
+
+	// The page tree either gets the sheets as additional pages, or is
+	// replaced by one that holds only the sheets.
+	rootObj := string(root[1])
+	var updated []int // numbers and offsets of replaced objects
+	if separate {
+		offsets[pagesNumber-size] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", pagesNumber, strings.Join(sheetRefs, " "), len(sheets))
+		catalog := newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", catalog, pagesNumber)
+		rootObj = strconv.Itoa(catalog)
+	} else {
+		count := reCount.FindSubmatch(pagesObj)
+		if count == nil {
+			return nil, errors.New("contact sheet: cannot parse the page tree")
+		}
+		n, _ := strconv.Atoi(string(count[1]))
+		updated = append(updated, pagesNumber, buf.Len())
+		fmt.Fprintf(&buf, "%s 0 obj\n<< /Type /Pages /Kids [%s %s] /Count %d /MediaBox [%s] >>\nendobj\n",
+			pagesNum, strings.TrimSpace(string(kids[1])), strings.Join(sheetRefs, " "), n+len(sheets), box[1])
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(updated); i += 2 {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", updated[i], updated[i+1])
+	}
+	fmt.Fprintf(&buf, "%d %d\n", size, len(offsets))
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		size+len(offsets), rootObj, info[1], prev, xref)
+	return buf.Bytes(), nil
+}
+
+// pdfObject returns the last definition of object num in data, up to
+// and including "endobj", or nil.
+func pdfObject(data []byte, num string) []byte {
+	start := bytes.LastIndex(data, []byte("\n"+num+" 0 obj\n"))
+	if start < 0 {
+		return nil
+	}
+	obj := data[start+1:]
+	end := bytes.Index(obj, []byte("endobj"))
+	if end < 0 {
+		return nil
+	}
+	return obj[:end+len("endobj")]
+}
+
+// contentStream returns the data of stream object num in data, as it is
+// stored, and its filter, if any.
+func contentStream(data []byte, num string) ([]byte, string, error) {
+	stream := pdfObject(data, num)
+	length := reLength.FindSubmatch(stream)
+	start := bytes.Index(stream, []byte("stream\n"))
+	if length == nil || start < 0 {
+		return nil, "", fmt.Errorf("cannot parse content stream %s", num)
+	}
+	n, _ := strconv.Atoi(string(length[1]))
+	start += len("stream\n")
+	if start+n > len(stream) {
+		return nil, "", fmt.Errorf("content stream %s is truncated", num)
+	}
+	filter := ""
+	if f := reFilter.FindSubmatch(stream[:start]); f != nil {
+		filter = string(f[1])
+	}
+	return stream[start : start+n], filter, nil
+}
+
+// mediaBoxSize returns the width and height of a media box given as
+// "llx lly urx ury".
+func mediaBoxSize(box string) (float64, float64) {
+	var v [4]float64
+	for i, f := range strings.Fields(box) {
+		if i < 4 {
+			v[i], _ = strconv.ParseFloat(f, 64)
+		}
+	}
+	return v[2] - v[0], v[3] - v[1]
+}
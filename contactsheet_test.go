@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pageObjects returns the page objects of a document, in the order of
+// its page tree, as the cross-reference tables find them.
+func pageObjects(t *testing.T, data []byte) []*pdfObj {
+	t.Helper()
+	doc, err := readPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := strconv.Atoi(doc.root)
+	tree, _ := strconv.Atoi(string(rePages.FindSubmatch(doc.objects[root].dict)[1]))
+	pages := doc.objects[tree]
+	var objs []*pdfObj
+	for _, ref := range reRef.FindAllSubmatch(reKids.FindSubmatch(pages.dict)[1], -1) {
+		n, _ := strconv.Atoi(string(ref[1]))
+		if doc.objects[n] == nil {
+			t.Fatalf("page %d is missing", n)
+		}
+		objs = append(objs, doc.objects[n])
+	}
+	if count := reCount.FindSubmatch(pages.dict); count == nil || string(count[1]) != strconv.Itoa(len(objs)) {
+		t.Errorf("the page tree has %d pages, but counts %q", len(objs), count)
+	}
+	return objs
+}
+
+// sheetContents returns the content streams of the contact sheets among
+// pages.
+func sheetContents(t *testing.T, data []byte, pages []*pdfObj) []string {
+	t.Helper()
+	var sheets []string
+	for _, p := range pages {
+		if !strings.Contains(string(p.dict), "/XObject") {
+			continue
+		}
+		n := reContents.FindSubmatch(p.dict)[1]
+		content, _, err := contentStream(data, string(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheets = append(sheets, string(content))
+	}
+	return sheets
+}
+
+func longCSV(rows int) string {
+	var csv strings.Builder
+	csv.WriteString("Item,Total\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&csv, "Item %d,%d\n", i, i)
+	}
+	return csv.String()
+}
+
+func TestContactSheet(t *testing.T) {
+	// The report has three landscape pages; a sheet holds one row of
+	// two.
+	env := testEnv(map[string]string{
+		"in.csv":   longCSV(50),
+		"cfg.json": `{"contactSheet": {"columns": 2}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(testFile(t, env, "out.pdf"))
+	pages := pageObjects(t, data)
+	sheets := sheetContents(t, data, pages)
+	if len(pages) != 5 || len(sheets) != 2 {
+		t.Fatalf("%d pages with %d sheets, want 3 pages and 2 sheets", len(pages), len(sheets))
+	}
+	for i, want := range [][]string{{"/P1 Do", "(1) Tj", "/P2 Do", "(2) Tj"}, {"/P3 Do", "(3) Tj"}} {
+		for _, s := range want {
+			if !strings.Contains(sheets[i], s) {
+				t.Errorf("sheet %d lacks %q:\n%s", i+1, s, sheets[i])
+			}
+		}
+	}
+	if strings.Contains(sheets[1], "/P1 Do") {
+		t.Error("the second sheet repeats the first page")
+	}
+}
+
+func TestSeparateContactSheet(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   longCSV(50),
+		"cfg.json": `{"contactSheet": {"separate": true}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	report := []byte(testFile(t, env, "out.pdf"))
+	if n := len(pageObjects(t, report)); n != 3 {
+		t.Errorf("the report has %d pages, want 3", n)
+	}
+	data := []byte(testFile(t, env, "out.contact.pdf"))
+	pages := pageObjects(t, data)
+	sheets := sheetContents(t, data, pages)
+	if len(pages) != 1 || len(sheets) != 1 || !strings.Contains(sheets[0], "/P3 Do") {
+		t.Errorf("the contact sheet has %d pages and %d sheets", len(pages), len(sheets))
+	}
+}
+
+func TestContactSheetConfig(t *testing.T) {
+	if got := contactSheetPath("out/report.pdf"); got != "out/report.contact.pdf" {
+		t.Errorf("contactSheetPath = %q", got)
+	}
+	if w, h := mediaBoxSize("0 0 792.00 612.00"); w != 792 || h != 612 {
+		t.Errorf("mediaBoxSize = %v, %v", w, h)
+	}
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"contactSheet": {"columns": -1}}`, "columns must not be negative"},
+		{`{"contactSheet": {}, "archive": {"fonts": {"": "f.ttf"}, "iccProfile": "p.icc"}}`, "PDF/A requires embedded fonts"},
+	} {
+		env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n", "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
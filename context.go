@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ## Cancellation and timeouts
+
+// A report of a million rows takes minutes, and a report that nobody
+// waits for anymore should not take them. GenerateContext runs a job
+// until its context is done: a caller that gives up cancels the
+// context, and the job stops at the next row, the next report of a
+// split, or the next request to a data source, without writing its
+// output. The job API cancels a job when the client that waits for it
+// disconnects, or when it is asked to:
+//
+//	POST   /reports?wait=1  runs the job and responds with the PDF
+//	DELETE /jobs/{id}       cancels a queued or running job
+//
+// A timeout bounds the time a job may take, however large or
+// pathological its input:
+//
+//	pdf -timeout 10m -config sales.json sales.csv
+//
+// or "timeout": "10m" in a job of the daemon or the API. A job that runs
+// out of time fails with the exit code 1.
+
+// GenerateContext runs a job like generate, but stops when ctx is done
+// or the job's timeout has passed.
+func GenerateContext(ctx context.Context, env *Env, job *Job) error {
+	var timeout time.Duration
+	if job.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(job.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout %q", job.Timeout)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	e := *env
+	e.ctx = ctx
+	err := generate(&e, job)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded && timeout > 0:
+		return fmt.Errorf("timed out after %v: %w", timeout, ctx.Err())
+	case ctx.Err() != nil:
+		return fmt.Errorf("canceled: %w", ctx.Err())
+	}
+	return err
+}
+
+// context returns the context of the job that env runs.
+func (env *Env) context() context.Context {
+	if env.ctx == nil {
+		return context.Background()
+	}
+	return env.ctx
+}
+
+// canceled returns the error of the job's context if it is done, and
+// nil otherwise.
+func (env *Env) canceled() error {
+	if env.ctx == nil {
+		return nil
+	}
+	return env.ctx.Err()
+}
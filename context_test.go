@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateContext(t *testing.T) {
+	csv := "Item,Total\nApples,1\nPears,2\nPlums,3\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows := 0
+	env := testEnv(map[string]string{"in.csv": csv})
+	env.Hooks = &RenderHooks{OnRow: func(pdf *Fpdf, hc HookContext) {
+		rows++
+		if hc.Row == 0 {
+			cancel()
+		}
+	}}
+	err := GenerateContext(ctx, env, &Job{Input: "in.csv", Output: "out.pdf"})
+	if !errors.Is(err, context.Canceled) || !strings.HasPrefix(err.Error(), "canceled: ") {
+		t.Errorf("canceled job: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("the job rendered %d rows after it was canceled", rows-1)
+	}
+	if _, err := env.FS.Open("out.pdf"); err == nil {
+		t.Error("a canceled job wrote its report")
+	}
+
+	for _, tt := range []struct{ timeout, err string }{
+		{"1ns", "timed out after 1ns: context deadline exceeded"},
+		{"soon", `invalid timeout "soon"`},
+		{"-1s", `invalid timeout "-1s"`},
+		{"1h", ""},
+	} {
+		env := testEnv(map[string]string{"in.csv": csv})
+		err := GenerateContext(context.Background(), env, &Job{Input: "in.csv", Output: "out.pdf", Timeout: tt.timeout})
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("timeout %s: %v, want %q", tt.timeout, err, tt.err)
+		}
+	}
+}
+
+func TestJobAPICancel(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	env := testEnv(map[string]string{filepath.Join("in", "sales.csv"): "Region,Total\nNorth,1\nSouth,2\n"})
+	env.Hooks = &RenderHooks{OnRow: func(pdf *Fpdf, hc HookContext) {
+		if hc.Row == 0 {
+			close(started)
+			<-release
+		}
+	}}
+	mux := http.NewServeMux()
+	(&APIConfig{Root: "in", OutputDir: "out"}).register(mux, env)
+
+	w := serve(mux, "POST", "/reports", `{"input": "sales.csv"}`)
+	location := w.Header().Get("Location")
+	<-started
+	w = serve(mux, "DELETE", location, "")
+	close(release)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("DELETE %s: %d %s", location, w.Code, w.Body)
+	}
+	st := poll(t, mux, location)
+	if st.Status != "canceled" || !strings.Contains(st.Error, "context canceled") {
+		t.Errorf("canceled job finished with %+v", st)
+	}
+	if w := serve(mux, "DELETE", "/jobs/nonexistent", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of an unknown job: %d", w.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// ## CSV dialects
+
+// Not every CSV file is comma-separated UTF-8. European spreadsheet
+// exports, for example, routinely use semicolons and the Windows-1252
+// code page. A csvDialect describes how to read such files.
+type csvDialect struct {
+	Delimiter  string `json:"delimiter"`
+	Quote      string `json:"quote"`
+	Comment    string `json:"comment"`
+	LazyQuotes bool   `json:"lazyQuotes"`
+	Encoding   string `json:"encoding"`
+
+	// NoHeader and DetectHeader control how the header row is found;
+	// see splitHeader.
+	NoHeader     bool `json:"noHeader"`
+	DetectHeader bool `json:"detectHeader"`
+
+	// DuplicateHeaders is the policy for repeated column names; see
+	// uniqueHeader.
+	DuplicateHeaders string `json:"duplicateHeaders"`
+}
+
+// registerFlags adds the dialect settings to the given flag set.
+func (d *csvDialect) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&d.Delimiter, "delimiter", ",", `field delimiter, e.g. ";" or "tab"`)
+	fs.StringVar(&d.Quote, "quote", `"`, "quote character")
+	fs.StringVar(&d.Comment, "comment", "", "lines starting with this character are ignored")
+	fs.BoolVar(&d.LazyQuotes, "lazy-quotes", false, "allow quotes in unquoted fields and unescaped quotes in quoted fields")
+	fs.StringVar(&d.Encoding, "encoding", "auto", "input encoding: auto, utf-8, latin-1, or windows-1252")
+	fs.BoolVar(&d.NoHeader, "no-header", false, "the input has no header row; columns are named automatically")
+	fs.BoolVar(&d.DetectHeader, "detect-header", false, "guess whether the first row is a header")
+	fs.StringVar(&d.DuplicateHeaders, "duplicate-headers", "rename", "what to do with repeated column names: rename or error")
+}
+
+// reader returns a csv.Reader for r that honors the dialect settings.
+// Input in a legacy encoding is converted to UTF-8 first.
+func (d csvDialect) reader(r io.Reader) (*csv.Reader, error) {
+	comma, err := dialectRune("delimiter", orDefault(d.Delimiter, ","))
+	if err != nil {
+		return nil, err
+	}
+	quote, err := dialectRune("quote", orDefault(d.Quote, `"`))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := decodeText(raw, d.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	// encoding/csv only knows the double quote. A different quote
+	// character is handled by swapping both characters before parsing;
+	// swapQuotes restores the original characters in the parsed fields.
+	if quote != '"' {
+		text = swapRunes(text, quote, '"')
+	}
+	cr := csv.NewReader(strings.NewReader(text))
+	cr.Comma = comma
+	cr.LazyQuotes = d.LazyQuotes
+	if d.Comment != "" {
+		cr.Comment, err = dialectRune("comment", d.Comment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cr, nil
+}
+
+// swapQuotes undoes the quote swap of reader in all fields of rows.
+func (d csvDialect) swapQuotes(rows [][]string) {
+	quote, _ := dialectRune("quote", orDefault(d.Quote, `"`))
+	if quote == '"' {
+		return
+	}
+	for _, row := range rows {
+		for i := range row {
+			row[i] = swapRunes(row[i], quote, '"')
+		}
+	}
+}
+
+// dialectRune parses a single-character setting. The names "tab" and
+// `\t` denote the tab character.
+func dialectRune(name, s string) (rune, error) {
+	switch strings.ToLower(s) {
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return 0, fmt.Errorf("%s must be a single character, got %q", name, s)
+	}
+	return r, nil
+}
+
+func swapRunes(s string, a, b rune) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case a:
+			return b
+		case b:
+			return a
+		}
+		return r
+	}, s)
+}
+
+// decodeText converts raw input in the given encoding to a UTF-8 string.
+// With "auto", valid UTF-8 is taken as is and anything else is read as
+// Windows-1252, the usual encoding of spreadsheet exports on Windows.
+func decodeText(raw []byte, encoding string) (string, error) {
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	switch strings.ToLower(encoding) {
+	case "", "auto":
+		if utf8.Valid(raw) {
+			return string(raw), nil
+		}
+		return decodeSingleByte(raw, true), nil
+	case "utf-8", "utf8":
+		return string(raw), nil
+	case "latin-1", "latin1", "iso-8859-1":
+		return decodeSingleByte(raw, false), nil
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(raw, true), nil
+	}
+	return "", fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// cp1252 maps the bytes 0x80-0x9F of Windows-1252 to Unicode. Everywhere
+// else, Windows-1252 and Latin-1 agree with the first 256 Unicode code points.
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+func decodeSingleByte(raw []byte, windows bool) string {
+	var sb strings.Builder
+	sb.Grow(len(raw))
+	for _, b := range raw {
+		if windows && b >= 0x80 && b <= 0x9f {
+			sb.WriteRune(cp1252[b-0x80])
+			continue
+		}
+		sb.WriteRune(rune(b))
+	}
+	return sb.String()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		dialect csvDialect
+		want    [][]string
+	}{
+		{"comma", "a,b\n1,2\n", csvDialect{}, [][]string{{"a", "b"}, {"1", "2"}}},
+		{"semicolon", "a;b\n1,5;2\n", csvDialect{Delimiter: ";"}, [][]string{{"a", "b"}, {"1,5", "2"}}},
+		{"tab", "a\tb\n1\t2\n", csvDialect{Delimiter: "tab"}, [][]string{{"a", "b"}, {"1", "2"}}},
+		{"escaped tab", "a\tb\n", csvDialect{Delimiter: `\t`}, [][]string{{"a", "b"}}},
+		{"quote", "a,b\n'x, y','say \"hi\"'\n", csvDialect{Quote: "'"}, [][]string{{"a", "b"}, {"x, y", `say "hi"`}}},
+		{"comment", "# export\na,b\n#1,2\n3,4\n", csvDialect{Comment: "#"}, [][]string{{"a", "b"}, {"3", "4"}}},
+		{"lazy quotes", "a,b\n5\" pipe,2\n", csvDialect{LazyQuotes: true}, [][]string{{"a", "b"}, {`5" pipe`, "2"}}},
+		{"bom", "\xef\xbb\xbfa,b\n", csvDialect{}, [][]string{{"a", "b"}}},
+		{"utf-8", "Straße,Größe\n", csvDialect{Encoding: "utf-8"}, [][]string{{"Straße", "Größe"}}},
+		{"windows-1252", "Stra\xdfe;\x80\n", csvDialect{Delimiter: ";", Encoding: "windows-1252"}, [][]string{{"Straße", "€"}}},
+		{"latin-1", "Stra\xdfe,\x80\n", csvDialect{Encoding: "latin-1"}, [][]string{{"Straße", "\u0080"}}},
+		{"auto utf-8", "Straße,€\n", csvDialect{Encoding: "auto"}, [][]string{{"Straße", "€"}}},
+		{"auto legacy", "Stra\xdfe,\x80\n", csvDialect{Encoding: "auto"}, [][]string{{"Straße", "€"}}},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{"in.csv": tt.input})
+		got, err := loadCSV(env.FS, "in.csv", tt.dialect)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: loadCSV = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCSVErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		dialect csvDialect
+		err     string
+	}{
+		{"a,b\n", csvDialect{Delimiter: ";;"}, `delimiter must be a single character, got ";;"`},
+		{"a,b\n", csvDialect{Quote: ""}, ""},
+		{"a,b\n", csvDialect{Comment: "//"}, `comment must be a single character, got "//"`},
+		{"a,b\n", csvDialect{Encoding: "utf-16"}, `unsupported encoding "utf-16"`},
+		{"a,b\n5\" pipe,2\n", csvDialect{}, `bare " in non-quoted-field`},
+		{"a,b\n1\n", csvDialect{}, "wrong number of fields"},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{"in.csv": tt.input})
+		_, err := loadCSV(env.FS, "in.csv", tt.dialect)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%+v: %v", tt.dialect, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%+v: %v, want an error with %q", tt.dialect, err, tt.err)
+		}
+	}
+	if _, err := loadCSV(NewMemFS(nil), "missing.csv", csvDialect{}); err == nil || !strings.Contains(err.Error(), "cannot open 'missing.csv'") {
+		t.Errorf("missing file: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ## Daemon mode
+
+// Instead of being started by cron, the tool can run as a long-lived
+// process that regenerates its reports on schedule. The jobs are read
+// from a JSON file passed via `-daemon`.
+
+// DaemonConfig lists the scheduled jobs.
+type DaemonConfig struct {
+	// Listen is the address of the health endpoint and the job API,
+	// e.g. ":8080". Empty disables both.
+	Listen string `json:"listen"`
+
+	Jobs []*ScheduledJob `json:"jobs"`
+
+	// API accepts report jobs over HTTP; see APIConfig.
+	API *APIConfig `json:"api"`
+
+	// Portal offers the jobs as report profiles in a web UI; see
+	// PortalConfig.
+	Portal *PortalConfig `json:"portal"`
+}
+
+// ScheduledJob is a Job with a schedule.
+type ScheduledJob struct {
+	Job
+
+	// Schedule is a standard five-field cron expression, such as
+	// "0 6 * * 1-5", or a descriptor like "@daily".
+	Schedule string `json:"schedule"`
+
+	// Keep is the number of outputs to keep; older ones are removed.
+	// Only applies to local files whose path contains the placeholder
+	// {date} or {time}, which are replaced by the generation date or
+	// time. Zero keeps all outputs.
+	Keep int `json:"keep"`
+
+	mu     sync.Mutex
+	status jobStatus
+}
+
+// jobStatus is reported by the health endpoint.
+type jobStatus struct {
+	Name        string    `json:"name"`
+	Schedule    string    `json:"schedule"`
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastOutput  string    `json:"lastOutput,omitempty"`
+	NextRun     time.Time `json:"nextRun"`
+}
+
+// timePlaceholder in an output path is replaced by the generation time.
+const timePlaceholder = "{time}"
+
+// runDaemon schedules all jobs and blocks until the process receives
+// SIGINT or SIGTERM.
+func runDaemon(env *Env, path string) error {
+	dc, err := loadDaemonConfig(env.FS, path)
+	if err != nil {
+		return err
+	}
+
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+	ids := map[*ScheduledJob]cron.EntryID{}
+	for _, sj := range dc.Jobs {
+		sj := sj
+		id, err := c.AddFunc(sj.Schedule, func() { sj.run(env) })
+		if err != nil {
+			return fmt.Errorf("job %q: schedule %q: %w", sj.Name, sj.Schedule, err)
+		}
+		ids[sj] = id
+		sj.status = jobStatus{Name: sj.Name, Schedule: sj.Schedule}
+	}
+	c.Start()
+	env.Log.Info("daemon started", "jobs", len(dc.Jobs))
+
+	var srv *http.Server
+	if dc.Listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			healthz(w, dc, c, ids)
+		})
+		if dc.API != nil {
+			api := dc.API.register(mux, env)
+			if dc.Portal != nil {
+				dc.Portal.register(mux, dc.Jobs, api)
+			}
+		}
+		srv = &http.Server{Addr: dc.Listen, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				env.Log.Error("HTTP server failed", "listen", dc.Listen, "err", err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	env.Log.Info("shutting down")
+	if srv != nil {
+		srv.Shutdown(context.Background())
+	}
+	<-c.Stop().Done()
+	return nil
+}
+
+func loadDaemonConfig(fsys FileSystem, path string) (*DaemonConfig, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dc := &DaemonConfig{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if dc.API != nil && dc.Listen == "" {
+		return nil, fmt.Errorf("%s: the job API needs a listen address", path)
+	}
+	if dc.Portal != nil && dc.API == nil {
+		return nil, fmt.Errorf("%s: the portal needs the job API", path)
+	}
+	if dc.API != nil && dc.API.CacheTTL != "" {
+		if _, err := time.ParseDuration(dc.API.CacheTTL); err != nil {
+			return nil, fmt.Errorf("%s: api: cacheTTL: %w", path, err)
+		}
+	}
+	for i, sj := range dc.Jobs {
+		if sj.Name == "" {
+			sj.Name = fmt.Sprintf("job %d", i+1)
+		}
+		if sj.Output == "" {
+			return nil, fmt.Errorf("job %q: no output path", sj.Name)
+		}
+	}
+	return dc, nil
+}
+
+// run generates the report once and removes outputs that are too old.
+func (sj *ScheduledJob) run(env *Env) {
+	now := env.Clock.Now()
+	job := sj.Job
+	job.Output = expandOutput(sj.Output, now)
+	err := GenerateContext(context.Background(), env, &job)
+	if err == nil {
+		err = sj.rotate(env.FS)
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	sj.status.LastRun = now
+	if err != nil {
+		sj.status.LastError = err.Error()
+		env.Log.Error("job failed", "job", sj.Name, "err", err)
+		return
+	}
+	sj.status.LastError = ""
+	sj.status.LastSuccess = now
+	sj.status.LastOutput = job.Output
+	env.Log.Info("job finished", "job", sj.Name, "output", job.Output)
+}
+
+// rotate removes all but the newest Keep outputs. The date and time
+// placeholders produce names that sort by generation time.
+func (sj *ScheduledJob) rotate(fsys FileSystem) error {
+	if sj.Keep <= 0 || isRemote(sj.Output) {
+		return nil
+	}
+	output, err := expandParams("output", sj.Output, sj.Params)
+	if err != nil {
+		return err
+	}
+	pattern, ok := outputGlob(output)
+	if !ok {
+		return nil
+	}
+	outputs, err := fsys.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	sort.Strings(outputs)
+	for len(outputs) > sj.Keep {
+		if err := fsys.Remove(outputs[0]); err != nil {
+			return err
+		}
+		outputs = outputs[1:]
+	}
+	return nil
+}
+
+// healthz reports the status of all jobs. It responds with 503 Service
+// Unavailable if the latest run of any job failed.
+func healthz(w http.ResponseWriter, dc *DaemonConfig, c *cron.Cron, ids map[*ScheduledJob]cron.EntryID) {
+	code := http.StatusOK
+	var statuses []jobStatus
+	for _, sj := range dc.Jobs {
+		sj.mu.Lock()
+		st := sj.status
+		sj.mu.Unlock()
+		st.NextRun = c.Entry(ids[sj]).Next
+		if st.LastError != "" {
+			code = http.StatusServiceUnavailable
+		}
+		statuses = append(statuses, st)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputGlob(t *testing.T) {
+	tests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"report.pdf", "report.pdf", false},
+		{"sales-{date}.pdf", "sales-[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9].pdf", true},
+		{"sales-{time}.pdf", "sales-[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]-[0-9][0-9][0-9][0-9][0-9][0-9].pdf", true},
+		{"{date}/sales.pdf", "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]/sales.pdf", true},
+	}
+	for _, tt := range tests {
+		got, ok := outputGlob(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("outputGlob(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		if expanded := expandOutput(tt.path, testTime); !globMatch(t, got, expanded) {
+			t.Errorf("%q does not match %q", got, expanded)
+		}
+	}
+}
+
+// globMatch reports whether name matches pattern, as MemFS.Glob does.
+func globMatch(t *testing.T, pattern, name string) bool {
+	t.Helper()
+	names, err := NewMemFS(map[string][]byte{name: nil}).Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(names) == 1
+}
+
+func TestScheduledJobRotation(t *testing.T) {
+	for _, output := range []string{"out/sales-{date}.pdf", "out/sales-{time}.pdf", "out/{date}/sales.pdf"} {
+		now := testTime
+		env := testEnv(map[string]string{"in.csv": "Region,Total\nNorth,1\n", "out/sales-final.pdf": "keep me"})
+		env.Clock = ClockFunc(func() time.Time { return now })
+		sj := &ScheduledJob{Job: Job{Input: "in.csv", Output: output}, Keep: 2}
+		var outputs []string
+		for day := 0; day < 4; day++ {
+			now = testTime.AddDate(0, 0, day)
+			sj.run(env)
+			if sj.status.LastError != "" {
+				t.Fatalf("%s: %s", output, sj.status.LastError)
+			}
+			outputs = append(outputs, expandOutput(output, now))
+		}
+		pattern, _ := outputGlob(output)
+		left, _ := env.FS.Glob(pattern)
+		if want := outputs[2:]; !reflect.DeepEqual(left, want) {
+			t.Errorf("%s: kept %q, want %q", output, left, want)
+		}
+		if all, _ := env.FS.Glob("out/*"); !strings.Contains(strings.Join(all, " "), "out/sales-final.pdf") {
+			t.Errorf("%s: removed a file that is not an output: %q", output, all)
+		}
+	}
+}
+
+func TestScheduledJobKeepAll(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{"a-2024-01-01.pdf": nil, "a-2024-01-02.pdf": nil, "b.pdf": nil})
+	for _, sj := range []*ScheduledJob{
+		{Job: Job{Output: "a-{date}.pdf"}},
+		{Job: Job{Output: "b.pdf"}, Keep: 1},
+		{Job: Job{Output: "s3://bucket/a-{date}.pdf"}, Keep: 1},
+	} {
+		if err := sj.rotate(fsys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if all, _ := fsys.Glob("*"); len(all) != 3 {
+		t.Errorf("rotation removed files: %q left", all)
+	}
+}
+
+func TestLoadDaemonConfig(t *testing.T) {
+	tests := []struct {
+		config, err string
+	}{
+		{`{"jobs": [{"schedule": "@daily", "input": "in.csv", "output": "out-{date}.pdf", "keep": 7}]}`, ""},
+		{`{"jobs": [{"schedule": "@daily", "input": "in.csv"}]}`, `job "job 1": no output path`},
+		{`{"api": {"outputDir": "out"}}`, "the job API needs a listen address"},
+		{`{"listen": ":8080", "portal": {}}`, "the portal needs the job API"},
+		{`{"jobs": [{"output": "a.pdf", "every": "1h"}]}`, `unknown field "every"`},
+	}
+	for _, tt := range tests {
+		fsys := NewMemFS(map[string][]byte{"daemon.json": []byte(tt.config)})
+		_, err := loadDaemonConfig(fsys, "daemon.json")
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.config, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
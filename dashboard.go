@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// ## Dashboard
+
+// Readers who look at the first page only should see the state of
+// business at a glance, the way the BI dashboard shows it. A dashboard
+// fills the rest of the title page with a grid of small components:
+//
+//	"dashboard": {"columns": 3, "components": [
+//	  {"type": "kpi", "title": "Revenue", "column": "Total"},
+//	  {"type": "kpi", "title": "Orders", "aggregate": "count"},
+//	  {"type": "kpi", "title": "Average order", "column": "Total", "aggregate": "avg"},
+//	  {"type": "chart", "title": "Revenue by day", "column": "Total", "by": "Date", "span": 2},
+//	  {"type": "top", "title": "Top items", "column": "Total", "by": "Order Item", "count": 5}]}
+//
+// A "kpi" tile shows a single number: the sum (default), average,
+// minimum, or maximum of a column, or the number of rows. A "chart"
+// tile shows the sums of a column per value of another column, in the
+// order in which the values first appear, as bars (default) or a line.
+// A "top" tile lists the values with the largest sums. Rows without a
+// category are left out of charts and top lists. Numbers are formatted
+// like the cells of their column.
+//
+// Components fill the grid row by row; a component spans one or more
+// grid columns. The grid rows share the height left on the page, unless
+// a row height is set. The table starts on the next page.
+
+// DashboardConfig arranges components in a grid.
+type DashboardConfig struct {
+	// Columns is the number of grid columns. Default: 3.
+	Columns int `json:"columns"`
+
+	// RowHeight is the height of a grid row in mm. Default: the rows
+	// fill the page.
+	RowHeight float64 `json:"rowHeight"`
+
+	Components []DashboardComponent `json:"components"`
+}
+
+// DashboardComponent is a tile of the dashboard.
+type DashboardComponent struct {
+	// Type is "kpi", "chart", or "top".
+	Type  string `json:"type"`
+	Title string `json:"title"`
+
+	// Column holds the values, By the categories of charts and top
+	// lists.
+	Column *ColumnRef `json:"column"`
+	By     *ColumnRef `json:"by"`
+
+	// Aggregate is "sum" (default), "avg", "min", "max", or "count" for
+	// KPI tiles.
+	Aggregate string `json:"aggregate"`
+
+	// Chart is "bar" (default) or "line".
+	Chart string `json:"chart"`
+
+	// Count is the length of a top list. Default: 5.
+	Count int `json:"count"`
+
+	// Span is the number of grid columns the component spans. Default: 1.
+	Span int `json:"span"`
+}
+
+func (dc *DashboardConfig) prepare() error {
+	if dc.Columns < 0 || dc.RowHeight < 0 {
+		return fmt.Errorf("columns and rowHeight must not be negative")
+	}
+	if dc.Columns == 0 {
+		dc.Columns = 3
+	}
+	for k := range dc.Components {
+		if err := dc.Components[k].prepare(dc.Columns); err != nil {
+			return fmt.Errorf("component %d: %s", k+1, err)
+		}
+	}
+	return nil
+}
+
+func (c *DashboardComponent) prepare(columns int) error {
+	switch c.Type {
+	case "kpi":
+		switch c.Aggregate {
+		case "", "sum", "avg", "min", "max":
+			if c.Column == nil {
+				return fmt.Errorf("column is required")
+			}
+		case "count":
+		default:
+			return fmt.Errorf("unknown aggregate %q; use sum, avg, min, max, or count", c.Aggregate)
+		}
+	case "chart", "top":
+		if c.Column == nil || c.By == nil {
+			return fmt.Errorf("column and by are required")
+		}
+		switch c.Chart {
+		case "", "bar", "line":
+		default:
+			return fmt.Errorf("unknown chart %q; use bar or line", c.Chart)
+		}
+	default:
+		return fmt.Errorf("unknown type %q; use kpi, chart, or top", c.Type)
+	}
+	if c.Span < 0 || c.Span > columns {
+		return fmt.Errorf("span must be between 1 and %d", columns)
+	}
+	if c.Span == 0 {
+		c.Span = 1
+	}
+	if c.Count == 0 {
+		c.Count = 5
+	}
+	return nil
+}
+
+func (dc *DashboardConfig) resolve(hdr []string) error {
+	for k := range dc.Components {
+		for _, ref := range []*ColumnRef{dc.Components[k].Column, dc.Components[k].By} {
+			if ref == nil {
+				continue
+			}
+			if err := ref.resolve(hdr); err != nil {
+				return fmt.Errorf("component %d: %s", k+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dashboardGap is the space between tiles in mm.
+const dashboardGap = 4
+
+// dashboard prints the dashboard below the title and starts a new page
+// for the table.
+func dashboard(pdf *Fpdf, cfg *Config, rows [][]string) *Fpdf {
+	dc := cfg.Dashboard
+	if dc == nil || len(dc.Components) == 0 {
+		return pdf
+	}
+
+	// The components flow into the grid row by row.
+	type place struct{ row, col int }
+	places := make([]place, len(dc.Components))
+	row, col := 0, 0
+	for k, c := range dc.Components {
+		if col+c.Span > dc.Columns {
+			row, col = row+1, 0
+		}
+		places[k] = place{row, col}
+		col += c.Span
+	}
+
+	left, _, right, bottom := pdf.GetMargins()
+	pageWidth, pageHeight := pdf.GetPageSize()
+	top := pdf.GetY()
+	cw := (pageWidth - left - right - dashboardGap*float64(dc.Columns-1)) / float64(dc.Columns)
+	rh := dc.RowHeight
+	if rh == 0 {
+		fill := func() float64 {
+			return (pageHeight - bottom - top - dashboardGap*float64(row)) / float64(row+1)
+		}
+		// A long narrative may leave too little room on the title page.
+		if rh = fill(); rh < 25 {
+			addPage(pdf, "")
+			top = pdf.GetY()
+			rh = fill()
+		}
+	}
+	for k := range dc.Components {
+		c := &dc.Components[k]
+		p := places[k]
+		x := left + float64(p.col)*(cw+dashboardGap)
+		y := top + float64(p.row)*(rh+dashboardGap)
+		w := float64(c.Span)*cw + float64(c.Span-1)*dashboardGap
+		c.tile(pdf, cfg, rows, x, y, w, rh)
+	}
+	addPage(pdf, "")
+	return pdf
+}
+
+// tile prints the component into the box at x, y of size w × h.
+func (c *DashboardComponent) tile(pdf *Fpdf, cfg *Config, rows [][]string, x, y, w, h float64) {
+	loc := cfg.locale()
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.Rect(x, y, w, h, "D")
+	pdf.SetDrawColor(0, 0, 0)
+
+	const pad = 2
+	pdf.SetXY(x+pad, y+pad)
+	pdf.SetFont("Times", "B", 11)
+	pdf.CellFormat(w-2*pad, 5, loc.print(c.Title), "", 0, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+	bx, by, bw, bh := x+pad, y+pad+7, w-2*pad, h-2*pad-7
+
+	switch c.Type {
+	case "kpi":
+		// The number is as large as the tile allows.
+		str := c.kpi(cfg, rows)
+		size := math.Min(28, bh/0.3528*0.8)
+		pdf.SetFont("Times", "B", size)
+		for size > 8 && pdf.GetStringWidth(str) > bw {
+			size--
+			pdf.SetFontSize(size)
+		}
+		pdf.SetXY(bx, by)
+		pdf.CellFormat(bw, bh, str, "", 0, "CM", false, 0, "")
+
+	case "chart":
+		labels, sums := c.series(rows)
+		vs := make([]float64, len(sums))
+		for k := range sums {
+			vs[k] = sums[k].float()
+		}
+		sc := &SparklineConfig{Type: orDefault(c.Chart, "bar")}
+		sc.prepare()
+		pdf.SetXY(bx, by)
+		sparklineCell(pdf, sc, bw, bh-5, vs, "", false)
+		if len(labels) > 0 {
+			pdf.SetFont("Times", "", 8)
+			pdf.SetXY(bx, by+bh-5)
+			pdf.CellFormat(bw/2, 5, loc.print(labels[0]), "", 0, "L", false, 0, "")
+			pdf.CellFormat(bw/2, 5, loc.print(labels[len(labels)-1]), "", 0, "R", false, 0, "")
+		}
+
+	case "top":
+		labels, sums := c.series(rows)
+		order := make([]int, len(labels))
+		for k := range order {
+			order[k] = k
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return sums[order[i]].sum.Cmp(&sums[order[j]].sum) > 0
+		})
+		if len(order) > c.Count {
+			order = order[:c.Count]
+		}
+		lh := math.Min(6, bh/float64(c.Count))
+		pdf.SetFont("Times", "", math.Min(11, lh/0.3528*0.8))
+		for n, k := range order {
+			pdf.SetXY(bx, by+float64(n)*lh)
+			pdf.CellFormat(bw*0.65, lh, loc.print(labels[k]), "", 0, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+			pdf.CellFormat(bw*0.35, lh, c.format(cfg, &sums[k].sum, sums[k].places), "", 0, cfg.mirrored(ColumnConfig{}, "R"), false, 0, "")
+		}
+	}
+}
+
+// kpi returns the formatted number of a KPI tile.
+func (c *DashboardComponent) kpi(cfg *Config, rows [][]string) string {
+	if c.Aggregate == "count" {
+		return cfg.locale().print(cfg.locale().number(strconv.Itoa(len(rows))))
+	}
+	var sum decimalSum
+	var lo, hi *big.Rat
+	for _, line := range rows {
+		s := cellAt(line, c.Column.Index)
+		r, _, ok := parseDecimal(s)
+		if !ok {
+			continue
+		}
+		sum.add(s)
+		if lo == nil || r.Cmp(lo) < 0 {
+			lo = r
+		}
+		if hi == nil || r.Cmp(hi) > 0 {
+			hi = r
+		}
+	}
+	if sum.n == 0 {
+		return ""
+	}
+	switch c.Aggregate {
+	case "avg":
+		return c.format(cfg, sum.mean(), sum.places)
+	case "min":
+		return c.format(cfg, lo, sum.places)
+	case "max":
+		return c.format(cfg, hi, sum.places)
+	}
+	return c.format(cfg, &sum.sum, sum.places)
+}
+
+// series returns the values of the By column in the order in which they
+// first appear, with the sums of the Column values for each. Rows
+// without a value are left out.
+func (c *DashboardComponent) series(rows [][]string) ([]string, []*decimalSum) {
+	var labels []string
+	var sums []*decimalSum
+	index := map[string]int{}
+	for _, line := range rows {
+		label := cellAt(line, c.By.Index)
+		if label == "" {
+			continue
+		}
+		k, ok := index[label]
+		if !ok {
+			k = len(labels)
+			index[label] = k
+			labels = append(labels, label)
+			sums = append(sums, &decimalSum{})
+		}
+		sums[k].add(cellAt(line, c.Column.Index))
+	}
+	return labels, sums
+}
+
+// format formats a number like the cells of the component's column.
+func (c *DashboardComponent) format(cfg *Config, r *big.Rat, places int) string {
+	loc := cfg.locale()
+	return formatCell(loc.rounding.format(r, places), cfg.column(c.Column.Index), loc)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDashboardConfig(t *testing.T) {
+	tests := []struct {
+		dashboard string
+		err       string
+	}{
+		{`{"components": [{"type": "kpi", "column": "Total"}, {"type": "kpi", "aggregate": "count"}, {"type": "chart", "column": "Total", "by": "Item", "span": 3}]}`, ""},
+		{`{"columns": -1}`, "columns and rowHeight must not be negative"},
+		{`{"components": [{"type": "gauge"}]}`, `component 1: unknown type "gauge"`},
+		{`{"components": [{"type": "kpi"}]}`, "component 1: column is required"},
+		{`{"components": [{"type": "kpi", "column": "Total", "aggregate": "median"}]}`, `component 1: unknown aggregate "median"`},
+		{`{"components": [{"type": "kpi", "aggregate": "count"}, {"type": "top", "column": "Total"}]}`, "component 2: column and by are required"},
+		{`{"components": [{"type": "chart", "column": "Total", "by": "Item", "chart": "pie"}]}`, `component 1: unknown chart "pie"`},
+		{`{"columns": 2, "components": [{"type": "kpi", "aggregate": "count", "span": 3}]}`, "component 1: span must be between 1 and 2"},
+		{`{"components": [{"type": "kpi", "column": "Price"}]}`, "component 1: "},
+	}
+	for _, tt := range tests {
+		fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"dashboard": ` + tt.dashboard + `}`)})
+		cfg, err := loadConfig(fsys, "cfg.json")
+		if err == nil {
+			err = cfg.resolve([]string{"Item", "Total"})
+		}
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.dashboard, err)
+			} else if dc := cfg.Dashboard; dc.Columns != 3 || dc.Components[0].Span != 1 || dc.Components[0].Count != 5 {
+				t.Errorf("%s: no defaults in %+v", tt.dashboard, dc)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.dashboard, err, tt.err)
+		}
+	}
+}
+
+func TestDashboardValues(t *testing.T) {
+	hdr := []string{"Item", "Total"}
+	rows := [][]string{{"Pears", "2.5"}, {"Apples", "10"}, {"", "7"}, {"Pears", "n/a"}, {"Plums", "1.25"}, {"Pears", "3"}}
+	fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"dashboard": {"components": [
+		{"type": "kpi", "column": "Total"},
+		{"type": "kpi", "column": "Total", "aggregate": "avg"},
+		{"type": "kpi", "column": "Total", "aggregate": "min"},
+		{"type": "kpi", "column": "Total", "aggregate": "max"},
+		{"type": "kpi", "aggregate": "count"},
+		{"type": "kpi", "column": "Item"},
+		{"type": "top", "column": "Total", "by": "Item"}]}}`)})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolve(hdr); err != nil {
+		t.Fatal(err)
+	}
+	cs := cfg.Dashboard.Components
+	var kpis []string
+	for k := range cs[:6] {
+		kpis = append(kpis, cs[k].kpi(cfg, rows))
+	}
+	// Values that are not numbers do not count, except for the number
+	// of rows. All aggregates have the decimal places of the sum.
+	if want := []string{"23.75", "4.75", "1.25", "10.00", "6", ""}; !reflect.DeepEqual(kpis, want) {
+		t.Errorf("KPIs %q, want %q", kpis, want)
+	}
+
+	labels, sums := cs[6].series(rows)
+	var totals []string
+	for _, s := range sums {
+		totals = append(totals, cs[6].format(cfg, &s.sum, s.places))
+	}
+	if want := []string{"Pears", "Apples", "Plums"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels %q, want %q", labels, want)
+	}
+	if want := []string{"5.5", "10", "1.25"}; !reflect.DeepEqual(totals, want) {
+		t.Errorf("sums %q, want %q", totals, want)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Total\nPears,2.5\nApples,10\nPlums,1.25\nPears,3\n",
+		"cfg.json": `{"dashboard": {"columns": 2, "components": [
+			{"type": "kpi", "title": "Revenue", "column": "Total"},
+			{"type": "kpi", "title": "Orders", "aggregate": "count"},
+			{"type": "chart", "title": "By item", "column": "Total", "by": "Item"},
+			{"type": "top", "title": "Top items", "column": "Total", "by": "Item", "count": 2}]}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	// The dashboard fills the first page, with the sum of the pears in
+	// the top list; the table follows on the second.
+	texts := []string{"Revenue", "16.75", "Orders", "4", "By item", "Top items", "5.5", "Item", "Total"}
+	on := pageTexts(t, []byte(testFile(t, env, "out.pdf")), texts)
+	want := map[string]int{
+		"Revenue": 1, "16.75": 1, "Orders": 1, "4": 1, "By item": 1, "Top items": 1, "5.5": 1,
+		"Item": 2, "Total": 2,
+	}
+	if !reflect.DeepEqual(on, want) {
+		t.Errorf("texts on pages %v, want %v", on, want)
+	}
+}
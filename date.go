@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ## Date formats
+
+// Machines like ISO timestamps such as `2024-03-07T14:00:00Z`, people
+// prefer `Mar 7, 2024`. Date columns are parsed with one of several input
+// layouts and printed in the configured output format and time zone.
+
+// DateFormat describes how to reformat the dates of a column. Layouts
+// use Go's reference time, "Mon Jan 2 15:04:05 MST 2006".
+type DateFormat struct {
+	// Layouts are the input layouts, tried in order. Default: RFC 3339
+	// and "2006-01-02".
+	Layouts []string `json:"layouts"`
+
+	// Format is the output layout. Default: "Jan 2, 2006".
+	Format string `json:"format"`
+
+	// TimeZone is the IANA name of the zone to print the dates in, for
+	// example "Europe/Berlin". Default: the zone of the input.
+	TimeZone string `json:"timeZone"`
+
+	loc *time.Location
+}
+
+var defaultDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// prepare loads the time zone.
+func (df *DateFormat) prepare() error {
+	if df.TimeZone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(df.TimeZone)
+	if err != nil {
+		return fmt.Errorf("time zone %q: %s", df.TimeZone, err)
+	}
+	df.loc = loc
+	return nil
+}
+
+// parse tries all input layouts on str.
+func (df *DateFormat) parse(str string) (time.Time, bool) {
+	return df.parseIn(str, time.UTC)
+}
+
+// parseIn is like parse but interprets dates without time zone
+// information in the given location.
+func (df *DateFormat) parseIn(str string, loc *time.Location) (time.Time, bool) {
+	layouts := df.Layouts
+	if len(layouts) == 0 {
+		layouts = defaultDateLayouts
+	}
+	str = strings.TrimSpace(str)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, str, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// format reformats str. Values that match none of the input layouts are
+// returned unchanged.
+func (df *DateFormat) format(str string) string {
+	t, ok := df.parse(str)
+	if !ok {
+		return str
+	}
+	if df.loc != nil {
+		t = t.In(df.loc)
+	}
+	layout := df.Format
+	if layout == "" {
+		layout = "Jan 2, 2006"
+	}
+	return t.Format(layout)
+}
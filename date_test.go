@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDateFormat(t *testing.T) {
+	tests := []struct {
+		df   DateFormat
+		in   string
+		want string
+	}{
+		{DateFormat{}, "2024-03-07T14:00:00Z", "Mar 7, 2024"},
+		{DateFormat{}, " 2024-03-07 ", "Mar 7, 2024"},
+		{DateFormat{}, "07.03.2024", "07.03.2024"},
+		{DateFormat{}, "", ""},
+		{DateFormat{Format: "2006-01-02 15:04 MST"}, "2024-03-07T14:00:00+02:00", "2024-03-07 14:00 +0200"},
+		{DateFormat{Layouts: []string{"02.01.2006", "1/2/2006"}, Format: "2 January 2006"}, "3/7/2024", "7 March 2024"},
+		{DateFormat{Layouts: []string{"02.01.2006"}}, "2024-03-07", "2024-03-07"},
+		{DateFormat{TimeZone: "Asia/Tokyo", Format: "Jan 2, 2006 15:04"}, "2024-03-07T20:00:00Z", "Mar 8, 2024 05:00"},
+		{DateFormat{TimeZone: "America/New_York", Format: "Jan 2, 2006 15:04 MST"}, "2024-07-01T12:00:00Z", "Jul 1, 2024 08:00 EDT"},
+		{DateFormat{TimeZone: "America/New_York"}, "2024-03-07", "Mar 6, 2024"},
+	}
+	for _, tt := range tests {
+		df := tt.df
+		if err := df.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		if got := df.format(tt.in); got != tt.want {
+			t.Errorf("%+v: format(%q) = %q, want %q", tt.df, tt.in, got, tt.want)
+		}
+	}
+	df := DateFormat{TimeZone: "Mars/Olympus_Mons"}
+	if err := df.prepare(); err == nil || !strings.HasPrefix(err.Error(), `time zone "Mars/Olympus_Mons": `) {
+		t.Errorf("unknown time zone: %v", err)
+	}
+}
+
+func TestDateColumnReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Shipped\nApples,2024-03-07T14:00:00Z\nPears,unknown\n",
+		"cfg.json": `{"columns": [{"name": "Shipped", "date": {"timeZone": "Europe/Berlin", "format": "02.01.2006 15:04"}}],
+			"textVersion": {"format": "text"}}`,
+		"bad.json": `{"columns": [{"name": "Shipped", "date": {"timeZone": "Berlin"}}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"07.03.2024 15:00", "unknown"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+
+	err := generate(env, &Job{Input: "in.csv", Config: "bad.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), `column "Shipped": time zone "Berlin"`) {
+		t.Errorf("unknown time zone: %v", err)
+	}
+}
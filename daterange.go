@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ## Date ranges
+
+// The full export contains everything, but the daily report should only
+// show today's orders and the month-to-date report only this month's. A
+// DateRange filters the rows by a date column relative to the current
+// date, so one configuration serves daily, MTD, and QTD variants.
+
+// DateRange selects rows whose date lies within a range.
+type DateRange struct {
+	// Column is the name of the date column. Empty disables filtering.
+	Column string `json:"dateColumn"`
+
+	// Range is "today", "yesterday", "last-N-days" (including today),
+	// "mtd", "qtd", "ytd", or "custom".
+	Range string `json:"range"`
+
+	// From and To are the first and last day of a custom range, as
+	// YYYY-MM-DD.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// FiscalYearStart is the month (1-12) in which the fiscal year
+	// starts. It affects "qtd" and "ytd". Default: 1 (January).
+	FiscalYearStart int `json:"fiscalYearStart"`
+
+	// Layout is the time.Parse layout of the dates. Default: RFC 3339
+	// or "2006-01-02".
+	Layout string `json:"dateLayout"`
+}
+
+// registerFlags adds the range settings to the given flag set.
+func (dr *DateRange) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&dr.Column, "date-column", "", "filter rows by the date in this column")
+	fs.StringVar(&dr.Range, "range", "", "date range: today, yesterday, last-N-days, mtd, qtd, ytd, or custom")
+	fs.StringVar(&dr.From, "from", "", "first day of a custom range (YYYY-MM-DD)")
+	fs.StringVar(&dr.To, "to", "", "last day of a custom range (YYYY-MM-DD)")
+	fs.IntVar(&dr.FiscalYearStart, "fiscal-year-start", 1, "month in which the fiscal year starts (1-12)")
+	fs.StringVar(&dr.Layout, "date-layout", "", "layout of the dates in the date column, in Go time format")
+}
+
+var lastNDays = regexp.MustCompile(`^last-(\d+)-days?$`)
+
+// bounds returns the half-open interval [from, to) of the range,
+// relative to now.
+func (dr *DateRange) bounds(now time.Time) (time.Time, time.Time, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	fy := dr.FiscalYearStart
+	if fy == 0 {
+		fy = 1
+	}
+	if fy < 1 || fy > 12 {
+		return time.Time{}, time.Time{}, fmt.Errorf("fiscal year start must be a month from 1 to 12, got %d", fy)
+	}
+	// monthsIntoYear is the number of months since the fiscal year began.
+	monthsIntoYear := (int(m) - fy + 12) % 12
+
+	switch dr.Range {
+	case "today":
+		return today, tomorrow, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "mtd":
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), tomorrow, nil
+	case "qtd":
+		start := time.Date(y, m, 1, 0, 0, 0, 0, now.Location()).AddDate(0, -(monthsIntoYear % 3), 0)
+		return start, tomorrow, nil
+	case "ytd":
+		start := time.Date(y, m, 1, 0, 0, 0, 0, now.Location()).AddDate(0, -monthsIntoYear, 0)
+		return start, tomorrow, nil
+	case "custom":
+		from, err := time.ParseInLocation("2006-01-02", dr.From, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("custom range: from: %w", err)
+		}
+		to, err := time.ParseInLocation("2006-01-02", dr.To, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("custom range: to: %w", err)
+		}
+		return from, to.AddDate(0, 0, 1), nil
+	}
+	if sm := lastNDays.FindStringSubmatch(dr.Range); sm != nil {
+		n, _ := strconv.Atoi(sm[1])
+		return today.AddDate(0, 0, 1-n), tomorrow, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown date range %q", dr.Range)
+}
+
+// filter returns the rows whose date lies within the range. Rows with
+// a missing or unparsable date are dropped.
+func (dr *DateRange) filter(hdr []string, rows [][]string, now time.Time) ([][]string, error) {
+	if dr.Column == "" {
+		return rows, nil
+	}
+	col := indexOf(hdr, dr.Column)
+	if col < 0 {
+		return nil, fmt.Errorf("date column %q not found in header", dr.Column)
+	}
+	from, to, err := dr.bounds(now)
+	if err != nil {
+		return nil, err
+	}
+	df := &DateFormat{}
+	if dr.Layout != "" {
+		df.Layouts = []string{dr.Layout}
+	}
+	var out [][]string
+	for _, line := range rows {
+		if col >= len(line) {
+			continue
+		}
+		// Dates without a time zone are taken as local dates.
+		t, ok := df.parseIn(line[col], now.Location())
+		if !ok {
+			continue
+		}
+		if !t.Before(from) && t.Before(to) {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
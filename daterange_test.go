@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateRangeBounds(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	tomorrow := day(2024, 5, 16)
+	tests := []struct {
+		dr       DateRange
+		from, to time.Time
+		err      string
+	}{
+		{DateRange{Range: "today"}, day(2024, 5, 15), tomorrow, ""},
+		{DateRange{Range: "yesterday"}, day(2024, 5, 14), day(2024, 5, 15), ""},
+		{DateRange{Range: "last-7-days"}, day(2024, 5, 9), tomorrow, ""},
+		{DateRange{Range: "last-1-day"}, day(2024, 5, 15), tomorrow, ""},
+		{DateRange{Range: "last-30-days"}, day(2024, 4, 16), tomorrow, ""},
+		{DateRange{Range: "mtd"}, day(2024, 5, 1), tomorrow, ""},
+		{DateRange{Range: "qtd"}, day(2024, 4, 1), tomorrow, ""},
+		{DateRange{Range: "ytd"}, day(2024, 1, 1), tomorrow, ""},
+		// A fiscal year from October has quarters from October, January,
+		// April, and July; one from July from July, October, January, and
+		// April; one from June from June, September, December, and March.
+		{DateRange{Range: "qtd", FiscalYearStart: 10}, day(2024, 4, 1), tomorrow, ""},
+		{DateRange{Range: "ytd", FiscalYearStart: 10}, day(2023, 10, 1), tomorrow, ""},
+		{DateRange{Range: "ytd", FiscalYearStart: 5}, day(2024, 5, 1), tomorrow, ""},
+		{DateRange{Range: "qtd", FiscalYearStart: 6}, day(2024, 3, 1), tomorrow, ""},
+		{DateRange{Range: "ytd", FiscalYearStart: 6}, day(2023, 6, 1), tomorrow, ""},
+		{DateRange{Range: "custom", From: "2024-02-01", To: "2024-02-29"}, day(2024, 2, 1), day(2024, 3, 1), ""},
+		{DateRange{Range: "custom", From: "2024-02-01"}, time.Time{}, time.Time{}, "custom range: to: "},
+		{DateRange{Range: "custom", From: "Feb 1", To: "2024-02-29"}, time.Time{}, time.Time{}, "custom range: from: "},
+		{DateRange{Range: "ytd", FiscalYearStart: 13}, time.Time{}, time.Time{}, "fiscal year start must be a month from 1 to 12, got 13"},
+		{DateRange{Range: "last-week"}, time.Time{}, time.Time{}, `unknown date range "last-week"`},
+	}
+	for _, tt := range tests {
+		from, to, err := tt.dr.bounds(now)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%+v: bounds = %v, want %q", tt.dr, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("%+v: bounds = %v, %v, %v; want %v, %v", tt.dr, from, to, err, tt.from, tt.to)
+		}
+	}
+}
+
+func TestDateRangeFilter(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, berlin)
+	hdr := []string{"Item", "Date"}
+	rows := [][]string{
+		{"Apples", "2024-05-15"},
+		{"Pears", "2024-05-14T23:30:00Z"}, // May 15 in Berlin
+		{"Plums", "2024-05-14"},
+		{"Figs", "2024-04-30"},
+		{"Kiwis", ""},
+		{"Limes"},
+		{"Dates", "15.05.2024"},
+	}
+	tests := []struct {
+		dr   DateRange
+		want []string
+		err  string
+	}{
+		{DateRange{}, []string{"Apples", "Pears", "Plums", "Figs", "Kiwis", "Limes", "Dates"}, ""},
+		{DateRange{Column: "Date", Range: "today"}, []string{"Apples", "Pears"}, ""},
+		{DateRange{Column: "Date", Range: "mtd"}, []string{"Apples", "Pears", "Plums"}, ""},
+		{DateRange{Column: "Date", Range: "last-30-days"}, []string{"Apples", "Pears", "Plums", "Figs"}, ""},
+		{DateRange{Column: "Date", Range: "today", Layout: "02.01.2006"}, []string{"Dates"}, ""},
+		{DateRange{Column: "Day", Range: "today"}, nil, `date column "Day" not found in header`},
+		{DateRange{Column: "Date", Range: "weekly"}, nil, `unknown date range "weekly"`},
+	}
+	for _, tt := range tests {
+		out, err := tt.dr.filter(hdr, rows, now)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%+v: filter = %v, want %q", tt.dr, err, tt.err)
+			}
+			continue
+		}
+		var got []string
+		for _, line := range out {
+			got = append(got, line[0])
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: filter = %q, %v; want %q", tt.dr, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// ## Tuning the layout
+
+// A new layout takes a few rounds of adjusting widths and margins. Two
+// switches shorten them:
+//
+//   - `-debug-layout` draws the page grid, the margins, the column
+//     boundaries, and a marker where each section of the report starts
+//     on top of every page.
+//   - `-dry-run` renders the report but writes and sends nothing.
+//     Instead, it prints the column widths, the page count, and warnings
+//     about columns too narrow for their contents and tables too wide
+//     for the page.
+
+// layoutDebug collects the positions that the debug overlay marks.
+type layoutDebug struct {
+	pdf   *Fpdf
+	marks []sectionMark
+	sizes map[int][2]float64 // width and height of each page
+}
+
+// newLayoutDebug starts collecting on the current page of pdf.
+func newLayoutDebug(pdf *Fpdf) *layoutDebug {
+	ld := &layoutDebug{pdf: pdf, sizes: map[int][2]float64{}}
+	ld.record()
+	return ld
+}
+
+// record records the size of the current page, which gofpdf does not
+// tell reliably once the orientation changes. It runs at the start of
+// every page.
+func (ld *layoutDebug) record() {
+	w, h := ld.pdf.GetPageSize()
+	ld.sizes[ld.pdf.PageNo()] = [2]float64{w, h}
+}
+
+// sectionMark is where a section of the report starts.
+type sectionMark struct {
+	section string
+	page    int
+	x, y    float64
+}
+
+// mark records the current position as the start of section.
+func (ld *layoutDebug) mark(section string) {
+	if ld == nil {
+		return
+	}
+	x, y := ld.pdf.GetXY()
+	ld.marks = append(ld.marks, sectionMark{section, ld.pdf.PageNo(), x, y})
+}
+
+// overlay draws the debug information onto every page.
+func (ld *layoutDebug) overlay(cfg *Config, hdr []string) {
+	if ld == nil {
+		return
+	}
+	pdf := ld.pdf
+	last := pdf.PageNo()
+	left, top, right, bottom := pdf.GetMargins()
+
+	// The column boundaries, in the order in which the columns are
+	// printed, starting at the left margin.
+	var ls layoutSnapshot
+	ls.columns(hdr, cfg)
+	edges := []float64{left}
+	for _, c := range ls.Columns {
+		edges = append(edges, edges[len(edges)-1]+c.Width)
+	}
+
+	pdf.SetFont("Times", "", 6)
+	for page := 1; page <= pdf.PageCount(); page++ {
+		pdf.SetPage(page)
+		w, h := ld.sizes[page][0], ld.sizes[page][1]
+
+		// A grid line every 10 mm.
+		pdf.SetLineWidth(0.1)
+		pdf.SetDrawColor(200, 220, 255)
+		for x := 10.0; x < w; x += 10 {
+			pdf.Line(x, 0, x, h)
+		}
+		for y := 10.0; y < h; y += 10 {
+			pdf.Line(0, y, w, y)
+		}
+
+		// The margins, dashed.
+		pdf.SetLineWidth(0.2)
+		pdf.SetDrawColor(255, 0, 0)
+		pdf.SetDashPattern([]float64{2, 1}, 0)
+		pdf.Rect(left, top, w-left-right, h-top-bottom, "D")
+		pdf.SetDashPattern([]float64{}, 0)
+
+		// The column boundaries.
+		pdf.SetDrawColor(0, 0, 255)
+		for _, x := range edges {
+			pdf.Line(x, top, x, h-bottom)
+		}
+
+		// A cross and the section name where each section starts.
+		pdf.SetDrawColor(0, 160, 0)
+		pdf.SetTextColor(0, 160, 0)
+		for _, m := range ld.marks {
+			if m.page != page {
+				continue
+			}
+			pdf.Line(m.x-2, m.y, m.x+2, m.y)
+			pdf.Line(m.x, m.y-2, m.x, m.y+2)
+			pdf.Text(m.x+1, m.y-1, fmt.Sprintf("%s (%.1f, %.1f)", m.section, m.x, m.y))
+		}
+	}
+	pdf.SetPage(last)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// dryRun prints what rendering the report of part p found out about its
+// layout, in place of saving and delivering it.
+func dryRun(env *Env, cfg *Config, data *reportData, p *part) error {
+	ls := data.layout
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s (dry run): %s, %s\n", p.output, pluralize(ls.Pages, "page", "pages"), pluralize(len(data.rows), "row", "rows"))
+
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	total := 0.0
+	for _, c := range ls.Columns {
+		fmt.Fprintf(tw, "  %s\t%6.1f mm\n", c.Name, c.Width)
+		total += c.Width
+	}
+	available := ls.PageWidth - ls.Margins[0] - ls.Margins[2]
+	fmt.Fprintf(tw, "  total\t%6.1f mm\n", total)
+	fmt.Fprintf(tw, "  available\t%6.1f mm\n", available)
+	tw.Flush()
+
+	// Values wider than their column run into the neighboring cells.
+	var warnings []string
+	if total > available {
+		warnings = append(warnings, fmt.Sprintf("the table is %.1f mm wider than the space between the margins", total-available))
+	}
+	count := make([]int, len(data.hdr))
+	widest := make([]float64, len(data.hdr))
+	measureCells(env, cfg, data.hdr, data.rows, func(col int, w float64) {
+		if w > cfg.width(col)+0.05 {
+			count[col]++
+			widest[col] = math.Max(widest[col], w)
+		}
+	})
+	for i, n := range count {
+		if n > 0 && cfg.column(i).Overflow == "" {
+			warnings = append(warnings, fmt.Sprintf("column %q: %s wider than %.1f mm, up to %.1f mm", data.hdr[i], pluralize(n, "value", "values"), cfg.width(i), widest[i]))
+		}
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(&buf, "warning: %s\n", w)
+	}
+
+	out := env.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
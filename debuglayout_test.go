@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Note\nApples,A note far too long for a narrow column\nPears,ok\n",
+		"cfg.json": `{"columns": [{"name": "Item", "width": 30}, {"name": "Note", "width": 20}], "delivery": {"targets": [{"type": "record"}]}}`,
+	})
+	var out bytes.Buffer
+	env.Stdout = &out
+	deliveries()
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", DryRun: true, Snapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, env.FS); !reflect.DeepEqual(got, []string{"cfg.json", "in.csv", "stats.png"}) {
+		t.Errorf("a dry run wrote files: %q", got)
+	}
+	if got := deliveries(); len(got) != 0 {
+		t.Errorf("a dry run delivered %q", got)
+	}
+	for _, re := range []string{
+		`^out\.pdf \(dry run\): 1 page, 2 rows\n`,
+		`\n  Item +30\.0 mm\n  Note +20\.0 mm\n  total +50\.0 mm\n  available +\d+\.\d mm\n`,
+		`\nwarning: column "Note": 1 value wider than 20\.0 mm, up to \d+\.\d mm\n$`,
+	} {
+		if !regexp.MustCompile(re).MatchString(out.String()) {
+			t.Errorf("dry run output does not match %s:\n%s", re, out.String())
+		}
+	}
+
+	out.Reset()
+	env = testEnv(map[string]string{
+		"in.csv":   "Item,Note\nApples,ok\n",
+		"cfg.json": `{"columns": [{"name": "Item", "width": 150}, {"name": "Note", "width": 150}]}`,
+	})
+	env.Stdout = &out
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "warning: the table is") || !strings.Contains(out.String(), "mm wider than the space between the margins") {
+		t.Errorf("dry run output lacks the width warning:\n%s", out.String())
+	}
+
+	env = testEnv(map[string]string{"inv.json": `{"number": "1", "items": [{"quantity": 1}]}`})
+	if err := generate(env, &Job{Invoice: "inv.json", Output: "out.pdf", DryRun: true}); err == nil || !strings.Contains(err.Error(), "support table reports only") {
+		t.Errorf("dry run of an invoice: %v", err)
+	}
+}
+
+func TestDebugLayout(t *testing.T) {
+	env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n"})
+	if err := generate(env, &Job{Input: "in.csv", Output: "out.pdf", DebugLayout: true}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, want := range []string{"(narrative \\(10.0, 42.0\\))", "(header \\(10.0, 42.0\\))", "0.784 0.863 1.000 RG", "[5.67 2.83] 0.00 d"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the debug overlay lacks %q", want)
+		}
+	}
+
+	if err := generate(env, &Job{Input: "in.csv", Output: "plain.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(pageContents(t, []byte(testFile(t, env, "plain.pdf"))), "(header \\(") {
+		t.Error("the overlay is drawn without DebugLayout")
+	}
+}
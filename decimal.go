@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ## Exact sums
+
+// Binary floating-point numbers cannot represent most decimal fractions
+// exactly. Adding millions of cents drifts away from the true total,
+// and whether 2.675 rounds to 2.67 or 2.68 depends on the binary
+// representation rather than on the accounting rules. Sums and totals
+// are therefore computed with exact decimal arithmetic (math/big), and
+// results are rounded once, at the end, with the configured rounding
+// mode:
+//
+//	"rounding": "halfEven"
+
+// roundingMode is "halfUp" (the default: halves are rounded away from
+// zero), "halfEven" (banker's rounding: halves are rounded to the even
+// digit), "down" (toward zero), or "up" (away from zero).
+type roundingMode string
+
+// check reports an unknown rounding mode.
+func (m roundingMode) check() error {
+	switch m {
+	case "", "halfUp", "halfEven", "down", "up":
+		return nil
+	}
+	return fmt.Errorf("rounding must be halfUp, halfEven, down, or up")
+}
+
+// format rounds r to the given number of decimal places and writes it
+// in Go syntax, such as "-1234.50".
+func (m roundingMode) format(r *big.Rat, places int) string {
+	if places < 0 {
+		places = 0
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	num := new(big.Int).Mul(r.Num(), scale)
+	num.Abs(num)
+	q, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+
+	// Compare the remainder with half of the denominator.
+	half := new(big.Int).Mul(rem, big.NewInt(2)).Cmp(r.Denom())
+	up := false
+	switch m {
+	case "halfEven":
+		up = half > 0 || (half == 0 && q.Bit(0) == 1)
+	case "down":
+	case "up":
+		up = rem.Sign() != 0
+	default:
+		up = half >= 0
+	}
+	if up {
+		q.Add(q, big.NewInt(1))
+	}
+
+	digits := q.String()
+	for len(digits) <= places {
+		digits = "0" + digits
+	}
+	s := digits
+	if places > 0 {
+		s = digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	}
+	if r.Sign() < 0 && q.Sign() != 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// float rounds r like format and returns the result as float64.
+func (m roundingMode) float(r *big.Rat, places int) float64 {
+	v, _ := strconv.ParseFloat(m.format(r, places), 64)
+	return v
+}
+
+// parseDecimal parses a decimal number such as "1234.50" exactly and
+// returns it with its number of decimal places.
+func parseDecimal(s string) (*big.Rat, int, bool) {
+	s = strings.TrimSpace(s)
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return nil, 0, false
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, 0, false
+	}
+	places := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		places = len(s) - i - 1
+		if e := strings.IndexAny(s, "eE"); e > i {
+			places = e - i - 1
+		}
+	}
+	return r, places, true
+}
+
+// ratFromFloat converts v to the decimal number it was most likely meant
+// to be: the shortest decimal that reads back as v, such as 0.1 rather
+// than 0.1000000000000000055511151231257827.
+func ratFromFloat(v float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	return r
+}
+
+// decimalSum adds decimal numbers exactly.
+type decimalSum struct {
+	sum    big.Rat
+	places int // the most decimal places of any value
+	n      int
+}
+
+// add adds the number in s and reports whether s is a number.
+func (d *decimalSum) add(s string) bool {
+	r, places, ok := parseDecimal(s)
+	if !ok {
+		return false
+	}
+	d.sum.Add(&d.sum, r)
+	if places > d.places {
+		d.places = places
+	}
+	d.n++
+	return true
+}
+
+// addFloat adds v, taken as the decimal it was meant to be.
+func (d *decimalSum) addFloat(v float64) {
+	d.sum.Add(&d.sum, ratFromFloat(v))
+	d.n++
+}
+
+// float returns the sum as float64.
+func (d *decimalSum) float() float64 {
+	v, _ := d.sum.Float64()
+	return v
+}
+
+// mean returns the exact mean of the values. It must not be called
+// for an empty sum.
+func (d *decimalSum) mean() *big.Rat {
+	return new(big.Rat).Quo(&d.sum, new(big.Rat).SetInt64(int64(d.n)))
+}
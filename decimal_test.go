@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestRoundingFormat(t *testing.T) {
+	tests := []struct {
+		mode   roundingMode
+		value  string
+		places int
+		want   string
+	}{
+		{"", "2.675", 2, "2.68"},
+		{"halfUp", "2.665", 2, "2.67"},
+		{"halfUp", "-2.5", 0, "-3"},
+		{"halfEven", "2.675", 2, "2.68"},
+		{"halfEven", "2.665", 2, "2.66"},
+		{"halfEven", "-2.5", 0, "-2"},
+		{"halfEven", "2.6651", 2, "2.67"},
+		{"down", "2.679", 2, "2.67"},
+		{"down", "-2.5", 0, "-2"},
+		{"up", "2.671", 2, "2.68"},
+		{"up", "-2.1", 0, "-3"},
+		{"up", "2.67", 2, "2.67"},
+		{"halfUp", "1234.5", 2, "1234.50"},
+		{"halfUp", "0.004", 2, "0.00"},
+		{"halfUp", "-0.004", 2, "0.00"},
+		{"halfUp", "0.05", 1, "0.1"},
+		{"halfUp", "7.5", -1, "8"},
+		{"halfUp", "1/3", 4, "0.3333"},
+	}
+	for _, tt := range tests {
+		r, ok := new(big.Rat).SetString(tt.value)
+		if !ok {
+			t.Fatalf("bad test value %q", tt.value)
+		}
+		if got := tt.mode.format(r, tt.places); got != tt.want {
+			t.Errorf("%q.format(%s, %d) = %q, want %q", tt.mode, tt.value, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestRoundingCheck(t *testing.T) {
+	for _, m := range []roundingMode{"", "halfUp", "halfEven", "down", "up"} {
+		if err := m.check(); err != nil {
+			t.Errorf("%q.check() = %v", m, err)
+		}
+	}
+	for _, m := range []roundingMode{"halfDown", "HalfUp", "ceiling"} {
+		if err := m.check(); err == nil {
+			t.Errorf("%q.check() = nil, want an error", m)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s      string
+		want   string // as a fraction, "" if s is not a number
+		places int
+	}{
+		{"1234.50", "2469/2", 2},
+		{" 42 ", "42/1", 0},
+		{"-0.125", "-1/8", 3},
+		{"1.25e1", "25/2", 2},
+		{"1.25E-1", "1/8", 2},
+		{"", "", 0},
+		{"abc", "", 0},
+		{"1,5", "", 0},
+		{"Inf", "", 0},
+		{"NaN", "", 0},
+	}
+	for _, tt := range tests {
+		r, places, ok := parseDecimal(tt.s)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("parseDecimal(%q) = %v, want no number", tt.s, r)
+		case tt.want == "":
+		case !ok:
+			t.Errorf("parseDecimal(%q) = no number, want %s", tt.s, tt.want)
+		case r.String() != tt.want || places != tt.places:
+			t.Errorf("parseDecimal(%q) = %s, %d places, want %s, %d places", tt.s, r, places, tt.want, tt.places)
+		}
+	}
+}
+
+func TestDecimalSum(t *testing.T) {
+	var d decimalSum
+	for i := 0; i < 10; i++ {
+		d.add("0.1")
+	}
+	if d.add("n/a") {
+		t.Error(`add("n/a") = true`)
+	}
+	d.add("2.675")
+	if got := roundingMode("").format(&d.sum, d.places); got != "3.675" {
+		t.Errorf("sum = %s, want 3.675", got)
+	}
+	if d.n != 11 || d.places != 3 {
+		t.Errorf("n = %d, places = %d, want 11 and 3", d.n, d.places)
+	}
+	d.addFloat(0.1)
+	if got := roundingMode("").format(d.mean(), 4); got != "0.3146" {
+		t.Errorf("mean = %s, want 0.3146", got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ## Skipping unchanged reports
+
+// A job that runs every hour mails the report every hour, even if the
+// data has not changed since the last run. With "skipUnchanged", a report
+// is uploaded and delivered only if it differs from the last delivered
+// version. The SHA-256 hashes of the delivered reports are kept in a
+// small JSON state file:
+//
+//	"deterministic": true,
+//	"delivery": {
+//	  "skipUnchanged": {"state": "delivered.json", "profile": "sales"},
+//	  "email": {...}
+//	}
+//
+// Comparing hashes only works if the same data produces the same bytes,
+// so skipping requires deterministic mode. Local files are written
+// either way.
+
+// SkipUnchangedConfig enables skipping unchanged reports.
+type SkipUnchangedConfig struct {
+	// State is the path of the JSON file with the hashes of the
+	// delivered reports.
+	State string `json:"state"`
+
+	// Profile names the delivery in the state file, so that several
+	// jobs can share it. Reports of a split or merge run are stored
+	// under the profile and their value. Default: "default".
+	Profile string `json:"profile"`
+}
+
+// deliveryState is the content of the state file: the hash of the last
+// delivered report per profile.
+type deliveryState struct {
+	Reports map[string]string `json:"reports"`
+}
+
+// deliveryStateMu serializes access to state files, which the parts of
+// a split run update concurrently.
+var deliveryStateMu sync.Mutex
+
+func (su *SkipUnchangedConfig) prepare(deterministic bool) error {
+	if !deterministic {
+		return errors.New("requires deterministic mode")
+	}
+	if su.State == "" {
+		return errors.New("state is required")
+	}
+	return nil
+}
+
+// key returns the name of the report of part p in the state file.
+func (su *SkipUnchangedConfig) key(p *part) string {
+	profile := orDefault(su.Profile, "default")
+	if p.value == "" {
+		return profile
+	}
+	return profile + "/" + p.value
+}
+
+// publish finishes the document of part p, stores it at p.output, and
+// delivers it. A report that is identical to the last delivered one is
+// neither uploaded nor delivered again.
+func publish(env *Env, cfg *Config, pdf *Fpdf, p *part) error {
+	var err error
+	p.pdf, err = finishPDF(pdf, cfg.finishers(env, p.tags, p.fields)...)
+	if err != nil {
+		return fmt.Errorf("cannot save PDF: %w", err)
+	}
+	return store(env, cfg, p)
+}
+
+// store writes the finished document of part p and, unless it is
+// unchanged, delivers it.
+func store(env *Env, cfg *Config, p *part) error {
+	var err error
+	p.unchanged, err = cfg.Delivery.unchanged(env, p)
+	if err != nil {
+		return err
+	}
+	if !p.unchanged || !isRemote(p.output) {
+		if err := cfg.saveOutput(env.FS, p.output, p.pdf); err != nil {
+			return fmt.Errorf("cannot save PDF: %w", err)
+		}
+		if cs := cfg.ContactSheet; cs != nil && cs.Separate {
+			sheet, err := cs.add(p.pdf, true)
+			if err != nil {
+				return err
+			}
+			if err := writeOutput(env.FS, contactSheetPath(p.output), sheet); err != nil {
+				return fmt.Errorf("cannot save contact sheet: %w", err)
+			}
+		}
+		if cfg.Previews != nil {
+			if err := cfg.Previews.write(env, p); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Delivery != nil && !p.unchanged {
+		return cfg.Delivery.deliver(env, p)
+	}
+	return nil
+}
+
+// unchanged reports whether the report of part p was delivered before.
+func (d *DeliveryConfig) unchanged(env *Env, p *part) (bool, error) {
+	if d == nil || d.SkipUnchanged == nil {
+		return false, nil
+	}
+	deliveryStateMu.Lock()
+	defer deliveryStateMu.Unlock()
+	state, err := loadDeliveryState(env.FS, d.artifactKey, d.SkipUnchanged.State)
+	if err != nil {
+		return false, err
+	}
+	return state.Reports[d.SkipUnchanged.key(p)] == hashPDF(p.pdf), nil
+}
+
+// delivered records the report of part p as delivered.
+func (d *DeliveryConfig) delivered(env *Env, p *part) error {
+	if d.SkipUnchanged == nil {
+		return nil
+	}
+	deliveryStateMu.Lock()
+	defer deliveryStateMu.Unlock()
+	state, err := loadDeliveryState(env.FS, d.artifactKey, d.SkipUnchanged.State)
+	if err != nil {
+		return err
+	}
+	state.Reports[d.SkipUnchanged.key(p)] = hashPDF(p.pdf)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeArtifact(env.FS, d.artifactKey, d.SkipUnchanged.State, data); err != nil {
+		return fmt.Errorf("cannot write delivery state: %w", err)
+	}
+	return nil
+}
+
+func hashPDF(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadDeliveryState reads the state file. A missing file is not an
+// error.
+func loadDeliveryState(fsys FileSystem, key []byte, path string) (*deliveryState, error) {
+	state := &deliveryState{}
+	data, err := readArtifact(fsys, key, path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("cannot read delivery state '%s': %w", path, err)
+	default:
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("cannot read delivery state '%s': %w", path, err)
+		}
+	}
+	if state.Reports == nil {
+		state.Reports = map[string]string{}
+	}
+	return state, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorded holds the files of the reports delivered to "record"
+// targets.
+var recorded struct {
+	sync.Mutex
+	files []string
+}
+
+type recordDeliverer struct{}
+
+func (recordDeliverer) Deliver(env *Env, r *Report) error {
+	recorded.Lock()
+	defer recorded.Unlock()
+	recorded.files = append(recorded.files, r.File)
+	return nil
+}
+
+func init() {
+	RegisterDeliverer("record", func(settings json.RawMessage) (Deliverer, error) {
+		return recordDeliverer{}, DecodeSettings(settings, &struct{}{})
+	})
+}
+
+// deliveries returns and forgets the files delivered so far.
+func deliveries() []string {
+	recorded.Lock()
+	defer recorded.Unlock()
+	files := recorded.files
+	recorded.files = nil
+	return files
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	deliveries()
+	env := testEnv(map[string]string{
+		"in.csv": "Region,Total\nNorth,1\n",
+		"cfg.json": `{"deterministic": true, "delivery": {"targets": [{"type": "record"}],
+			"skipUnchanged": {"state": "delivered.json", "profile": "sales"}}}`,
+	})
+	run := func() {
+		t.Helper()
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run()
+	if got := deliveries(); len(got) != 1 || got[0] != "out.pdf" {
+		t.Fatalf("first run delivered %q", got)
+	}
+	first := testFile(t, env, "delivered.json")
+	var state deliveryState
+	if err := json.Unmarshal([]byte(first), &state); err != nil || state.Reports["sales"] != hashPDF([]byte(testFile(t, env, "out.pdf"))) {
+		t.Errorf("delivery state %s, %v", first, err)
+	}
+
+	run()
+	if got := deliveries(); len(got) != 0 {
+		t.Errorf("an unchanged report was delivered again: %q", got)
+	}
+
+	f, err := env.FS.Create("in.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("Region,Total\nNorth,2\n"))
+	f.Close()
+	run()
+	if got := deliveries(); len(got) != 1 {
+		t.Errorf("a changed report was delivered %d times", len(got))
+	}
+	if testFile(t, env, "delivered.json") == first {
+		t.Error("the delivery state was not updated")
+	}
+}
+
+func TestSkipUnchangedConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"delivery": {"skipUnchanged": {"state": "delivered.json"}}}`, "requires deterministic mode"},
+		{`{"deterministic": true, "delivery": {"skipUnchanged": {}}}`, "state is required"},
+	} {
+		_, err := loadConfig(NewMemFS(map[string][]byte{"cfg.json": []byte(tt.config)}), "cfg.json")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want %q", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Delivery targets
+
+// Email is not the only way to a reader. Delivery targets send the
+// finished report anywhere else -- to cloud storage, an SFTP server, a
+// Slack channel, or a printer:
+//
+//	"delivery": {"targets": [
+//	  {"type": "s3", "settings": {"url": "s3://reports/{date}/{file}"}},
+//	  {"type": "sftp", "settings": {"host": "files.example.com", "user": "reports", "dir": "/incoming"}},
+//	  {"type": "slack", "settings": {"token": "$SLACK_TOKEN", "channel": "C0123456"}},
+//	  {"type": "printer", "settings": {"printer": "finance-3", "copies": 2}}]}
+//
+// "email" is a target type as well, with the settings of the email
+// delivery. Other types -- the API of an in-house document management
+// system, say -- are added in a file of their own, without touching the
+// delivery code:
+//
+//	func init() {
+//		RegisterDeliverer("dms", func(settings json.RawMessage) (Deliverer, error) {
+//			var d dmsDeliverer
+//			return &d, DecodeSettings(settings, &d)
+//		})
+//	}
+//
+// Targets are set up when the configuration is loaded, so unknown types
+// and bad settings are found before any report is rendered.
+
+// Report is a finished report on its way to its readers.
+type Report struct {
+	File  string    // the file name of the report
+	Path  string    // where the report was saved
+	Value string    // the split value, if any
+	Rows  int       // the number of rows
+	Date  time.Time // when the report was made
+	PDF   []byte
+
+	part *part
+}
+
+// Deliverer sends reports to one target.
+type Deliverer interface {
+	Deliver(env *Env, r *Report) error
+}
+
+// DelivererFactory creates the Deliverer of a target from its settings.
+type DelivererFactory func(settings json.RawMessage) (Deliverer, error)
+
+// deliverers holds the target types by name.
+var deliverers = map[string]DelivererFactory{}
+
+// RegisterDeliverer adds a target type. It panics if the name is taken.
+func RegisterDeliverer(name string, f DelivererFactory) {
+	if _, ok := deliverers[name]; ok {
+		panic(fmt.Sprintf("deliverer %q registered twice", name))
+	}
+	deliverers[name] = f
+}
+
+func init() {
+	RegisterDeliverer("email", func(settings json.RawMessage) (Deliverer, error) {
+		var ec EmailConfig
+		return &ec, DecodeSettings(settings, &ec)
+	})
+	RegisterDeliverer("s3", func(settings json.RawMessage) (Deliverer, error) {
+		var sd storageDeliverer
+		if err := DecodeSettings(settings, &sd); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(sd.URL, "s3://") {
+			return nil, fmt.Errorf("url %q: expected s3://bucket/key", sd.URL)
+		}
+		return &sd, nil
+	})
+	RegisterDeliverer("sftp", func(settings json.RawMessage) (Deliverer, error) {
+		var sd sftpDeliverer
+		if err := DecodeSettings(settings, &sd); err != nil {
+			return nil, err
+		}
+		if sd.Host == "" {
+			return nil, fmt.Errorf("host is required")
+		}
+		return &sd, nil
+	})
+	RegisterDeliverer("slack", func(settings json.RawMessage) (Deliverer, error) {
+		var sd slackDeliverer
+		if err := DecodeSettings(settings, &sd); err != nil {
+			return nil, err
+		}
+		if sd.Token == "" || sd.Channel == "" {
+			return nil, fmt.Errorf("token and channel are required")
+		}
+		return &sd, nil
+	})
+	RegisterDeliverer("printer", func(settings json.RawMessage) (Deliverer, error) {
+		var pd printerDeliverer
+		return &pd, DecodeSettings(settings, &pd)
+	})
+}
+
+// DecodeSettings decodes the settings of a target into v. Unknown
+// fields are an error, as everywhere in the configuration.
+func DecodeSettings(settings json.RawMessage, v interface{}) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(settings))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// DeliveryTarget is a target of a type and its settings.
+type DeliveryTarget struct {
+	Type     string          `json:"type"`
+	Settings json.RawMessage `json:"settings"`
+
+	deliverer Deliverer
+}
+
+func (dt *DeliveryTarget) prepare() error {
+	f, ok := deliverers[dt.Type]
+	if !ok {
+		var types []string
+		for name := range deliverers {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("unknown type %q; use one of %s", dt.Type, strings.Join(types, ", "))
+	}
+	var err error
+	dt.deliverer, err = f(dt.Settings)
+	return err
+}
+
+// deliveryReport returns the report of part p.
+func deliveryReport(env *Env, p *part) *Report {
+	return &Report{
+		File:  filepath.Base(p.output),
+		Path:  p.output,
+		Value: p.value,
+		Rows:  len(p.rows),
+		Date:  env.Clock.Now(),
+		PDF:   p.pdf,
+		part:  p,
+	}
+}
+
+// Deliver mails the report; it makes EmailConfig a target type.
+func (ec *EmailConfig) Deliver(env *Env, r *Report) error {
+	return ec.send(env, r.part)
+}
+
+// storageDeliverer copies reports to cloud storage.
+type storageDeliverer struct {
+	// URL is the destination. {file} is replaced with the file name of
+	// the report, {date} and {time} as in output paths.
+	URL string `json:"url"`
+}
+
+func (sd *storageDeliverer) Deliver(env *Env, r *Report) error {
+	dest := strings.Replace(expandOutput(sd.URL, r.Date), "{file}", r.File, -1)
+	return upload(env.FS, dest, r.PDF)
+}
+
+// sftpDeliverer copies reports to an SFTP server with the sftp command,
+// which authenticates with the usual SSH keys and agent.
+type sftpDeliverer struct {
+	Host string `json:"host"`
+	Port int    `json:"port"` // default: 22
+	User string `json:"user"`
+
+	// Dir is the directory on the server; the default is the home
+	// directory of the user.
+	Dir string `json:"dir"`
+
+	// IdentityFile is the private key, if not the default one.
+	IdentityFile string `json:"identityFile"`
+}
+
+func (sd *sftpDeliverer) Deliver(env *Env, r *Report) error {
+	// sftp uploads files, so the report goes through a temp file.
+	tmp, err := ioutil.TempFile("", "report-*.pdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(r.PDF)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-b", "-"}
+	if sd.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(sd.Port))
+	}
+	if sd.IdentityFile != "" {
+		args = append(args, "-i", sd.IdentityFile)
+	}
+	host := sd.Host
+	if sd.User != "" {
+		host = sd.User + "@" + host
+	}
+	dest := r.File
+	if sd.Dir != "" {
+		dest = strings.TrimSuffix(sd.Dir, "/") + "/" + r.File
+	}
+	cmd := exec.Command("sftp", append(args, host)...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("put %q %q\n", tmp.Name(), dest))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("upload to %s: %s: %s", host, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// slackDeliverer posts reports to a Slack channel.
+type slackDeliverer struct {
+	// Token is a bot token with the files:write scope. It may reference
+	// an environment variable as $NAME or ${NAME}.
+	Token string `json:"token"`
+
+	// Channel is the ID of the channel.
+	Channel string `json:"channel"`
+
+	// Comment is a text/template like the email subject; see
+	// EmailConfig.
+	Comment string `json:"comment"`
+}
+
+// slackAPI is the base URL of the Slack Web API.
+var slackAPI = "https://slack.com/api/"
+
+func (sd *slackDeliverer) Deliver(env *Env, r *Report) error {
+	comment, err := execTemplate("comment", orDefault(sd.Comment, "Report {{.File}}"), mailData{
+		File:  r.File,
+		Value: r.Value,
+		Rows:  r.Rows,
+		Date:  r.Date.Format("Mon Jan 2, 2006"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files go to Slack in three steps: get an upload URL, upload the
+	// file, and share it in the channel.
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err = sd.call("files.getUploadURLExternal", url.Values{
+		"filename": {r.File},
+		"length":   {strconv.Itoa(len(r.PDF))},
+	}, &upload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(upload.UploadURL, "application/pdf", bytes.NewReader(r.PDF))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack upload: %s", resp.Status)
+	}
+	files, _ := json.Marshal([]map[string]string{{"id": upload.FileID, "title": r.File}})
+	return sd.call("files.completeUploadExternal", url.Values{
+		"files":           {string(files)},
+		"channel_id":      {sd.Channel},
+		"initial_comment": {comment},
+	}, nil)
+}
+
+// call calls a method of the Slack Web API and decodes the response
+// into v.
+func (sd *slackDeliverer) call(method string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest("POST", slackAPI+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(sd.Token))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("slack %s: %s", method, resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack %s: %s", method, result.Error)
+	}
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+// printerDeliverer prints reports with the lp command of CUPS.
+type printerDeliverer struct {
+	// Printer is the name of the printer; the default is the system's
+	// default printer.
+	Printer string `json:"printer"`
+
+	Copies int `json:"copies"`
+
+	// Options are passed to lp as -o options, such as "sides=two-sided-long-edge".
+	Options []string `json:"options"`
+}
+
+func (pd *printerDeliverer) Deliver(env *Env, r *Report) error {
+	args := []string{"-t", r.File}
+	if pd.Printer != "" {
+		args = append(args, "-d", pd.Printer)
+	}
+	if pd.Copies > 1 {
+		args = append(args, "-n", strconv.Itoa(pd.Copies))
+	}
+	for _, o := range pd.Options {
+		args = append(args, "-o", o)
+	}
+	cmd := exec.Command("lp", append(args, "-")...)
+	cmd.Stdin = bytes.NewReader(r.PDF)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("lp: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
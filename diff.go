@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ## Changes since the previous data
+
+// Yesterday's report had most of today's rows already. Given the
+// previous input as well, the report shows what is new: added rows are
+// shaded green, changed values yellow, and a summary after the table
+// counts the changes and lists the removed rows and the old values.
+// Grayscale reports mark the changes with shapes instead; see
+// grayscaleFinisher.
+//
+//	pdf -config daily.json -previous yesterday.csv today.csv
+//
+// Rows are matched by their key columns:
+//
+//	"diff": {"key": ["Order ID"]}
+//
+// Keys should be unique; of previous rows that share a key, the last
+// one counts. Without a key, rows are matched by all of their values, so
+// rows are only ever added or removed. Columns are matched by name; columns that
+// the previous data lacks, such as computed ones, are not compared. The
+// previous data is read like the input and is not filtered, so a row
+// counts as removed only if it is missing from the input as a whole.
+// Diffs are not available in split runs and for pivot tables.
+
+// DiffConfig compares the input with the previous input.
+type DiffConfig struct {
+	// Key lists the columns that identify a row.
+	Key []ColumnRef `json:"key"`
+
+	key     []int               // the key columns in the input
+	prevKey []int               // the key columns in the previous data
+	cols    []int               // the previous column of each input column, or -1
+	prev    map[string][]string // the previous rows by key
+	prevHdr []string
+	removed [][]string
+}
+
+func (dc *DiffConfig) prepare(c *Config) error {
+	if c.Split != nil || c.Recipients != nil || c.Pivot != nil {
+		return fmt.Errorf("not available in split runs and for pivot tables")
+	}
+	return nil
+}
+
+// load reads the previous data and matches its rows with rows.
+func (dc *DiffConfig) load(env *Env, job *Job, hdr []string, rows [][]string) error {
+	data, err := loadCSV(env.FS, job.Previous, job.Dialect)
+	if err != nil {
+		return err
+	}
+	prevHdr, prevRows, err := job.Dialect.splitHeader(data)
+	if err != nil {
+		return err
+	}
+	if prevHdr, _, err = uniqueHeader(prevHdr, job.Dialect.DuplicateHeaders); err != nil {
+		return err
+	}
+	dc.prevHdr = prevHdr
+	dc.cols = make([]int, len(hdr))
+	for i, name := range hdr {
+		dc.cols[i] = indexOf(prevHdr, name)
+	}
+
+	dc.key, dc.prevKey = nil, nil
+	for k := range dc.Key {
+		if err := dc.Key[k].resolve(hdr); err != nil {
+			return fmt.Errorf("key: %s", err)
+		}
+		i := dc.Key[k].Index
+		if dc.cols[i] < 0 {
+			return fmt.Errorf("key: column %q not found in the previous data", hdr[i])
+		}
+		dc.key = append(dc.key, i)
+		dc.prevKey = append(dc.prevKey, dc.cols[i])
+	}
+	if len(dc.Key) == 0 {
+		for i, j := range dc.cols {
+			if j >= 0 {
+				dc.key = append(dc.key, i)
+				dc.prevKey = append(dc.prevKey, j)
+			}
+		}
+	}
+
+	dc.prev = map[string][]string{}
+	for _, line := range prevRows {
+		dc.prev[diffKey(line, dc.prevKey)] = line
+	}
+	current := map[string]bool{}
+	for _, line := range rows {
+		current[diffKey(line, dc.key)] = true
+	}
+	dc.removed = nil
+	for _, line := range prevRows {
+		if !current[diffKey(line, dc.prevKey)] {
+			dc.removed = append(dc.removed, line)
+		}
+	}
+	return nil
+}
+
+// diffKey joins the key columns of line.
+func diffKey(line []string, key []int) string {
+	parts := make([]string, len(key))
+	for k, i := range key {
+		parts[k] = cellAt(line, i)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// compare reports whether line is new and, if it is not, which of its
+// columns changed.
+func (dc *DiffConfig) compare(line []string) (added bool, changed map[int]bool) {
+	if dc == nil || dc.prev == nil {
+		return false, nil
+	}
+	p, ok := dc.prev[diffKey(line, dc.key)]
+	if !ok {
+		return true, nil
+	}
+	for i, j := range dc.cols {
+		if j >= 0 && cellAt(line, i) != cellAt(p, j) {
+			if changed == nil {
+				changed = map[int]bool{}
+			}
+			changed[i] = true
+		}
+	}
+	return false, changed
+}
+
+// diffReport is the summary of the changes.
+type diffReport struct {
+	counts  string   // the sentence that counts the changes
+	values  []string // the changed values, one line per row
+	removed []string // the removed rows, one line per row
+}
+
+// report sums up the changes of rows. It returns nil if there is no
+// previous data.
+func (dc *DiffConfig) report(loc *locale, hdr []string, rows [][]string) *diffReport {
+	if dc == nil || dc.prev == nil {
+		return nil
+	}
+	var dr diffReport
+	added, changed := 0, 0
+	for _, line := range rows {
+		isNew, cells := dc.compare(line)
+		switch {
+		case isNew:
+			added++
+		case cells != nil:
+			changed++
+			var diffs []string
+			for i := range dc.cols {
+				if cells[i] {
+					p := dc.prev[diffKey(line, dc.key)]
+					diffs = append(diffs, loc.msg("changedValue", hdr[i], cellAt(line, i), cellAt(p, dc.cols[i])))
+				}
+			}
+			key := strings.Replace(diffKey(line, dc.key), "\x00", " / ", -1)
+			dr.values = append(dr.values, key+": "+strings.Join(diffs, ", "))
+		}
+	}
+	dr.counts = loc.msg("changeCounts", added, changed, len(dc.removed))
+	for _, line := range dc.removed {
+		var fields []string
+		for j, name := range dc.prevHdr {
+			fields = append(fields, name+": "+cellAt(line, j))
+		}
+		dr.removed = append(dr.removed, strings.Join(fields, ", "))
+	}
+	return &dr
+}
+
+// diffSummary adds a page that counts the changes and lists the
+// changed values and the removed rows.
+func diffSummary(pdf *Fpdf, cfg *Config, hdr []string, rows [][]string) *Fpdf {
+	loc := cfg.locale()
+	dr := cfg.Diff.report(loc, hdr, rows)
+	if dr == nil {
+		return pdf
+	}
+
+	addPage(pdf, cfg.Orientation.of("appendix"))
+	pdf.SetFont("Times", "B", 20)
+	pdf.Cell(40, 10, loc.text("changes"))
+	pdf.Ln(14)
+	pdf.SetFont("Times", "", 12)
+	legend := loc.msg("changeLegend")
+	if cfg.Grayscale {
+		legend = loc.msg("changeLegendGray")
+	}
+	pdf.MultiCell(0, 6, loc.print(dr.counts+" "+legend), "", "", false)
+	pdf.Ln(4)
+
+	list := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		pdf.SetFont("Times", "B", 14)
+		pdf.Cell(40, 8, loc.text(title))
+		pdf.Ln(10)
+		pdf.SetFont("Times", "", 10)
+		for _, l := range lines {
+			pdf.MultiCell(0, 5, loc.print(l), "", "", false)
+		}
+		pdf.Ln(4)
+	}
+	list("changedValues", dr.values)
+	list("removedRows", dr.removed)
+	return pdf
+}
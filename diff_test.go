@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"prev.csv": "Total,Status,ID\n10,open,1\n20,open,2\n30,open,3\n",
+	})
+	hdr := []string{"ID", "Status", "Total", "Margin"}
+	rows := [][]string{
+		{"1", "open", "10", "5%"},
+		{"2", "paid", "25", "6%"},
+		{"4", "open", "40", "7%"},
+	}
+	dc := &DiffConfig{Key: []ColumnRef{{Name: "ID"}}}
+	if err := dc.load(env, &Job{Previous: "prev.csv"}, hdr, rows); err != nil {
+		t.Fatal(err)
+	}
+	for r, want := range []struct {
+		added   bool
+		changed map[int]bool
+	}{
+		{false, nil},
+		{false, map[int]bool{1: true, 2: true}},
+		{true, nil},
+	} {
+		added, changed := dc.compare(rows[r])
+		if added != want.added || !reflect.DeepEqual(changed, want.changed) {
+			t.Errorf("compare(row %d) = %v, %v, want %v, %v", r, added, changed, want.added, want.changed)
+		}
+	}
+	loc, err := newLocale("", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr := dc.report(loc, hdr, rows)
+	want := &diffReport{
+		counts:  "Since the previous data, 1 rows were added, 1 changed, and 1 removed.",
+		values:  []string{"2: Status paid (was open), Total 25 (was 20)"},
+		removed: []string{"Total: 30, Status: open, ID: 3"},
+	}
+	if !reflect.DeepEqual(dr, want) {
+		t.Errorf("report = %+v, want %+v", dr, want)
+	}
+
+	// Without a key, rows match by all common values.
+	dc = &DiffConfig{}
+	if err := dc.load(env, &Job{Previous: "prev.csv"}, hdr, rows); err != nil {
+		t.Fatal(err)
+	}
+	if added, changed := dc.compare(rows[1]); !added || changed != nil {
+		t.Errorf("compare without a key = %v, %v, want an added row", added, changed)
+	}
+	if dr := dc.report(loc, hdr, rows); len(dr.removed) != 2 {
+		t.Errorf("report without a key removed %q, want 2 rows", dr.removed)
+	}
+
+	dc = &DiffConfig{Key: []ColumnRef{{Name: "Margin"}}}
+	if err := dc.load(env, &Job{Previous: "prev.csv"}, hdr, rows); err == nil || err.Error() != `key: column "Margin" not found in the previous data` {
+		t.Errorf("load with a key missing from the previous data: %v", err)
+	}
+}
+
+func TestDiffSummary(t *testing.T) {
+	env := testEnv(map[string]string{
+		"prev.csv": "ID,Total\n1,10\n2,20\n",
+		"in.csv":   "ID,Total\n1,10\n2,25\n3,30\n",
+		"cfg.json": `{"diff": {"key": ["ID"]}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Previous: "prev.csv", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, want := range []string{"(Changes)", "1 rows were added, 1 changed, and 0 removed.", "(2: Total 25 \\(was 20\\))", "0.863 0.961 0.863 rg"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the report lacks %q", want)
+		}
+	}
+
+	env = testEnv(map[string]string{"in.csv": "Region,Total\nNorth,1\n", "cfg.json": `{"diff": {}, "split": {"column": "Region"}}`})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err == nil || !strings.Contains(err.Error(), "not available in split runs") {
+		t.Errorf("diff in a split run: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ## Digest email
+
+// A split or merge run produces dozens of reports at once. Mailing each
+// of them floods the inbox, and a failed report goes unnoticed among the
+// successful ones. A digest is a single email per run that lists every
+// report -- failures first, with the reason, then the successful ones
+// with their size and where to find them. It has no attachments.
+
+// DigestConfig describes the digest email.
+type DigestConfig struct {
+	SMTPConfig
+
+	To []string `json:"to"`
+
+	// Subject and Body are text/templates. They can use {{.Date}},
+	// {{.Total}}, {{.Succeeded}}, {{.Failed}}, and {{.Reports}}, a list
+	// of reports with the fields File, Value, Rows, Size, Link, Error,
+	// and Unchanged (not delivered again; see SkipUnchangedConfig).
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	// LinkBase turns the paths of local reports into links, for example
+	// "https://reports.example.com/" for a web server that serves the
+	// output directory. Reports in cloud storage are listed with their
+	// URL.
+	LinkBase string `json:"linkBase"`
+}
+
+// digestData is the template data for Subject and Body.
+type digestData struct {
+	Date                     string
+	Total, Succeeded, Failed int
+	Reports                  []digestReport
+}
+
+type digestReport struct {
+	File  string
+	Value string
+	Rows  int
+	Size  string
+	Link  string
+	Error string
+
+	Unchanged bool
+}
+
+const defaultDigestBody = `{{.Succeeded}} of {{.Total}} reports were generated on {{.Date}}.
+{{if .Failed}}
+Failed:
+{{range .Reports}}{{if .Error}}
+  {{.File}}
+    {{.Error}}
+{{end}}{{end}}{{end}}
+{{- if .Succeeded}}
+Generated:
+{{range .Reports}}{{if not .Error}}
+  {{.File}} ({{pluralize .Rows "row" "rows"}}, {{.Size}}{{if .Unchanged}}, unchanged{{end}}){{with .Link}}
+    {{.}}{{end}}
+{{end}}{{end}}{{end}}`
+
+// sendDigest sends the digest of a run, if configured, and returns the
+// error of the run combined with the error of sending the digest.
+func (d *DeliveryConfig) sendDigest(env *Env, parts []*part, runErr error) error {
+	if d == nil || d.Digest == nil {
+		return runErr
+	}
+	err := d.Digest.send(env, parts)
+	switch {
+	case err == nil:
+		return runErr
+	case runErr == nil:
+		return fmt.Errorf("digest email: %w", err)
+	}
+	return fmt.Errorf("%w\ndigest email: %s", runErr, err)
+}
+
+// send mails the digest of parts.
+func (dc *DigestConfig) send(env *Env, parts []*part) error {
+	if len(dc.To) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	data := digestData{Date: env.Clock.Now().Format("Mon Jan 2, 2006"), Total: len(parts)}
+	for _, p := range parts {
+		r := digestReport{File: p.output, Value: p.value, Rows: len(p.rows)}
+		if p.err != nil {
+			r.Error = p.err.Error()
+			data.Failed++
+		} else {
+			r.Size = formatSize(len(p.pdf))
+			r.Link = dc.link(p.output)
+			r.Unchanged = p.unchanged
+			data.Succeeded++
+		}
+		data.Reports = append(data.Reports, r)
+	}
+	subject, err := execTemplate("subject", orDefault(dc.Subject, "{{.Succeeded}} of {{.Total}} reports generated{{if .Failed}}, {{.Failed}} failed{{end}}"), data)
+	if err != nil {
+		return err
+	}
+	body, err := execTemplate("body", orDefault(dc.Body, defaultDigestBody), data)
+	if err != nil {
+		return err
+	}
+	msg, err := mailMessage(dc.From, dc.To, subject, body, "", nil, env.Clock.Now())
+	if err != nil {
+		return err
+	}
+	return dc.sendMail(dc.To, msg)
+}
+
+// link returns the URL of a report, or "" if there is none.
+func (dc *DigestConfig) link(output string) string {
+	if isRemote(output) {
+		return output
+	}
+	if dc.LinkBase == "" {
+		return ""
+	}
+	u := url.URL{Path: filepath.ToSlash(filepath.Clean(output))}
+	return strings.TrimSuffix(dc.LinkBase, "/") + "/" + strings.TrimPrefix(u.EscapedPath(), "/")
+}
+
+// formatSize formats a number of bytes for humans, such as "45.2 kB".
+func formatSize(n int) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%d B", n)
+	case n < 1000*1000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1000)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/1000/1000)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mailText returns the subject and the text part of a message.
+func mailText(t *testing.T, data string) (subject, text string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subject, string(b)
+}
+
+func TestDigest(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+	env := testEnv(map[string]string{
+		"in.csv": "Name,Course\nAda,Analytics\nBad,Logic\nAlan,Logic\n",
+		// The template fails for the second row.
+		"cfg.json": `{"merge": {"template": "{{if eq .Name \"Bad\"}}{{call .Name}}{{end}}{{.Name}}", "key": "Name", "output": "out/{{.Value}}.pdf"},
+			"delivery": {"digest": {"host": "127.0.0.1", "port": ` + strconv.Itoa(srv.port()) + `,
+				"from": "reports@example.com", "to": ["ops@example.com"], "linkBase": "https://reports.example.com/"}}}`,
+	})
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 reports failed:\nout/Bad.pdf: merge template: ") {
+		t.Errorf("generate = %v, want the failed report", err)
+	}
+	sent := srv.sent()
+	if len(sent) != 1 || strings.Join(sent[0].to, ",") != "ops@example.com" {
+		t.Fatalf("sent %d messages, want one to ops@example.com", len(sent))
+	}
+	subject, text := mailText(t, sent[0].data)
+	if want := "2 of 3 reports generated, 1 failed"; subject != want {
+		t.Errorf("subject %q, want %q", subject, want)
+	}
+	size := func(name string) string { return formatSize(len(testFile(t, env, name))) }
+	want := `2 of 3 reports were generated on Fri Mar 15, 2024.
+
+Failed:
+
+  out/Bad.pdf
+    ` + err.Error()[strings.Index(err.Error(), "merge template: "):] + `
+
+Generated:
+
+  out/Ada.pdf (1 row, ` + size("out/Ada.pdf") + `)
+    https://reports.example.com/out/Ada.pdf
+
+  out/Alan.pdf (1 row, ` + size("out/Alan.pdf") + `)
+    https://reports.example.com/out/Alan.pdf
+`
+	if text != want {
+		t.Errorf("digest:\n%s\nwant:\n%s", text, want)
+	}
+	if strings.Contains(sent[0].data, "Content-Disposition: attachment") {
+		t.Error("the digest has an attachment")
+	}
+}
+
+func TestDigestTemplates(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+	dc := &DigestConfig{
+		SMTPConfig: SMTPConfig{Host: "127.0.0.1", Port: srv.port(), From: "reports@example.com"},
+		To:         []string{"ops@example.com"},
+		Subject:    "Nightly run: {{.Succeeded}}/{{.Total}}",
+		Body:       "{{range .Reports}}{{.Value}} {{.Rows}} {{.Link}} {{.Unchanged}}\n{{end}}",
+	}
+	parts := []*part{
+		{output: "s3://bucket/North.pdf", value: "North", rows: make([][]string, 3), pdf: []byte("%PDF")},
+		{output: "South.pdf", value: "South", rows: make([][]string, 1), pdf: []byte("%PDF"), unchanged: true},
+	}
+	if err := dc.send(testEnv(nil), parts); err != nil {
+		t.Fatal(err)
+	}
+	subject, text := mailText(t, srv.sent()[0].data)
+	if subject != "Nightly run: 2/2" || text != "North 3 s3://bucket/North.pdf false\nSouth 1  true\n" {
+		t.Errorf("digest %q:\n%s", subject, text)
+	}
+
+	if err := (&DigestConfig{}).send(testEnv(nil), parts); err == nil || err.Error() != "no recipients" {
+		t.Errorf("digest without recipients: %v", err)
+	}
+	dc.Body = "{{.Missing}}"
+	if err := dc.send(testEnv(nil), parts); err == nil {
+		t.Error("a broken template is sent")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int]string{0: "0 B", 999: "999 B", 1000: "1.0 kB", 45230: "45.2 kB", 2500000: "2.5 MB"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
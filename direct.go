@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// ## The direct engine
+
+// gofpdf is a general layout engine: every cell goes through font
+// handling, page break checks, and a pile of options. For a report of a
+// few thousand rows, that does not matter. For an export of millions of
+// rows, it does: most of the run goes to machinery that a plain table
+// does not need.
+//
+// The direct engine writes such tables itself: the same title, header,
+// table, and logo, in the core fonts, straight into PDF content streams.
+// It knows nothing else, so it only takes plain tables: no embedded
+// fonts, no footnotes, groups, ranks, links, badges, heat maps, or any
+// of the other features of the general engine.
+//
+// `-engine direct` selects it, and fails for reports that are not plain.
+// `-engine auto`, the default, selects it for plain tables of at least
+// 100,000 rows, or that exceed the memory budget otherwise; `-engine
+// gofpdf` never does.
+
+// directThreshold is the number of rows from which the automatic engine
+// selection prefers the direct engine.
+const directThreshold = 100000
+
+// directEngine returns whether the report is written by the direct engine.
+func (job *Job) directEngine(env *Env, cfg *Config, data *reportData) (bool, error) {
+	switch job.Engine {
+	case "", "auto":
+		large := len(data.rows) >= directThreshold || !env.fits(len(data.rows), len(data.hdr), false)
+		return large && directObstacle(env, cfg, job, data) == "", nil
+	case "gofpdf":
+		return false, nil
+	case "direct":
+		if reason := directObstacle(env, cfg, job, data); reason != "" {
+			return false, fmt.Errorf("the direct engine does not support %s", reason)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown engine %q; use auto, gofpdf, or direct", job.Engine)
+}
+
+// directObstacle returns the first feature of the report that the direct
+// engine does not support, or "" if the table is plain.
+func directObstacle(env *Env, cfg *Config, job *Job, data *reportData) string {
+	checks := []struct {
+		used    bool
+		feature string
+	}{
+		{len(cfg.fonts()) > 0 || len(cfg.FallbackFonts) > 0, "embedded fonts"},
+		{cfg.Narrative != "", "narratives"},
+		{cfg.Footnotes != nil, "footnotes"},
+		{cfg.Group != nil, "groups"},
+		{cfg.Rank != nil, "ranks"},
+		{cfg.Pivot != nil, "pivot tables"},
+		{cfg.Link != nil, "links"},
+		{cfg.Freshness != nil, "freshness stamps"},
+		{cfg.Limits != nil, "limits"},
+		{cfg.Attach != nil, "attachments"},
+		{cfg.Archive != nil, "archive mode"},
+		{cfg.Tagged != nil, "tagged PDF"},
+		{cfg.Stationery != nil && (cfg.Stationery.Top > 0 || cfg.Stationery.Bottom > 0), "stationery margins"},
+		{cfg.Form.block(), "form blocks"},
+		{cfg.SignOff != nil, "sign-off blocks"},
+		{len(cfg.annotations) > 0, "review annotations"},
+		{cfg.Manifest != nil, "manifests"},
+		{cfg.overflows(), "overflow policies"},
+		{cfg.Freeze != nil, "frozen columns"},
+		{cfg.Orientation != nil, "page orientations"},
+		{cfg.CellStyle != nil, "cell styles"},
+		{cfg.RotateHeader != nil, "rotated column names"},
+		{len(cfg.HeaderGroups) > 0, "header groups"},
+		{cfg.RawData != nil, "the raw data appendix"},
+		{cfg.Dashboard != nil, "dashboards"},
+		{len(cfg.Callouts) > 0, "callouts"},
+		{cfg.Diff != nil && cfg.Diff.prev != nil, "changes since the previous data"},
+		{cfg.rtl(), "right-to-left documents"},
+		{env.Hooks != nil, "render hooks"},
+		{len(data.invalid) > 0 || len(data.issues) > 0, "invalid rows"},
+		{job.Snapshot || job.DryRun || job.DebugLayout || job.Golden != "", "layout snapshots, dry runs, layout debugging, or golden files"},
+	}
+	for _, c := range checks {
+		if c.used {
+			return c.feature
+		}
+	}
+	for _, cc := range cfg.Columns {
+		if cc.Sparkline != nil || cc.Renderer != nil || cc.HeatMap != nil || cc.Badges != nil || cc.Highlight != "" || cc.Footnote != "" || cc.Direction != "" {
+			return fmt.Sprintf("the settings of column %s", cc.label())
+		}
+	}
+	return ""
+}
+
+// writeDirect writes, saves, and delivers the report of part p with the
+// direct engine.
+func writeDirect(env *Env, cfg *Config, data *reportData, p *part) error {
+	env.Log.Debug("direct engine selected", "output", p.output, "rows", len(data.rows))
+	pdf, pages, err := directReport(env, cfg, data)
+	if err != nil {
+		return withExitCode(exitRender, fmt.Errorf("failed creating PDF report: %w", err))
+	}
+	p.pages = pages
+	if p.pdf, err = finishBytes(pdf, cfg.finishers(env, nil, nil)...); err != nil {
+		return fmt.Errorf("cannot save PDF: %w", err)
+	}
+	if err := store(env, cfg, p); err != nil {
+		return err
+	}
+	if cfg.TextVersion != nil {
+		if err := cfg.TextVersion.write(env, cfg, data, p); err != nil {
+			return err
+		}
+	}
+	if p.unchanged {
+		env.Log.Info("report unchanged, not delivered", "output", p.output)
+	} else {
+		env.Log.Info("report written", "output", p.output, "rows", len(data.rows), "pages", pages)
+	}
+	return nil
+}
+
+// Page geometry in mm, the same as gofpdf's defaults for a landscape
+// Letter page.
+const (
+	directPageW  = 279.4
+	directPageH  = 215.9
+	directMargin = 10.0
+	directBottom = 20.0
+	directCellH  = 7.0
+	directCellM  = 1.0       // the margin inside a cell
+	directK      = 72 / 25.4 // points per mm
+)
+
+// directWriter writes PDF objects and remembers their offsets.
+type directWriter struct {
+	buf     bytes.Buffer
+	offsets []int // by object number - 1
+
+	z  bytes.Buffer // compressed streams, reused
+	zw *zlib.Writer
+}
+
+// reserve returns the number of an object that is written later.
+func (w *directWriter) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+// object starts object n.
+func (w *directWriter) object(n int) {
+	w.offsets[n-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", n)
+}
+
+// stream writes object n as a compressed stream with the given
+// dictionary entries.
+func (w *directWriter) stream(n int, dict string, data []byte) {
+	w.z.Reset()
+	if w.zw == nil {
+		w.zw, _ = zlib.NewWriterLevel(&w.z, zlib.BestSpeed)
+	} else {
+		w.zw.Reset(&w.z)
+	}
+	w.zw.Write(data)
+	w.zw.Close()
+	w.object(n)
+	fmt.Fprintf(&w.buf, "<<%s /Filter /FlateDecode /Length %d>>\nstream\n", dict, w.z.Len())
+	w.buf.Write(w.z.Bytes())
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// directContent is the content stream of a page.
+type directContent struct {
+	b []byte
+}
+
+// op appends operators and operands.
+func (c *directContent) op(s string) {
+	c.b = append(c.b, s...)
+}
+
+// num appends a number and a space.
+func (c *directContent) num(v float64) {
+	c.b = strconv.AppendFloat(c.b, v, 'f', 2, 64)
+	c.b = append(c.b, ' ')
+}
+
+// text prints s with its baseline starting at x, y, in mm from the top
+// left corner.
+func (c *directContent) text(font string, size, x, y float64, s string) {
+	c.op("BT /")
+	c.op(font)
+	c.op(" ")
+	c.num(size)
+	c.op("Tf ")
+	c.num(x * directK)
+	c.num((directPageH - y) * directK)
+	c.op("Td (")
+	c.op(pdfEscape(s))
+	c.op(") Tj ET\n")
+}
+
+// directReport writes the report and returns the PDF and its number of
+// pages.
+func directReport(env *Env, cfg *Config, data *reportData) ([]byte, int, error) {
+	loc := cfg.locale()
+	regular, bold := coreFontWidths("", 16), coreFontWidths("B", 16)
+	width := func(widths *[256]float64, s string) float64 {
+		total := 0.0
+		for i := 0; i < len(s); i++ {
+			total += widths[s[i]]
+		}
+		return total
+	}
+
+	w := &directWriter{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	pagesObj, resourcesObj := w.reserve(), w.reserve()
+	var pages []int
+
+	// The content of the current page.
+	page := &directContent{}
+	endPage := func() {
+		pageObj, contentObj := w.reserve(), w.reserve()
+		w.object(pageObj)
+		fmt.Fprintf(&w.buf, "<</Type /Page /Parent %d 0 R /Resources %d 0 R /Contents %d 0 R>>\nendobj\n", pagesObj, resourcesObj, contentObj)
+		w.stream(contentObj, "", page.b)
+		pages = append(pages, pageObj)
+		page.b = page.b[:0]
+		// gofpdf's default line width of 0.2 mm.
+		page.op("0.57 w\n")
+	}
+	page.op("0.57 w\n")
+	// cell draws a bordered cell at x, y, like gofpdf's CellFormat.
+	cell := func(font string, widths *[256]float64, x, y, cw float64, s, align string, fill bool) {
+		page.num(x * directK)
+		page.num((directPageH - y) * directK)
+		page.num(cw * directK)
+		page.num(-directCellH * directK)
+		if fill {
+			page.op("re B\n")
+		} else {
+			page.op("re S\n")
+		}
+		if s == "" {
+			return
+		}
+		dx := directCellM
+		switch align {
+		case "R":
+			dx = cw - directCellM - width(widths, s)
+		case "C":
+			dx = (cw - width(widths, s)) / 2
+		}
+		page.text(font, 16, x+dx, y+.5*directCellH+.3*16/directK, s)
+	}
+
+	// The title and the date.
+	page.text("F2", 28, directMargin+directCellM, directMargin+5+.3*28/directK, loc.text("title"))
+	page.text("F1", 20, directMargin+directCellM, directMargin+12+5+.3*20/directK, loc.print(loc.date(env.Clock.Now(), loc.longDate)))
+	y := directMargin + 12 + 20.0
+
+	// The header. The position, width, and alignment of the columns are
+	// the same in every row.
+	type column struct {
+		cc       ColumnConfig
+		i        int
+		x, width float64
+		align    string
+	}
+	var cols []column
+	defaults := []string{"L", "C", "L", "R", "R", "R"}
+	x := directMargin
+	for _, i := range cfg.columnOrder(len(data.hdr)) {
+		cc := cfg.column(i)
+		def := ""
+		if i < len(defaults) {
+			def = defaults[i]
+		}
+		cols = append(cols, column{cc: cc, i: i, x: x, width: cfg.width(i), align: cfg.align(cc, def)})
+		x += cfg.width(i)
+	}
+	page.op("0.941 g\n")
+	for _, c := range cols {
+		cell("F2", bold, c.x, y, c.width, loc.printDir(data.hdr[c.i], c.cc.Direction), cfg.mirrored(c.cc, ""), true)
+	}
+	page.op("0 g\n")
+	y += directCellH
+
+	// The rows.
+	report := env.Progress
+	event := ProgressEvent{Report: data.name, TotalRows: len(data.rows)}
+	for r, line := range data.rows {
+		if y+directCellH > directPageH-directBottom {
+			endPage()
+			y = directMargin
+		}
+		for _, c := range cols {
+			cell("F1", regular, c.x, y, c.width, formatCell(cellAt(line, c.i), c.cc, loc), c.align, false)
+		}
+		y += directCellH
+		if (r+1)%1000 != 0 {
+			continue
+		}
+		if err := env.canceled(); err != nil {
+			return nil, 0, err
+		}
+		if report != nil {
+			event.Rows, event.Pages = r+1, len(pages)+1
+			report(event)
+		}
+	}
+
+	// The logo goes to the top right corner of the last page.
+	logo, err := directImage(env, w, cfg.Grayscale)
+	if err != nil {
+		return nil, 0, err
+	}
+	page.op("q ")
+	page.num(25 * directK)
+	page.op("0 0 ")
+	page.num(25 * directK)
+	page.num((directPageW - 54.4) * directK)
+	page.num((directPageH - 35) * directK)
+	page.op("cm /I1 Do Q\n")
+	endPage()
+
+	// The fonts, the resources, and the page tree.
+	fonts := [2]int{w.reserve(), w.reserve()}
+	for i, name := range []string{"Times-Roman", "Times-Bold"} {
+		w.object(fonts[i])
+		fmt.Fprintf(&w.buf, "<</Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding>>\nendobj\n", name)
+	}
+	w.object(resourcesObj)
+	fmt.Fprintf(&w.buf, "<</ProcSet [/PDF /Text /ImageC] /Font <</F1 %d 0 R /F2 %d 0 R>> /XObject <</I1 %d 0 R>>>>\nendobj\n", fonts[0], fonts[1], logo)
+	kids := make([]string, len(pages))
+	for i, p := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	w.object(pagesObj)
+	fmt.Fprintf(&w.buf, "<</Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %.2f %.2f]>>\nendobj\n", strings.Join(kids, " "), len(pages), directPageW*directK, directPageH*directK)
+	info := w.reserve()
+	w.object(info)
+	fmt.Fprintf(&w.buf, "<</Producer (appliedgo/pdf direct engine) /CreationDate (D:%s)>>\nendobj\n", cfg.documentTime(env).Format("20060102150405"))
+	catalog := w.reserve()
+	w.object(catalog)
+	fmt.Fprintf(&w.buf, "<</Type /Catalog /Pages %d 0 R>>\nendobj\n", pagesObj)
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n>>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, catalog, info, xref)
+
+	if report != nil {
+		event.Rows, event.Pages, event.Done = len(data.rows), len(pages), true
+		report(event)
+	}
+	return w.buf.Bytes(), len(pages), nil
+}
+
+// directImage writes the logo as an image XObject, with its
+// transparency as a soft mask, and returns its object number.
+func directImage(env *Env, w *directWriter, gray bool) (int, error) {
+	kind := "direct"
+	if gray {
+		kind = "direct gray"
+	}
+	v, err := env.Resources.derive(env.FS, "stats.png", kind, func(data []byte) (interface{}, error) {
+		img, err := decodeDirectImage(data, gray)
+		if err != nil {
+			return nil, fmt.Errorf("stats.png: %w", err)
+		}
+		return img, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	img := v.(*directPicture)
+	dict := fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", img.width, img.height)
+	mask := ""
+	if !img.opaque {
+		n := w.reserve()
+		w.stream(n, dict+" /ColorSpace /DeviceGray", img.alpha)
+		mask = fmt.Sprintf(" /SMask %d 0 R", n)
+	}
+	n := w.reserve()
+	w.stream(n, dict+" /ColorSpace /DeviceRGB"+mask, img.rgb)
+	return n, nil
+}
+
+// directPicture is the logo, decoded for the direct engine.
+type directPicture struct {
+	width, height int
+	rgb, alpha    []byte
+	opaque        bool
+}
+
+// decodeDirectImage decodes a PNG image into its colors and its
+// transparency, in gray if gray is true.
+func decodeDirectImage(data []byte, gray bool) (*directPicture, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// RGBA returns alpha-premultiplied values.
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a > 0 && a < 0xffff {
+				r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+			}
+			if gray {
+				r = uint32(grayLevel(float64(r), float64(g), float64(bl)))
+				g, bl = r, r
+			}
+			rgb = append(rgb, byte(r>>8), byte(g>>8), byte(bl>>8))
+			alpha = append(alpha, byte(a>>8))
+			opaque = opaque && a == 0xffff
+		}
+	}
+	return &directPicture{width: b.Dx(), height: b.Dy(), rgb: rgb, alpha: alpha, opaque: opaque}, nil
+}
+
+// coreFontWidths returns the widths in mm of the 256 characters of a
+// Times core font in the given style and size.
+func coreFontWidths(style string, size float64) *[256]float64 {
+	pdf := newPDF("L", "mm", "Letter", "")
+	pdf.SetFont("Times", style, size)
+	var widths [256]float64
+	for c := range widths {
+		widths[c] = pdf.GetStringWidth(string([]byte{byte(c)}))
+	}
+	return &widths
+}
+
+// pdfEscaper escapes the characters that end or break a PDF literal
+// string.
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`)
+
+// pdfEscape escapes s for a PDF literal string.
+func pdfEscape(s string) string {
+	if !strings.ContainsAny(s, "\\()\r") {
+		return s
+	}
+	return pdfEscaper.Replace(s)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDirectReport(t *testing.T) {
+	// The first page holds 20 rows under the title and the header, the
+	// following ones 26 rows each.
+	env := testEnv(map[string]string{"in.csv": longCSV(100)})
+	if err := generate(env, &Job{Input: "in.csv", Output: "out.pdf", Engine: "direct"}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(testFile(t, env, "out.pdf"))
+	if !strings.Contains(string(data), "/Producer (appliedgo/pdf direct engine)") {
+		t.Error("the report is not written by the direct engine")
+	}
+	if pages := pageObjects(t, data); len(pages) != 5 {
+		t.Errorf("%d pages, want 5", len(pages))
+	}
+	content := pageContents(t, data)
+	if !strings.Contains(content, "/F2 16.00 Tf") || !strings.Contains(content, "(Total) Tj") {
+		t.Error("the header is missing")
+	}
+	for i := 0; i < 100; i++ {
+		if !strings.Contains(content, fmt.Sprintf("(Item %d) Tj", i)) {
+			t.Fatalf("row %d is missing", i)
+		}
+	}
+	if !strings.Contains(content, "/I1 Do") {
+		t.Error("the logo is missing")
+	}
+}
+
+func TestDirectEngine(t *testing.T) {
+	small := &reportData{hdr: []string{"Item", "Total"}, rows: [][]string{{"a", "1"}}}
+	large := &reportData{hdr: small.hdr, rows: make([][]string, directThreshold)}
+	tests := []struct {
+		name   string
+		engine string
+		cfg    *Config
+		data   *reportData
+		budget int64
+		want   bool
+		err    string
+	}{
+		{"auto small", "", &Config{}, small, 0, false, ""},
+		{"auto large", "auto", &Config{}, large, 0, true, ""},
+		{"auto over budget", "auto", &Config{}, small, 1, true, ""},
+		{"auto not plain", "auto", &Config{Narrative: "n"}, large, 0, false, ""},
+		{"gofpdf", "gofpdf", &Config{}, large, 0, false, ""},
+		{"direct", "direct", &Config{}, small, 0, true, ""},
+		{"direct not plain", "direct", &Config{Group: &GroupConfig{}}, small, 0, false, "the direct engine does not support groups"},
+		{"direct column", "direct", &Config{Columns: []ColumnConfig{{Name: "Total", Highlight: "> 1"}}}, small, 0, false, "the direct engine does not support the settings of column"},
+		{"unknown", "fast", &Config{}, small, 0, false, `unknown engine "fast"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv(nil)
+			env.MaxMemory = tt.budget
+			job := &Job{Engine: tt.engine}
+			got, err := job.directEngine(env, tt.cfg, tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
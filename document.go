@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+)
+
+// ## Document-wide settings
+
+// setupDocument applies settings that affect the whole document, such as
+// fonts and metadata. newReport calls it before anything is written.
+func setupDocument(pdf *Fpdf, env *Env, cfg *Config) {
+	if fonts := cfg.fonts(); len(fonts) > 0 {
+		if err := cfg.embedFonts(pdf, env.resources(), "Times", fonts); err != nil {
+			pdf.SetError(err)
+			return
+		}
+	}
+	for i, fonts := range cfg.FallbackFonts {
+		if err := cfg.embedFonts(pdf, env.resources(), fallbackFamily(i), fonts); err != nil {
+			pdf.SetError(err)
+			return
+		}
+	}
+	if cfg.Deterministic {
+		// gofpdf writes the current time and, unless told otherwise,
+		// lists fonts and images in random order.
+		pdf.SetCatalogSort(true)
+		pdf.SetCreationDate(cfg.documentTime(env))
+		pdf.SetModificationDate(cfg.documentTime(env))
+	}
+	if cfg.Stationery != nil {
+		cfg.Stationery.setup(pdf)
+	}
+	if cfg.Tagged != nil {
+		cfg.Tagged.setup(pdf, cfg)
+	}
+	if cfg.Archive != nil {
+		cfg.Archive.setup(pdf, cfg.documentTime(env), cfg.manifest.xmp())
+	} else if cfg.manifest != nil && cfg.Tagged == nil {
+		pdf.SetXmpMetadata(cfg.manifest.packet())
+	}
+}
+
+// documentTime returns the creation time of the document: now, or in
+// deterministic mode the start of the day.
+func (c *Config) documentTime(env *Env) time.Time {
+	now := env.Clock.Now()
+	if !c.Deterministic {
+		return now
+	}
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+// finishers returns the steps that process the finished document, with
+// the structure tree of tags for a tagged report and the fields of the
+// form block.
+func (c *Config) finishers(env *Env, tags *tagger, fields []formWidget) []func([]byte) ([]byte, error) {
+	var finish []func([]byte) ([]byte, error)
+	if c.Grayscale {
+		finish = append(finish, grayscaleFinisher())
+	}
+	if tags != nil {
+		finish = append(finish, tags.finisher())
+	}
+	if c.Stationery != nil {
+		finish = append(finish, c.Stationery.finisher(env.resources(), c.Grayscale))
+	}
+	if c.Form != nil {
+		finish = append(finish, c.Form.finisher(fields))
+	}
+	if c.Insert != nil {
+		finish = append(finish, c.Insert.finisher(env.resources()))
+	}
+	if c.ContactSheet != nil && !c.ContactSheet.Separate {
+		finish = append(finish, c.ContactSheet.finisher())
+	}
+	if c.Compression != nil || c.maxSize > 0 {
+		finish = append(finish, compressionFinisher(env, c.Compression, c.maxSize))
+	}
+	if c.Archive != nil {
+		finish = append(finish, c.Archive.finisher(env.resources()))
+	}
+	return finish
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Schema drift
+
+// Upstream systems change their exports without asking. A new column in
+// the middle of the file shifts everything behind it, and the report
+// prints quantities under "Total". With drift detection, the schema is
+// the complete list of expected columns, in order, and the input header
+// is compared with it before anything else happens:
+//
+//	"schema": {
+//	  "columns": [{"name": "Date", "type": "date"}, {"name": "Total", "type": "float"}],
+//	  "drift": "error"}
+//
+// The comparison finds new and missing columns, columns that moved, and
+// typed columns none of whose values have the type anymore. "error"
+// stops the report with a list of the differences; "warn" logs them and
+// goes on, skipping the checks of missing columns.
+
+// driftCheck compares hdr and rows with the schema and reports the
+// differences according to the Drift policy.
+func (s *SchemaConfig) driftCheck(env *Env, input string, hdr []string, rows [][]string) error {
+	if s == nil || s.Drift == "" {
+		return nil
+	}
+	if s.Drift != "warn" && s.Drift != "error" {
+		return fmt.Errorf("unknown schema drift policy %q; use warn or error", s.Drift)
+	}
+	diff := s.drift(hdr, rows)
+	if len(diff) == 0 {
+		return nil
+	}
+	if s.Drift == "warn" {
+		env.Log.Warn("input columns differ from the schema", "input", input, "changes", strings.Join(diff, "; "))
+		return nil
+	}
+	return fmt.Errorf("input columns differ from the schema: %s", strings.Join(diff, "; "))
+}
+
+// drift returns the differences between the schema and the input, one
+// entry each: "+" for new columns, "-" for missing ones, and "~" for
+// moved or retyped ones.
+func (s *SchemaConfig) drift(hdr []string, rows [][]string) []string {
+	var diff []string
+	expected := map[string]bool{}
+	for _, sc := range s.Columns {
+		expected[sc.Name] = true
+	}
+	for i, name := range hdr {
+		if !expected[name] {
+			diff = append(diff, fmt.Sprintf("+ %s: new column %d", name, i+1))
+		}
+	}
+
+	// Columns moved if the columns that are in both come in a different
+	// order. New or missing columns alone do not move the others.
+	var common []int
+	for j, sc := range s.Columns {
+		if indexOf(hdr, sc.Name) < 0 {
+			diff = append(diff, fmt.Sprintf("- %s: missing", sc.Name))
+			continue
+		}
+		common = append(common, j)
+	}
+	var found []string
+	for _, name := range hdr {
+		if expected[name] {
+			found = append(found, name)
+		}
+	}
+	for k, j := range common {
+		sc := s.Columns[j]
+		col := indexOf(hdr, sc.Name)
+		if k >= len(found) || found[k] != sc.Name {
+			diff = append(diff, fmt.Sprintf("~ %s: moved from column %d to %d", sc.Name, j+1, col+1))
+		}
+		if str, ok := retyped(sc, col, rows); ok {
+			diff = append(diff, fmt.Sprintf("~ %s: %s expected, found %s such as %q", sc.Name, sc.Type, valueType(str), str))
+		}
+	}
+	return diff
+}
+
+// retyped reports whether column col has values but none of the type
+// of sc, and returns the first value.
+func retyped(sc SchemaColumn, col int, rows [][]string) (string, bool) {
+	if sc.Type == "" || sc.Type == "string" {
+		return "", false
+	}
+	first := ""
+	for _, line := range rows {
+		if col >= len(line) {
+			continue
+		}
+		str := strings.TrimSpace(line[col])
+		if str == "" {
+			continue
+		}
+		if sc.check(str, nil) == "" {
+			return "", false
+		}
+		if first == "" {
+			first = str
+		}
+	}
+	return first, first != ""
+}
+
+// valueType names the type of str for the drift report.
+func valueType(str string) string {
+	if _, err := strconv.Atoi(str); err == nil {
+		return "int"
+	}
+	if _, err := strconv.ParseFloat(str, 64); err == nil {
+		return "float"
+	}
+	if _, err := time.Parse("2006-01-02", str); err == nil {
+		return "date"
+	}
+	return "string"
+}
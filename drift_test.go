@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	s := &SchemaConfig{Columns: []SchemaColumn{
+		{Name: "Date", Type: "date"},
+		{Name: "Item"},
+		{Name: "Qty", Type: "int"},
+		{Name: "Total", Type: "float"},
+	}}
+	tests := []struct {
+		hdr  []string
+		rows [][]string
+		want []string
+	}{
+		{[]string{"Date", "Item", "Qty", "Total"}, [][]string{{"2024-03-01", "Apples", "3", "1.5"}}, nil},
+		// Empty values and a single typed value are enough.
+		{[]string{"Date", "Item", "Qty", "Total"}, [][]string{{"", "Apples", "", "n/a"}, {"", "Pears", "2", "2"}}, nil},
+		// A new column in the middle moves no other column.
+		{[]string{"Date", "Item", "Unit", "Qty", "Total"}, nil, []string{"+ Unit: new column 3"}},
+		{[]string{"Date", "Item", "Total"}, nil, []string{"- Qty: missing"}},
+		{[]string{"Date", "Item", "Total", "Qty"}, nil, []string{
+			"~ Qty: moved from column 3 to 4",
+			"~ Total: moved from column 4 to 3",
+		}},
+		{[]string{"Date", "Item", "Qty", "Total"}, [][]string{{"01.03.2024", "Apples", "3.5", "1,5"}, {"02.03.2024", "Pears", "", "2,5"}}, []string{
+			`~ Date: date expected, found string such as "01.03.2024"`,
+			`~ Qty: int expected, found float such as "3.5"`,
+			`~ Total: float expected, found string such as "1,5"`,
+		}},
+	}
+	for _, tt := range tests {
+		if got := s.drift(tt.hdr, tt.rows); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("drift(%q) = %q, want %q", tt.hdr, got, tt.want)
+		}
+	}
+}
+
+func TestSchemaDriftPolicy(t *testing.T) {
+	hdr := []string{"Item", "Unit", "Total"}
+	s := &SchemaConfig{Drift: "error", Columns: []SchemaColumn{{Name: "Item"}, {Name: "Total"}}}
+	env := testEnv(nil)
+	err := s.driftCheck(env, "in.csv", hdr, nil)
+	if err == nil || err.Error() != "input columns differ from the schema: + Unit: new column 2" {
+		t.Errorf("driftCheck with error = %v", err)
+	}
+
+	var log bytes.Buffer
+	env.Log, _ = NewLogger(&log, "info", "text")
+	s.Drift = "warn"
+	if err := s.driftCheck(env, "in.csv", hdr, nil); err != nil {
+		t.Errorf("driftCheck with warn = %v", err)
+	}
+	if !strings.Contains(log.String(), "input columns differ from the schema") || !strings.Contains(log.String(), "+ Unit: new column 2") {
+		t.Errorf("driftCheck with warn logged %q", log.String())
+	}
+
+	s.Drift = ""
+	if err := s.driftCheck(env, "in.csv", []string{"Other"}, nil); err != nil {
+		t.Errorf("driftCheck without a policy = %v", err)
+	}
+}
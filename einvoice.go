@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Electronic invoices
+
+// More and more customers, and soon the tax authorities of most EU
+// countries, want invoices they can book without typing them in.
+// ZUGFeRD and Factur-X, the German and the French name of the same
+// standard, make the PDF invoice machine-readable: the invoice data is
+// embedded as an XML file in the UN/CEFACT Cross Industry Invoice
+// format, and the document becomes a PDF/A-3 file that carries it:
+//
+//	"archive": {"level": "3b", "iccProfile": "sRGB.icc"},
+//	"eInvoice": {"profile": "en16931"}
+//
+// The XML needs a few details that the printed invoice can do without:
+// the ISO code of the currency, the country of the seller and, if tax is
+// charged, the seller's VAT ID, and the country of the buyer. Invoices
+// that lack them are rejected.
+
+// EInvoiceConfig embeds the invoice data as Factur-X XML.
+type EInvoiceConfig struct {
+	// Profile is the Factur-X profile, "basic" (default) or "en16931"
+	// ("comfort" in ZUGFeRD).
+	Profile string `json:"profile"`
+}
+
+// facturXFile is the name that Factur-X and ZUGFeRD 2.1 require for the
+// embedded XML.
+const facturXFile = "factur-x.xml"
+
+const facturXNamespace = "urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"
+
+// profile returns the guideline ID and the XMP conformance level of the
+// profile.
+func (ec *EInvoiceConfig) profile() (string, string, error) {
+	switch ec.Profile {
+	case "", "basic":
+		return "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic", "BASIC", nil
+	case "en16931":
+		return "urn:cen.eu:en16931:2017", "EN 16931", nil
+	}
+	return "", "", fmt.Errorf("unsupported profile %q; use basic or en16931", ec.Profile)
+}
+
+// prepare checks the profile and adds the Factur-X metadata to the
+// archive settings, which must select PDF/A-3.
+func (ec *EInvoiceConfig) prepare(ac *ArchiveConfig) error {
+	_, level, err := ec.profile()
+	if err != nil {
+		return err
+	}
+	if ac == nil || ac.Level != "3b" {
+		return errors.New(`e-invoices require archive level "3b"`)
+	}
+	ac.xmpExtension = facturXMP(level)
+	return nil
+}
+
+// facturXMP returns the XMP descriptions that Factur-X requires,
+// including the PDF/A extension schema that defines them.
+func facturXMP(level string) string {
+	property := func(name, description string) string {
+		return `<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>` + name + `</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>` + description + `</pdfaProperty:description>
+</rdf:li>
+`
+	}
+	return `<rdf:Description rdf:about="" xmlns:fx="` + facturXNamespace + `">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>` + facturXFile + `</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>` + level + `</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>` + facturXNamespace + `</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+` + property("DocumentFileName", "The name of the embedded XML document") +
+		property("DocumentType", "The type of the hybrid document in capital letters, e.g. INVOICE or ORDER") +
+		property("Version", "The actual version of the standard applying to the embedded XML document") +
+		property("ConformanceLevel", "The conformance level of the embedded XML document") + `</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+`
+}
+
+// check rejects invoices that lack what e-invoices require.
+func (ec *EInvoiceConfig) check(inv *Invoice) error {
+	var missing []string
+	if len(inv.CurrencyCode) != 3 {
+		missing = append(missing, "currencyCode")
+	}
+	if len(inv.From.Country) != 2 {
+		missing = append(missing, "from.country")
+	}
+	if inv.From.VATID == "" && inv.TaxRate > 0 {
+		missing = append(missing, "from.vatID")
+	}
+	if len(inv.BillTo.Country) != 2 {
+		missing = append(missing, "billTo.country")
+	}
+	for _, li := range inv.Items {
+		if li.TaxExempt && inv.TaxExemptReason == "" {
+			missing = append(missing, "taxExemptReason")
+			break
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("e-invoices require %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// file returns the Factur-X XML of inv, issued on date, as a file to be
+// embedded in the document.
+func (ec *EInvoiceConfig) file(inv *Invoice, mode roundingMode, date time.Time) (archiveFile, error) {
+	if err := ec.check(inv); err != nil {
+		return archiveFile{}, err
+	}
+	guideline, _, _ := ec.profile()
+	x := &xmlWriter{}
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	dateTime := func(name string, t time.Time) {
+		x.open(name)
+		x.elemAttr("udt:DateTimeString", "format", "102", t.Format("20060102"))
+		x.close(name)
+	}
+
+	x.buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100" xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100" xmlns:qdt="urn:un:unece:uncefact:data:standard:QualifiedDataType:100" xmlns:udt="urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100">
+`)
+	x.open("rsm:ExchangedDocumentContext")
+	x.open("ram:GuidelineSpecifiedDocumentContextParameter")
+	x.elem("ram:ID", guideline)
+	x.close("ram:GuidelineSpecifiedDocumentContextParameter")
+	x.close("rsm:ExchangedDocumentContext")
+
+	x.open("rsm:ExchangedDocument")
+	x.elem("ram:ID", inv.Number)
+	x.elem("ram:TypeCode", "380") // commercial invoice
+	dateTime("ram:IssueDateTime", date)
+	x.close("rsm:ExchangedDocument")
+
+	x.open("rsm:SupplyChainTradeTransaction")
+	category := func(li LineItem) string {
+		switch {
+		case li.TaxExempt:
+			return "E"
+		case inv.TaxRate == 0:
+			return "Z"
+		}
+		return "S"
+	}
+	for i, li := range inv.Items {
+		x.open("ram:IncludedSupplyChainTradeLineItem")
+		x.open("ram:AssociatedDocumentLineDocument")
+		x.elem("ram:LineID", strconv.Itoa(i+1))
+		x.close("ram:AssociatedDocumentLineDocument")
+		x.open("ram:SpecifiedTradeProduct")
+		x.elem("ram:Name", li.Description)
+		x.close("ram:SpecifiedTradeProduct")
+		x.open("ram:SpecifiedLineTradeAgreement")
+		x.open("ram:NetPriceProductTradePrice")
+		x.elem("ram:ChargeAmount", strconv.FormatFloat(li.UnitPrice, 'f', -1, 64))
+		x.close("ram:NetPriceProductTradePrice")
+		x.close("ram:SpecifiedLineTradeAgreement")
+		x.open("ram:SpecifiedLineTradeDelivery")
+		x.elemAttr("ram:BilledQuantity", "unitCode", orDefault(li.Unit, "C62"), strconv.FormatFloat(li.Quantity, 'f', -1, 64))
+		x.close("ram:SpecifiedLineTradeDelivery")
+		x.open("ram:SpecifiedLineTradeSettlement")
+		x.open("ram:ApplicableTradeTax")
+		x.elem("ram:TypeCode", "VAT")
+		x.elem("ram:CategoryCode", category(li))
+		if !li.TaxExempt {
+			x.elem("ram:RateApplicablePercent", strconv.FormatFloat(inv.TaxRate, 'f', -1, 64))
+		}
+		x.close("ram:ApplicableTradeTax")
+		x.open("ram:SpecifiedTradeSettlementLineMonetarySummation")
+		x.elem("ram:LineTotalAmount", amount(li.total(mode)))
+		x.close("ram:SpecifiedTradeSettlementLineMonetarySummation")
+		x.close("ram:SpecifiedLineTradeSettlement")
+		x.close("ram:IncludedSupplyChainTradeLineItem")
+	}
+
+	x.open("ram:ApplicableHeaderTradeAgreement")
+	x.party("ram:SellerTradeParty", inv.From)
+	x.party("ram:BuyerTradeParty", inv.BillTo)
+	x.close("ram:ApplicableHeaderTradeAgreement")
+	x.open("ram:ApplicableHeaderTradeDelivery")
+	if inv.ShipTo != nil {
+		x.party("ram:ShipToTradeParty", *inv.ShipTo)
+	}
+	x.close("ram:ApplicableHeaderTradeDelivery")
+
+	x.open("ram:ApplicableHeaderTradeSettlement")
+	x.elem("ram:InvoiceCurrencyCode", inv.CurrencyCode)
+
+	// One tax breakdown per category, in the order of first use.
+	subtotal, tax, total := inv.totals(mode)
+	var categories []string
+	basis := map[string]*decimalSum{}
+	for _, li := range inv.Items {
+		c := category(li)
+		if basis[c] == nil {
+			basis[c] = &decimalSum{}
+			categories = append(categories, c)
+		}
+		basis[c].addFloat(li.total(mode))
+	}
+	for _, c := range categories {
+		x.open("ram:ApplicableTradeTax")
+		calculated := 0.0
+		if c == "S" {
+			calculated = tax
+		}
+		x.elem("ram:CalculatedAmount", amount(calculated))
+		x.elem("ram:TypeCode", "VAT")
+		if c == "E" {
+			x.elem("ram:ExemptionReason", inv.TaxExemptReason)
+		}
+		x.elem("ram:BasisAmount", amount(mode.float(&basis[c].sum, 2)))
+		x.elem("ram:CategoryCode", c)
+		rate := inv.TaxRate
+		if c == "E" {
+			rate = 0
+		}
+		x.elem("ram:RateApplicablePercent", strconv.FormatFloat(rate, 'f', -1, 64))
+		x.close("ram:ApplicableTradeTax")
+	}
+	if inv.Terms != "" || inv.DueDate != "" {
+		x.open("ram:SpecifiedTradePaymentTerms")
+		if inv.Terms != "" {
+			x.elem("ram:Description", inv.Terms)
+		}
+		if inv.DueDate != "" {
+			due, _ := time.Parse("2006-01-02", inv.DueDate)
+			dateTime("ram:DueDateDateTime", due)
+		}
+		x.close("ram:SpecifiedTradePaymentTerms")
+	}
+	x.open("ram:SpecifiedTradeSettlementHeaderMonetarySummation")
+	x.elem("ram:LineTotalAmount", amount(subtotal))
+	x.elem("ram:TaxBasisTotalAmount", amount(subtotal))
+	x.elemAttr("ram:TaxTotalAmount", "currencyID", inv.CurrencyCode, amount(tax))
+	x.elem("ram:GrandTotalAmount", amount(total))
+	x.elem("ram:DuePayableAmount", amount(total))
+	x.close("ram:SpecifiedTradeSettlementHeaderMonetarySummation")
+	x.close("ram:ApplicableHeaderTradeSettlement")
+	x.close("rsm:SupplyChainTradeTransaction")
+	x.buf.WriteString("</rsm:CrossIndustryInvoice>\n")
+
+	return archiveFile{
+		name:         facturXFile,
+		description:  "Factur-X invoice",
+		mimeType:     "text/xml",
+		relationship: "Data",
+		data:         x.buf.Bytes(),
+		modified:     date,
+	}, nil
+}
+
+// xmlWriter writes indented XML elements.
+type xmlWriter struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+func (x *xmlWriter) indent() {
+	x.buf.WriteString(strings.Repeat("  ", x.depth+1))
+}
+
+func (x *xmlWriter) open(name string) {
+	x.indent()
+	x.buf.WriteString("<" + name + ">\n")
+	x.depth++
+}
+
+func (x *xmlWriter) close(name string) {
+	x.depth--
+	x.indent()
+	x.buf.WriteString("</" + name + ">\n")
+}
+
+func (x *xmlWriter) elem(name, text string) {
+	x.indent()
+	x.buf.WriteString("<" + name + ">")
+	xml.EscapeText(&x.buf, []byte(text))
+	x.buf.WriteString("</" + name + ">\n")
+}
+
+func (x *xmlWriter) elemAttr(name, attr, value, text string) {
+	x.indent()
+	x.buf.WriteString("<" + name + " " + attr + `="`)
+	xml.EscapeText(&x.buf, []byte(value))
+	x.buf.WriteString(`">`)
+	xml.EscapeText(&x.buf, []byte(text))
+	x.buf.WriteString("</" + name + ">\n")
+}
+
+// party writes a trade party with its address and VAT ID. The first
+// three address lines become the street lines.
+func (x *xmlWriter) party(name string, a Address) {
+	x.open(name)
+	x.elem("ram:Name", a.Name)
+	x.open("ram:PostalTradeAddress")
+	if a.PostCode != "" {
+		x.elem("ram:PostcodeCode", a.PostCode)
+	}
+	for i, line := range a.Lines {
+		if i < 3 {
+			x.elem("ram:Line"+[]string{"One", "Two", "Three"}[i], line)
+		}
+	}
+	if a.City != "" {
+		x.elem("ram:CityName", a.City)
+	}
+	x.elem("ram:CountryID", a.Country)
+	x.close("ram:PostalTradeAddress")
+	if a.VATID != "" {
+		x.open("ram:SpecifiedTaxRegistration")
+		x.elemAttr("ram:ID", "schemeID", "VA", a.VATID)
+		x.close("ram:SpecifiedTaxRegistration")
+	}
+	x.close(name)
+}
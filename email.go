@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ## Email delivery
+
+// The boss wants the report in her inbox, not in some directory. After
+// generation, the PDF can be mailed to a list of recipients. In split
+// mode, each report can go to the address found in a column of its rows.
+
+// DeliveryConfig lists where finished reports are sent.
+type DeliveryConfig struct {
+	Email *EmailConfig `json:"email"`
+
+	// Targets are further destinations; see Deliverer.
+	Targets []DeliveryTarget `json:"targets"`
+
+	// Digest sends a single summary of all reports of a split or merge
+	// run.
+	Digest *DigestConfig `json:"digest"`
+
+	// SkipUnchanged suppresses the upload and delivery of reports that
+	// are identical to the last delivered version.
+	SkipUnchanged *SkipUnchangedConfig `json:"skipUnchanged"`
+
+	artifactKey []byte // encrypts the state file; see Config.ArtifactKey
+}
+
+// SMTPConfig describes the mail server and the sender.
+type SMTPConfig struct {
+	Host string `json:"host"`
+	Port int    `json:"port"` // default: 587
+
+	// Username and Password enable PLAIN authentication. Both may
+	// reference environment variables as $NAME or ${NAME}.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	From string `json:"from"`
+}
+
+// EmailConfig describes SMTP delivery.
+type EmailConfig struct {
+	SMTPConfig
+
+	To []string `json:"to"`
+
+	// RecipientColumn, in split mode, holds the recipient address(es)
+	// of each report. Those are used instead of To.
+	RecipientColumn *ColumnRef `json:"recipientColumn"`
+
+	// Subject and Body are text/templates. They can use {{.File}}
+	// (the file name of the report), {{.Value}} (the split value),
+	// {{.Rows}} (the number of rows), and {{.Date}}.
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// mailData is the template data for Subject and Body.
+type mailData struct {
+	File  string
+	Value string
+	Rows  int
+	Date  string
+}
+
+// deliver sends the finished report of part p.
+func (d *DeliveryConfig) deliver(env *Env, p *part) error {
+	if d.Email != nil {
+		if err := d.Email.send(env, p); err != nil {
+			return fmt.Errorf("email delivery: %w", err)
+		}
+	}
+	if len(d.Targets) > 0 {
+		r := deliveryReport(env, p)
+		for _, t := range d.Targets {
+			if err := t.deliverer.Deliver(env, r); err != nil {
+				return fmt.Errorf("%s delivery: %w", t.Type, err)
+			}
+		}
+	}
+	return d.delivered(env, p)
+}
+
+// recipients returns the addresses for part p.
+func (ec *EmailConfig) recipients(p *part) []string {
+	if p.to != nil {
+		return p.to
+	}
+	if ec.RecipientColumn == nil {
+		return ec.To
+	}
+	seen := map[string]bool{}
+	var to []string
+	for _, line := range p.rows {
+		if ec.RecipientColumn.Index >= len(line) {
+			continue
+		}
+		for _, addr := range splitAddresses(line[ec.RecipientColumn.Index]) {
+			if !seen[addr] {
+				seen[addr] = true
+				to = append(to, addr)
+			}
+		}
+	}
+	return to
+}
+
+// splitAddresses returns the email addresses in s, separated by commas
+// or semicolons.
+func splitAddresses(s string) []string {
+	var addrs []string
+	for _, addr := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// send mails the report of part p as an attachment.
+func (ec *EmailConfig) send(env *Env, p *part) error {
+	to := ec.recipients(p)
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients for %s", p.output)
+	}
+	data := mailData{
+		File:  filepath.Base(p.output),
+		Value: p.value,
+		Rows:  len(p.rows),
+		Date:  env.Clock.Now().Format("Mon Jan 2, 2006"),
+	}
+	subject, err := execTemplate("subject", orDefault(ec.Subject, "Report {{.File}}"), data)
+	if err != nil {
+		return err
+	}
+	body, err := execTemplate("body", orDefault(ec.Body, "Please find the report {{.File}} attached."), data)
+	if err != nil {
+		return err
+	}
+	msg, err := mailMessage(ec.From, to, subject, body, data.File, p.pdf, env.Clock.Now())
+	if err != nil {
+		return err
+	}
+	return ec.sendMail(to, msg)
+}
+
+// sendMail sends msg through the mail server.
+func (sc SMTPConfig) sendMail(to []string, msg []byte) error {
+	port := sc.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if sc.Username != "" {
+		auth = smtp.PlainAuth("", os.ExpandEnv(sc.Username), os.ExpandEnv(sc.Password), sc.Host)
+	}
+	return smtp.SendMail(sc.Host+":"+strconv.Itoa(port), auth, sc.From, to, msg)
+}
+
+// mailMessage builds a MIME message with a text body and a PDF
+// attachment. Without a file name, the message has no attachment.
+func mailMessage(from string, to []string, subject, body, fileName string, pdf []byte, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	tw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(tw)
+	qp.Write([]byte(body))
+	qp.Close()
+	if fileName == "" {
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	aw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("application/pdf", map[string]string{"name": fileName})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": fileName})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding.EncodeToString(pdf)
+	for len(enc) > 76 {
+		aw.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	aw.Write([]byte(enc + "\r\n"))
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// execTemplate parses and executes a text/template with the template
+// functions.
+func execTemplate(name, text string, data interface{}) (string, error) {
+	return execTemplateFuncs(name, text, data, templateFuncs())
+}
+
+// execTemplateFuncs is like execTemplate but with the given functions.
+func execTemplateFuncs(name, text string, data interface{}, funcs template.FuncMap) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sentMail is a message received by smtpServer.
+type sentMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer accepts mail on a local port and records it.
+type smtpServer struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	mail []sentMail
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// port returns the port the server listens on.
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// sent returns the received mail, sorted by recipients.
+func (s *smtpServer) sent() []sentMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mail := append([]sentMail{}, s.mail...)
+	sort.Slice(mail, func(i, j int) bool { return strings.Join(mail[i].to, ",") < strings.Join(mail[j].to, ",") })
+	return mail
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	var m sentMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			m = sentMail{from: strings.Trim(line[strings.Index(line, ":")+1:], "<> ")}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.Trim(line[strings.Index(line, ":")+1:], "<> "))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			s.mu.Lock()
+			s.mail = append(s.mail, m)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// attachment returns the subject of a message and its attached file.
+func attachment(t *testing.T, data string) (subject, name string, file []byte) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return subject, "", nil
+		}
+		if part.FileName() != "" {
+			b, _ := ioutil.ReadAll(part)
+			file, err := base64.StdEncoding.DecodeString(strings.Replace(string(b), "\r\n", "", -1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return subject, part.FileName(), file
+		}
+	}
+}
+
+func TestEmailDelivery(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+	env := testEnv(map[string]string{
+		"in.csv": "Region,Total,Manager\nNorth,1,ann@example.com\nSouth,2,bob@example.com; cy@example.com\nNorth,3,ann@example.com\n",
+		"cfg.json": `{"split": {"column": "Region"}, "delivery": {"email": {
+			"host": "127.0.0.1", "port": ` + strconv.Itoa(srv.port()) + `, "from": "reports@example.com",
+			"recipientColumn": "Manager", "subject": "Sales {{.Value}} ({{.Rows}}) – {{.Date}}"}}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "sales.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	sent := srv.sent()
+	if len(sent) != 2 {
+		t.Fatalf("%d messages sent, want 2", len(sent))
+	}
+	for i, want := range []struct {
+		to      []string
+		subject string
+		file    string
+	}{
+		{[]string{"ann@example.com"}, "Sales North (2) – Fri Mar 15, 2024", "sales-North.pdf"},
+		{[]string{"bob@example.com", "cy@example.com"}, "Sales South (1) – Fri Mar 15, 2024", "sales-South.pdf"},
+	} {
+		m := sent[i]
+		if m.from != "reports@example.com" || strings.Join(m.to, ",") != strings.Join(want.to, ",") {
+			t.Errorf("message %d from %s to %q, want to %q", i, m.from, m.to, want.to)
+		}
+		subject, name, file := attachment(t, m.data)
+		if subject != want.subject || name != want.file {
+			t.Errorf("message %d: subject %q with %q, want %q with %q", i, subject, name, want.subject, want.file)
+		}
+		if string(file) != testFile(t, env, want.file) {
+			t.Errorf("message %d: the attachment differs from %s", i, want.file)
+		}
+	}
+}
+
+func TestEmailWithoutRecipients(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+	env := testEnv(map[string]string{
+		"in.csv": "Region,Total,Manager\nNorth,1,ann@example.com\nSouth,2, ; \n",
+		"cfg.json": `{"split": {"column": "Region"}, "delivery": {"email": {
+			"host": "127.0.0.1", "port": ` + strconv.Itoa(srv.port()) + `, "from": "reports@example.com",
+			"recipientColumn": "Manager"}}}`,
+	})
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "sales.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "email delivery: no recipients for sales-South.pdf") {
+		t.Errorf("generate = %v, want an error for the South report", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ## Reports without data
+
+// On a holiday, the daily export is empty, and a table of column names
+// without a single row leaves readers wondering whether the report is
+// broken. A report without rows says so instead, on a page that has the
+// title, the date, and a message in place of the table:
+//
+//	"empty": {"policy": "page", "message": "No orders were placed today."}
+//
+// The policy "skip" writes and delivers no report at all, and "fail"
+// fails the run with exit code 2, for jobs that must never see an empty
+// export. Personalized reports follow the policy for every recipient
+// without rows. Split reports have no empty parts, so empty data gives
+// no reports at all, unless the policy is "fail".
+
+// EmptyConfig says what to do with a report without rows.
+type EmptyConfig struct {
+	// Policy is "page" (default), "skip", or "fail".
+	Policy string `json:"policy"`
+
+	// Message replaces the table. Default: "No data for this period."
+	Message string `json:"message"`
+}
+
+func (ec *EmptyConfig) prepare() error {
+	switch ec.Policy {
+	case "", "page", "skip", "fail":
+		return nil
+	}
+	return fmt.Errorf("unknown policy %q; use page, skip, or fail", ec.Policy)
+}
+
+// policy returns the policy, which is "page" if ec is nil.
+func (ec *EmptyConfig) policy() string {
+	if ec == nil || ec.Policy == "" {
+		return "page"
+	}
+	return ec.Policy
+}
+
+// noDataMessage returns the message for a report without rows.
+func noDataMessage(cfg *Config) string {
+	if cfg.Empty != nil && cfg.Empty.Message != "" {
+		return cfg.Empty.Message
+	}
+	return cfg.locale().msg("noData")
+}
+
+// noData prints the message in place of the table: in a gray box that
+// fills the rest of the page.
+func noData(pdf *Fpdf, cfg *Config) *Fpdf {
+	msg := cfg.locale().print(noDataMessage(cfg))
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	w := pageWidth - left - right
+	pdf.Ln(20)
+	y := pdf.GetY()
+	h := spaceLeft(pdf)
+	pdf.SetFillColor(245, 245, 245)
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.RoundedRect(left, y, w, h, 4, "1234", "FD")
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetFont("Times", "I", 20)
+	pdf.SetTextColor(110, 110, 110)
+	lines := pdf.SplitText(msg, w-20)
+	lh := 10.0
+	top := y + (h-float64(len(lines))*lh)/2
+	for n, l := range lines {
+		pdf.SetXY(left+10, top+float64(n)*lh)
+		pdf.CellFormat(w-20, lh, l, "", 0, "C", false, 0, "")
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetXY(left, y+h)
+	return pdf
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmptyPolicy(t *testing.T) {
+	tests := []struct {
+		empty string
+		want  string // in the report, or in the error
+		code  int
+	}{
+		{``, "(No data for this period.)", 0},
+		{`"empty": {"policy": "page", "message": "No orders were placed today."},`, "(No orders were placed today.)", 0},
+		{`"empty": {"policy": "skip"},`, "", 0},
+		{`"empty": {"policy": "fail"},`, "no data in 'in.csv'", exitInvalid},
+		{`"empty": {"policy": "ignore"},`, `unknown policy "ignore"; use page, skip, or fail`, exitFailed},
+	}
+	for _, tt := range tests {
+		// Both rows are filtered out.
+		env := testEnv(map[string]string{"in.csv": "Region,Total\nNorth,1\nSouth,2\n", "cfg.json": `{` + tt.empty + `"messages": {"title": "Orders"}}`})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Filter: "Total > 5"})
+		if exitCode(err) != tt.code || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: %v, want exit code %d", tt.empty, err, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		f, err := env.FS.Open("out.pdf")
+		if tt.want == "" {
+			if err == nil {
+				f.Close()
+				t.Errorf("%s: a report was written", tt.empty)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+		if !strings.Contains(content, tt.want) || !strings.Contains(content, "(Orders)") || strings.Contains(content, "(Region)") {
+			t.Errorf("%s: the report lacks %q or the title, or has a table", tt.empty, tt.want)
+		}
+	}
+}
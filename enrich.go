@@ -0,0 +1,342 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ## Enrichment
+
+// The export has the customer ID; the reader wants to see the account
+// manager. Enrichment adds columns to the input, looked up by the value
+// of a key column:
+//
+//	"enrich": [
+//	  {"key": "Customer ID", "columns": ["Account Manager", "Region"],
+//	   "provider": "file", "settings": {"path": "customers.csv"}},
+//	  {"key": "Zip", "columns": ["City"],
+//	   "provider": "http", "settings": {"url": "https://geo.example.com/zip/{key}", "paths": {"City": "place.name"}}},
+//	  {"key": "SKU", "columns": ["Stock"],
+//	   "provider": "sql", "settings": {"driver": "postgres", "dsn": "...",
+//	     "query": "SELECT stock FROM inventory WHERE sku = $1"}}]
+//
+// The added columns follow the input columns, in the order of the
+// enrichment steps, and come before computed columns. The rest of the
+// configuration refers to them like to any other column; a step can use
+// the columns of the steps before it as its key. Keys that a provider
+// does not know leave the added cells empty.
+//
+// Like delivery targets, providers are pluggable. Each distinct key is
+// looked up once per run:
+//
+//	func init() {
+//		RegisterLookupProvider("ldap", func(settings json.RawMessage) (LookupProvider, error) {
+//			var p ldapProvider
+//			return &p, DecodeSettings(settings, &p)
+//		})
+//	}
+
+// LookupProvider looks up the values of columns by key.
+type LookupProvider interface {
+	// Lookup returns the values of the columns, in order, for the keys
+	// it knows.
+	Lookup(env *Env, keys []string, columns []string) (map[string][]string, error)
+}
+
+// LookupProviderFactory creates a LookupProvider from its settings.
+type LookupProviderFactory func(settings json.RawMessage) (LookupProvider, error)
+
+// lookupProviders holds the providers by name.
+var lookupProviders = map[string]LookupProviderFactory{}
+
+// RegisterLookupProvider adds a provider. It panics if the name is
+// taken.
+func RegisterLookupProvider(name string, f LookupProviderFactory) {
+	if _, ok := lookupProviders[name]; ok {
+		panic(fmt.Sprintf("lookup provider %q registered twice", name))
+	}
+	lookupProviders[name] = f
+}
+
+func init() {
+	RegisterLookupProvider("file", func(settings json.RawMessage) (LookupProvider, error) {
+		var fp fileLookup
+		if err := DecodeSettings(settings, &fp); err != nil {
+			return nil, err
+		}
+		if fp.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		return &fp, nil
+	})
+	RegisterLookupProvider("http", func(settings json.RawMessage) (LookupProvider, error) {
+		var hp httpLookup
+		if err := DecodeSettings(settings, &hp); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(hp.URL, "{key}") {
+			return nil, fmt.Errorf("url %q lacks {key}", hp.URL)
+		}
+		return &hp, nil
+	})
+	RegisterLookupProvider("sql", func(settings json.RawMessage) (LookupProvider, error) {
+		var sp sqlLookup
+		if err := DecodeSettings(settings, &sp); err != nil {
+			return nil, err
+		}
+		if sp.Driver == "" || sp.Query == "" {
+			return nil, fmt.Errorf("driver and query are required")
+		}
+		return &sp, nil
+	})
+}
+
+// EnrichConfig is an enrichment step.
+type EnrichConfig struct {
+	// Key is the column whose values are looked up.
+	Key ColumnRef `json:"key"`
+
+	// Columns are the names of the added columns.
+	Columns []string `json:"columns"`
+
+	// Provider is "file", "http", "sql", or a registered provider, with
+	// its settings.
+	Provider string          `json:"provider"`
+	Settings json.RawMessage `json:"settings"`
+
+	provider LookupProvider
+}
+
+func (ec *EnrichConfig) prepare() error {
+	if len(ec.Columns) == 0 {
+		return fmt.Errorf("no columns to add")
+	}
+	f, ok := lookupProviders[ec.Provider]
+	if !ok {
+		var names []string
+		for name := range lookupProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown provider %q; use one of %s", ec.Provider, strings.Join(names, ", "))
+	}
+	var err error
+	ec.provider, err = f(ec.Settings)
+	return err
+}
+
+// enrich runs the enrichment steps and returns hdr and rows with the
+// added columns.
+func (c *Config) enrich(env *Env, hdr []string, rows [][]string) ([]string, [][]string, error) {
+	for i := range c.Enrich {
+		ec := &c.Enrich[i]
+		if err := ec.Key.resolve(hdr); err != nil {
+			return nil, nil, fmt.Errorf("key: %s", err)
+		}
+		for _, name := range ec.Columns {
+			if indexOf(hdr, name) >= 0 {
+				return nil, nil, fmt.Errorf("column %q exists already", name)
+			}
+		}
+		seen := map[string]bool{}
+		var keys []string
+		for _, line := range rows {
+			if k := cellAt(line, ec.Key.Index); k != "" && !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+		found, err := ec.provider.Lookup(env, keys, ec.Columns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", ec.Provider, err)
+		}
+		env.Log.Debug("rows enriched", "provider", ec.Provider, "keys", len(keys), "found", len(found))
+
+		n := len(hdr)
+		out := make([][]string, len(rows))
+		for r, line := range rows {
+			out[r] = make([]string, n, n+len(ec.Columns))
+			copy(out[r], line)
+			values := found[cellAt(line, ec.Key.Index)]
+			for k := range ec.Columns {
+				out[r] = append(out[r], cellAt(values, k))
+			}
+		}
+		hdr, rows = append(append([]string{}, hdr...), ec.Columns...), out
+	}
+	return hdr, rows, nil
+}
+
+// fileLookup looks keys up in a CSV or JSON file.
+type fileLookup struct {
+	// Path is a CSV file with a header row, or a JSON object that maps
+	// keys to objects of column values.
+	Path string `json:"path"`
+
+	// Key is the key column of a CSV file. Default: the first column.
+	Key string `json:"key"`
+
+	Dialect csvDialect `json:"dialect"`
+}
+
+func (fp *fileLookup) Lookup(env *Env, keys []string, columns []string) (map[string][]string, error) {
+	found := map[string][]string{}
+	if strings.EqualFold(filepath.Ext(fp.Path), ".json") {
+		data, err := readFile(env.FS, fp.Path)
+		if err != nil {
+			return nil, err
+		}
+		var table map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &table); err != nil {
+			return nil, fmt.Errorf("%s: %w", fp.Path, err)
+		}
+		for k, obj := range table {
+			values := make([]string, len(columns))
+			for i, col := range columns {
+				values[i] = jsonString(obj[col])
+			}
+			found[k] = values
+		}
+		return found, nil
+	}
+
+	records, err := loadCSV(env.FS, fp.Path, fp.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return found, nil
+	}
+	hdr := records[0]
+	key := 0
+	if fp.Key != "" {
+		if key = indexOf(hdr, fp.Key); key < 0 {
+			return nil, fmt.Errorf("%s: column %q not found", fp.Path, fp.Key)
+		}
+	}
+	cols := make([]int, len(columns))
+	for i, col := range columns {
+		if cols[i] = indexOf(hdr, col); cols[i] < 0 {
+			return nil, fmt.Errorf("%s: column %q not found", fp.Path, col)
+		}
+	}
+	for _, line := range records[1:] {
+		values := make([]string, len(cols))
+		for i, c := range cols {
+			values[i] = cellAt(line, c)
+		}
+		found[cellAt(line, key)] = values
+	}
+	return found, nil
+}
+
+// httpLookup looks each key up in a JSON API. A response of 404 Not
+// Found means the key is unknown.
+type httpLookup struct {
+	// URL is the address of a key; {key} is replaced with the escaped
+	// key.
+	URL string `json:"url"`
+
+	// Headers are sent with every request. Values may reference
+	// environment variables as $NAME or ${NAME}.
+	Headers map[string]string `json:"headers"`
+
+	// Paths lead from the response to the values of the columns, as in
+	// RESTSource. Default: the name of the column.
+	Paths map[string]string `json:"paths"`
+}
+
+func (hp *httpLookup) Lookup(env *Env, keys []string, columns []string) (map[string][]string, error) {
+	found := map[string][]string{}
+	for _, key := range keys {
+		u := strings.Replace(hp.URL, "{key}", url.PathEscape(key), -1)
+		req, err := http.NewRequestWithContext(env.context(), "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		for k, v := range hp.Headers {
+			req.Header.Set(k, os.ExpandEnv(v))
+		}
+		resp, err := restClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		dec := json.NewDecoder(resp.Body)
+		dec.UseNumber()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = dec.Decode(&v)
+		case http.StatusNotFound:
+			resp.Body.Close()
+			continue
+		default:
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %s", u, err)
+		}
+		values := make([]string, len(columns))
+		for i, col := range columns {
+			if node, ok := jsonLookup(v, orDefault(hp.Paths[col], col)); ok {
+				values[i] = jsonString(node)
+			}
+		}
+		found[key] = values
+	}
+	return found, nil
+}
+
+// sqlLookup runs a query per key. The query has the key as its only
+// parameter and returns the values of the columns, in order. Keys
+// without a result row are unknown.
+type sqlLookup struct {
+	// Driver is "postgres", "mysql", or "sqlite3".
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	Query  string `json:"query"`
+}
+
+func (sp *sqlLookup) Lookup(env *Env, keys []string, columns []string) (map[string][]string, error) {
+	db, err := sql.Open(sp.Driver, sp.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	stmt, err := db.Prepare(sp.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	found := map[string][]string{}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for _, key := range keys {
+		err := stmt.QueryRowContext(env.context(), key).Scan(ptrs...)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := make([]string, len(columns))
+		for i, v := range values {
+			record[i] = sqlString(v)
+		}
+		found[key] = record
+	}
+	return found, nil
+}
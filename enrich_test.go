@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEnrichConfig(t *testing.T) {
+	tests := []struct {
+		cfg string
+		err string
+	}{
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "file", "settings": {"path": "ids.csv"}}]}`, ""},
+		{`{"enrich": [{"key": "ID", "provider": "file", "settings": {"path": "ids.csv"}}]}`, "enrich: file: no columns to add"},
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "ldap"}]}`, `enrich: ldap: unknown provider "ldap"; use one of file, http, sql`},
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "file", "settings": {}}]}`, "enrich: file: path is required"},
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "file", "settings": {"path": "ids.csv", "color": "red"}}]}`, "enrich: file: "},
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "http", "settings": {"url": "https://example.com/ids"}}]}`, `enrich: http: url "https://example.com/ids" lacks {key}`},
+		{`{"enrich": [{"key": "ID", "columns": ["Name"], "provider": "sql", "settings": {"driver": "postgres"}}]}`, "enrich: sql: driver and query are required"},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(NewMemFS(map[string][]byte{"cfg.json": []byte(tt.cfg)}), "cfg.json")
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.cfg, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.cfg, err, tt.err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a provider was registered twice")
+		}
+	}()
+	RegisterLookupProvider("file", nil)
+}
+
+func TestEnrich(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/zip/10115":
+			fmt.Fprint(w, `{"place": {"name": "Berlin"}}`)
+		case "/zip/80331":
+			fmt.Fprint(w, `{"place": {"name": "München"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// The second step looks up the zip code that the first one adds.
+	fsys := NewMemFS(map[string][]byte{
+		"customers.csv": []byte("Customer,Manager,Zip\nC1,Ann,10115\nC2,Bob,80331\nC3,Cy,99999\n"),
+		"cfg.json": []byte(`{"enrich": [
+			{"key": "Customer ID", "columns": ["Manager", "Zip"], "provider": "file", "settings": {"path": "customers.csv"}},
+			{"key": "Zip", "columns": ["City"], "provider": "http",
+			 "settings": {"url": "` + srv.URL + `/zip/{key}", "paths": {"City": "place.name"}}}]}`),
+	})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &Env{FS: fsys}
+	hdr, rows, err := cfg.enrich(env, []string{"Customer ID", "Total"}, [][]string{{"C1", "1"}, {"C2", "2"}, {"C1", "3"}, {"C3", "4"}, {"C9", "5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Customer ID", "Total", "Manager", "Zip", "City"}; !reflect.DeepEqual(hdr, want) {
+		t.Errorf("header %q, want %q", hdr, want)
+	}
+	want := [][]string{
+		{"C1", "1", "Ann", "10115", "Berlin"},
+		{"C2", "2", "Bob", "80331", "München"},
+		{"C1", "3", "Ann", "10115", "Berlin"},
+		{"C3", "4", "Cy", "99999", ""},
+		{"C9", "5", "", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+	// Each distinct key is looked up once; unknown customers have no
+	// zip code to look up.
+	if want := map[string]int{"/zip/10115": 1, "/zip/80331": 1, "/zip/99999": 1}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests %v, want %v", requests, want)
+	}
+}
+
+func TestEnrichErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	fsys := NewMemFS(map[string][]byte{
+		"customers.csv":  []byte("Customer,Manager\nC1,Ann\n"),
+		"customers.json": []byte(`{"C1": {"Manager": "Ann", "Since": 2019}}`),
+	})
+	tests := []struct {
+		step string
+		err  string
+	}{
+		{`{"key": "Customer ID", "columns": ["Manager"], "provider": "file", "settings": {"path": "customers.json"}}`, ""},
+		{`{"key": "Customer", "columns": ["Manager"], "provider": "file", "settings": {"path": "customers.csv"}}`, "key: "},
+		{`{"key": "Customer ID", "columns": ["Total"], "provider": "file", "settings": {"path": "customers.csv"}}`, `column "Total" exists already`},
+		{`{"key": "Customer ID", "columns": ["Region"], "provider": "file", "settings": {"path": "customers.csv"}}`, `file: customers.csv: column "Region" not found`},
+		{`{"key": "Customer ID", "columns": ["Manager"], "provider": "file", "settings": {"path": "customers.csv", "key": "ID"}}`, `file: customers.csv: column "ID" not found`},
+		{`{"key": "Customer ID", "columns": ["Manager"], "provider": "file", "settings": {"path": "missing.csv"}}`, "file: "},
+		{`{"key": "Customer ID", "columns": ["Manager"], "provider": "http", "settings": {"url": "` + srv.URL + `/{key}"}}`, "http: GET " + srv.URL + "/C1: 503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		fsys.files["cfg.json"] = []byte(`{"enrich": [` + tt.step + `]}`)
+		cfg, err := loadConfig(fsys, "cfg.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rows, err := cfg.enrich(&Env{FS: fsys}, []string{"Customer ID", "Total"}, [][]string{{"C1", "1"}})
+		if tt.err == "" {
+			if err != nil || !reflect.DeepEqual(rows, [][]string{{"C1", "1", "Ann"}}) {
+				t.Errorf("%s: got %q, %v", tt.step, rows, err)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.step, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ## The outside world
+
+// The report depends on the current time and on files. Both are reached
+// through an Env, so that a test can fix the date and serve inputs from
+// memory instead of patching globals. The pdf command is a program, not
+// a library: Env and the hooks serve the files of this package, such as
+// the tests and the extensions that a build of the program adds.
+type Env struct {
+	Clock Clock
+	FS    FileSystem
+
+	// Stdout receives output meant for the user, such as the result of
+	// a dry run.
+	Stdout io.Writer
+
+	// Log receives log events; nil discards them.
+	Log *Logger
+
+	// Progress, if not nil, is called while reports are rendered.
+	Progress func(ProgressEvent)
+
+	// Hooks, if not nil, decorate the reports as they are rendered.
+	Hooks *RenderHooks
+
+	// Rasterize, if not nil, renders the pages of a document as images
+	// of the given width and format, at most pages of them if pages is
+	// not 0. It replaces the converter of PreviewConfig.
+	Rasterize func(pdf []byte, width, pages int, format string) ([][]byte, error)
+
+	// MaxMemory is the memory budget in bytes; 0 means none. See
+	// setMemoryBudget.
+	MaxMemory int64
+
+	// Resources, if not nil, keeps the fonts and images that documents
+	// share in memory; see ResourceCache.
+	Resources *ResourceCache
+
+	// ctx is the context of the running job; see GenerateContext.
+	ctx context.Context
+}
+
+// defaultEnv uses the system clock, the operating system's files,
+// standard output, and logs to standard error, and caches resources.
+func defaultEnv() *Env {
+	log, _ := NewLogger(os.Stderr, "", "")
+	return &Env{Clock: ClockFunc(time.Now), FS: osFileSystem{}, Stdout: os.Stdout, Log: log, Resources: NewResourceCache()}
+}
+
+// Clock tells the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc turns a function into a Clock.
+type ClockFunc func() time.Time
+
+// Now calls f.
+func (f ClockFunc) Now() time.Time { return f() }
+
+// FixedClock returns a Clock that always reports t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// FileSystem opens input files and creates, finds, renames, and removes
+// output files.
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	Glob(pattern string) ([]string, error)
+}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error)    { return os.Open(name) }
+func (osFileSystem) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+func (osFileSystem) Rename(oldname, newname string) error       { return os.Rename(oldname, newname) }
+func (osFileSystem) Remove(name string) error                   { return os.Remove(name) }
+func (osFileSystem) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+
+// MemFS is an in-memory FileSystem. Files written through Create become
+// visible when they are closed.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemFS returns a MemFS that contains the given files.
+func NewMemFS(files map[string][]byte) *MemFS {
+	m := &MemFS{files: map[string][]byte{}}
+	for name, data := range files {
+		m.files[name] = data
+	}
+	return m
+}
+
+// Open returns the contents of the named file.
+func (m *MemFS) Open(name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// Create returns a writer for the named file.
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	return &memFile{fs: m, name: name}, nil
+}
+
+// Rename moves a file to a new name, replacing any file of that name.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = data
+	return nil
+}
+
+// Remove deletes the named file.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Glob returns the names of all files matching pattern, sorted.
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.files {
+		ok, err := filepath.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// File returns the contents of the named file and whether it exists.
+func (m *MemFS) File(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	return data, ok
+}
+
+type memFile struct {
+	bytes.Buffer
+	fs   *MemFS
+	name string
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.files[f.name] = f.Bytes()
+	return nil
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ## Row filters
+
+// A filter expression selects rows by their values:
+//
+//	Region = "North"
+//	Region in ("North", "East") and Total >= 1000
+//	not (Status = "cancelled" or [Order Item] = "Sample")
+//
+// Comparisons are = != < <= > >= and in. Values that are both numbers
+// are compared as numbers, all others as text, in the root order of collate. Column names that are not
+// identifiers go in brackets, as in computed columns; text goes in
+// double quotes.
+
+// filterNode is a node of a parsed filter expression.
+type filterNode interface {
+	match(line []string) bool
+}
+
+// operand is a column, or a literal value if col is negative.
+type operand struct {
+	col     int
+	literal string
+}
+
+func (o operand) value(line []string) string {
+	if o.col < 0 {
+		return o.literal
+	}
+	return strings.TrimSpace(cellAt(line, o.col))
+}
+
+type compareNode struct {
+	op   string
+	l, r operand
+}
+
+func (n compareNode) match(line []string) bool {
+	c := compareValues(n.l.value(line), n.r.value(line), nil)
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compareValues compares a and b as numbers if both are numbers, or
+// else as text in the order of loc; filters pass nil for the root
+// order.
+func compareValues(a, b string, loc *locale) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return loc.collate(a, b)
+}
+
+type inNode struct {
+	l    operand
+	list []operand
+}
+
+func (n inNode) match(line []string) bool {
+	v := n.l.value(line)
+	for _, o := range n.list {
+		if compareValues(v, o.value(line), nil) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type logicNode struct {
+	and  bool
+	l, r filterNode
+}
+
+func (n logicNode) match(line []string) bool {
+	if n.and {
+		return n.l.match(line) && n.r.match(line)
+	}
+	return n.l.match(line) || n.r.match(line)
+}
+
+type notNode struct{ n filterNode }
+
+func (n notNode) match(line []string) bool { return !n.n.match(line) }
+
+// filterRows returns the rows that match the filter expression src.
+// Computed columns can be filtered, too, except in pivot mode, where
+// they are computed from the pivot table.
+func filterRows(cfg *Config, hdr []string, rows [][]string, src string) ([][]string, error) {
+	f, err := parseFilter(src, hdr, cfg.renamed)
+	if err != nil {
+		return nil, err
+	}
+	values := rows
+	if cfg.Pivot == nil {
+		values = cfg.computeRows(hdr, rows)
+	}
+	var matched [][]string
+	for r, line := range rows {
+		if f.match(values[r]) {
+			matched = append(matched, line)
+		}
+	}
+	return matched, nil
+}
+
+// parseFilter parses a filter expression over the columns in hdr, of
+// which those in renamed are disambiguated duplicates.
+func parseFilter(src string, hdr []string, renamed map[string]string) (filterNode, error) {
+	p := &filterParser{exprParser{src: src, hdr: hdr, renamed: renamed}}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos:], p.pos+1)
+	}
+	return n, nil
+}
+
+// filterParser is a recursive descent parser for filter expressions. It
+// shares the scanning helpers of exprParser.
+type filterParser struct {
+	exprParser
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	n, err := p.and()
+	for err == nil && p.keyword("or") {
+		var r filterNode
+		if r, err = p.and(); err == nil {
+			n = logicNode{false, n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	n, err := p.not()
+	for err == nil && p.keyword("and") {
+		var r filterNode
+		if r, err = p.not(); err == nil {
+			n = logicNode{true, n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *filterParser) not() (filterNode, error) {
+	if p.keyword("not") {
+		n, err := p.not()
+		return notNode{n}, err
+	}
+	if p.peek() == '(' {
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(')')
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterNode, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("in") {
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		var list []operand
+		for {
+			o, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, o)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		return inNode{l, list}, p.expect(')')
+	}
+	p.skipSpace()
+	var op string
+	for _, candidate := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(p.src[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("missing comparison at position %d", p.pos+1)
+	}
+	p.pos += len(op)
+	r, err := p.operand()
+	return compareNode{op, l, r}, err
+}
+
+// operand parses a column name, a quoted text, or a number.
+func (p *filterParser) operand() (operand, error) {
+	c := p.peek()
+	switch {
+	case c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			return operand{}, fmt.Errorf("missing closing quote after position %d", p.pos+1)
+		}
+		text := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return operand{col: -1, literal: text}, nil
+	case c == '[':
+		end := strings.IndexByte(p.src[p.pos:], ']')
+		if end < 0 {
+			return operand{}, fmt.Errorf("missing ] after position %d", p.pos+1)
+		}
+		name := p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return p.columnOperand(name)
+	case c >= '0' && c <= '9' || c == '.' || c == '-':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return operand{}, fmt.Errorf("invalid number %q", text)
+		}
+		return operand{col: -1, literal: text}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		return p.columnOperand(p.word())
+	case c == 0:
+		return operand{}, fmt.Errorf("unexpected end of filter")
+	}
+	return operand{}, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *filterParser) columnOperand(name string) (operand, error) {
+	i, err := p.index(name)
+	return operand{col: i}, err
+}
+
+// word scans an identifier.
+func (p *filterParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// keyword consumes the keyword kw, in any case, if it comes next.
+func (p *filterParser) keyword(kw string) bool {
+	p.skipSpace()
+	start := p.pos
+	if strings.EqualFold(p.word(), kw) {
+		return true
+	}
+	p.pos = start
+	return false
+}
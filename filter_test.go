@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	hdr := []string{"Region", "Total", "Status", "Order Item"}
+	line := []string{"North", " 1200 ", "open", "Sample"}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`Region = "North"`, true},
+		{`Region != "North"`, false},
+		{`Region="North"`, true},
+		{`Total >= 1000`, true},
+		{`Total > 1200`, false},
+		{`Total <= 1200.0`, true},
+		{`Total < 999`, false},
+		{`Total > -5`, true},
+		{`Total < 13`, false}, // numbers, not text
+		{`Region < "Österreich"`, true},
+		{`Region > "apple"`, true}, // letters before case
+		{`Region in ("East", "North")`, true},
+		{`Region in ("East")`, false},
+		{`Total in (1000, 1200)`, true},
+		{`[Order Item] = "Sample"`, true},
+		{`Region = "North" and Total >= 1000`, true},
+		{`Region = "East" or Total >= 1000`, true},
+		{`Region = "East" or Status = "closed" and Total > 0`, false},
+		{`not Region = "North"`, false},
+		{`NOT (Status = "cancelled" OR [Order Item] = "Sample")`, false},
+		{`not not Status = "open"`, true},
+		{`(Region = "East" or Region = "North") and Status = "open"`, true},
+		{`Status = Status`, true},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.src, hdr, nil)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.match(line); got != tt.want {
+			t.Errorf("filter %q matches = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	hdr := []string{"Region", "Total"}
+	tests := []struct {
+		src, want string
+	}{
+		{``, "unexpected end of filter"},
+		{`Region`, "missing comparison at position 7"},
+		{`Region =`, "unexpected end of filter"},
+		{`Region == "North"`, `unexpected '='`},
+		{`Country = "DE"`, `column "Country" not found`},
+		{`[Region = "North"`, "missing ] after position 1"},
+		{`Region = "North`, "missing closing quote after position 10"},
+		{`Total > 1.2.3`, `invalid number "1.2.3"`},
+		{`(Region = "North"`, "missing ')' at position 18"},
+		{`Region in "North"`, "missing '(' at position 11"},
+		{`Region in ("North"`, "missing ')' at position 19"},
+		{`Region = "North" Total`, `unexpected "Total" at position 18`},
+		{`Region = "North" and`, "unexpected end of filter"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilter(tt.src, hdr, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseFilter(%q) = %v, want an error with %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ## Checking the font coverage
+
+// A missing glyph shows up as an empty box, or as a question mark in the
+// core fonts, and nobody notices until a customer asks what "M?ller"
+// ordered. Before rendering, the font check looks at every value of the
+// data and lists the characters that none of the configured fonts has,
+// with the rows and columns they occur in:
+//
+//	"fontCheck": {"onMissing": "fail",
+//	  "fallback": {"": "noto/NotoSansSymbols2-Regular.ttf"}}
+//
+// By default, missing characters are logged as warnings; "fail" stops
+// the run instead. A fallback font is embedded only if the data needs
+// it: it joins the fallback fonts (see fontChain) when the other fonts
+// lack a character that it has.
+
+// FontCheckConfig checks the data for characters that the fonts lack.
+type FontCheckConfig struct {
+	// OnMissing is "warn" (default) or "fail".
+	OnMissing string `json:"onMissing"`
+
+	// Fallback maps styles to the files of a font, like Fonts, that is
+	// added to the fallback fonts if the data needs it.
+	Fallback map[string]string `json:"fallback"`
+}
+
+func (fc *FontCheckConfig) prepare(c *Config) error {
+	switch fc.OnMissing {
+	case "", "warn", "fail":
+	default:
+		return fmt.Errorf("unknown onMissing %q; use warn or fail", fc.OnMissing)
+	}
+	if fc.Fallback != nil && len(c.fonts()) == 0 {
+		return errors.New("a fallback font requires fonts")
+	}
+	return nil
+}
+
+// cp1252Charset holds the characters of Windows-1252, the encoding of
+// the core fonts.
+var cp1252Charset = charset{
+	{0x20, 0x7e}, {0xa0, 0xff}, {0x152, 0x153}, {0x160, 0x161}, {0x178, 0x178},
+	{0x17d, 0x17e}, {0x192, 0x192}, {0x2c6, 0x2c6}, {0x2dc, 0x2dc},
+	{0x2013, 0x2014}, {0x2018, 0x201a}, {0x201c, 0x201e}, {0x2020, 0x2022},
+	{0x2026, 0x2026}, {0x2030, 0x2030}, {0x2039, 0x203a}, {0x20ac, 0x20ac},
+	{0x2122, 0x2122},
+}
+
+// maxGlyphLocations limits the cells listed per missing character, and
+// the characters listed in an error.
+const maxGlyphLocations = 5
+
+// missingGlyph is a character that no font has, and where it occurs.
+type missingGlyph struct {
+	char  rune
+	count int      // cells that contain it
+	at    []string // the first few of them
+	last  int      // the last cell counted
+}
+
+func (mg missingGlyph) String() string {
+	return fmt.Sprintf("%U %q (%s)", mg.char, mg.char, mg.locations())
+}
+
+// locations lists the cells that contain the character.
+func (mg missingGlyph) locations() string {
+	s := strings.Join(mg.at, "; ")
+	if more := mg.count - len(mg.at); more > 0 {
+		s += fmt.Sprintf("; %d more", more)
+	}
+	return s
+}
+
+// check looks for characters in hdr and rows that the fonts lack. If
+// the fallback font has some of them, it is added to cfg's fallback
+// fonts. The characters that are still missing are logged or, with
+// OnMissing "fail", returned as an error.
+func (fc *FontCheckConfig) check(env *Env, cfg *Config, hdr []string, rows [][]string) error {
+	if fc == nil {
+		return nil
+	}
+	chain, err := cfg.coverage(env.FS)
+	if err != nil {
+		return err
+	}
+	missing := findMissingGlyphs(chain.fonts, hdr, rows)
+	if len(missing) > 0 && fc.Fallback != nil {
+		cs, err := cfg.fontCharset(env.FS, fc.Fallback)
+		if err != nil {
+			return err
+		}
+		var still []missingGlyph
+		for _, mg := range missing {
+			if !cs.has(mg.char) {
+				still = append(still, mg)
+			}
+		}
+		if len(still) < len(missing) {
+			cfg.FallbackFonts = append(cfg.FallbackFonts, fc.Fallback)
+			if cfg.fallback, err = cfg.loadFontChain(env.FS); err != nil {
+				return err
+			}
+			env.Log.Info("fallback font enabled", "font", fc.Fallback[""], "chars", len(missing)-len(still))
+		}
+		missing = still
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if fc.OnMissing == "fail" {
+		var list []string
+		for i, mg := range missing {
+			if i == maxGlyphLocations {
+				list = append(list, fmt.Sprintf("%d more", len(missing)-i))
+				break
+			}
+			list = append(list, mg.String())
+		}
+		return fmt.Errorf("the fonts lack %s: %s", pluralize(len(missing), "character", "characters"), strings.Join(list, ", "))
+	}
+	for _, mg := range missing {
+		env.Log.Warn("character missing from fonts", "char", fmt.Sprintf("%U %q", mg.char, mg.char), "cells", mg.count, "at", mg.locations())
+	}
+	return nil
+}
+
+// coverage returns the fonts that print the data: the font chain if
+// fallback fonts are configured, or else the main font alone.
+func (c *Config) coverage(fsys FileSystem) (*fontChain, error) {
+	if c.fallback != nil {
+		return c.fallback, nil
+	}
+	if len(c.fonts()) == 0 {
+		return &fontChain{fonts: []charset{cp1252Charset}, families: []string{"Times"}}, nil
+	}
+	cs, err := c.fontCharset(fsys, c.fonts())
+	if err != nil {
+		return nil, err
+	}
+	return &fontChain{fonts: []charset{cs}, families: []string{"Times"}}, nil
+}
+
+// findMissingGlyphs returns the characters of hdr and rows that none of
+// the fonts has, in the order in which they first occur. Control
+// characters are not printed and are ignored.
+func findMissingGlyphs(fonts []charset, hdr []string, rows [][]string) []missingGlyph {
+	var missing []missingGlyph
+	index := map[rune]int{}
+	cell := 0
+	scan := func(s, where string) {
+		cell++
+		for _, r := range s {
+			if unicode.IsControl(r) {
+				continue
+			}
+			found := false
+			for _, cs := range fonts {
+				if cs.has(r) {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			i, ok := index[r]
+			if !ok {
+				i = len(missing)
+				index[r] = i
+				missing = append(missing, missingGlyph{char: r})
+			}
+			mg := &missing[i]
+			if mg.last == cell {
+				continue
+			}
+			mg.last = cell
+			mg.count++
+			if len(mg.at) < maxGlyphLocations {
+				mg.at = append(mg.at, where)
+			}
+		}
+	}
+	for i, h := range hdr {
+		scan(h, fmt.Sprintf("the header of column %d", i+1))
+	}
+	for r, line := range rows {
+		for i, v := range line {
+			name := fmt.Sprintf("%d", i+1)
+			if i < len(hdr) {
+				name = hdr[i]
+			}
+			scan(v, fmt.Sprintf("row %d, column %s", r+1, name))
+		}
+	}
+	return missing
+}
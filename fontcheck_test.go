@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindMissingGlyphs(t *testing.T) {
+	hdr := []string{"Item", "Status ✓"}
+	rows := [][]string{
+		{"Müller €5", "✓✓"},
+		{"tab\there", "☎ or ✓", "extra ☎"},
+	}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, []string{"", "✓"})
+	}
+	missing := findMissingGlyphs([]charset{cp1252Charset}, hdr, rows)
+	var got []string
+	for _, mg := range missing {
+		got = append(got, fmt.Sprint(mg))
+	}
+	want := []string{
+		`U+2713 '✓' (the header of column 2; row 1, column Status ✓; row 2, column Status ✓; row 3, column Status ✓; row 4, column Status ✓; 3 more)`,
+		`U+260E '☎' (row 2, column Status ✓; row 2, column 3)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("missing glyphs:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if missing := findMissingGlyphs([]charset{cp1252Charset, {{'☎', '☎'}, {'✓', '✓'}}}, hdr, rows); missing != nil {
+		t.Errorf("the fallback font is ignored: %v", missing)
+	}
+}
+
+func TestFontCheck(t *testing.T) {
+	const fallbackCSV = "Name,Total\nCheck ✓,1\nЖ ✓,2\n中,3\n"
+	tests := []struct {
+		config, in, err string
+		log             []string
+	}{
+		// The core fonts lack the check mark and the Cyrillic letters.
+		{`{"fontCheck": {}}`, "", "", []string{
+			`level=WARN msg="character missing from fonts" char="U+2713 '✓'" cells=2 at="row 1, column Name; row 2, column Name"`,
+			`level=WARN msg="character missing from fonts" char="U+0416 'Ж'" cells=1 at="row 2, column Name"`,
+		}},
+		{`{"fontCheck": {"onMissing": "fail"}}`, "", "the fonts lack 2 characters: U+2713 '✓' (row 1, column Name; row 2, column Name), U+0416 'Ж' (row 2, column Name)", nil},
+		{`{"fontCheck": {"onMissing": "fail"}}`, "Name\nМосква\n", "the fonts lack 6 characters: U+041C 'М' (row 1, column Name), " +
+			"U+043E 'о' (row 1, column Name), U+0441 'с' (row 1, column Name), U+043A 'к' (row 1, column Name), U+0432 'в' (row 1, column Name), 1 more", nil},
+		// The fallback font has all characters but one.
+		{`{"fonts": {"": "calligra.ttf"}, "fontCheck": {"onMissing": "fail", "fallback": {"": "DejaVuSansCondensed.ttf"}}}`, fallbackCSV,
+			"the fonts lack 1 character: U+4E2D '中' (row 3, column Name)", nil},
+		{`{"fonts": {"": "calligra.ttf"}, "fontCheck": {"fallback": {"": "DejaVuSansCondensed.ttf"}}}`, fallbackCSV, "", []string{
+			`level=INFO msg="fallback font enabled" font=DejaVuSansCondensed.ttf chars=2`,
+			`level=WARN msg="character missing from fonts" char="U+4E2D '中'" cells=1 at="row 3, column Name"`,
+		}},
+		{`{"fontCheck": {"onMissing": "ignore"}}`, "", `fontCheck: unknown onMissing "ignore"; use warn or fail`, nil},
+		{`{"fontCheck": {"fallback": {"": "DejaVuSansCondensed.ttf"}}}`, "", "fontCheck: a fallback font requires fonts", nil},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{
+			"in.csv":                  orDefault(tt.in, "Name,Total\nCheck ✓,1\nЖ ✓,2\n"),
+			"cfg.json":                tt.config,
+			"calligra.ttf":            testFont(t, "calligra.ttf"),
+			"DejaVuSansCondensed.ttf": testFont(t, "DejaVuSansCondensed.ttf"),
+		})
+		var buf bytes.Buffer
+		env.Log, _ = NewLogger(&buf, "", "")
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.config, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+		if tt.log == nil {
+			continue
+		}
+		var log []string
+		for _, line := range logLines(&buf) {
+			if !strings.Contains(line, "report written") {
+				log = append(log, line)
+			}
+		}
+		if !reflect.DeepEqual(log, tt.log) {
+			t.Errorf("%s: log\n%s\nwant:\n%s", tt.config, strings.Join(log, "\n"), strings.Join(tt.log, "\n"))
+		}
+	}
+}
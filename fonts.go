@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"unicode"
+)
+
+// ## Fonts and fallback fonts
+
+// No single font has every character. A customer list may mix Latin
+// names with Chinese or Japanese ones, and a status column may use
+// symbols like ✓ or ☎. Characters missing from a font print as empty
+// boxes ("tofu"). So, behind the main fonts, a chain of fallback fonts
+// can be configured. Each cell is split into runs of text, and each run
+// is printed with the first font of the chain that has all of its
+// characters:
+//
+//	"fontDir": "/usr/share/fonts/truetype",
+//	"fonts": {"": "noto/NotoSans-Regular.ttf", "B": "noto/NotoSans-Bold.ttf"},
+//	"fallbackFonts": [
+//	  {"": "noto/NotoSansSC-Regular.ttf"},
+//	  {"": "noto/NotoSansSymbols2-Regular.ttf"}
+//	]
+//
+// gofpdf reads TrueType fonts (.ttf) only, and only characters of the
+// Basic Multilingual Plane, up to U+FFFF. This rules out most emoji,
+// which lie beyond.
+
+// fonts returns the TrueType fonts of the document, if any.
+func (c *Config) fonts() map[string]string {
+	if c.Archive != nil && len(c.Archive.Fonts) > 0 {
+		return c.Archive.Fonts
+	}
+	return c.Fonts
+}
+
+// fontPath returns the path of a font file, relative to the font
+// directory.
+func (c *Config) fontPath(path string) string {
+	if c.FontDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.FontDir, path)
+}
+
+// fallbackFamily returns the family name of the i-th fallback font.
+func fallbackFamily(i int) string {
+	return fmt.Sprintf("Fallback%d", i+1)
+}
+
+// embedFonts registers the given TrueType fonts under the family name.
+// Styles without a file use the regular ("") font.
+func (c *Config) embedFonts(pdf *Fpdf, fsys FileSystem, family string, fonts map[string]string) error {
+	regular, ok := fonts[""]
+	if !ok {
+		return fmt.Errorf("fonts: a regular (\"\") font is required")
+	}
+	for _, style := range []string{"", "B", "I", "BI"} {
+		path, ok := fonts[style]
+		if !ok {
+			path = regular
+		}
+		data, err := readFile(fsys, c.fontPath(path))
+		if err != nil {
+			return fmt.Errorf("font: %w", err)
+		}
+		// Registering the main font under the family name "Times" makes
+		// all SetFont("Times", ...) calls use the embedded font.
+		pdf.AddUTF8FontFromBytes(family, style, data)
+	}
+	return nil
+}
+
+// fontChain knows which characters the main and the fallback fonts
+// have.
+type fontChain struct {
+	fonts    []charset // main font first
+	families []string
+}
+
+// loadFontChain reads the character sets of the regular main and
+// fallback fonts. It returns nil if no fallback fonts are configured.
+func (c *Config) loadFontChain(fsys FileSystem) (*fontChain, error) {
+	if len(c.FallbackFonts) == 0 {
+		return nil, nil
+	}
+	fc := &fontChain{}
+	add := func(family string, fonts map[string]string) error {
+		cs, err := c.fontCharset(fsys, fonts)
+		if err != nil {
+			return err
+		}
+		fc.fonts = append(fc.fonts, cs)
+		fc.families = append(fc.families, family)
+		return nil
+	}
+	if err := add("Times", c.fonts()); err != nil {
+		return nil, err
+	}
+	for i, fonts := range c.FallbackFonts {
+		if err := add(fallbackFamily(i), fonts); err != nil {
+			return nil, err
+		}
+	}
+	return fc, nil
+}
+
+// fontCharset reads the character set of the regular font of fonts.
+func (c *Config) fontCharset(fsys FileSystem, fonts map[string]string) (charset, error) {
+	data, err := readFile(fsys, c.fontPath(fonts[""]))
+	if err != nil {
+		return nil, fmt.Errorf("font: %w", err)
+	}
+	cs, err := readCharset(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", fonts[""], err)
+	}
+	return cs, nil
+}
+
+// fontRun is a piece of text that is printed in one font.
+type fontRun struct {
+	family, text string
+}
+
+// runs splits text into runs of the same font. Each word is printed in
+// the first font that has all of its characters, so that a word does
+// not mix fonts unless it must. Spaces, and characters that no font
+// has, stay with the run they are in.
+func (fc *fontChain) runs(text string) []fontRun {
+	var runs []fontRun
+	add := func(family, text string) {
+		if n := len(runs); n > 0 && (runs[n-1].family == family || family == "") {
+			runs[n-1].text += text
+			return
+		}
+		if family == "" {
+			family = fc.families[0]
+		}
+		runs = append(runs, fontRun{family, text})
+	}
+	for len(text) > 0 {
+		// Split off the next word, or the spaces before it.
+		end := len(text)
+		space := unicode.IsSpace([]rune(text)[0])
+		for i, r := range text {
+			if unicode.IsSpace(r) != space {
+				end = i
+				break
+			}
+		}
+		word := text[:end]
+		text = text[end:]
+		if space {
+			add("", word)
+			continue
+		}
+		if family := fc.family(word); family != "" {
+			add(family, word)
+			continue
+		}
+		for _, r := range word {
+			add(fc.family(string(r)), string(r))
+		}
+	}
+	return runs
+}
+
+// family returns the family of the first font that has all characters
+// of s, or "".
+func (fc *fontChain) family(s string) string {
+	for i, cs := range fc.fonts {
+		if cs.hasAll(s) {
+			return fc.families[i]
+		}
+	}
+	return ""
+}
+
+// cell prints a cell like CellFormat, switching to fallback fonts where
+// the main font lacks characters. style is the current font style.
+func (fc *fontChain) cell(pdf Backend, style string, w, h float64, text, border string, ln int, align string, fill bool) {
+	if fc == nil {
+		pdf.CellFormat(w, h, text, border, ln, align, fill, 0, "")
+		return
+	}
+	runs := fc.runs(text)
+	if len(runs) == 1 && runs[0].family == fc.families[0] {
+		pdf.CellFormat(w, h, text, border, ln, align, fill, 0, "")
+		return
+	}
+
+	// Draw the empty cell first, then print the runs one after another
+	// at the position the alignment requires.
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+	total := 0.0
+	widths := make([]float64, len(runs))
+	for i, run := range runs {
+		pdf.SetFont(run.family, style, 0)
+		widths[i] = pdf.GetStringWidth(run.text)
+		total += widths[i]
+	}
+	margin := pdf.GetCellMargin()
+	switch align {
+	case "R":
+		pdf.SetX(x + w - margin - total)
+	case "C":
+		pdf.SetX(x + (w-total)/2)
+	default:
+		pdf.SetX(x + margin)
+	}
+	pdf.SetCellMargin(0)
+	for i, run := range runs {
+		pdf.SetFont(run.family, style, 0)
+		pdf.CellFormat(widths[i], h, run.text, "", 0, "", false, 0, "")
+	}
+	pdf.SetCellMargin(margin)
+	pdf.SetFont(fc.families[0], style, 0)
+
+	switch ln {
+	case 1:
+		left, _, _, _ := pdf.GetMargins()
+		pdf.SetXY(left, y+h)
+	case 2:
+		pdf.SetXY(x, y+h)
+	default:
+		pdf.SetXY(x+w, y)
+	}
+}
+
+// charset is a set of characters, stored as sorted, disjoint ranges.
+type charset [][2]rune
+
+func (cs charset) has(r rune) bool {
+	i := sort.Search(len(cs), func(i int) bool { return cs[i][1] >= r })
+	return i < len(cs) && cs[i][0] <= r
+}
+
+func (cs charset) hasAll(s string) bool {
+	for _, r := range s {
+		if !cs.has(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// readCharset returns the characters that a TrueType font maps to
+// glyphs, as listed in the Unicode BMP subtable (format 4) of its cmap
+// table -- the only one that gofpdf reads.
+func readCharset(font []byte) (charset, error) {
+	errFormat := errors.New("not a TrueType font with a Unicode cmap")
+	u16 := func(off int) int {
+		if off < 0 || off+2 > len(font) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(font[off:]))
+	}
+	u32 := func(off int) int {
+		if off < 0 || off+4 > len(font) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint32(font[off:]))
+	}
+
+	// Find the cmap table, then its format 4 subtable.
+	cmap := -1
+	for i := 0; i < u16(4); i++ {
+		rec := 12 + 16*i
+		if rec+16 <= len(font) && string(font[rec:rec+4]) == "cmap" {
+			cmap = u32(rec + 8)
+		}
+	}
+	if cmap < 0 {
+		return nil, errFormat
+	}
+	sub := -1
+	for i := 0; i < u16(cmap+2); i++ {
+		rec := cmap + 4 + 8*i
+		platform, encoding := u16(rec), u16(rec+2)
+		off := cmap + u32(rec+4)
+		if (platform == 0 || (platform == 3 && encoding == 1)) && u16(off) == 4 {
+			sub = off
+			break
+		}
+	}
+	if sub < 0 {
+		return nil, errFormat
+	}
+
+	segs := u16(sub+6) / 2
+	ends, starts := sub+14, sub+16+2*segs
+	deltas, rangeOffsets := starts+2*segs, starts+4*segs
+	var cs charset
+	for s := 0; s < segs; s++ {
+		start, end := u16(starts+2*s), u16(ends+2*s)
+		delta, rangeOffset := u16(deltas+2*s), u16(rangeOffsets+2*s)
+		for c := start; c <= end && c != 0xffff; c++ {
+			glyph := (c + delta) & 0xffff
+			if rangeOffset != 0 {
+				glyph = u16(rangeOffsets + 2*s + rangeOffset + 2*(c-start))
+				if glyph != 0 {
+					glyph = (glyph + delta) & 0xffff
+				}
+			}
+			if glyph == 0 {
+				continue
+			}
+			if n := len(cs); n > 0 && cs[n-1][1] == rune(c)-1 {
+				cs[n-1][1] = rune(c)
+			} else {
+				cs = append(cs, [2]rune{rune(c), rune(c)})
+			}
+		}
+	}
+	return cs, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCharset(t *testing.T) {
+	cs := charset{{'a', 'z'}, {'é', 'é'}}
+	for r, want := range map[rune]bool{'a': true, 'm': true, 'z': true, 'é': true, 'A': false, '{': false, 'ê': false} {
+		if cs.has(r) != want {
+			t.Errorf("has(%q) = %v, want %v", r, !want, want)
+		}
+	}
+	if !cs.hasAll("café") || cs.hasAll("Café") || !cs.hasAll("") {
+		t.Error("hasAll is wrong")
+	}
+}
+
+func TestFontRuns(t *testing.T) {
+	fc := &fontChain{
+		fonts:    []charset{{{' ', '~'}}, {{'0', '9'}, {'Ж', 'я'}}},
+		families: []string{"Times", "Fallback1"},
+	}
+	tests := []struct {
+		text string
+		want []fontRun
+	}{
+		{"plain text", []fontRun{{"Times", "plain text"}}},
+		// Words in one font, spaces with the run before them.
+		{"Hotel Москва 12", []fontRun{{"Times", "Hotel "}, {"Fallback1", "Москва "}, {"Times", "12"}}},
+		{"Москва", []fontRun{{"Fallback1", "Москва"}}},
+		// Words that no font has as a whole are split.
+		{"Tverskaya-ул", []fontRun{{"Times", "Tverskaya-"}, {"Fallback1", "ул"}}},
+		// Characters that no font has stay where they are.
+		{"☎ 12", []fontRun{{"Times", "☎ 12"}}},
+		{"ул☎", []fontRun{{"Fallback1", "ул☎"}}},
+		{"  ", []fontRun{{"Times", "  "}}},
+	}
+	for _, tt := range tests {
+		if got := fc.runs(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("runs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestReadCharset(t *testing.T) {
+	for _, tt := range []struct {
+		font, has, lacks string
+	}{
+		{"calligra.ttf", "Café", "Ж"},
+		{"DejaVuSansCondensed.ttf", "CaféЖ✓", "中"},
+	} {
+		cs, err := readCharset([]byte(testFont(t, tt.font)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cs.hasAll(tt.has) {
+			t.Errorf("%s lacks %q", tt.font, tt.has)
+		}
+		if cs.hasAll(tt.lacks) {
+			t.Errorf("%s has %q", tt.font, tt.lacks)
+		}
+	}
+	for _, data := range []string{"", "not a font", "\x00\x01\x00\x00\x00\x01" + strings.Repeat("\x00", 30)} {
+		if _, err := readCharset([]byte(data)); err == nil || err.Error() != "not a TrueType font with a Unicode cmap" {
+			t.Errorf("readCharset(%q): %v", data, err)
+		}
+	}
+}
+
+// fontRecorder is a Backend that records font families and printed
+// texts.
+type fontRecorder struct {
+	Backend
+	families, texts []string
+}
+
+func (fr *fontRecorder) SetFont(family, style string, size float64) {
+	fr.families = append(fr.families, family)
+	fr.Backend.SetFont(family, style, size)
+}
+
+func (fr *fontRecorder) CellFormat(w, h float64, txt, border string, ln int, align string, fill bool, link int, linkStr string) {
+	fr.texts = append(fr.texts, txt)
+	fr.Backend.CellFormat(w, h, txt, border, ln, align, fill, link, linkStr)
+}
+
+func TestFallbackFonts(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":                        "City,Total\nCafé Москва,10\n",
+		"fonts/calligra.ttf":            testFont(t, "calligra.ttf"),
+		"fonts/DejaVuSansCondensed.ttf": testFont(t, "DejaVuSansCondensed.ttf"),
+		"cfg.json": `{"fontDir": "fonts", "fonts": {"": "calligra.ttf"},
+			"fallbackFonts": [{"": "DejaVuSansCondensed.ttf"}]}`,
+	})
+	cfg, err := loadConfig(env.FS, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := newPDF("P", "mm", "A4", "")
+	setupDocument(pdf, env, cfg)
+	pdf.AddPage()
+	pdf.SetFont("Times", "", 12)
+	rec := &fontRecorder{Backend: pdf}
+
+	// A cell that the main font can print is a plain cell.
+	cfg.fallback.cell(rec, "", 60, 7, "Café", "", 0, "R", false)
+	if want := []string{"Café"}; !reflect.DeepEqual(rec.texts, want) || rec.families != nil {
+		t.Errorf("printed %q in %q, want %q in the current font", rec.texts, rec.families, want)
+	}
+
+	// Otherwise, an empty cell is drawn, then the runs are measured and
+	// printed, and the main font is restored.
+	rec.texts, rec.families = nil, nil
+	x, y := pdf.GetXY()
+	cfg.fallback.cell(rec, "", 60, 7, "Café Москва", "", 0, "R", false)
+	if want := []string{"", "Café ", "Москва"}; !reflect.DeepEqual(rec.texts, want) {
+		t.Errorf("printed %q, want %q", rec.texts, want)
+	}
+	if want := []string{"Times", "Fallback1", "Times", "Fallback1", "Times"}; !reflect.DeepEqual(rec.families, want) {
+		t.Errorf("fonts %q, want %q", rec.families, want)
+	}
+	if x2, y2 := pdf.GetXY(); !approx(x2, x+60) || !approx(y2, y) {
+		t.Errorf("the cell ends at (%v, %v), want (%v, %v)", x2, y2, x+60, y)
+	}
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFontConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"fallbackFonts": [{"": "f.ttf"}]}`, "fallbackFonts require fonts"},
+		{`{"fonts": {"": "calligra.ttf"}, "fallbackFonts": [{"": "missing.ttf"}]}`, "font: "},
+		{`{"fonts": {"": "calligra.ttf"}, "fallbackFonts": [{"": "in.csv"}]}`, "font in.csv: not a TrueType font"},
+		{`{"fonts": {"B": "calligra.ttf"}}`, `fonts: a regular ("") font is required`},
+	} {
+		env := testEnv(map[string]string{"in.csv": "City,Total\nParis,10\n", "calligra.ttf": testFont(t, "calligra.ttf"), "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
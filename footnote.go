@@ -0,0 +1,274 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ## Footnotes
+
+// Some numbers need an explanation that does not fit into a table cell.
+// With footnotes enabled, a cell value or the narrative text can carry
+// notes written as [^note text]:
+//
+//	1.99[^Discounted price]
+//
+// The note is replaced by a superscript number, and the text appears at
+// the bottom of the page -- the table ends early to make room -- or in a
+// notes section at the end of the report. Columns can also carry a
+// note on their header; see ColumnConfig.Footnote.
+
+// FootnoteConfig enables footnotes.
+type FootnoteConfig struct {
+	// Placement is "page" (default) for footnotes at the bottom of each
+	// page, or "end" for endnotes after the table.
+	Placement string `json:"placement"`
+
+	// FontSize is the size of the note text in points. Default: 10.
+	FontSize float64 `json:"fontSize"`
+}
+
+// cellPos identifies a table cell by row and column.
+type cellPos struct{ row, col int }
+
+// splitNotes removes all [^...] notes from str and returns them.
+func splitNotes(str string) (string, []string) {
+	var notes []string
+	for {
+		i := strings.Index(str, "[^")
+		if i < 0 {
+			return str, notes
+		}
+		j := strings.Index(str[i:], "]")
+		if j < 0 {
+			return str, notes
+		}
+		notes = append(notes, strings.TrimSpace(str[i+2:i+j]))
+		str = str[:i] + str[i+j+1:]
+	}
+}
+
+// stripCellNotes returns a copy of rows without notes, and the notes of
+// each cell.
+func stripCellNotes(rows [][]string) ([][]string, map[cellPos][]string) {
+	notes := map[cellPos][]string{}
+	clean := make([][]string, len(rows))
+	for r, line := range rows {
+		clean[r] = make([]string, len(line))
+		for i, str := range line {
+			var n []string
+			clean[r][i], n = splitNotes(str)
+			if len(n) > 0 {
+				notes[cellPos{r, i}] = n
+			}
+		}
+	}
+	return clean, notes
+}
+
+// footnotes numbers the notes of a document and prints them. A nil
+// *footnotes ignores all notes.
+type footnotes struct {
+	cfg    *FootnoteConfig
+	cells  map[cellPos][]string
+	next   int
+	page   []string // numbered notes of the current page
+	end    []string // numbered notes for the notes section
+	bottom float64  // the bottom margin without notes
+	loc    *locale
+}
+
+// newFootnotes prepares pdf for footnotes. Unless they go to the end,
+// the notes of a page are printed when the page is complete.
+func newFootnotes(pdf *Fpdf, fc *FootnoteConfig, loc *locale, cells map[cellPos][]string, prog *progress) *footnotes {
+	fn := &footnotes{cfg: fc, cells: cells, next: 1, loc: loc}
+	_, fn.bottom = pdf.GetAutoPageBreak()
+	if !fn.atEnd() {
+		prog.onPageEnd(pdf, func() { fn.printPage(pdf) })
+	}
+	return fn
+}
+
+func (fn *footnotes) atEnd() bool { return fn.cfg.Placement == "end" }
+
+func (fn *footnotes) fontSize() float64 { return orDefaultFloat(fn.cfg.FontSize, 10) }
+
+// lineHeight is the height of a note line in mm.
+func (fn *footnotes) lineHeight() float64 { return fn.fontSize() * 0.3528 * 1.3 }
+
+// add numbers the notes and returns their markers, such as "1,2".
+func (fn *footnotes) add(notes []string) string {
+	if fn == nil || len(notes) == 0 {
+		return ""
+	}
+	marks := make([]string, len(notes))
+	for i, n := range notes {
+		num := strconv.Itoa(fn.next)
+		fn.next++
+		marks[i] = num
+		if fn.atEnd() {
+			fn.end = append(fn.end, num+" "+fn.loc.print(n))
+		} else {
+			fn.page = append(fn.page, num+" "+fn.loc.print(n))
+		}
+	}
+	return strings.Join(marks, ",")
+}
+
+// cellMark numbers the notes of a table cell and returns their marker.
+func (fn *footnotes) cellMark(r, i int) string {
+	if fn == nil {
+		return ""
+	}
+	return fn.add(fn.cells[cellPos{r, i}])
+}
+
+// rowNotes returns the notes of all cells of row r.
+func (fn *footnotes) rowNotes(r, ncols int) []string {
+	if fn == nil {
+		return nil
+	}
+	var notes []string
+	for i := 0; i < ncols; i++ {
+		notes = append(notes, fn.cells[cellPos{r, i}]...)
+	}
+	return notes
+}
+
+// reserve makes room at the bottom of the page for the given notes,
+// which belong to content of height h that is about to be printed. If
+// content and notes do not fit, a new page is started.
+func (fn *footnotes) reserve(pdf Backend, notes []string, h float64) {
+	if fn == nil || fn.atEnd() || len(notes) == 0 {
+		return
+	}
+	pending := append(append([]string{}, fn.page...), notes...)
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+h+fn.height(pdf, pending) > pageHeight-fn.bottom {
+		addPage(pdf, "")
+		pending = notes
+	}
+	pdf.SetAutoPageBreak(true, fn.bottom+fn.height(pdf, pending))
+}
+
+// height returns the space that the notes need, including the
+// separator line.
+func (fn *footnotes) height(pdf Backend, notes []string) float64 {
+	if len(notes) == 0 {
+		return 0
+	}
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	size, _ := pdf.GetFontSize()
+	pdf.SetFontSize(fn.fontSize())
+	lines := 0
+	for i, n := range notes {
+		// Notes that are not numbered yet get a placeholder number.
+		if i >= len(fn.page) {
+			n = "00 " + n
+		}
+		lines += len(pdf.SplitLines([]byte(n), pageWidth-left-right))
+	}
+	pdf.SetFontSize(size)
+	return 4 + float64(lines)*fn.lineHeight()
+}
+
+// printPage prints the notes of the current page at its bottom and
+// resets the reserved space. It runs as the page footer.
+func (fn *footnotes) printPage(pdf *Fpdf) {
+	if len(fn.page) == 0 {
+		return
+	}
+	_, pageHeight := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	y := pageHeight - fn.bottom - fn.height(pdf, fn.page) + 2
+	pdf.Line(left, y, left+40, y)
+	pdf.SetXY(left, y+2)
+	fn.printNotes(pdf, fn.page, pageWidth-left-right)
+	fn.page = nil
+	pdf.SetAutoPageBreak(true, fn.bottom)
+}
+
+// printEnd prints the notes section, if there are endnotes.
+func (fn *footnotes) printEnd(pdf *Fpdf) {
+	if fn == nil || len(fn.end) == 0 {
+		return
+	}
+	pdf.Ln(10)
+	pdf.SetFont("Times", "B", 16)
+	pdf.Cell(40, 10, fn.loc.text("notes"))
+	pdf.Ln(12)
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	fn.printNotes(pdf, fn.end, pageWidth-left-right)
+}
+
+func (fn *footnotes) printNotes(pdf *Fpdf, notes []string, w float64) {
+	pdf.SetFont("Times", "", fn.fontSize())
+	for _, n := range notes {
+		pdf.MultiCell(w, fn.lineHeight(), n, "", "L", false)
+	}
+}
+
+// markedCell prints a table cell whose text is followed by a
+// superscript footnote marker.
+func markedCell(pdf Backend, w, h float64, str, mark, border, align string, fill bool) {
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+	size, _ := pdf.GetFontSize()
+	tw := pdf.GetStringWidth(str)
+	pdf.SetFontSize(size * 0.6)
+	mw := pdf.GetStringWidth(mark)
+	pdf.SetFontSize(size)
+
+	margin := pdf.GetCellMargin()
+	tx := x + margin
+	switch align {
+	case "C":
+		tx = x + (w-tw-mw)/2
+	case "R":
+		tx = x + w - margin - tw - mw
+	}
+	pdf.SetXY(tx, y)
+	pdf.CellFormat(tw, h, str, "", 0, "L", false, 0, "")
+	pdf.SetFontSize(size * 0.6)
+	pdf.SetXY(tx+tw, y-h*0.2)
+	pdf.CellFormat(mw, h, mark, "", 0, "L", false, 0, "")
+	pdf.SetFontSize(size)
+	pdf.SetXY(x+w, y)
+}
+
+// writeNoted writes text that may contain notes, such as the narrative,
+// as flowing text with superscript markers.
+func writeNoted(pdf *Fpdf, fn *footnotes, h float64, text string) {
+	size, _ := pdf.GetFontSize()
+	for {
+		i := strings.Index(text, "[^")
+		j := strings.Index(text[maxInt(i, 0):], "]")
+		if fn == nil || i < 0 || j < 0 {
+			pdf.Write(h, fn.print(text))
+			return
+		}
+		pdf.Write(h, fn.print(text[:i]))
+		note := strings.TrimSpace(text[i+2 : i+j])
+		fn.reserve(pdf, []string{note}, h)
+		pdf.SubWrite(h, fn.add([]string{note}), size*0.6, size*0.4, 0, "")
+		text = text[i+j+1:]
+	}
+}
+
+// print converts text for the fonts of the document.
+func (fn *footnotes) print(text string) string {
+	if fn == nil {
+		return text
+	}
+	return fn.loc.print(text)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitNotes(t *testing.T) {
+	tests := []struct {
+		in, want string
+		notes    []string
+	}{
+		{"1.99", "1.99", nil},
+		{"1.99[^Discounted price]", "1.99", []string{"Discounted price"}},
+		{"a[^ one ]b[^two]", "ab", []string{"one", "two"}},
+		{"[^only]", "", []string{"only"}},
+		{"open [^note", "open [^note", nil},
+		{"x[^a] [^b]", "x ", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		got, notes := splitNotes(tt.in)
+		if got != tt.want || !reflect.DeepEqual(notes, tt.notes) {
+			t.Errorf("splitNotes(%q) = %q, %q, want %q, %q", tt.in, got, notes, tt.want, tt.notes)
+		}
+	}
+
+	rows, cells := stripCellNotes([][]string{{"Apples", "10[^est.]"}, {"Pears[^new]", "5"}})
+	if want := [][]string{{"Apples", "10"}, {"Pears", "5"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("stripCellNotes rows = %q, want %q", rows, want)
+	}
+	if want := map[cellPos][]string{{0, 1}: {"est."}, {1, 0}: {"new"}}; !reflect.DeepEqual(cells, want) {
+		t.Errorf("stripCellNotes notes = %v, want %v", cells, want)
+	}
+}
+
+func TestFootnotes(t *testing.T) {
+	for _, placement := range []string{"page", "end"} {
+		env := testEnv(map[string]string{
+			"in.csv":   "Item,Price\nApples,1.99[^Discounted price]\nPears,2.50\nPlums,3.10[^Estimated]\n",
+			"cfg.json": `{"footnotes": {"placement": "` + placement + `"}, "columns": [{"name": "Price", "footnote": "Per pound"}]}`,
+		})
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+		content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+		for _, want := range []string{"(1 Per pound)", "(1.99)", "(2 Discounted price)", "(3 Estimated)"} {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: the report lacks %s", placement, want)
+			}
+		}
+		if strings.Contains(content, "[^") {
+			t.Errorf("%s: the report has an unprocessed note", placement)
+		}
+		if got := strings.Contains(content, "(Notes)"); got != (placement == "end") {
+			t.Errorf("%s: notes section printed: %v", placement, got)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ## Form fields
+
+// Some reports come back: the manager reads the numbers, ticks a box
+// that they were checked, signs off with their name, and files the
+// report. They do that in Acrobat, in fields that the report brings
+// along:
+//
+//	"form": {
+//	  "title": "Approval",
+//	  "fields": [
+//	    {"name": "approvedBy", "label": "Approved by", "width": 80},
+//	    {"name": "checked", "label": "Numbers checked", "type": "checkbox"},
+//	    {"name": "remarks", "label": "Remarks", "type": "multiline"},
+//	    {"name": "filed", "type": "checkbox", "page": 1, "x": 190, "y": 12}
+//	  ]
+//	}
+//
+// Fields without a page form a block at the end of the report, after the
+// endnotes: the title, and a line for each field with its label and the
+// box to fill in. Fields with a page sit at a fixed position on that
+// page, x and y mm from its top left corner, and have no label; negative
+// pages count from the end, so -1 is the last page.
+//
+// A field is text, a line of it by default, several lines for
+// "multiline", a checkbox, or a "signature", which Acrobat signs
+// digitally. The name is what the field is called in
+// the form data that Acrobat exports, and must be unique; the label is
+// also what screen readers and tooltips show.
+//
+// gofpdf cannot write form fields, so they are added to the finished
+// document, like stationery. The fields use Helvetica, which is not
+// embedded, so they cannot be part of PDF/A documents, and they are not
+// tagged, so they cannot be part of tagged PDFs either.
+
+// FormConfig adds fillable fields to the report.
+type FormConfig struct {
+	// Title is printed above the block of fields without a page.
+	Title string `json:"title"`
+
+	// Fields lists the fields.
+	Fields []FormField `json:"fields"`
+}
+
+// FormField is a field of the form.
+type FormField struct {
+	// Name identifies the field in the form data.
+	Name string `json:"name"`
+
+	// Label describes the field.
+	Label string `json:"label"`
+
+	// Type is "text", "multiline", "checkbox", or "signature".
+	// Default: "text".
+	Type string `json:"type"`
+
+	// Width and Height are the size of the field in mm. Default: 60 by
+	// 7 for text, 60 by 20 for multiline, 5 by 5 for checkboxes, and 60
+	// by 15 for signatures.
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+
+	// Page is the page of a field at a fixed position, counted from 1,
+	// or from the end if negative. Default: the block at the end.
+	Page int `json:"page"`
+
+	// X and Y are the position of the top left corner of a field with
+	// a page, in mm.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+
+	signOff bool // the field belongs to the sign-off block
+}
+
+// formSizes are the default sizes of the field types, in mm.
+var formSizes = map[string][2]float64{
+	"text":      {60, 7},
+	"multiline": {60, 20},
+	"checkbox":  {5, 5},
+	"signature": {60, 15},
+}
+
+func (fc *FormConfig) prepare(c *Config) error {
+	if len(fc.Fields) == 0 {
+		return errors.New("fields required")
+	}
+	seen := map[string]bool{}
+	for i := range fc.Fields {
+		f := &fc.Fields[i]
+		switch {
+		case f.Name == "":
+			return fmt.Errorf("field %d: name required", i+1)
+		case strings.Contains(f.Name, "."):
+			return fmt.Errorf("field %q: names must not contain dots", f.Name)
+		case seen[f.Name]:
+			return fmt.Errorf("field %q: duplicate name", f.Name)
+		}
+		seen[f.Name] = true
+		if f.Type == "" {
+			f.Type = "text"
+		}
+		size, ok := formSizes[f.Type]
+		if !ok {
+			return fmt.Errorf("field %q: type must be text, multiline, checkbox, or signature", f.Name)
+		}
+		if f.Width < 0 || f.Height < 0 {
+			return fmt.Errorf("field %q: width and height must not be negative", f.Name)
+		}
+		if f.Width == 0 {
+			f.Width = size[0]
+		}
+		if f.Height == 0 {
+			f.Height = size[1]
+		}
+	}
+	if c.Tagged != nil {
+		return errors.New("form fields have no tags and cannot be part of a tagged PDF")
+	}
+	if c.Archive != nil {
+		return errors.New("form fields use fonts that are not embedded and cannot be part of a PDF/A document")
+	}
+	return nil
+}
+
+// block reports whether some fields go into the block at the end.
+func (fc *FormConfig) block() bool {
+	if fc == nil {
+		return false
+	}
+	for _, f := range fc.Fields {
+		if f.Page == 0 && !f.signOff {
+			return true
+		}
+	}
+	return false
+}
+
+// formWidget is where a field goes: on a page, counted from 1, with the
+// top left corner and the size in mm.
+type formWidget struct {
+	field      int // index into FormConfig.Fields
+	page       int
+	x, y, w, h float64
+}
+
+// formBlock prints the block of the fields without a page and returns
+// where their boxes are.
+func formBlock(pdf *Fpdf, cfg *Config) (*Fpdf, []formWidget) {
+	fc := cfg.Form
+	if !fc.block() {
+		return pdf, nil
+	}
+	loc := cfg.locale()
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	const gap, lh = 3, 7
+
+	// The labels line up, and so do the boxes.
+	pdf.SetFont("Times", "", 12)
+	h := 4.0
+	if fc.Title != "" {
+		h += 10
+	}
+	labelWidth := 0.0
+	for _, f := range fc.Fields {
+		if f.Page == 0 && !f.signOff {
+			labelWidth = math.Max(labelWidth, pdf.GetStringWidth(loc.print(f.Label))+4)
+			h += f.Height + gap
+		}
+	}
+	if h > spaceLeft(pdf) {
+		addPage(pdf, "")
+	}
+	pdf.Ln(4)
+	if fc.Title != "" {
+		pdf.SetFont("Times", "B", 14)
+		pdf.CellFormat(0, 10, loc.print(fc.Title), "", 1, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+		pdf.SetFont("Times", "", 12)
+	}
+	var widgets []formWidget
+	for i, f := range fc.Fields {
+		if f.Page != 0 || f.signOff {
+			continue
+		}
+		y := pdf.GetY()
+		labelX, boxX := left, left+labelWidth
+		if cfg.rtl() {
+			labelX, boxX = pageWidth-right-labelWidth, pageWidth-right-labelWidth-f.Width
+		}
+		pdf.SetXY(labelX, y)
+		pdf.CellFormat(labelWidth, math.Min(f.Height, lh), loc.print(f.Label), "", 0, cfg.mirrored(ColumnConfig{}, "L"), false, 0, "")
+		widgets = append(widgets, formWidget{field: i, page: pdf.PageNo(), x: boxX, y: y, w: f.Width, h: f.Height})
+		pdf.SetXY(left, y+f.Height+gap)
+	}
+	return pdf, widgets
+}
+
+// finisher returns the post-processing step for savePDF that adds the
+// fields, those of the block at widgets. It must run before the steps
+// that add pages.
+func (fc *FormConfig) finisher(widgets []formWidget) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		data, err := formFields(data, fc, widgets)
+		if err != nil {
+			return nil, fmt.Errorf("form: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// formFields appends an incremental update to data that adds the fields
+// of fc as widget annotations to their pages, and the form to the
+// catalog.
+func formFields(data []byte, fc *FormConfig, widgets []formWidget) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+	catalog := pdfObject(data, string(root[1]))
+	pagesRef := rePages.FindSubmatch(catalog)
+	if pagesRef == nil {
+		return nil, errors.New("cannot find the page tree")
+	}
+	pagesObj := pdfObject(data, string(pagesRef[1]))
+	kids := reKids.FindSubmatch(pagesObj)
+	box := reMediaBox.FindSubmatch(pagesObj)
+	if kids == nil || box == nil {
+		return nil, errors.New("cannot parse the page tree")
+	}
+	pages := reRef.FindAllSubmatch(kids[1], -1)
+
+	// The fields with a page are placed now that the number of pages is
+	// known.
+	widgets = append([]formWidget(nil), widgets...)
+	for i, f := range fc.Fields {
+		if f.Page == 0 {
+			continue
+		}
+		page := f.Page
+		if page < 0 {
+			page += len(pages) + 1
+		}
+		if page < 1 || page > len(pages) {
+			return nil, fmt.Errorf("field %q: the report has no page %d", f.Name, f.Page)
+		}
+		widgets = append(widgets, formWidget{field: i, page: page, x: f.X, y: f.Y, w: f.Width, h: f.Height})
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	offsets := map[int]int{}
+	next := size
+	write := func(value string, stream []byte) int {
+		num := next
+		next++
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", num, value)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+		return num
+	}
+	appearance := func(w, h float64, content string) int {
+		return write(fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Length %d >>", w, h, len(content)), []byte(content))
+	}
+	helv := write("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	zapf := write("<< /Type /Font /Subtype /Type1 /BaseFont /ZapfDingbats >>", nil)
+
+	const k = 72 / 25.4 // points per mm
+	var fields []string
+	annots := make([][]string, len(pages))
+	for _, wd := range widgets {
+		f := fc.Fields[wd.field]
+		page := pdfObject(data, string(pages[wd.page-1][1]))
+		pw, ph := mediaBoxSize(string(box[1]))
+		if b := reMediaBox.FindSubmatch(page); b != nil {
+			pw, ph = mediaBoxSize(string(b[1]))
+		}
+		w, h := wd.w*k, wd.h*k
+		if wd.x < 0 || wd.y < 0 || wd.x*k+w > pw+0.01 || wd.y*k+h > ph+0.01 {
+			return nil, fmt.Errorf("field %q does not fit on page %d", f.Name, wd.page)
+		}
+		x, y := wd.x*k, ph-(wd.y+wd.h)*k
+		border := fmt.Sprintf("q 0 G 1 w 0.5 0.5 %.2f %.2f re S Q\n", w-1, h-1)
+		common := fmt.Sprintf("/Type /Annot /Subtype /Widget /T %s /TU %s /Rect [%.2f %.2f %.2f %.2f] /F 4 /P %s 0 R /MK << /BC [0 0 0] >> /BS << /W 1 /S /S >>",
+			pdfTextString(f.Name), pdfTextString(orDefault(f.Label, f.Name)), x, y, x+w, y+h, pages[wd.page-1][1])
+		var num int
+		if f.Type == "checkbox" {
+			check := fmt.Sprintf("q 0 g 0 G 1.5 w %.2f %.2f m %.2f %.2f l %.2f %.2f l S Q\n", w*0.22, h*0.5, w*0.42, h*0.25, w*0.8, h*0.78)
+			on := appearance(w, h, border+check)
+			off := appearance(w, h, border)
+			num = write(fmt.Sprintf("<< %s /FT /Btn /V /Off /AS /Off /DA (/ZaDb 0 Tf 0 g) /AP << /N << /Yes %d 0 R /Off %d 0 R >> >> >>", common, on, off), nil)
+		} else if f.Type == "signature" {
+			empty := appearance(w, h, border)
+			num = write(fmt.Sprintf("<< %s /FT /Sig /AP << /N %d 0 R >> >>", common, empty), nil)
+		} else {
+			flags := ""
+			if f.Type == "multiline" {
+				flags = " /Ff 4096"
+			}
+			empty := appearance(w, h, border+"/Tx BMC EMC\n")
+			num = write(fmt.Sprintf("<< %s /FT /Tx%s /V () /DA (/Helv 10 Tf 0 g) /AP << /N %d 0 R >> >>", common, flags, empty), nil)
+		}
+		ref := fmt.Sprintf("%d 0 R", num)
+		fields = append(fields, ref)
+		annots[wd.page-1] = append(annots[wd.page-1], ref)
+	}
+	form := write(fmt.Sprintf("<< /Fields [%s] /DA (/Helv 10 Tf 0 g) /DR << /Font << /Helv %d 0 R /ZaDb %d 0 R >> >> >>",
+		strings.Join(fields, " "), helv, zapf), nil)
+
+	// The pages get their widgets, and the catalog the form.
+	var updated []int // numbers and offsets of replaced objects
+	for i, refs := range annots {
+		if refs == nil {
+			continue
+		}
+		dict := pdfObjectValue(pdfObject(data, string(pages[i][1])))
+		add := " " + strings.Join(refs, " ")
+		var merged []byte
+		if _, vs, ve, ok := pdfDictEntry(dict, "Annots"); ok {
+			if !bytes.HasPrefix(dict[vs:], []byte("[")) {
+				return nil, fmt.Errorf("cannot parse page object %s", pages[i][1])
+			}
+			merged = append(append(append(merged, dict[:ve-1]...), add...), dict[ve-1:]...)
+		} else {
+			merged = withEntry(dict, "/Annots ["+add+" ]")
+		}
+		num, _ := strconv.Atoi(string(pages[i][1]))
+		updated = append(updated, num, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", num, merged)
+	}
+	dict := pdfObjectValue(catalog)
+	if _, _, _, ok := pdfDictEntry(dict, "AcroForm"); ok {
+		return nil, errors.New("the document has a form already")
+	}
+	num, _ := strconv.Atoi(string(root[1]))
+	updated = append(updated, num, buf.Len())
+	fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", num, withEntry(dict, fmt.Sprintf("/AcroForm %d 0 R", form)))
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(updated); i += 2 {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", updated[i], updated[i+1])
+	}
+	fmt.Fprintf(&buf, "%d %d\n", size, next-size)
+	for num := size; num < next; num++ {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[num])
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		next, root[1], info[1], m[1], xref)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFormConfig(t *testing.T) {
+	fc := &FormConfig{Fields: []FormField{{Name: "by"}, {Name: "notes", Type: "multiline"}, {Name: "ok", Type: "checkbox", Width: 8}, {Name: "sig", Type: "signature"}}}
+	if err := fc.prepare(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][3]interface{}{{"text", 60.0, 7.0}, {"multiline", 60.0, 20.0}, {"checkbox", 8.0, 5.0}, {"signature", 60.0, 15.0}}
+	for i, f := range fc.Fields {
+		if got := [3]interface{}{f.Type, f.Width, f.Height}; got != want[i] {
+			t.Errorf("field %s: %v, want %v", f.Name, got, want[i])
+		}
+	}
+
+	tests := []struct {
+		fields []FormField
+		cfg    Config
+		err    string
+	}{
+		{nil, Config{}, "fields required"},
+		{[]FormField{{Label: "By"}}, Config{}, "field 1: name required"},
+		{[]FormField{{Name: "a.b"}}, Config{}, `field "a.b": names must not contain dots`},
+		{[]FormField{{Name: "a"}, {Name: "a"}}, Config{}, `field "a": duplicate name`},
+		{[]FormField{{Name: "a", Type: "radio"}}, Config{}, `field "a": type must be`},
+		{[]FormField{{Name: "a", Height: -1}}, Config{}, `field "a": width and height must not be negative`},
+		{[]FormField{{Name: "a"}}, Config{Tagged: &TaggedConfig{}}, "form fields have no tags"},
+		{[]FormField{{Name: "a"}}, Config{Archive: &ArchiveConfig{}}, "form fields use fonts that are not embedded"},
+	}
+	for _, tt := range tests {
+		fc := &FormConfig{Fields: tt.fields}
+		if err := fc.prepare(&tt.cfg); err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%+v: got error %v, want %q", tt.fields, err, tt.err)
+		}
+	}
+}
+
+func TestFormFields(t *testing.T) {
+	fc := &FormConfig{Fields: []FormField{
+		{Name: "filed", Type: "checkbox", Page: 1, X: 10, Y: 20},
+		{Name: "Übersicht", Label: "Remarks", Type: "multiline", Page: -1, X: 10, Y: 20},
+		{Name: "sig", Type: "signature", Page: 2, X: 100, Y: 200},
+	}}
+	if err := fc.prepare(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := formFields(testPDF(t, 2), fc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageObjects(t, data)
+	// A4 is 841.89 points high; the fields are placed from the top.
+	for _, s := range []string{
+		"/FT /Btn /V /Off /AS /Off",
+		"/T (filed) /TU (filed) /Rect [28.35 771.02 42.52 785.20] /F 4 /P 3 0 R",
+		"/T <FEFF00DC00620065007200730069006300680074> /TU (Remarks) /Rect [28.35 728.50 198.43 785.20] /F 4 /P 5 0 R",
+		"/FT /Tx /Ff 4096 /V ()",
+		"/Rect [283.46 232.44 453.54 274.96] /F 4 /P 5 0 R",
+		"/FT /Sig",
+		"/Annots [ 14 0 R ]",
+		"/Annots [ 16 0 R 18 0 R ]",
+		"/AcroForm 19 0 R",
+		"/Fields [14 0 R 16 0 R 18 0 R]",
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("missing %q", s)
+		}
+	}
+
+	for _, tt := range []struct {
+		field FormField
+		err   string
+	}{
+		{FormField{Name: "a", Page: 3}, `field "a": the report has no page 3`},
+		{FormField{Name: "a", Page: -3}, `field "a": the report has no page -3`},
+		{FormField{Name: "a", Page: 1, X: 180, Y: 10}, `field "a" does not fit on page 1`},
+		{FormField{Name: "a", Page: 1, X: 10, Y: -1}, `field "a" does not fit on page 1`},
+	} {
+		fc := &FormConfig{Fields: []FormField{tt.field}}
+		if err := fc.prepare(&Config{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := formFields(testPDF(t, 2), fc, nil); err == nil || err.Error() != tt.err {
+			t.Errorf("%+v: got error %v, want %q", tt.field, err, tt.err)
+		}
+	}
+	if _, err := formFields(data, fc, nil); err == nil || err.Error() != "the document has a form already" {
+		t.Errorf("a second form: %v", err)
+	}
+}
+
+func TestForm(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Total\nApples,10\nPears,2\n",
+		"cfg.json": `{"form": {"title": "Approval", "fields": [
+			{"name": "approvedBy", "label": "Approved by", "width": 80},
+			{"name": "checked", "label": "Numbers checked", "type": "checkbox"},
+			{"name": "filed", "type": "checkbox", "page": 1, "x": 250, "y": 12}]}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	content := pageContents(t, []byte(data))
+	for _, s := range []string{"(Approval)Tj", "(Approved by)Tj", "(Numbers checked)Tj"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("missing %q in the block", s)
+		}
+	}
+	// The boxes of the block line up after the longest label.
+	rects := regexp.MustCompile(`/T \((\w+)\) /TU \([^)]*\) /Rect \[([\d.]+) `).FindAllStringSubmatch(data, -1)
+	if len(rects) != 3 {
+		t.Fatalf("fields %q", rects)
+	}
+	got := map[string]string{}
+	for _, r := range rects {
+		got[r[1]] = r[2]
+	}
+	if got["approvedBy"] != got["checked"] || got["filed"] != "708.66" {
+		t.Errorf("fields at %v", got)
+	}
+}
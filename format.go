@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ## Number formats
+
+// Measurement data spans many orders of magnitude. Printing such values
+// verbatim makes a column hard to read, so columns can opt into
+// scientific or engineering notation with a fixed number of significant
+// digits.
+
+// defaultDigits is used when a column does not specify its significant digits.
+const defaultDigits = 3
+
+// formatCell returns str formatted according to the column settings
+// and the locale, ready for printing. Values that are not numbers (or
+// dates, for date columns) are returned unchanged, apart from the
+// column's text transformations.
+func formatCell(str string, cc ColumnConfig, loc *locale) string {
+	return loc.printDir(formatText(str, cc, loc), cc.Direction)
+}
+
+// formatText is formatCell for text that is not printed with a PDF
+// font, such as that of the text version.
+func formatText(str string, cc ColumnConfig, loc *locale) string {
+	str = formatValue(str, cc)
+	if cc.Date != nil {
+		str = loc.dateNames(str)
+	} else {
+		str = loc.number(str)
+	}
+	return cc.Cache.transform(str, cc.Transform)
+}
+
+func formatValue(str string, cc ColumnConfig) string {
+	if cc.Date != nil {
+		return cc.Date.format(str)
+	}
+	if cc.Format == "" {
+		return str
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		// "NaN" and "Inf" parse as numbers, but have no digits.
+		return str
+	}
+	digits := cc.Digits
+	if digits < 1 {
+		digits = defaultDigits
+	}
+	switch cc.Format {
+	case "sci":
+		return formatSci(v, digits)
+	case "eng":
+		return formatEng(v, digits)
+	}
+	return str
+}
+
+// formatSci formats v as d.ddd×10^n, written as "d.dddE+n".
+func formatSci(v float64, digits int) string {
+	mant, exp := splitSig(v, digits)
+	return joinMantissa(mant, 1) + expSuffix(exp)
+}
+
+// formatEng formats v like formatSci, but restricts the exponent to
+// multiples of three so that the value maps onto SI prefixes.
+func formatEng(v float64, digits int) string {
+	mant, exp := splitSig(v, digits)
+	shift := exp % 3
+	if shift < 0 {
+		shift += 3
+	}
+	return joinMantissa(mant, shift+1) + expSuffix(exp-shift)
+}
+
+// splitSig rounds v to the given number of significant digits and
+// returns the digits (with an optional leading minus sign) and the
+// decimal exponent of the first digit.
+func splitSig(v float64, digits int) (string, int) {
+	s := strconv.FormatFloat(v, 'e', digits-1, 64)
+	i := strings.IndexByte(s, 'e')
+	exp, _ := strconv.Atoi(s[i+1:])
+	mant := strings.Replace(s[:i], ".", "", 1)
+	if v == 0 {
+		exp = 0
+	}
+	return mant, exp
+}
+
+// joinMantissa inserts the decimal point after intDigits digits,
+// padding with zeros if the mantissa is too short.
+func joinMantissa(mant string, intDigits int) string {
+	sign := ""
+	if strings.HasPrefix(mant, "-") {
+		sign, mant = "-", mant[1:]
+	}
+	for len(mant) < intDigits {
+		mant += "0"
+	}
+	if len(mant) == intDigits {
+		return sign + mant
+	}
+	return sign + mant[:intDigits] + "." + mant[intDigits:]
+}
+
+func expSuffix(exp int) string {
+	if exp < 0 {
+		return "E-" + strconv.Itoa(-exp)
+	}
+	return "E+" + strconv.Itoa(exp)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		format string
+		digits int
+		value  string
+		want   string
+	}{
+		{"", 0, "12345.678", "12345.678"},
+		{"sci", 0, "12345.678", "1.23E+4"},
+		{"sci", 5, "12345.678", "1.2346E+4"},
+		{"sci", 1, "0.00042", "4E-4"},
+		{"sci", 3, "-0.000123456", "-1.23E-4"},
+		{"sci", 3, "0", "0.00E+0"},
+		{"sci", 3, " 42 ", "4.20E+1"},
+		{"eng", 3, "12345.678", "12.3E+3"},
+		{"eng", 3, "123456", "123E+3"},
+		{"eng", 3, "0.00042", "420E-6"},
+		{"eng", 4, "-4700", "-4.700E+3"},
+		{"eng", 2, "999", "1.0E+3"},
+		{"sci", 3, "n/a", "n/a"},
+		{"sci", 3, "", ""},
+		{"sci", 3, "NaN", "NaN"},
+		{"sci", 3, "Inf", "Inf"},
+		{"eng", 3, "-inf", "-inf"},
+		{"eng", 3, "+Infinity", "+Infinity"},
+		{"sci", 3, "1e999", "1e999"},
+	}
+	for _, tt := range tests {
+		cc := ColumnConfig{Format: tt.format, Digits: tt.digits}
+		if got := formatValue(tt.value, cc); got != tt.want {
+			t.Errorf("formatValue(%q) with %s, %d digits = %q, want %q", tt.value, tt.format, tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareColumnSettings(t *testing.T) {
+	tests := []struct {
+		cc   ColumnConfig
+		want string // "" if the settings are valid
+	}{
+		{ColumnConfig{Name: "Mass", Format: "sci"}, ""},
+		{ColumnConfig{Name: "Mass", Format: "eng", Highlight: "bold"}, ""},
+		{ColumnConfig{Name: "Mass", Highlight: "outline"}, ""},
+		{ColumnConfig{Name: "Mass", Format: "scientific"}, `column "Mass": format must be sci or eng`},
+		{ColumnConfig{Name: "Mass", Format: "SCI"}, "format must be sci or eng"},
+		{ColumnConfig{Name: "Mass", Highlight: "Bold"}, `column "Mass": highlight must be bold or outline`},
+		{ColumnConfig{Name: "Mass", Highlight: "max"}, "highlight must be bold or outline"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Columns: []ColumnConfig{tt.cc}}
+		err := cfg.prepare()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s/%s: %v", tt.cc.Format, tt.cc.Highlight, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s/%s: prepare = %v, want an error with %q", tt.cc.Format, tt.cc.Highlight, err, tt.want)
+		}
+	}
+}
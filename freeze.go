@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ## Frozen columns
+
+// Some tables are wider than a landscape page. Instead of running off
+// the right edge, they can be printed in bands of columns, like a
+// spreadsheet prints its column pages: first all rows with the columns
+// that fit, then all rows with the next columns, and so on. The key
+// columns, which tell the rows apart, are frozen -- repeated at the left
+// of every band:
+//
+//	"freeze": {"columns": ["Order ID"]}
+//
+// Each band starts on a new page. Tables that fit the page are printed
+// as they are.
+
+// FreezeConfig splits wide tables into bands of columns.
+type FreezeConfig struct {
+	// Columns are the key columns, repeated in every band.
+	Columns []ColumnRef `json:"columns"`
+}
+
+func (fc *FreezeConfig) resolve(hdr []string) error {
+	for i := range fc.Columns {
+		if err := fc.Columns[i].resolve(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bands returns the columns of each band, key columns first, for a table
+// of n columns and the given available width. It returns nil if all
+// columns fit.
+func (fc *FreezeConfig) bands(cfg *Config, n int, available float64) [][]int {
+	if fc == nil {
+		return nil
+	}
+	// The rank column counts as a key column.
+	total, keyWidth := 0.0, 0.0
+	if cfg.Rank != nil {
+		total, keyWidth = rankWidth, rankWidth
+	}
+	for i := 0; i < n; i++ {
+		total += cfg.width(i)
+	}
+	if total <= available {
+		return nil
+	}
+	isKey := map[int]bool{}
+	var keys []int
+	for _, ref := range fc.Columns {
+		if !isKey[ref.Index] {
+			isKey[ref.Index] = true
+			keys = append(keys, ref.Index)
+			keyWidth += cfg.width(ref.Index)
+		}
+	}
+	var bands [][]int
+	band, w := append([]int{}, keys...), keyWidth
+	for i := 0; i < n; i++ {
+		if isKey[i] {
+			continue
+		}
+		// A band holds at least one column besides the keys, even if
+		// the column does not fit.
+		if w+cfg.width(i) > available && len(band) > len(keys) {
+			bands = append(bands, band)
+			band, w = append([]int{}, keys...), keyWidth
+		}
+		band = append(band, i)
+		w += cfg.width(i)
+	}
+	if len(band) > len(keys) || len(bands) == 0 {
+		bands = append(bands, band)
+	}
+	return bands
+}
+
+// bandedTable prints the header and the table once per band of columns.
+// Every band after the first starts on a new page and prints the rows
+// that the first band printed.
+func bandedTable(pdf *Fpdf, data *reportData, cfg *Config, prog *progress) *Fpdf {
+	w, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	bands := cfg.Freeze.bands(cfg, len(data.hdr), w-left-right)
+	if bands == nil {
+		header(pdf, data.hdr, cfg, prog)
+		prog.enter("table")
+		table(pdf, data.rows, cfg, data.invalid, prog)
+		return pdf
+	}
+	prog.event.TotalRows *= len(bands)
+	rows := data.rows
+	var truncated *truncation
+	for b, band := range bands {
+		bc := *cfg
+		bc.band = band
+		if b > 0 {
+			// The limits were applied to the first band.
+			bc.Limits = nil
+			prog.enter("header")
+			addPage(pdf, "")
+		}
+		header(pdf, data.hdr, &bc, prog)
+		prog.enter(fmt.Sprintf("table, band %d", b+1))
+		table(pdf, rows, &bc, data.invalid, prog)
+		if b == 0 && prog.truncated != nil {
+			truncated = prog.truncated
+			rows = rows[:truncated.shown]
+		}
+	}
+	prog.truncated = truncated
+	return pdf
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFreezeBands(t *testing.T) {
+	hdr := []string{"ID", "A", "B", "C", "D", "E"}
+	tests := []struct {
+		config    string
+		available float64
+		want      [][]int
+	}{
+		// 30 + 5 * 60 mm do not fit 250 mm, so the columns are split
+		// with the key column in front of each band.
+		{`{"freeze": {"columns": ["ID"]}}`, 250, [][]int{{0, 1, 2, 3}, {0, 4, 5}}},
+		{`{"freeze": {"columns": ["ID"]}}`, 330, nil},
+		// Key columns need not come first in the table.
+		{`{"freeze": {"columns": ["C", "ID", "C"]}}`, 250, [][]int{{3, 0, 1, 2}, {3, 0, 4, 5}}},
+		{`{"freeze": {}}`, 130, [][]int{{0, 1}, {2, 3}, {4, 5}}},
+		// Every band has a column besides the keys, even if it does not
+		// fit.
+		{`{"freeze": {"columns": ["ID"]}}`, 50, [][]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {0, 5}}},
+		// The rank column is frozen, too: without it, 280 mm would
+		// take the key and four columns.
+		{`{"freeze": {"columns": ["ID"]}, "rank": {"column": "A"}}`, 280, [][]int{{0, 1, 2, 3}, {0, 4, 5}}},
+		{`{}`, 100, nil},
+	}
+	for _, tt := range tests {
+		cfg := strings.Replace(tt.config, "{", `{"columns": [{"name": "ID", "width": 30}, {"name": "A", "width": 60}, {"name": "B", "width": 60},
+			{"name": "C", "width": 60}, {"name": "D", "width": 60}, {"name": "E", "width": 60}], `, 1)
+		fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(strings.Replace(cfg, ", }", "}", 1))})
+		c, err := loadConfig(fsys, "cfg.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.resolve(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Freeze.bands(c, len(hdr), tt.available); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s, %v mm: bands %v, want %v", tt.config, tt.available, got, tt.want)
+		}
+	}
+}
+
+func TestFrozenColumns(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "ID,A,B,C,D,E\nr1,a1,b1,c1,d1,e1\nr2,a2,b2,c2,d2,e2\n",
+		"cfg.json": `{"freeze": {"columns": ["ID"]}, "columns": [{"name": "ID", "width": 30}, {"name": "A", "width": 60}, {"name": "B", "width": 60},
+			{"name": "C", "width": 60}, {"name": "D", "width": 60}, {"name": "E", "width": 60}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	if n := strings.Count(data, "/Type /Page\n"); n != 2 {
+		t.Errorf("%d pages, want one per band", n)
+	}
+	// Each band prints the header and all rows, with the key column.
+	content := pageContents(t, []byte(data))
+	first := content[:strings.LastIndex(content, "(ID)Tj")]
+	if strings.Contains(first, "(D)Tj") || strings.Contains(first, "(d1)Tj") {
+		t.Error("the first band has column D")
+	}
+	rest := content
+	for _, s := range []string{
+		"(ID)Tj", "(A)Tj", "(B)Tj", "(C)Tj", "(r1)Tj", "(a1)Tj", "(c1)Tj", "(r2)Tj", "(c2)Tj",
+		"(ID)Tj", "(D)Tj", "(E)Tj", "(r1)Tj", "(d1)Tj", "(e1)Tj", "(r2)Tj", "(e2)Tj",
+	} {
+		i := strings.Index(rest, s)
+		if i < 0 {
+			t.Fatalf("%q is missing or out of order", s)
+		}
+		rest = rest[i+len(s):]
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// ## Data freshness
+
+// The date below the title tells when the report was made, not how old
+// its numbers are. A CSV export may be days old, while a query or an API
+// call returns live data. With freshness enabled, every section that
+// shows data prints when that data was last refreshed beneath its
+// caption: the modification time of a file, or the time of a query or
+// API call.
+
+// FreshnessConfig prints data timestamps.
+type FreshnessConfig struct {
+	// Format is the time layout. Default: "Jan 2, 2006 15:04 MST" or
+	// the equivalent of the locale.
+	Format string `json:"format"`
+
+	// Label precedes the time. Default: "Data as of", in the language
+	// of the report.
+	Label string `json:"label"`
+
+	data time.Time // when the table data was refreshed
+	loc  *locale
+}
+
+// ModTimeFS is implemented by file systems that know when a file was
+// last modified.
+type ModTimeFS interface {
+	ModTime(name string) (time.Time, error)
+}
+
+// ModTime returns the modification time of the named file.
+func (osFileSystem) ModTime(name string) (time.Time, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// fileTime returns when the named file was last modified, or the current
+// time if the file system cannot tell.
+func fileTime(env *Env, name string) time.Time {
+	if mfs, ok := env.FS.(ModTimeFS); ok {
+		if t, err := mfs.ModTime(name); err == nil {
+			return t
+		}
+	}
+	return env.Clock.Now()
+}
+
+// stamp prints the data timestamp t as a small line of width w. It does
+// nothing if f is nil.
+func (f *FreshnessConfig) stamp(pdf *Fpdf, w float64, align string, t time.Time) {
+	if f == nil {
+		return
+	}
+	pdf.SetFont("Times", "I", 9)
+	pdf.SetTextColor(96, 96, 96)
+	pdf.CellFormat(w, 5, f.locale().print(f.text(t)), "", 1, align, false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// text returns the line of the stamp for the data timestamp t.
+func (f *FreshnessConfig) text(t time.Time) string {
+	loc := f.locale()
+	return orDefault(f.Label, loc.msg("dataAsOf")) + " " + loc.date(t, orDefault(f.Format, loc.timestamp))
+}
+
+// locale returns the locale of the stamp.
+func (f *FreshnessConfig) locale() *locale {
+	if f.loc == nil {
+		return defaultLocale
+	}
+	return f.loc
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// modTimeFS adds modification times to a file system.
+type modTimeFS struct {
+	FileSystem
+	times map[string]time.Time
+}
+
+func (m modTimeFS) ModTime(name string) (time.Time, error) {
+	t, ok := m.times[name]
+	if !ok {
+		return time.Time{}, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return t, nil
+}
+
+func TestFreshnessText(t *testing.T) {
+	de, err := newLocale("de", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2024, 3, 14, 8, 5, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		f    *FreshnessConfig
+		want string
+	}{
+		{&FreshnessConfig{}, "Data as of Mar 14, 2024 08:05 UTC"},
+		{&FreshnessConfig{Label: "Exported", Format: "2006-01-02"}, "Exported 2024-03-14"},
+		{&FreshnessConfig{loc: de}, "Datenstand 14.03.2024 08:05 UTC"},
+	} {
+		if got := tt.f.text(ts); got != tt.want {
+			t.Errorf("text = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\nPears,x\n",
+		"cfg.json": `{"freshness": {}, "schema": {"columns": [{"name": "Total", "type": "int"}], "onError": "appendix"}}`,
+	})
+	env.FS = modTimeFS{env.FS, map[string]time.Time{
+		"in.csv":    time.Date(2024, 3, 14, 8, 0, 0, 0, time.UTC),
+		"stats.png": time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}}
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	// The table and the appendix show the data of the input file, the
+	// image is as old as its own file.
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	if n := strings.Count(content, "(Data as of Mar 14, 2024 08:00 UTC)Tj"); n != 2 {
+		t.Errorf("%d stamps for the input file, want 2 (table and appendix)", n)
+	}
+	if !strings.Contains(content, "(Data as of Mar 1, 2024 12:00 UTC)Tj") {
+		t.Error("the image has no stamp")
+	}
+
+	// Without modification times, the data is as fresh as the report.
+	env = testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n", "cfg.json": `{"freshness": {"label": "Stand:"}}`})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content = pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	if n := strings.Count(content, "(Stand: Mar 15, 2024 10:30 UTC)Tj"); n != 2 {
+		t.Errorf("%d stamps with the report time, want 2 (table and image)", n)
+	}
+}
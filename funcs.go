@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ## Template functions
+
+// Templated strings -- narrative text, file names, email subjects -- often
+// need to format a number or shift a date. These functions are available
+// in all of them. Arguments are ordered so that the value can be piped
+// in, as in {{.Total | currency "$"}}.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"currency":   tmplCurrency,
+		"pct":        tmplPct,
+		"humanize":   tmplHumanize,
+		"round":      tmplRound,
+		"lookup":     tmplLookup,
+		"pluralize":  tmplPluralize,
+		"addDays":    tmplAddDays,
+		"addMonths":  tmplAddMonths,
+		"formatDate": tmplFormatDate,
+		"parseDate":  tmplParseDate,
+	}
+}
+
+// tmplCurrency formats v with two decimals, thousands separators, and
+// the given symbol: currency "$" 1234.5 yields "$1,234.50".
+func tmplCurrency(symbol string, v interface{}) (string, error) {
+	return defaultLocale.currency(symbol, v)
+}
+
+// tmplPct formats a fraction as a percentage with one decimal: pct 0.1234
+// yields "12.3%".
+func tmplPct(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f*100, 'f', 1, 64) + "%", nil
+}
+
+// tmplHumanize abbreviates large numbers: humanize 1234567 yields "1.2M".
+func tmplHumanize(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	abs := math.Abs(f)
+	for _, u := range []struct {
+		limit  float64
+		suffix string
+	}{{1e12, "T"}, {1e9, "B"}, {1e6, "M"}, {1e3, "k"}} {
+		if abs >= u.limit {
+			return strconv.FormatFloat(f/u.limit, 'f', 1, 64) + u.suffix, nil
+		}
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// tmplRound rounds v to the given number of decimal places.
+func tmplRound(places int, v interface{}) (float64, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p, nil
+}
+
+// tmplLookup maps key through a list of key/value pairs, returning key
+// itself if it is not found: lookup "A" "A" "Active" "I" "Inactive"
+// yields "Active".
+func tmplLookup(key string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("lookup: odd number of key/value arguments")
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i] == key {
+			return pairs[i+1], nil
+		}
+	}
+	return key, nil
+}
+
+// tmplPluralize returns the count followed by the singular or plural
+// noun: pluralize 3 "row" "rows" yields "3 rows".
+func tmplPluralize(n interface{}, singular, plural string) (string, error) {
+	f, err := toFloat(n)
+	if err != nil {
+		return "", err
+	}
+	noun := plural
+	if f == 1 {
+		noun = singular
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) + " " + noun, nil
+}
+
+// pluralize is tmplPluralize for Go code.
+func pluralize(n int, singular, plural string) string {
+	s, _ := tmplPluralize(n, singular, plural)
+	return s
+}
+
+func tmplAddDays(days int, t time.Time) time.Time     { return t.AddDate(0, 0, days) }
+func tmplAddMonths(months int, t time.Time) time.Time { return t.AddDate(0, months, 0) }
+
+func tmplFormatDate(layout string, t time.Time) string { return t.Format(layout) }
+
+func tmplParseDate(layout, s string) (time.Time, error) { return time.Parse(layout, s) }
+
+// toFloat converts template values to float64.
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// groupThousands inserts commas into the integer part of a formatted
+// non-negative number.
+func groupThousands(s string) string {
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i:]
+	}
+	var sb strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String() + frac
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"Total": 1234.5,
+		"Share": "0.1234",
+		"Rows":  1,
+		"Big":   -1234567,
+		"Date":  time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{`{{.Total | currency "$"}}`, "$1,234.50"},
+		{`{{currency "€" 0.005}}`, "€0.01"},
+		{`{{currency "$" 1000000}}`, "$1,000,000.00"},
+		{`{{.Share | pct}}`, "12.3%"},
+		{`{{.Big | humanize}}`, "-1.2M"},
+		{`{{humanize 999}} {{humanize 1500}} {{humanize 2.5e9}} {{humanize 3e12}}`, "999 1.5k 2.5B 3.0T"},
+		{`{{.Total | round 0}} {{round 2 3.14159}}`, "1235 3.14"},
+		{`{{lookup "A" "A" "Active" "I" "Inactive"}} {{lookup "X" "A" "Active"}}`, "Active X"},
+		{`{{pluralize .Rows "row" "rows"}}, {{pluralize 3 "row" "rows"}}`, "1 row, 3 rows"},
+		{`{{.Date | addDays 1 | formatDate "2006-01-02"}}`, "2024-02-01"},
+		{`{{.Date | addMonths 1 | formatDate "Jan 2"}}`, "Mar 2"},
+		{`{{parseDate "02.01.2006" "15.03.2024" | formatDate "Monday"}}`, "Friday"},
+	}
+	for _, tt := range tests {
+		tmpl, err := template.New("").Funcs(templateFuncs()).Parse(tt.tmpl)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.tmpl, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil || b.String() != tt.want {
+			t.Errorf("%s = %q, %v; want %q", tt.tmpl, b.String(), err, tt.want)
+		}
+	}
+}
+
+func TestTemplateFuncErrors(t *testing.T) {
+	for _, tt := range []struct {
+		tmpl, err string
+	}{
+		{`{{currency "$" "lots"}}`, `strconv.ParseFloat: parsing "lots": invalid syntax`},
+		{`{{pct true}}`, "not a number: true"},
+		{`{{lookup "A" "A"}}`, "lookup: odd number of key/value arguments"},
+		{`{{parseDate "2006-01-02" "tomorrow"}}`, `cannot parse "tomorrow"`},
+	} {
+		tmpl := template.Must(template.New("").Funcs(templateFuncs()).Parse(tt.tmpl))
+		if err := tmpl.Execute(&strings.Builder{}, nil); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want %q", tt.tmpl, err, tt.err)
+		}
+	}
+}
@@ -2,6 +2,16 @@ module github.com/appliedgo/pdf
 
 go 1.13
 
-require github.com/jung-kurt/gofpdf v1.16.2
+require (
+	github.com/go-pdf/fpdf v0.6.0
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/phpdave11/gofpdi v1.0.13
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/text v0.3.6
+	sigs.k8s.io/yaml v1.3.0
+)
 
 replace github.com/jung-kurt/gofpdf => /Users/christoph/dev/go/others/gofpdf
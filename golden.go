@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ## Golden files
+
+// A change to the layout code can move a line by a millimeter on page 7
+// of one report, and nobody notices. A regression test catches this by
+// comparing each report with a known-good "golden" copy, byte by byte:
+//
+//	pdf -config sales.json -golden testdata/golden sales.csv
+//
+// compares the report with testdata/golden/report.pdf and fails if they
+// differ, leaving the new version next to the golden file as
+// report.pdf.new. After checking the new version, `-update-golden`
+// makes it the golden file. Golden runs write and send nothing else.
+//
+// Equal data must render to equal bytes, so golden runs imply
+// deterministic mode, and the clock stands still at goldenTime unless
+// `-now` sets another time.
+
+// goldenTime is the time of golden runs without `-now`.
+var goldenTime = time.Date(2017, 11, 17, 12, 0, 0, 0, time.UTC)
+
+// parseNow parses the value of `-now`, a date or an RFC 3339 time.
+func parseNow(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-now: want a date (2006-01-02) or an RFC 3339 time: %w", err)
+	}
+	return t, nil
+}
+
+// checkGolden finishes the document of part p and compares it with its
+// golden file -- or, with job.UpdateGolden, replaces the golden file.
+func checkGolden(env *Env, cfg *Config, job *Job, pdf *Fpdf, p *part) error {
+	got, err := finishPDF(pdf, cfg.finishers(env, p.tags, p.fields)...)
+	if err != nil {
+		return fmt.Errorf("cannot save PDF: %w", err)
+	}
+	path := filepath.Join(job.Golden, filepath.Base(p.output))
+	if job.UpdateGolden {
+		if err := writeOutput(env.FS, path, got); err != nil {
+			return fmt.Errorf("cannot update golden file: %w", err)
+		}
+		return nil
+	}
+	want, err := readFile(env.FS, path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("golden file '%s' does not exist; run with -update-golden to create it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read golden file: %w", err)
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+	if err := writeOutput(env.FS, path+".new", got); err != nil {
+		return fmt.Errorf("cannot save PDF: %w", err)
+	}
+	return fmt.Errorf("%s differs from golden file '%s'; see '%s.new'", filepath.Base(p.output), path, path)
+}
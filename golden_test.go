@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGolden(t *testing.T) {
+	env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n"})
+	golden := filepath.Join("golden", "out.pdf")
+	run := func(update bool) error {
+		return generate(env, &Job{Input: "in.csv", Output: filepath.Join("reports", "out.pdf"), Golden: "golden", UpdateGolden: update})
+	}
+
+	err := run(false)
+	if err == nil || !strings.Contains(err.Error(), "golden file '"+golden+"' does not exist; run with -update-golden") {
+		t.Fatalf("missing golden file: %v", err)
+	}
+	if err := run(true); err != nil {
+		t.Fatal(err)
+	}
+	want := testFile(t, env, golden)
+	if err := run(false); err != nil {
+		t.Errorf("an unchanged report differs from its golden file: %v", err)
+	}
+
+	f, err := env.FS.Create("in.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("Item,Total\nApples,11\n"))
+	f.Close()
+	err = run(false)
+	if err == nil || !strings.Contains(err.Error(), "out.pdf differs from golden file '"+golden+"'; see '"+golden+".new'") {
+		t.Errorf("changed report: %v", err)
+	}
+	if testFile(t, env, golden) != want {
+		t.Error("a failed comparison changed the golden file")
+	}
+	if testFile(t, env, golden+".new") == want {
+		t.Error("the new version equals the golden file")
+	}
+	if got, _ := env.FS.Glob(filepath.Join("reports", "*")); len(got) != 0 {
+		t.Errorf("golden runs wrote reports: %q", got)
+	}
+}
+
+func TestParseNow(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-03-15", time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local)},
+		{"2024-03-15T08:30:00Z", time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC)},
+	} {
+		got, err := parseNow(tt.in)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseNow(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseNow("15.03.2024"); err == nil || !strings.Contains(err.Error(), "-now: want a date") {
+		t.Errorf("parseNow of a bad date: %v", err)
+	}
+}
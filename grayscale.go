@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// ## Grayscale printing
+
+// Most copies of the report end up on a mono office printer, where a
+// red fill and a green fill come out as the same gray. A report for such
+// printers is made with `-grayscale`, or in the configuration:
+//
+//	"grayscale": true
+//
+// Every color becomes the gray of the same brightness, the logo
+// included, and what the colors said is said by shapes as well:
+//
+//   - invalid rows get a "!" in the margin, added rows a "+"
+//   - changed values get a triangle in the corner of the cell
+//   - heat maps run from light gray for the smallest values to dark gray
+//     for the largest
+//   - links are underlined
+//   - callouts have a thin border for "info", a dashed one for
+//     "warning", and a thick one for "error"
+//
+// Badges have their labels, and trends their words, so they need no
+// further cue. The colors are converted in the finished document, so
+// that those of cell renderers and render hooks are converted, too.
+
+// grayLevel returns the brightness of a color as a gray level on the
+// scale of its components.
+func grayLevel(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// reColorOp matches the operators that set an RGB fill or stroke color.
+var reColorOp = regexp.MustCompile(`(^|\s)([\d.]+) ([\d.]+) ([\d.]+) (rg|RG)\b`)
+
+// grayContent replaces the RGB colors of a content stream with gray
+// levels.
+func grayContent(content []byte) []byte {
+	return reColorOp.ReplaceAllFunc(content, func(op []byte) []byte {
+		m := reColorOp.FindSubmatch(op)
+		var c [3]float64
+		for i := range c {
+			c[i], _ = strconv.ParseFloat(string(m[i+2]), 64)
+		}
+		gray := "g"
+		if string(m[5]) == "RG" {
+			gray = "G"
+		}
+		return []byte(fmt.Sprintf("%s%.3f %s", m[1], grayLevel(c[0], c[1], c[2]), gray))
+	})
+}
+
+// grayscaleFinisher returns the post-processing step for savePDF that
+// converts the colors of all pages. It must run before the steps that
+// copy or append pages.
+func grayscaleFinisher() func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		data, err := grayPages(data)
+		if err != nil {
+			return nil, fmt.Errorf("grayscale: %s", err)
+		}
+		return data, nil
+	}
+}
+
+// grayPages appends an incremental update that replaces the content
+// streams of all pages with their grayscale versions.
+func grayPages(data []byte) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	size := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || size == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	pagesRef := rePages.FindSubmatch(pdfObject(data, string(root[1])))
+	if pagesRef == nil {
+		return nil, errors.New("cannot find the page tree")
+	}
+	kids := reKids.FindSubmatch(pdfObject(data, string(pagesRef[1])))
+	if kids == nil {
+		return nil, errors.New("cannot parse the page tree")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	var updated []int // numbers and offsets of replaced objects
+	for _, ref := range reRef.FindAllSubmatch(kids[1], -1) {
+		contents := reContents.FindSubmatch(pdfObject(data, string(ref[1])))
+		if contents == nil {
+			return nil, fmt.Errorf("cannot parse page object %s", ref[1])
+		}
+		content, filter, err := contentStream(data, string(contents[1]))
+		if err != nil {
+			return nil, err
+		}
+		switch filter {
+		case "":
+			content = grayContent(content)
+		case "FlateDecode":
+			if content, err = inflate(content); err != nil {
+				return nil, fmt.Errorf("content stream %s: %s", contents[1], err)
+			}
+			content = deflate(grayContent(content))
+		default:
+			return nil, fmt.Errorf("content stream %s has the unsupported filter %s", contents[1], filter)
+		}
+		num, _ := strconv.Atoi(string(contents[1]))
+		updated = append(updated, num, buf.Len())
+		if filter != "" {
+			filter = " /Filter /" + filter
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n<<%s /Length %d >>\nstream\n", num, filter, len(content))
+		buf.Write(content)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(updated); i += 2 {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", updated[i], updated[i+1])
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %s\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		size[1], root[1], info[1], m[1], xref)
+	return buf.Bytes(), nil
+}
+
+// inflate decompresses a stream with the FlateDecode filter.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// deflate compresses a stream for the FlateDecode filter.
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+// grayPicture shows an image in gray.
+type grayPicture struct {
+	stdimage.Image
+}
+
+func (gp grayPicture) ColorModel() color.Model { return color.NRGBAModel }
+
+func (gp grayPicture) At(x, y int) color.Color {
+	c := color.NRGBAModel.Convert(gp.Image.At(x, y)).(color.NRGBA)
+	v := uint8(grayLevel(float64(c.R), float64(c.G), float64(c.B)) + 0.5)
+	return color.NRGBA{R: v, G: v, B: v, A: c.A}
+}
+
+// grayPNG returns the PNG image read from r in gray, as a PNG image.
+func grayPNG(r io.Reader) ([]byte, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, grayPicture{img}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// grayHeat returns the gray of a heat map cell at position t of the
+// scale, from 0 to 1.
+func grayHeat(t float64) [3]int {
+	t = math.Max(0, math.Min(t, 1))
+	v := 245 - int(t*150+0.5)
+	return [3]int{v, v, v}
+}
+
+// rowMark prints mark in the margin next to the row that was just
+// printed, h high, which ends at the current position: before the row,
+// or after it in right-to-left documents.
+func rowMark(pdf Backend, cfg *Config, mark string, h float64) {
+	x, y := pdf.GetXY()
+	left, _, _, _ := pdf.GetMargins()
+	size, _ := pdf.GetFontSize()
+	pdf.SetFont("Times", "B", 12)
+	pdf.SetX(left - 6)
+	if cfg.rtl() {
+		pdf.SetX(x)
+	}
+	pdf.CellFormat(6, h, mark, "", 0, "C", false, 0, "")
+	pdf.SetFont("Times", "", size)
+	pdf.SetXY(x, y)
+}
+
+// changedMark draws a triangle into the top right corner of the cell
+// that was just printed, which ends at the current position.
+func changedMark(pdf Backend) {
+	x, y := pdf.GetXY()
+	r, g, b := pdf.GetFillColor()
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Polygon([]PointType{{X: x - 2.5, Y: y}, {X: x, Y: y}, {X: x, Y: y + 2.5}}, "F")
+	pdf.SetFillColor(r, g, b)
+}
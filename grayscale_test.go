@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGrayContent(t *testing.T) {
+	in := "1.000 0.000 0.000 rg\nq 0 0 1 RG BT (red)Tj ET Q\n0.5 0.5 0.5 rg 10 20 re f\n1 2 3 4 re 0.1 rg"
+	want := "0.299 g\nq 0.114 G BT (red)Tj ET Q\n0.500 g 10 20 re f\n1 2 3 4 re 0.1 rg"
+	if got := string(grayContent([]byte(in))); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGrayPNG(t *testing.T) {
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	img.Set(1, 0, color.NRGBA{G: 255, A: 128})
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	data, err := grayPNG(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range []color.NRGBA{{76, 76, 76, 255}, {150, 150, 150, 128}} {
+		if got := color.NRGBAModel.Convert(gray.At(x, 0)); got != want {
+			t.Errorf("pixel %d is %v, want %v", x, got, want)
+		}
+	}
+	if _, err := grayPNG(strings.NewReader("GIF89a")); err == nil {
+		t.Error("an image that is not a PNG image is converted")
+	}
+}
+
+func TestGrayHeat(t *testing.T) {
+	for _, tt := range []struct {
+		t    float64
+		want int
+	}{{0, 245}, {0.5, 170}, {1, 95}, {-1, 245}, {2, 95}} {
+		if got := grayHeat(tt.t); got != [3]int{tt.want, tt.want, tt.want} {
+			t.Errorf("grayHeat(%g) = %v, want gray %d", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	env := testEnv(map[string]string{
+		"prev.csv": "ID,Total\n1,10\n2,20\n4,1\n",
+		"in.csv":   "ID,Total\n1,10\n2,25\n3,30\n4,x\n",
+		"cfg.json": `{"diff": {"key": ["ID"]}, "schema": {"onError": "highlight", "columns": [{"name": "Total", "type": "int"}]}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Previous: "prev.csv", Output: "out.pdf", Grayscale: true}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	if rgb := regexp.MustCompile(`[\d.]+ [\d.]+ [\d.]+ (rg|RG)\b`).FindString(content); rgb != "" {
+		t.Errorf("the report has the color %q", rgb)
+	}
+	// The added row has a "+", the invalid one a "!", and changed values
+	// a triangle in the top right corner of their cell.
+	for _, s := range []string{
+		"BT 16.43 419.89 Td (+)Tj",
+		"BT 17.85 400.05 Td (!)Tj",
+		"0.000 g\n248.04 453.26 m\n255.12165 453.25630 l \n255.12165 446.16969 l \n248.03504 453.25630 l \nf\n",
+	} {
+		if !strings.Contains(content, s) {
+			t.Errorf("missing %q in\n%s", s, content)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// ## Groups and subtotals
+
+// Orders of the same day, sales of the same region: rows often come in
+// groups. With a group column, each run of consecutive rows with the
+// same value in that column is followed by a subtotal row. The input is
+// expected to be sorted by the group column, unless "sort" sorts it:
+// numbers by value, text in the order of the report's language (see
+// collate), so that "Österreich" is grouped between "Norge" and
+// "Polska".
+//
+// A group that starts near the bottom of a page would be split across
+// two pages. If only a little space is left after a subtotal row and the
+// next group does not fit, the page is broken right after the subtotal
+// instead. Groups that are split anyway keep a few rows together: a
+// group does not start with a lone row at the bottom of a page, and its
+// subtotal row does not end up at the top of a page without the rows it
+// sums up.
+
+// GroupConfig enables grouping.
+type GroupConfig struct {
+	// Column is the column whose values define the groups.
+	Column ColumnRef `json:"column"`
+
+	// Sum lists the columns to add up in the subtotal rows.
+	Sum []ColumnRef `json:"sum"`
+
+	// Sort sorts the rows by the group column before grouping them.
+	// Rows of the same group keep their order.
+	Sort bool `json:"sort"`
+
+	// BreakTolerance is the space in mm that may be left empty at the
+	// bottom of a page to keep the next group together. Default: 40.
+	// A negative value disables the soft page break.
+	BreakTolerance float64 `json:"breakTolerance"`
+
+	// MinRows is the number of rows of a group that a page break leaves
+	// together, at the bottom of a page where the group starts and at
+	// the top of the page with its subtotal row. Default: 2. A negative
+	// value disables it.
+	MinRows int `json:"minRows"`
+}
+
+// sort sorts rows by the group column and moves the marks of invalid
+// rows along. The group column may be a computed one.
+func (gc *GroupConfig) sort(cfg *Config, hdr []string, rows [][]string, invalid map[int]bool) ([][]string, map[int]bool) {
+	keys := cfg.computeRows(hdr, rows)
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a := strings.TrimSpace(cellAt(keys[order[i]], gc.Column.Index))
+		b := strings.TrimSpace(cellAt(keys[order[j]], gc.Column.Index))
+		return compareValues(a, b, cfg.locale()) < 0
+	})
+	sorted := make([][]string, len(rows))
+	var moved map[int]bool
+	for to, from := range order {
+		sorted[to] = rows[from]
+		if invalid[from] {
+			if moved == nil {
+				moved = map[int]bool{}
+			}
+			moved[to] = true
+		}
+	}
+	return sorted, moved
+}
+
+// groupEnds reports whether row r is the last row of its group.
+func (gc *GroupConfig) groupEnds(tbl [][]string, r int) bool {
+	if r == len(tbl)-1 {
+		return true
+	}
+	i := gc.Column.Index
+	return cellAt(tbl[r], i) != cellAt(tbl[r+1], i)
+}
+
+// groupSize returns the number of rows of the group that starts at row r.
+func (gc *GroupConfig) groupSize(tbl [][]string, r int) int {
+	n := 1
+	for !gc.groupEnds(tbl, r+n-1) {
+		n++
+	}
+	return n
+}
+
+// subtotalRow prints the subtotal row for the rows of one group.
+func (gc *GroupConfig) subtotalRow(pdf Backend, cfg *Config, group [][]string, ncols int, h float64) {
+	pdf.SetFontStyle("B")
+	pdf.SetFillColor(240, 240, 240)
+	border, restore := cfg.CellStyle.begin(pdf, "body")
+	defer restore()
+	if cfg.Rank != nil && !cfg.rtl() {
+		pdf.CellFormat(rankWidth, h, "", border, 0, "", true, 0, "")
+	}
+	for _, i := range cfg.columnOrder(ncols) {
+		str, align := "", "R"
+		switch {
+		case i == gc.Column.Index:
+			str, align = cfg.locale().text("subtotal", cellAt(group[0], i)), "L"
+		case gc.sums(i):
+			var sum decimalSum
+			for _, line := range group {
+				sum.add(cellAt(line, i))
+			}
+			str = formatCell(cfg.locale().rounding.format(&sum.sum, sum.places), cfg.column(i), cfg.locale())
+		}
+		cfg.fallback.cell(pdf, "B", cfg.width(i), h, str, border, 0, cfg.mirrored(cfg.column(i), align), true)
+	}
+	if cfg.Rank != nil && cfg.rtl() {
+		pdf.CellFormat(rankWidth, h, "", border, 0, "", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFontStyle("")
+	pdf.SetFillColor(255, 255, 255)
+}
+
+func (gc *GroupConfig) sums(i int) bool {
+	for _, ref := range gc.Sum {
+		if ref.Index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// softBreak starts a new page if the next group, n rows plus its
+// subtotal, does not fit on the current page and the space left is
+// within the tolerance.
+func (gc *GroupConfig) softBreak(pdf Backend, n int, h float64) {
+	tolerance := gc.BreakTolerance
+	if tolerance == 0 {
+		tolerance = 40
+	}
+	left := spaceLeft(pdf)
+	if float64(n+1)*h > left && left <= tolerance {
+		addPage(pdf, "")
+	}
+}
+
+// keepTogether starts a new page before row r of the group that starts
+// at row start and has n rows, if the page break would leave fewer than
+// MinRows rows of the group on either page.
+func (gc *GroupConfig) keepTogether(pdf Backend, start, n, r int, h float64) {
+	min := gc.MinRows
+	if min == 0 {
+		min = 2
+	}
+	if min < 0 {
+		return
+	}
+	var need int
+	switch {
+	case r == start && n <= min:
+		// A short group goes to the next page as a whole, with its
+		// subtotal row.
+		need = n + 1
+	case r == start:
+		need = min
+	case start+n-r == min:
+		// The last rows stay with the subtotal row.
+		need = min + 1
+	default:
+		return
+	}
+	if float64(need)*h > spaceLeft(pdf) {
+		addPage(pdf, "")
+	}
+}
+
+// spaceLeft returns the space between the current position and the
+// bottom margin.
+func spaceLeft(pdf Backend) float64 {
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	return pageHeight - bottom - pdf.GetY()
+}
+
+// cellAt returns column i of line, or "" if the line is too short.
+func cellAt(line []string, i int) string {
+	if i < len(line) {
+		return line[i]
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupSort(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"locale": "de", "group": {"column": "Country", "sort": true}}`)})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := []string{"Country", "Total"}
+	if err := cfg.resolve(hdr); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{{"Polska", "1"}, {"Österreich", "2"}, {"Norge", "3"}, {"Polska", "4"}}
+	sorted, invalid := cfg.Group.sort(cfg, hdr, rows, map[int]bool{1: true})
+	want := [][]string{{"Norge", "3"}, {"Österreich", "2"}, {"Polska", "1"}, {"Polska", "4"}}
+	if !reflect.DeepEqual(sorted, want) {
+		t.Errorf("sorted %q, want %q", sorted, want)
+	}
+	if want := map[int]bool{1: true}; !reflect.DeepEqual(invalid, want) {
+		t.Errorf("invalid rows %v, want %v", invalid, want)
+	}
+	if _, invalid := cfg.Group.sort(cfg, hdr, rows, nil); invalid != nil {
+		t.Errorf("invalid rows %v, want none", invalid)
+	}
+}
+
+func TestGroupSize(t *testing.T) {
+	gc := &GroupConfig{Column: ColumnRef{Index: 0}}
+	tbl := [][]string{{"East"}, {"East"}, {"West"}, {"North"}, {"North"}, {"North"}}
+	var ends []int
+	for r := range tbl {
+		if gc.groupEnds(tbl, r) {
+			ends = append(ends, r)
+		}
+	}
+	if want := []int{1, 2, 5}; !reflect.DeepEqual(ends, want) {
+		t.Errorf("groups end at rows %v, want %v", ends, want)
+	}
+	for start, want := range map[int]int{0: 2, 2: 1, 3: 3, 4: 2} {
+		if got := gc.groupSize(tbl, start); got != want {
+			t.Errorf("groupSize(%d) = %d, want %d", start, got, want)
+		}
+	}
+}
+
+// pageWithSpace returns a document whose current position is left mm
+// above the bottom margin.
+func pageWithSpace(left float64) *Fpdf {
+	pdf := newPDF("P", "mm", "A4", "")
+	pdf.AddPage()
+	_, h := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	pdf.SetY(h - bottom - left)
+	return pdf
+}
+
+func TestSoftBreak(t *testing.T) {
+	tests := []struct {
+		tolerance, left float64
+		rows            int
+		wantBreak       bool
+	}{
+		{0, 30, 5, true},   // 6 rows of 7 mm do not fit into 30 mm
+		{0, 30, 3, false},  // 4 rows fit
+		{0, 50, 10, false}, // too much space would be left empty
+		{60, 50, 10, true}, // within a larger tolerance
+		{20, 30, 5, false}, // beyond a smaller tolerance
+	}
+	for _, tt := range tests {
+		pdf := pageWithSpace(tt.left)
+		(&GroupConfig{BreakTolerance: tt.tolerance}).softBreak(pdf, tt.rows, 7)
+		if got := pdf.PageNo() == 2; got != tt.wantBreak {
+			t.Errorf("%d rows, %v mm left, tolerance %v: page break %v, want %v", tt.rows, tt.left, tt.tolerance, got, tt.wantBreak)
+		}
+	}
+}
+
+func TestKeepTogether(t *testing.T) {
+	tests := []struct {
+		minRows     int
+		left        float64
+		start, n, r int
+		wantBreak   bool
+	}{
+		{0, 10, 0, 5, 0, true},  // a group does not start with a lone row
+		{0, 15, 0, 5, 0, false}, // two rows fit
+		{0, 15, 0, 2, 0, true},  // a short group and its subtotal move as a whole
+		{0, 20, 0, 5, 3, true},  // the last two rows stay with the subtotal
+		{0, 10, 0, 5, 2, false}, // rows in the middle may be split
+		{3, 15, 0, 5, 0, true},  // three rows do not fit
+		{-1, 1, 0, 5, 0, false}, // disabled
+	}
+	for _, tt := range tests {
+		pdf := pageWithSpace(tt.left)
+		(&GroupConfig{MinRows: tt.minRows}).keepTogether(pdf, tt.start, tt.n, tt.r, 7)
+		if got := pdf.PageNo() == 2; got != tt.wantBreak {
+			t.Errorf("%+v: page break %v, want %v", tt, got, tt.wantBreak)
+		}
+	}
+}
+
+func TestGroupSubtotals(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Item,Total\nWest,Apples,10\nEast,Pears,2.5\nWest,Plums,1.25\n",
+		"cfg.json": `{"group": {"column": "Region", "sum": ["Total"], "sort": true}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	// Each text follows the previous one: the East group, sorted first,
+	// its subtotal, then the West group and its subtotal.
+	rest := content
+	for _, s := range []string{"(Pears)Tj", "(2.5)Tj", "(Subtotal East)Tj", "(2.5)Tj", "(Apples)Tj", "(Plums)Tj", "(Subtotal West)Tj", "(11.25)Tj"} {
+		i := strings.Index(rest, s)
+		if i < 0 {
+			t.Fatalf("%q is missing or out of order", s)
+		}
+		rest = rest[i+len(s):]
+	}
+}
+
+// pageTexts returns the page numbers that the texts of a document are
+// printed on.
+func pageTexts(t *testing.T, data []byte, texts []string) map[string]int {
+	t.Helper()
+	on := map[string]int{}
+	for i, p := range pageObjects(t, data) {
+		stream, _, err := contentStream(data, string(reContents.FindSubmatch(p.dict)[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range texts {
+			if bytes.Contains(content, []byte("("+s+")Tj")) {
+				on[s] = i + 1
+			}
+		}
+	}
+	return on
+}
+
+func TestOrphanRows(t *testing.T) {
+	// The first page has room for 20 rows. Soft page breaks are
+	// disabled, so only the minimum of rows moves group B.
+	tests := []struct {
+		a, minRows int
+		want       []int // the pages of B0 to B4 and of the subtotal
+	}{
+		{18, -1, []int{1, 2, 2, 2, 2, 2}},
+		{18, 0, []int{2, 2, 2, 2, 2, 2}}, // not one row alone at the bottom
+		{17, 0, []int{1, 1, 2, 2, 2, 2}},
+		{17, 3, []int{2, 2, 2, 2, 2, 2}},
+		{14, -1, []int{1, 1, 1, 1, 1, 2}},
+		{14, 0, []int{1, 1, 1, 2, 2, 2}}, // not the subtotal alone at the top
+		{14, 3, []int{1, 1, 2, 2, 2, 2}},
+	}
+	texts := []string{"B0", "B1", "B2", "B3", "B4", "Subtotal B"}
+	for _, tt := range tests {
+		var csv strings.Builder
+		csv.WriteString("Region,Item,Total\n")
+		for i := 0; i < tt.a; i++ {
+			fmt.Fprintf(&csv, "A,A%d,1\n", i)
+		}
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(&csv, "B,B%d,1\n", i)
+		}
+		env := testEnv(map[string]string{
+			"in.csv":   csv.String(),
+			"cfg.json": fmt.Sprintf(`{"group": {"column": "Region", "sum": ["Total"], "breakTolerance": -1, "minRows": %d}}`, tt.minRows),
+		})
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+		on := pageTexts(t, []byte(testFile(t, env, "out.pdf")), texts)
+		got := make([]int, len(texts))
+		for i, s := range texts {
+			got[i] = on[s]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d rows of A, minRows %d: B is on pages %v, want %v", tt.a, tt.minRows, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ## The header row
+
+// By default, the first CSV record holds the column names. Some exports
+// come without a header, though, and some tools add one only sometimes.
+
+// errNoData is returned for inputs without a single record.
+var errNoData = errors.New("the input contains no data")
+
+// splitHeader separates the header from the data records. Depending on
+// the dialect, the header is taken from the first record, generated, or
+// guessed.
+func (d csvDialect) splitHeader(rows [][]string) ([]string, [][]string, error) {
+	if d.NoHeader && d.DetectHeader {
+		return nil, nil, errors.New("-no-header and -detect-header cannot be combined")
+	}
+	if len(rows) == 0 {
+		return nil, nil, errNoData
+	}
+	if d.NoHeader || (d.DetectHeader && !looksLikeHeader(rows)) {
+		return columnNames(len(rows[0])), rows, nil
+	}
+	return rows[0], rows[1:], nil
+}
+
+// uniqueHeader makes the column names of hdr unique, so that they can be
+// referenced by name. With the policy "rename" (the default), the second
+// "Total" becomes "Total_2", the third "Total_3", and so on. With "error",
+// duplicates are rejected. The returned map links each new name to the
+// original one; expressions use it to tell the columns apart, see
+// exprParser.index.
+func uniqueHeader(hdr []string, policy string) ([]string, map[string]string, error) {
+	if policy != "" && policy != "rename" && policy != "error" {
+		return nil, nil, fmt.Errorf("unknown duplicate header policy %q", policy)
+	}
+	taken := map[string]bool{}
+	for _, h := range hdr {
+		taken[h] = true
+	}
+	seen := map[string]int{}
+	renamed := map[string]string{}
+	out := make([]string, len(hdr))
+	for i, h := range hdr {
+		seen[h]++
+		if seen[h] == 1 {
+			out[i] = h
+			continue
+		}
+		if policy == "error" {
+			return nil, nil, fmt.Errorf("duplicate column name %q in column %d", h, i+1)
+		}
+		n := seen[h]
+		name := fmt.Sprintf("%s_%d", h, n)
+		for taken[name] {
+			n++
+			name = fmt.Sprintf("%s_%d", h, n)
+		}
+		seen[h] = n
+		taken[name] = true
+		renamed[name] = h
+		out[i] = name
+	}
+	return out, renamed, nil
+}
+
+// duplicates returns the names by which expressions refer to the
+// columns that were named like name in the input, in order, or nil if
+// name was unique. The first column is name_1.
+func duplicates(renamed map[string]string, name string) []string {
+	var dups []string
+	for n, orig := range renamed {
+		if orig == name {
+			dups = append(dups, n)
+		}
+	}
+	if dups == nil {
+		return nil
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		a, _ := strconv.Atoi(dups[i][len(name)+1:])
+		b, _ := strconv.Atoi(dups[j][len(name)+1:])
+		return a < b
+	})
+	return append([]string{name + "_1"}, dups...)
+}
+
+// columnNames generates names for n columns of a headerless input.
+func columnNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("Column %d", i+1)
+	}
+	return names
+}
+
+// looksLikeHeader guesses whether the first record is a header. Column
+// names are rarely numeric and rarely empty, so a number or an empty
+// cell in the first record indicates data. Otherwise the first record is
+// taken as header, as usual.
+func looksLikeHeader(rows [][]string) bool {
+	first := rows[0]
+	for i, str := range first {
+		if strings.TrimSpace(str) == "" {
+			return false
+		}
+		if _, ok := cellNumber(first, i); ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueHeader(t *testing.T) {
+	tests := []struct {
+		hdr     []string
+		policy  string
+		want    []string
+		renamed map[string]string
+		err     string
+	}{
+		{[]string{"A", "B"}, "", []string{"A", "B"}, map[string]string{}, ""},
+		{[]string{"Total", "Total", "Total"}, "", []string{"Total", "Total_2", "Total_3"},
+			map[string]string{"Total_2": "Total", "Total_3": "Total"}, ""},
+		{[]string{"Total", "Total_2", "Total"}, "rename", []string{"Total", "Total_2", "Total_3"},
+			map[string]string{"Total_3": "Total"}, ""},
+		{[]string{"", ""}, "", []string{"", "_2"}, map[string]string{"_2": ""}, ""},
+		{[]string{"A", "B", "A"}, "error", nil, nil, `duplicate column name "A" in column 3`},
+		{[]string{"A"}, "first", nil, nil, `unknown duplicate header policy "first"`},
+	}
+	for _, tt := range tests {
+		got, renamed, err := uniqueHeader(tt.hdr, tt.policy)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("uniqueHeader(%q, %q) = %v, want %q", tt.hdr, tt.policy, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(renamed, tt.renamed) {
+			t.Errorf("uniqueHeader(%q, %q) = %q, %v, %v; want %q, %v", tt.hdr, tt.policy, got, renamed, err, tt.want, tt.renamed)
+		}
+	}
+}
+
+func TestDuplicateColumnReferences(t *testing.T) {
+	hdr, renamed, _ := uniqueHeader(strings.Split("Item,Total,Total,Tax,Total", ","), "")
+	rows := [][]string{{"Apples", "1", "2", "3", "4"}}
+	for _, tt := range []struct {
+		expr string
+		want float64
+		err  string
+	}{
+		{"Total_1", 1, ""},
+		{"Total_2 + Total_3", 6, ""},
+		{"Tax * 2", 6, ""},
+		{"Total * 2", 0, `column "Total" is ambiguous; use Total_1, Total_2, Total_3`},
+		{"total(Total)", 0, "is ambiguous"},
+		{"Tax_1", 0, `column "Tax_1" not found`},
+	} {
+		p := &exprParser{src: tt.expr, hdr: hdr, renamed: renamed}
+		n, err := p.parse()
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: %v, want an error with %q", tt.expr, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.expr, err)
+		case tt.err == "" && n.eval(rows)[0] != tt.want:
+			t.Errorf("%q = %v, want %v", tt.expr, n.eval(rows)[0], tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		filter string
+		want   bool
+		err    string
+	}{
+		{"Total_1 = 1", true, ""},
+		{"Total_3 = 4 and Total_2 = 2", true, ""},
+		{"Total = 1", false, `column "Total" is ambiguous`},
+	} {
+		f, err := parseFilter(tt.filter, hdr, renamed)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: %v, want an error with %q", tt.filter, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.filter, err)
+		case tt.err == "" && f.match(rows[0]) != tt.want:
+			t.Errorf("%q matches = %v, want %v", tt.filter, !tt.want, tt.want)
+		}
+	}
+}
+
+func TestDuplicateHeadersReport(t *testing.T) {
+	csv := "Item,Total,Total\nApples,10,12\nPears,20,22\n"
+	tests := []struct {
+		config string
+		policy string
+		want   string // in the text version, or in the error
+	}{
+		{`{"computed": [{"name": "Sum", "expr": "Total_1 + Total_2", "decimals": 0}], "textVersion": {"format": "text"}}`, "",
+			"Apples     10       12   22"},
+		{`{"computed": [{"name": "Sum", "expr": "Total * 2"}]}`, "", `column "Total" is ambiguous; use Total_1, Total_2`},
+		{`{"textVersion": {"format": "text"}}`, "error", `duplicate column name "Total" in column 3`},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{"in.csv": csv, "cfg.json": tt.config})
+		job := &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Dialect: csvDialect{DuplicateHeaders: tt.policy}}
+		err := generate(env, job)
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: %v, want %q", tt.config, err, tt.want)
+			}
+			continue
+		}
+		if text := testFile(t, env, "out.txt"); !strings.Contains(text, tt.want) {
+			t.Errorf("%s: text version lacks %q:\n%s", tt.config, tt.want, text)
+		}
+	}
+}
+
+func TestSplitHeader(t *testing.T) {
+	rows := [][]string{{"Item", "Total"}, {"Apples", "10"}}
+	data := [][]string{{"Apples", "10"}, {"Pears", "20"}}
+	tests := []struct {
+		dialect csvDialect
+		rows    [][]string
+		hdr     []string
+		data    [][]string
+		err     string
+	}{
+		{csvDialect{}, rows, []string{"Item", "Total"}, rows[1:], ""},
+		{csvDialect{}, rows[:1], []string{"Item", "Total"}, [][]string{}, ""},
+		{csvDialect{NoHeader: true}, data, []string{"Column 1", "Column 2"}, data, ""},
+		{csvDialect{DetectHeader: true}, rows, []string{"Item", "Total"}, rows[1:], ""},
+		{csvDialect{DetectHeader: true}, data, []string{"Column 1", "Column 2"}, data, ""},
+		{csvDialect{DetectHeader: true}, [][]string{{"Item", ""}}, []string{"Column 1", "Column 2"}, [][]string{{"Item", ""}}, ""},
+		{csvDialect{}, nil, nil, nil, "the input contains no data"},
+		{csvDialect{NoHeader: true}, nil, nil, nil, "the input contains no data"},
+		{csvDialect{NoHeader: true, DetectHeader: true}, rows, nil, nil, "-no-header and -detect-header cannot be combined"},
+	}
+	for _, tt := range tests {
+		hdr, data, err := tt.dialect.splitHeader(tt.rows)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%+v: splitHeader(%q) = %v, want %q", tt.dialect, tt.rows, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(hdr, tt.hdr) || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("%+v: splitHeader(%q) = %q, %q, %v; want %q, %q", tt.dialect, tt.rows, hdr, data, err, tt.hdr, tt.data)
+		}
+	}
+}
+
+func TestHeaderlessReport(t *testing.T) {
+	tests := []struct {
+		input   string
+		dialect csvDialect
+		want    string // in the text version, or in the error
+	}{
+		{"Apples,10\nPears,20\n", csvDialect{NoHeader: true}, "Column 1"},
+		{"Apples,10\nPears,20\n", csvDialect{DetectHeader: true}, "Column 2"},
+		{"", csvDialect{}, "cannot use 'in.csv': the input contains no data"},
+		{"\n\n", csvDialect{NoHeader: true}, "cannot use 'in.csv': the input contains no data"},
+		{"Item,Total\nApples\n", csvDialect{}, "wrong number of fields"},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{"in.csv": tt.input, "cfg.json": `{"textVersion": {"format": "text"}}`})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Dialect: tt.dialect})
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%q: %v, want %q", tt.input, err, tt.want)
+			}
+			continue
+		}
+		text := testFile(t, env, "out.txt")
+		if !strings.Contains(text, tt.want) || !strings.Contains(text, "Pears") {
+			t.Errorf("%q: text version lacks %q:\n%s", tt.input, tt.want, text)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ## Header groups
+
+// A table of monthly figures reads better with the quarters above the
+// months. Header groups add a row above the column names, with one cell
+// spanning each group of adjacent columns:
+//
+//	"headerGroups": [
+//	  {"label": "Q1", "from": "Jan", "to": "Mar"},
+//	  {"label": "Q2", "from": "Apr", "to": "Jun", "align": "L"}]
+//
+// Labels are centered unless aligned otherwise. Columns outside of any
+// group have nothing above them. In a table printed in bands (see
+// FreezeConfig), a group spans the columns of the band it has.
+
+// HeaderGroup is a label above a range of columns.
+type HeaderGroup struct {
+	Label string    `json:"label"`
+	From  ColumnRef `json:"from"`
+
+	// To is the last column of the group. Default: From.
+	To *ColumnRef `json:"to"`
+
+	// Align is "L", "C" (default), or "R".
+	Align string `json:"align"`
+}
+
+// resolveHeaderGroups resolves the columns of the groups and checks that
+// the groups do not overlap.
+func resolveHeaderGroups(groups []HeaderGroup, hdr []string) error {
+	owner := map[int]string{}
+	for gi := range groups {
+		g := &groups[gi]
+		switch g.Align {
+		case "", "L", "C", "R":
+		default:
+			return fmt.Errorf("%q: unknown align %q; use L, C, or R", g.Label, g.Align)
+		}
+		if err := g.From.resolve(hdr); err != nil {
+			return fmt.Errorf("%q: %s", g.Label, err)
+		}
+		if g.To == nil {
+			g.To = &ColumnRef{Index: g.From.Index}
+		} else if err := g.To.resolve(hdr); err != nil {
+			return fmt.Errorf("%q: %s", g.Label, err)
+		}
+		if g.To.Index < g.From.Index {
+			return fmt.Errorf("%q: the last column comes before the first", g.Label)
+		}
+		for i := g.From.Index; i <= g.To.Index; i++ {
+			if other, ok := owner[i]; ok {
+				return fmt.Errorf("%q overlaps %q", g.Label, other)
+			}
+			owner[i] = g.Label
+		}
+	}
+	return nil
+}
+
+// headerGroup returns the index of the group of column i, or -1.
+func (c *Config) headerGroup(i int) int {
+	for gi, g := range c.HeaderGroups {
+		if g.From.Index <= i && i <= g.To.Index {
+			return gi
+		}
+	}
+	return -1
+}
+
+// headerGroupRow prints the row of group labels above the column names
+// of hdr, with cells of height h.
+func headerGroupRow(pdf Backend, cfg *Config, hdr []string, h float64, border string) {
+	if len(cfg.HeaderGroups) == 0 {
+		return
+	}
+	blank := func(w float64) {
+		pdf.CellFormat(w, h, "", "", 0, "", false, 0, "")
+	}
+	if cfg.Rank != nil && !cfg.rtl() {
+		blank(rankWidth)
+	}
+	// Adjacent columns of the same group share one cell.
+	order := cfg.columnOrder(len(hdr))
+	for k := 0; k < len(order); {
+		gi := cfg.headerGroup(order[k])
+		end := k + 1
+		for gi >= 0 && end < len(order) && cfg.headerGroup(order[end]) == gi {
+			end++
+		}
+		w := 0.0
+		for _, i := range order[k:end] {
+			w += cfg.width(i)
+		}
+		k = end
+		if gi < 0 {
+			blank(w)
+			continue
+		}
+		g := cfg.HeaderGroups[gi]
+		align := cfg.mirrored(ColumnConfig{}, orDefault(g.Align, "C"))
+		cfg.fallback.cell(pdf, "B", w, h, cfg.locale().print(g.Label), border, 0, align, true)
+	}
+	if cfg.Rank != nil && cfg.rtl() {
+		blank(rankWidth)
+	}
+	pdf.Ln(h)
+}
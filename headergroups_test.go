@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResolveHeaderGroups(t *testing.T) {
+	hdr := []string{"Item", "Jan", "Feb", "Mar", "Apr"}
+	tests := []struct {
+		groups string
+		want   [][2]int // the first and last column of each group
+		err    string
+	}{
+		{`[{"label": "Q1", "from": "Jan", "to": "Mar"}, {"label": "Q2", "from": "Apr"}]`, [][2]int{{1, 3}, {4, 4}}, ""},
+		{`[{"label": "Q1", "from": 1, "to": 2, "align": "R"}]`, [][2]int{{1, 2}}, ""},
+		{`[{"label": "Q1", "from": "Jan", "align": "J"}]`, nil, `"Q1": unknown align "J"`},
+		{`[{"label": "Q1", "from": "Dec"}]`, nil, `"Q1": `},
+		{`[{"label": "Q1", "from": "Jan", "to": "Dec"}]`, nil, `"Q1": `},
+		{`[{"label": "Q1", "from": "Mar", "to": "Jan"}]`, nil, `"Q1": the last column comes before the first`},
+		{`[{"label": "Q1", "from": "Jan", "to": "Mar"}, {"label": "Spring", "from": "Mar", "to": "Apr"}]`, nil, `"Spring" overlaps "Q1"`},
+	}
+	for _, tt := range tests {
+		var groups []HeaderGroup
+		if err := json.Unmarshal([]byte(tt.groups), &groups); err != nil {
+			t.Fatal(err)
+		}
+		err := resolveHeaderGroups(groups, hdr)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.groups, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.groups, err)
+			continue
+		}
+		for gi, g := range groups {
+			if got := [2]int{g.From.Index, g.To.Index}; got != tt.want[gi] {
+				t.Errorf("%s: group %d spans %v, want %v", tt.groups, gi, got, tt.want[gi])
+			}
+		}
+	}
+}
+
+func TestHeaderGroups(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Jan,Feb,Mar,Apr\na,1,2,3,4\n",
+		"cfg.json": `{"headerGroups": [{"label": "Q1", "from": "Jan", "to": "Feb"}, {"label": "Q2", "from": "Apr", "align": "L"}],
+			"columns": [{"name": "Jan", "width": 20}, {"name": "Feb", "width": 20}, {"name": "Mar", "width": 20}, {"name": "Apr", "width": 20}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	// Q1 spans Jan and Feb, centered; Q2 is above Apr, at the left.
+	// Item and Mar have nothing above them; the column names follow one
+	// row lower.
+	for _, s := range []string{
+		"0.941 g\n141.74 492.94 113.39 -19.84 re B q 0.000 g BT 188.20 478.22 Td (Q1)Tj",
+		"\n311.81 492.94 56.69 -19.84 re B q 0.000 g BT 314.65 478.22 Td (Q2)Tj",
+		"\n28.35 473.10 113.39 -19.84 re B q 0.000 g BT 31.19 458.38 Td (Item)Tj",
+	} {
+		if !strings.Contains(content, s) {
+			t.Errorf("missing %q in\n%s", s, content)
+		}
+	}
+	if n := strings.Count(content, " 492.94 "); n != 2 {
+		t.Errorf("%d cells in the group row, want 2", n)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ## Heat maps
+
+// In a wide table of numbers, colors find the hot spots faster than
+// eyes do. A column with a heat map setting fills each numeric cell with
+// a color between a low and a high color, according to where the value
+// lies within the column's range. The range is the smallest to the
+// largest value of the column, unless fixed bounds are given -- which
+// keeps the colors comparable across reports.
+//
+//	"heatMap": {"low": "#f8696b", "mid": "#ffeb84", "high": "#63be7b", "min": 0}
+
+// HeatMapConfig colors the cells of a column by value.
+type HeatMapConfig struct {
+	// Low and High are the colors of the smallest and largest values,
+	// as "#rrggbb". Default: red and green.
+	Low  string `json:"low"`
+	High string `json:"high"`
+
+	// Mid, if set, is the color halfway between Low and High.
+	Mid string `json:"mid"`
+
+	// Min and Max fix the bounds of the scale. Values outside the bounds
+	// get the color of the nearest bound. Default: the column's range.
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+
+	low, mid, high [3]int
+}
+
+// prepare parses the colors and checks the bounds.
+func (hc *HeatMapConfig) prepare() error {
+	var err error
+	if hc.low, err = parseColor(orDefault(hc.Low, "#f8696b")); err != nil {
+		return fmt.Errorf("heat map: %s", err)
+	}
+	if hc.high, err = parseColor(orDefault(hc.High, "#63be7b")); err != nil {
+		return fmt.Errorf("heat map: %s", err)
+	}
+	if hc.Mid == "" {
+		hc.mid = mixColor(hc.low, hc.high, 0.5)
+	} else if hc.mid, err = parseColor(hc.Mid); err != nil {
+		return fmt.Errorf("heat map: %s", err)
+	}
+	if hc.Min != nil && hc.Max != nil && *hc.Min >= *hc.Max {
+		return fmt.Errorf("heat map: min must be less than max")
+	}
+	return nil
+}
+
+// findHeatRanges returns the scale of each heat map column of tbl.
+// Columns without any numeric value are omitted from the result.
+func findHeatRanges(tbl [][]string, cfg *Config) map[int]extremes {
+	heat := map[int]extremes{}
+	for _, cc := range cfg.Columns {
+		hc := cc.HeatMap
+		if hc == nil {
+			continue
+		}
+		found := false
+		var e extremes
+		for _, line := range tbl {
+			v, ok := cellNumber(line, cc.Index)
+			if !ok {
+				continue
+			}
+			if !found || v < e.min {
+				e.min = v
+			}
+			if !found || v > e.max {
+				e.max = v
+			}
+			found = true
+		}
+		if hc.Min != nil {
+			e.min, found = *hc.Min, true
+		}
+		if hc.Max != nil {
+			e.max, found = *hc.Max, true
+		}
+		if found {
+			heat[cc.Index] = e
+		}
+	}
+	return heat
+}
+
+// position returns where value v lies on the scale e: 0 at the
+// smallest value, 1 at the largest.
+func (e extremes) position(v float64) float64 {
+	if e.max > e.min {
+		return (v - e.min) / (e.max - e.min)
+	}
+	return 0.5 // a column with a single value sits in the middle
+}
+
+// color returns the fill color of value v on the scale e.
+func (hc *HeatMapConfig) color(v float64, e extremes) [3]int {
+	t := e.position(v)
+	switch {
+	case t <= 0:
+		return hc.low
+	case t >= 1:
+		return hc.high
+	case t < 0.5:
+		return mixColor(hc.low, hc.mid, t*2)
+	}
+	return mixColor(hc.mid, hc.high, t*2-1)
+}
+
+// mixColor interpolates linearly between the colors a and b.
+func mixColor(a, b [3]int, t float64) [3]int {
+	var c [3]int
+	for i := range c {
+		c[i] = a[i] + int(float64(b[i]-a[i])*t+0.5)
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeatMapColor(t *testing.T) {
+	hc := &HeatMapConfig{Low: "#000000", High: "#c8c8c8"}
+	if err := hc.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	e := extremes{min: 10, max: 30}
+	for _, tt := range []struct {
+		v    float64
+		want [3]int
+	}{
+		{10, [3]int{0, 0, 0}},
+		{15, [3]int{50, 50, 50}},
+		{20, [3]int{100, 100, 100}},
+		{30, [3]int{200, 200, 200}},
+		{-5, [3]int{0, 0, 0}},
+		{99, [3]int{200, 200, 200}},
+	} {
+		if got := hc.color(tt.v, e); got != tt.want {
+			t.Errorf("color(%v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+	if got := hc.color(7, extremes{min: 7, max: 7}); got != [3]int{100, 100, 100} {
+		t.Errorf("color of a single value = %v, want the middle", got)
+	}
+
+	hc = &HeatMapConfig{Low: "#ff0000", Mid: "#ffffff", High: "#0000ff"}
+	if err := hc.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if got := hc.color(20, e); got != [3]int{255, 255, 255} {
+		t.Errorf("color at the middle = %v, want the mid color", got)
+	}
+	if got := hc.color(25, e); got != [3]int{128, 128, 255} {
+		t.Errorf("color between mid and high = %v", got)
+	}
+}
+
+func TestHeatMapPrepareErrors(t *testing.T) {
+	one, two := 1.0, 2.0
+	for _, tt := range []struct {
+		hc  HeatMapConfig
+		err string
+	}{
+		{HeatMapConfig{Low: "red"}, `heat map: color "red": use the form #rrggbb`},
+		{HeatMapConfig{Mid: "#12345"}, `heat map: color "#12345"`},
+		{HeatMapConfig{Min: &two, Max: &one}, "heat map: min must be less than max"},
+		{HeatMapConfig{Min: &one, Max: &one}, "heat map: min must be less than max"},
+	} {
+		if err := tt.hc.prepare(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: %v, want an error with %q", tt.hc, err, tt.err)
+		}
+	}
+}
+
+func TestFindHeatRanges(t *testing.T) {
+	zero := 0.0
+	cfg := &Config{Columns: []ColumnConfig{
+		{Index: 1, HeatMap: &HeatMapConfig{}},
+		{Index: 2, HeatMap: &HeatMapConfig{Min: &zero}},
+		{Index: 3, HeatMap: &HeatMapConfig{}},
+		{Index: 4},
+	}}
+	tbl := [][]string{
+		{"Apples", "10", "5", "n/a", "1"},
+		{"Pears", "-2.5", "8", "", "9"},
+		{"Plums", "30", "x", "-", "5"},
+	}
+	want := map[int]extremes{1: {min: -2.5, max: 30}, 2: {min: 0, max: 8}}
+	if got := findHeatRanges(tbl, cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("findHeatRanges = %v, want %v", got, want)
+	}
+}
+
+func TestHeatMapCells(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\nPears,30\n",
+		"cfg.json": `{"columns": [{"name": "Total", "heatMap": {"low": "#ff0000", "high": "#0000ff"}}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, want := range []string{"1.000 0.000 0.000 rg", "0.000 0.000 1.000 rg"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the report lacks the fill color %q", want)
+		}
+	}
+}
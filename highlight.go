@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ## Minimum and maximum highlighting
+
+// Readers want to spot the best and worst performers at a glance. Columns
+// with a "highlight" setting get their smallest and largest values
+// printed in bold ("bold") or surrounded by a heavy border ("outline").
+
+// extremes holds the smallest and largest numeric value of a column.
+type extremes struct {
+	min, max float64
+}
+
+// findExtremes scans all highlighted columns of tbl. Columns without any
+// numeric value are omitted from the result.
+func findExtremes(tbl [][]string, cfg *Config) map[int]extremes {
+	ext := map[int]extremes{}
+	for _, cc := range cfg.Columns {
+		if cc.Highlight == "" {
+			continue
+		}
+		found := false
+		var e extremes
+		for _, line := range tbl {
+			v, ok := cellNumber(line, cc.Index)
+			if !ok {
+				continue
+			}
+			if !found || v < e.min {
+				e.min = v
+			}
+			if !found || v > e.max {
+				e.max = v
+			}
+			found = true
+		}
+		if found {
+			ext[cc.Index] = e
+		}
+	}
+	return ext
+}
+
+// isExtreme reports whether column i of line holds the column's minimum
+// or maximum.
+func isExtreme(ext map[int]extremes, line []string, i int) bool {
+	e, ok := ext[i]
+	if !ok {
+		return false
+	}
+	v, ok := cellNumber(line, i)
+	return ok && (v == e.min || v == e.max)
+}
+
+// highlightCell prints a cell like `CellFormat()` but in the given
+// highlight style, restoring the font and line width afterwards.
+func highlightCell(pdf Backend, style string, w, h float64, str, border, align string, fill bool) {
+	switch style {
+	case "bold":
+		pdf.SetFontStyle("B")
+		pdf.CellFormat(w, h, str, border, 0, align, fill, 0, "")
+		pdf.SetFontStyle("")
+	case "outline":
+		lw := pdf.GetLineWidth()
+		pdf.SetLineWidth(0.6)
+		pdf.CellFormat(w, h, str, border, 0, align, fill, 0, "")
+		pdf.SetLineWidth(lw)
+	default:
+		pdf.CellFormat(w, h, str, border, 0, align, fill, 0, "")
+	}
+}
+
+// cellNumber parses column i of line as a number.
+func cellNumber(line []string, i int) (float64, bool) {
+	if i < 0 || i >= len(line) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(line[i]), 64)
+	return v, err == nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindExtremes(t *testing.T) {
+	cfg := &Config{Columns: []ColumnConfig{
+		{Name: "Total", Index: 1, Highlight: "bold"},
+		{Name: "Note", Index: 2, Highlight: "outline"},
+		{Name: "Count", Index: 3},
+	}}
+	tbl := [][]string{
+		{"Apples", "10", "n/a", "1"},
+		{"Pears", " -2.5 ", "", "9"},
+		{"Plums", "30", "late", "5"},
+		{"Figs", "", "x"},
+	}
+	got := findExtremes(tbl, cfg)
+	want := map[int]extremes{1: {min: -2.5, max: 30}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("findExtremes = %v, want %v", got, want)
+	}
+	for r, want := range []bool{false, true, true, false} {
+		if isExtreme(got, tbl[r], 1) != want {
+			t.Errorf("isExtreme(row %d) = %v, want %v", r, !want, want)
+		}
+	}
+	if isExtreme(got, tbl[2], 3) {
+		t.Error("a column without highlight has extremes")
+	}
+}
+
+// styleRecorder is a Backend that records the cells printed in bold and
+// those printed with a heavy border.
+type styleRecorder struct {
+	Backend
+	bold           bool
+	bolds, heavies []string
+}
+
+func (sr *styleRecorder) SetFontStyle(style string) {
+	sr.bold = style == "B"
+	sr.Backend.SetFontStyle(style)
+}
+
+func (sr *styleRecorder) CellFormat(w, h float64, txt, border string, ln int, align string, fill bool, link int, linkStr string) {
+	if sr.bold {
+		sr.bolds = append(sr.bolds, txt)
+	}
+	if sr.GetLineWidth() > 0.5 {
+		sr.heavies = append(sr.heavies, txt)
+	}
+	sr.Backend.CellFormat(w, h, txt, border, ln, align, fill, link, linkStr)
+}
+
+func TestHighlightCells(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"columns": [
+		{"name": "Total", "highlight": "bold"},
+		{"name": "Count", "highlight": "outline"}]}`)})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolve([]string{"Item", "Total", "Count"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{{"Apples", "10", "7"}, {"Pears", "30", "3"}, {"Plums", "5", "3"}, {"Figs", "20", "4"}}
+
+	pdf := newPDF("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Times", "", 16)
+	rec := &styleRecorder{Backend: pdf}
+	table(rec, rows, cfg, nil, &progress{})
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"30", "5"}; !reflect.DeepEqual(rec.bolds, want) {
+		t.Errorf("bold cells %q, want %q", rec.bolds, want)
+	}
+	if want := []string{"7", "3", "3"}; !reflect.DeepEqual(rec.heavies, want) {
+		t.Errorf("outlined cells %q, want %q", rec.heavies, want)
+	}
+}
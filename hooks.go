@@ -0,0 +1,144 @@
+package main
+
+// ## Render hooks
+
+// Some decorations belong to one company only: a colored tab on the
+// page edge that shows the section, as in a printed binder, or an audit
+// stamp next to every row. A build of the program for that company sets
+// hooks in defaultEnv that draw them, without changes to the renderer:
+//
+//	env.Hooks = &RenderHooks{
+//		OnPageStart: func(pdf *Fpdf, hc HookContext) {
+//			w, _ := pdf.GetPageSize()
+//			pdf.SetFillColor(0, 90, 160)
+//			pdf.Rect(w-6, 20+float64(hc.Page%8)*22, 6, 20, "F")
+//		},
+//		OnRow: func(pdf *Fpdf, hc HookContext) {
+//			pdf.SetFont("Courier", "", 6)
+//			pdf.Text(hc.Rect.X+hc.Rect.W+1, hc.Rect.Y+4, audit(hc.Line))
+//		},
+//	}
+//
+// OnPageStart runs when a page has been added, OnPageEnd when it is
+// complete, after its footnotes. OnRow runs when a table row has been
+// printed, and OnFinish when the report is complete, before it is
+// saved. Saving completes the last page, so OnFinish runs before the
+// OnPageEnd of the last page. The hooks may draw anywhere, but they
+// must leave the current position, the font, and the colors as they
+// found them. Split reports are rendered concurrently, so hooks must be
+// safe for concurrent use. Hooks that panic fail the report with a
+// RenderError.
+
+// RenderHooks are called while a report is rendered. Any of them may
+// be nil.
+type RenderHooks struct {
+	OnPageStart func(pdf *Fpdf, hc HookContext)
+	OnRow       func(pdf *Fpdf, hc HookContext)
+	OnPageEnd   func(pdf *Fpdf, hc HookContext)
+	OnFinish    func(pdf *Fpdf, hc HookContext)
+}
+
+// HookContext tells a hook where rendering is.
+type HookContext struct {
+	Report  string   // the output path
+	Section string   // the part of the report being rendered, such as "table"
+	Page    int      // the current page number
+	Row     int      // the index of the table row, or -1
+	Line    []string // the values of the row, for OnRow
+	Header  []string // the column names
+
+	// Rect is the box of the row for OnRow, and the area within the
+	// margins of the page otherwise.
+	Rect CellRect
+}
+
+// pageFuncs are the functions that run at the start and the end of
+// every page. gofpdf keeps only one of each.
+type pageFuncs struct {
+	start, end []func()
+	installed  bool
+}
+
+// onPageStart adds f to the functions that run when a page was added.
+func (p *progress) onPageStart(pdf *Fpdf, f func()) {
+	p.pages.start = append(p.pages.start, f)
+	p.installPageFuncs(pdf)
+}
+
+// onPageEnd adds f to the functions that run when a page is complete.
+func (p *progress) onPageEnd(pdf *Fpdf, f func()) {
+	p.pages.end = append(p.pages.end, f)
+	p.installPageFuncs(pdf)
+}
+
+// installPageFuncs makes gofpdf run the page functions. What they draw
+// is an artifact of a tagged report, so the tagger comes first and last.
+func (p *progress) installPageFuncs(pdf *Fpdf) {
+	if p.pages.installed {
+		return
+	}
+	p.pages.installed = true
+	pdf.SetHeaderFunc(func() {
+		p.tags.pageStart()
+		for _, f := range p.pages.start {
+			f()
+		}
+		p.tags.resume()
+	})
+	pdf.SetFooterFunc(func() {
+		p.tags.suspend()
+		for _, f := range p.pages.end {
+			f()
+		}
+		p.tags.pageEnd()
+	})
+}
+
+// setHooks installs the page hooks of h. The first page exists already,
+// so its OnPageStart hook runs right away.
+func (p *progress) setHooks(pdf *Fpdf, h *RenderHooks, name string, hdr []string) {
+	if h == nil {
+		return
+	}
+	p.hooks, p.hookCtx, p.hookDoc = h, HookContext{Report: name, Header: hdr}, pdf
+	if h.OnPageStart != nil {
+		f := func() { h.OnPageStart(pdf, p.context(pdf)) }
+		f()
+		p.onPageStart(pdf, f)
+	}
+	if h.OnPageEnd != nil {
+		p.onPageEnd(pdf, func() { h.OnPageEnd(pdf, p.context(pdf)) })
+	}
+}
+
+// context returns the hook context for the current page.
+func (p *progress) context(pdf *Fpdf) HookContext {
+	hc := p.hookCtx
+	hc.Section, hc.Page, hc.Row = p.section, pdf.PageNo(), -1
+	left, top, right, bottom := pdf.GetMargins()
+	w, h := pdf.GetPageSize()
+	hc.Rect = CellRect{X: left, Y: top, W: w - left - right, H: h - top - bottom}
+	return hc
+}
+
+// rowHook runs OnRow for the row that was just printed, h high, which
+// ends at the current position.
+func (p *progress) rowHook(line []string, h float64) {
+	if p.hooks == nil || p.hooks.OnRow == nil {
+		return
+	}
+	pdf := p.hookDoc
+	hc := p.context(pdf)
+	hc.Row, hc.Line = p.row, line
+	left, _, _, _ := pdf.GetMargins()
+	x, y := pdf.GetXY()
+	hc.Rect = CellRect{X: left, Y: y, W: x - left, H: h}
+	p.hooks.OnRow(pdf, hc)
+}
+
+// finishHook runs OnFinish.
+func (p *progress) finishHook(pdf *Fpdf) {
+	if p.hooks != nil && p.hooks.OnFinish != nil {
+		p.hooks.OnFinish(pdf, p.context(pdf))
+	}
+}
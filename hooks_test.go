@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderHooks(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("Item,Total\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&csv, "Item %d,%d\n", i, i)
+	}
+	env := testEnv(map[string]string{
+		"in.csv":   csv.String(),
+		"cfg.json": `{"columns": [{"name": "Item", "width": 50}, {"name": "Total", "width": 30}]}`,
+	})
+	var events []string
+	var rows []HookContext
+	env.Hooks = &RenderHooks{
+		OnPageStart: func(pdf *Fpdf, hc HookContext) { events = append(events, fmt.Sprintf("start %d", hc.Page)) },
+		OnPageEnd:   func(pdf *Fpdf, hc HookContext) { events = append(events, fmt.Sprintf("end %d", hc.Page)) },
+		OnFinish: func(pdf *Fpdf, hc HookContext) {
+			events = append(events, fmt.Sprintf("finish %d", hc.Page))
+			if hc.Report != "out.pdf" || hc.Row != -1 || !reflect.DeepEqual(hc.Header, []string{"Item", "Total"}) {
+				t.Errorf("OnFinish context %+v", hc)
+			}
+		},
+		OnRow: func(pdf *Fpdf, hc HookContext) {
+			if len(rows) == 0 || rows[len(rows)-1].Page != hc.Page {
+				events = append(events, fmt.Sprintf("rows %d", hc.Page))
+			}
+			rows = append(rows, hc)
+		},
+	}
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start 1", "rows 1", "end 1", "start 2", "rows 2", "finish 2", "end 2"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("hooks ran %q, want %q", events, want)
+	}
+	if len(rows) != 40 {
+		t.Fatalf("OnRow ran %d times, want 40", len(rows))
+	}
+	for i, hc := range rows {
+		if hc.Row != i || hc.Section != "table" || hc.Line[0] != fmt.Sprintf("Item %d", i) {
+			t.Errorf("OnRow %d: row %d in %q with %q", i, hc.Row, hc.Section, hc.Line)
+		}
+		if !approx(hc.Rect.W, 80) || hc.Rect.H <= 0 || (i > 0 && hc.Page == rows[i-1].Page && !approx(hc.Rect.Y, rows[i-1].Rect.Y+rows[i-1].Rect.H)) {
+			t.Errorf("OnRow %d: box %+v after %+v", i, hc.Rect, rows[maxInt(i-1, 0)].Rect)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// ## Languages
+
+// Our German and French offices read their reports in their own
+// language. The "locale" setting selects a bundle of translated texts --
+// title, captions, the labels of subtotals and invoices -- together with
+// the local date and number conventions. Single texts can be overridden
+// through "messages":
+//
+//	"locale": "de", "messages": {"title": "Auftragsbericht"}
+
+// locale holds the texts and conventions of one language.
+type locale struct {
+	messages map[string]string
+
+	// Date layouts for the report date, numeric dates, and timestamps.
+	longDate, shortDate, timestamp string
+
+	// Month and weekday names, starting with January and Sunday.
+	months, shortMonths, days, shortDays []string
+
+	decimal, thousands string
+	currencyAfter      bool   // "1.234,50 €" rather than "€1,234.50"
+	percent            string // appended to percentages
+
+	collator *collator           // sorts text; nil for the root order
+	names    *strings.Replacer   // translates English date names
+	encode   func(string) string // converts text for the fonts in use
+	rounding roundingMode
+	rtl      bool              // the document reads from right to left
+	params   map[string]string // for the narrative; see applyParams
+}
+
+// englishMessages are the texts of the report. Their keys are the keys
+// of the "messages" setting.
+var englishMessages = map[string]string{
+	"title":            "Daily Report",
+	"notes":            "Notes",
+	"dataErrors":       "Data errors",
+	"row":              "Row %d",
+	"subtotal":         "Subtotal %s",
+	"total":            "Total",
+	"rank":             "Rank",
+	"dataAsOf":         "Data as of",
+	"invoice":          "INVOICE",
+	"invoiceNo":        "Invoice No.",
+	"date":             "Date",
+	"dueDate":          "Due Date",
+	"billTo":           "Bill To",
+	"shipTo":           "Ship To",
+	"description":      "Description",
+	"quantity":         "Quantity",
+	"unitPrice":        "Unit Price",
+	"amount":           "Amount",
+	"invoiceSubtotal":  "Subtotal",
+	"tax":              "Tax (%s%%)",
+	"truncated":        "Report truncated",
+	"truncatedRows":    "The table shows the first %d of %d rows, because reports are limited to %d rows.",
+	"truncatedPages":   "The table shows the first %d of %d rows, because reports are limited to %d pages.",
+	"fullData":         "Please ask the sender of this report for the complete data.",
+	"fullDataAttached": "The complete data is attached to this document as %s.",
+	"rawData":          "Raw data",
+	"noData":           "No data for this period.",
+	"improving":        "improving",
+	"stable":           "stable",
+	"deteriorating":    "deteriorating",
+	"changes":          "Changes",
+	"changeCounts":     "Since the previous data, %d rows were added, %d changed, and %d removed.",
+	"changeLegend":     "Added rows are shaded green, changed values yellow.",
+	"changeLegendGray": "Added rows are marked with +, changed values with a triangle in the corner.",
+	"changedValues":    "Changed values",
+	"changedValue":     "%s %s (was %s)",
+	"removedRows":      "Removed rows",
+	"signOff":          "Sign-off",
+	"name":             "Name",
+	"signature":        "Signature",
+}
+
+var locales = map[string]*locale{
+	"en": {
+		messages:  englishMessages,
+		longDate:  "Mon Jan 2, 2006",
+		shortDate: "2006-01-02",
+		timestamp: "Jan 2, 2006 15:04 MST",
+		decimal:   ".",
+		thousands: ",",
+		percent:   "%",
+	},
+	"de": {
+		messages: map[string]string{
+			"title":            "Tagesbericht",
+			"notes":            "Anmerkungen",
+			"dataErrors":       "Datenfehler",
+			"row":              "Zeile %d",
+			"subtotal":         "Zwischensumme %s",
+			"total":            "Gesamt",
+			"rank":             "Rang",
+			"dataAsOf":         "Datenstand",
+			"invoice":          "RECHNUNG",
+			"invoiceNo":        "Rechnungsnr.",
+			"date":             "Datum",
+			"dueDate":          "Fällig am",
+			"billTo":           "Rechnungsadresse",
+			"shipTo":           "Lieferadresse",
+			"description":      "Beschreibung",
+			"quantity":         "Menge",
+			"unitPrice":        "Einzelpreis",
+			"amount":           "Betrag",
+			"invoiceSubtotal":  "Zwischensumme",
+			"tax":              "MwSt. (%s %%)",
+			"truncated":        "Bericht gekürzt",
+			"truncatedRows":    "Die Tabelle zeigt die ersten %d von %d Zeilen, weil Berichte auf %d Zeilen begrenzt sind.",
+			"truncatedPages":   "Die Tabelle zeigt die ersten %d von %d Zeilen, weil Berichte auf %d Seiten begrenzt sind.",
+			"fullData":         "Die vollständigen Daten erhalten Sie beim Absender dieses Berichts.",
+			"fullDataAttached": "Die vollständigen Daten sind diesem Dokument als %s beigefügt.",
+			"rawData":          "Rohdaten",
+			"noData":           "Keine Daten für diesen Zeitraum.",
+			"improving":        "verbessert",
+			"stable":           "stabil",
+			"deteriorating":    "verschlechtert",
+			"changes":          "Änderungen",
+			"changeCounts":     "Seit den vorherigen Daten wurden %d Zeilen hinzugefügt, %d geändert und %d entfernt.",
+			"changeLegend":     "Neue Zeilen sind grün hinterlegt, geänderte Werte gelb.",
+			"changeLegendGray": "Neue Zeilen sind mit + markiert, geänderte Werte mit einem Dreieck in der Ecke.",
+			"changedValues":    "Geänderte Werte",
+			"changedValue":     "%s %s (vorher %s)",
+			"removedRows":      "Entfernte Zeilen",
+			"signOff":          "Freigabe",
+			"name":             "Name",
+			"signature":        "Unterschrift",
+		},
+		longDate:      "Monday, 2. January 2006",
+		shortDate:     "02.01.2006",
+		timestamp:     "02.01.2006 15:04 MST",
+		months:        []string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths:   []string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		days:          []string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:     []string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		decimal:       ",",
+		thousands:     ".",
+		currencyAfter: true,
+		percent:       " %",
+	},
+	"fr": {
+		messages: map[string]string{
+			"title":            "Rapport quotidien",
+			"notes":            "Notes",
+			"dataErrors":       "Erreurs de données",
+			"row":              "Ligne %d",
+			"subtotal":         "Sous-total %s",
+			"total":            "Total",
+			"rank":             "Rang",
+			"dataAsOf":         "Données du",
+			"invoice":          "FACTURE",
+			"invoiceNo":        "Facture n°",
+			"date":             "Date",
+			"dueDate":          "Échéance",
+			"billTo":           "Facturer à",
+			"shipTo":           "Livrer à",
+			"description":      "Description",
+			"quantity":         "Quantité",
+			"unitPrice":        "Prix unitaire",
+			"amount":           "Montant",
+			"invoiceSubtotal":  "Sous-total",
+			"tax":              "TVA (%s %%)",
+			"truncated":        "Rapport tronqué",
+			"truncatedRows":    "Le tableau présente les %d premières lignes sur %d, car les rapports sont limités à %d lignes.",
+			"truncatedPages":   "Le tableau présente les %d premières lignes sur %d, car les rapports sont limités à %d pages.",
+			"fullData":         "Veuillez demander les données complètes à l'expéditeur de ce rapport.",
+			"fullDataAttached": "Les données complètes sont jointes à ce document sous le nom %s.",
+			"rawData":          "Données brutes",
+			"noData":           "Aucune donnée pour cette période.",
+			"improving":        "en amélioration",
+			"stable":           "stable",
+			"deteriorating":    "en dégradation",
+			"changes":          "Modifications",
+			"changeCounts":     "Depuis les données précédentes, %d lignes ont été ajoutées, %d modifiées et %d supprimées.",
+			"changeLegend":     "Les lignes ajoutées sont en vert, les valeurs modifiées en jaune.",
+			"changeLegendGray": "Les lignes ajoutées sont marquées d'un +, les valeurs modifiées d'un triangle dans le coin.",
+			"changedValues":    "Valeurs modifiées",
+			"changedValue":     "%s %s (auparavant %s)",
+			"removedRows":      "Lignes supprimées",
+			"signOff":          "Validation",
+			"name":             "Nom",
+			"signature":        "Signature",
+		},
+		longDate:      "Monday 2 January 2006",
+		shortDate:     "02/01/2006",
+		timestamp:     "02/01/2006 15:04 MST",
+		months:        []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths:   []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:          []string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:     []string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		decimal:       ",",
+		thousands:     " ",
+		currencyAfter: true,
+		percent:       " %",
+	},
+}
+
+// defaultLocale is used by configurations that were not prepared.
+var defaultLocale = locales["en"]
+
+// coreFontText converts UTF-8 text to Windows-1252, the encoding of the
+// PDF core fonts.
+var coreFontText = newPDF("P", "mm", "Letter", "").UnicodeTranslatorFromDescriptor("")
+
+// newLocale returns the locale for a language such as "de" or "de-AT",
+// with the given messages overriding the built-in ones. Unless the
+// document embeds UTF-8 fonts, text is converted for the core fonts.
+func newLocale(name string, messages map[string]string, utf8Fonts bool) (*locale, error) {
+	lang := strings.ToLower(orDefault(name, "en"))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	base, ok := locales[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q; use one of %s", name, strings.Join(localeNames(), ", "))
+	}
+	l := *base
+	l.messages = map[string]string{}
+	for key, text := range base.messages {
+		l.messages[key] = text
+	}
+	for key, text := range messages {
+		if _, ok := englishMessages[key]; !ok {
+			return nil, fmt.Errorf("unknown message %q", key)
+		}
+		l.messages[key] = text
+	}
+
+	// Go formats dates in English. Full names are listed first, so that
+	// "March" is not taken for "Mar" followed by "ch".
+	if l.months != nil {
+		var pairs []string
+		for m := time.January; m <= time.December; m++ {
+			pairs = append(pairs, m.String(), l.months[m-1])
+		}
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			pairs = append(pairs, d.String(), l.days[d])
+		}
+		for m := time.January; m <= time.December; m++ {
+			pairs = append(pairs, m.String()[:3], l.shortMonths[m-1])
+		}
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			pairs = append(pairs, d.String()[:3], l.shortDays[d])
+		}
+		l.names = strings.NewReplacer(pairs...)
+	}
+	if !utf8Fonts {
+		l.encode = coreFontText
+	}
+	l.collator = collatorFor(localeLanguages[lang])
+	return &l, nil
+}
+
+func localeNames() []string {
+	var names []string
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// locale returns the locale of the configuration.
+func (c *Config) locale() *locale {
+	if c.loc == nil {
+		return defaultLocale
+	}
+	return c.loc
+}
+
+// msg returns the message with the given key, formatted with args.
+func (l *locale) msg(key string, args ...interface{}) string {
+	text := l.messages[key]
+	if len(args) > 0 {
+		text = fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// text is like msg but converts the message for printing.
+func (l *locale) text(key string, args ...interface{}) string {
+	return l.print(l.msg(key, args...))
+}
+
+// print converts text for the fonts of the document.
+func (l *locale) print(text string) string {
+	return l.printDir(text, "")
+}
+
+// printDir is like print for text in the given direction; see visual.
+func (l *locale) printDir(text, dir string) string {
+	if isASCII(text) {
+		// ASCII has no right-to-left letters and is the same in
+		// Windows-1252.
+		return text
+	}
+	text = l.visual(text, dir)
+	if l.encode == nil {
+		return text
+	}
+	return l.encode(text)
+}
+
+// isASCII reports whether s consists of ASCII characters only.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// date formats t with the given layout and translates the names of
+// months and weekdays.
+func (l *locale) date(t time.Time, layout string) string {
+	return l.dateNames(t.Format(layout))
+}
+
+// dateNames translates the English month and weekday names in s.
+func (l *locale) dateNames(s string) string {
+	if l.names == nil {
+		return s
+	}
+	return l.names.Replace(s)
+}
+
+// number writes a number given in Go syntax, such as "1234.5", with the
+// locale's decimal separator. Other values are returned unchanged.
+func (l *locale) number(s string) string {
+	if l.decimal == "." {
+		return s
+	}
+	if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil {
+		return s
+	}
+	return strings.Replace(s, ".", l.decimal, 1)
+}
+
+// currency formats v like tmplCurrency, but with the locale's separators
+// and symbol placement.
+func (l *locale) currency(symbol string, v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	s := groupThousands(l.rounding.format(ratFromFloat(f), 2))
+	s = strings.NewReplacer(",", l.thousands, ".", l.decimal).Replace(s)
+	if l.currencyAfter {
+		return sign + s + " " + symbol, nil
+	}
+	return sign + symbol + s, nil
+}
+
+// funcs returns the template functions with local formats for
+// currencies, percentages, and dates.
+func (l *locale) funcs() template.FuncMap {
+	funcs := templateFuncs()
+	funcs["currency"] = l.currency
+	funcs["pct"] = func(v interface{}) (string, error) {
+		f, err := toFloat(v)
+		if err != nil {
+			return "", err
+		}
+		pct := new(big.Rat).Mul(ratFromFloat(f), big.NewRat(100, 1))
+		return l.number(l.rounding.format(pct, 1)) + l.percent, nil
+	}
+	funcs["formatDate"] = func(layout string, t time.Time) string { return l.date(t, layout) }
+	for name, f := range paramFuncs(l.params) {
+		funcs[name] = f
+	}
+	return funcs
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocale(t *testing.T) {
+	day := time.Date(2024, 3, 4, 9, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name                    string
+		title, total, longDate  string
+		short, number, currency string
+		pct                     string
+	}{
+		{"en", "Daily Report", "Total", "Mon Mar 4, 2024", "Mar 4", "1234.5", "-$1,234.50", "12.5%"},
+		{"de", "Tagesbericht", "Gesamt", "Montag, 4. März 2024", "Mär 4", "1234,5", "-1.234,50\u00a0€", "12,5\u00a0%"},
+		{"de-AT", "Tagesbericht", "Gesamt", "Montag, 4. März 2024", "Mär 4", "1234,5", "-1.234,50\u00a0€", "12,5\u00a0%"},
+		{"fr_CA", "", "", "lundi 4 mars 2024", "mars 4", "1234,5", "-1\u00a0234,50\u00a0€", "12,5\u00a0%"},
+	}
+	for _, tt := range tests {
+		l, err := newLocale(tt.name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.title != "" && (l.msg("title") != tt.title || l.msg("total") != tt.total) {
+			t.Errorf("%s: title %q and total %q, want %q and %q", tt.name, l.msg("title"), l.msg("total"), tt.title, tt.total)
+		}
+		if got := l.date(day, l.longDate); got != tt.longDate {
+			t.Errorf("%s: long date %q, want %q", tt.name, got, tt.longDate)
+		}
+		if got := l.dateNames(day.Format("Jan 2")); got != tt.short {
+			t.Errorf("%s: dateNames = %q, want %q", tt.name, got, tt.short)
+		}
+		if got := l.number("1234.5"); got != tt.number {
+			t.Errorf("%s: number = %q, want %q", tt.name, got, tt.number)
+		}
+		if got := l.number("v1.2"); got != "v1.2" {
+			t.Errorf("%s: number changed the text %q", tt.name, got)
+		}
+		symbol := "€"
+		if tt.name == "en" {
+			symbol = "$"
+		}
+		if got, err := l.currency(symbol, -1234.5); err != nil || got != tt.currency {
+			t.Errorf("%s: currency = %q, %v; want %q", tt.name, got, err, tt.currency)
+		}
+		pct := l.funcs()["pct"].(func(interface{}) (string, error))
+		if got, err := pct(0.125); err != nil || got != tt.pct {
+			t.Errorf("%s: pct = %q, %v; want %q", tt.name, got, err, tt.pct)
+		}
+	}
+}
+
+func TestLocaleMessages(t *testing.T) {
+	l, err := newLocale("de", map[string]string{"title": "Auftragsbericht", "row": "Datensatz %d"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.msg("title") != "Auftragsbericht" || l.msg("row", 7) != "Datensatz 7" || l.msg("total") != "Gesamt" {
+		t.Errorf("messages %q, %q, %q", l.msg("title"), l.msg("row", 7), l.msg("total"))
+	}
+	if locales["de"].messages["title"] != "Tagesbericht" {
+		t.Error("the override changed the built-in messages")
+	}
+	// Without UTF-8 fonts, text is converted to Windows-1252.
+	if got := l.text("dueDate"); got != "F\xe4llig am" {
+		t.Errorf("text = %q, want Windows-1252", got)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		messages map[string]string
+		err      string
+	}{
+		{"es", nil, `unsupported locale "es"; use one of de, en, fr`},
+		{"de", map[string]string{"titel": "Bericht"}, `unknown message "titel"`},
+	} {
+		if _, err := newLocale(tt.name, tt.messages, false); err == nil || err.Error() != tt.err {
+			t.Errorf("newLocale(%q, %v) = %v, want %q", tt.name, tt.messages, err, tt.err)
+		}
+	}
+}
+
+func TestLocaleReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Total\nNorth,1.5\nSouth,2\n",
+		"cfg.json": `{"locale": "de", "textVersion": {"format": "text"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"Tagesbericht", "Freitag, 15. März 2024", "1,5"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/phpdave11/gofpdi"
+)
+
+// ## Cover and appendix pages
+
+// Reports for customers start with a cover that was designed elsewhere,
+// in the corporate template, and end with the same pages of terms or
+// contacts every time. These come as PDF files, and the report is put
+// between them:
+//
+//	"insert": {"cover": "templates/cover.pdf", "appendix": ["terms.pdf", "contacts.pdf"]}
+//
+// The pages of the cover go before the first page of the report, and
+// those of the appendix files after its last page, in the order of the
+// list. The result is a single file. The pages are added to the
+// finished document, like contact sheets, so that the direct engine and
+// invoices can have them, too: gofpdi imports each page as a form, with
+// the fonts and images it uses, and a new page of the size of the form
+// draws it.
+// Links, form fields, and bookmarks of the inserted files are not
+// copied, and the page numbers in the footer of the report count its
+// own pages only. The contact sheets show the inserted pages, too.
+//
+// The files may be written by any program, as long as they are not
+// encrypted. Inserted pages have no tags, so tagged reports cannot have
+// them, and a PDF/A report only conforms if the inserted files do.
+
+// InsertConfig puts the pages of other PDF files before and after the
+// report.
+type InsertConfig struct {
+	// Cover is a PDF file whose pages go before the report.
+	Cover string `json:"cover"`
+
+	// Appendix lists PDF files whose pages go after the report.
+	Appendix []string `json:"appendix"`
+}
+
+func (ic *InsertConfig) prepare(c *Config) error {
+	if ic.Cover == "" && len(ic.Appendix) == 0 {
+		return errors.New("cover or appendix required")
+	}
+	if c.Tagged != nil {
+		return errors.New("inserted pages have no tags and cannot be part of a tagged PDF")
+	}
+	return nil
+}
+
+// finisher returns the post-processing step for savePDF that inserts
+// the pages. It must run before the steps that copy or count pages, such
+// as contact sheets.
+func (ic *InsertConfig) finisher(fsys FileSystem) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		var cover []string
+		if ic.Cover != "" {
+			cover = []string{ic.Cover}
+		}
+		data, err := insertPages(data, fsys, cover, ic.Appendix)
+		if err != nil {
+			return nil, fmt.Errorf("insert: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// insertPages appends an incremental update to data that imports the
+// pages of the files before into the page tree ahead of the pages of
+// data, and those of the files after behind them.
+func insertPages(data []byte, fsys FileSystem, before, after []string) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+	pagesRef := rePages.FindSubmatch(pdfObject(data, string(root[1])))
+	if pagesRef == nil {
+		return nil, errors.New("cannot find the page tree")
+	}
+	pagesNum := string(pagesRef[1])
+	pagesObj := pdfObject(data, pagesNum)
+	kids := reKids.FindSubmatch(pagesObj)
+	box := reMediaBox.FindSubmatch(pagesObj)
+	if kids == nil || box == nil {
+		return nil, errors.New("cannot parse the page tree")
+	}
+	parent, _ := strconv.Atoi(pagesNum)
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	imp := &pageImporter{buf: &buf, next: size, offsets: map[int]int{}}
+	importFiles := func(names []string) ([]string, error) {
+		var refs []string
+		for _, name := range names {
+			file, err := readFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			forms, err := imp.importForms(file, 0, false)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			for _, f := range forms {
+				refs = append(refs, fmt.Sprintf("%d 0 R", imp.page(f, parent)))
+			}
+		}
+		return refs, nil
+	}
+	first, err := importFiles(before)
+	if err != nil {
+		return nil, err
+	}
+	last, err := importFiles(after)
+	if err != nil {
+		return nil, err
+	}
+	refs := append(first, reRef.FindAllString(string(kids[1]), -1)...)
+	refs = append(refs, last...)
+
+	pagesOffset := buf.Len()
+	fmt.Fprintf(&buf, "%s 0 obj\n<< /Type /Pages /Kids [%s] /Count %d /MediaBox [%s] >>\nendobj\n",
+		pagesNum, strings.Join(refs, " "), len(refs), box[1])
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n%s 1\n%010d 00000 n \n", pagesNum, pagesOffset)
+	if imp.next > size {
+		fmt.Fprintf(&buf, "%d %d\n", size, imp.next-size)
+		for num := size; num < imp.next; num++ {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", imp.offsets[num])
+		}
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		imp.next, root[1], info[1], m[1], xref)
+	return buf.Bytes(), nil
+}
+
+// pageImporter imports pages of other files into an incremental update,
+// with the objects they use.
+type pageImporter struct {
+	buf     *bytes.Buffer
+	next    int         // the number of the next new object
+	offsets map[int]int // of the new objects
+}
+
+// page adds a page of the size of form f that draws it, as a child of
+// page tree node parent, and returns its number. The resources and the
+// content are objects of their own, as those of gofpdf are, so that
+// contact sheets can draw the page.
+func (imp *pageImporter) page(f importedForm, parent int) int {
+	res := imp.newObj()
+	imp.write(res, []byte(fmt.Sprintf("<< /XObject << /Imported %d 0 R >> >>", f.num)), nil)
+	content := []byte("q /Imported Do Q")
+	contents := imp.newObj()
+	imp.write(contents, []byte(fmt.Sprintf("<< /Length %d >>", len(content))), content)
+	num := imp.newObj()
+	imp.write(num, []byte(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %d 0 R /Contents %d 0 R >>",
+		parent, f.w, f.h, res, contents)), nil)
+	return num
+}
+
+// newObj returns the number of a new object.
+func (imp *pageImporter) newObj() int {
+	imp.next++
+	return imp.next - 1
+}
+
+// write writes object num, with the data of a stream unless stream is
+// nil.
+func (imp *pageImporter) write(num int, value, stream []byte) {
+	imp.offsets[num] = imp.buf.Len()
+	fmt.Fprintf(imp.buf, "%d 0 obj\n%s\n", num, value)
+	if stream != nil {
+		imp.buf.WriteString("stream\n")
+		imp.buf.Write(stream)
+		imp.buf.WriteString("\nendstream\n")
+	}
+	imp.buf.WriteString("endobj\n")
+}
+
+// ### Importing pages
+
+// The inserted files come from other programs, which compress their
+// cross-reference tables and pack small objects into object streams.
+// gofpdi reads such files and makes a form of each page, with the
+// objects it uses. It has its limits, though:
+//
+//   - It reads the box of every page from the first one, so pages of a
+//     file that differ in size from its first page are cut or padded.
+//   - Of a file that was changed by appending an update, as this
+//     program changes its reports, it reads the original version. Such
+//     files must be saved anew, with "Save as" or "Print to PDF".
+//   - It only copies the first 9999 objects of a file; a page that uses
+//     others cannot be imported.
+
+// importedForm is a page of another file, imported as a form.
+type importedForm struct {
+	num  int     // the number of the form
+	w, h float64 // its size, in points
+}
+
+// importForms imports the first n pages of file as forms, or all pages
+// if n is 0, in gray if gray is true, and returns the forms.
+func (imp *pageImporter) importForms(file []byte, n int, gray bool) (forms []importedForm, err error) {
+	// gofpdi reports errors by panicking, and malformed files can make
+	// it panic by accident, too.
+	defer func() {
+		if v := recover(); v != nil {
+			forms, err = nil, fmt.Errorf("cannot import pages: %v", v)
+		}
+	}()
+	fpdi := gofpdi.NewImporter()
+	rs := io.ReadSeeker(&eofLimit{r: bytes.NewReader(file)})
+	fpdi.SetSourceStream(&rs)
+	if count := fpdi.GetNumPages(); n == 0 || n > count {
+		n = count
+	}
+	tpls := make([]int, n)
+	for i := range tpls {
+		tpls[i] = fpdi.ImportPage(i+1, "/MediaBox")
+	}
+	names := fpdi.PutFormXobjects()
+	objects := fpdi.GetImportedObjects()
+
+	// gofpdi numbers the objects, and orders the entries of their
+	// dictionaries, at random. The objects are renumbered in the order
+	// in which the forms use them, and the entries sorted, so that the
+	// same report always has the same bytes.
+	numbers := map[int]int{}
+	var queue []int
+	ref := func(num int) string {
+		if _, ok := numbers[num]; !ok {
+			numbers[num] = imp.newObj()
+			queue = append(queue, num)
+		}
+		return fmt.Sprintf("%d 0 R", numbers[num])
+	}
+	isForm := map[int]bool{}
+	for _, tpl := range tpls {
+		// The size of a form shows in the scale at which it is drawn
+		// 1 by 1 point.
+		name, sx, sy, _, _ := fpdi.UseTemplate(tpl, 0, 0, 1, 1)
+		num, ok := names[name]
+		if !ok {
+			return nil, fmt.Errorf("cannot find form %s", name)
+		}
+		ref(num)
+		isForm[num] = true
+		forms = append(forms, importedForm{num: numbers[num], w: 1 / sx, h: 1 / sy})
+	}
+	for len(queue) > 0 {
+		num := queue[0]
+		queue = queue[1:]
+		obj, ok := objects[num]
+		if !ok {
+			return nil, fmt.Errorf("cannot import object %d", num)
+		}
+		value, stream, err := splitObject([]byte(obj))
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", num, err)
+		}
+		if stream == nil {
+			imp.write(numbers[num], canonical(value, ref), nil)
+			continue
+		}
+		if gray && isForm[num] { // gofpdi compresses forms
+			if stream, err = inflate(stream); err != nil {
+				return nil, fmt.Errorf("object %d: %w", num, err)
+			}
+			stream = deflate(grayContent(stream))
+		}
+		// The length may be an object of its own, which is not needed
+		// any more.
+		value = canonical(withoutKey(value, "Length"), ref)
+		value = append(value[:len(value)-2:len(value)-2], fmt.Sprintf("/Length %d >>", len(stream))...)
+		imp.write(numbers[num], value, stream)
+	}
+	return forms, nil
+}
+
+// eofLimit reads a file for gofpdi, and panics when gofpdi keeps
+// reading at its end: gofpdi takes the end of a file for an empty token,
+// and would look for the rest of a truncated file forever.
+type eofLimit struct {
+	r    *bytes.Reader
+	eofs int
+}
+
+func (l *eofLimit) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if err == io.EOF {
+		if l.eofs++; l.eofs > 1000 {
+			panic("unexpected end of file")
+		}
+	}
+	return n, err
+}
+
+func (l *eofLimit) Seek(offset int64, whence int) (int64, error) {
+	return l.r.Seek(offset, whence)
+}
+
+// splitObject splits an object that gofpdi wrote into its value and,
+// if it is a stream, the data of the stream.
+func splitObject(obj []byte) (value, stream []byte, err error) {
+	s, e := pdfValue(obj, 0)
+	value = obj[s:e]
+	s, e = pdfToken(obj, e)
+	switch string(obj[s:e]) {
+	case "endobj":
+		return value, nil, nil
+	case "stream":
+		data := bytes.TrimPrefix(obj[e:], []byte("\n"))
+		end := bytes.LastIndex(data, []byte("\nendstream"))
+		if end < 0 {
+			return nil, nil, errors.New("cannot find the end of the stream")
+		}
+		return value, data[:end], nil
+	}
+	return nil, nil, errors.New("cannot parse object")
+}
+
+// canonical returns value v with one space between its tokens, the
+// spacing that the other steps of savePDF expect, with the entries of
+// its dictionaries sorted by key, and with its references replaced by
+// what ref returns for their object numbers, in the order of the result.
+func canonical(v []byte, ref func(int) string) []byte {
+	var out []byte
+	for i := 0; ; {
+		s, e := pdfToken(v, i)
+		if s == e {
+			return out
+		}
+		tok := v[s:e]
+		if num, end, ok := pdfReference(v, s); ok {
+			tok, e = []byte(ref(num)), end
+		} else if string(tok) == "<<" {
+			s, e = pdfValue(v, s)
+			tok = sortedDict(v[s:e], ref)
+		}
+		if out != nil {
+			out = append(out, ' ')
+		}
+		out = append(out, tok...)
+		i = e
+	}
+}
+
+// sortedDict returns dictionary dict as canonical does.
+func sortedDict(dict []byte, ref func(int) string) []byte {
+	type entry struct{ key, value []byte }
+	var entries []entry
+	for _, e := pdfToken(dict, 0); ; {
+		ks, ke := pdfToken(dict, e)
+		if ks == ke || dict[ks] != '/' {
+			break
+		}
+		var vs int
+		vs, e = pdfValue(dict, ke)
+		entries = append(entries, entry{dict[ks:ke], dict[vs:e]})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	out := []byte("<<")
+	for _, en := range entries {
+		out = append(append(append(out, ' '), en.key...), ' ')
+		out = append(out, canonical(en.value, ref)...)
+	}
+	return append(out, " >>"...)
+}
+
+// ### PDF syntax
+
+// pdfToken returns the bounds of the token at or after position i of b,
+// after white space and comments; start and end are len(b) at the end
+// of b. Strings, dictionary brackets, and names are single tokens.
+func pdfToken(b []byte, i int) (start, end int) {
+	for i < len(b) {
+		if isPDFSpace(b[i]) {
+			i++
+		} else if b[i] == '%' {
+			for i < len(b) && b[i] != '\n' && b[i] != '\r' {
+				i++
+			}
+		} else {
+			break
+		}
+	}
+	if i >= len(b) {
+		return len(b), len(b)
+	}
+	start = i
+	switch c := b[i]; {
+	case (c == '<' || c == '>') && i+1 < len(b) && b[i+1] == c:
+		return start, i + 2
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		return start, i + 1
+	case c == '<':
+		if j := bytes.IndexByte(b[i:], '>'); j >= 0 {
+			return start, i + j + 1
+		}
+		return start, len(b)
+	case c == '(':
+		depth := 0
+		for ; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth == 0 {
+					return start, i + 1
+				}
+			}
+		}
+		return start, len(b)
+	case c == '/':
+		i++
+	}
+	for i < len(b) && !isPDFSpace(b[i]) && strings.IndexByte("()<>[]{}/%", b[i]) < 0 {
+		i++
+	}
+	if i == start { // a stray ")" or ">"
+		i++
+	}
+	return start, i
+}
+
+// isPDFSpace reports whether c is white space in PDF.
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// pdfValue returns the bounds of the value at or after position i of b:
+// a token, a reference, an array, or a dictionary.
+func pdfValue(b []byte, i int) (start, end int) {
+	start, end = pdfToken(b, i)
+	if _, e, ok := pdfReference(b, start); ok {
+		return start, e
+	}
+	switch string(b[start:end]) {
+	case "<<", "[":
+		for depth := 1; depth > 0; {
+			var s int
+			if s, end = pdfToken(b, end); s == end {
+				break
+			}
+			switch string(b[s:end]) {
+			case "<<", "[":
+				depth++
+			case ">>", "]":
+				depth--
+			}
+		}
+	}
+	return start, end
+}
+
+// pdfReference reports whether the tokens at position i of b are a
+// reference, "num gen R", and returns num and the end of the reference.
+func pdfReference(b []byte, i int) (num, end int, ok bool) {
+	s, e := pdfToken(b, i)
+	num, err := strconv.Atoi(string(b[s:e]))
+	if err != nil || num < 0 {
+		return 0, 0, false
+	}
+	s, e = pdfToken(b, e)
+	if _, err := strconv.Atoi(string(b[s:e])); err != nil {
+		return 0, 0, false
+	}
+	if s, e = pdfToken(b, e); string(b[s:e]) != "R" {
+		return 0, 0, false
+	}
+	return num, e, true
+}
+
+// pdfDictEntry finds key in dictionary dict and returns the start of
+// the key and the bounds of its value.
+func pdfDictEntry(dict []byte, key string) (keyStart, start, end int, ok bool) {
+	s, e := pdfToken(dict, 0)
+	if string(dict[s:e]) != "<<" {
+		return 0, 0, 0, false
+	}
+	for {
+		ks, ke := pdfToken(dict, e)
+		if ks == ke || dict[ks] != '/' {
+			return 0, 0, 0, false
+		}
+		s, e = pdfValue(dict, ke)
+		if string(dict[ks+1:ke]) == key {
+			return ks, s, e, true
+		}
+	}
+}
+
+// withoutKey returns dictionary dict without the entry of key.
+func withoutKey(dict []byte, key string) []byte {
+	ks, _, e, ok := pdfDictEntry(dict, key)
+	if !ok {
+		return dict
+	}
+	return append(append([]byte{}, dict[:ks]...), dict[e:]...)
+}
+
+// withEntry returns dictionary dict with entry appended to its entries.
+func withEntry(dict []byte, entry string) []byte {
+	end := bytes.LastIndex(dict, []byte(">>"))
+	if end < 0 {
+		return dict
+	}
+	return append(append(append([]byte{}, dict[:end]...), " "+entry+" "...), dict[end:]...)
+}
+
+// pdfObjectValue returns the value of an object as pdfObject returns
+// it, without the number and the keywords around it.
+func pdfObjectValue(obj []byte) []byte {
+	e := 0
+	for k := 0; k < 3; k++ { // number, generation, and "obj"
+		_, e = pdfToken(obj, e)
+	}
+	s, e := pdfValue(obj, e)
+	return obj[s:e]
+}
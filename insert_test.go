@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestImportForms(t *testing.T) {
+	two := testPDF(t, 2)
+	tests := []struct {
+		name  string
+		file  []byte
+		n     int
+		gray  bool
+		forms int // -1 for an error
+	}{
+		{"all pages", two, 0, false, 2},
+		{"first page", two, 1, false, 1},
+		{"more than all", two, 5, false, 2},
+		{"gray", two, 0, true, 2},
+		{"empty", nil, 0, false, -1},
+		{"not a PDF", []byte("name,total\nNorth,1200\n"), 0, false, -1},
+		{"truncated", two[:len(two)/2], 0, false, -1},
+		{"header only", []byte("%PDF-1.4\n%%EOF\n"), 0, false, -1},
+	}
+	for _, tt := range tests {
+		imp := &pageImporter{buf: &bytes.Buffer{}, next: 10, offsets: map[int]int{}}
+		forms, err := imp.importForms(tt.file, tt.n, tt.gray)
+		if tt.forms < 0 {
+			if err == nil {
+				t.Errorf("%s: imported %d forms, want an error", tt.name, len(forms))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(forms) != tt.forms {
+			t.Errorf("%s: imported %d forms, want %d", tt.name, len(forms), tt.forms)
+		}
+		for _, f := range forms {
+			if math.Abs(f.w-595.28) > 0.01 || math.Abs(f.h-841.89) > 0.01 {
+				t.Errorf("%s: form %d is %.2f by %.2f, want A4", tt.name, f.num, f.w, f.h)
+			}
+			if _, ok := imp.offsets[f.num]; !ok {
+				t.Errorf("%s: form %d was not written", tt.name, f.num)
+			}
+		}
+		// The objects are numbered from next on, without gaps.
+		for num := 10; num < imp.next; num++ {
+			if _, ok := imp.offsets[num]; !ok {
+				t.Errorf("%s: object %d is missing", tt.name, num)
+			}
+		}
+		if len(imp.offsets) != imp.next-10 {
+			t.Errorf("%s: wrote %d objects, numbered 10 to %d", tt.name, len(imp.offsets), imp.next-1)
+		}
+		content := formContent(t, imp, forms[0])
+		if colored := bytes.Contains(content, []byte(" rg")); colored == tt.gray {
+			t.Errorf("%s: content has colors = %v:\n%s", tt.name, colored, content)
+		}
+	}
+}
+
+// formContent returns the inflated content of an imported form.
+func formContent(t *testing.T, imp *pageImporter, f importedForm) []byte {
+	t.Helper()
+	obj := imp.buf.Bytes()[imp.offsets[f.num]:]
+	start := bytes.Index(obj, []byte("stream\n"))
+	end := bytes.Index(obj, []byte("\nendstream"))
+	if start < 0 || end < start {
+		t.Fatalf("form %d is not a stream", f.num)
+	}
+	content, err := inflate(obj[start+len("stream\n") : end])
+	if err != nil {
+		t.Fatalf("form %d: %v", f.num, err)
+	}
+	return content
+}
+
+func TestImportFormsDeterministic(t *testing.T) {
+	file := testPDF(t, 3)
+	var first []byte
+	for i := 0; i < 5; i++ {
+		imp := &pageImporter{buf: &bytes.Buffer{}, next: 1, offsets: map[int]int{}}
+		if _, err := imp.importForms(file, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = imp.buf.Bytes()
+		} else if !bytes.Equal(imp.buf.Bytes(), first) {
+			t.Fatal("importing the same file twice gave different bytes")
+		}
+	}
+}
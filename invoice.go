@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ## Invoices
+
+// Invoices are tables, too: one row per line item. Invoice mode reads a
+// structured JSON or YAML document instead of CSV data and renders it
+// with address blocks, the line items, a totals block, and the payment
+// terms at the bottom of each page.
+
+// Invoice is the input of invoice mode.
+type Invoice struct {
+	Number string `json:"number"`
+
+	// Date and DueDate are written as YYYY-MM-DD. Date defaults to
+	// today; DueDate is optional.
+	Date    string `json:"date"`
+	DueDate string `json:"dueDate"`
+
+	From   Address  `json:"from"`
+	BillTo Address  `json:"billTo"`
+	ShipTo *Address `json:"shipTo"`
+
+	// Currency is the currency symbol. Default: "$".
+	Currency string `json:"currency"`
+
+	// CurrencyCode is the ISO 4217 code of the currency, such as "EUR".
+	// E-invoices require it.
+	CurrencyCode string `json:"currencyCode"`
+
+	Items []LineItem `json:"items"`
+
+	// TaxRate is the tax rate in percent, applied to all items that are
+	// not tax exempt.
+	TaxRate float64 `json:"taxRate"`
+
+	// TaxExemptReason says why items are tax exempt. E-invoices with
+	// tax exempt items require it.
+	TaxExemptReason string `json:"taxExemptReason"`
+
+	// Terms are the payment terms, printed in the footer.
+	Terms string `json:"terms"`
+}
+
+// Address is a name followed by any number of address lines. The other
+// fields are for e-invoices, which require at least the country.
+type Address struct {
+	Name  string   `json:"name"`
+	Lines []string `json:"lines"`
+
+	PostCode string `json:"postCode"`
+	City     string `json:"city"`
+	Country  string `json:"country"` // ISO 3166-1 code, such as "DE"
+	VATID    string `json:"vatID"`
+}
+
+// LineItem is one row of the invoice.
+type LineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+	TaxExempt   bool    `json:"taxExempt"`
+
+	// Unit is the unit of the quantity in e-invoices, as a code of
+	// UN/ECE Recommendation 20, such as "HUR" for hours. Default: "C62"
+	// (one piece).
+	Unit string `json:"unit"`
+}
+
+// total returns the line total, rounded to cents.
+func (li LineItem) total(mode roundingMode) float64 {
+	return mode.float(new(big.Rat).Mul(ratFromFloat(li.Quantity), ratFromFloat(li.UnitPrice)), 2)
+}
+
+// loadInvoice reads an invoice from a .json, .yaml, or .yml file.
+func loadInvoice(fsys FileSystem, path string) (*Invoice, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+	inv := &Invoice{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(inv); err != nil {
+		return nil, err
+	}
+	return inv, inv.check()
+}
+
+// check rejects invoices that cannot be billed.
+func (inv *Invoice) check() error {
+	if inv.Number == "" {
+		return errors.New("invoice number missing")
+	}
+	if len(inv.Items) == 0 {
+		return errors.New("invoice has no line items")
+	}
+	for i, li := range inv.Items {
+		if li.Quantity < 0 || li.UnitPrice < 0 {
+			return fmt.Errorf("line item %d: quantity and unit price must not be negative", i+1)
+		}
+	}
+	for _, d := range []string{inv.Date, inv.DueDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("invalid date %q; use YYYY-MM-DD", d)
+		}
+	}
+	if inv.TaxRate < 0 {
+		return errors.New("tax rate must not be negative")
+	}
+	return nil
+}
+
+// totals returns the subtotal, the tax, and the grand total. Tax is
+// computed on the sum of the taxable line totals and rounded once.
+func (inv *Invoice) totals(mode roundingMode) (subtotal, tax, total float64) {
+	var sub, taxable decimalSum
+	for _, li := range inv.Items {
+		t := li.total(mode)
+		sub.addFloat(t)
+		if !li.TaxExempt {
+			taxable.addFloat(t)
+		}
+	}
+	r := new(big.Rat).Mul(&taxable.sum, ratFromFloat(inv.TaxRate))
+	r.Quo(r, big.NewRat(100, 1))
+	tax = mode.float(r, 2)
+	subtotal = mode.float(&sub.sum, 2)
+	return subtotal, tax, mode.float(new(big.Rat).Add(&sub.sum, ratFromFloat(tax)), 2)
+}
+
+// money formats an amount in the invoice currency.
+func (inv *Invoice) money(loc *locale, v float64) string {
+	s, _ := loc.currency(orDefault(inv.Currency, "$"), v)
+	return s
+}
+
+// invoiceColumns is the layout of the line item table.
+var invoiceColumns = []ColumnConfig{
+	{Index: 0, Width: 100, Align: "L"},
+	{Index: 1, Width: 25, Align: "R"},
+	{Index: 2, Width: 30, Align: "R"},
+	{Index: 3, Width: 35, Align: "R"},
+}
+
+// generateInvoice renders and saves the invoice of a job.
+func generateInvoice(env *Env, cfg *Config, job *Job) error {
+	inv, err := loadInvoice(env.FS, job.Invoice)
+	if err != nil {
+		return fmt.Errorf("cannot load invoice '%s': %w", job.Invoice, err)
+	}
+	pdf, err := renderInvoice(env, cfg, inv)
+	if err != nil {
+		return fmt.Errorf("failed creating invoice: %w", err)
+	}
+	if cfg.EInvoice != nil {
+		date := env.Clock.Now()
+		if inv.Date != "" {
+			date, _ = time.Parse("2006-01-02", inv.Date)
+		}
+		f, err := cfg.EInvoice.file(inv, cfg.locale().rounding, date)
+		if err != nil {
+			return fmt.Errorf("cannot create e-invoice: %w", err)
+		}
+		cfg.Archive.files = []archiveFile{f}
+	}
+	output := expandOutput(job.Output, env.Clock.Now())
+	if _, err := savePDF(pdf, cfg, env.FS, output, cfg.finishers(env, nil, nil)...); err != nil {
+		return fmt.Errorf("cannot save PDF: %w", err)
+	}
+	return nil
+}
+
+// renderInvoice fills the invoice document. The line items go through
+// the same `header()` and `table()` functions as the report's data.
+func renderInvoice(env *Env, cfg *Config, inv *Invoice) (pdf *Fpdf, err error) {
+	prog := progress{ctx: env.context()}
+	defer prog.recoverRender(&err)
+
+	prog.enter("title")
+	loc := cfg.locale()
+	pdf = newPDF("P", "mm", "Letter", "")
+	setupDocument(pdf, env, cfg)
+	if inv.Terms != "" {
+		pdf.SetFooterFunc(func() {
+			pdf.SetY(-20)
+			pdf.SetFont("Times", "I", 10)
+			pdf.MultiCell(0, 5, loc.print(inv.Terms), "T", "C", false)
+		})
+	}
+	pdf.AddPage()
+
+	// The seller's address on the left, the invoice details on the right.
+	pdf.SetFont("Times", "B", 28)
+	pdf.CellFormat(0, 12, loc.text("invoice"), "", 1, "R", false, 0, "")
+	top := pdf.GetY()
+	addressBlock(pdf, loc, "", inv.From)
+	bottom := pdf.GetY()
+	date := inv.Date
+	if date == "" {
+		date = loc.date(env.Clock.Now(), loc.shortDate)
+	}
+	details := [][2]string{{loc.msg("invoiceNo"), inv.Number}, {loc.msg("date"), date}}
+	if inv.DueDate != "" {
+		details = append(details, [2]string{loc.msg("dueDate"), inv.DueDate})
+	}
+	pdf.SetY(top)
+	for _, d := range details {
+		pdf.SetX(130)
+		pdf.SetFont("Times", "B", 11)
+		pdf.CellFormat(30, 6, loc.print(d[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Times", "", 11)
+		pdf.CellFormat(0, 6, loc.print(d[1]), "", 1, "R", false, 0, "")
+	}
+	pdf.SetY(math.Max(bottom, pdf.GetY()) + 12)
+
+	// Bill-to and ship-to addresses, side by side.
+	prog.enter("addresses")
+	top = pdf.GetY()
+	addressBlock(pdf, loc, loc.msg("billTo"), inv.BillTo)
+	bottom = pdf.GetY()
+	if inv.ShipTo != nil {
+		pdf.SetY(top)
+		pdf.SetLeftMargin(110)
+		pdf.SetX(110)
+		addressBlock(pdf, loc, loc.msg("shipTo"), *inv.ShipTo)
+		pdf.SetLeftMargin(10)
+		bottom = math.Max(bottom, pdf.GetY())
+	}
+	pdf.SetXY(10, bottom+10)
+
+	// The line items.
+	prog.enter("header")
+	icfg := &Config{Columns: invoiceColumns, loc: loc}
+	header(pdf, []string{loc.msg("description"), loc.msg("quantity"), loc.msg("unitPrice"), loc.msg("amount")}, icfg, &prog)
+	prog.enter("table")
+	rows := make([][]string, len(inv.Items))
+	for i, li := range inv.Items {
+		rows[i] = []string{
+			li.Description,
+			strconv.FormatFloat(li.Quantity, 'f', -1, 64),
+			inv.money(loc, li.UnitPrice),
+			inv.money(loc, li.total(loc.rounding)),
+		}
+	}
+	table(pdf, rows, icfg, nil, &prog)
+
+	// The totals block sits below the last two columns.
+	prog.enter("totals")
+	subtotal, tax, total := inv.totals(loc.rounding)
+	labelX := 10 + invoiceColumns[0].Width + invoiceColumns[1].Width
+	lines := [][2]string{{loc.msg("invoiceSubtotal"), inv.money(loc, subtotal)}}
+	if inv.TaxRate > 0 {
+		rate := loc.number(strconv.FormatFloat(inv.TaxRate, 'f', -1, 64))
+		lines = append(lines, [2]string{loc.msg("tax", rate), inv.money(loc, tax)})
+	}
+	pdf.Ln(2)
+	pdf.SetFont("Times", "", 12)
+	for _, l := range lines {
+		pdf.SetX(labelX)
+		pdf.CellFormat(invoiceColumns[2].Width, 7, loc.print(l[0]), "", 0, "L", false, 0, "")
+		pdf.CellFormat(invoiceColumns[3].Width, 7, loc.print(l[1]), "", 1, "R", false, 0, "")
+	}
+	pdf.SetX(labelX)
+	pdf.SetFont("Times", "B", 14)
+	pdf.SetFillColor(240, 240, 240)
+	pdf.CellFormat(invoiceColumns[2].Width, 9, loc.text("total"), "LTB", 0, "L", true, 0, "")
+	pdf.CellFormat(invoiceColumns[3].Width, 9, loc.print(inv.money(loc, total)), "RTB", 1, "R", true, 0, "")
+
+	if pdf.Err() {
+		return nil, pdf.Error()
+	}
+	return pdf, nil
+}
+
+// addressBlock prints an optional caption, the name, and the address
+// lines at the current position.
+func addressBlock(pdf *Fpdf, loc *locale, caption string, a Address) {
+	if caption != "" {
+		pdf.SetFont("Times", "B", 10)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.CellFormat(0, 5, loc.print(strings.ToUpper(caption)), "", 1, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.SetFont("Times", "B", 12)
+	pdf.CellFormat(0, 6, loc.print(a.Name), "", 1, "L", false, 0, "")
+	pdf.SetFont("Times", "", 12)
+	for _, l := range a.Lines {
+		pdf.CellFormat(0, 6, loc.print(l), "", 1, "L", false, 0, "")
+	}
+}
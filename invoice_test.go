@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInvoiceTotals(t *testing.T) {
+	inv := &Invoice{TaxRate: 19, Items: []LineItem{
+		{Quantity: 2, UnitPrice: 19.99},
+		{Quantity: 1, UnitPrice: 0.125},
+		{Quantity: 1, UnitPrice: 10, TaxExempt: true},
+	}}
+	for _, tt := range []struct {
+		mode                 roundingMode
+		subtotal, tax, total float64
+	}{
+		{"", 50.11, 7.62, 57.73},
+		{"halfEven", 50.10, 7.62, 57.72},
+		{"down", 50.10, 7.61, 57.71},
+	} {
+		subtotal, tax, total := inv.totals(tt.mode)
+		if subtotal != tt.subtotal || tax != tt.tax || total != tt.total {
+			t.Errorf("%q: totals = %v, %v, %v, want %v, %v, %v", tt.mode, subtotal, tax, total, tt.subtotal, tt.tax, tt.total)
+		}
+	}
+}
+
+func TestLoadInvoice(t *testing.T) {
+	env := testEnv(map[string]string{
+		"inv.yaml": "number: A-17\ndate: 2024-03-01\nbillTo:\n  name: Acme\nitems:\n  - description: Consulting\n    quantity: 3\n    unitPrice: 120\n",
+	})
+	inv, err := loadInvoice(env.FS, "inv.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Number != "A-17" || inv.BillTo.Name != "Acme" || len(inv.Items) != 1 || inv.Items[0].total("") != 360 {
+		t.Errorf("loadInvoice = %+v", inv)
+	}
+
+	for _, tt := range []struct {
+		json, err string
+	}{
+		{`{"number": "1", "items": [{"quantity": 1}], "vat": 7}`, `unknown field "vat"`},
+		{`{"items": [{"quantity": 1}]}`, "invoice number missing"},
+		{`{"number": "1"}`, "invoice has no line items"},
+		{`{"number": "1", "items": [{"quantity": 1}, {"quantity": -1}]}`, "line item 2: quantity and unit price must not be negative"},
+		{`{"number": "1", "items": [{"quantity": 1}], "dueDate": "03/01/2024"}`, `invalid date "03/01/2024"`},
+		{`{"number": "1", "items": [{"quantity": 1}], "taxRate": -5}`, "tax rate must not be negative"},
+	} {
+		env := testEnv(map[string]string{"inv.json": tt.json})
+		if _, err := loadInvoice(env.FS, "inv.json"); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.json, err, tt.err)
+		}
+	}
+}
+
+func TestGenerateInvoice(t *testing.T) {
+	env := testEnv(map[string]string{
+		"inv.json": `{"number": "A-17", "taxRate": 19, "terms": "Payable within 30 days",
+			"from": {"name": "Widgets Inc."}, "billTo": {"name": "Acme", "lines": ["1 Main St"]},
+			"items": [{"description": "Widget", "quantity": 2, "unitPrice": 19.99}]}`,
+	})
+	if err := generate(env, &Job{Invoice: "inv.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	for _, want := range []string{"(INVOICE)", "(A-17)", "(2024-03-15)", "(Acme)", "(1 Main St)", "(Widget)", "(Tax \\(19%\\))", "($7.60)", "($47.58)", "(Payable within 30 days)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the invoice lacks %s", want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ## Label sheets
+
+// Address labels and name badges come on sheets with a fixed grid of
+// labels. In label mode, every row fills one label from a template (see
+// merge mode for the template syntax), left to right and top to bottom,
+// with a new sheet whenever the grid is full.
+
+// LabelsConfig enables label mode. The sheet geometry comes from a
+// known label format or from the individual settings, which override
+// the format's values. All lengths are in mm.
+type LabelsConfig struct {
+	Template     string `json:"template"`
+	TemplateFile string `json:"templateFile"`
+
+	// Format is a known label format: "avery-5160", "avery-5163", or
+	// "avery-l7163".
+	Format string `json:"format"`
+
+	// PageSize is "Letter" or "A4".
+	PageSize string `json:"pageSize"`
+
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+
+	MarginTop  float64 `json:"marginTop"`
+	MarginLeft float64 `json:"marginLeft"`
+
+	// GapX and GapY are the spaces between neighboring labels.
+	GapX float64 `json:"gapX"`
+	GapY float64 `json:"gapY"`
+
+	// Padding is the space between the label's edge and its text.
+	// Default: 3.
+	Padding float64 `json:"padding"`
+
+	// FontSize is the text size in points. Default: 10.
+	FontSize float64 `json:"fontSize"`
+
+	// Skip leaves the first labels of the first sheet empty, to reuse a
+	// partially used sheet.
+	Skip int `json:"skip"`
+
+	// Border outlines each label, which helps to test the alignment on
+	// plain paper.
+	Border bool `json:"border"`
+}
+
+// labelFormats are the geometries of common label sheets.
+var labelFormats = map[string]LabelsConfig{
+	"avery-5160": {PageSize: "Letter", Rows: 10, Columns: 3, Width: 66.675, Height: 25.4,
+		MarginTop: 12.7, MarginLeft: 4.7625, GapX: 3.175},
+	"avery-5163": {PageSize: "Letter", Rows: 5, Columns: 2, Width: 101.6, Height: 50.8,
+		MarginTop: 12.7, MarginLeft: 3.96875, GapX: 4.7625},
+	"avery-l7163": {PageSize: "A4", Rows: 7, Columns: 2, Width: 99.1, Height: 38.1,
+		MarginTop: 15.15, MarginLeft: 4.65, GapX: 2.5},
+}
+
+// geometry returns the settings with the format's values filled in.
+func (lc *LabelsConfig) geometry() (LabelsConfig, error) {
+	g := *lc
+	if lc.Format != "" {
+		f, ok := labelFormats[strings.ToLower(lc.Format)]
+		if !ok {
+			return g, fmt.Errorf("unknown label format %q", lc.Format)
+		}
+		g.PageSize = orDefault(g.PageSize, f.PageSize)
+		for _, v := range []struct{ dst, src *float64 }{
+			{&g.Width, &f.Width}, {&g.Height, &f.Height},
+			{&g.MarginTop, &f.MarginTop}, {&g.MarginLeft, &f.MarginLeft},
+			{&g.GapX, &f.GapX}, {&g.GapY, &f.GapY},
+		} {
+			if *v.dst == 0 {
+				*v.dst = *v.src
+			}
+		}
+		if g.Rows == 0 {
+			g.Rows = f.Rows
+		}
+		if g.Columns == 0 {
+			g.Columns = f.Columns
+		}
+	}
+	if g.Rows < 1 || g.Columns < 1 || g.Width <= 0 || g.Height <= 0 {
+		return g, fmt.Errorf("labels need rows, columns, width, and height, or a format")
+	}
+	g.PageSize = orDefault(g.PageSize, "Letter")
+	g.Padding = orDefaultFloat(g.Padding, 3)
+	g.FontSize = orDefaultFloat(g.FontSize, 10)
+	return g, nil
+}
+
+// run renders the label sheets for rows into a single document.
+func (lc *LabelsConfig) run(env *Env, cfg *Config, hdr []string, rows [][]string, output string) error {
+	g, err := lc.geometry()
+	if err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+	tmpl, err := rowTemplate(env.FS, "labels", lc.Template, lc.TemplateFile)
+	if err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+
+	pdf := newPDF("P", "mm", g.PageSize, "")
+	setupDocument(pdf, env, cfg)
+	pdf.SetAutoPageBreak(false, 0)
+	perSheet := g.Rows * g.Columns
+	for r, line := range rows {
+		n := r + g.Skip
+		if n%perSheet == 0 || r == 0 {
+			pdf.AddPage()
+		}
+		n %= perSheet
+		x := g.MarginLeft + float64(n%g.Columns)*(g.Width+g.GapX)
+		y := g.MarginTop + float64(n/g.Columns)*(g.Height+g.GapY)
+		text, err := execRow(tmpl, hdr, line)
+		if err != nil {
+			return fmt.Errorf("labels template: %w", err)
+		}
+		g.label(pdf, x, y, text)
+	}
+	if pdf.Err() {
+		return fmt.Errorf("failed creating label sheets: %w", pdf.Error())
+	}
+	return publish(env, cfg, pdf, &part{output: output, rows: rows})
+}
+
+// label prints the text of one label at x, y. Text that does not fit is
+// cut off at the label's edge. Lines starting with "# " are bold.
+func (lc *LabelsConfig) label(pdf *Fpdf, x, y float64, text string) {
+	if lc.Border {
+		pdf.RoundedRect(x, y, lc.Width, lc.Height, 2, "1234", "D")
+	}
+	pdf.ClipRect(x, y, lc.Width, lc.Height, false)
+	lineHeight := lc.FontSize * 0.3528 * 1.2 // points to mm, plus leading
+	pdf.SetXY(x+lc.Padding, y+lc.Padding)
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		style := ""
+		if strings.HasPrefix(line, "# ") {
+			style, line = "B", strings.TrimPrefix(line, "# ")
+		}
+		pdf.SetFont("Times", style, lc.FontSize)
+		pdf.SetX(x + lc.Padding)
+		pdf.MultiCell(lc.Width-2*lc.Padding, lineHeight, line, "", "L", false)
+	}
+	pdf.ClipEnd()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLabelGeometry(t *testing.T) {
+	g, err := (&LabelsConfig{Format: "Avery-L7163", Rows: 6, MarginTop: 20}).geometry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := labelFormats["avery-l7163"]
+	want.Format, want.Rows, want.MarginTop, want.Padding, want.FontSize = "Avery-L7163", 6, 20, 3, 10
+	if g != want {
+		t.Errorf("geometry = %+v, want %+v", g, want)
+	}
+	g, err = (&LabelsConfig{Rows: 2, Columns: 2, Width: 50, Height: 30, Padding: 1}).geometry()
+	if err != nil || g.PageSize != "Letter" || g.Padding != 1 || g.FontSize != 10 {
+		t.Errorf("geometry = %+v, %v", g, err)
+	}
+	for _, lc := range []LabelsConfig{
+		{Format: "avery-9999"},
+		{Rows: 2, Columns: 2, Width: 50},
+		{Columns: 2, Width: 50, Height: 30},
+	} {
+		if _, err := lc.geometry(); err == nil {
+			t.Errorf("geometry(%+v) succeeds", lc)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("Name,City\n")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&csv, "Name %d,City %d\n", i, i)
+	}
+	env := testEnv(map[string]string{
+		"in.csv": csv.String(),
+		"cfg.json": `{"labels": {"template": "# {{.Name}}\n{{.City}}\n",
+			"rows": 2, "columns": 2, "width": 80, "height": 40, "marginTop": 10, "marginLeft": 10, "gapX": 5, "skip": 1}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	if n := strings.Count(data, "/Type /Page\n"); n != 2 {
+		t.Errorf("%d sheets, want 2", n)
+	}
+	// The first label is skipped, so the five labels fill the sheets
+	// at these grid positions (column, row).
+	content := pageContents(t, []byte(data))
+	type pos struct{ x, y float64 }
+	at := map[int]pos{}
+	for _, m := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \(Name (\d)\)Tj`).FindAllStringSubmatch(content, -1) {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		n, _ := strconv.Atoi(m[3])
+		at[n] = pos{x, y}
+	}
+	if len(at) != 5 {
+		t.Fatalf("labels at %v, want five", at)
+	}
+	k := 72 / 25.4
+	for _, tt := range []struct{ label, col, row int }{
+		{1, 1, 0}, {2, 0, 1}, {3, 1, 1}, {4, 0, 0}, {5, 1, 0},
+	} {
+		origin := at[4] // the first label of the second sheet
+		wantX := origin.x + float64(tt.col)*85*k
+		wantY := origin.y - float64(tt.row)*40*k
+		// The content stream has two decimals.
+		if got := at[tt.label]; math.Abs(got.x-wantX) > 0.01 || math.Abs(got.y-wantY) > 0.01 {
+			t.Errorf("label %d at %v, want (%.2f, %.2f)", tt.label, got, wantX, wantY)
+		}
+	}
+	if !strings.Contains(content, "(City 5)Tj") {
+		t.Error("the second template line is missing")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ## Limits
+
+// A query without a WHERE clause turns a two-page report into one of
+// four thousand pages that nobody reads and the mail server rejects.
+// Limits guard against this:
+//
+//	"limits": {"maxRows": 5000, "maxPages": 100, "lenient": true,
+//	  "fullData": "The complete data is in the sales dashboard."}
+//
+// By default, a report that exceeds a limit fails. In lenient mode, the
+// table is cut off instead, and a notice page that follows it says what
+// was left out and how to get the complete data. If the data is attached
+// to the report (see AttachConfig), the notice points to the attachment,
+// which holds all rows.
+
+// LimitsConfig sets limits on the size of a report.
+type LimitsConfig struct {
+	// MaxRows is the maximum number of table rows.
+	MaxRows int `json:"maxRows"`
+
+	// MaxPages is the page on which the table must end. The notice
+	// page and the appendix come on top.
+	MaxPages int `json:"maxPages"`
+
+	// Lenient truncates the table instead of failing.
+	Lenient bool `json:"lenient"`
+
+	// FullData tells readers how to get the complete data. Default: a
+	// pointer to the attachment, if any, or else to the sender.
+	FullData string `json:"fullData"`
+}
+
+// truncation records where and why the table was cut off.
+type truncation struct {
+	shown, total int
+	limit        string // "truncatedRows" or "truncatedPages"
+	max          int
+}
+
+// stop reports whether the table of total rows must end before row r,
+// which is h high. It sets an error on pdf if the limits are strict.
+func (lc *LimitsConfig) stop(pdf Backend, r, total int, h float64) *truncation {
+	if lc == nil {
+		return nil
+	}
+	var t *truncation
+	switch {
+	case lc.MaxRows > 0 && r >= lc.MaxRows:
+		t = &truncation{shown: r, total: total, limit: "truncatedRows", max: lc.MaxRows}
+	case lc.MaxPages > 0 && pdf.PageNo() >= lc.MaxPages:
+		// The row would start a new page.
+		_, pageH := pdf.GetPageSize()
+		_, _, _, bottom := pdf.GetMargins()
+		if pdf.GetY()+h > pageH-bottom {
+			t = &truncation{shown: r, total: total, limit: "truncatedPages", max: lc.MaxPages}
+		}
+	}
+	if t != nil && !lc.Lenient {
+		if t.limit == "truncatedRows" {
+			pdf.SetError(fmt.Errorf("the report has %d rows, more than maxRows (%d)", total, lc.MaxRows))
+		} else {
+			pdf.SetError(fmt.Errorf("the report has more than maxPages (%d) pages", lc.MaxPages))
+		}
+	}
+	return t
+}
+
+// truncationNotice adds a page that explains a truncated table.
+// attachment is the name of the attached data, if any.
+func truncationNotice(pdf *Fpdf, cfg *Config, t *truncation, attachment string) *Fpdf {
+	if t == nil {
+		return pdf
+	}
+	loc := cfg.locale()
+	full := cfg.Limits.FullData
+	switch {
+	case full != "":
+	case attachment != "":
+		full = loc.msg("fullDataAttached", attachment)
+	default:
+		full = loc.msg("fullData")
+	}
+
+	addPage(pdf, cfg.Orientation.of("appendix"))
+	left, top, right, _ := pdf.GetMargins()
+	w, _ := pdf.GetPageSize()
+	pdf.SetXY(left, top+10)
+	pdf.SetFillColor(255, 243, 205)
+	pdf.SetDrawColor(230, 160, 0)
+	pdf.SetLineWidth(0.8)
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(w-left-right, 14, loc.text("truncated"), "LTR", 1, cfg.mirrored(ColumnConfig{}, "L"), true, 0, "")
+	pdf.SetFont("Times", "", 14)
+	text := loc.msg(t.limit, t.shown, t.total, t.max) + "\n\n" + full
+	pdf.MultiCell(w-left-right, 8, loc.print(text), "LBR", cfg.mirrored(ColumnConfig{}, "L"), true)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetFillColor(255, 255, 255)
+	return pdf
+}
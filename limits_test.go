@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("Item,Total\n")
+	for i := 1; i <= 80; i++ {
+		fmt.Fprintf(&csv, "Item%d,%d\n", i, i)
+	}
+	tests := []struct {
+		limits string
+		err    string   // for strict limits
+		want   []string // in the content of the lenient report
+		absent string
+	}{
+		{`{"maxRows": 5}`, "the report has 80 rows, more than maxRows (5)",
+			[]string{"(Item5)", "Report truncated", "first 5 of 80 rows", "Please ask the sender"}, "(Item6)"},
+		{`{"maxPages": 1, "fullData": "See the sales dashboard."}`, "the report has more than maxPages (1) pages",
+			[]string{"(Item20)", "Report truncated", "limited to 1 pages", "See the sales dashboard."}, "(Item80)"},
+		{`{"maxRows": 80, "maxPages": 5}`, "", []string{"(Item80)"}, "Report truncated"},
+	}
+	for _, tt := range tests {
+		for _, lenient := range []bool{false, true} {
+			limits := tt.limits
+			if lenient {
+				limits = strings.Replace(limits, "{", `{"lenient": true, `, 1)
+			}
+			env := testEnv(map[string]string{"in.csv": csv.String(), "cfg.json": `{"limits": ` + limits + `}`})
+			err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+			if !lenient && tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("%s: %v, want %q", tt.limits, err, tt.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s, lenient %v: %v", tt.limits, lenient, err)
+				continue
+			}
+			content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("%s, lenient %v: the report lacks %q", tt.limits, lenient, want)
+				}
+			}
+			if strings.Contains(content, tt.absent) {
+				t.Errorf("%s, lenient %v: the report contains %q", tt.limits, lenient, tt.absent)
+			}
+		}
+	}
+}
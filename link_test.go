@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkURL(t *testing.T) {
+	hdr := []string{"Order ID", "Region", "Total"}
+	lc := &LinkConfig{Column: ColumnRef{Name: "Order ID"}, URL: "https://crm.example.com/{{ Region }}/orders/{{Order ID}}?src=pdf"}
+	if err := lc.resolve(hdr); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		line []string
+		want string
+	}{
+		{[]string{"A-1", "West", "10"}, "https://crm.example.com/West/orders/A-1?src=pdf"},
+		{[]string{" A/2 ", "North East", "10"}, "https://crm.example.com/North%20East/orders/A%2F2?src=pdf"},
+		{[]string{"A-3"}, "https://crm.example.com//orders/A-3?src=pdf"},
+	} {
+		if got := lc.url(tt.line); got != tt.want {
+			t.Errorf("url(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if !lc.applies([]string{"A-1"}, 0) || lc.applies([]string{" "}, 0) || lc.applies([]string{"A-1", "West"}, 1) {
+		t.Error("links apply to the wrong cells")
+	}
+	if (*LinkConfig)(nil).applies([]string{"A-1"}, 0) {
+		t.Error("links apply without a configuration")
+	}
+
+	for _, lc := range []*LinkConfig{
+		{Column: ColumnRef{Name: "Order ID"}, URL: "https://crm.example.com/{{Order ID"},
+		{Column: ColumnRef{Name: "Order ID"}, URL: "https://crm.example.com/{{Customer}}"},
+		{Column: ColumnRef{Name: "Customer"}, URL: "https://crm.example.com/"},
+	} {
+		if err := lc.resolve(hdr); err == nil {
+			t.Errorf("resolve(%q, %q) succeeds", lc.Column.Name, lc.URL)
+		}
+	}
+}
+
+func TestRowLinks(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Order ID,Total\nA-1,10\nA/2,20\n,30\n",
+		"cfg.json": `{"link": {"column": "Order ID", "url": "https://crm.example.com/orders/{{Order ID}}"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	for _, want := range []string{"/URI (https://crm.example.com/orders/A-1)", "/URI (https://crm.example.com/orders/A%2F2)"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("the report lacks the link %q", want)
+		}
+	}
+	if n := strings.Count(data, "/URI ("); n != 2 {
+		t.Errorf("%d links, want one per row with an ID", n)
+	}
+}
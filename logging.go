@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ## Logging and progress
+
+// A report of a hundred thousand rows takes minutes, and until it is
+// done, the tool says nothing. With `-progress`, it shows how far it got:
+//
+//	report.pdf [==========>         ]  52%  52000/100000 rows, 613 pages
+//
+// Everything else it has to say goes to standard error as log lines,
+// one event per line, with key=value pairs that log collectors can
+// parse -- or as JSON objects with `-log-format json`:
+//
+//	time=2026-10-17T05:20:41Z level=INFO msg="report written" output=report.pdf rows=100000 pages=1178
+//
+// `-log-level` sets the least severe level that is logged: debug, info
+// (the default), warn, or error.
+
+// logLevel is the severity of a log event.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Logger writes structured log events. A nil Logger discards them.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level logLevel
+	json  bool
+
+	// warned, if not nil, receives all warnings and errors, whatever the
+	// level; see runSummary.
+	warned func(line string)
+}
+
+// NewLogger returns a Logger that writes events of the given level
+// ("debug", "info", "warn", or "error"; default: "info") and above to w,
+// as key=value pairs or, if format is "json", as JSON objects.
+func NewLogger(w io.Writer, level, format string) (*Logger, error) {
+	l := &Logger{w: w, level: levelInfo}
+	if level != "" {
+		found := false
+		for i, name := range levelNames {
+			if strings.EqualFold(level, name) {
+				l.level, found = logLevel(i), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	switch format {
+	case "", "text":
+	case "json":
+		l.json = true
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return l, nil
+}
+
+// Debug, Info, Warn, and Error log msg with alternating keys and values
+// in args.
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(levelDebug, msg, args) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.log(levelInfo, msg, args) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.log(levelWarn, msg, args) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(levelError, msg, args) }
+
+func (l *Logger) log(level logLevel, msg string, args []interface{}) {
+	if l != nil && l.warned != nil && level >= levelWarn {
+		l.warned(summaryLine(msg, args))
+	}
+	if l == nil || level < l.level {
+		return
+	}
+	attrs := []interface{}{"time", time.Now().Format(time.RFC3339), "level", levelNames[level], "msg", msg}
+	attrs = append(attrs, args...)
+	if len(attrs)%2 == 1 {
+		attrs = append(attrs[:len(attrs)-1], "!BADKEY", attrs[len(attrs)-1])
+	}
+
+	var buf bytes.Buffer
+	if l.json {
+		buf.WriteByte('{')
+	}
+	for i := 0; i < len(attrs); i += 2 {
+		key, value := fmt.Sprint(attrs[i]), logValue(attrs[i+1])
+		switch {
+		case l.json:
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(key)
+			v, err := json.Marshal(value)
+			if err != nil {
+				v, _ = json.Marshal(fmt.Sprint(value))
+			}
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(v)
+		default:
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(key)
+			buf.WriteByte('=')
+			buf.WriteString(logfmtQuote(fmt.Sprint(value)))
+		}
+	}
+	if l.json {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// withWarnings returns a Logger that writes like l and passes warnings
+// and errors to warned.
+func (l *Logger) withWarnings(warned func(line string)) *Logger {
+	if l == nil {
+		return &Logger{w: ioutil.Discard, level: levelError + 1, warned: warned}
+	}
+	return &Logger{w: l.w, level: l.level, json: l.json, warned: warned}
+}
+
+// logValue converts values that have no useful JSON form.
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// logfmtQuote quotes s if it is empty or contains spaces, quotes, or
+// equal signs.
+func logfmtQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// fatal logs err and ends the program with the exit code of err; see
+// exitCode.
+func fatal(l *Logger, err error) {
+	if l == nil {
+		l, _ = NewLogger(os.Stderr, "", "")
+	}
+	l.Error(err.Error())
+	os.Exit(exitCode(err))
+}
+
+// ProgressEvent tells how far rendering a report got.
+type ProgressEvent struct {
+	Report    string // the output path
+	Rows      int    // table rows printed so far
+	TotalRows int
+	Pages     int
+	Done      bool
+}
+
+// progressBar returns a progress callback that draws a bar on w. It
+// redraws only when the percentage changes.
+func progressBar(w io.Writer) func(ProgressEvent) {
+	var mu sync.Mutex
+	last := map[string]int{}
+	return func(ev ProgressEvent) {
+		// A report is complete only when it is done, not with its last
+		// row.
+		percent := 100
+		if !ev.Done {
+			percent = 0
+			if ev.TotalRows > 0 {
+				percent = ev.Rows * 99 / ev.TotalRows
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if p, ok := last[ev.Report]; ok && p == percent && !ev.Done {
+			return
+		}
+		last[ev.Report] = percent
+		const width = 20
+		filled := percent * width / 100
+		bar := strings.Repeat("=", filled)
+		if filled < width {
+			bar += ">" + strings.Repeat(" ", width-filled-1)
+		}
+		fmt.Fprintf(w, "\r%s [%s] %3d%%  %d/%s, %s", ev.Report, bar, percent, ev.Rows, pluralize(ev.TotalRows, "row", "rows"), pluralize(ev.Pages, "page", "pages"))
+		if ev.Done {
+			fmt.Fprintln(w)
+			delete(last, ev.Report)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLines returns the lines written to buf, without their time.
+func logLines(buf *bytes.Buffer) []string {
+	text := regexp.MustCompile(`time=\S+ |"time":"[^"]+",`).ReplaceAllString(buf.String(), "")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, "WARN", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("not logged")
+	l.Warn("cannot save cache", "cache", "my cache.json", "err", errors.New(`say "hi"`), "empty", "", "odd")
+	l.Error("failed", "after", 1500*time.Millisecond, "at", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC))
+	want := []string{
+		`level=WARN msg="cannot save cache" cache="my cache.json" err="say \"hi\"" empty="" !BADKEY=odd`,
+		`level=ERROR msg=failed after=1.5s at=2024-03-15T10:30:00Z`,
+	}
+	if got := logLines(&buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("text log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	buf.Reset()
+	l, _ = NewLogger(&buf, "debug", "json")
+	l.Debug("rows enriched", "keys", 3, "err", errors.New("timeout"), "ratio", math.Inf(1))
+	want = []string{`{"level":"DEBUG","msg":"rows enriched","keys":3,"err":"timeout","ratio":"+Inf"}`}
+	if got := logLines(&buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON log %q, want %q", got, want)
+	}
+
+	var nilLogger *Logger
+	nilLogger.Error("discarded")
+
+	for _, args := range [][2]string{{"verbose", ""}, {"", "xml"}} {
+		if _, err := NewLogger(&buf, args[0], args[1]); err == nil {
+			t.Errorf("NewLogger(%q, %q) succeeds", args[0], args[1])
+		}
+	}
+}
+
+func TestLoggerWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := NewLogger(&buf, "error", "")
+	for _, l := range []*Logger{l, nil} {
+		var warned []string
+		w := l.withWarnings(func(line string) { warned = append(warned, line) })
+		w.Info("report written")
+		w.Warn("report larger than the size limit")
+		w.Error("job failed")
+		if len(warned) != 2 {
+			t.Errorf("warnings %q, want the warning and the error", warned)
+		}
+	}
+	if got := logLines(&buf); len(got) != 1 || !strings.Contains(got[0], "job failed") {
+		t.Errorf("log %q, want the error only", got)
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	bar := progressBar(&buf)
+	for _, ev := range []ProgressEvent{
+		{Report: "a.pdf", Rows: 0, TotalRows: 200, Pages: 1},
+		{Report: "a.pdf", Rows: 1, TotalRows: 200, Pages: 1}, // still 0%
+		{Report: "a.pdf", Rows: 100, TotalRows: 200, Pages: 2},
+		{Report: "a.pdf", Rows: 200, TotalRows: 200, Pages: 3}, // 99% until done
+		{Report: "a.pdf", Rows: 200, TotalRows: 200, Pages: 3, Done: true},
+		{Report: "b.pdf", Rows: 0, TotalRows: 0, Pages: 1, Done: true},
+	} {
+		bar(ev)
+	}
+	want := "\ra.pdf [>                   ]   0%  0/200 rows, 1 page" +
+		"\ra.pdf [=========>          ]  49%  100/200 rows, 2 pages" +
+		"\ra.pdf [===================>]  99%  200/200 rows, 3 pages" +
+		"\ra.pdf [====================] 100%  200/200 rows, 3 pages\n" +
+		"\rb.pdf [====================] 100%  0/0 rows, 1 page\n"
+	if buf.String() != want {
+		t.Errorf("progress bar:\n%q\nwant:\n%q", buf.String(), want)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\nPears,20\nPlums,30\n"})
+	var events []ProgressEvent
+	env.Progress = func(ev ProgressEvent) { events = append(events, ev) }
+	var buf bytes.Buffer
+	env.Log, _ = NewLogger(&buf, "", "")
+	if err := generate(env, &Job{Input: "in.csv", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []ProgressEvent{
+		{Report: "out.pdf", Rows: 1, TotalRows: 3, Pages: 1},
+		{Report: "out.pdf", Rows: 2, TotalRows: 3, Pages: 1},
+		{Report: "out.pdf", Rows: 3, TotalRows: 3, Pages: 1},
+		{Report: "out.pdf", Rows: 3, TotalRows: 3, Pages: 1, Done: true},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("progress events %+v, want %+v", events, want)
+	}
+	if got := logLines(&buf); !reflect.DeepEqual(got, []string{`level=INFO msg="report written" output=out.pdf rows=3 pages=1`}) {
+		t.Errorf("log %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Generation manifest
+
+// A report that turns up months later raises the question where its
+// numbers came from. With
+//
+//	"manifest": {"print": true}
+//
+// every report carries a manifest: the version of this program, the
+// input file with its SHA-256 checksum, the number of rows read from it,
+// the time the report was made, which deterministic reports round to the
+// start of the day, and its parameters. Reports from a data
+// source have no input file; their checksum is that of the records, as
+// CSV. The manifest is part of the XMP metadata, where PDF viewers and
+// tools such as exiftool find it, and with "print", it is also printed
+// in small type at the end of the report. The version is set when the
+// program is built:
+//
+//	go build -ldflags "-X main.version=1.4.0"
+
+// ManifestConfig embeds the generation manifest into the report.
+type ManifestConfig struct {
+	// Print also prints the manifest at the end of the report.
+	Print bool `json:"print"`
+}
+
+// version is the version of this program.
+var version = "devel"
+
+// manifest is what the manifest says about the reports of a job.
+type manifest struct {
+	input     string // the input file, or the kind of data source
+	sum       string // the SHA-256 checksum of the input, in hex
+	rows      int
+	generated time.Time
+	params    map[string]string
+}
+
+// newManifest describes the input of job, which held the given records
+// and rows, and was read at the given time.
+func newManifest(env *Env, cfg *Config, job *Job, records [][]string, rows int, generated time.Time) (*manifest, error) {
+	m := &manifest{input: job.Input, rows: rows, generated: generated, params: job.Params}
+	var data []byte
+	if s := cfg.Source; s != nil {
+		m.input = "sql"
+		if s.REST != nil {
+			m.input = "rest"
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.WriteAll(records)
+		data = buf.Bytes()
+	} else {
+		var err error
+		if data, err = readFile(env.FS, job.Input); err != nil {
+			return nil, err
+		}
+	}
+	sum := sha256.Sum256(data)
+	m.sum = hex.EncodeToString(sum[:])
+	return m, nil
+}
+
+// paramList returns the parameters as name=value, sorted by name.
+func (m *manifest) paramList() string {
+	var pairs []string
+	for name, value := range m.params {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// xmp returns the XMP description of the manifest, with the PDF/A
+// extension schema that defines it, or "" if m is nil.
+func (m *manifest) xmp() string {
+	if m == nil {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:manifest="` + manifestNS + `">` + "\n")
+	for _, p := range []struct{ name, value string }{
+		{"Version", version},
+		{"Input", m.input},
+		{"InputSHA256", m.sum},
+		{"Rows", strconv.Itoa(m.rows)},
+		{"Generated", m.generated.Format("2006-01-02T15:04:05")},
+		{"Parameters", m.paramList()},
+	} {
+		fmt.Fprintf(&b, "<manifest:%s>", p.name)
+		xmlEscape(&b, p.value)
+		fmt.Fprintf(&b, "</manifest:%s>\n", p.name)
+	}
+	b.WriteString("</rdf:Description>\n")
+	b.WriteString(manifestSchemaXMP)
+	return b.String()
+}
+
+// packet returns an XMP packet with the manifest alone, for reports
+// without other metadata.
+func (m *manifest) packet() []byte {
+	return []byte(`<?xpacket begin="` + "\xef\xbb\xbf" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+` + m.xmp() + `</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
+
+const manifestNS = "https://github.com/appliedgo/pdf/ns/manifest/"
+
+// manifestSchemaXMP describes the properties of the manifest for PDF/A.
+const manifestSchemaXMP = `<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Generation manifest</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>` + manifestNS + `</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>manifest</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Version</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>Version of the generating program</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Input</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>Input file or data source</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>InputSHA256</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>SHA-256 checksum of the input</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Rows</pdfaProperty:name><pdfaProperty:valueType>Integer</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>Number of rows read from the input</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Generated</pdfaProperty:name><pdfaProperty:valueType>Date</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>Time of generation</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Parameters</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>Parameters of the report</pdfaProperty:description></rdf:li>
+</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+`
+
+// printManifest prints the manifest in small type at the end of the
+// report.
+func printManifest(pdf *Fpdf, cfg *Config) *Fpdf {
+	m := cfg.manifest
+	if m == nil || !cfg.Manifest.Print {
+		return pdf
+	}
+	text := fmt.Sprintf("Generated by %s %s on %s from %s (SHA-256 %s), %s",
+		archiveProducer, version, m.generated.Format("2006-01-02 15:04:05"), m.input, m.sum, pluralize(m.rows, "row", "rows"))
+	if len(m.params) > 0 {
+		text += "; " + m.paramList()
+	}
+	pdf.SetFont("Times", "", 7)
+	if spaceLeft(pdf) < 12 {
+		addPage(pdf, "")
+	}
+	pdf.Ln(4)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.MultiCell(0, 3, cfg.locale().print(text), "", cfg.mirrored(ColumnConfig{}, "L"), false)
+	pdf.SetTextColor(0, 0, 0)
+	return pdf
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	input := "Item,Total\nApples,10\nPears,5\nPlums,3\n"
+	env := testEnv(map[string]string{
+		"in.csv":   input,
+		"cfg.json": `{"manifest": {"print": true}, "deterministic": true}`,
+	})
+	job := &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Params: map[string]string{"region": "EMEA", "period": "Q3"}}
+	if err := generate(env, job); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(input))
+	hash := hex.EncodeToString(sum[:])
+	pdf := testFile(t, env, "out.pdf")
+	for _, want := range []string{
+		"<manifest:Version>devel</manifest:Version>",
+		"<manifest:Input>in.csv</manifest:Input>",
+		"<manifest:InputSHA256>" + hash + "</manifest:InputSHA256>",
+		"<manifest:Rows>3</manifest:Rows>",
+		"<manifest:Generated>2024-03-15T00:00:00</manifest:Generated>",
+		"<manifest:Parameters>period=Q3, region=EMEA</manifest:Parameters>",
+		"<pdfaSchema:prefix>manifest</pdfaSchema:prefix>",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("the metadata lacks %s", want)
+		}
+	}
+	content := pageContents(t, []byte(pdf))
+	if !strings.Contains(content, "(Generated by appliedgo/pdf devel on 2024-03-15 00:00:00 from in.csv \\(SHA-256 "+hash+"\\), 3 rows; period=Q3, region=EMEA)") {
+		t.Error("the printed manifest is missing")
+	}
+}
+
+func TestManifestSource(t *testing.T) {
+	records := [][]string{{"region", "total"}, {"North", "12.5"}}
+	cfg := &Config{Source: &SourceConfig{REST: &RESTSource{}}}
+	m, err := newManifest(testEnv(nil), cfg, &Job{}, records, 1, testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("region,total\nNorth,12.5\n"))
+	if m.input != "rest" || m.sum != hex.EncodeToString(sum[:]) {
+		t.Errorf("manifest of a REST source: input %q, checksum %s", m.input, m.sum)
+	}
+	if (*manifest)(nil).xmp() != "" {
+		t.Error("a nil manifest has metadata")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// ## Memory budget
+
+// In a container with a memory limit of 512 MiB, a report that needs a
+// little more is not slow; it is killed, without a word in the log. A
+// memory budget makes the tool plan for the limit instead:
+//
+//	pdf -max-memory 400MiB -config sales.json sales.csv
+//
+// With a budget,
+//
+//   - the garbage collector runs twice as often, unless GOGC is set;
+//   - `-engine auto` selects the direct engine for plain tables that
+//     gofpdf would not fit into the budget, and reports that do not fit
+//     either way are logged as a warning;
+//   - split and recipient reports are rendered by fewer workers at a
+//     time, so that the parts that render together fit;
+//   - transform caches keep no more entries in memory than a sixteenth
+//     of the budget holds. Further values are transformed again when
+//     they come up;
+//   - the resource cache of batch runs keeps no more fonts and images
+//     than an eighth of the budget holds; see `ResourceCache`.
+//
+// The budget should leave some room below the container's limit: the
+// input is read in full, and the estimates are rough.
+//
+// Nothing spills to disk. gofpdf keeps the whole document in memory
+// until it is written, and the finishing steps work on all of its
+// bytes at once, so the large parts of a run cannot be moved out of
+// memory; the budget picks an engine and a number of workers that fit
+// instead, and drops what can be made again.
+
+// Rough memory costs in bytes, measured with a table of 100,000 rows.
+const (
+	gofpdfCellCost = 500 // per table cell, rendered by gofpdf
+	directCellCost = 100 // per table cell, rendered by the direct engine
+	cacheEntryCost = 256 // per transform cache entry
+)
+
+// parseSize parses a size such as "512MiB", "2G", or "1000000". K, M,
+// and G count in powers of 1024, with or without "i" and "B".
+func parseSize(s string) (int64, error) {
+	t := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	t = strings.TrimSuffix(t, "I")
+	unit := int64(1)
+	if n := len(t); n > 0 {
+		switch t[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			t = t[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q; use a size such as 512MiB", s)
+	}
+	return n * unit, nil
+}
+
+// setMemoryBudget sets env's budget and tunes the garbage collector.
+func (env *Env) setMemoryBudget(budget int64) {
+	env.MaxMemory = budget
+	if env.Resources != nil {
+		env.Resources.setLimit(budget / 8)
+	}
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(50)
+	}
+	env.Log.Debug("memory budget set", "bytes", budget)
+}
+
+// fits reports whether a table of rows × cols cells fits into the
+// budget when rendered by the given engine.
+func (env *Env) fits(rows, cols int, direct bool) bool {
+	if env.MaxMemory <= 0 {
+		return true
+	}
+	cost := int64(gofpdfCellCost)
+	if direct {
+		cost = directCellCost
+	}
+	return int64(rows)*int64(cols)*cost <= env.MaxMemory
+}
+
+// partWorkers returns how many of n workers may render parts with cols
+// columns at the same time. It assumes that every worker renders the
+// largest part.
+func (env *Env) partWorkers(parts []*part, cols, n int) int {
+	if env.MaxMemory <= 0 {
+		return n
+	}
+	largest := 1
+	for _, p := range parts {
+		largest = maxInt(largest, len(p.rows))
+	}
+	fit := int(env.MaxMemory / (int64(largest) * int64(cols) * gofpdfCellCost))
+	if fit < n {
+		env.Log.Debug("fewer workers for the memory budget", "workers", maxInt(fit, 1))
+		return maxInt(fit, 1)
+	}
+	return n
+}
+
+// cacheLimit returns the number of entries that each of n transform
+// caches may keep in memory, or 0 for no limit.
+func (env *Env) cacheLimit(n int) int {
+	if env.MaxMemory <= 0 || n == 0 {
+		return 0
+	}
+	return maxInt(1, int(env.MaxMemory/16/cacheEntryCost)/n)
+}
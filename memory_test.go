@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1000000", 1000000},
+		{"512MiB", 512 << 20},
+		{"512mb", 512 << 20},
+		{"2G", 2 << 30},
+		{" 64 KiB ", 64 << 10},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		if got, err := parseSize(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MiB", "0", "-1G", "1.5G", "12TB"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) succeeded", in)
+		}
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	env := &Env{}
+	if !env.fits(1<<20, 100, false) || env.partWorkers([]*part{{rows: make([][]string, 1000)}}, 10, 8) != 8 || env.cacheLimit(2) != 0 {
+		t.Error("no budget limits the run")
+	}
+
+	// 1,000 rows of 10 columns take 5,000,000 bytes with gofpdf and
+	// 1,000,000 with the direct engine.
+	env.MaxMemory = 2000000
+	if env.fits(1000, 10, false) || !env.fits(1000, 10, true) || !env.fits(400, 10, false) {
+		t.Error("wrong estimates of what fits")
+	}
+	parts := []*part{{rows: make([][]string, 100)}, {rows: make([][]string, 200)}}
+	for _, tt := range []struct{ n, want int }{{8, 2}, {2, 2}, {1, 1}} {
+		if got := env.partWorkers(parts, 10, tt.n); got != tt.want {
+			t.Errorf("%d workers for parts of 200 rows: got %d, want %d", tt.n, got, tt.want)
+		}
+	}
+	if got := env.partWorkers([]*part{{rows: make([][]string, 10000)}}, 10, 8); got != 1 {
+		t.Errorf("a part that does not fit: %d workers, want 1", got)
+	}
+	// A sixteenth of the budget holds 488 entries.
+	for _, tt := range []struct{ n, want int }{{0, 0}, {1, 488}, {2, 244}} {
+		if got := env.cacheLimit(tt.n); got != tt.want {
+			t.Errorf("%d caches: limit %d, want %d", tt.n, got, tt.want)
+		}
+	}
+	env.MaxMemory = 1
+	if got := env.cacheLimit(3); got != 1 {
+		t.Errorf("a tiny budget: limit %d, want 1", got)
+	}
+}
+
+func TestSetMemoryBudget(t *testing.T) {
+	if os.Getenv("GOGC") != "" {
+		t.Skip("GOGC is set")
+	}
+	old := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(old)
+
+	env := &Env{Resources: NewResourceCache()}
+	env.setMemoryBudget(800 << 20)
+	if env.MaxMemory != 800<<20 || env.Resources.limit != 100<<20 {
+		t.Errorf("budget %d, resource limit %d", env.MaxMemory, env.Resources.limit)
+	}
+	if percent := debug.SetGCPercent(100); percent != 50 {
+		t.Errorf("GC percent %d, want 50", percent)
+	}
+}
+
+func TestTransformCacheBudget(t *testing.T) {
+	gs := newGeoServer()
+	defer gs.Close()
+	env := testEnv(map[string]string{
+		"in.csv": "City,Total\nParis,1\nBerlin,2\nParis,3\nAtlantis,4\nAtlantis,5\n",
+		"cfg.json": `{"columns": [{"name": "City", "transform": [{"op": "fetch", "url": "` + gs.URL + `/geo?q={value}", "path": "results.0.country"}],
+			"cache": {}}]}`,
+	})
+	// The budget holds two entries, for the first two cities; Atlantis
+	// is looked up again.
+	env.MaxMemory = 2 * 16 * cacheEntryCost
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Engine: "gofpdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gs.calls(), map[string]int{"Paris": 1, "Berlin": 1, "Atlantis": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("looked up %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ## Mail merge
+
+// Personalized letters and certificates are one document per person.
+// In merge mode, every row fills a text/template of its own, and the
+// result becomes a separate PDF -- or a separate page of one PDF.
+//
+// The template sees the row as a map from column names to values, so
+// {{.Name}} prints the "Name" column. Names that are not identifiers
+// need the index function: {{index . "Order ID"}}. Lines starting with
+// "# " are printed as headings.
+
+// MergeConfig enables merge mode.
+type MergeConfig struct {
+	// Template is the text/template of each document; TemplateFile
+	// reads it from a file instead.
+	Template     string `json:"template"`
+	TemplateFile string `json:"templateFile"`
+
+	// Output is a text/template for the file name of each document, like
+	// SplitConfig.Output. {{.Value}} is the value of the column named by
+	// Key, or the row number if Key is not set.
+	// Default: "{{.Base}}-{{.Index}}.pdf".
+	Output string     `json:"output"`
+	Key    *ColumnRef `json:"key"`
+
+	// Pages puts all documents into the job's output file, one page per
+	// row, instead of writing separate files.
+	Pages bool `json:"pages"`
+
+	// Workers is the number of documents generated concurrently.
+	// Default: the number of CPUs.
+	Workers int `json:"workers"`
+}
+
+// run generates the merged documents for rows.
+func (mc *MergeConfig) run(env *Env, cfg *Config, hdr []string, rows [][]string, output string) error {
+	tmpl, err := mc.template(env.FS)
+	if err != nil {
+		return err
+	}
+	if mc.Pages {
+		p := &part{output: output, rows: rows}
+		return mc.write(env, cfg, tmpl, hdr, p)
+	}
+
+	// Each row is a part of its own, named like the parts of split mode.
+	parts := make([]*part, len(rows))
+	for r, line := range rows {
+		parts[r] = &part{value: strconv.Itoa(r + 1), rows: [][]string{line}}
+		if mc.Key != nil {
+			parts[r].value = cellAt(line, mc.Key.Index)
+		}
+	}
+	if err := nameParts(parts, orDefault(mc.Output, "{{.Base}}-{{.Index}}.pdf"), output); err != nil {
+		return fmt.Errorf("merge output: %w", err)
+	}
+	sc := &SplitConfig{Workers: mc.Workers}
+	err = forEachPart(parts, sc.workers(), func(p *part) error {
+		if err := env.canceled(); err != nil {
+			return err
+		}
+		return mc.write(env, cfg, tmpl, hdr, p)
+	})
+	return cfg.Delivery.sendDigest(env, parts, err)
+}
+
+// template parses the document template.
+func (mc *MergeConfig) template(fsys FileSystem) (*template.Template, error) {
+	tmpl, err := rowTemplate(fsys, "merge", mc.Template, mc.TemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("merge: %w", err)
+	}
+	return tmpl, nil
+}
+
+// rowTemplate parses a template for a single row, given as text or as
+// the name of a file.
+func rowTemplate(fsys FileSystem, name, text, file string) (*template.Template, error) {
+	if file != "" {
+		f, err := fsys.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return nil, errors.New("template or templateFile is required")
+	}
+	return template.New(name).Funcs(templateFuncs()).Option("missingkey=error").Parse(text)
+}
+
+// execRow executes a row template with the row's fields, a map from
+// column names to values.
+func execRow(tmpl *template.Template, hdr, line []string) (string, error) {
+	fields := map[string]string{}
+	for i, h := range hdr {
+		fields[h] = cellAt(line, i)
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, fields)
+	return buf.String(), err
+}
+
+// write renders the rows of p, one page each, then saves and delivers
+// the document.
+func (mc *MergeConfig) write(env *Env, cfg *Config, tmpl *template.Template, hdr []string, p *part) error {
+	pdf := newPDF("P", "mm", "Letter", "")
+	setupDocument(pdf, env, cfg)
+	for _, line := range p.rows {
+		text, err := execRow(tmpl, hdr, line)
+		if err != nil {
+			return fmt.Errorf("merge template: %w", err)
+		}
+		pdf.AddPage()
+		mergePage(pdf, text)
+	}
+	if pdf.Err() {
+		return fmt.Errorf("failed creating PDF document: %w", pdf.Error())
+	}
+	return publish(env, cfg, pdf, p)
+}
+
+// mergePage prints the text of one document. Paragraphs wrap at the
+// right margin.
+func mergePage(pdf *Fpdf, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			pdf.SetFont("Times", "B", 20)
+			pdf.MultiCell(0, 10, strings.TrimPrefix(line, "# "), "", "L", false)
+			pdf.Ln(4)
+			continue
+		}
+		pdf.SetFont("Times", "", 12)
+		pdf.MultiCell(0, 6, line, "", "L", false)
+	}
+}
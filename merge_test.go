@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mergeCSV = "Name,Course,Order ID\nAda Lovelace,Analytics,A-1\nAlan Turing,Logic,A/2\n"
+
+func TestMerge(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":      mergeCSV,
+		"letter.tmpl": "# Certificate\n{{.Name}} completed {{.Course}} ({{index . \"Order ID\"}}).",
+		"cfg.json":    `{"merge": {"templateFile": "letter.tmpl", "key": "Order ID", "output": "cert-{{.Value}}.pdf", "workers": 2}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := files(t, env.FS), []string{"cert-A-1.pdf", "cert-A_2.pdf", "cfg.json", "in.csv", "letter.tmpl", "stats.png"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %q, want %q", got, want)
+	}
+	for name, want := range map[string]string{
+		"cert-A-1.pdf": "(Ada Lovelace completed Analytics \\(A-1\\).)Tj",
+		"cert-A_2.pdf": "(Alan Turing completed Logic \\(A/2\\).)Tj",
+	} {
+		content := pageContents(t, []byte(testFile(t, env, name)))
+		if !strings.Contains(content, want) || !strings.Contains(content, "(Certificate)Tj") {
+			t.Errorf("%s lacks the certificate text %q:\n%s", name, want, content)
+		}
+		if strings.Count(content, "(Certificate)Tj") != 1 {
+			t.Errorf("%s has more than one page", name)
+		}
+	}
+}
+
+func TestMergePages(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   mergeCSV,
+		"cfg.json": `{"merge": {"template": "Dear {{.Name}},", "pages": true}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	if n := strings.Count(data, "/Type /Page\n"); n != 2 {
+		t.Errorf("%d pages, want one per row", n)
+	}
+	content := pageContents(t, []byte(data))
+	ada, alan := strings.Index(content, "(Dear Ada Lovelace,)Tj"), strings.Index(content, "(Dear Alan Turing,)Tj")
+	if ada < 0 || alan < ada {
+		t.Errorf("the letters are missing or out of order:\n%s", content)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"merge": {}}`, "merge: template or templateFile is required"},
+		{`{"merge": {"templateFile": "missing.tmpl"}}`, "merge: "},
+		{`{"merge": {"template": "{{.Name"}}`, "merge: template: merge:1: unclosed action"},
+		{`{"merge": {"template": "{{.Nmae}}"}}`, `merge template: template: merge:1:2: executing "merge" at <.Nmae>: map has no entry for key "Nmae"`},
+		{`{"merge": {"template": "x", "output": "same.pdf"}}`, `merge output: "same.pdf" is generated twice`},
+		{`{"merge": {"template": "x", "key": "Missing"}}`, "Missing"},
+	} {
+		env := testEnv(map[string]string{"in.csv": mergeCSV, "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
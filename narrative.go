@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+)
+
+// ## Narrative text
+
+// A few sentences below the title tell the reader what the numbers
+// mean. The narrative is a text/template with the template functions
+// and access to the data, for example:
+//
+//	{{pluralize .Rows "order" "orders"}} worth {{.Sum "Total" | currency "$"}}.
+type narrativeData struct {
+	Date time.Time
+	Rows int
+
+	hdr  []string
+	rows [][]string
+}
+
+// Sum adds up the numeric values of the named column.
+func (nd narrativeData) Sum(column string) float64 {
+	sum := nd.aggregate(column)
+	return sum.float()
+}
+
+// Avg returns the mean of the numeric values of the named column.
+func (nd narrativeData) Avg(column string) float64 {
+	sum := nd.aggregate(column)
+	if sum.n == 0 {
+		return 0
+	}
+	v, _ := sum.mean().Float64()
+	return v
+}
+
+func (nd narrativeData) aggregate(column string) *decimalSum {
+	i := indexOf(nd.hdr, column)
+	var sum decimalSum
+	for _, line := range nd.rows {
+		sum.add(cellAt(line, i))
+	}
+	return &sum
+}
+
+// narrative prints the narrative text below the title. With footnotes,
+// the text may contain notes.
+func narrative(pdf *Fpdf, text string, nd narrativeData, loc *locale, notes *footnotes) *Fpdf {
+	if text == "" {
+		return pdf
+	}
+	str, err := execTemplateFuncs("narrative", text, nd, loc.funcs())
+	if err != nil {
+		pdf.SetError(err)
+		return pdf
+	}
+	pdf.SetFont("Times", "", 14)
+	if notes != nil {
+		writeNoted(pdf, notes, 6, str)
+		pdf.Ln(12)
+		return pdf
+	}
+	pdf.MultiCell(0, 6, loc.print(str), "", "", false)
+	pdf.Ln(6)
+	return pdf
+}
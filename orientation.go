@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ## Page orientation
+
+// The report is printed in landscape, which suits a wide table but
+// wastes half of the title page and makes the appendix hard to read.
+// Each section can have its own orientation, "P" for portrait or "L"
+// for landscape:
+//
+//	"orientation": {"title": "P", "table": "L", "appendix": "P"}
+//
+// The title section holds the title, the date, and the narrative; the
+// table section the table, its endnotes, and the logo; the appendix the
+// truncation notice and the list of invalid rows. A section that changes
+// the orientation starts on a new page. Everything that depends on the
+// page size -- footnotes, page breaks, limits, the position of the logo
+// -- follows the orientation of the page it is printed on.
+
+// OrientationConfig sets the orientation of the sections of the report.
+// The default is landscape.
+type OrientationConfig struct {
+	Title    string `json:"title"`
+	Table    string `json:"table"`
+	Appendix string `json:"appendix"`
+}
+
+func (oc *OrientationConfig) prepare() error {
+	for _, o := range []struct{ name, value string }{{"title", oc.Title}, {"table", oc.Table}, {"appendix", oc.Appendix}} {
+		switch o.value {
+		case "", "P", "L":
+		default:
+			return fmt.Errorf("%s: unknown orientation %q; use P or L", o.name, o.value)
+		}
+	}
+	return nil
+}
+
+// of returns the orientation of a section: "title", "table", or
+// "appendix".
+func (oc *OrientationConfig) of(section string) string {
+	o := ""
+	if oc != nil {
+		switch section {
+		case "title":
+			o = oc.Title
+		case "table":
+			o = oc.Table
+		case "appendix":
+			o = oc.Appendix
+		}
+	}
+	return orDefault(o, "L")
+}
+
+// orientation returns the orientation of the current page.
+func orientation(pdf Backend) string {
+	if w, h := pdf.GetPageSize(); w > h {
+		return "L"
+	}
+	return "P"
+}
+
+// addPage starts a new page in the given orientation or, if it is
+// empty, in the orientation of the current page. Unlike AddPage, which
+// falls back to the orientation the document was created with, it keeps
+// a section in its orientation.
+func addPage(pdf Backend, o string) {
+	if o == "" {
+		o = orientation(pdf)
+	}
+	w, h := pdf.GetPageSize()
+	pdf.AddPageFormat(o, SizeType{Wd: math.Min(w, h), Ht: math.Max(w, h)})
+}
+
+// startSection starts a new page if the section needs a different
+// orientation than the current page.
+func startSection(pdf *Fpdf, o string) {
+	if orientation(pdf) != o {
+		addPage(pdf, o)
+	}
+}
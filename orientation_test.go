@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pageOrientations returns the orientation of each page of a gofpdf
+// document, "P" or "L", in order. Pages without a media box of their
+// own have the size of the document.
+func pageOrientations(t *testing.T, data string) string {
+	t.Helper()
+	box := regexp.MustCompile(`/MediaBox \[0 0 ([\d.]+) ([\d.]+)\]`)
+	of := func(m []string) string {
+		w, _ := strconv.ParseFloat(m[1], 64)
+		h, _ := strconv.ParseFloat(m[2], 64)
+		if w > h {
+			return "L"
+		}
+		return "P"
+	}
+	pages := regexp.MustCompile(`/Type /Pages\n[^>]*`).FindString(data)
+	def := box.FindStringSubmatch(pages)
+	if def == nil {
+		t.Fatal("no document media box")
+	}
+	var o strings.Builder
+	for _, page := range regexp.MustCompile(`/Type /Page\n[^>]*`).FindAllString(data, -1) {
+		if m := box.FindStringSubmatch(page); m != nil {
+			o.WriteString(of(m))
+		} else {
+			o.WriteString(of(def))
+		}
+	}
+	return o.String()
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		orientation, want string
+	}{
+		{``, "LL"},
+		{`{"title": "P", "appendix": "P"}`, "PLP"},
+		{`{"title": "P", "table": "P"}`, "PL"},
+		{`{"title": "P", "table": "P", "appendix": "P"}`, "PP"},
+		{`{"table": "P", "appendix": "L"}`, "LPL"},
+	}
+	for _, tt := range tests {
+		cfg := `{"schema": {"columns": [{"name": "Total", "type": "int"}], "onError": "appendix"}}`
+		if tt.orientation != "" {
+			cfg = strings.Replace(cfg, "{", `{"orientation": `+tt.orientation+`, `, 1)
+		}
+		env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\nPears,x\n", "cfg.json": cfg})
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := pageOrientations(t, testFile(t, env, "out.pdf")); got != tt.want {
+			t.Errorf("%s: pages %s, want %s", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestOrientationConfig(t *testing.T) {
+	oc := &OrientationConfig{Title: "P"}
+	for section, want := range map[string]string{"title": "P", "table": "L", "appendix": "L", "other": "L"} {
+		if got := oc.of(section); got != want {
+			t.Errorf("of(%q) = %q, want %q", section, got, want)
+		}
+	}
+	if got := (*OrientationConfig)(nil).of("title"); got != "L" {
+		t.Errorf("default orientation %q, want L", got)
+	}
+	env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n", "cfg.json": `{"orientation": {"table": "portrait"}}`})
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), `orientation: table: unknown orientation "portrait"; use P or L`) {
+		t.Errorf("unknown orientation: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ## Replacing reports
+
+// Reports are never written in place: writeOutput writes them under a
+// temporary name and renames the file when it is complete, so that a
+// job that picks up `report.pdf` finds either the old report or the new
+// one, but never half of one. Whether a report may replace an earlier
+// one at all is up to the configuration:
+//
+//	"output": {"backup": true, "noClobber": false}
+//
+// With "backup", the earlier report is kept as `report.pdf.bak`, which
+// in turn replaces the backup of the run before. The backup is made
+// only once the new report is complete, and `report.pdf` stays in place
+// until the new report replaces it. With "noClobber", a run fails
+// instead of replacing an existing report, and writes nothing, even if
+// another run writes the same report at the same time. `-no-clobber`
+// does the same for a single run, and `-force` replaces the report even
+// if the configuration says "noClobber". Both apply to local files
+// only; cloud storage keeps versions itself.
+
+// OutputConfig says how a report replaces an earlier one.
+type OutputConfig struct {
+	// Backup keeps the earlier report as <output>.bak.
+	Backup bool `json:"backup"`
+
+	// NoClobber fails rather than replace an existing report.
+	NoClobber bool `json:"noClobber"`
+}
+
+// backupPath returns the name of the backup of the report at path.
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// clobberPolicy applies -force and -no-clobber of job to the
+// configuration.
+func (c *Config) clobberPolicy(job *Job) error {
+	if job.Force && job.NoClobber {
+		return fmt.Errorf("-force and -no-clobber exclude each other")
+	}
+	c.noClobber = (c.Output != nil && c.Output.NoClobber || job.NoClobber) && !job.Force
+	return nil
+}
+
+// saveOutput stores the report data at path, unless it must not replace
+// a report there, and keeps the earlier report if asked to.
+func (c *Config) saveOutput(fsys FileSystem, path string, data []byte) error {
+	backup := c.Output != nil && c.Output.Backup
+	if isRemote(path) || !c.noClobber && !backup {
+		return writeOutput(fsys, path, data)
+	}
+	tmp, err := writeTemp(fsys, path, data)
+	if err != nil {
+		return err
+	}
+	if c.noClobber {
+		err = noClobber(fsys, tmp, path)
+	} else {
+		if err = keepBackup(fsys, path); err != nil {
+			err = fmt.Errorf("cannot keep a backup: %w", err)
+		} else {
+			err = fsys.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+	}
+	return err
+}
+
+// noClobber moves the complete report tmp to path, unless there is a
+// report at path already. A hard link fails if there is one, even if
+// another run has only just written it; file systems without hard links
+// check first.
+func noClobber(fsys FileSystem, tmp, path string) error {
+	if lfs, ok := fsys.(LinkFS); ok {
+		err := lfs.Link(tmp, path)
+		if err == nil {
+			fsys.Remove(tmp)
+			return nil
+		}
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s exists; use -force to replace it", path)
+		}
+	}
+	if f, err := fsys.Open(path); err == nil {
+		f.Close()
+		return fmt.Errorf("%s exists; use -force to replace it", path)
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// keepBackup makes the report at path, if there is one, its backup. The
+// report stays where it is until the new one replaces it: the backup is
+// a hard link to it, or else a copy.
+func keepBackup(fsys FileSystem, path string) error {
+	bak := backupPath(path)
+	if lfs, ok := fsys.(LinkFS); ok {
+		tmp := tempPath(bak)
+		fsys.Remove(tmp)
+		err := lfs.Link(path, tmp)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err == nil {
+			if err = fsys.Rename(tmp, bak); err != nil {
+				fsys.Remove(tmp)
+			}
+			return err
+		}
+	}
+	data, err := readFile(fsys, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(fsys, bak, data)
+}
+
+// LinkFS is implemented by file systems that can give a file a second
+// name. Link fails if there is a file of the new name.
+type LinkFS interface {
+	Link(oldname, newname string) error
+}
+
+// Link creates newname as a hard link to oldname.
+func (osFileSystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Link gives the contents of a file a second name.
+func (m *MemFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if _, ok := m.files[newname]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	m.files[newname] = data
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fullFS is a MemFS on a full disk: writes to new files fail.
+type fullFS struct {
+	*MemFS
+}
+
+func (fs fullFS) Create(name string) (io.WriteCloser, error) {
+	w, err := fs.MemFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return fullWriter{w}, nil
+}
+
+type fullWriter struct {
+	io.WriteCloser
+}
+
+func (w fullWriter) Write(p []byte) (int, error) {
+	w.WriteCloser.Write(p[:len(p)/2])
+	return len(p) / 2, errors.New("no space left on device")
+}
+
+// files returns the names of all files of fsys.
+func files(t *testing.T, fsys FileSystem) []string {
+	t.Helper()
+	names, err := fsys.Glob("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestWriteOutput(t *testing.T) {
+	mem := NewMemFS(map[string][]byte{"report.pdf": []byte("old")})
+	if err := writeOutput(mem, "report.pdf", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, mem); !reflect.DeepEqual(got, []string{"report.pdf"}) {
+		t.Errorf("files %q after writing", got)
+	}
+
+	// A failed write leaves the earlier report as it was.
+	err := writeOutput(fullFS{mem}, "report.pdf", []byte("newer"))
+	if err == nil || err.Error() != "no space left on device" {
+		t.Errorf("write to a full disk: %v", err)
+	}
+	if got := files(t, mem); !reflect.DeepEqual(got, []string{"report.pdf"}) {
+		t.Errorf("files %q after a failed write", got)
+	}
+	if data, _ := readFile(mem, "report.pdf"); string(data) != "new" {
+		t.Errorf("the report is %q after a failed write", data)
+	}
+}
+
+func TestSaveOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The OS file system makes backups with hard links, MemFS with
+	// copies.
+	for _, fsys := range []FileSystem{NewMemFS(nil), osFileSystem{}} {
+		path := "report.pdf"
+		if fsys == (osFileSystem{}) {
+			path = filepath.Join(dir, path)
+		}
+		cfg := &Config{Output: &OutputConfig{Backup: true}}
+		for _, data := range []string{"first", "second", "third"} {
+			if err := cfg.saveOutput(fsys, path, []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if data, _ := readFile(fsys, path); string(data) != "third" {
+			t.Errorf("%T: the report is %q", fsys, data)
+		}
+		if data, _ := readFile(fsys, backupPath(path)); string(data) != "second" {
+			t.Errorf("%T: the backup is %q", fsys, data)
+		}
+
+		cfg = &Config{noClobber: true}
+		err := cfg.saveOutput(fsys, path, []byte("fourth"))
+		if err == nil || !strings.HasSuffix(err.Error(), "report.pdf exists; use -force to replace it") {
+			t.Errorf("%T: noClobber: %v", fsys, err)
+		}
+		if data, _ := readFile(fsys, path); string(data) != "third" {
+			t.Errorf("%T: the report is %q after noClobber", fsys, data)
+		}
+		if err := cfg.saveOutput(fsys, path+".new", []byte("fourth")); err != nil {
+			t.Errorf("%T: noClobber of a new report: %v", fsys, err)
+		}
+		names, _ := fsys.Glob(filepath.Join(filepath.Dir(path), ".*"))
+		if len(names) != 0 {
+			t.Errorf("%T: temporary files %q are left", fsys, names)
+		}
+	}
+}
+
+func TestClobberPolicy(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Total\nNorth,1\n",
+		"out.pdf":  "old",
+		"cfg.json": `{"output": {"noClobber": true}}`,
+	})
+	tests := []struct {
+		job  Job
+		err  string
+		kept bool
+	}{
+		{Job{Config: "cfg.json"}, "out.pdf exists; use -force to replace it", true},
+		{Job{NoClobber: true}, "out.pdf exists; use -force to replace it", true},
+		{Job{Config: "cfg.json", Force: true, NoClobber: true}, "-force and -no-clobber exclude each other", true},
+		{Job{Config: "cfg.json", Force: true}, "", false},
+	}
+	for _, tt := range tests {
+		job := tt.job
+		job.Input, job.Output = "in.csv", "out.pdf"
+		err := generate(env, &job)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%+v: %v, want %q", tt.job, err, tt.err)
+		}
+		if kept := testFile(t, env, "out.pdf") == "old"; kept != tt.kept {
+			t.Errorf("%+v: the report was kept: %v", tt.job, kept)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ## Overflowing cells
+
+// A value that is wider than its column runs into the next cell, where
+// it overlaps the value there. Columns whose values vary in length can
+// say what to do instead:
+//
+//	"columns": [
+//	  {"name": "Comment", "width": 60, "overflow": "wrap"},
+//	  {"name": "Customer", "width": 45, "overflow": "shrink", "minFontSize": 10},
+//	  {"name": "Product", "width": 30, "overflow": "truncate"}
+//	]
+//
+//   - "wrap" breaks the value into lines, at spaces if possible, and the
+//     row grows to the height of its longest cell. The fill and the
+//     border of the row go around all of its lines.
+//   - "shrink" prints the value in a smaller font, down to the minimum
+//     size, 8 points by default. Values that do not fit even then are
+//     cut short.
+//   - "truncate" cuts the value short and ends it with "…".
+//
+// Values that fit are printed as usual. Values are cut short and shrunk
+// in badges, highlighted, and marked cells, too, but only plain cells
+// wrap; sparklines and rendered cells draw themselves as before.
+// `-dry-run` does not warn about columns with a policy.
+
+// overflows reports whether some columns have an overflow policy.
+func (c *Config) overflows() bool {
+	for _, cc := range c.Columns {
+		if cc.Overflow != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapRow returns the lines of the cells of line in wrapping columns
+// that do not fit on one line, and the height of the row with lines h
+// high.
+func wrapRow(pdf Backend, cfg *Config, line []string, h float64) (map[int][]string, float64) {
+	var wrapped map[int][]string
+	rowHeight := h
+	for _, cc := range cfg.Columns {
+		if cc.Overflow != "wrap" || cc.Index >= len(line) {
+			continue
+		}
+		room := cfg.width(cc.Index) - 2*pdf.GetCellMargin()
+		lines := wrapText(pdf, cfg.locale(), formatText(line[cc.Index], cc, cfg.locale()), cc.Direction, room)
+		if len(lines) > 1 {
+			if wrapped == nil {
+				wrapped = map[int][]string{}
+			}
+			wrapped[cc.Index] = lines
+			rowHeight = math.Max(rowHeight, float64(len(lines))*h)
+		}
+	}
+	return wrapped, rowHeight
+}
+
+// wrapText breaks text into lines no wider than room, at spaces if
+// possible, and converts them for printing.
+func wrapText(pdf Backend, loc *locale, text, dir string, room float64) []string {
+	width := func(s string) float64 {
+		return pdf.GetStringWidth(loc.printDir(s, dir))
+	}
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && width(line+" "+word) <= room {
+			line += " " + word
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// A word wider than the cell is broken anywhere.
+		for width(word) > room {
+			runes := []rune(word)
+			n := sort.Search(len(runes), func(n int) bool { return width(string(runes[:n+1])) > room })
+			n = maxInt(n, 1)
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		line = word
+	}
+	lines = append(lines, line)
+	for i := range lines {
+		lines[i] = loc.printDir(lines[i], dir)
+	}
+	return lines
+}
+
+// wrappedCell prints the lines of a wrapped cell, each lh high, centered
+// vertically in a cell w by h.
+func wrappedCell(pdf Backend, w, h, lh float64, lines []string, border, align string, fill bool) {
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+	x, y := pdf.GetXY()
+	top := y + (h-float64(len(lines))*lh)/2
+	for n, l := range lines {
+		pdf.SetXY(x-w, top+float64(n)*lh)
+		pdf.CellFormat(w, lh, l, "", 0, align, false, 0, "")
+	}
+	pdf.SetXY(x, y)
+}
+
+// rowBox starts a table row w wide and h high at the current position,
+// on a new page if the row does not fit on this one. A row of several
+// lines is one box: rowBox fills it, if fill is set, and draws the
+// sides of border around all of it. The cells of the row then draw
+// their own fills and the lines between them; see innerBorder.
+func rowBox(pdf Backend, w, h float64, border string, fill bool) {
+	// An empty cell breaks the page as the cells of the row would.
+	x := pdf.GetX()
+	pdf.CellFormat(w, h, "", "", 0, "", false, 0, "")
+	pdf.SetX(x)
+	y := pdf.GetY()
+	switch {
+	case border == "1" && fill:
+		pdf.Rect(x, y, w, h, "FD")
+		return
+	case border == "1":
+		pdf.Rect(x, y, w, h, "D")
+		return
+	case fill:
+		pdf.Rect(x, y, w, h, "F")
+	}
+	for _, side := range []struct {
+		name           string
+		x1, y1, x2, y2 float64
+	}{
+		{"L", x, y, x, y + h},
+		{"T", x, y, x + w, y},
+		{"R", x + w, y, x + w, y + h},
+		{"B", x, y + h, x + w, y + h},
+	} {
+		if strings.Contains(border, side.name) {
+			pdf.Line(side.x1, side.y1, side.x2, side.y2)
+		}
+	}
+}
+
+// innerBorder returns the border of the cells of a row after the first,
+// whose left sides are the lines between the cells. The row box draws
+// the rest of border; see rowBox.
+func innerBorder(border string) string {
+	if border == "1" || strings.ContainsAny(border, "LR") {
+		return "L"
+	}
+	return ""
+}
+
+// rowWidth returns the width of a table row of the given columns, and
+// of the rank column if ranked.
+func (c *Config) rowWidth(order []int, ranked bool) float64 {
+	w := 0.0
+	if ranked {
+		w = rankWidth
+	}
+	for _, i := range order {
+		w += c.width(i)
+	}
+	return w
+}
+
+// fitCell returns value as printed in a cell w wide of column cc, which
+// shrinks or truncates values that do not fit, and the font size to
+// print it in.
+func fitCell(pdf Backend, cc ColumnConfig, loc *locale, value string, w float64) (string, float64) {
+	size, _ := pdf.GetFontSize()
+	text := formatText(value, cc, loc)
+	room := w - 2*pdf.GetCellMargin()
+	width := pdf.GetStringWidth(loc.printDir(text, cc.Direction))
+	if width <= room {
+		return loc.printDir(text, cc.Direction), size
+	}
+
+	// Widths grow with the font size.
+	scale := 1.0
+	if cc.Overflow == "shrink" {
+		min := orDefaultFloat(cc.MinFontSize, 8)
+		fit := math.Floor(size*room/width*10) / 10
+		if fit >= min {
+			return loc.printDir(text, cc.Direction), fit
+		}
+		scale = min / size
+		size = min
+	}
+	runes := []rune(text)
+	fits := func(n int) bool {
+		s := strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace) + "…"
+		return pdf.GetStringWidth(loc.printDir(s, cc.Direction))*scale <= room
+	}
+	n := sort.Search(len(runes), func(n int) bool { return !fits(n + 1) })
+	return loc.printDir(strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace)+"…", cc.Direction), size
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// wrapCSV has a long comment in its first row, which wraps in a column
+// 30 mm wide.
+const wrapCSV = "Item,Total,Comment\n" +
+	"Apples,10,ordered twice this month because the first delivery was late\n" +
+	"Pears,20,fine\n" +
+	"Plums,30,fine\n"
+
+func TestWrappedRowHeight(t *testing.T) {
+	// The wrapping column is last, so the row ends with a line of the
+	// wrapped cell.
+	env := testEnv(map[string]string{"in.csv": wrapCSV,
+		"cfg.json": `{"columns": [{"name": "Comment", "width": 30, "overflow": "wrap"}]}`})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Snapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	var ls layoutSnapshot
+	if err := json.Unmarshal([]byte(testFile(t, env, "out.layout.json")), &ls); err != nil {
+		t.Fatal(err)
+	}
+	if len(ls.Rows) != 3 {
+		t.Fatalf("%d rows in the layout, want 3", len(ls.Rows))
+	}
+	if ls.Rows[0].Height <= 7 {
+		t.Fatalf("the first row is %v mm high; it does not wrap", ls.Rows[0].Height)
+	}
+	for r := 1; r < len(ls.Rows); r++ {
+		prev, row := ls.Rows[r-1], ls.Rows[r]
+		if want := prev.Y + prev.Height; row.Page == prev.Page && !approx(row.Y, want) {
+			t.Errorf("row %d starts at %v mm, want %v mm below row %d", r, row.Y, want, r-1)
+		}
+	}
+}
+
+// approx reports whether a and b are equal up to rounding.
+func approx(a, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
+
+func TestWrappedRowBox(t *testing.T) {
+	// Apples breaks the schema and is filled in red.
+	env := testEnv(map[string]string{"in.csv": wrapCSV, "cfg.json": `{
+		"columns": [{"name": "Comment", "width": 30, "overflow": "wrap"}],
+		"schema": {"onError": "highlight", "columns": [{"name": "Item", "pattern": "^P"}]}}`})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Snapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	var ls layoutSnapshot
+	if err := json.Unmarshal([]byte(testFile(t, env, "out.layout.json")), &ls); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+
+	// The row is one filled and bordered box, as high as all of its
+	// lines, and no cell of it has a box of its own.
+	k := 72 / 25.4
+	height := regexp.QuoteMeta(strconv.FormatFloat(-ls.Rows[0].Height*k, 'f', 2, 64))
+	boxes := regexp.MustCompile(height+` re ([BfS])`).FindAllStringSubmatch(content, -1)
+	if len(boxes) != 1 || boxes[0][1] != "B" {
+		t.Errorf("the wrapped row has the boxes %q, want one filled and bordered box", boxes)
+	}
+	if !strings.Contains(content, "1.000 0.784 0.784 rg") {
+		t.Error("the row is not filled in red")
+	}
+}
+
+// pageContents returns the content streams of a document.
+func pageContents(t *testing.T, data []byte) string {
+	t.Helper()
+	doc, err := readPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nums []int
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	var b strings.Builder
+	for _, num := range nums {
+		o := doc.objects[num]
+		if o.stream == nil || o.filter() != "FlateDecode" || reImageType.Match(o.dict) || bytes.Contains(o.dict, []byte("/Length1")) {
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(o.stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(content)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ## Report parameters
+
+// One configuration often serves many reports that differ in a few
+// words: the region in the title, the period in the file name. Cron
+// jobs pass these words from the environment or on the command line:
+//
+//	REGION=EMEA pdf -config sales.json -param period="Q3 2024" -output 'sales-{{param "period"}}.pdf' sales.csv
+//
+// with, in sales.json:
+//
+//	"messages": {"title": "Sales {{env \"REGION\"}}, {{param \"period\"}}"}
+//
+// `{{env "NAME"}}` is replaced with the environment variable NAME, which
+// is empty if it is not set, and `{{param "name"}}` with the value of
+// `-param name=value`, which may be given for several parameters. A
+// parameter that is not set is an error, so that a forgotten one does
+// not go unnoticed. Jobs of the daemon set parameters in "params".
+//
+// The placeholders work in the output path, the messages of the locale,
+// which include the title and the labels of the running text, the title
+// of PDF/A documents, the texts of the sign-off block, and the
+// narrative. The other template functions work, too, as in
+// `{{lookup (param "region") "N" "North" "S" "South"}}`.
+
+// paramFlag collects the parameters of -param.
+type paramFlag map[string]string
+
+func (pf paramFlag) String() string {
+	var pairs []string
+	for name, value := range pf {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (pf paramFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return errors.New("parameters are name=value")
+	}
+	pf[s[:i]] = s[i+1:]
+	return nil
+}
+
+// paramFuncs returns the template functions env and param.
+func paramFuncs(params map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"param": func(name string) (string, error) {
+			v, ok := params[name]
+			if !ok {
+				return "", fmt.Errorf("parameter %q is not set", name)
+			}
+			return v, nil
+		},
+	}
+}
+
+// expandParams replaces the placeholders in text.
+func expandParams(name, text string, params map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	funcs := templateFuncs()
+	for k, f := range paramFuncs(params) {
+		funcs[k] = f
+	}
+	return execTemplateFuncs(name, text, nil, funcs)
+}
+
+// applyParams replaces the placeholders in the texts of the report, and
+// makes the parameters available to the narrative.
+func (c *Config) applyParams(params map[string]string) error {
+	var err error
+	for key, text := range c.loc.messages {
+		if c.loc.messages[key], err = expandParams(key, text, params); err != nil {
+			return err
+		}
+	}
+	c.loc.params = params
+	if c.Archive != nil {
+		if c.Archive.Title, err = expandParams("title", c.Archive.Title, params); err != nil {
+			return err
+		}
+	}
+	if c.SignOff != nil {
+		if err := c.SignOff.applyParams(c, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParamFlag(t *testing.T) {
+	pf := paramFlag{}
+	for _, s := range []string{"period=Q3 2024", "region=", "expr=a=b"} {
+		if err := pf.Set(s); err != nil {
+			t.Errorf("Set(%q) = %v", s, err)
+		}
+	}
+	if want := (paramFlag{"period": "Q3 2024", "region": "", "expr": "a=b"}); !reflect.DeepEqual(pf, want) {
+		t.Errorf("parameters %v, want %v", pf, want)
+	}
+	if got := pf.String(); got != "expr=a=b period=Q3 2024 region=" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, s := range []string{"period", "=x"} {
+		if err := pf.Set(s); err == nil {
+			t.Errorf("Set(%q) accepted", s)
+		}
+	}
+}
+
+func TestExpandParams(t *testing.T) {
+	defer os.Setenv("REPORT_REGION", os.Getenv("REPORT_REGION"))
+	os.Setenv("REPORT_REGION", "EMEA")
+	params := map[string]string{"period": "Q3 2024", "unit": "N"}
+	tests := []struct {
+		text, want string
+	}{
+		{"Sales", "Sales"},
+		{`Sales {{env "REPORT_REGION"}}, {{param "period"}}`, "Sales EMEA, Q3 2024"},
+		{`[{{env "REPORT_UNSET_VARIABLE"}}]`, "[]"},
+		{`{{lookup (param "unit") "N" "North" "S" "South"}}`, "North"},
+	}
+	for _, tt := range tests {
+		got, err := expandParams("title", tt.text, params)
+		if err != nil || got != tt.want {
+			t.Errorf("expandParams(%q) = %q, %v, want %q", tt.text, got, err, tt.want)
+		}
+	}
+	if _, err := expandParams("title", `{{param "region"}}`, params); err == nil || !strings.Contains(err.Error(), `parameter "region" is not set`) {
+		t.Errorf("missing parameter: %v", err)
+	}
+}
+
+func TestReportParams(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\n",
+		"cfg.json": `{"messages": {"title": "Sales {{param \"period\"}}"}}`,
+	})
+	job := &Job{Input: "in.csv", Config: "cfg.json", Output: `sales-{{lookup (param "period") "Q3 2024" "2024q3"}}.pdf`, Params: map[string]string{"period": "Q3 2024"}}
+	if err := generate(env, job); err != nil {
+		t.Fatal(err)
+	}
+	if content := pageContents(t, []byte(testFile(t, env, "sales-2024q3.pdf"))); !strings.Contains(content, "(Sales Q3 2024)") {
+		t.Error("the title lacks the parameter")
+	}
+
+	job = &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}
+	if err := generate(env, job); err == nil || !strings.Contains(err.Error(), `parameter "period" is not set`) {
+		t.Errorf("generate without the parameter: %v", err)
+	}
+}
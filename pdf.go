@@ -61,12 +61,12 @@ After `go get`ting the package, we can start coding right away.
 package main
 
 import (
-	"encoding/csv"
-	"log"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"time"
-
-	"github.com/jung-kurt/gofpdf"
 )
 
 // ## The top-level flow
@@ -75,28 +75,614 @@ import (
 //
 // This flow is quite simple as it consists of only a few linear steps.
 func main() {
-	// First, we load the CSV data.
-	data := loadCSV(path())
+	// The `templates` subcommand helps to get started with a configuration.
+	if len(os.Args) > 1 && os.Args[1] == "templates" {
+		if err := templatesCommand(os.Stdout, os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(nil, err)
+		}
+		return
+	}
 
-	// Then we create a new PDF document and write the title and the current date.
-	pdf := newReport()
+	// The `bench` subcommand measures how fast large tables render.
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := benchCommand(os.Stdout, os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(nil, err)
+		}
+		return
+	}
 
-	// After that, we create the table header and fill the table.
-	pdf = header(pdf, data[0])
-	pdf = table(pdf, data[1:])
+	// Optional settings come from a JSON file passed via `-config`.
+	configPath := flag.String("config", "", "path to a JSON report configuration")
+	daemonPath := flag.String("daemon", "", "run the scheduled jobs from this JSON file instead of a single report")
+	invoice := flag.String("invoice", "", "render this JSON or YAML invoice instead of a report")
+	snapshot := flag.Bool("snapshot", false, "also write the computed layout as JSON next to the PDF")
+	refit := flag.Bool("refit-widths", false, "fit automatic column widths anew, ignoring the width lock file")
+	debugLayout := flag.Bool("debug-layout", false, "draw the page grid, margins, column boundaries, and section markers onto the report")
+	dryRun := flag.Bool("dry-run", false, "render the report but write and send nothing; print column widths, page count, and overflow warnings")
+	golden := flag.String("golden", "", "compare the report with the file of the same name in this directory instead of writing and sending it")
+	updateGolden := flag.Bool("update-golden", false, "with -golden, replace the golden file with the report")
+	filter := flag.String("filter", "", "only report rows that match this filter expression, such as 'Total >= 100'")
+	previous := flag.String("previous", "", "highlight the changes since this previous CSV file")
+	grayscale := flag.Bool("grayscale", false, "print all colors in gray, with shapes in place of colors that carry meaning, for mono printers")
+	engine := flag.String("engine", "auto", "PDF engine: gofpdf, direct (fast, for large plain tables), or auto to choose by table size")
+	now := flag.String("now", "", "use this date (2006-01-02) or RFC 3339 time as the current time")
+	showProgress := flag.Bool("progress", false, "show a progress bar on standard error while rendering")
+	logLevel := flag.String("log-level", "info", "least severe level to log: debug, info, warn, or error")
+	logFormat := flag.String("log-format", "text", "log format: text (key=value pairs) or json")
+	summary := flag.String("summary-json", "", "write a JSON summary of the run to this file, or - for standard output")
+	maxMemory := flag.String("max-memory", "", "stay within this much memory, such as 512MiB, by trading speed for space")
+	params := paramFlag{}
+	flag.Var(params, "param", "set a parameter for {{param \"name\"}} in texts and the output path, as name=value; may be repeated")
+	annotations := flag.String("annotations", "", "stamp the review notes of this JSON file onto the pages")
+	maxSize := flag.String("max-size", "", "keep the report below this size, such as 5MB, by compressing its images and streams harder")
+	force := flag.Bool("force", false, "replace an existing report even if the configuration says noClobber")
+	noClobber := flag.Bool("no-clobber", false, "fail instead of replacing an existing report")
+	timeout := flag.String("timeout", "", "give up on the report after this long, such as 10m")
+	output := flag.String("output", "report.pdf", "output file or cloud storage URL (s3://, gs://, az://); {date} and {time} are replaced")
+	var dialect csvDialect
+	dialect.registerFlags(flag.CommandLine)
+	var dateRange DateRange
+	dateRange.registerFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Time and files are accessed through an environment that tests can
+	// replace.
+	env := defaultEnv()
+	var err error
+	if env.Log, err = NewLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		fatal(nil, err)
+	}
+	if *showProgress {
+		env.Progress = progressBar(os.Stderr)
+	}
+	if *maxMemory != "" {
+		budget, err := parseSize(*maxMemory)
+		if err != nil {
+			fatal(env.Log, err)
+		}
+		env.setMemoryBudget(budget)
+	}
 
-	// And we should take the opportunity and beef up our report with a nice logo.
-	pdf = image(pdf)
+	// Golden files need a clock that stands still.
+	switch {
+	case *now != "":
+		t, err := parseNow(*now)
+		if err != nil {
+			fatal(env.Log, err)
+		}
+		env.Clock = FixedClock(t)
+	case *golden != "":
+		env.Clock = FixedClock(goldenTime)
+	}
 
-	if pdf.Err() {
-		log.Fatalf("Failed creating PDF report: %s\n", pdf.Error())
+	// In daemon mode, reports are generated on a schedule until the
+	// process is stopped.
+	if *daemonPath != "" {
+		if err := runDaemon(env, *daemonPath); err != nil {
+			fatal(env.Log, fmt.Errorf("daemon failed: %w", err))
+		}
+		return
+	}
+
+	// Otherwise, we generate a single report.
+	job := &Job{Input: path(), Config: *configPath, Invoice: *invoice, Output: *output, Dialect: dialect, DateRange: dateRange, Filter: *filter, Previous: *previous, Snapshot: *snapshot, RefitWidths: *refit, DebugLayout: *debugLayout, Grayscale: *grayscale, DryRun: *dryRun, Golden: *golden, UpdateGolden: *updateGolden, Engine: *engine, Summary: *summary, Annotations: *annotations, Params: params, Force: *force, NoClobber: *noClobber, Timeout: *timeout}
+	if *maxSize != "" {
+		if job.MaxSize, err = parseSize(*maxSize); err != nil {
+			fatal(env.Log, err)
+		}
+	}
+	if err := GenerateContext(context.Background(), env, job); err != nil {
+		fatal(env.Log, err)
+	}
+}
+
+// A `Job` describes one report: where the data comes from, how the
+// report looks, and where it goes.
+type Job struct {
+	Name    string     `json:"name"`
+	Input   string     `json:"input"`
+	Config  string     `json:"config"`
+	Output  string     `json:"output"`
+	Dialect csvDialect `json:"dialect"`
+
+	// Invoice, if set, replaces the report with an invoice.
+	Invoice string `json:"invoice"`
+
+	// DateRange restricts the report to rows within a range of dates.
+	DateRange
+
+	// Filter restricts the report to rows that match a filter
+	// expression; see parseFilter.
+	Filter string `json:"filter"`
+
+	// Previous is the previous input, to highlight the changes since;
+	// see DiffConfig.
+	Previous string `json:"previous"`
+
+	// Snapshot writes the layout to a JSON file next to the output.
+	Snapshot bool `json:"snapshot"`
+
+	// RefitWidths ignores locked column widths; see AutoWidthConfig.
+	RefitWidths bool `json:"refitWidths"`
+
+	// DebugLayout and DryRun help with tuning the layout; see
+	// layoutDebug and dryRun.
+	DebugLayout bool `json:"debugLayout"`
+	DryRun      bool `json:"dryRun"`
+
+	// Grayscale overrides the setting of the configuration; see
+	// grayscaleFinisher.
+	Grayscale bool `json:"grayscale"`
+
+	// Golden is a directory of known-good reports to compare the report
+	// with, in place of saving and delivering it; see checkGolden.
+	// UpdateGolden replaces them.
+	Golden       string `json:"golden"`
+	UpdateGolden bool   `json:"updateGolden"`
+
+	// Engine is "auto" (default), "gofpdf", or "direct"; see
+	// directEngine.
+	Engine string `json:"engine"`
+
+	// Summary is the path of a JSON summary of the run, or "-" for
+	// standard output; see runSummary.
+	Summary string `json:"summary"`
+
+	// MaxSize is the size limit of the report in bytes, or 0; see
+	// compressionFinisher.
+	MaxSize int64 `json:"maxSize"`
+
+	// Annotations is a JSON file of review notes to stamp onto the
+	// pages; see Annotation.
+	Annotations string `json:"annotations"`
+
+	// Params are the values of {{param "name"}} in the texts of the
+	// report and the output path; see applyParams.
+	Params map[string]string `json:"params"`
+
+	// Force and NoClobber override the NoClobber setting of the
+	// configuration; see OutputConfig.
+	Force     bool `json:"force"`
+	NoClobber bool `json:"noClobber"`
+
+	// Timeout, such as "10m", bounds the time the job may take; see
+	// GenerateContext.
+	Timeout string `json:"timeout"`
+
+	summary *runSummary
+}
+
+// The `generate()` function runs all steps of a job, one after another.
+func generate(env *Env, job *Job) (err error) {
+	if job.Summary != "" {
+		job.summary = &runSummary{}
+		env = job.summary.recording(env)
+		defer func() {
+			if sErr := job.summary.write(env, job.Summary, err); sErr != nil {
+				env.Log.Warn("cannot write the summary", "summary", job.Summary, "err", sErr)
+			}
+		}()
+	}
+
+	cfg, err := loadConfig(env.FS, job.Config)
+	if err != nil {
+		return fmt.Errorf("cannot load configuration: %w", err)
+	}
+	if (job.DryRun || job.Golden != "") && (job.Invoice != "" || cfg.Merge != nil || cfg.Labels != nil) {
+		return fmt.Errorf("dry runs and golden files support table reports only")
+	}
+	if job.Golden != "" {
+		cfg.Deterministic = true
+	}
+
+	// Texts and the output path may contain parameters.
+	if err := cfg.applyParams(job.Params); err != nil {
+		return fmt.Errorf("cannot apply parameters: %w", err)
+	}
+	if job.Output, err = expandParams("output", job.Output, job.Params); err != nil {
+		return fmt.Errorf("cannot apply parameters: %w", err)
+	}
+	if job.Grayscale {
+		cfg.Grayscale = true
+	}
+	cfg.maxSize = job.MaxSize
+	if err := cfg.clobberPolicy(job); err != nil {
+		return err
+	}
+	if job.Annotations != "" {
+		if job.Invoice != "" || cfg.Merge != nil || cfg.Labels != nil {
+			return fmt.Errorf("annotations support table reports only")
+		}
+		if cfg.annotations, err = loadAnnotations(env.FS, job.Annotations); err != nil {
+			return fmt.Errorf("cannot load annotations: %w", err)
+		}
+	}
+	if job.Invoice != "" {
+		return generateInvoice(env, cfg, job)
+	}
+
+	// Transformations may be cached across runs; see `TransformCache`.
+	if err := cfg.loadCaches(env); err != nil {
+		return err
+	}
+	defer cfg.saveCaches(env)
+
+	// First, we load the CSV data -- or query a configured data source.
+	var data [][]string
+	if cfg.Source != nil {
+		data, err = cfg.Source.load(env.context())
+	} else {
+		data, err = loadCSV(env.FS, job.Input, job.Dialect)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot load data: %w", err)
+	}
+	env.Log.Debug("data loaded", "input", job.Input, "records", len(data))
+
+	// A file is as fresh as its last modification; a query or an API
+	// call returns the data of the moment.
+	if cfg.Freshness != nil {
+		cfg.Freshness.data = env.Clock.Now()
+		if cfg.Source == nil {
+			cfg.Freshness.data = fileTime(env, job.Input)
+		}
+	}
+
+	// The first record usually holds the column names, but not always.
+	hdr, rows, err := job.Dialect.splitHeader(data)
+	if err != nil {
+		return fmt.Errorf("cannot use '%s': %w", job.Input, err)
+	}
+	read := len(rows)
+	job.summary.rows(read, read)
+
+	// The manifest traces the report back to its input; see `manifest`.
+	if cfg.Manifest != nil {
+		if cfg.manifest, err = newManifest(env, cfg, job, data, read, cfg.documentTime(env)); err != nil {
+			return fmt.Errorf("cannot checksum '%s': %w", job.Input, err)
+		}
+	}
+
+	// Columns are referenced by name, so the names must be unique.
+	hdr, cfg.renamed, err = uniqueHeader(hdr, job.Dialect.DuplicateHeaders)
+	if err != nil {
+		return fmt.Errorf("cannot use '%s': %w", job.Input, err)
+	}
+
+	// The columns may have changed upstream; see `driftCheck`.
+	if err := cfg.Schema.driftCheck(env, job.Input, hdr, rows); err != nil {
+		return withExitCode(exitInvalid, fmt.Errorf("cannot use '%s': %w", job.Input, err))
+	}
+
+	// Looked-up columns follow the input columns; see `EnrichConfig`.
+	if hdr, rows, err = cfg.enrich(env, hdr, rows); err != nil {
+		return fmt.Errorf("cannot enrich '%s': %w", job.Input, err)
+	}
+
+	// Rows are compared with the previous data before they are
+	// filtered; see `DiffConfig`.
+	if job.Previous != "" {
+		if cfg.Diff == nil {
+			cfg.Diff = &DiffConfig{}
+			if err := cfg.Diff.prepare(cfg); err != nil {
+				return fmt.Errorf("cannot compare with '%s': %w", job.Previous, err)
+			}
+		}
+		if err := cfg.Diff.load(env, job, hdr, rows); err != nil {
+			return fmt.Errorf("cannot compare with '%s': %w", job.Previous, err)
+		}
+	}
+	// Computed columns follow the input columns. In pivot mode, the
+	// configuration refers to the columns of the pivot table instead,
+	// which are known only after filtering.
+	if cfg.Pivot != nil {
+		err = cfg.Pivot.resolve(hdr)
+	} else {
+		hdr = cfg.withComputed(hdr)
+		err = cfg.resolve(hdr)
+	}
+	if err != nil {
+		return fmt.Errorf("configuration does not match '%s': %w", job.Input, err)
+	}
+
+	// The output path may contain the current date or time.
+	output := expandOutput(job.Output, env.Clock.Now())
+
+	// Only rows within the requested date range make it into the report.
+	rows, err = job.DateRange.filter(hdr, rows, env.Clock.Now())
+	if err != nil {
+		return fmt.Errorf("cannot filter '%s' by date: %w", job.Input, err)
+	}
+	if job.Filter != "" {
+		if rows, err = filterRows(cfg, hdr, rows, job.Filter); err != nil {
+			return fmt.Errorf("cannot filter '%s': %w", job.Input, err)
+		}
+	}
+
+	// If the report comes with a schema, invalid rows are sorted out now.
+	var invalid map[int]bool
+	var issues []rowIssue
+	if cfg.Schema != nil {
+		rows, invalid, issues, err = cfg.Schema.apply(hdr, rows)
+		if err != nil {
+			return withExitCode(exitInvalid, fmt.Errorf("cannot validate '%s': %w", job.Input, err))
+		}
+	}
+	job.summary.rows(read, len(rows))
+	if len(rows) == 0 && cfg.Empty.policy() == "fail" {
+		return withExitCode(exitInvalid, fmt.Errorf("no data in '%s'", job.Input))
+	}
+
+	// A pivot table replaces the rows. Its columns depend on the data,
+	// so they are sized to their contents unless configured otherwise.
+	if cfg.Pivot != nil {
+		hdr, rows = cfg.Pivot.apply(hdr, rows, invalid, cfg.locale())
+		invalid, cfg.renamed = nil, nil
+		hdr = cfg.withComputed(hdr)
+		if err := cfg.resolve(hdr); err != nil {
+			return fmt.Errorf("configuration does not match the pivot table: %w", err)
+		}
+		cfg.Pivot.layout(env, cfg, hdr, rows)
+	}
+
+	// Characters that the fonts lack would print as empty boxes.
+	if err := cfg.FontCheck.check(env, cfg, hdr, rows); err != nil {
+		return fmt.Errorf("cannot print '%s': %w", job.Input, err)
+	}
+
+	// Columns may be as wide as their contents.
+	if cfg.AutoWidth != nil {
+		if err := cfg.AutoWidth.fit(env, cfg, hdr, rows, job.RefitWidths, job.DryRun); err != nil {
+			return fmt.Errorf("cannot fit column widths: %w", err)
+		}
+	}
+
+	// In merge mode, every row becomes a document of its own; in label
+	// mode, a label on a sheet.
+	if cfg.Merge != nil {
+		return cfg.Merge.run(env, cfg, hdr, cfg.computeRows(hdr, rows), output)
+	}
+	if cfg.Labels != nil {
+		return cfg.Labels.run(env, cfg, hdr, cfg.computeRows(hdr, rows), output)
+	}
+
+	// Then we render the report -- or, in split mode, one report per
+	// value of the split column, or one per recipient.
+	var parts []*part
+	var workers int
+	switch {
+	case cfg.Split != nil:
+		parts, err = cfg.Split.parts(rows, invalid, issues, output)
+		workers = cfg.Split.workers()
+	case cfg.Recipients != nil:
+		parts, err = cfg.Recipients.parts(env, cfg, hdr, rows, invalid, issues, output)
+		workers = cfg.Recipients.workers()
+	default:
+		p := &part{output: output, rows: rows, invalid: invalid, issues: issues}
+		job.summary.add(p)
+		return writeReport(env, cfg, job, hdr, p)
+	}
+	if err != nil {
+		return err
+	}
+	job.summary.add(parts...)
+	err = forEachPart(parts, env.partWorkers(parts, len(hdr), workers), func(p *part) error {
+		return writeReport(env, cfg, job, hdr, p)
+	})
+	if job.DryRun || job.Golden != "" {
+		return err
+	}
+	return cfg.Delivery.sendDigest(env, parts, err)
+}
+
+// The `writeReport()` function renders, saves, and delivers one report.
+func writeReport(env *Env, cfg *Config, job *Job, hdr []string, p *part) error {
+	if err := env.canceled(); err != nil {
+		return err
+	}
+	// A report without rows may be skipped; see `EmptyConfig`.
+	if len(p.rows) == 0 {
+		switch cfg.Empty.policy() {
+		case "skip":
+			env.Log.Info("no data, report skipped", "output", p.output)
+			return nil
+		case "fail":
+			return withExitCode(exitInvalid, fmt.Errorf("no data for %s", p.output))
+		}
+	}
+	body := &reportData{hdr: hdr, rows: p.rows, invalid: p.invalid, issues: p.issues, debug: job.DebugLayout, name: p.output}
+	if cfg.Attach != nil {
+		body.attach = cfg.Attach.fileName(job, p)
+	}
+	if g := cfg.Group; g != nil && g.Sort {
+		body.rows, body.invalid = g.sort(cfg, hdr, body.rows, body.invalid)
+	}
+	if job.Snapshot || job.DryRun {
+		body.layout = &layoutSnapshot{}
+	}
+	if cfg.Footnotes != nil {
+		body.rows, body.cellNotes = stripCellNotes(body.rows)
 	}
 
-	// And finally, we write out our finished record to a file.
-	err := savePDF(pdf)
+	// Computed columns are evaluated for the rows of this report only,
+	// so running totals restart in every part of a split.
+	body.rows = cfg.computeRows(hdr, body.rows)
+
+	// Large plain tables skip the layout engine. The page for empty
+	// reports needs it.
+	direct, err := job.directEngine(env, cfg, body)
 	if err != nil {
-		log.Fatalf("Cannot save PDF: %s|n", err)
+		return err
+	}
+	direct = direct && len(body.rows) > 0
+	if !env.fits(len(body.rows), len(body.hdr), direct) {
+		env.Log.Warn("report may exceed the memory budget", "output", p.output, "rows", len(body.rows))
+	}
+	if direct {
+		return writeDirect(env, cfg, body, p)
+	}
+	pdf, err := render(env, cfg, body)
+	if err != nil {
+		return withExitCode(exitRender, fmt.Errorf("failed creating PDF report: %w", err))
+	}
+	if job.DryRun {
+		return dryRun(env, cfg, body, p)
+	}
+	p.tags, p.fields = body.tags, body.fields
+	if cfg.Attach != nil {
+		if err := cfg.Attach.attach(env, job, pdf, hdr, body.rows, p); err != nil {
+			return err
+		}
+	}
+	if job.Golden != "" {
+		return checkGolden(env, cfg, job, pdf, p)
+	}
+
+	// And finally, we write out our finished record to a file and, if
+	// configured, send it to its readers.
+	if err := publish(env, cfg, pdf, p); err != nil {
+		return err
+	}
+	p.pages = pdf.PageCount()
+	if cfg.TextVersion != nil {
+		if err := cfg.TextVersion.write(env, cfg, body, p); err != nil {
+			return err
+		}
+	}
+	if p.unchanged {
+		env.Log.Info("report unchanged, not delivered", "output", p.output)
+	} else {
+		env.Log.Info("report written", "output", p.output, "rows", len(body.rows), "pages", pdf.PageCount())
+	}
+	if body.layout != nil {
+		if err := saveSnapshot(body.layout, env.FS, cfg.artifactKey, snapshotPath(p.output)); err != nil {
+			return fmt.Errorf("cannot save layout snapshot: %w", err)
+		}
 	}
+	return nil
+}
+
+// reportData is everything we know about the data when rendering starts.
+type reportData struct {
+	hdr     []string
+	rows    [][]string
+	invalid map[int]bool    // rows that failed validation
+	issues  []rowIssue      // problems to list in the appendix
+	layout  *layoutSnapshot // filled during rendering, if not nil
+	debug   bool            // draw the layout debug overlay
+	name    string          // the output file, for progress reports
+	attach  string          // the file name of the attached data, if any
+	tags    *tagger         // set during rendering of a tagged report
+	fields  []formWidget    // set during rendering of a form block
+
+	cellNotes map[cellPos][]string // footnotes of table cells
+}
+
+// The `render()` function runs the steps that fill the document. Should
+// any of them panic, the panic becomes an error; see `RenderError`.
+func render(env *Env, cfg *Config, data *reportData) (pdf *Fpdf, err error) {
+	prog := progress{ctx: env.context(), layout: data.layout, report: env.Progress, event: ProgressEvent{Report: data.name, TotalRows: len(data.rows)}}
+	defer prog.recoverRender(&err)
+
+	// We create a new PDF document and write the title and the current date.
+	prog.enter("title")
+	prog.tags = newTagger(cfg)
+	pdf = newReport(env, cfg, prog.tags)
+	if prog.tags != nil {
+		prog.installPageFuncs(pdf)
+	}
+	if data.debug {
+		prog.debug = newLayoutDebug(pdf)
+		prog.onPageStart(pdf, prog.debug.record)
+	}
+	if cfg.Footnotes != nil {
+		prog.notes = newFootnotes(pdf, cfg.Footnotes, cfg.locale(), data.cellNotes, &prog)
+	}
+	prog.setHooks(pdf, env.Hooks, data.name, data.hdr)
+
+	// A few words about the numbers may follow.
+	prog.enter("narrative")
+	pdf = narrative(pdf, cfg.Narrative, narrativeData{Date: env.Clock.Now(), Rows: len(data.rows), hdr: data.hdr, rows: data.rows}, cfg.locale(), prog.notes)
+
+	// Without rows, a message takes the place of the dashboard and the
+	// table.
+	if len(data.rows) == 0 {
+		prog.enter("no data")
+		pdf = noData(pdf, cfg)
+	} else {
+		// The rest of the title page may show a dashboard.
+		prog.enter("dashboard")
+		pdf = dashboard(pdf, cfg, data.rows)
+
+		// After that, we create the table header and fill the table. The
+		// table starts on a new page if it has another orientation than
+		// the title.
+		prog.enter("header")
+		startSection(pdf, cfg.Orientation.of("table"))
+		if data.layout != nil {
+			data.layout.columns(data.hdr, cfg)
+			data.layout.page(pdf)
+		}
+		pdf = bandedTable(pdf, data, cfg, &prog)
+	}
+
+	// A table cut short by the limits is followed by a notice.
+	prog.enter("truncation")
+	pdf = truncationNotice(pdf, cfg, prog.truncated, data.attach)
+
+	// Callouts point out what the numbers mean.
+	prog.enter("callouts")
+	pdf = callouts(pdf, cfg, data.rows)
+
+	// Endnotes follow the table.
+	prog.enter("notes")
+	prog.notes.printEnd(pdf)
+
+	// The reader may fill in a form before filing the report.
+	prog.enter("form")
+	pdf, data.fields = formBlock(pdf, cfg)
+
+	// The people who checked the report sign it.
+	prog.enter("sign-off")
+	var signOffFields []formWidget
+	pdf, signOffFields = signOffBlock(pdf, cfg)
+	data.fields = append(data.fields, signOffFields...)
+
+	// And we should take the opportunity and beef up our report with a nice logo.
+	prog.enter("image")
+	pdf = image(pdf, env, cfg.Freshness, cfg.Grayscale, cfg.Stationery.top())
+
+	// Rows that failed validation may get a page of their own.
+	prog.enter("appendix")
+	pdf = errorAppendix(pdf, data.issues, cfg)
+
+	// The changes since the previous data are summed up.
+	prog.enter("changes")
+	pdf = diffSummary(pdf, cfg, data.hdr, data.rows)
+
+	// Auditors may want all of the data, unformatted.
+	prog.enter("raw data")
+	pdf = rawDataAppendix(pdf, cfg, data.hdr, data.rows)
+
+	// Review notes from automated checks go on top of it all.
+	prog.enter("manifest")
+	pdf = printManifest(pdf, cfg)
+
+	prog.enter("annotations")
+	pdf = stampAnnotations(pdf, cfg)
+	prog.tags.enter("")
+	data.tags = prog.tags
+	prog.finishHook(pdf)
+	prog.debug.overlay(cfg, data.hdr)
+
+	if pdf.Err() {
+		return nil, pdf.Error()
+	}
+	if data.layout != nil {
+		data.layout.finish(pdf)
+	}
+	prog.done(pdf)
+	return pdf, nil
 }
 
 /*
@@ -113,40 +699,45 @@ if pdf.Err() {
 
 ```
 
-We make use of this error mechanism in `main()`, after all PDF processing is done.
+We make use of this error mechanism in `render()`, after all PDF processing is done.
 */
 
 // ## Loading the CSV data
 
-// Loading a CSV file is no problem for us, we had this last time when dealing with CSV data. We can reuse the `loadCSV()` function unchanged.
-func loadCSV(path string) [][]string {
-	f, err := os.Open(path)
+// Loading a CSV file is no problem for us, we had this last time when dealing with CSV data. We can reuse the `loadCSV()` function almost unchanged. Only the CSV reader now comes from a `csvDialect` that knows about delimiters, quotes, and encodings other than plain comma-separated UTF-8.
+func loadCSV(fsys FileSystem, path string, dialect csvDialect) ([][]string, error) {
+	f, err := fsys.Open(path)
 	if err != nil {
-		log.Fatalf("Cannot open '%s': %s\n", path, err.Error())
+		return nil, fmt.Errorf("cannot open '%s': %w", path, err)
 	}
 	defer f.Close()
-	r := csv.NewReader(f)
+	r, err := dialect.reader(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CSV data: %w", err)
+	}
 	rows, err := r.ReadAll()
 	if err != nil {
-		log.Fatalln("Cannot read CSV data:", err.Error())
+		return nil, fmt.Errorf("cannot read CSV data: %w", err)
 	}
-	return rows
+	dialect.swapQuotes(rows)
+	return rows, nil
 }
 
-// We use a small helper function named `path()` to fetch the path from `os.Args`.
+// We use a small helper function named `path()` to fetch the path from the command line arguments that remain after flag parsing.
 //
-// If no path is passed via the command line, the slice `os.Args` contains only one entry -- the name of the executable. In this case, `path()` shall return a suitable default value.
+// If no path is passed via the command line, `flag.NArg()` is zero. In this case, `path()` shall return a suitable default value.
 func path() string {
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		return "ordersReport.csv"
 	}
-	return os.Args[1]
+	return flag.Arg(0)
 }
 
 // ## The Initial PDF document
 
-// Next, we create a new PDF document.
-func newReport() *gofpdf.Fpdf {
+// Next, we create a new PDF document. A tagged report tells the tagger
+// what the title and the date are; see `TaggedConfig`.
+func newReport(env *Env, cfg *Config, tags *tagger) *Fpdf {
 	// The package provides a function named `New()` to create a PDF document with
 	//
 	// * landscape ("L") or portrait ("P") orientation,
@@ -157,11 +748,19 @@ func newReport() *gofpdf.Fpdf {
 	// All of these can remain empty, in which case `New()` provides suitable defaults.
 	//
 	// Function `New()` returns an object of type `*gofpdf.Fpdf` that
-	// provides a number of methods for filling the document.
-	pdf := gofpdf.New("L", "mm", "Letter", "")
+	// provides a number of methods for filling the document. We call it
+	// as `newPDF()`, and the type `Fpdf`, so that a fork of gofpdf can
+	// take its place; see the section on backends. The orientation is
+	// that of the title page, landscape unless configured otherwise; see
+	// `OrientationConfig`.
+	pdf := newPDF(cfg.Orientation.of("title"), "mm", "Letter", "")
+
+	// Document-wide settings must be made before anything is written.
+	setupDocument(pdf, env, cfg)
 
 	// We start by adding a new page to the document.
 	pdf.AddPage()
+	tags.start(pdf)
 
 	// Now we set the font to "Times", the style to "bold", and the size to 28 points.
 	pdf.SetFont("Times", "B", 28)
@@ -170,15 +769,30 @@ func newReport() *gofpdf.Fpdf {
 	// starting coordinates used here; instead, the `Cell()` method moves
 	// the current position to the end of the cell so that the next call
 	// to `Cell()` continues after the previous cell.
-	pdf.Cell(40, 10, "Daily Report")
+	//
+	// The title and the date are printed in the language of the report.
+	loc := cfg.locale()
+	tags.block("H1")
+	pdf.Cell(40, 10, loc.text("title"))
 
 	// The `Ln()` function moves the current position to a new line, with
 	// an optional line height parameter.
 	pdf.Ln(12)
 
 	pdf.SetFont("Times", "", 20)
-	pdf.Cell(40, 10, time.Now().Format("Mon Jan 2, 2006"))
-	pdf.Ln(20)
+	tags.block("P")
+	pdf.Cell(40, 10, loc.print(loc.date(env.Clock.Now(), loc.longDate)))
+
+	// The data may be older than the report.
+	if f := cfg.Freshness; f != nil {
+		pdf.Ln(10)
+		tags.block("P")
+		f.stamp(pdf, 0, "L", f.data)
+		pdf.Ln(5)
+	} else {
+		pdf.Ln(20)
+	}
+	tags.end()
 
 	return pdf
 }
@@ -196,63 +810,379 @@ HYPE[pdf](pdf.html)
 
 // Having created the initial document, we can now create the table header.
 // This time, we generate a formatted cell with a light grey as the
-// background color.
-func header(pdf *gofpdf.Fpdf, hdr []string) *gofpdf.Fpdf {
+// background color. The table code takes the document as a `Backend`,
+// the methods that it draws with; see `## Backends`.
+func header(pdf Backend, hdr []string, cfg *Config, prog *progress) {
 	pdf.SetFont("Times", "B", 16)
 	pdf.SetFillColor(240, 240, 240)
-	for _, str := range hdr {
+
+	// The borders may be styled; see `CellStyleConfig`.
+	border, restore := cfg.CellStyle.begin(pdf, "header")
+	defer restore()
+
+	// Long names of narrow columns may be rotated, which makes the row
+	// higher; see `RotateHeaderConfig`.
+	h := cfg.RotateHeader.height(pdf, cfg, hdr, 7)
+
+	// Header notes need room at the bottom of the page, below the group
+	// labels, if any.
+	if prog.notes != nil {
+		var notes []string
+		for i := range hdr {
+			if n := cfg.column(i).Footnote; n != "" {
+				notes = append(notes, n)
+			}
+		}
+		rows := h
+		if len(cfg.HeaderGroups) > 0 {
+			rows += 7
+		}
+		prog.notes.reserve(pdf, notes, rows)
+	}
+
+	// Groups of columns may have a label above them.
+	headerGroupRow(pdf, cfg, hdr, 7, border)
+
+	// In a tagged report, the header row starts a table of the
+	// structure tree; see `TaggedConfig`.
+	prog.tags.table()
+
+	// The rank column is the first one: on the left, or on the right in
+	// right-to-left documents.
+	rank := func() {
+		if cfg.Rank != nil {
+			prog.tags.cell("TH")
+			title := cfg.locale().print(cfg.Rank.title(cfg.locale()))
+			pdf.CellFormat(rankWidth, h, title, border, 0, cfg.mirrored(ColumnConfig{}, ""), true, 0, "")
+		}
+	}
+	if !cfg.rtl() {
+		rank()
+	}
+	for _, i := range cfg.columnOrder(len(hdr)) {
 		// The `CellFormat()` method takes a couple of parameters to format
 		// the cell. We make use of this to create a visible border around
 		// the cell, and to enable the background fill.
-		pdf.CellFormat(40, 7, str, "1", 0, "", true, 0, "")
+		cc := cfg.column(i)
+		str := cfg.locale().printDir(hdr[i], cc.Direction)
+		a := cfg.mirrored(cc, "")
+		prog.tags.cell("TH")
+		if n := cc.Footnote; n != "" && prog.notes != nil {
+			markedCell(pdf, cfg.width(i), h, str, prog.notes.add([]string{n}), border, a, true)
+		} else if cfg.RotateHeader.rotated(pdf, cfg, hdr, i) {
+			cfg.RotateHeader.cell(pdf, cfg.width(i), h, str, border, true)
+		} else {
+			cfg.fallback.cell(pdf, "B", cfg.width(i), h, str, border, 0, a, true)
+		}
 	}
+	if cfg.rtl() {
+		rank()
+	}
+	prog.tags.end()
 
 	// Passing `-1` to `Ln()` uses the height of the last printed cell as
 	// the line height.
 	pdf.Ln(-1)
-	return pdf
 }
 
 // ## The Table Body
 
 // In the same fashion, we can create the table body.
 
-func table(pdf *gofpdf.Fpdf, tbl [][]string) *gofpdf.Fpdf {
+func table(pdf Backend, tbl [][]string, cfg *Config, invalid map[int]bool, prog *progress) {
 	// Reset font and fill color.
 	pdf.SetFont("Times", "", 16)
 	pdf.SetFillColor(255, 255, 255)
+	bodySize, _ := pdf.GetFontSize()
 
-	// Every column gets aligned according to its contents.
+	// Every column gets aligned according to its contents, unless the
+	// configuration says otherwise.
 	align := []string{"L", "C", "L", "R", "R", "R"}
-	for _, line := range tbl {
-		for i, str := range line {
+
+	border, restore := cfg.CellStyle.begin(pdf, "body")
+	defer restore()
+
+	// Some columns want their smallest and largest values to stand out.
+	ext := findExtremes(tbl, cfg)
+
+	// Heat map columns color their cells by value.
+	heat := findHeatRanges(tbl, cfg)
+
+	// Leaderboards get a rank column in front of the data.
+	var ranks []string
+	if cfg.Rank != nil {
+		var err error
+		ranks, err = computeRanks(tbl, cfg.Rank)
+		if err != nil {
+			pdf.SetError(err)
+			return
+		}
+	}
+	// Table cells do not wrap, unless their column says so: every row is
+	// a single line, 7 mm high, or as many lines as its longest cell; see
+	// `wrapRow`. The row is one box of that height, filled and bordered
+	// as a whole, and its cells draw only their own fills and the lines
+	// between them; see `rowBox`.
+	start, size := 0, 0 // first row and size of the current group
+	if g := cfg.Group; g != nil && len(tbl) > 0 {
+		size = g.groupSize(tbl, 0)
+	}
+	// Plain cells take a shortcut; see `cellWriter`.
+	cells := newCellWriter(pdf, cfg)
+	for r, line := range tbl {
+		wrapped, h := wrapRow(pdf, cfg, line, 7)
+		if prog.truncated = cfg.Limits.stop(pdf, r, len(tbl), h); prog.truncated != nil {
+			break
+		}
+		if err := prog.canceled(); err != nil {
+			pdf.SetError(err)
+			break
+		}
+		prog.row = r
+		if g := cfg.Group; g != nil {
+			g.keepTogether(pdf, start, size, r, 7)
+		}
+		prog.notes.reserve(pdf, prog.notes.rowNotes(r, len(line)), h)
+		prog.tags.tableRow()
+		cells.row()
+
+		// Rows that failed schema validation are filled in red, new rows
+		// in green, and changed values in yellow; see `DiffConfig`.
+		fill := invalid[r]
+		if fill {
+			pdf.SetFillColor(255, 200, 200)
+		}
+		added, changed := cfg.Diff.compare(line)
+		if added && !fill {
+			fill = true
+			pdf.SetFillColor(220, 245, 220)
+		}
+		order := cfg.columnOrder(len(line))
+		rowBox(pdf, cfg.rowWidth(order, ranks != nil), h, border, fill)
+		sep := "" // the border of the next cell
+		rank := func() {
+			if ranks != nil {
+				prog.tags.cell("TD")
+				pdf.CellFormat(rankWidth, h, ranks[r], sep, 0, "R", false, 0, "")
+				sep = innerBorder(border)
+			}
+		}
+		if !cfg.rtl() {
+			rank()
+		}
+		for _, i := range order {
 			// Again, we need the `CellFormat()` method to create a visible
 			// border around the cell. We also use the `alignStr` parameter
 			// here to print the cell content either left-aligned or
 			// right-aligned.
-			pdf.CellFormat(40, 7, str, "1", 0, align[i], false, 0, "")
+			//
+			// Numeric columns may request a special number format.
+			// In right-to-left documents, the alignment defaults are
+			// mirrored.
+			cc := cfg.column(i)
+			str := formatCell(line[i], cc, cfg.locale())
+			def := ""
+			if i < len(align) {
+				def = align[i]
+			}
+			a := cfg.align(cc, def)
+			w := cfg.width(i)
+			// The totals of a pivot table stand out from its values.
+			style, cellFill := "", fill
+			if cfg.Pivot.isTotal(r, i, len(tbl)) {
+				style = "B"
+				pdf.SetFontStyle(style)
+				if !fill {
+					pdf.SetFillColor(240, 240, 240)
+					cellFill = true
+				}
+			}
+			if changed[i] && !cellFill {
+				pdf.SetFillColor(255, 240, 170)
+				cellFill = true
+			}
+			// Heat map cells are filled by value, unless the row is
+			// already marked as invalid.
+			if e, ok := heat[i]; ok && !cellFill {
+				if v, ok := cellNumber(line, i); ok {
+					bg := cc.HeatMap.color(v, e)
+					if cfg.Grayscale {
+						bg = grayHeat(e.position(v))
+					}
+					fg := contrastColor(bg)
+					pdf.SetFillColor(bg[0], bg[1], bg[2])
+					pdf.SetTextColor(fg[0], fg[1], fg[2])
+					cellFill = true
+				}
+			}
+			// Values too wide for the column may be shrunk or cut short;
+			// see `fitCell`.
+			fontSize := bodySize
+			if cc.Overflow == "shrink" || cc.Overflow == "truncate" {
+				str, fontSize = fitCell(pdf, cc, cfg.locale(), line[i], w)
+				if fontSize != bodySize {
+					pdf.SetFontSize(fontSize)
+				}
+			}
+			prog.tags.cell("TD")
+			link := cfg.Link.applies(line, i)
+			if link {
+				pdf.SetTextColor(0, 0, 238)
+				if cfg.Grayscale {
+					style += "U"
+					pdf.SetFontStyle(style)
+				}
+			}
+			// The row box has the fill of the row already.
+			own := cellFill && !fill
+			if cc.Renderer != nil {
+				renderedCell(pdf, cc.Renderer, w, h, line[i], sep, own, CellContext{Row: r, Column: i, Line: line, Text: str, Align: a})
+			} else if cc.Sparkline != nil {
+				sparklineCell(pdf, cc.Sparkline, w, h, cc.Sparkline.values(line, i), sep, own)
+			} else if mark := prog.notes.cellMark(r, i); mark != "" {
+				markedCell(pdf, w, h, str, mark, sep, a, own)
+			} else if b, ok := cc.Badges[line[i]]; ok {
+				badgeCell(pdf, b, w, h, str, sep, a, own)
+			} else if isExtreme(ext, line, i) {
+				highlightCell(pdf, cc.Highlight, w, h, str, sep, a, own)
+			} else if lines, ok := wrapped[i]; ok {
+				wrappedCell(pdf, w, h, 7, lines, sep, a, own)
+			} else if !cells.cell(style, w, h, str, sep, a, own) {
+				cfg.fallback.cell(pdf, style, w, h, str, sep, 0, a, own)
+			}
+			sep = innerBorder(border)
+			if changed[i] && cfg.Grayscale {
+				changedMark(pdf)
+			}
+			if cellFill != fill {
+				pdf.SetFillColor(255, 255, 255)
+				pdf.SetTextColor(0, 0, 0)
+			}
+			if style != "" {
+				pdf.SetFontStyle("")
+			}
+			if fontSize != bodySize {
+				pdf.SetFontSize(bodySize)
+			}
+
+			// A link leads to the row in the source system.
+			if link {
+				pdf.SetTextColor(0, 0, 0)
+				linkCell(pdf, w, h, cfg.Link.url(line))
+			}
+		}
+		if cfg.rtl() {
+			rank()
+		}
+		prog.tags.end()
+		if fill {
+			pdf.SetFillColor(255, 255, 255)
+		}
+		// In grayscale, the fills of invalid and new rows look alike.
+		if cfg.Grayscale && invalid[r] {
+			rowMark(pdf, cfg, "!", h)
+		} else if cfg.Grayscale && added {
+			rowMark(pdf, cfg, "+", h)
+		}
+		prog.endRow(pdf, line, h)
+		pdf.Ln(h)
+
+		// Groups end with a subtotal row -- preferably at the bottom of a page.
+		if g := cfg.Group; g != nil && g.groupEnds(tbl, r) {
+			g.subtotalRow(pdf, cfg, tbl[start:r+1], len(line), 7)
+			start = r + 1
+			if start < len(tbl) {
+				size = g.groupSize(tbl, start)
+				if g.BreakTolerance >= 0 {
+					g.softBreak(pdf, size, 7)
+				}
+			}
 		}
-		pdf.Ln(-1)
 	}
-	return pdf
 }
 
 // ## The Image
 
 // Next, let's not forget to impress our boss by adding a fancy image.
-func image(pdf *gofpdf.Fpdf) *gofpdf.Fpdf {
-	// The `ImageOptions` method takes a file path, x, y, width, and height
+func image(pdf *Fpdf, env *Env, fresh *FreshnessConfig, gray bool, top float64) *Fpdf {
+	// We read the image ourselves and register it under its file name,
+	// so that it can come from any `FileSystem`. For mono printers, it
+	// is converted to gray; see `grayPNG`. Documents of the same run
+	// share the file and its conversion; see `ResourceCache`.
+	opts := ImageOptions{ImageType: "PNG", ReadDpi: true}
+	data, err := env.Resources.file(env.FS, "stats.png")
+	if err != nil {
+		pdf.SetError(err)
+		return pdf
+	}
+	if gray {
+		v, err := env.Resources.derive(env.FS, "stats.png", "gray", func(data []byte) (interface{}, error) {
+			return grayPNG(bytes.NewReader(data))
+		})
+		if err != nil {
+			pdf.SetError(fmt.Errorf("stats.png: %w", err))
+			return pdf
+		}
+		data = v.([]byte)
+	}
+	pdf.RegisterImageOptionsReader("stats.png", opts, bytes.NewReader(data))
+
+	// The `ImageOptions` method takes an image name, x, y, width, and height
 	// parameters, and an `ImageOptions` struct to specify a couple of options.
-	pdf.ImageOptions("stats.png", 225, 10, 25, 25, false, gofpdf.ImageOptions{ImageType: "PNG", ReadDpi: true}, 0, "")
+	// The image goes to the top right corner, which depends on the
+	// orientation of the page and, with stationery, on the top margin.
+	w, _ := pdf.GetPageSize()
+	pdf.ImageOptions("stats.png", w-54.4, top, 25, 25, false, opts, 0, "")
+
+	// The chart may be older than the table.
+	if fresh != nil {
+		x, y := pdf.GetXY()
+		pdf.SetXY(w-64.4, top+26)
+		fresh.stamp(pdf, 45, "C", fileTime(env, "stats.png"))
+		pdf.SetXY(x, y)
+	}
 	return pdf
 }
 
 // ## Saving The Document
 //
-// Finally, the convenience method `OutputFileAndClose()` lets us save the
-// finished document.
-func savePDF(pdf *gofpdf.Fpdf) error {
-	return pdf.OutputFileAndClose("report.pdf")
+// Finally, the `Output()` method lets us save the finished document. It
+// writes to any `io.Writer`; we use a buffer, so that the same bytes can
+// go to a file, to cloud storage, and to email recipients. Before that,
+// the bytes can pass through a few finishing steps.
+func savePDF(pdf *Fpdf, cfg *Config, fsys FileSystem, path string, finish ...func([]byte) ([]byte, error)) ([]byte, error) {
+	data, err := finishPDF(pdf, finish...)
+	if err != nil {
+		return nil, err
+	}
+	return data, cfg.saveOutput(fsys, path, data)
+}
+
+// finishPDF returns the bytes of the finished document.
+func finishPDF(pdf *Fpdf, finish ...func([]byte) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return finishBytes(buf.Bytes(), finish...)
+}
+
+// finishBytes passes the bytes of a document through the finishing
+// steps. The steps parse the document and the files it draws on, and a
+// malformed file that makes one of them panic fails the document, not
+// the program.
+func finishBytes(data []byte, finish ...func([]byte) ([]byte, error)) (out []byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			out, err = nil, fmt.Errorf("cannot finish the document: %v", v)
+		}
+	}()
+	for _, f := range finish {
+		if data, err = f(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
 }
 
 /*
@@ -267,9 +1197,10 @@ Step 2: `cd` to the source code directory.
 
     cd $GOPATH/src/github.com/appliedgo/pdf
 
-Step 3. Run the binary.
+Step 3. Run the binary. The program spans all the files of the
+directory, so run the package rather than pdf.go alone.
 
-	go run pdf.go
+	go run .
 
 Then you should find a file named "report.pdf" in the same directory. The document should look like this:
 
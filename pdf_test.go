@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// testTime is the time of the fixed clock of testEnv.
+var testTime = time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+
+// testEnv returns an environment with a fixed clock that serves the
+// given files from memory, along with the image that every report
+// shows.
+func testEnv(files map[string]string) *Env {
+	data := map[string][]byte{"stats.png": benchPNG()}
+	for name, s := range files {
+		data[name] = []byte(s)
+	}
+	return &Env{Clock: FixedClock(testTime), FS: NewMemFS(data), Stdout: ioutil.Discard}
+}
+
+// testFile returns the contents of a file of env.
+func testFile(t *testing.T, env *Env, name string) string {
+	t.Helper()
+	f, err := env.FS.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
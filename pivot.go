@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Pivot tables
+
+// A flat list of sales is hard to compare across months and regions. In
+// pivot mode, the rows are reshaped into a cross-tab: one row per value
+// of the row key, one column per value of the column key, and in each
+// cell the aggregate of the value column over the matching rows.
+//
+// Dates make good keys when grouped, say, by month. A key with a date
+// format is grouped by the formatted date and sorted chronologically;
+// other keys are sorted numerically, if they are numbers, or
+// alphabetically.
+//
+// Like a spreadsheet pivot table, the cross-tab may have margins: a
+// column with the total of each row, a row with the total of each
+// column, and the grand total where both meet. Margins are printed in
+// bold on a gray background, like subtotals.
+//
+// The rest of the configuration -- column settings, computed columns,
+// ranks, and so on -- refers to the columns of the pivot table: the row
+// key, the column key values, and "Total".
+
+// PivotConfig enables pivot mode.
+type PivotConfig struct {
+	Rows    ColumnRef `json:"rows"`
+	Columns ColumnRef `json:"columns"`
+	Values  ColumnRef `json:"values"`
+
+	// Aggregate is "sum" (default), "count", "avg", "min", or "max".
+	Aggregate string `json:"aggregate"`
+
+	// Decimals is the number of decimal places. Default: 2, or 0 for
+	// "count".
+	Decimals *int `json:"decimals"`
+
+	// RowFormat and ColumnFormat group date keys.
+	RowFormat    *DateFormat `json:"rowFormat"`
+	ColumnFormat *DateFormat `json:"columnFormat"`
+
+	// RowTotals adds a column with the total of each row, ColumnTotals
+	// a row with the total of each column. Totals adds both.
+	Totals       bool `json:"totals"`
+	RowTotals    bool `json:"rowTotals"`
+	ColumnTotals bool `json:"columnTotals"`
+
+	// GrandTotal prints the total of all values where the total row and
+	// the total column meet. Default: true.
+	GrandTotal *bool `json:"grandTotal"`
+
+	totalCol int  // index of the total column, or -1
+	totalRow bool // the last row is the total row
+}
+
+// prepare checks the settings.
+func (pc *PivotConfig) prepare() error {
+	switch pc.Aggregate {
+	case "", "sum", "count", "avg", "min", "max":
+	default:
+		return fmt.Errorf("unknown aggregate %q", pc.Aggregate)
+	}
+	for _, df := range []*DateFormat{pc.RowFormat, pc.ColumnFormat} {
+		if df != nil {
+			if err := df.prepare(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve resolves the column references against the input header.
+func (pc *PivotConfig) resolve(hdr []string) error {
+	for _, ref := range []*ColumnRef{&pc.Rows, &pc.Columns, &pc.Values} {
+		if err := ref.resolve(hdr); err != nil {
+			return fmt.Errorf("pivot: %s", err)
+		}
+	}
+	return nil
+}
+
+// aggregator accumulates the values of one cell. Sums are exact.
+type aggregator struct {
+	n        int
+	sum      decimalSum
+	min, max float64
+}
+
+func (a *aggregator) add(v float64) {
+	if a.n == 0 || v < a.min {
+		a.min = v
+	}
+	if a.n == 0 || v > a.max {
+		a.max = v
+	}
+	a.n++
+	a.sum.addFloat(v)
+}
+
+func (a *aggregator) result(kind string) *big.Rat {
+	switch kind {
+	case "count":
+		return new(big.Rat).SetInt64(int64(a.n))
+	case "avg":
+		return a.sum.mean()
+	case "min":
+		return ratFromFloat(a.min)
+	case "max":
+		return ratFromFloat(a.max)
+	}
+	return &a.sum.sum
+}
+
+// pivotKeys collects the distinct keys of a column in sort order.
+type pivotKeys struct {
+	df    *DateFormat
+	index map[string]int
+	keys  []string
+	first map[string]time.Time // earliest date per key, for sorting
+}
+
+func newPivotKeys(df *DateFormat) *pivotKeys {
+	return &pivotKeys{df: df, index: map[string]int{}, first: map[string]time.Time{}}
+}
+
+// add returns the key of str.
+func (pk *pivotKeys) add(str string) string {
+	key := strings.TrimSpace(str)
+	if pk.df != nil {
+		if t, ok := pk.df.parse(key); ok {
+			key = pk.df.format(key)
+			if f, seen := pk.first[key]; !seen || t.Before(f) {
+				pk.first[key] = t
+			}
+		}
+	}
+	if _, ok := pk.index[key]; !ok {
+		pk.index[key] = len(pk.keys)
+		pk.keys = append(pk.keys, key)
+	}
+	return key
+}
+
+// sorted returns the keys in order, text in the order of loc.
+func (pk *pivotKeys) sorted(loc *locale) []string {
+	keys := append([]string{}, pk.keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		ta, oka := pk.first[a]
+		tb, okb := pk.first[b]
+		if oka && okb {
+			return ta.Before(tb)
+		}
+		na, erra := strconv.ParseFloat(a, 64)
+		nb, errb := strconv.ParseFloat(b, 64)
+		if erra == nil && errb == nil {
+			return na < nb
+		}
+		return loc.collate(a, b) < 0
+	})
+	return keys
+}
+
+// apply reshapes rows into the pivot table and returns its header and
+// rows. Invalid rows and rows without a numeric value are left out;
+// "count" counts all rows. Values are rounded and totals are labeled
+// according to the locale.
+func (pc *PivotConfig) apply(hdr []string, rows [][]string, invalid map[int]bool, loc *locale) ([]string, [][]string) {
+	kind := pc.Aggregate
+	rowKeys, colKeys := newPivotKeys(pc.RowFormat), newPivotKeys(pc.ColumnFormat)
+	cells := map[[2]string]*aggregator{}
+	rowTotals := map[string]*aggregator{}
+	colTotals := map[string]*aggregator{}
+	grand := &aggregator{}
+	get := func(m map[string]*aggregator, k string) *aggregator {
+		if m[k] == nil {
+			m[k] = &aggregator{}
+		}
+		return m[k]
+	}
+
+	for r, line := range rows {
+		if invalid[r] {
+			continue
+		}
+		v, ok := cellNumber(line, pc.Values.Index)
+		if !ok && kind != "count" {
+			continue
+		}
+		rk := rowKeys.add(cellAt(line, pc.Rows.Index))
+		ck := colKeys.add(cellAt(line, pc.Columns.Index))
+		if cells[[2]string{rk, ck}] == nil {
+			cells[[2]string{rk, ck}] = &aggregator{}
+		}
+		for _, a := range []*aggregator{cells[[2]string{rk, ck}], get(rowTotals, rk), get(colTotals, ck), grand} {
+			a.add(v)
+		}
+	}
+
+	decimals := 2
+	if kind == "count" {
+		decimals = 0
+	}
+	if pc.Decimals != nil {
+		decimals = *pc.Decimals
+	}
+	format := func(a *aggregator) string {
+		if a == nil || a.n == 0 {
+			return ""
+		}
+		return loc.rounding.format(a.result(kind), decimals)
+	}
+
+	cols := colKeys.sorted(loc)
+	out := []string{hdr[pc.Rows.Index]}
+	out = append(out, cols...)
+	pc.totalCol, pc.totalRow = -1, pc.Totals || pc.ColumnTotals
+	if pc.Totals || pc.RowTotals {
+		pc.totalCol = len(out)
+		out = append(out, loc.msg("total"))
+	}
+	var table [][]string
+	for _, rk := range rowKeys.sorted(loc) {
+		line := []string{rk}
+		for _, ck := range cols {
+			line = append(line, format(cells[[2]string{rk, ck}]))
+		}
+		if pc.totalCol >= 0 {
+			line = append(line, format(rowTotals[rk]))
+		}
+		table = append(table, line)
+	}
+	if pc.totalRow {
+		line := []string{loc.msg("total")}
+		for _, ck := range cols {
+			line = append(line, format(colTotals[ck]))
+		}
+		if pc.totalCol >= 0 {
+			if pc.GrandTotal != nil && !*pc.GrandTotal {
+				grand = nil
+			}
+			line = append(line, format(grand))
+		}
+		table = append(table, line)
+	}
+	return out, table
+}
+
+// isTotal reports whether the cell in row r and column i of a pivot
+// table with n rows is a total.
+func (pc *PivotConfig) isTotal(r, i, n int) bool {
+	if pc == nil {
+		return false
+	}
+	return pc.totalRow && r == n-1 || i == pc.totalCol
+}
+
+// layout sizes the pivot table's columns to their contents and aligns
+// the value columns to the right, unless the columns are configured.
+func (pc *PivotConfig) layout(env *Env, cfg *Config, hdr []string, rows [][]string) {
+	configured := map[int]bool{}
+	for k := range cfg.Columns {
+		cc := &cfg.Columns[k]
+		configured[cc.Index] = true
+		if cc.Index > 0 && cc.Align == "" {
+			cc.Align = "R"
+		}
+	}
+	for i := 1; i < len(hdr); i++ {
+		if !configured[i] {
+			cfg.Columns = append(cfg.Columns, ColumnConfig{Index: i, Align: "R"})
+		}
+	}
+	cfg.widths = measureColumns(env, cfg, hdr, cfg.computeRows(hdr, rows))
+}
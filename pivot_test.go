@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPivot(t *testing.T) {
+	hdr := []string{"Date", "Region", "Sales"}
+	rows := [][]string{
+		{"2024-02-10", "North", "10.1"},
+		{"2024-01-05", "South", "5"},
+		{"2024-01-20", "North", "2.2"},
+		{"2024-02-01", "North", "n/a"},
+		{"2024-01-31", "South", "7"},
+		{"2024-03-03", "East", "1"}, // invalid
+	}
+	invalid := map[int]bool{5: true}
+	month := &DateFormat{Format: "Jan 2006"}
+	no := false
+	one := 1
+	tests := []struct {
+		pivot PivotConfig
+		hdr   []string
+		rows  [][]string
+	}{
+		{PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 0}, Values: ColumnRef{Index: 2}, ColumnFormat: month},
+			[]string{"Region", "Jan 2024", "Feb 2024"},
+			[][]string{{"North", "2.20", "10.10"}, {"South", "12.00", ""}}},
+		{PivotConfig{Rows: ColumnRef{Index: 0}, Columns: ColumnRef{Index: 1}, Values: ColumnRef{Index: 2}, RowFormat: month, Totals: true},
+			[]string{"Date", "North", "South", "Total"},
+			[][]string{{"Jan 2024", "2.20", "12.00", "14.20"}, {"Feb 2024", "10.10", "", "10.10"}, {"Total", "12.30", "12.00", "24.30"}}},
+		{PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 0}, Values: ColumnRef{Index: 2}, ColumnFormat: month,
+			Aggregate: "count", RowTotals: true},
+			[]string{"Region", "Jan 2024", "Feb 2024", "Total"},
+			[][]string{{"North", "1", "2", "3"}, {"South", "2", "", "2"}}},
+		{PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 0}, Values: ColumnRef{Index: 2}, ColumnFormat: month,
+			Aggregate: "avg", ColumnTotals: true, Decimals: &one},
+			[]string{"Region", "Jan 2024", "Feb 2024"},
+			[][]string{{"North", "2.2", "10.1"}, {"South", "6.0", ""}, {"Total", "4.7", "10.1"}}},
+		{PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 0}, Values: ColumnRef{Index: 2}, ColumnFormat: month,
+			Aggregate: "max", Totals: true, GrandTotal: &no},
+			[]string{"Region", "Jan 2024", "Feb 2024", "Total"},
+			[][]string{{"North", "2.20", "10.10", "10.10"}, {"South", "7.00", "", "7.00"}, {"Total", "7.00", "10.10", ""}}},
+		{PivotConfig{Rows: ColumnRef{Index: 1}, Columns: ColumnRef{Index: 1}, Values: ColumnRef{Index: 2}, Aggregate: "min"},
+			[]string{"Region", "North", "South"},
+			[][]string{{"North", "2.20", ""}, {"South", "", "5.00"}}},
+	}
+	loc := (&Config{}).locale()
+	for i, tt := range tests {
+		pc := tt.pivot
+		if err := pc.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		gotHdr, gotRows := pc.apply(hdr, rows, invalid, loc)
+		if !reflect.DeepEqual(gotHdr, tt.hdr) || !reflect.DeepEqual(gotRows, tt.rows) {
+			t.Errorf("pivot %d: apply = %q, %q; want %q, %q", i, gotHdr, gotRows, tt.hdr, tt.rows)
+		}
+	}
+}
+
+func TestPivotKeyOrder(t *testing.T) {
+	pk := newPivotKeys(nil)
+	for _, k := range []string{"10", "9", " 100 "} {
+		pk.add(k)
+	}
+	if got, want := pk.sorted((&Config{}).locale()), []string{"9", "10", "100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("numeric keys sorted as %q, want %q", got, want)
+	}
+}
+
+func TestPivotReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Product,Sales\nNorth,Apples,10\nSouth,Pears,5\nNorth,Pears,2\n",
+		"cfg.json": `{"pivot": {"rows": "Region", "columns": "Product", "values": "Sales", "totals": true}, "textVersion": {"format": "text"}}`,
+		"bad.json": `{"pivot": {"rows": "Region", "columns": "Product", "values": "Sales", "aggregate": "median"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"Region  Apples  Pears  Total", "North    10.00   2.00  12.00", "Total    10.00   7.00  17.00"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+	err := generate(env, &Job{Input: "in.csv", Config: "bad.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), `unknown aggregate "median"`) {
+		t.Errorf("unknown aggregate: %v", err)
+	}
+}
+
+func TestPivotTotalStyle(t *testing.T) {
+	pc := &PivotConfig{totalCol: 3, totalRow: true}
+	for _, tt := range []struct {
+		r, i int
+		want bool
+	}{{0, 0, false}, {0, 3, true}, {2, 0, true}, {2, 3, true}, {1, 2, false}} {
+		if got := pc.isTotal(tt.r, tt.i, 3); got != tt.want {
+			t.Errorf("isTotal(%d, %d) = %v, want %v", tt.r, tt.i, got, tt.want)
+		}
+	}
+	if (*PivotConfig)(nil).isTotal(0, 0, 1) {
+		t.Error("a table without pivot has totals")
+	}
+
+	env := testEnv(map[string]string{
+		"in.csv":   "Region,Product,Sales\nNorth,Apples,10\nSouth,Pears,5\nNorth,Pears,2\n",
+		"cfg.json": `{"pivot": {"rows": "Region", "columns": "Product", "values": "Sales", "totals": true}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	// Follow the font and the fill color through the content stream after
+	// the header row, and mark the texts printed in the bold font of the
+	// header on gray.
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	tf := regexp.MustCompile(`/(\w+) [\d.]+ Tf`)
+	header := strings.Index(content, "(Region)Tj")
+	fonts := tf.FindAllStringSubmatch(content[:header], -1)
+	bold := fonts[len(fonts)-1][1]
+	content = content[header+strings.Index(content[header:], "(Total)Tj")+len("(Total)Tj"):]
+	var font, fill string
+	var got []string
+	for _, m := range regexp.MustCompile(tf.String()+`|([\d.]+) g\n|\(([^)]*)\)Tj`).FindAllStringSubmatch(content, -1) {
+		switch {
+		case m[1] != "":
+			font = m[1]
+		case m[2] != "":
+			fill = m[2]
+		case font == bold && fill == "0.941":
+			got = append(got, "*"+m[3])
+		default:
+			got = append(got, m[3])
+		}
+	}
+	want := []string{
+		"North", "10.00", "2.00", "*12.00",
+		"South", "5.00", "*5.00",
+		"*Total", "*10.00", "*7.00", "*17.00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cells %q, want %q (totals marked *)", got, want)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ## Report portal
+
+// Colleagues who want last quarter's numbers for one region should not
+// have to ask for a new scheduled job. The portal is a small web UI on
+// the daemon's listen address that lists the scheduled jobs as report
+// profiles. A user picks one, adjusts the date range and a row filter,
+// and gets the report shown in the browser:
+//
+//	"portal": {"title": "Sales reports"}
+//
+// The portal runs its reports through the job API, which must be
+// enabled, so they share its workers and its output directory. The
+// scheduled jobs themselves are not affected.
+
+// PortalConfig enables the report portal at /portal/.
+type PortalConfig struct {
+	// Title is the heading of the portal pages. Default: "Reports".
+	Title string `json:"title"`
+}
+
+// portal serves the portal pages.
+type portal struct {
+	title string
+	jobs  []*ScheduledJob
+	api   *jobAPI
+}
+
+// register adds the portal's handlers to mux.
+func (pc *PortalConfig) register(mux *http.ServeMux, jobs []*ScheduledJob, api *jobAPI) {
+	p := &portal{title: orDefault(pc.Title, "Reports"), jobs: jobs, api: api}
+	mux.HandleFunc("/portal/", p.index)
+	mux.HandleFunc("/portal/run", p.run)
+	mux.HandleFunc("/portal/jobs/", p.job)
+}
+
+// portalRanges are the date ranges offered in the form.
+var portalRanges = []string{"today", "yesterday", "last-7-days", "last-30-days", "mtd", "qtd", "ytd", "custom"}
+
+var portalTemplate = template.Must(template.New("portal").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+{{if .Refresh}}<meta http-equiv="refresh" content="2">{{end}}
+<style>
+body { font-family: sans-serif; margin: 2em; }
+form { border: 1px solid #ccc; padding: 1em; margin-bottom: 1em; }
+label { margin-right: 1em; }
+iframe { width: 100%; height: 80vh; border: 1px solid #ccc; }
+.error { color: #b00; }
+</style></head><body>
+<h1><a href="/portal/">{{.Title}}</a></h1>
+{{define "profiles"}}{{range .}}
+<form method="post" action="/portal/run">
+<h2>{{.Name}}</h2>
+<input type="hidden" name="profile" value="{{.Index}}">
+{{if .DateColumn}}<label>Range <select name="range">{{$r := .Range}}{{range .Ranges}}
+<option{{if eq . $r}} selected{{end}}>{{.}}</option>{{end}}
+</select></label>
+<label>From <input type="date" name="from" value="{{.From}}"></label>
+<label>To <input type="date" name="to" value="{{.To}}"></label>{{end}}
+<label>Filter <input type="text" name="filter" size="40" value="{{.Filter}}" placeholder="Region = &quot;North&quot;"></label>
+<button>Create report</button>
+</form>{{else}}<p>There are no report profiles.</p>{{end}}{{end}}
+{{define "job"}}{{if eq .Status "done"}}<p>The report is ready. <a href="{{.Result}}">Download</a></p>
+<iframe src="{{.Result}}"></iframe>{{else if eq .Status "failed"}}<p class="error">The report failed: {{.Error}}</p>
+{{else if eq .Status "canceled"}}<p>The report was canceled.</p>
+{{else}}<p>The report is {{.Status}} &hellip;</p>{{end}}{{end}}
+{{if .Job}}{{template "job" .Job}}{{else}}{{template "profiles" .Profiles}}{{end}}
+</body></html>
+`))
+
+// portalPage is the template data of a portal page.
+type portalPage struct {
+	Title    string
+	Refresh  bool
+	Profiles []portalProfile
+	Job      *apiJob
+}
+
+// portalProfile is a scheduled job offered in the portal.
+type portalProfile struct {
+	Index      int
+	Name       string
+	DateColumn string
+	Range      string
+	Ranges     []string
+	From, To   string
+	Filter     string
+}
+
+// index lists the profiles.
+func (p *portal) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/portal/" {
+		http.NotFound(w, r)
+		return
+	}
+	page := portalPage{Title: p.title}
+	for i, sj := range p.jobs {
+		page.Profiles = append(page.Profiles, portalProfile{
+			Index:      i,
+			Name:       sj.Name,
+			DateColumn: sj.DateRange.Column,
+			Range:      sj.DateRange.Range,
+			Ranges:     portalRanges,
+			From:       sj.DateRange.From,
+			To:         sj.DateRange.To,
+			Filter:     sj.Filter,
+		})
+	}
+	p.render(w, page)
+}
+
+// run starts a report of a profile with the settings of the form and
+// redirects to its page.
+func (p *portal) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	i, err := strconv.Atoi(r.FormValue("profile"))
+	if err != nil || i < 0 || i >= len(p.jobs) {
+		http.Error(w, "unknown profile", http.StatusBadRequest)
+		return
+	}
+	job := p.jobs[i].Job
+	if job.DateRange.Column != "" {
+		job.DateRange.Range = r.FormValue("range")
+		job.DateRange.From = r.FormValue("from")
+		job.DateRange.To = r.FormValue("to")
+	}
+	job.Filter = strings.TrimSpace(r.FormValue("filter"))
+	if err := p.api.supports(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	aj, err := p.api.start(context.Background(), &job, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/portal/jobs/"+aj.ID, http.StatusSeeOther)
+}
+
+// job shows the progress of a report and, when it is done, the report.
+func (p *portal) job(w http.ResponseWriter, r *http.Request) {
+	st, ok := p.api.status(strings.TrimPrefix(r.URL.Path, "/portal/jobs/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	p.render(w, portalPage{Title: p.title, Refresh: st.Status == "queued" || st.Status == "running", Job: &st})
+}
+
+func (p *portal) render(w http.ResponseWriter, page portalPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := portalTemplate.Execute(w, page); err != nil {
+		p.api.env.Log.Error("portal page failed", "err", err)
+	}
+}
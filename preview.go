@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ## Page previews
+
+// The web UI shows a report before the user downloads it. For that, it
+// needs images of the pages, which the tool writes next to the report:
+// report.pdf gets report.page-1.png, report.page-2.png, and so on.
+//
+//	"previews": {"width": 300, "pages": 3}
+//
+// gofpdf writes PDF but cannot draw it, so the images come from a
+// converter: pdftoppm of Poppler by default, or any command that writes
+// one image per page into a directory:
+//
+//	"previews": {"format": "jpeg",
+//	  "command": ["mutool", "draw", "-w", "{width}", "-o", "{dir}/page-%d.jpg", "{pdf}"]}
+//
+// In the command, {pdf} is replaced with the path of the report, {dir}
+// with the directory for the images, and {width} and {pages} with the
+// settings. The images are taken in the order of the page numbers in
+// their names. A test may render the pages itself; see
+// Env.Rasterize. Previews are written whenever the report is, and
+// a failed conversion fails the report.
+
+// PreviewConfig writes images of the pages.
+type PreviewConfig struct {
+	// Width is the width of the images in pixels. Default: 200.
+	Width int `json:"width"`
+
+	// Pages is the number of pages to write images of. Default: all.
+	Pages int `json:"pages"`
+
+	// Format is "png" (default) or "jpeg".
+	Format string `json:"format"`
+
+	// Command is the converter and its arguments. Default: pdftoppm.
+	Command []string `json:"command"`
+}
+
+func (pc *PreviewConfig) prepare() error {
+	switch pc.Format {
+	case "":
+		pc.Format = "png"
+	case "png", "jpeg":
+	default:
+		return fmt.Errorf("unknown format %q; use png or jpeg", pc.Format)
+	}
+	if pc.Width < 0 || pc.Pages < 0 {
+		return errors.New("width and pages must not be negative")
+	}
+	if pc.Width == 0 {
+		pc.Width = 200
+	}
+	return nil
+}
+
+// ext returns the file name extension of the images.
+func (pc *PreviewConfig) ext() string {
+	if pc.Format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// previewPath returns the path of the image of page n for a PDF path.
+func previewPath(pdfPath string, n int, ext string) string {
+	return fmt.Sprintf("%s.page-%d%s", strings.TrimSuffix(pdfPath, ".pdf"), n, ext)
+}
+
+// write writes the images of the pages of part p.
+func (pc *PreviewConfig) write(env *Env, p *part) error {
+	var images [][]byte
+	var err error
+	if env.Rasterize != nil {
+		images, err = env.Rasterize(p.pdf, pc.Width, pc.Pages, pc.Format)
+	} else {
+		images, err = pc.convert(p.pdf)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create previews: %w", err)
+	}
+	if pc.Pages > 0 && len(images) > pc.Pages {
+		images = images[:pc.Pages]
+	}
+	for i, img := range images {
+		path := previewPath(p.output, i+1, pc.ext())
+		if err := writeOutput(env.FS, path, img); err != nil {
+			return fmt.Errorf("cannot save preview: %w", err)
+		}
+	}
+	env.Log.Debug("previews written", "output", p.output, "images", len(images))
+	return nil
+}
+
+// reNumber finds the page number in the name of an image.
+var reNumber = regexp.MustCompile(`(\d+)\.\w+$`)
+
+// convert runs the converter on a temporary copy of the document and
+// returns the images it writes.
+func (pc *PreviewConfig) convert(pdf []byte) ([][]byte, error) {
+	dir, err := ioutil.TempDir("", "previews-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	pdfPath := filepath.Join(dir, "report.pdf")
+	if err := ioutil.WriteFile(pdfPath, pdf, 0600); err != nil {
+		return nil, err
+	}
+	imgDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(imgDir, 0700); err != nil {
+		return nil, err
+	}
+
+	args := pc.Command
+	if len(args) == 0 {
+		args = []string{"pdftoppm", "-" + pc.Format, "-scale-to-x", "{width}", "-scale-to-y", "-1"}
+		if pc.Pages > 0 {
+			args = append(args, "-l", "{pages}")
+		}
+		args = append(args, "{pdf}", "{dir}/page")
+	}
+	r := strings.NewReplacer("{pdf}", pdfPath, "{dir}", imgDir, "{width}", strconv.Itoa(pc.Width), "{pages}", strconv.Itoa(pc.Pages))
+	expanded := make([]string, len(args))
+	for i, a := range args {
+		expanded[i] = r.Replace(a)
+	}
+	cmd := exec.Command(expanded[0], expanded[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	// pdftoppm pads the page numbers to the same length, other
+	// converters may not.
+	files, err := ioutil.ReadDir(imgDir)
+	if err != nil {
+		return nil, err
+	}
+	type page struct {
+		n    int
+		name string
+	}
+	var pages []page
+	for _, f := range files {
+		m := reNumber.FindStringSubmatch(f.Name())
+		if m == nil || f.IsDir() {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		pages = append(pages, page{n, f.Name()})
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%s wrote no images", args[0])
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].n < pages[j].n })
+	images := make([][]byte, len(pages))
+	for i, pg := range pages {
+		if images[i], err = ioutil.ReadFile(filepath.Join(imgDir, pg.name)); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
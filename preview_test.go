@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreviewConfig(t *testing.T) {
+	pc := &PreviewConfig{}
+	if err := pc.prepare(); err != nil || pc.Format != "png" || pc.Width != 200 || pc.ext() != ".png" {
+		t.Errorf("defaults %+v, %v", pc, err)
+	}
+	pc = &PreviewConfig{Format: "jpeg", Width: 300}
+	if err := pc.prepare(); err != nil || pc.Width != 300 || pc.ext() != ".jpg" {
+		t.Errorf("jpeg: %+v, %v", pc, err)
+	}
+	for _, pc := range []*PreviewConfig{{Format: "gif"}, {Width: -1}, {Pages: -1}} {
+		if err := pc.prepare(); err == nil {
+			t.Errorf("%+v is accepted", pc)
+		}
+	}
+	if got := previewPath("out/sales.pdf", 2, ".jpg"); got != "out/sales.page-2.jpg" {
+		t.Errorf("previewPath = %q", got)
+	}
+}
+
+func TestPreviews(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   longCSV(50),
+		"cfg.json": `{"previews": {"width": 300, "pages": 2}}`,
+	})
+	var args []interface{}
+	env.Rasterize = func(pdf []byte, width, pages int, format string) ([][]byte, error) {
+		args = []interface{}{strings.HasPrefix(string(pdf), "%PDF-"), width, pages, format}
+		return [][]byte{[]byte("page 1"), []byte("page 2"), []byte("page 3")}, nil
+	}
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "sales.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{true, 300, 2, "png"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("rasterized with %v, want %v", args, want)
+	}
+	// Images beyond the number of pages are dropped.
+	for n, want := range []string{"page 1", "page 2"} {
+		if got := testFile(t, env, fmt.Sprintf("sales.page-%d.png", n+1)); got != want {
+			t.Errorf("image %d is %q, want %q", n+1, got, want)
+		}
+	}
+	if got := files(t, env.FS); indexOf(got, "sales.page-3.png") >= 0 {
+		t.Errorf("an image beyond the number of pages is written: %q", got)
+	}
+
+	env.Rasterize = func([]byte, int, int, string) ([][]byte, error) {
+		return nil, errors.New("out of ink")
+	}
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "failed.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "cannot create previews: out of ink") {
+		t.Errorf("a failed conversion: %v", err)
+	}
+}
+
+func TestPreviewConvert(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	tests := []struct {
+		script string
+		want   []string
+		err    string
+	}{
+		// Images are taken in the order of their page numbers, padded or
+		// not; other files are ignored.
+		{`printf 3 > {dir}/p-10.png; printf 2 > {dir}/p-02.png; printf 1 > {dir}/p-1.png; printf x > {dir}/notes; printf {width}/{pages} > {dir}/p-11.png`,
+			[]string{"1", "2", "3", "150/4"}, ""},
+		{`echo broken >&2; exit 3`, nil, "sh: exit status 3: broken"},
+		{`true`, nil, "sh wrote no images"},
+	}
+	for _, tt := range tests {
+		pc := &PreviewConfig{Width: 150, Pages: 4, Command: []string{"sh", "-c", tt.script, "{pdf}"}}
+		images, err := pc.convert([]byte("%PDF-1.4"))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got error %v, want %q", tt.script, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.script, err)
+		}
+		var got []string
+		for _, img := range images {
+			got = append(got, string(img))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: images %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
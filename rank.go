@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ## Rank column
+
+// Leaderboard-style reports want a rank in front of each row. The rank is
+// computed while rendering, so the CSV data stays as it is.
+
+// rankWidth is the width of the rank column.
+const rankWidth = 15
+
+// RankConfig enables the rank column.
+type RankConfig struct {
+	// Column is the metric column to rank by.
+	Column ColumnRef `json:"column"`
+
+	// Title is the header of the rank column. Default: "Rank".
+	Title string `json:"title"`
+
+	// Method decides how ties are ranked:
+	// "standard" (1, 2, 2, 4), "dense" (1, 2, 2, 3),
+	// "modified" (1, 3, 3, 4), or "ordinal" (1, 2, 3, 4).
+	Method string `json:"method"`
+
+	// Ascending ranks the smallest value first. By default, the largest
+	// value gets rank 1.
+	Ascending bool `json:"ascending"`
+}
+
+// title returns the header of the rank column.
+func (rc *RankConfig) title(loc *locale) string {
+	if rc.Title == "" {
+		return loc.msg("rank")
+	}
+	return rc.Title
+}
+
+// computeRanks returns the rank of every row of tbl as a string. Rows
+// without a numeric metric get an empty rank.
+func computeRanks(tbl [][]string, rc *RankConfig) ([]string, error) {
+	type entry struct {
+		row int
+		v   float64
+	}
+	var entries []entry
+	for i, line := range tbl {
+		if v, ok := cellNumber(line, rc.Column.Index); ok {
+			entries = append(entries, entry{i, v})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if rc.Ascending {
+			return entries[i].v < entries[j].v
+		}
+		return entries[i].v > entries[j].v
+	})
+
+	ranks := make([]string, len(tbl))
+	dense := 0
+	for start := 0; start < len(entries); {
+		// Find the group of tied entries starting at start.
+		end := start + 1
+		for end < len(entries) && entries[end].v == entries[start].v {
+			end++
+		}
+		dense++
+		for k := start; k < end; k++ {
+			var r int
+			switch rc.Method {
+			case "", "standard":
+				r = start + 1
+			case "dense":
+				r = dense
+			case "modified":
+				r = end
+			case "ordinal":
+				r = k + 1
+			default:
+				return nil, fmt.Errorf("unknown rank method %q", rc.Method)
+			}
+			ranks[entries[k].row] = strconv.Itoa(r)
+		}
+		start = end
+	}
+	return ranks, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeRanks(t *testing.T) {
+	// Pears and Plums tie; Figs has no metric.
+	tbl := [][]string{{"Apples", "10"}, {"Pears", "30"}, {"Figs", "n/a"}, {"Plums", "30"}, {"Kiwis", "5"}}
+	tests := []struct {
+		method    string
+		ascending bool
+		want      []string
+	}{
+		{"", false, []string{"3", "1", "", "1", "4"}},
+		{"standard", false, []string{"3", "1", "", "1", "4"}},
+		{"dense", false, []string{"2", "1", "", "1", "3"}},
+		{"modified", false, []string{"3", "2", "", "2", "4"}},
+		{"ordinal", false, []string{"3", "1", "", "2", "4"}},
+		{"standard", true, []string{"2", "3", "", "3", "1"}},
+		{"dense", true, []string{"2", "3", "", "3", "1"}},
+	}
+	for _, tt := range tests {
+		rc := &RankConfig{Column: ColumnRef{Index: 1}, Method: tt.method, Ascending: tt.ascending}
+		got, err := computeRanks(tbl, rc)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q, ascending %v: computeRanks = %q, %v; want %q", tt.method, tt.ascending, got, err, tt.want)
+		}
+	}
+	rc := &RankConfig{Column: ColumnRef{Index: 1}, Method: "fractional"}
+	if _, err := computeRanks(tbl, rc); err == nil || err.Error() != `unknown rank method "fractional"` {
+		t.Errorf("unknown method: %v", err)
+	}
+}
+
+func TestRankReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\nPears,30\nPlums,30\n",
+		"cfg.json": `{"rank": {"column": "Total", "method": "dense", "title": "Place"}, "textVersion": {"format": "text"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"Place", "2 Apples", "1 Pears", "1 Plums"} {
+		if !strings.Contains(strings.Join(strings.Fields(text), " "), want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+}
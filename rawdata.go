@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ## Raw data appendix
+
+// Auditors do not trust formatted numbers, rounded sums, or tables cut
+// short by limits; they want to see everything. The raw data appendix
+// lists the rows of the report after the formatted report, as they came
+// in: unformatted, without computed columns, and all of them, in a
+// compact monospace layout without borders:
+//
+//	"rawData": {"fontSize": 6}
+//
+// Columns are as wide as their longest value. If the page is too narrow
+// for that, the widest columns are narrowed, and their longer values
+// continue on the next lines. Nothing is cut off. The appendix is not
+// available for pivot tables, whose rows are not the input rows.
+
+// RawDataConfig adds the raw data appendix.
+type RawDataConfig struct {
+	// FontSize is the size of the Courier font in points. Default: 6.
+	FontSize float64 `json:"fontSize"`
+}
+
+func (rc *RawDataConfig) prepare(c *Config) error {
+	if c.Pivot != nil {
+		return fmt.Errorf("not available for pivot tables")
+	}
+	if rc.FontSize < 0 {
+		return fmt.Errorf("invalid font size %g", rc.FontSize)
+	}
+	if rc.FontSize == 0 {
+		rc.FontSize = 6
+	}
+	return nil
+}
+
+// rawDataAppendix adds the appendix with the input columns of rows.
+func rawDataAppendix(pdf *Fpdf, cfg *Config, hdr []string, rows [][]string) *Fpdf {
+	rc := cfg.RawData
+	if rc == nil {
+		return pdf
+	}
+	hdr = hdr[:len(hdr)-len(cfg.Computed)]
+	loc := cfg.locale()
+	addPage(pdf, cfg.Orientation.of("appendix"))
+	pdf.SetFont("Times", "B", 20)
+	pdf.Cell(40, 10, loc.text("rawData"))
+	pdf.Ln(14)
+
+	pdf.SetFont("Courier", "", rc.FontSize)
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	chars := int((pageWidth - left - right) / pdf.GetStringWidth("0"))
+	widths := rawWidths(hdr, rows, chars)
+	h := rc.FontSize * 25.4 / 72 * 1.2
+
+	// Rows are kept together on a page, and every page starts with the
+	// column names.
+	header := rawLines(hdr, widths)
+	printLines := func(lines []string, style string) {
+		pdf.SetFontStyle(style)
+		for _, l := range lines {
+			pdf.CellFormat(0, h, coreFontText(l), "", 1, "L", false, 0, "")
+		}
+	}
+	printLines(header, "B")
+	for _, line := range rows {
+		lines := rawLines(line, widths)
+		if float64(len(lines))*h > spaceLeft(pdf) {
+			addPage(pdf, "")
+			printLines(header, "B")
+		}
+		printLines(lines, "")
+	}
+	return pdf
+}
+
+// rawGap is the space between the columns of the appendix, in
+// characters.
+const rawGap = 2
+
+// rawSpace replaces line breaks and tabs in raw values.
+var rawSpace = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// rawWidths returns the widths of the columns in characters: the
+// length of their longest values, but no more than fit into a line of
+// the given length.
+func rawWidths(hdr []string, rows [][]string, chars int) []int {
+	widths := make([]int, len(hdr))
+	total := 0
+	for i := range hdr {
+		widths[i] = maxInt(1, utf8.RuneCountInString(hdr[i]))
+		for _, line := range rows {
+			if n := utf8.RuneCountInString(rawSpace.Replace(cellAt(line, i))); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		total += widths[i]
+	}
+	avail := chars - rawGap*(len(hdr)-1)
+	if total <= avail {
+		return widths
+	}
+
+	// The widest columns are narrowed to the largest width at which
+	// all columns fit.
+	limit := 1
+	for w := 1; ; w++ {
+		sum := 0
+		for _, cw := range widths {
+			sum += minInt(cw, w)
+		}
+		if sum > avail {
+			break
+		}
+		limit = w
+	}
+	for i := range widths {
+		widths[i] = minInt(widths[i], limit)
+	}
+	return widths
+}
+
+// rawLines returns the text lines of a row. Values longer than their
+// column continue on the next lines.
+func rawLines(line []string, widths []int) []string {
+	cols := make([][]rune, len(widths))
+	n := 1
+	for i, w := range widths {
+		cols[i] = []rune(rawSpace.Replace(cellAt(line, i)))
+		if k := (len(cols[i]) + w - 1) / w; k > n {
+			n = k
+		}
+	}
+	lines := make([]string, n)
+	gap := strings.Repeat(" ", rawGap)
+	for k := range lines {
+		var b strings.Builder
+		for i, w := range widths {
+			if i > 0 {
+				b.WriteString(gap)
+			}
+			chunk := []rune{}
+			if k*w < len(cols[i]) {
+				chunk = cols[i][k*w : minInt((k+1)*w, len(cols[i]))]
+			}
+			b.WriteString(string(chunk))
+			b.WriteString(strings.Repeat(" ", w-len(chunk)))
+		}
+		lines[k] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRawWidths(t *testing.T) {
+	hdr := []string{"Item", "Note", "Total"}
+	rows := [][]string{
+		{"Apples", "late\tagain", "12"},
+		{"Pears", strings.Repeat("x", 30), "1234.5"},
+		{"Äpfel"},
+	}
+	tests := []struct {
+		chars int
+		want  []int
+	}{
+		{100, []int{6, 30, 6}},
+		{46, []int{6, 30, 6}},
+		{45, []int{6, 29, 6}},
+		{20, []int{5, 5, 5}},
+		{1, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		if got := rawWidths(hdr, rows, tt.chars); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d characters: widths %v, want %v", tt.chars, got, tt.want)
+		}
+	}
+}
+
+func TestRawLines(t *testing.T) {
+	got := rawLines([]string{"Apples", "late\nagain, and again", "12"}, []int{6, 8, 3})
+	want := []string{
+		"Apples  late aga  12",
+		"        in, and",
+		"        again",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := rawLines([]string{"a"}, []int{3, 2}); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("a short row: got %q", got)
+	}
+}
+
+func TestRawDataConfig(t *testing.T) {
+	rc := &RawDataConfig{}
+	if err := rc.prepare(&Config{}); err != nil || rc.FontSize != 6 {
+		t.Errorf("got font size %g, %v, want 6", rc.FontSize, err)
+	}
+	if err := (&RawDataConfig{FontSize: -1}).prepare(&Config{}); err == nil {
+		t.Error("a negative font size is accepted")
+	}
+	if err := (&RawDataConfig{}).prepare(&Config{Pivot: &PivotConfig{}}); err == nil {
+		t.Error("the appendix is accepted for a pivot table")
+	}
+}
+
+func TestRawDataAppendix(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,1234.5\nPears\tand plums,2\n",
+		"cfg.json": `{"rawData": {}, "computed": [{"name": "Double", "expr": "Total * 2"}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(testFile(t, env, "out.pdf"))
+	if pages := pageObjects(t, data); len(pages) != 2 {
+		t.Fatalf("%d pages, want 2", len(pages))
+	}
+	content := pageContents(t, data)
+	i := strings.Index(content, "(Raw data)Tj")
+	if i < 0 {
+		t.Fatal("the appendix is missing")
+	}
+	// The computed column is left out; tabs become spaces.
+	appendix := content[i:]
+	for _, s := range []string{"(Item             Total)Tj", "(Apples           1234.5)Tj", "(Pears and plums  2)Tj"} {
+		if !strings.Contains(appendix, s) {
+			t.Errorf("missing %q in\n%s", s, appendix)
+		}
+	}
+	if strings.Contains(appendix, "Double") || strings.Contains(appendix, "2469") {
+		t.Error("the appendix has the computed column")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ## Personalized reports
+
+// Every sales rep wants the report, but only about their own region. A
+// recipients file lists, per email address, a filter expression that
+// selects the rows of that recipient's report:
+//
+//	email,filter
+//	anna@example.com,"Region = ""North"""
+//	bob@example.com; carol@example.com,"Region in (""East"", ""West"")"
+//
+// One run then renders and mails one report per line. Several addresses
+// in one line, separated by commas or semicolons, share a report. A
+// recipient whose filter matches no rows gets a report with an empty
+// table.
+
+// RecipientsConfig enables personalized reports.
+type RecipientsConfig struct {
+	// File is a CSV file with the columns "email" and "filter".
+	File string `json:"file"`
+
+	// Output is a text/template for the file name of each report, like
+	// SplitConfig.Output; {{.Value}} is the email address.
+	// Default: "{{.Base}}-{{.Value}}.pdf".
+	Output string `json:"output"`
+
+	// Workers is the number of reports generated concurrently.
+	// Default: the number of CPUs.
+	Workers int `json:"workers"`
+}
+
+// workers returns the number of concurrent workers.
+func (rc *RecipientsConfig) workers() int {
+	return (&SplitConfig{Workers: rc.Workers}).workers()
+}
+
+// parts reads the recipients file and returns one part per recipient,
+// with the rows that match the recipient's filter. Filters see the
+// computed columns, too.
+func (rc *RecipientsConfig) parts(env *Env, cfg *Config, hdr []string, rows [][]string, invalid map[int]bool, issues []rowIssue, output string) ([]*part, error) {
+	data, err := loadCSV(env.FS, rc.File, csvDialect{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot load recipients: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("recipients file '%s' is empty", rc.File)
+	}
+	emailCol, filterCol := indexOf(data[0], "email"), indexOf(data[0], "filter")
+	if emailCol < 0 || filterCol < 0 {
+		return nil, fmt.Errorf("recipients file '%s' needs the columns email and filter", rc.File)
+	}
+
+	byRow := map[int]rowIssue{}
+	for _, is := range issues {
+		byRow[is.Row] = is
+	}
+	computed := cfg.computeRows(hdr, rows)
+	var parts []*part
+	for n, line := range data[1:] {
+		email := strings.TrimSpace(cellAt(line, emailCol))
+		filter, err := parseFilter(cellAt(line, filterCol), hdr, cfg.renamed)
+		if err != nil {
+			return nil, fmt.Errorf("recipients file '%s', line %d: %w", rc.File, n+2, err)
+		}
+		p := &part{value: email, to: splitAddresses(email), invalid: map[int]bool{}}
+		if len(p.to) == 0 {
+			return nil, fmt.Errorf("recipients file '%s', line %d: no email address", rc.File, n+2)
+		}
+		for r, line := range rows {
+			if !filter.match(computed[r]) {
+				continue
+			}
+			if invalid[r] {
+				p.invalid[len(p.rows)] = true
+			}
+			if is, ok := byRow[r]; ok {
+				p.issues = append(p.issues, is)
+			}
+			p.rows = append(p.rows, line)
+		}
+		parts = append(parts, p)
+	}
+	if err := nameParts(parts, orDefault(rc.Output, "{{.Base}}-{{.Value}}.pdf"), output); err != nil {
+		return nil, fmt.Errorf("recipients output: %w", err)
+	}
+	return parts, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// ## Recovering from panics
+
+// A panic deep inside gofpdf or in a custom callback should not take
+// down a long-running process that renders many reports. render
+// recovers such panics and turns them into a RenderError that tells
+// where rendering went wrong.
+
+// RenderError describes a panic that occurred while rendering.
+type RenderError struct {
+	// Section is the part of the report being rendered, e.g. "table".
+	Section string
+
+	// Row is the index of the data row being rendered, or -1.
+	Row int
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *RenderError) Error() string {
+	if e.Row >= 0 {
+		return fmt.Sprintf("panic while rendering %s, row %d: %v", e.Section, e.Row+1, e.Value)
+	}
+	return fmt.Sprintf("panic while rendering %s: %v", e.Section, e.Value)
+}
+
+// progress tracks the section and row being rendered, records the
+// layout if a snapshot was requested, and collects footnotes.
+type progress struct {
+	ctx     context.Context // the job's, or nil; see GenerateContext
+	section string
+	row     int
+	layout  *layoutSnapshot
+	notes   *footnotes   // nil without footnotes
+	debug   *layoutDebug // nil without the layout debug overlay
+
+	report func(ProgressEvent) // nil without progress reporting
+	event  ProgressEvent
+
+	truncated *truncation // set if the limits cut the table short
+
+	pages   pageFuncs
+	hooks   *RenderHooks // nil without hooks
+	hookCtx HookContext
+	hookDoc *Fpdf // the document that the hooks draw on
+
+	tags *tagger // nil unless the report is tagged
+}
+
+// enter marks the start of a new section.
+func (p *progress) enter(section string) {
+	p.section = section
+	p.row = -1
+	p.debug.mark(section)
+	p.tags.enter(section)
+}
+
+// endRow is called after a table row has been printed, before moving
+// to the next line.
+func (p *progress) endRow(pdf Backend, line []string, h float64) {
+	p.rowHook(line, h)
+	if p.layout != nil {
+		p.layout.row(pdf, p.row, h)
+	}
+	if p.report != nil {
+		p.event.Rows++
+		p.event.Pages = pdf.PageNo()
+		p.report(p.event)
+	}
+}
+
+// canceled returns the error of the job's context if it is done, and
+// nil otherwise.
+func (p *progress) canceled() error {
+	if p.ctx == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
+
+// done reports the end of rendering.
+func (p *progress) done(pdf *Fpdf) {
+	if p.report != nil {
+		p.event.Pages, p.event.Done = pdf.PageCount(), true
+		p.report(p.event)
+	}
+}
+
+// recoverRender converts a panic into a RenderError stored in *err. It
+// must be called via defer.
+func (p *progress) recoverRender(err *error) {
+	if v := recover(); v != nil {
+		*err = &RenderError{Section: p.section, Row: p.row, Value: v, Stack: debug.Stack()}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderPanic(t *testing.T) {
+	tests := []struct {
+		hooks *RenderHooks
+		want  string
+		row   int
+	}{
+		{&RenderHooks{OnRow: func(pdf *Fpdf, hc HookContext) {
+			if hc.Line[0] == "Pears" {
+				panic("no pears")
+			}
+		}}, "panic while rendering table, row 2: no pears", 1},
+		{&RenderHooks{OnRow: func(pdf *Fpdf, hc HookContext) {
+			_ = hc.Line[9]
+		}}, "panic while rendering table, row 1: runtime error: index out of range", 0},
+		{&RenderHooks{OnFinish: func(pdf *Fpdf, hc HookContext) {
+			panic(errors.New("out of ink"))
+		}}, "out of ink", -1},
+	}
+	for _, tt := range tests {
+		env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\nPears,20\n"})
+		env.Hooks = tt.hooks
+		err := generate(env, &Job{Input: "in.csv", Output: "out.pdf"})
+		var re *RenderError
+		if !errors.As(err, &re) {
+			t.Errorf("%v is no RenderError", err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) || len(re.Stack) == 0 {
+			t.Errorf("%v, want %q with a stack trace", err, tt.want)
+		}
+		if re.Row != tt.row {
+			t.Errorf("%v: row %d, want %d", err, re.Row, tt.row)
+		}
+		if exitCode(err) != exitRender {
+			t.Errorf("%v: exit code %d, want %d", err, exitCode(err), exitRender)
+		}
+		if _, err := env.FS.Open("out.pdf"); err == nil {
+			t.Errorf("%v: the report was written", tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// ## Shared resources
+
+// In split mode, with recipients, and in daemon mode, one process
+// renders many documents, and every one of them reads the same fonts,
+// the same logo, and the same stationery. The grayscale ones convert the
+// logo to gray, and the direct engine decodes it -- the same work, over
+// and over again. With 500 customers, converting the logo took longer
+// than everything else together.
+//
+// The resource cache of the Env keeps these files in memory for the
+// lifetime of the process, along with what is made of them, so that
+// each is read and converted only once. With a memory budget, it keeps
+// no more than an eighth of the budget holds: when it grows larger, the
+// files that were used least recently are dropped, and read and
+// converted again if they come up again. A file that changes is read
+// again: file systems that know when a file was modified (see
+// `ModTimeFS`) are asked before each use, so that a daemon picks up a
+// new logo with its next run. Files of other file systems are read once.
+// The input and the configuration are read anew for each run.
+//
+// gofpdf still parses the fonts and the logo for each document, as it
+// offers no way to share them between documents.
+
+// ResourceCache keeps the files that documents share in memory.
+type ResourceCache struct {
+	mu    sync.Mutex
+	files map[string]*resource
+	limit int64  // the most bytes to keep, or 0 for no limit
+	size  int64  // the bytes kept
+	uses  uint64 // counts the uses of files
+}
+
+// resource is a cached file, and what has been made of it, by kind.
+type resource struct {
+	modTime time.Time
+	data    []byte
+	made    map[string]interface{}
+	size    int64  // of data and what has been made of it
+	used    uint64 // the count of uses at its last use
+}
+
+// NewResourceCache returns an empty ResourceCache.
+func NewResourceCache() *ResourceCache {
+	return &ResourceCache{files: map[string]*resource{}}
+}
+
+// get returns the cached file, which it reads if it is not cached or
+// has changed. The caller holds rc.mu.
+func (rc *ResourceCache) get(fsys FileSystem, name string) (*resource, error) {
+	var modTime time.Time
+	if mfs, ok := fsys.(ModTimeFS); ok {
+		t, err := mfs.ModTime(name)
+		if err != nil {
+			return nil, err
+		}
+		modTime = t
+	}
+	rc.uses++
+	if r, ok := rc.files[name]; ok && r.modTime.Equal(modTime) {
+		r.used = rc.uses
+		return r, nil
+	}
+	data, err := readFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := rc.files[name]; ok {
+		rc.size -= old.size
+	}
+	r := &resource{modTime: modTime, data: data, made: map[string]interface{}{}, used: rc.uses}
+	rc.files[name] = r
+	rc.grow(r, int64(len(data)))
+	return r, nil
+}
+
+// grow adds n bytes to the size of r, and trims the cache for it.
+// The caller holds rc.mu.
+func (rc *ResourceCache) grow(r *resource, n int64) {
+	r.size += n
+	rc.size += n
+	rc.trim(r)
+}
+
+// trim drops the files that were used least recently, but not keep,
+// until the cache is within its limit. The caller holds rc.mu.
+func (rc *ResourceCache) trim(keep *resource) {
+	for rc.limit > 0 && rc.size > rc.limit {
+		var oldest string
+		for name, f := range rc.files {
+			if f != keep && (oldest == "" || f.used < rc.files[oldest].used) {
+				oldest = name
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		rc.size -= rc.files[oldest].size
+		delete(rc.files, oldest)
+	}
+}
+
+// setLimit limits the cache to n bytes, or lifts the limit if n is 0.
+func (rc *ResourceCache) setLimit(n int64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.limit = n
+	rc.trim(nil)
+}
+
+// madeSize estimates the bytes that v, made of a file of n bytes, takes.
+func madeSize(v interface{}, n int) int64 {
+	switch v := v.(type) {
+	case []byte:
+		return int64(len(v))
+	case *directPicture:
+		return int64(len(v.rgb) + len(v.alpha))
+	}
+	return int64(n)
+}
+
+// file returns the contents of the named file. The caller must not
+// modify them. Without a cache, it reads the file.
+func (rc *ResourceCache) file(fsys FileSystem, name string) ([]byte, error) {
+	if rc == nil {
+		return readFile(fsys, name)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	r, err := rc.get(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.data, nil
+}
+
+// derive returns what fn makes of the contents of the named file, which
+// is cached by kind along with the file. The caller must not modify it.
+func (rc *ResourceCache) derive(fsys FileSystem, name, kind string, fn func([]byte) (interface{}, error)) (interface{}, error) {
+	if rc == nil {
+		data, err := readFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return fn(data)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	r, err := rc.get(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := r.made[kind]; ok {
+		return v, nil
+	}
+	v, err := fn(r.data)
+	if err != nil {
+		return nil, err
+	}
+	r.made[kind] = v
+	rc.grow(r, madeSize(v, len(r.data)))
+	return v, nil
+}
+
+// resourceFS reads files through a resource cache.
+type resourceFS struct {
+	FileSystem
+	cache *ResourceCache
+}
+
+func (fs resourceFS) Open(name string) (io.ReadCloser, error) {
+	data, err := fs.cache.file(fs.FileSystem, name)
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// resources returns the file system of env for files that documents
+// share, such as fonts: one that keeps them in the resource cache, if
+// env has one.
+func (env *Env) resources() FileSystem {
+	if env.Resources == nil {
+		return env.FS
+	}
+	return resourceFS{env.FS, env.Resources}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// countingFS counts the files opened on a file system.
+type countingFS struct {
+	FileSystem
+	opened map[string]int
+}
+
+func (c *countingFS) Open(name string) (io.ReadCloser, error) {
+	c.opened[name]++
+	return c.FileSystem.Open(name)
+}
+
+func TestResourceCache(t *testing.T) {
+	fsys := &countingFS{NewMemFS(map[string][]byte{"logo.png": []byte("logo")}), map[string]int{}}
+	rc := NewResourceCache()
+	made := 0
+	upper := func(data []byte) (interface{}, error) {
+		made++
+		return append([]byte("LOGO:"), data...), nil
+	}
+	for i := 0; i < 3; i++ {
+		if data, err := rc.file(fsys, "logo.png"); err != nil || string(data) != "logo" {
+			t.Fatalf("file: %q, %v", data, err)
+		}
+		if v, err := rc.derive(fsys, "logo.png", "upper", upper); err != nil || string(v.([]byte)) != "LOGO:logo" {
+			t.Fatalf("derive: %v, %v", v, err)
+		}
+	}
+	if fsys.opened["logo.png"] != 1 || made != 1 {
+		t.Errorf("read %d times, made %d times", fsys.opened["logo.png"], made)
+	}
+	if rc.size != int64(len("logo")+len("LOGO:logo")) {
+		t.Errorf("size %d", rc.size)
+	}
+
+	// Failures are not cached.
+	fail := func([]byte) (interface{}, error) {
+		made++
+		return nil, errors.New("broken")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := rc.derive(fsys, "logo.png", "fail", fail); err == nil || err.Error() != "broken" {
+			t.Errorf("derive: %v", err)
+		}
+	}
+	if _, err := rc.file(fsys, "missing.png"); err == nil {
+		t.Error("a missing file is read")
+	}
+	if made != 3 || len(rc.files) != 1 {
+		t.Errorf("made %d times, %d files", made, len(rc.files))
+	}
+
+	// Without a cache, every use reads the file.
+	var none *ResourceCache
+	none.file(fsys, "logo.png")
+	none.derive(fsys, "logo.png", "upper", upper)
+	if fsys.opened["logo.png"] != 3 || made != 4 {
+		t.Errorf("without a cache: read %d times, made %d times", fsys.opened["logo.png"], made)
+	}
+}
+
+func TestResourceCacheModTime(t *testing.T) {
+	mem := NewMemFS(map[string][]byte{"logo.png": []byte("old")})
+	times := map[string]time.Time{"logo.png": testTime}
+	counter := &countingFS{mem, map[string]int{}}
+	fsys := modTimeFS{counter, times}
+	rc := NewResourceCache()
+	rc.derive(fsys, "logo.png", "size", func(data []byte) (interface{}, error) { return len(data), nil })
+	rc.file(fsys, "logo.png")
+
+	// A file that changes is read again, and what was made of it is
+	// made again.
+	mem.files["logo.png"] = []byte("newer")
+	times["logo.png"] = testTime.Add(time.Minute)
+	v, _ := rc.derive(fsys, "logo.png", "size", func(data []byte) (interface{}, error) { return len(data), nil })
+	if v != 5 || counter.opened["logo.png"] != 2 {
+		t.Errorf("size %v, read %d times", v, counter.opened["logo.png"])
+	}
+	if rc.size != 5+5 {
+		t.Errorf("size %d, want 10", rc.size)
+	}
+	delete(times, "logo.png")
+	if _, err := rc.file(fsys, "logo.png"); err == nil {
+		t.Error("a file without a modification time is read")
+	}
+}
+
+func TestResourceCacheLimit(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{"a": []byte("aaaa"), "b": []byte("bbbb"), "c": []byte("cccc"), "big": make([]byte, 20)})
+	rc := NewResourceCache()
+	rc.setLimit(10)
+	cached := func() []string {
+		var names []string
+		for name := range rc.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// The file used least recently goes first.
+	rc.file(fsys, "a")
+	rc.file(fsys, "b")
+	rc.file(fsys, "a")
+	rc.file(fsys, "c")
+	if got := cached(); !reflect.DeepEqual(got, []string{"a", "c"}) || rc.size != 8 {
+		t.Errorf("cached %v, %d bytes", got, rc.size)
+	}
+	// What is made of a file counts towards the limit.
+	rc.derive(fsys, "c", "copy", func(data []byte) (interface{}, error) { return append([]byte(nil), data...), nil })
+	if got := cached(); !reflect.DeepEqual(got, []string{"c"}) || rc.size != 8 {
+		t.Errorf("cached %v, %d bytes", got, rc.size)
+	}
+	// A file larger than the limit is kept until the next one comes.
+	if data, err := rc.file(fsys, "big"); err != nil || len(data) != 20 {
+		t.Fatalf("big: %d bytes, %v", len(data), err)
+	}
+	if got := cached(); !reflect.DeepEqual(got, []string{"big"}) {
+		t.Errorf("cached %v", got)
+	}
+	rc.file(fsys, "a")
+	if got := cached(); !reflect.DeepEqual(got, []string{"a"}) || rc.size != 4 {
+		t.Errorf("cached %v, %d bytes", got, rc.size)
+	}
+	rc.setLimit(0)
+	rc.file(fsys, "big")
+	rc.file(fsys, "b")
+	if got := cached(); len(got) != 3 || rc.size != 28 {
+		t.Errorf("without a limit: cached %v, %d bytes", got, rc.size)
+	}
+	rc.setLimit(5)
+	if got := cached(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("a new limit: cached %v", got)
+	}
+}
+
+func TestSharedResources(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\n",
+		"font.ttf": testFont(t, "DejaVuSansCondensed.ttf"),
+		"cfg.json": `{"fonts": {"": "font.ttf", "B": "font.ttf"}}`,
+	})
+	fsys := &countingFS{env.FS, map[string]int{}}
+	env.FS = fsys
+	env.Resources = NewResourceCache()
+	for _, out := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: out, Grayscale: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The input and the configuration are read for each document.
+	want := map[string]int{"in.csv": 3, "cfg.json": 3, "font.ttf": 1, "stats.png": 1}
+	for name, n := range want {
+		if fsys.opened[name] != n {
+			t.Errorf("%s read %d times, want %d", name, fsys.opened[name], n)
+		}
+	}
+	if _, ok := env.Resources.files["stats.png"].made["gray"]; !ok {
+		t.Error("the gray logo is not cached")
+	}
+}
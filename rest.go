@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## REST data source
+
+// Scheduled reports should show live data rather than yesterday's CSV
+// dump. A RESTSource fetches a JSON array of objects from an HTTP
+// endpoint, following offset or cursor pagination, and turns it into
+// records.
+
+// RESTSource describes a JSON REST endpoint.
+type RESTSource struct {
+	URL string `json:"url"`
+
+	// Headers are sent with every request, e.g. "Authorization". Values
+	// may reference environment variables as $NAME or ${NAME}, so that
+	// secrets need not be stored in the configuration.
+	Headers map[string]string `json:"headers"`
+
+	// Path leads to the array of objects in the response, as
+	// dot-separated keys, e.g. "data.items". Empty if the response is
+	// the array itself.
+	Path string `json:"path"`
+
+	// Columns are the object fields to print, in order. Default: all
+	// fields of the first object, sorted by name.
+	Columns []string `json:"columns"`
+
+	Pagination *Pagination `json:"pagination"`
+}
+
+// Pagination describes how to fetch further pages.
+type Pagination struct {
+	// Type is "offset" or "cursor".
+	Type string `json:"type"`
+
+	// OffsetParam and LimitParam name the query parameters for offset
+	// pagination. Default: "offset" and "limit".
+	OffsetParam string `json:"offsetParam"`
+	LimitParam  string `json:"limitParam"`
+
+	// Limit is the page size for offset pagination. Default: 100.
+	Limit int `json:"limit"`
+
+	// CursorParam names the query parameter that receives the cursor.
+	// Default: "cursor".
+	CursorParam string `json:"cursorParam"`
+
+	// CursorPath leads to the next cursor in the response. An empty or
+	// missing cursor ends the pagination.
+	CursorPath string `json:"cursorPath"`
+
+	// MaxPages guards against endless pagination. Default: 1000.
+	MaxPages int `json:"maxPages"`
+}
+
+var restClient = &http.Client{Timeout: 30 * time.Second}
+
+// load fetches all pages and returns the column names followed by one
+// record per object.
+func (s *RESTSource) load(ctx context.Context) ([][]string, error) {
+	var items []interface{}
+	p := s.Pagination
+	if p == nil {
+		page, err := s.fetch(ctx, s.URL)
+		if err != nil {
+			return nil, err
+		}
+		items, err = jsonArray(page, s.Path)
+		if err != nil {
+			return nil, err
+		}
+		return s.records(items), nil
+	}
+
+	maxPages := p.MaxPages
+	if maxPages <= 0 {
+		maxPages = 1000
+	}
+	offset, cursor := 0, ""
+	for n := 0; ; n++ {
+		if n == maxPages {
+			return nil, fmt.Errorf("more than %d pages", maxPages)
+		}
+		u, err := p.pageURL(s.URL, offset, cursor)
+		if err != nil {
+			return nil, err
+		}
+		page, err := s.fetch(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := jsonArray(page, s.Path)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+
+		switch p.Type {
+		case "offset":
+			if len(batch) < p.limit() {
+				return s.records(items), nil
+			}
+			offset += len(batch)
+		case "cursor":
+			next, _ := jsonLookup(page, p.CursorPath)
+			cursor = jsonString(next)
+			if cursor == "" {
+				return s.records(items), nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown pagination type %q", p.Type)
+		}
+	}
+}
+
+func (p *Pagination) limit() int {
+	if p.Limit > 0 {
+		return p.Limit
+	}
+	return 100
+}
+
+// pageURL adds the pagination parameters to base.
+func (p *Pagination) pageURL(base string, offset int, cursor string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	switch p.Type {
+	case "offset":
+		q.Set(orDefault(p.OffsetParam, "offset"), strconv.Itoa(offset))
+		q.Set(orDefault(p.LimitParam, "limit"), strconv.Itoa(p.limit()))
+	case "cursor":
+		if cursor != "" {
+			q.Set(orDefault(p.CursorParam, "cursor"), cursor)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// fetch GETs u and decodes the JSON response.
+func (s *RESTSource) fetch(ctx context.Context, u string) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	var v interface{}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("GET %s: %s", u, err)
+	}
+	return v, nil
+}
+
+// records converts the objects to records, header first.
+func (s *RESTSource) records(items []interface{}) [][]string {
+	cols := s.Columns
+	if len(cols) == 0 && len(items) > 0 {
+		if obj, ok := items[0].(map[string]interface{}); ok {
+			for k := range obj {
+				cols = append(cols, k)
+			}
+			sort.Strings(cols)
+		}
+	}
+	records := [][]string{cols}
+	for _, item := range items {
+		obj, _ := item.(map[string]interface{})
+		record := make([]string, len(cols))
+		for i, c := range cols {
+			record[i] = jsonString(obj[c])
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// jsonLookup follows a dot-separated path of object keys and array
+// indexes through v.
+func jsonLookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonArray returns the array found at path.
+func jsonArray(v interface{}, path string) ([]interface{}, error) {
+	node, ok := jsonLookup(v, path)
+	if !ok {
+		return nil, fmt.Errorf("path %q not found in response", path)
+	}
+	arr, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("path %q does not lead to an array", path)
+	}
+	return arr, nil
+}
+
+// jsonString converts a JSON value to text. Nested objects and arrays
+// are printed as JSON.
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ## Exit codes and run summaries
+
+// A cron job or a CI pipeline wants to know more than "it failed". The
+// exit code tells what failed:
+//
+//	0  the reports were written
+//	1  anything else: a bad configuration, a missing file, a failed delivery
+//	2  the data failed validation: a schema that does not match the
+//	   input, columns that drifted with `"drift": "error"`, or invalid
+//	   rows with `"onError": "fail"`
+//	3  a report could not be rendered
+//
+// With `-summary-json`, the tool also writes a summary of the run to a
+// file, or to standard output for "-":
+//
+//	{"status": "ok", "exitCode": 0, "rowsRead": 300, "rowsSkipped": 12,
+//	 "rowsRendered": 288, "pages": 9, "warnings": [],
+//	 "reports": [{"output": "report.pdf", "rows": 288, "pages": 9}]}
+//
+// Skipped rows are those that date ranges, filters, and schema
+// validation sorted out. Warnings are the messages logged at level WARN,
+// whatever the log level.
+
+// Exit codes.
+const (
+	exitFailed  = 1
+	exitInvalid = 2
+	exitRender  = 3
+)
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode returns err with the exit code attached, or nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var ee *exitError
+	var re *RenderError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &ee):
+		return ee.code
+	case errors.As(err, &re):
+		return exitRender
+	}
+	return exitFailed
+}
+
+// runSummary describes the run of a job.
+type runSummary struct {
+	Status       string          `json:"status"` // "ok" or "failed"
+	ExitCode     int             `json:"exitCode"`
+	Error        string          `json:"error,omitempty"`
+	RowsRead     int             `json:"rowsRead"`
+	RowsSkipped  int             `json:"rowsSkipped"`
+	RowsRendered int             `json:"rowsRendered"`
+	Pages        int             `json:"pages"`
+	Warnings     []string        `json:"warnings"`
+	Reports      []reportSummary `json:"reports"`
+
+	mu    sync.Mutex
+	parts []*part
+}
+
+// reportSummary describes a report of the run.
+type reportSummary struct {
+	Output string `json:"output"`
+	Rows   int    `json:"rows"`
+	Pages  int    `json:"pages"`
+	Error  string `json:"error,omitempty"`
+}
+
+// recording returns a copy of env whose logger also records warnings
+// in the summary.
+func (s *runSummary) recording(env *Env) *Env {
+	e := *env
+	e.Log = env.Log.withWarnings(func(line string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.Warnings = append(s.Warnings, line)
+	})
+	return &e
+}
+
+// rows records the number of rows read and of those left after
+// filtering and validation.
+func (s *runSummary) rows(read, kept int) {
+	if s == nil {
+		return
+	}
+	s.RowsRead, s.RowsSkipped = read, read-kept
+}
+
+// add records the reports of the run.
+func (s *runSummary) add(parts ...*part) {
+	if s == nil {
+		return
+	}
+	s.parts = append(s.parts, parts...)
+}
+
+// write writes the summary for the outcome err to path.
+func (s *runSummary) write(env *Env, path string, err error) error {
+	s.ExitCode = exitCode(err)
+	s.Status = "ok"
+	if err != nil {
+		s.Status, s.Error = "failed", err.Error()
+	}
+	s.Reports = []reportSummary{}
+	for _, p := range s.parts {
+		r := reportSummary{Output: p.output, Rows: len(p.rows), Pages: p.pages}
+		if p.err != nil {
+			r.Error = p.err.Error()
+		}
+		s.RowsRendered += r.Rows
+		s.Pages += r.Pages
+		s.Reports = append(s.Reports, r)
+	}
+	sort.SliceStable(s.Reports, func(i, j int) bool { return s.Reports[i].Output < s.Reports[j].Output })
+	if s.Warnings == nil {
+		s.Warnings = []string{}
+	}
+	data, mErr := json.MarshalIndent(s, "", "  ")
+	if mErr != nil {
+		return mErr
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, mErr = env.Stdout.Write(data)
+		return mErr
+	}
+	f, mErr := env.FS.Create(path)
+	if mErr != nil {
+		return mErr
+	}
+	if _, mErr = f.Write(data); mErr != nil {
+		f.Close()
+		return mErr
+	}
+	return f.Close()
+}
+
+// summaryLine formats a log event for the summary.
+func summaryLine(msg string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%s", args[i], logfmtQuote(fmt.Sprint(logValue(args[i+1]))))
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRunSummary(t *testing.T) {
+	csv := "Region,Total\nNorth,1\nSouth,20\nEast,30\nWest,x\n"
+	tests := []struct {
+		config  string
+		filter  string
+		hooks   *RenderHooks
+		code    int
+		read    int
+		report  reportSummary // of a successful run
+		skipped int
+	}{
+		{`{"schema": {"onError": "reject", "columns": [{"name": "Total", "type": "int"}]}}`, "Total > 1", nil,
+			0, 4, reportSummary{Output: "out.pdf", Rows: 2, Pages: 1}, 2},
+		{`{"schema": {"onError": "fail", "columns": [{"name": "Total", "type": "int"}]}}`, "", nil, exitInvalid, 4, reportSummary{}, 0},
+		{`{}`, "", &RenderHooks{OnRow: func(pdf *Fpdf, hc HookContext) { panic("boom") }}, exitRender, 4, reportSummary{}, 0},
+		{`{"columns": [{"name": "Sum"}]}`, "", nil, exitFailed, 4, reportSummary{}, 0},
+	}
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		env := testEnv(map[string]string{"in.csv": csv, "cfg.json": tt.config})
+		env.Stdout = &stdout
+		env.Hooks = tt.hooks
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Filter: tt.filter, Summary: "-"})
+		if exitCode(err) != tt.code {
+			t.Errorf("%s: exit code %d (%v), want %d", tt.config, exitCode(err), err, tt.code)
+		}
+		var got runSummary
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v in %s", tt.config, err, stdout.Bytes())
+		}
+		status := "ok"
+		if err != nil {
+			status = "failed"
+			if got.Error != err.Error() {
+				t.Errorf("%s: summary error %q, want %q", tt.config, got.Error, err)
+			}
+		}
+		if got.Status != status || got.ExitCode != tt.code || got.RowsRead != tt.read || got.Warnings == nil {
+			t.Errorf("%s: summary %s", tt.config, stdout.Bytes())
+		}
+		if err != nil {
+			continue
+		}
+		r := tt.report
+		if got.RowsSkipped != tt.skipped || got.RowsRendered != r.Rows || got.Pages != r.Pages ||
+			len(got.Reports) != 1 || got.Reports[0] != r {
+			t.Errorf("%s: summary %s, want %d rows skipped and %+v", tt.config, stdout.Bytes(), tt.skipped, r)
+		}
+	}
+}
+
+func TestRunSummaryFile(t *testing.T) {
+	env := testEnv(map[string]string{"in.csv": "Region,Total\n"})
+	if err := generate(env, &Job{Input: "in.csv", Output: "out.pdf", Summary: "summary.json"}); err != nil {
+		t.Fatal(err)
+	}
+	summary := testFile(t, env, "summary.json")
+	for _, want := range []string{`"status": "ok"`, `"rowsRendered": 0`, `"warnings": []`, `"output": "out.pdf"`} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary lacks %s:\n%s", want, summary)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ## Rotated header names
+
+// A table of many narrow numeric columns has a problem with long column
+// names: the names are wider than the numbers below them. Rotated, they
+// fit. The header row grows as high as the longest rotated name needs:
+//
+//	"rotateHeader": {"angle": 90, "columns": ["Units sold", "Units returned"]}
+//
+// The angle is 90 (default, reading upwards) or 45 degrees. Without
+// columns, the names that are wider than their columns are rotated.
+// Automatic column widths ignore the names of the listed columns. Names
+// with a footnote marker are not rotated.
+
+// RotateHeaderConfig prints column names at an angle.
+type RotateHeaderConfig struct {
+	Angle   float64     `json:"angle"`
+	Columns []ColumnRef `json:"columns"`
+}
+
+func (rc *RotateHeaderConfig) prepare() error {
+	switch rc.Angle {
+	case 0:
+		rc.Angle = 90
+	case 45, 90:
+	default:
+		return fmt.Errorf("unsupported angle %g; use 45 or 90", rc.Angle)
+	}
+	return nil
+}
+
+func (rc *RotateHeaderConfig) resolve(hdr []string) error {
+	for i := range rc.Columns {
+		if err := rc.Columns[i].resolve(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listed reports whether column i is listed in Columns.
+func (rc *RotateHeaderConfig) listed(i int) bool {
+	if rc == nil {
+		return false
+	}
+	for _, ref := range rc.Columns {
+		if ref.Index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// rotated reports whether the name of column i is rotated. The current
+// font must be the header font.
+func (rc *RotateHeaderConfig) rotated(pdf Backend, cfg *Config, hdr []string, i int) bool {
+	if rc == nil || cfg.column(i).Footnote != "" {
+		return false
+	}
+	if len(rc.Columns) > 0 {
+		return rc.listed(i)
+	}
+	w := pdf.GetStringWidth(cfg.locale().print(hdr[i])) + 2*pdf.GetCellMargin()
+	return w > cfg.width(i)
+}
+
+// height returns the height of the header row: the height the longest
+// rotated name needs, but at least h. The current font must be the
+// header font.
+func (rc *RotateHeaderConfig) height(pdf Backend, cfg *Config, hdr []string, h float64) float64 {
+	if rc == nil {
+		return h
+	}
+	_, size := pdf.GetFontSize()
+	margin := pdf.GetCellMargin()
+	rad := rc.Angle * math.Pi / 180
+	for _, i := range cfg.columnOrder(len(hdr)) {
+		if !rc.rotated(pdf, cfg, hdr, i) {
+			continue
+		}
+		tw := pdf.GetStringWidth(cfg.locale().print(hdr[i]))
+		h = math.Max(h, tw*math.Sin(rad)+size*math.Cos(rad)+2*margin)
+	}
+	return h
+}
+
+// cell prints a header cell of width w and height h with a rotated
+// name. The name starts at the bottom of the cell: centered at 90
+// degrees, at the left at 45 degrees.
+func (rc *RotateHeaderConfig) cell(pdf Backend, w, h float64, str, border string, fill bool) {
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+	_, size := pdf.GetFontSize()
+	margin := pdf.GetCellMargin()
+
+	// The baseline is offset so that the letters, not the baseline,
+	// are centered.
+	ax, ay := x+w/2+0.3*size, y+h-margin
+	if rc.Angle == 45 {
+		ax = x + margin + 0.3*size
+	}
+	pdf.TransformBegin()
+	pdf.TransformRotate(rc.Angle, ax, ay)
+	pdf.Text(ax, ay, str)
+	pdf.TransformEnd()
+	pdf.SetXY(x+w, y)
+}
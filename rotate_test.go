@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRotateHeaderConfig(t *testing.T) {
+	for _, tt := range []struct {
+		angle, want float64
+	}{{0, 90}, {45, 45}, {90, 90}} {
+		rc := &RotateHeaderConfig{Angle: tt.angle}
+		if err := rc.prepare(); err != nil || rc.Angle != tt.want {
+			t.Errorf("angle %g: got %g, %v, want %g", tt.angle, rc.Angle, err, tt.want)
+		}
+	}
+	if err := (&RotateHeaderConfig{Angle: 30}).prepare(); err == nil {
+		t.Error("angle 30 is accepted")
+	}
+}
+
+func TestRotateHeaderHeight(t *testing.T) {
+	hdr := []string{"Item", "Units returned"}
+	fsys := NewMemFS(map[string][]byte{"cfg.json": []byte(`{"rotateHeader": {}, "columns": [{"name": "Units returned", "width": 15}]}`)})
+	cfg, err := loadConfig(fsys, "cfg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolve(hdr); err != nil {
+		t.Fatal(err)
+	}
+	pdf := newPDF("L", "mm", "Letter", "")
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 16)
+	rc := cfg.RotateHeader
+	if rc.rotated(pdf, cfg, hdr, 0) || !rc.rotated(pdf, cfg, hdr, 1) {
+		t.Error("not only the name that is wider than its column is rotated")
+	}
+	tw, margin := pdf.GetStringWidth("Units returned"), pdf.GetCellMargin()
+	if h := rc.height(pdf, cfg, hdr, 7); !approx(h, tw+2*margin) {
+		t.Errorf("90 degrees: height %g, want %g", h, tw+2*margin)
+	}
+	rc.Angle = 45
+	_, size := pdf.GetFontSize()
+	want := (tw + size) * math.Sqrt2 / 2
+	if h := rc.height(pdf, cfg, hdr, 7); !approx(h, want+2*margin) {
+		t.Errorf("45 degrees: height %g, want %g", h, want+2*margin)
+	}
+	if h := rc.height(pdf, cfg, hdr, 50); h != 50 {
+		t.Errorf("the header is %g high, not at least 50", h)
+	}
+
+	// Listed columns are rotated whatever their width; footnoted ones
+	// are not.
+	rc.Columns = []ColumnRef{{Index: 0}}
+	if !rc.rotated(pdf, cfg, hdr, 0) || rc.rotated(pdf, cfg, hdr, 1) {
+		t.Error("the listed columns are not the rotated ones")
+	}
+	cfg.Columns[0].Footnote = "Returned in March"
+	rc.Columns = []ColumnRef{{Index: 1}}
+	if rc.rotated(pdf, cfg, hdr, 1) {
+		t.Error("a name with a footnote is rotated")
+	}
+}
+
+func TestRotateHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want []string
+	}{
+		{"90", `{"rotateHeader": {}, "columns": [{"name": "Units returned", "width": 15}]}`,
+			[]string{"(Item)Tj", "0.00000 1.00000 -1.00000 0.00000 557.02201 221.43067 cm\nq 0.000 g BT 167.80 389.23 Td (Units returned) Tj"}},
+		{"45", `{"rotateHeader": {"angle": 45}, "columns": [{"name": "Units returned", "width": 15}]}`,
+			[]string{"(Item)Tj", "0.70711 0.70711 -0.70711 0.70711 "}},
+		{"listed", `{"rotateHeader": {"columns": ["Item"]}, "columns": [{"name": "Units returned", "width": 15}]}`,
+			[]string{"0.00000 1.00000 -1.00000 0.00000 ", "(Item) Tj", "(Units returned)Tj"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv(map[string]string{"in.csv": "Item,Units returned\na,1\n", "cfg.json": tt.cfg})
+			if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+				t.Fatal(err)
+			}
+			content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+			for _, s := range tt.want {
+				if !strings.Contains(content, s) {
+					t.Errorf("missing %q in\n%s", s, content)
+				}
+			}
+			if strings.Count(content, " cm\nq 0.000 g BT") != 1 {
+				t.Error("not one name is rotated")
+			}
+		})
+	}
+}
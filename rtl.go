@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// ## Right-to-left text
+
+// Customer names and addresses from our offices in the Middle East are
+// written in Arabic or Hebrew. Both scripts run from right to left, and
+// PDF knows nothing about that: it prints the characters of a string
+// from left to right, in the order in which they are stored. Before a
+// text is printed, we therefore
+//
+//   - replace Arabic letters with the shape they take at the start,
+//     in the middle, or at the end of a word, and
+//   - reorder the text from logical (stored) order into visual order, so
+//     that right-to-left words read correctly while numbers and Latin
+//     words inside them keep their left-to-right order.
+//
+// Neither works with the built-in Times font; configure a TrueType font
+// with Arabic or Hebrew letters, such as DejaVu Sans:
+//
+//	"fonts": {"": "DejaVuSans.ttf", "B": "DejaVuSans-Bold.ttf"},
+//	"direction": "rtl"
+//
+// In a right-to-left document, the table is mirrored: the first column
+// is printed on the right, and columns that would be left-aligned are
+// right-aligned and vice versa. Single columns can set their own
+// direction. Text that MultiCell wraps is reordered as a whole, so long
+// right-to-left paragraphs should be broken into lines explicitly.
+
+// checkDirection reports an unknown text direction.
+func checkDirection(dir string) error {
+	switch dir {
+	case "", "ltr", "rtl":
+		return nil
+	}
+	return fmt.Errorf("direction must be ltr or rtl")
+}
+
+// rtl reports whether the document is printed from right to left.
+func (c *Config) rtl() bool {
+	return c.locale().rtl
+}
+
+// columnOrder returns the indexes of n columns in the order in which
+// they are printed: all columns or, in a band of a frozen table, the
+// columns of the band.
+func (c *Config) columnOrder(n int) []int {
+	var order []int
+	if c.band != nil {
+		for _, i := range c.band {
+			if i < n {
+				order = append(order, i)
+			}
+		}
+	} else {
+		order = make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+	}
+	if c.rtl() {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+	return order
+}
+
+// mirrored returns the alignment of column cc, given its alignment in a
+// left-to-right table. Right-to-left columns swap left and right.
+func (c *Config) mirrored(cc ColumnConfig, align string) string {
+	if cc.Direction == "rtl" || (cc.Direction == "" && c.rtl()) {
+		switch align {
+		case "", "L":
+			return "R"
+		case "R":
+			return "L"
+		}
+	}
+	return align
+}
+
+// align returns the alignment of column cc: the configured one or else
+// def, mirrored for right-to-left columns.
+func (c *Config) align(cc ColumnConfig, def string) string {
+	if cc.Align != "" {
+		return cc.Align
+	}
+	return c.mirrored(cc, def)
+}
+
+// visual prepares text for printing in the given direction, "ltr" or
+// "rtl". With "", the direction is that of the document, or in
+// left-to-right documents that of the first letter. Text without
+// right-to-left letters is returned unchanged.
+func (l *locale) visual(text, dir string) string {
+	if strings.IndexFunc(text, isRTL) < 0 {
+		return text
+	}
+	rtl := dir == "rtl"
+	if dir == "" {
+		rtl = l.rtl || firstStrongRTL(text)
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = string(visualOrder(shapeArabic([]rune(line)), rtl))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// bidiClass returns the bidirectional character type of r.
+func bidiClass(r rune) bidi.Class {
+	p, _ := bidi.LookupRune(r)
+	return p.Class()
+}
+
+// isRTL reports whether r is a right-to-left letter: Hebrew, Arabic,
+// and their neighbors, including the Arabic presentation forms that
+// shapeArabic produces.
+func isRTL(r rune) bool {
+	c := bidiClass(r)
+	return c == bidi.R || c == bidi.AL
+}
+
+// firstStrongRTL reports whether the first letter of s is right-to-left.
+func firstStrongRTL(s string) bool {
+	for _, r := range s {
+		switch bidiClass(r) {
+		case bidi.R, bidi.AL:
+			return true
+		case bidi.L:
+			return false
+		}
+	}
+	return false
+}
+
+// visualOrder reorders one line of text from logical into visual order.
+// golang.org/x/text/unicode/bidi implements UAX #9, the Unicode
+// bidirectional algorithm, and splits the line into runs of either
+// direction. Without explicit embeddings, which table cells and
+// captions do not have, the runs are at levels 0 to 2, and the levels
+// tell how they are put together: runs at odd levels are reversed, and
+// brackets in them are mirrored.
+func visualOrder(text []rune, rtl bool) []rune {
+	s, dir := string(text), bidi.LeftToRight
+	if rtl {
+		dir = bidi.RightToLeft
+	} else {
+		// The bidi package takes the direction of the first letter for
+		// that of the line, unless it is right-to-left; a left-to-right
+		// mark makes it left-to-right.
+		s = "\u200e" + s
+	}
+	var p bidi.Paragraph
+	if _, err := p.SetString(s, bidi.DefaultDirection(dir)); err != nil {
+		return text
+	}
+	o, err := p.Order()
+	if err != nil || o.NumRuns() == 0 {
+		return text
+	}
+	levels := make([]int, 0, len(text))
+	out := make([]rune, 0, len(text))
+	afterRTL := false
+	for i := 0; i < o.NumRuns(); i++ {
+		run := o.Run(i)
+		runes := []rune(run.String())
+		if i == 0 && !rtl {
+			runes = runes[1:]
+		}
+		level := 0
+		switch {
+		case run.Direction() == bidi.RightToLeft:
+			level = 1
+		case rtl:
+			level = 2
+		}
+		// In left-to-right text, a number that follows right-to-left
+		// letters belongs to them, at level 2 (rules W7 and I1).
+		number := 0
+		if !rtl && afterRTL && level == 0 {
+			number = numberPrefix(runes)
+		}
+		for j, r := range runes {
+			if j < number {
+				levels = append(levels, 2)
+			} else {
+				levels = append(levels, level)
+			}
+			out = append(out, r)
+		}
+		afterRTL = level == 1
+	}
+
+	pairBrackets(out, levels)
+
+	// Mirror brackets (L4), then reverse every run at each level from
+	// the highest down to the lowest odd level (L2).
+	for i, r := range out {
+		if levels[i]%2 == 1 {
+			out[i] = []rune(bidi.ReverseString(string(r)))[0]
+		}
+	}
+	for level := 2; level >= 1; level-- {
+		for i := 0; i < len(out); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(out) && levels[j] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				out[a], out[b] = out[b], out[a]
+				levels[a], levels[b] = levels[b], levels[a]
+			}
+			i = j
+		}
+	}
+	return out
+}
+
+// pairBrackets gives a closing bracket the level of its opening
+// bracket, as rule N0 does. The bidi package misses pairs when the
+// closing bracket is followed by a number, as in "שלום [abc] 12", and
+// leaves the closing bracket and the space after it at the level of
+// the number. Neutrals after the bracket follow it if the next letter
+// or number runs in the bracket's direction (rule N1).
+func pairBrackets(text []rune, levels []int) {
+	var open []int
+	for c, r := range text {
+		p, _ := bidi.LookupRune(r)
+		switch {
+		case p.IsOpeningBracket():
+			open = append(open, c)
+		case p.IsBracket():
+			i := len(open) - 1
+			for i >= 0 && bidi.ReverseString(string(text[open[i]])) != string(r) {
+				i--
+			}
+			if i < 0 {
+				continue
+			}
+			o := open[i]
+			open = open[:i]
+			if levels[c] == levels[o] {
+				continue
+			}
+			levels[c] = levels[o]
+			n := c + 1
+			for n < len(text) && isNeutral(bidiClass(text[n])) {
+				n++
+			}
+			if n == len(text) {
+				continue
+			}
+			nc := bidiClass(text[n])
+			rtl := levels[n]%2 == 1 || nc == bidi.EN || nc == bidi.AN
+			if rtl == (levels[o]%2 == 1) {
+				for k := c + 1; k < n; k++ {
+					levels[k] = levels[o]
+				}
+			}
+		}
+	}
+}
+
+// isNeutral reports whether c is a neutral type: spaces and other
+// punctuation that take the direction of their neighbors.
+func isNeutral(c bidi.Class) bool {
+	return c == bidi.WS || c == bidi.ON || c == bidi.B || c == bidi.S
+}
+
+// numberPrefix returns the length of the number that text starts with:
+// digits, with separators between them and currency and percent signs
+// next to them (rules W4 and W5).
+func numberPrefix(text []rune) int {
+	isNumber := func(i int) bool {
+		c := bidiClass(text[i])
+		return c == bidi.EN || c == bidi.AN
+	}
+	n := 0
+	for i := 0; i < len(text); n = i {
+		switch c := bidiClass(text[i]); {
+		case c == bidi.EN, c == bidi.AN:
+			i++
+		case c == bidi.ES || c == bidi.CS:
+			if i == 0 || i+1 == len(text) || !isNumber(i-1) || !isNumber(i+1) {
+				return n
+			}
+			i++
+		case c == bidi.ET:
+			j := i
+			for j < len(text) && bidiClass(text[j]) == bidi.ET {
+				j++
+			}
+			if (i == 0 || !isNumber(i-1)) && (j == len(text) || !isNumber(j)) {
+				return n
+			}
+			i = j
+		case c == bidi.NSM && i > 0:
+			i++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// ### Arabic shaping
+
+// Arabic letters connect to their neighbors and change their shape
+// accordingly. Fonts provide the shapes as "presentation forms", and
+// TrueType fonts without a shaping engine -- such as those in a PDF
+// printed by gofpdf -- need the text to use them directly.
+
+// arabicForm describes how an Arabic letter joins. Its presentation
+// forms follow each other in Unicode: isolated, final, and, for letters
+// that join on both sides, initial and medial.
+type arabicForm struct {
+	isolated rune
+	dual     bool // joins the following letter, too
+}
+
+// arabicForms lists the letters of the basic Arabic alphabet.
+var arabicForms = map[rune]arabicForm{
+	'ء': {0xfe80, false}, 'آ': {0xfe81, false}, 'أ': {0xfe83, false},
+	'ؤ': {0xfe85, false}, 'إ': {0xfe87, false}, 'ئ': {0xfe89, true},
+	'ا': {0xfe8d, false}, 'ب': {0xfe8f, true}, 'ة': {0xfe93, false},
+	'ت': {0xfe95, true}, 'ث': {0xfe99, true}, 'ج': {0xfe9d, true},
+	'ح': {0xfea1, true}, 'خ': {0xfea5, true}, 'د': {0xfea9, false},
+	'ذ': {0xfeab, false}, 'ر': {0xfead, false}, 'ز': {0xfeaf, false},
+	'س': {0xfeb1, true}, 'ش': {0xfeb5, true}, 'ص': {0xfeb9, true},
+	'ض': {0xfebd, true}, 'ط': {0xfec1, true}, 'ظ': {0xfec5, true},
+	'ع': {0xfec9, true}, 'غ': {0xfecd, true}, 'ف': {0xfed1, true},
+	'ق': {0xfed5, true}, 'ك': {0xfed9, true}, 'ل': {0xfedd, true},
+	'م': {0xfee1, true}, 'ن': {0xfee5, true}, 'ه': {0xfee9, true},
+	'و': {0xfeed, false}, 'ى': {0xfeef, false}, 'ي': {0xfef1, true},
+}
+
+// lamAlef maps the alef variants to the isolated form of their
+// ligature with a preceding lam, which is mandatory in Arabic.
+var lamAlef = map[rune]rune{'آ': 0xfef5, 'أ': 0xfef7, 'إ': 0xfef9, 'ا': 0xfefb}
+
+const tatweel = 'ـ' // the connecting stroke; joins on both sides
+
+// joinsNext reports whether r connects to the letter after it.
+func joinsNext(r rune) bool {
+	return arabicForms[r].dual || r == tatweel
+}
+
+// joins reports whether r connects to the letter before it. Hamza, the
+// only letter in arabicForms that joins neither side, has no final form.
+func joins(r rune) bool {
+	_, ok := arabicForms[r]
+	return (ok && r != 'ء') || r == tatweel
+}
+
+// shapeArabic replaces the Arabic letters of text, in logical order,
+// with their presentation forms. Vowel marks are transparent: they
+// neither join nor break a connection.
+func shapeArabic(text []rune) []rune {
+	neighbor := func(i, step int) rune {
+		for i += step; i >= 0 && i < len(text); i += step {
+			if !unicode.Is(unicode.Mn, text[i]) {
+				return text[i]
+			}
+		}
+		return 0
+	}
+	out := make([]rune, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		form, ok := arabicForms[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+		prev := joinsNext(neighbor(i, -1))
+		if lig, ok := lamAlef[neighbor(i, 1)]; ok && r == 'ل' {
+			if prev {
+				lig++
+			}
+			out = append(out, lig)
+			// Skip the alef, keeping any vowel marks in between.
+			for i++; unicode.Is(unicode.Mn, text[i]); i++ {
+				out = append(out, text[i])
+			}
+			continue
+		}
+		next := form.dual && joins(neighbor(i, 1))
+		switch {
+		case r == 'ء':
+			out = append(out, form.isolated)
+		case prev && next:
+			out = append(out, form.isolated+3)
+		case next:
+			out = append(out, form.isolated+2)
+		case prev:
+			out = append(out, form.isolated+1)
+		default:
+			out = append(out, form.isolated)
+		}
+	}
+	return out
+}
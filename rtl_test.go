@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVisual(t *testing.T) {
+	tests := []struct {
+		text, dir string
+		docRTL    bool
+		want      string
+	}{
+		{"Apples 12", "", true, "Apples 12"},
+		{"שלום", "rtl", false, "םולש"},
+		{"שלום abc 12", "rtl", false, "abc 12 םולש"},
+		{"שלום 12", "rtl", false, "12 םולש"},
+		{"שלום abc", "", false, "abc םולש"},
+		{"abc שלום", "", false, "abc םולש"},
+		{"abc שלום", "", true, "םולש abc"},
+		{"abc שלום", "ltr", true, "abc םולש"},
+		{"שלום (abc)", "rtl", false, "(abc) םולש"},
+		{"שלום [abc] 12", "rtl", false, "12 [abc] םולש"},
+		{"שלום\nעולם", "rtl", false, "םולש\nםלוע"},
+		{"سلام", "rtl", false, "ﻡﻼﺳ"},
+	}
+	for _, tt := range tests {
+		l := &locale{rtl: tt.docRTL}
+		if got := l.visual(tt.text, tt.dir); got != tt.want {
+			t.Errorf("visual(%q, %q) with rtl=%v = %q, want %q", tt.text, tt.dir, tt.docRTL, got, tt.want)
+		}
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		// Initial, medial, and final forms.
+		{"بيت", "ﺑﻴﺖ"},
+		// Alef does not join the next letter.
+		{"باب", "ﺑﺎﺏ"},
+		// Lam-alef ligatures, isolated and final.
+		{"لا", "ﻻ"},
+		{"سلا", "ﺳﻼ"},
+		// Vowel marks do not break a connection.
+		{"بَيت", "ﺑَﻴﺖ"},
+		// Hamza joins neither side.
+		{"ماء", "ﻣﺎﺀ"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := string(shapeArabic([]rune(tt.text))); got != tt.want {
+			t.Errorf("shapeArabic(%q) = %+q, want %+q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMirroredColumns(t *testing.T) {
+	cfg := &Config{Columns: []ColumnConfig{{Index: 1, Direction: "ltr"}, {Index: 2, Align: "L"}}, loc: &locale{rtl: true}}
+	if got, want := cfg.columnOrder(3), []int{2, 1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columnOrder = %v, want %v", got, want)
+	}
+	for i, want := range []string{"R", "L", "L"} {
+		if got := cfg.align(cfg.column(i), "L"); got != want {
+			t.Errorf("align(column %d) = %q, want %q", i, got, want)
+		}
+	}
+	if got := cfg.align(cfg.column(0), "R"); got != "L" {
+		t.Errorf("a right-aligned column in a right-to-left table is aligned %q", got)
+	}
+
+	cfg.band = []int{0, 2}
+	if got, want := cfg.columnOrder(3), []int{2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columnOrder of a band = %v, want %v", got, want)
+	}
+	if err := checkDirection("ttb"); err == nil {
+		t.Error("checkDirection accepts ttb")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ## Schema validation
+
+// Garbage in, garbage out. An optional schema describes what each column
+// must contain, and rows that break the rules are rejected, highlighted
+// in the table, or listed on an appendix page -- or they fail the run.
+
+// SchemaConfig describes the expected input columns.
+type SchemaConfig struct {
+	Columns []SchemaColumn `json:"columns"`
+
+	// OnError is "reject", "highlight", "appendix", or "fail". Default:
+	// "reject".
+	OnError string `json:"onError"`
+
+	// Drift is "warn" or "error" to compare the input columns with
+	// Columns; see driftCheck. Default: no comparison.
+	Drift string `json:"drift"`
+}
+
+// SchemaColumn describes a single column, found by its header name.
+type SchemaColumn struct {
+	Name string `json:"name"`
+
+	// Type is "string" (default), "int", "float", or "date".
+	Type string `json:"type"`
+
+	// Layout is the time.Parse layout for dates. Default: "2006-01-02".
+	Layout string `json:"layout"`
+
+	Required bool   `json:"required"`
+	Pattern  string `json:"pattern"`
+}
+
+// prepare checks the policies and the columns, so that a misspelled
+// setting fails the run before any row is read, not when the first row
+// breaks a rule.
+func (s *SchemaConfig) prepare() error {
+	switch s.OnError {
+	case "", "reject", "highlight", "appendix", "fail":
+	default:
+		return fmt.Errorf("onError must be reject, highlight, appendix, or fail")
+	}
+	switch s.Drift {
+	case "", "warn", "error":
+	default:
+		return fmt.Errorf("drift must be warn or error")
+	}
+	for _, sc := range s.Columns {
+		if sc.Name == "" {
+			return fmt.Errorf("a column has no name")
+		}
+		switch sc.Type {
+		case "", "string", "int", "float", "date":
+		default:
+			return fmt.Errorf("column %q: type must be string, int, float, or date", sc.Name)
+		}
+		if sc.Pattern != "" {
+			if _, err := regexp.Compile(sc.Pattern); err != nil {
+				return fmt.Errorf("column %q: %s", sc.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rowIssue lists everything that is wrong with a data row.
+type rowIssue struct {
+	Row      int // index into the data rows
+	Messages []string
+}
+
+// validate checks all rows against the schema and returns the issues
+// found, in row order.
+func (s *SchemaConfig) validate(hdr []string, rows [][]string) ([]rowIssue, error) {
+	type check struct {
+		col     int
+		sc      SchemaColumn
+		pattern *regexp.Regexp
+	}
+	var checks []check
+	for _, sc := range s.Columns {
+		col := indexOf(hdr, sc.Name)
+		if col < 0 && s.Drift == "warn" {
+			// The drift check warned about it.
+			continue
+		}
+		if col < 0 {
+			return nil, fmt.Errorf("schema column %q not found in header", sc.Name)
+		}
+		c := check{col: col, sc: sc}
+		if sc.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + sc.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("schema column %q: %s", sc.Name, err)
+			}
+			c.pattern = re
+		}
+		checks = append(checks, c)
+	}
+
+	var issues []rowIssue
+	for r, line := range rows {
+		var msgs []string
+		for _, c := range checks {
+			str := ""
+			if c.col < len(line) {
+				str = strings.TrimSpace(line[c.col])
+			}
+			if msg := c.sc.check(str, c.pattern); msg != "" {
+				msgs = append(msgs, c.sc.Name+": "+msg)
+			}
+		}
+		if msgs != nil {
+			issues = append(issues, rowIssue{Row: r, Messages: msgs})
+		}
+	}
+	return issues, nil
+}
+
+// check returns a description of what is wrong with str, or "".
+func (sc SchemaColumn) check(str string, pattern *regexp.Regexp) string {
+	if str == "" {
+		if sc.Required {
+			return "value is required"
+		}
+		return ""
+	}
+	var err error
+	switch sc.Type {
+	case "", "string":
+	case "int":
+		_, err = strconv.Atoi(str)
+	case "float":
+		_, err = strconv.ParseFloat(str, 64)
+	case "date":
+		layout := sc.Layout
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		_, err = time.Parse(layout, str)
+	default:
+		return fmt.Sprintf("unknown type %q", sc.Type)
+	}
+	if err != nil {
+		return fmt.Sprintf("%q is not a valid %s", str, sc.Type)
+	}
+	if pattern != nil && !pattern.MatchString(str) {
+		return fmt.Sprintf("%q does not match %s", str, sc.Pattern)
+	}
+	return ""
+}
+
+// apply validates rows and handles invalid rows according to the
+// OnError policy. It returns the rows to print, the indexes (into the
+// returned rows) of rows to highlight, and the issues for the appendix.
+func (s *SchemaConfig) apply(hdr []string, rows [][]string) ([][]string, map[int]bool, []rowIssue, error) {
+	issues, err := s.validate(hdr, rows)
+	if err != nil || len(issues) == 0 {
+		return rows, nil, nil, err
+	}
+	switch s.OnError {
+	case "", "reject":
+		bad := map[int]bool{}
+		for _, is := range issues {
+			bad[is.Row] = true
+		}
+		var valid [][]string
+		for r, line := range rows {
+			if !bad[r] {
+				valid = append(valid, line)
+			}
+		}
+		return valid, nil, nil, nil
+	case "highlight":
+		marked := map[int]bool{}
+		for _, is := range issues {
+			marked[is.Row] = true
+		}
+		return rows, marked, nil, nil
+	case "appendix":
+		return rows, nil, issues, nil
+	case "fail":
+		is := issues[0]
+		return nil, nil, nil, fmt.Errorf("%d invalid rows; row %d: %s", len(issues), is.Row+1, strings.Join(is.Messages, "; "))
+	}
+	return nil, nil, nil, fmt.Errorf("unknown schema error policy %q", s.OnError)
+}
+
+// errorAppendix adds a page that lists all invalid rows.
+func errorAppendix(pdf *Fpdf, issues []rowIssue, cfg *Config) *Fpdf {
+	if len(issues) == 0 {
+		return pdf
+	}
+	loc := cfg.locale()
+	addPage(pdf, cfg.Orientation.of("appendix"))
+	pdf.SetFont("Times", "B", 20)
+	pdf.Cell(40, 10, loc.text("dataErrors"))
+	if fresh := cfg.Freshness; fresh != nil {
+		pdf.Ln(10)
+		fresh.stamp(pdf, 0, "L", fresh.data)
+		pdf.Ln(4)
+	} else {
+		pdf.Ln(14)
+	}
+	for _, is := range issues {
+		pdf.SetFont("Times", "B", 12)
+		pdf.CellFormat(30, 6, loc.text("row", is.Row+1), "", 0, "", false, 0, "")
+		pdf.SetFont("Times", "", 12)
+		pdf.MultiCell(0, 6, loc.print(strings.Join(is.Messages, "\n")), "", "", false)
+	}
+	return pdf
+}
+
+// indexOf returns the index of name in hdr, or -1.
+func indexOf(hdr []string, name string) int {
+	for i, h := range hdr {
+		if h == name {
+			return i
+		}
+	}
+	return -1
+}
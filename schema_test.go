@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaPrepare(t *testing.T) {
+	tests := []struct {
+		schema SchemaConfig
+		want   string // "" if the schema is valid
+	}{
+		{SchemaConfig{}, ""},
+		{SchemaConfig{OnError: "appendix", Drift: "warn", Columns: []SchemaColumn{
+			{Name: "ID", Type: "int", Required: true}, {Name: "Day", Type: "date"}, {Name: "Code", Pattern: "[A-Z]{3}"}}}, ""},
+		{SchemaConfig{OnError: "rejected"}, "schema: onError must be reject, highlight, appendix, or fail"},
+		{SchemaConfig{Drift: "ignore"}, "schema: drift must be warn or error"},
+		{SchemaConfig{Columns: []SchemaColumn{{Name: "ID", Type: "integer"}}}, `schema: column "ID": type must be string, int, float, or date`},
+		{SchemaConfig{Columns: []SchemaColumn{{Name: "Code", Pattern: "[A-Z"}}}, `schema: column "Code": error parsing regexp`},
+		{SchemaConfig{Columns: []SchemaColumn{{Type: "int"}}}, "schema: a column has no name"},
+	}
+	for i, tt := range tests {
+		s := tt.schema
+		err := (&Config{Schema: &s}).prepare()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("schema %d: %v", i, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("schema %d: prepare = %v, want an error with %q", i, err, tt.want)
+		}
+	}
+}
+
+func TestSchemaApply(t *testing.T) {
+	hdr := []string{"ID", "Day", "Code", "Amount"}
+	rows := [][]string{
+		{"1", "2024-01-02", "ABC", "1.5"},
+		{"x", "2024-01-02", "ABC", "2"},
+		{"3", "02.01.2024", "abc", "3"},
+		{"", "2024-01-03", "DEF", "four"},
+		{"5", "", "GHI", ""},
+	}
+	columns := []SchemaColumn{
+		{Name: "ID", Type: "int", Required: true},
+		{Name: "Day", Type: "date"},
+		{Name: "Code", Pattern: "[A-Z]{3}"},
+		{Name: "Amount", Type: "float"},
+	}
+	wantIssues := []rowIssue{
+		{1, []string{`ID: "x" is not a valid int`}},
+		{2, []string{`Day: "02.01.2024" is not a valid date`, `Code: "abc" does not match [A-Z]{3}`}},
+		{3, []string{"ID: value is required", `Amount: "four" is not a valid float`}},
+	}
+	tests := []struct {
+		onError string
+		rows    int          // printed
+		marked  map[int]bool // highlighted
+		issues  []rowIssue   // on the appendix
+		err     string
+	}{
+		{"", 2, nil, nil, ""},
+		{"reject", 2, nil, nil, ""},
+		{"highlight", 5, map[int]bool{1: true, 2: true, 3: true}, nil, ""},
+		{"appendix", 5, nil, wantIssues, ""},
+		{"fail", 0, nil, nil, `3 invalid rows; row 2: ID: "x" is not a valid int`},
+	}
+	for _, tt := range tests {
+		s := &SchemaConfig{Columns: columns, OnError: tt.onError}
+		printed, marked, issues, err := s.apply(hdr, rows)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: apply = %v, want %q", tt.onError, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.onError, err)
+			continue
+		}
+		if len(printed) != tt.rows || !reflect.DeepEqual(marked, tt.marked) || !reflect.DeepEqual(issues, tt.issues) {
+			t.Errorf("%q: apply = %d rows, marked %v, issues %v; want %d rows, marked %v, issues %v",
+				tt.onError, len(printed), marked, issues, tt.rows, tt.marked, tt.issues)
+		}
+	}
+
+	// Clean data passes any policy.
+	s := &SchemaConfig{Columns: columns, OnError: "fail"}
+	if printed, _, _, err := s.apply(hdr, rows[:1]); err != nil || len(printed) != 1 {
+		t.Errorf("clean data: apply = %d rows, %v", len(printed), err)
+	}
+	s = &SchemaConfig{Columns: []SchemaColumn{{Name: "Missing"}}}
+	if _, _, _, err := s.apply(hdr, rows); err == nil {
+		t.Error("a missing schema column was not reported")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ## Sign-off
+
+// Our auditors want every daily report signed: the person who prepared
+// it and the person who approved it confirm, with name, date, and
+// signature, that they checked what the audit process asks them to
+// check. The sign-off block at the end of the report has room for that:
+//
+//	"signOff": {
+//	  "criteria": ["Totals agree with the ledger", "Outliers are explained"],
+//	  "signers": [
+//	    {"role": "Prepared by", "name": "{{param \"preparer\"}}"},
+//	    {"role": "Approved by"}
+//	  ]
+//	}
+//
+// The criteria come first, each with a box to tick. Then every signer
+// gets a line with their role, and below it lines for the name, the
+// date, and the signature. A name that is known is printed on its line;
+// like the title, the texts of the block may use parameters. The block
+// follows the endnotes and the form block, and is never split across
+// pages. Its title is "Sign-off" in the language of the report, unless
+// "title" says otherwise.
+//
+// By default, the block is meant for pen and paper. With "fillable",
+// the boxes and the lines for names and dates become fields of a PDF
+// form, and the signature lines signature fields, which Acrobat signs
+// digitally. Like other form fields, they cannot be part of tagged or
+// PDF/A documents.
+
+// SignOffConfig adds a sign-off block to the end of the report.
+type SignOffConfig struct {
+	// Title is printed above the block. Default: the "signOff" message.
+	Title string `json:"title"`
+
+	// Criteria are the statements that the signers confirm.
+	Criteria []string `json:"criteria"`
+
+	// Signers are the people who sign, in order.
+	Signers []Signer `json:"signers"`
+
+	// Fillable makes the boxes and lines fields of a PDF form.
+	Fillable bool `json:"fillable"`
+
+	fields map[string]int // form fields by name, if fillable
+}
+
+// Signer is a person who signs the report.
+type Signer struct {
+	// Role is what the signer does, such as "Approved by".
+	Role string `json:"role"`
+
+	// Name is printed on the name line. Default: an empty line.
+	Name string `json:"name"`
+}
+
+// Sizes of the sign-off block, in mm.
+const (
+	signOffLine      = 7  // the height of a line of text
+	signOffBox       = 5  // the size of the boxes of the criteria
+	signOffGap       = 6  // between the columns and the signers
+	signOffSignature = 15 // the space for a signature above its line
+	signOffCaption   = 4  // the caption below a line
+)
+
+func (so *SignOffConfig) prepare(c *Config) error {
+	if len(so.Criteria) == 0 && len(so.Signers) == 0 {
+		return errors.New("criteria or signers required")
+	}
+	for i, s := range so.Signers {
+		if s.Role == "" {
+			return fmt.Errorf("signer %d: role required", i+1)
+		}
+	}
+	if !so.Fillable {
+		return nil
+	}
+	if c.Tagged != nil {
+		return errors.New("fillable fields have no tags and cannot be part of a tagged PDF")
+	}
+	if c.Archive != nil {
+		return errors.New("fillable fields use fonts that are not embedded and cannot be part of a PDF/A document")
+	}
+
+	// The fields join those of the form, which writes them all.
+	if c.Form == nil {
+		c.Form = &FormConfig{}
+	}
+	so.fields = map[string]int{}
+	add := func(name, typ string, w, h float64) {
+		so.fields[name] = len(c.Form.Fields)
+		c.Form.Fields = append(c.Form.Fields, FormField{Name: name, Type: typ, Width: w, Height: h, signOff: true})
+	}
+	for i := range so.Criteria {
+		add(signOffField("Criterion", i), "checkbox", signOffBox, signOffBox)
+	}
+	for i, s := range so.Signers {
+		if s.Name == "" {
+			add(signOffField("Name", i), "text", 0, signOffLine)
+		}
+		add(signOffField("Date", i), "text", 0, signOffLine)
+		add(signOffField("Signature", i), "signature", 0, signOffSignature)
+	}
+	so.label(c)
+	return nil
+}
+
+// signOffField returns the name of the i-th form field of a kind.
+func signOffField(kind string, i int) string {
+	return "signOff" + kind + strconv.Itoa(i+1)
+}
+
+// label sets the labels of the form fields, which screen readers and
+// tooltips show.
+func (so *SignOffConfig) label(c *Config) {
+	loc := c.locale()
+	set := func(name, label string) {
+		if i, ok := so.fields[name]; ok {
+			c.Form.Fields[i].Label = label
+		}
+	}
+	for i, text := range so.Criteria {
+		set(signOffField("Criterion", i), text)
+	}
+	for i, s := range so.Signers {
+		set(signOffField("Name", i), s.Role+": "+loc.msg("name"))
+		set(signOffField("Date", i), s.Role+": "+loc.msg("date"))
+		set(signOffField("Signature", i), s.Role+": "+loc.msg("signature"))
+	}
+}
+
+// applyParams replaces the placeholders in the texts of the block.
+func (so *SignOffConfig) applyParams(c *Config, params map[string]string) error {
+	var err error
+	if so.Title, err = expandParams("signOff", so.Title, params); err != nil {
+		return err
+	}
+	for i := range so.Criteria {
+		if so.Criteria[i], err = expandParams("criterion", so.Criteria[i], params); err != nil {
+			return err
+		}
+	}
+	for i := range so.Signers {
+		s := &so.Signers[i]
+		if s.Role, err = expandParams("role", s.Role, params); err != nil {
+			return err
+		}
+		if s.Name, err = expandParams("name", s.Name, params); err != nil {
+			return err
+		}
+	}
+	if so.fields != nil {
+		so.label(c)
+	}
+	return nil
+}
+
+// signOffBlock prints the sign-off block and returns where its form
+// fields are, if it is fillable.
+func signOffBlock(pdf *Fpdf, cfg *Config) (*Fpdf, []formWidget) {
+	so := cfg.SignOff
+	if so == nil {
+		return pdf, nil
+	}
+	loc := cfg.locale()
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - left - right
+	align := cfg.mirrored(ColumnConfig{}, "L")
+
+	// at returns the left edge of something w wide, x mm from the start
+	// of the line, which is on the right in right-to-left reports.
+	at := func(x, w float64) float64 {
+		if cfg.rtl() {
+			return pageWidth - right - x - w
+		}
+		return left + x
+	}
+	var widgets []formWidget
+	field := func(name string, x, y, w, h float64) {
+		widgets = append(widgets, formWidget{field: so.fields[name], page: pdf.PageNo(), x: x, y: y, w: w, h: h})
+	}
+
+	signer := float64(signOffLine + signOffSignature + signOffCaption + signOffGap)
+	h := 14 + float64(len(so.Criteria))*signOffLine + float64(len(so.Signers))*signer
+	if h > spaceLeft(pdf) {
+		addPage(pdf, "")
+	}
+	pdf.Ln(4)
+	pdf.SetFont("Times", "B", 14)
+	pdf.CellFormat(0, 10, loc.print(orDefault(so.Title, loc.msg("signOff"))), "", 1, align, false, 0, "")
+
+	// Each criterion has a box to tick.
+	pdf.SetFont("Times", "", 12)
+	for i, text := range so.Criteria {
+		y := pdf.GetY()
+		x, top := at(0, signOffBox), y+(signOffLine-signOffBox)/2
+		if so.Fillable {
+			field(signOffField("Criterion", i), x, top, signOffBox, signOffBox)
+		} else {
+			pdf.Rect(x, top, signOffBox, signOffBox, "D")
+		}
+		pdf.SetXY(at(signOffBox+3, width-signOffBox-3), y)
+		pdf.CellFormat(width-signOffBox-3, signOffLine, loc.print(text), "", 0, align, false, 0, "")
+		pdf.SetXY(left, y+signOffLine)
+	}
+
+	// Each signer has a line for the name, a shorter one for the date,
+	// and a longer one for the signature, with room above it.
+	nameW := (width - 2*signOffGap) * 0.35
+	dateW := (width - 2*signOffGap) * 0.2
+	columns := []struct {
+		kind, caption string
+		x, w          float64
+	}{
+		{"Name", "name", 0, nameW},
+		{"Date", "date", nameW + signOffGap, dateW},
+		{"Signature", "signature", nameW + dateW + 2*signOffGap, width - nameW - dateW - 2*signOffGap},
+	}
+	for i, s := range so.Signers {
+		y := pdf.GetY() + signOffGap
+		pdf.SetXY(left, y)
+		pdf.SetFont("Times", "B", 12)
+		pdf.CellFormat(width, signOffLine, loc.print(s.Role), "", 0, align, false, 0, "")
+		line := y + signOffLine + signOffSignature
+		for _, c := range columns {
+			x := at(c.x, c.w)
+			pdf.Line(x, line, x+c.w, line)
+			pdf.SetXY(x, line)
+			pdf.SetFont("Times", "", 8)
+			pdf.SetTextColor(100, 100, 100)
+			pdf.CellFormat(c.w, signOffCaption, loc.text(c.caption), "", 0, align, false, 0, "")
+			pdf.SetTextColor(0, 0, 0)
+			switch {
+			case c.kind == "Name" && s.Name != "":
+				pdf.SetXY(x, line-signOffLine)
+				pdf.SetFont("Times", "", 12)
+				pdf.CellFormat(c.w, signOffLine, loc.print(s.Name), "", 0, align, false, 0, "")
+			case !so.Fillable:
+			case c.kind == "Signature":
+				field(signOffField(c.kind, i), x, line-signOffSignature, c.w, signOffSignature)
+			default:
+				field(signOffField(c.kind, i), x, line-signOffLine, c.w, signOffLine)
+			}
+		}
+		pdf.SetXY(left, line+signOffCaption)
+	}
+	pdf.SetFont("Times", "", 12)
+	return pdf, widgets
+}
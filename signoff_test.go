@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const signOffConfig = `"criteria": ["Totals agree with the ledger"],
+	"signers": [{"role": "Prepared by", "name": "{{param \"preparer\"}}"}, {"role": "Approved by"}]`
+
+func TestSignOffBlock(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\n",
+		"cfg.json": `{"signOff": {` + signOffConfig + `}}`,
+	})
+	job := &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Params: map[string]string{"preparer": "Ann Smith"}}
+	if err := generate(env, job); err != nil {
+		t.Fatal(err)
+	}
+	pdf := testFile(t, env, "out.pdf")
+	content := pageContents(t, []byte(pdf))
+	for _, want := range []string{"(Sign-off)", "(Totals agree with the ledger)", "(Prepared by)", "(Ann Smith)", "(Approved by)", "(Signature)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the sign-off block lacks %s", want)
+		}
+	}
+	if strings.Contains(pdf, "/AcroForm") {
+		t.Error("a paper sign-off block has form fields")
+	}
+}
+
+func TestSignOffFillable(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\n",
+		"cfg.json": `{"signOff": {"fillable": true, "title": "Approval", ` + signOffConfig + `}}`,
+	})
+	job := &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Params: map[string]string{"preparer": "Ann Smith"}}
+	if err := generate(env, job); err != nil {
+		t.Fatal(err)
+	}
+	pdf := testFile(t, env, "out.pdf")
+	if !strings.Contains(pageContents(t, []byte(pdf)), "(Approval)") {
+		t.Error("the block lacks its title")
+	}
+	for _, tt := range []struct {
+		name, label, typ string
+	}{
+		{"signOffCriterion1", "Totals agree with the ledger", "Btn"},
+		{"signOffDate1", "Prepared by: Date", "Tx"},
+		{"signOffSignature1", "Prepared by: Signature", "Sig"},
+		{"signOffName2", "Approved by: Name", "Tx"},
+		{"signOffDate2", "Approved by: Date", "Tx"},
+		{"signOffSignature2", "Approved by: Signature", "Sig"},
+	} {
+		re := regexp.MustCompile(`/T \(` + tt.name + `\) /TU \(` + regexp.QuoteMeta(tt.label) + `\) .*/FT /` + tt.typ + ` `)
+		if !re.MatchString(pdf) {
+			t.Errorf("the form lacks the %s field %s", tt.typ, tt.name)
+		}
+	}
+	// The preparer's name is known, so it needs no field.
+	if strings.Contains(pdf, "signOffName1") {
+		t.Error("a known name has a field")
+	}
+}
+
+func TestSignOffConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config, err string
+	}{
+		{`{"signOff": {}}`, "criteria or signers required"},
+		{`{"signOff": {"signers": [{"role": "Prepared by"}, {"name": "Bob"}]}}`, "signer 2: role required"},
+		{`{"signOff": {"fillable": true, "criteria": ["ok"]}, "tagged": {}}`, "cannot be part of a tagged PDF"},
+		{`{"signOff": {"fillable": true, "criteria": ["ok"]}, "archive": {}}`, "cannot be part of a PDF/A document"},
+	} {
+		env := testEnv(map[string]string{"in.csv": "Item,Total\nApples,10\n", "cfg.json": tt.config})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ## Layout snapshots
+
+// A PDF is hard to diff. To catch layout regressions between versions,
+// the computed layout can be written to a JSON file next to the PDF,
+// where a plain text diff shows every shifted column and page break.
+
+// layoutSnapshot describes the layout of the rendered table.
+type layoutSnapshot struct {
+	PageWidth  float64        `json:"pageWidth"`
+	PageHeight float64        `json:"pageHeight"`
+	Margins    [4]float64     `json:"margins"` // left, top, right, bottom
+	Columns    []layoutColumn `json:"columns"`
+	Rows       []layoutRow    `json:"rows"`
+	PageBreaks []pageBreak    `json:"pageBreaks"`
+	Pages      int            `json:"pages"`
+}
+
+type layoutColumn struct {
+	Name  string  `json:"name"`
+	Width float64 `json:"width"`
+}
+
+// layoutRow is the position of a table row on its page.
+type layoutRow struct {
+	Row    int     `json:"row"`
+	Page   int     `json:"page"`
+	Y      float64 `json:"y"`
+	Height float64 `json:"height"`
+}
+
+// pageBreak marks a table row that starts a new page.
+type pageBreak struct {
+	BeforeRow int `json:"beforeRow"`
+	Page      int `json:"page"`
+}
+
+// columns records the table columns.
+func (ls *layoutSnapshot) columns(hdr []string, cfg *Config) {
+	for _, i := range cfg.columnOrder(len(hdr)) {
+		ls.Columns = append(ls.Columns, layoutColumn{hdr[i], cfg.width(i)})
+	}
+	if cfg.Rank != nil {
+		rank := layoutColumn{cfg.Rank.title(cfg.locale()), rankWidth}
+		if cfg.rtl() {
+			ls.Columns = append(ls.Columns, rank)
+		} else {
+			ls.Columns = append([]layoutColumn{rank}, ls.Columns...)
+		}
+	}
+}
+
+// row records the position of a row that was just printed.
+func (ls *layoutSnapshot) row(pdf Backend, r int, h float64) {
+	page := pdf.PageNo()
+	if n := len(ls.Rows); n > 0 && ls.Rows[n-1].Page != page {
+		ls.PageBreaks = append(ls.PageBreaks, pageBreak{BeforeRow: r, Page: page})
+	}
+	ls.Rows = append(ls.Rows, layoutRow{Row: r, Page: page, Y: pdf.GetY(), Height: h})
+}
+
+// page records the geometry of the page the table starts on.
+func (ls *layoutSnapshot) page(pdf *Fpdf) {
+	ls.PageWidth, ls.PageHeight = pdf.GetPageSize()
+	l, t, r, b := pdf.GetMargins()
+	ls.Margins = [4]float64{l, t, r, b}
+}
+
+// finish records the page count.
+func (ls *layoutSnapshot) finish(pdf *Fpdf) {
+	ls.Pages = pdf.PageCount()
+}
+
+// snapshotPath returns the path of the layout file for a PDF path.
+func snapshotPath(pdfPath string) string {
+	return strings.TrimSuffix(pdfPath, ".pdf") + ".layout.json"
+}
+
+// saveSnapshot writes the layout as indented JSON, encrypted with key if
+// it is not nil.
+func saveSnapshot(ls *layoutSnapshot, fsys FileSystem, key []byte, path string) error {
+	data, err := json.MarshalIndent(ls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeArtifact(fsys, key, path, append(data, '\n'))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayoutSnapshot(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("Item,Total\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&csv, "Item %d,%d\n", i, i)
+	}
+	env := testEnv(map[string]string{
+		"in.csv":   csv.String(),
+		"cfg.json": `{"columns": [{"name": "Item", "width": 50}], "rank": {"column": "Total"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Snapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	var ls layoutSnapshot
+	if err := json.Unmarshal([]byte(testFile(t, env, "out.layout.json")), &ls); err != nil {
+		t.Fatal(err)
+	}
+	if want := []layoutColumn{{"Rank", rankWidth}, {"Item", 50}, {"Total", 40}}; !reflect.DeepEqual(ls.Columns, want) {
+		t.Errorf("columns %v, want %v", ls.Columns, want)
+	}
+	if ls.PageWidth <= ls.PageHeight || ls.Margins[0] < 10 || ls.Margins[0] > 10.01 {
+		t.Errorf("page %v x %v with margins %v, want landscape with 10 mm margins", ls.PageWidth, ls.PageHeight, ls.Margins)
+	}
+	if len(ls.Rows) != 40 || ls.Pages != 2 || len(ls.PageBreaks) != 1 {
+		t.Fatalf("%d rows on %d pages with breaks %v, want 40 rows and one break", len(ls.Rows), ls.Pages, ls.PageBreaks)
+	}
+	pb := ls.PageBreaks[0]
+	for i, r := range ls.Rows {
+		wantPage := 1
+		if i >= pb.BeforeRow {
+			wantPage = 2
+		}
+		if r.Row != i || r.Page != wantPage || r.Height <= 0 {
+			t.Errorf("row %d: %+v, want page %d", i, r, wantPage)
+		}
+		if i > 0 && r.Page == ls.Rows[i-1].Page && !approx(r.Y, ls.Rows[i-1].Y+r.Height) {
+			t.Errorf("row %d at %v follows row %d at %v", i, r.Y, i-1, ls.Rows[i-1].Y)
+		}
+		if r.Y > ls.PageHeight-ls.Margins[3]+0.01 {
+			t.Errorf("row %d ends at %v, below the bottom margin", i, r.Y)
+		}
+	}
+	if pb.Page != 2 || pb.BeforeRow < 10 {
+		t.Errorf("page break %+v", pb)
+	}
+}
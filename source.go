@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ## Data sources
+
+// The CSV file is just an export of data that lives elsewhere. Instead of
+// exporting the data first, the report can fetch it directly. A source
+// returns the same records as a CSV file, header first, so the rest of
+// the pipeline does not care where the data came from.
+
+// SourceConfig selects the data source. Exactly one field must be set.
+type SourceConfig struct {
+	SQL  *SQLSource  `json:"sql"`
+	REST *RESTSource `json:"rest"`
+}
+
+// prepare checks that exactly one source is set, and that it has what
+// it needs to fetch the data.
+func (s *SourceConfig) prepare() error {
+	switch {
+	case s.SQL == nil && s.REST == nil:
+		return errors.New("set sql or rest")
+	case s.SQL != nil && s.REST != nil:
+		return errors.New("set either sql or rest, not both")
+	case s.SQL != nil:
+		switch s.SQL.Driver {
+		case "postgres", "mysql", "sqlite3":
+		default:
+			return errors.New("sql: driver must be postgres, mysql, or sqlite3")
+		}
+		if s.SQL.Query == "" {
+			return errors.New("sql: query is required")
+		}
+	case s.REST.URL == "":
+		return errors.New("rest: url is required")
+	case s.REST.Pagination != nil:
+		switch s.REST.Pagination.Type {
+		case "offset", "cursor":
+		default:
+			return errors.New("rest: pagination type must be offset or cursor")
+		}
+	}
+	return nil
+}
+
+// load fetches the records from the configured source. It gives up
+// when ctx is done.
+func (s *SourceConfig) load(ctx context.Context) ([][]string, error) {
+	switch {
+	case s.SQL != nil:
+		return s.SQL.load(ctx)
+	case s.REST != nil:
+		return s.REST.load(ctx)
+	}
+	return nil, errors.New("no data source configured")
+}
+
+// SQLSource runs a query against a database.
+type SQLSource struct {
+	// Driver is "postgres", "mysql", or "sqlite3".
+	Driver string `json:"driver"`
+
+	// DSN is the driver-specific data source name.
+	DSN string `json:"dsn"`
+
+	Query string `json:"query"`
+}
+
+// load runs the query and returns the column names followed by all
+// result rows. NULL becomes an empty string.
+func (s *SQLSource) load(ctx context.Context) ([][]string, error) {
+	db, err := sql.Open(s.Driver, s.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rs, err := db.QueryContext(ctx, s.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	cols, err := rs.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := [][]string{cols}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rs.Next() {
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		record := make([]string, len(cols))
+		for i, v := range values {
+			record[i] = sqlString(v)
+		}
+		records = append(records, record)
+	}
+	return records, rs.Err()
+}
+
+// sqlString converts a scanned database value to text.
+func sqlString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSourcePrepare(t *testing.T) {
+	sql := &SQLSource{Driver: "sqlite3", DSN: ":memory:", Query: "SELECT 1"}
+	rest := &RESTSource{URL: "https://example.com/orders"}
+	tests := []struct {
+		source SourceConfig
+		want   string // "" if the source is valid
+	}{
+		{SourceConfig{SQL: sql}, ""},
+		{SourceConfig{REST: rest}, ""},
+		{SourceConfig{REST: &RESTSource{URL: "https://example.com", Pagination: &Pagination{Type: "cursor"}}}, ""},
+		{SourceConfig{}, "source: set sql or rest"},
+		{SourceConfig{SQL: sql, REST: rest}, "source: set either sql or rest, not both"},
+		{SourceConfig{SQL: &SQLSource{Driver: "oracle", Query: "SELECT 1"}}, "source: sql: driver must be postgres, mysql, or sqlite3"},
+		{SourceConfig{SQL: &SQLSource{Driver: "sqlite3"}}, "source: sql: query is required"},
+		{SourceConfig{REST: &RESTSource{}}, "source: rest: url is required"},
+		{SourceConfig{REST: &RESTSource{URL: "https://example.com", Pagination: &Pagination{Type: "page"}}},
+			"source: rest: pagination type must be offset or cursor"},
+	}
+	for i, tt := range tests {
+		s := tt.source
+		err := (&Config{Source: &s}).prepare()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("source %d: %v", i, err)
+		case tt.want != "" && (err == nil || err.Error() != tt.want):
+			t.Errorf("source %d: prepare = %v, want %q", i, err, tt.want)
+		}
+	}
+}
+
+func TestSQLSource(t *testing.T) {
+	s := &SQLSource{Driver: "sqlite3", DSN: ":memory:",
+		Query: "SELECT 'North' AS region, 12.5 AS total, 3 AS n UNION ALL SELECT 'East', NULL, 4"}
+	records, err := s.load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"region", "total", "n"}, {"North", "12.5", "3"}, {"East", "", "4"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("load = %q, want %q", records, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.load(ctx); err == nil {
+		t.Error("a canceled query did not fail")
+	}
+}
+
+func TestSQLSourceReport(t *testing.T) {
+	env := testEnv(map[string]string{"cfg.json": `{"source": {"sql": {"driver": "sqlite3", "dsn": ":memory:",
+		"query": "SELECT 'North' AS Region, 1200 AS Total"}}, "textVersion": {"format": "text"}}`})
+	if err := generate(env, &Job{Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if text := testFile(t, env, "out.txt"); !strings.Contains(text, "North    1200") {
+		t.Errorf("text version lacks the queried row:\n%s", text)
+	}
+}
+
+// restServer serves five orders, in pages by offset at /offset and by
+// cursor at /cursor, to clients with the token "secret".
+func restServer() *httptest.Server {
+	orders := []map[string]interface{}{
+		{"id": 1, "region": "North", "total": 12.5},
+		{"id": 2, "region": "East", "total": nil},
+		{"id": 3, "region": "South", "total": 7, "tags": []string{"a"}},
+		{"id": 4, "region": "West", "total": 3},
+		{"id": 5, "region": "North", "total": 1, "paid": true},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		var resp interface{}
+		switch r.URL.Path {
+		case "/offset":
+			offset, _ := strconv.Atoi(q.Get("skip"))
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			end := minInt(offset+limit, len(orders))
+			resp = map[string]interface{}{"data": map[string]interface{}{"items": orders[minInt(offset, end):end]}}
+		case "/cursor":
+			from, _ := strconv.Atoi(q.Get("cursor"))
+			next := ""
+			if from+2 < len(orders) {
+				next = strconv.Itoa(from + 2)
+			}
+			resp = map[string]interface{}{"items": orders[from:minInt(from+2, len(orders))], "meta": map[string]string{"next": next}}
+		case "/all":
+			resp = orders
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestRESTSource(t *testing.T) {
+	srv := restServer()
+	defer srv.Close()
+	defer os.Setenv("REST_TOKEN", os.Getenv("REST_TOKEN"))
+	os.Setenv("REST_TOKEN", "secret")
+	auth := map[string]string{"Authorization": "Bearer ${REST_TOKEN}"}
+
+	// The first object has no "tags" or "paid", so they are not columns
+	// by default.
+	all := [][]string{{"id", "region", "total"}, {"1", "North", "12.5"}, {"2", "East", ""}, {"3", "South", "7"}, {"4", "West", "3"}, {"5", "North", "1"}}
+	tests := []struct {
+		source RESTSource
+		want   [][]string
+		err    string
+	}{
+		{RESTSource{URL: srv.URL + "/all", Headers: auth}, all, ""},
+		{RESTSource{URL: srv.URL + "/all", Headers: auth, Columns: []string{"region", "tags", "paid"}}, [][]string{
+			{"region", "tags", "paid"}, {"North", "", ""}, {"East", "", ""}, {"South", `["a"]`, ""}, {"West", "", ""}, {"North", "", "true"}}, ""},
+		{RESTSource{URL: srv.URL + "/offset", Headers: auth, Path: "data.items", Columns: all[0],
+			Pagination: &Pagination{Type: "offset", OffsetParam: "skip", Limit: 2}}, all, ""},
+		{RESTSource{URL: srv.URL + "/offset", Headers: auth, Path: "data.items", Columns: all[0],
+			Pagination: &Pagination{Type: "offset", OffsetParam: "skip", Limit: 5}}, all, ""},
+		{RESTSource{URL: srv.URL + "/cursor", Headers: auth, Path: "items", Columns: all[0],
+			Pagination: &Pagination{Type: "cursor", CursorPath: "meta.next"}}, all, ""},
+		{RESTSource{URL: srv.URL + "/cursor", Headers: auth, Path: "items",
+			Pagination: &Pagination{Type: "cursor", CursorPath: "meta.next", MaxPages: 2}}, nil, "more than 2 pages"},
+		{RESTSource{URL: srv.URL + "/all"}, nil, "401 Unauthorized"},
+		{RESTSource{URL: srv.URL + "/all", Headers: auth, Path: "data"}, nil, `path "data" not found in response`},
+		{RESTSource{URL: srv.URL + "/offset", Headers: auth, Path: "data",
+			Pagination: &Pagination{Type: "offset"}}, nil, `path "data" does not lead to an array`},
+	}
+	for i, tt := range tests {
+		records, err := tt.source.load(context.Background())
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("source %d: load = %v, want %q", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(records, tt.want) {
+			t.Errorf("source %d: load = %q, %v; want %q", i, records, err, tt.want)
+		}
+	}
+}
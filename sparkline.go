@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ## Sparklines
+
+// A column of numbers does not show a trend; a tiny chart does. A column
+// with a sparkline setting draws a line or bar chart into its cells.
+// The values come from the cell itself, as a list like "3,5,4,8", or,
+// for data in wide format, from a list of columns such as one column
+// per month.
+
+// SparklineConfig draws charts into the cells of a column.
+type SparklineConfig struct {
+	// Type is "line" (default) or "bar".
+	Type string `json:"type"`
+
+	// Columns are the columns that hold the values, in order. Without
+	// columns, the values are read from the cell itself, separated by
+	// commas, semicolons, or spaces.
+	Columns []ColumnRef `json:"columns"`
+
+	// Color is the chart color as "#rrggbb". Default: a dark blue.
+	Color string `json:"color"`
+
+	color [3]int
+}
+
+// prepare checks the type and parses the color.
+func (sc *SparklineConfig) prepare() error {
+	switch sc.Type {
+	case "", "line", "bar":
+	default:
+		return fmt.Errorf("sparkline type must be line or bar")
+	}
+	if sc.Color == "" {
+		sc.color = [3]int{31, 78, 121}
+		return nil
+	}
+	var err error
+	sc.color, err = parseColor(sc.Color)
+	return err
+}
+
+// resolve resolves the value columns.
+func (sc *SparklineConfig) resolve(hdr []string) error {
+	for i := range sc.Columns {
+		if err := sc.Columns[i].resolve(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// values returns the chart values for column i of line. Values that are
+// not numbers are skipped.
+func (sc *SparklineConfig) values(line []string, i int) []float64 {
+	var fields []string
+	if len(sc.Columns) > 0 {
+		for _, ref := range sc.Columns {
+			fields = append(fields, cellAt(line, ref.Index))
+		}
+	} else {
+		fields = strings.FieldsFunc(cellAt(line, i), func(r rune) bool {
+			return r == ',' || r == ';' || r == ' '
+		})
+	}
+	var vs []float64
+	for _, f := range fields {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(f), 64); err == nil {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// sparklineCell prints a table cell with a chart of vs inside.
+func sparklineCell(pdf Backend, sc *SparklineConfig, w, h float64, vs []float64, border string, fill bool) {
+	x, y := pdf.GetXY()
+	pdf.CellFormat(w, h, "", border, 0, "", fill, 0, "")
+	if len(vs) == 0 {
+		return
+	}
+
+	// The chart area leaves a small margin inside the cell.
+	const pad = 1.5
+	cx, cy, cw, ch := x+pad, y+pad, w-2*pad, h-2*pad
+	lo, hi := vs[0], vs[0]
+	for _, v := range vs {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	if sc.Type == "bar" {
+		// Bars grow from zero, so zero must be in range.
+		if lo > 0 {
+			lo = 0
+		}
+		if hi < 0 {
+			hi = 0
+		}
+	}
+	// vy maps a value to a y coordinate; flat series sit in the middle.
+	vy := func(v float64) float64 {
+		if hi == lo {
+			return cy + ch/2
+		}
+		return cy + ch - (v-lo)/(hi-lo)*ch
+	}
+
+	dr, dg, db := pdf.GetDrawColor()
+	fr, fg, fb := pdf.GetFillColor()
+	lw := pdf.GetLineWidth()
+	c := sc.color
+	pdf.SetDrawColor(c[0], c[1], c[2])
+	pdf.SetFillColor(c[0], c[1], c[2])
+
+	if sc.Type == "bar" {
+		step := cw / float64(len(vs))
+		zero := vy(0)
+		for k, v := range vs {
+			top, bottom := vy(v), zero
+			if top > bottom {
+				top, bottom = bottom, top
+			}
+			pdf.Rect(cx+float64(k)*step+step*0.1, top, step*0.8, bottom-top, "F")
+		}
+	} else {
+		pdf.SetLineWidth(0.3)
+		step := 0.0
+		if len(vs) > 1 {
+			step = cw / float64(len(vs)-1)
+		}
+		for k := 1; k < len(vs); k++ {
+			pdf.Line(cx+float64(k-1)*step, vy(vs[k-1]), cx+float64(k)*step, vy(vs[k]))
+		}
+		// A dot marks the latest value.
+		pdf.Circle(cx+float64(len(vs)-1)*step, vy(vs[len(vs)-1]), 0.5, "F")
+	}
+
+	pdf.SetDrawColor(dr, dg, db)
+	pdf.SetFillColor(fr, fg, fb)
+	pdf.SetLineWidth(lw)
+}
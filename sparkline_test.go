@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSparklineValues(t *testing.T) {
+	sc := &SparklineConfig{}
+	line := []string{"Apples", "3, 5;4 x 8", "1", "n/a", "2"}
+	if got, want := sc.values(line, 1), []float64{3, 5, 4, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values from the cell = %v, want %v", got, want)
+	}
+	if got := sc.values(line, 7); got != nil {
+		t.Errorf("values from a missing cell = %v", got)
+	}
+	sc.Columns = []ColumnRef{{Name: "Jan"}, {Name: "Feb"}, {Name: "Mar"}}
+	if err := sc.resolve([]string{"Item", "Trend", "Jan", "Feb", "Mar"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sc.values(line, 1), []float64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values from columns = %v, want %v", got, want)
+	}
+	if err := sc.resolve([]string{"Item", "Jan"}); err == nil {
+		t.Error("a missing value column resolves")
+	}
+}
+
+// chartRecorder is a Backend that records the lines, bars, and dots it
+// draws, as x, y, x, y or x, y, w, h.
+type chartRecorder struct {
+	Backend
+	lines, bars, dots [][4]float64
+}
+
+func (cr *chartRecorder) Line(x1, y1, x2, y2 float64) {
+	cr.lines = append(cr.lines, [4]float64{x1, y1, x2, y2})
+}
+
+func (cr *chartRecorder) Rect(x, y, w, h float64, style string) {
+	cr.bars = append(cr.bars, [4]float64{x, y, w, h})
+}
+
+func (cr *chartRecorder) Circle(x, y, r float64, style string) {
+	cr.dots = append(cr.dots, [4]float64{x, y, r, r})
+}
+
+func TestSparklineCell(t *testing.T) {
+	// The chart area of a cell 30 x 7 mm at (10, 20) is 27 x 4 mm at
+	// (11.5, 21.5).
+	tests := []struct {
+		typ               string
+		vs                []float64
+		lines, bars, dots [][4]float64
+	}{
+		{"line", []float64{1, 3, 2}, [][4]float64{{11.5, 25.5, 25, 21.5}, {25, 21.5, 38.5, 23.5}}, nil, [][4]float64{{38.5, 23.5, 0.5, 0.5}}},
+		{"line", []float64{5, 5}, [][4]float64{{11.5, 23.5, 38.5, 23.5}}, nil, [][4]float64{{38.5, 23.5, 0.5, 0.5}}},
+		{"line", []float64{5}, nil, nil, [][4]float64{{11.5, 23.5, 0.5, 0.5}}},
+		// Bars grow from zero, down for negative values.
+		{"bar", []float64{2, -1, 4}, nil, [][4]float64{{12.4, 23.1, 7.2, 1.6}, {21.4, 24.7, 7.2, 0.8}, {30.4, 21.5, 7.2, 3.2}}, nil},
+		{"bar", []float64{}, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		pdf := newPDF("P", "mm", "A4", "")
+		pdf.AddPage()
+		pdf.SetFont("Times", "", 12)
+		pdf.SetXY(10, 20)
+		rec := &chartRecorder{Backend: pdf}
+		sc := &SparklineConfig{Type: tt.typ}
+		if err := sc.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		sparklineCell(rec, sc, 30, 7, tt.vs, "", false)
+		for _, c := range []struct {
+			what      string
+			got, want [][4]float64
+		}{{"lines", rec.lines, tt.lines}, {"bars", rec.bars, tt.bars}, {"dots", rec.dots, tt.dots}} {
+			if !approxShapes(c.got, c.want) {
+				t.Errorf("%s %v: %s %v, want %v", tt.typ, tt.vs, c.what, c.got, c.want)
+			}
+		}
+		if err := pdf.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if x, y := pdf.GetXY(); !approx(x, 40) || !approx(y, 20) {
+			t.Errorf("%s %v: the cell ends at (%v, %v), want (40, 20)", tt.typ, tt.vs, x, y)
+		}
+	}
+}
+
+func approxShapes(a, b [][4]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		for j := range a[i] {
+			if !approx(a[i][j], b[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSparklineConfig(t *testing.T) {
+	for _, tt := range []struct {
+		sparkline, err string
+	}{
+		{`{"type": "pie"}`, "sparkline type must be line or bar"},
+		{`{"color": "blue"}`, `color "blue": use the form #rrggbb`},
+		{`{"columns": ["Jan"]}`, `column "Trend": sparkline: column "Jan" not found`},
+	} {
+		env := testEnv(map[string]string{
+			"in.csv":   "Item,Trend\nApples,\"1,2\"\n",
+			"cfg.json": `{"columns": [{"name": "Trend", "sparkline": ` + tt.sparkline + `}]}`,
+		})
+		err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error with %q", tt.sparkline, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ## Split mode
+
+// One report per customer, region, or sales rep: in split mode, the rows
+// are grouped by the value of a column and every group becomes a report
+// of its own.
+
+// SplitConfig enables split mode.
+type SplitConfig struct {
+	// Column is the column whose values select the report of a row.
+	Column ColumnRef `json:"column"`
+
+	// Output is a text/template for the file name of each report. It can
+	// use {{.Value}} (the column value, made safe for file names),
+	// {{.Index}} (1, 2, ...), and {{.Base}} (the job's output path
+	// without ".pdf"). Default: "{{.Base}}-{{.Value}}.pdf".
+	Output string `json:"output"`
+
+	// Workers is the number of reports generated concurrently.
+	// Default: the number of CPUs.
+	Workers int `json:"workers"`
+}
+
+// part is the data of one report.
+type part struct {
+	value   string
+	output  string
+	rows    [][]string
+	invalid map[int]bool
+	issues  []rowIssue
+	pdf     []byte       // the finished document
+	err     error        // why the part failed, set by forEachPart
+	pages   int          // of the finished document
+	tags    *tagger      // the structure of a tagged document
+	fields  []formWidget // the form block of the document
+
+	to        []string // the recipients of a personalized report
+	unchanged bool     // identical to the last delivered version; see publish
+}
+
+// splitName is the template data for SplitConfig.Output.
+type splitName struct {
+	Value string
+	Index int
+	Base  string
+}
+
+// parts groups the rows by the split column, in order of first
+// appearance, and names the output file of each group.
+func (sc *SplitConfig) parts(rows [][]string, invalid map[int]bool, issues []rowIssue, output string) ([]*part, error) {
+	byRow := map[int]rowIssue{}
+	for _, is := range issues {
+		byRow[is.Row] = is
+	}
+	var parts []*part
+	index := map[string]*part{}
+	for r, line := range rows {
+		value := ""
+		if sc.Column.Index < len(line) {
+			value = line[sc.Column.Index]
+		}
+		p, ok := index[value]
+		if !ok {
+			p = &part{value: value, invalid: map[int]bool{}}
+			index[value] = p
+			parts = append(parts, p)
+		}
+		if invalid[r] {
+			p.invalid[len(p.rows)] = true
+		}
+		if is, ok := byRow[r]; ok {
+			p.issues = append(p.issues, is)
+		}
+		p.rows = append(p.rows, line)
+	}
+	if err := nameParts(parts, orDefault(sc.Output, "{{.Base}}-{{.Value}}.pdf"), output); err != nil {
+		return nil, fmt.Errorf("split output: %w", err)
+	}
+	return parts, nil
+}
+
+// nameParts sets the output file of each part from the template text.
+// output is the job's output path.
+func nameParts(parts []*part, text, output string) error {
+	tmpl, err := template.New("output").Funcs(templateFuncs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, p := range parts {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, splitName{
+			Value: safeFileName(p.value),
+			Index: i + 1,
+			Base:  strings.TrimSuffix(output, ".pdf"),
+		})
+		if err != nil {
+			return err
+		}
+		p.output = buf.String()
+		if names[p.output] {
+			return fmt.Errorf("%q is generated twice; add {{.Index}} to the template", p.output)
+		}
+		names[p.output] = true
+	}
+	return nil
+}
+
+// workers returns the number of concurrent workers.
+func (sc *SplitConfig) workers() int {
+	if sc.Workers > 0 {
+		return sc.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// forEachPart calls fn for every part, using up to n goroutines. It
+// returns the errors of all failed calls, combined into one, with the
+// highest of their exit codes.
+func forEachPart(parts []*part, n int, fn func(*part) error) error {
+	var (
+		mu   sync.Mutex
+		errs []string
+		code int
+		wg   sync.WaitGroup
+	)
+	work := make(chan *part)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				if err := fn(p); err != nil {
+					p.err = err
+					mu.Lock()
+					errs = append(errs, fmt.Sprintf("%s: %s", p.output, err))
+					code = maxInt(code, exitCode(err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, p := range parts {
+		work <- p
+	}
+	close(work)
+	wg.Wait()
+	if len(errs) > 0 {
+		return withExitCode(code, fmt.Errorf("%d of %d reports failed:\n%s", len(errs), len(parts), strings.Join(errs, "\n")))
+	}
+	return nil
+}
+
+// safeFileName replaces characters that are unsafe in file names.
+func safeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == filepath.Separator, r == '/', r == '\\', r == ':', r < ' ':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
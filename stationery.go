@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ## Stationery
+
+// Reports that leave the company are printed on its stationery: a
+// letterhead with the logo and the address at the top, and the legal
+// details at the bottom. The designers deliver it as a PDF file, and
+// every page of the report is printed on it:
+//
+//	"stationery": {"file": "letterhead.pdf", "top": 45, "bottom": 30}
+//
+// The first page of the file goes under the first page of the report,
+// and its second page, if it has one, under all others, so that the
+// following pages can have a smaller letterhead. A page of the file
+// that is not of the size of the report's pages is scaled to fit and
+// centered. Top and bottom are the margins of the report, so that the
+// table stays clear of the letterhead; the logo of the report moves
+// down with the top margin.
+//
+// Like cover and appendix pages, the stationery is added to the finished
+// document: gofpdi imports the pages of the file as forms, with the same
+// limits, and every page draws one before its own content. In tagged reports, the stationery is an
+// artifact, which screen readers skip, and in grayscale reports, its
+// text and drawings are gray, though not its images. Cover and appendix
+// pages are not printed on the stationery.
+
+// StationeryConfig prints the pages of the report on the pages of a
+// PDF file.
+type StationeryConfig struct {
+	// File is a PDF file with the stationery, on one or two pages.
+	File string `json:"file"`
+
+	// Top and Bottom are the margins of the report in mm.
+	// Default: 10 and 20.
+	Top    float64 `json:"top"`
+	Bottom float64 `json:"bottom"`
+}
+
+func (sc *StationeryConfig) prepare() error {
+	if sc.File == "" {
+		return errors.New("file required")
+	}
+	if sc.Top < 0 || sc.Bottom < 0 {
+		return errors.New("top and bottom must not be negative")
+	}
+	return nil
+}
+
+// setup sets the margins of the report.
+func (sc *StationeryConfig) setup(pdf *Fpdf) {
+	if sc.Top > 0 {
+		pdf.SetTopMargin(sc.Top)
+	}
+	if sc.Bottom > 0 {
+		pdf.SetAutoPageBreak(true, sc.Bottom)
+	}
+}
+
+// top returns the top margin of the report in mm, for the logo.
+func (sc *StationeryConfig) top() float64 {
+	if sc == nil || sc.Top == 0 {
+		return 10
+	}
+	return sc.Top
+}
+
+// finisher returns the post-processing step for savePDF that prints the
+// pages on the stationery, in gray if gray is true. It must run before
+// the steps that add pages.
+func (sc *StationeryConfig) finisher(fsys FileSystem, gray bool) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		file, err := readFile(fsys, sc.File)
+		if err != nil {
+			return nil, fmt.Errorf("stationery: %w", err)
+		}
+		if data, err = stationeryPages(data, file, gray); err != nil {
+			return nil, fmt.Errorf("stationery: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// stationeryPages appends an incremental update to data that imports
+// the first two pages of file as forms, and replaces the content streams
+// of all pages with ones that draw a form first.
+func stationeryPages(data, file []byte, gray bool) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+	pagesRef := rePages.FindSubmatch(pdfObject(data, string(root[1])))
+	if pagesRef == nil {
+		return nil, errors.New("cannot find the page tree")
+	}
+	pagesObj := pdfObject(data, string(pagesRef[1]))
+	kids := reKids.FindSubmatch(pagesObj)
+	box := reMediaBox.FindSubmatch(pagesObj)
+	if kids == nil || box == nil {
+		return nil, errors.New("cannot parse the page tree")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	imp := &pageImporter{buf: &buf, next: size, offsets: map[int]int{}}
+	forms, err := imp.importForms(file, 2, gray)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms) == 0 {
+		return nil, errors.New("the file has no pages")
+	}
+	var names []byte // the forms, as entries of an XObject dictionary
+	for i, f := range forms {
+		names = append(names, fmt.Sprintf(" /Stationery%d %d 0 R", i+1, f.num)...)
+	}
+
+	var updated []int // numbers and offsets of replaced objects
+	var resources []string
+	seen := map[string]bool{}
+	for i, ref := range reRef.FindAllSubmatch(kids[1], -1) {
+		page := pdfObject(data, string(ref[1]))
+		res, contents := reRes.FindSubmatch(page), reContents.FindSubmatch(page)
+		if res == nil || contents == nil {
+			return nil, fmt.Errorf("cannot parse page object %s", ref[1])
+		}
+		if !seen[string(res[1])] {
+			seen[string(res[1])] = true
+			resources = append(resources, string(res[1]))
+		}
+		content, filter, err := contentStream(data, string(contents[1]))
+		if err != nil {
+			return nil, err
+		}
+		switch filter {
+		case "":
+		case "FlateDecode":
+			if content, err = inflate(content); err != nil {
+				return nil, fmt.Errorf("content stream %s: %s", contents[1], err)
+			}
+		default:
+			return nil, fmt.Errorf("content stream %s has the unsupported filter %s", contents[1], filter)
+		}
+
+		// The form is scaled to the page and centered.
+		w, h := mediaBoxSize(string(box[1]))
+		if b := reMediaBox.FindSubmatch(page); b != nil {
+			w, h = mediaBoxSize(string(b[1]))
+		}
+		sheet := minInt(i, len(forms)-1)
+		f := forms[sheet]
+		s := math.Min(w/f.w, h/f.h)
+		x, y := (w-f.w*s)/2, (h-f.h*s)/2
+		stamp := fmt.Sprintf("/Artifact BMC q %.4f 0 0 %.4f %.2f %.2f cm /Stationery%d Do Q EMC\n", s, s, x, y, sheet+1)
+		content = deflate(append([]byte(stamp), content...))
+
+		num, _ := strconv.Atoi(string(contents[1]))
+		updated = append(updated, num, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Filter /FlateDecode /Length %d >>\nstream\n", num, len(content))
+		buf.Write(content)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	// The forms join the images in the resources of the pages.
+	for _, res := range resources {
+		dict := pdfObjectValue(pdfObject(data, res))
+		var merged []byte
+		if _, vs, ve, ok := pdfDictEntry(dict, "XObject"); ok {
+			if !bytes.HasPrefix(dict[vs:], []byte("<<")) {
+				return nil, fmt.Errorf("cannot parse resources %s", res)
+			}
+			merged = append(append(append(merged, dict[:ve-2]...), names...), dict[ve-2:]...)
+		} else {
+			merged = withEntry(dict, fmt.Sprintf("/XObject <<%s >>", names))
+		}
+		num, _ := strconv.Atoi(res)
+		updated = append(updated, num, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", num, merged)
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(updated); i += 2 {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", updated[i], updated[i+1])
+	}
+	if imp.next > size {
+		fmt.Fprintf(&buf, "%d %d\n", size, imp.next-size)
+		for num := size; num < imp.next; num++ {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", imp.offsets[num])
+		}
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		imp.next, root[1], info[1], m[1], xref)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStationeryConfig(t *testing.T) {
+	for _, sc := range []*StationeryConfig{{}, {File: "lh.pdf", Top: -1}, {File: "lh.pdf", Bottom: -1}} {
+		if err := sc.prepare(); err == nil {
+			t.Errorf("%+v is accepted", sc)
+		}
+	}
+	var none *StationeryConfig
+	if none.top() != 10 || (&StationeryConfig{}).top() != 10 || (&StationeryConfig{Top: 45}).top() != 45 {
+		t.Error("wrong top margins")
+	}
+}
+
+func TestStationery(t *testing.T) {
+	reStamp := regexp.MustCompile(`/Artifact BMC q [^\n]* cm /Stationery\d Do Q EMC\n`)
+	tests := []struct {
+		name  string
+		pages int
+		want  []string
+	}{
+		{"one page", 1, []string{"Stationery1", "Stationery1", "Stationery1"}},
+		{"two pages", 2, []string{"Stationery1", "Stationery2", "Stationery2"}},
+		{"more pages", 3, []string{"Stationery1", "Stationery2", "Stationery2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv(map[string]string{
+				"in.csv":   longCSV(50),
+				"lh.pdf":   string(testPDF(t, tt.pages)),
+				"cfg.json": `{"stationery": {"file": "lh.pdf", "top": 45, "bottom": 30}}`,
+			})
+			if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+				t.Fatal(err)
+			}
+			data := []byte(testFile(t, env, "out.pdf"))
+			pages := pageObjects(t, data)
+			if len(pages) != len(tt.want) {
+				t.Fatalf("%d pages, want %d", len(pages), len(tt.want))
+			}
+			// Every page draws its form first. A4 is scaled down to the
+			// height of landscape Letter, and centered.
+			for i, page := range pages {
+				num := reContents.FindSubmatch(page.dict)[1]
+				stream, _, err := contentStream(data, string(num))
+				if err != nil {
+					t.Fatal(err)
+				}
+				content, err := inflate(stream)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "/Artifact BMC q 0.7269 0 0 0.7269 179.63 0.00 cm /" + tt.want[i] + " Do Q EMC\n"
+				if !strings.HasPrefix(string(content), want) {
+					t.Errorf("page %d starts with %.80q, want %q", i+1, content, want)
+				}
+				if n := len(reStamp.FindAll(content, -1)); n != 1 {
+					t.Errorf("page %d draws %d forms", i+1, n)
+				}
+			}
+			forms := "/Stationery1 \\d+ 0 R"
+			if tt.pages > 1 {
+				forms += " /Stationery2 \\d+ 0 R"
+			}
+			if !regexp.MustCompile("/XObject <<[^>]*" + forms + ">>").Match(data) {
+				t.Error("the forms are not in the resources of the pages")
+			}
+			// The table starts below the top margin of 45 mm.
+			if !strings.Contains(pageContents(t, data), "BT 31.19 379.01 Td (Item)Tj") {
+				t.Error("the top margin is not applied")
+			}
+		})
+	}
+}
+
+func TestStationeryErrors(t *testing.T) {
+	for name, file := range map[string]string{
+		"missing":    "",
+		"not a PDF":  "Item,Total\n",
+		"no objects": "%PDF-1.4\n%%EOF\n",
+	} {
+		files := map[string]string{
+			"in.csv":   "Item,Total\nApples,1\n",
+			"cfg.json": `{"stationery": {"file": "lh.pdf"}}`,
+		}
+		if file != "" {
+			files["lh.pdf"] = file
+		}
+		err := generate(testEnv(files), &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+		if err == nil || !strings.Contains(err.Error(), "stationery: ") {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
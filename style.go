@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ## Cell styles
+
+// Every table cell has a thin black border on all four sides. Designs
+// that want a lighter look -- horizontal rules only, say -- can set the
+// borders of the header and the body cells separately, and the padding
+// between the borders and the text:
+//
+//	"cellStyle": {"padding": 2,
+//	  "header": {"sides": "TB", "width": 0.5},
+//	  "body": {"sides": "B", "width": 0.1, "style": "dotted", "color": "#999999"}}
+//
+// Sides are any of L, T, R, and B, or "none"; the default is all four.
+// Widths are in mm, 0.2 by default. The style is "solid" (default),
+// "dashed", or "dotted". Group subtotal rows use the body borders.
+
+// CellStyleConfig sets the borders and the padding of table cells.
+type CellStyleConfig struct {
+	// Padding is the space between the left or right border and the
+	// text, in mm. The default is 1.
+	Padding *float64 `json:"padding"`
+
+	Header BorderConfig `json:"header"`
+	Body   BorderConfig `json:"body"`
+}
+
+// BorderConfig describes the borders of a cell.
+type BorderConfig struct {
+	Sides string  `json:"sides"`
+	Width float64 `json:"width"`
+	Style string  `json:"style"`
+	Color string  `json:"color"`
+
+	color [3]int
+}
+
+func (cs *CellStyleConfig) prepare() error {
+	if cs.Padding != nil && *cs.Padding < 0 {
+		return fmt.Errorf("padding must not be negative")
+	}
+	if err := cs.Header.prepare(); err != nil {
+		return fmt.Errorf("header: %s", err)
+	}
+	if err := cs.Body.prepare(); err != nil {
+		return fmt.Errorf("body: %s", err)
+	}
+	return nil
+}
+
+func (bc *BorderConfig) prepare() error {
+	if bc.Sides != "none" && strings.Trim(bc.Sides, "LTRB") != "" {
+		return fmt.Errorf("unknown sides %q; use any of L, T, R, and B, or none", bc.Sides)
+	}
+	if bc.Width < 0 {
+		return fmt.Errorf("width must not be negative")
+	}
+	switch bc.Style {
+	case "", "solid", "dashed", "dotted":
+	default:
+		return fmt.Errorf("unknown style %q; use solid, dashed, or dotted", bc.Style)
+	}
+	if bc.Color != "" {
+		var err error
+		if bc.color, err = parseColor(bc.Color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// border returns the border argument of CellFormat.
+func (bc *BorderConfig) border() string {
+	switch bc.Sides {
+	case "", "LTRB":
+		return "1"
+	case "none":
+		return ""
+	}
+	return bc.Sides
+}
+
+// padding returns the cell padding, or def if none is configured.
+func (cs *CellStyleConfig) padding(def float64) float64 {
+	if cs == nil || cs.Padding == nil {
+		return def
+	}
+	return *cs.Padding
+}
+
+// begin sets up the line style and the padding for the cells of a
+// section, "header" or "body", and returns their border argument and a
+// function that restores the previous style.
+func (cs *CellStyleConfig) begin(pdf Backend, section string) (string, func()) {
+	if cs == nil {
+		return "1", func() {}
+	}
+	bc := &cs.Body
+	if section == "header" {
+		bc = &cs.Header
+	}
+	lw, margin := pdf.GetLineWidth(), pdf.GetCellMargin()
+	dr, dg, db := pdf.GetDrawColor()
+
+	w := bc.Width
+	if w == 0 {
+		w = 0.2
+	}
+	pdf.SetLineWidth(w)
+	pdf.SetDrawColor(bc.color[0], bc.color[1], bc.color[2])
+	switch bc.Style {
+	case "dashed":
+		pdf.SetDashPattern([]float64{2, 1}, 0)
+	case "dotted":
+		pdf.SetDashPattern([]float64{w, 2 * w}, 0)
+	}
+	pdf.SetCellMargin(cs.padding(margin))
+
+	return bc.border(), func() {
+		pdf.SetLineWidth(lw)
+		pdf.SetDrawColor(dr, dg, db)
+		if bc.Style == "dashed" || bc.Style == "dotted" {
+			pdf.SetDashPattern([]float64{}, 0)
+		}
+		pdf.SetCellMargin(margin)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCellStyleConfig(t *testing.T) {
+	tests := []struct {
+		cs     CellStyleConfig
+		header string
+		err    string
+	}{
+		{CellStyleConfig{}, "1", ""},
+		{CellStyleConfig{Header: BorderConfig{Sides: "LTRB"}}, "1", ""},
+		{CellStyleConfig{Header: BorderConfig{Sides: "none"}}, "", ""},
+		{CellStyleConfig{Header: BorderConfig{Sides: "TB"}}, "TB", ""},
+		{CellStyleConfig{Header: BorderConfig{Sides: "X"}}, "", `header: unknown sides "X"`},
+		{CellStyleConfig{Body: BorderConfig{Width: -1}}, "", "body: width must not be negative"},
+		{CellStyleConfig{Body: BorderConfig{Style: "wavy"}}, "", `body: unknown style "wavy"`},
+		{CellStyleConfig{Body: BorderConfig{Color: "grey"}}, "", "body: "},
+		{CellStyleConfig{Padding: new(float64)}, "1", ""},
+	}
+	for _, tt := range tests {
+		err := tt.cs.prepare()
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%+v: got error %v, want %q", tt.cs, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tt.cs, err)
+		} else if got := tt.cs.Header.border(); got != tt.header {
+			t.Errorf("%+v: got border %q, want %q", tt.cs, got, tt.header)
+		}
+	}
+	padding := -1.0
+	if err := (&CellStyleConfig{Padding: &padding}).prepare(); err == nil {
+		t.Error("negative padding is accepted")
+	}
+	var cs *CellStyleConfig
+	if cs.padding(1) != 1 || (&CellStyleConfig{Padding: &padding}).padding(1) != -1 {
+		t.Error("wrong padding")
+	}
+}
+
+func TestCellStyle(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want []string
+		not  []string
+	}{
+		{"default", `{}`,
+			[]string{"re B", "re S", "BT 31.19 478.22 Td (Item)Tj"},
+			[]string{" d\n"}},
+		{"rules", `{"cellStyle": {"padding": 2,
+			"header": {"sides": "TB", "width": 0.5},
+			"body": {"sides": "B", "width": 0.1, "style": "dotted", "color": "#999999"}}}`,
+			[]string{
+				// The header has a thick top and bottom rule,
+				"1.42 w\n", "28.35 492.94 m 141.74 492.94 l S", "28.35 473.10 m 141.74 473.10 l S",
+				// the text is 2 mm from the left border,
+				"BT 34.02 478.22 Td (Item)Tj",
+				// and the body has a dotted gray rule below the row,
+				"0.28 w\n0.600 G\n[0.28 0.57] 0.00 d\n28.35 453.26 m 255.12 453.26 l S",
+				// after which the line style is restored.
+				"0.57 w\n0.000 G\n[] 0.00 d\n",
+			},
+			[]string{"re B", "re S"}},
+		{"dashed", `{"cellStyle": {"body": {"style": "dashed"}}}`,
+			[]string{"[5.67 2.83] 0.00 d\n"},
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv(map[string]string{"in.csv": "Item,Total\na,1\n", "cfg.json": tt.cfg})
+			if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+				t.Fatal(err)
+			}
+			content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+			for _, s := range tt.want {
+				if !strings.Contains(content, s) {
+					t.Errorf("missing %q", s)
+				}
+			}
+			for _, s := range tt.not {
+				if strings.Contains(content, s) {
+					t.Errorf("unexpected %q", s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ## Fast table cells
+
+// A large table is mostly plain cells, and gofpdf prints every one of
+// them the long way: CellFormat formats each number of the cell with
+// fmt, measures the text anew for each right-aligned or centered cell,
+// and looks up the colors, although they rarely change within a row.
+// `pdf bench` shows that this is where most of the time goes.
+//
+// cellWriter prints plain cells itself. It writes exactly what
+// CellFormat would, byte for byte, but formats the numbers with strconv,
+// remembers the width of each distinct text, and looks up the text
+// color once per row. Everything it cannot do the same way goes to
+// CellFormat as before: the first cell of each row, which may start a
+// new page, cells with characters that an embedded font has not printed
+// yet, underlined text, and all cells of documents with fallback fonts.
+// It relies on the internals of gofpdf, so the go-pdf/fpdf backend does
+// without it; see fastCells.
+//
+// This falls short of the goal of making large tables five times as
+// fast. A cell takes less than half the time, but a table of 200,000
+// rows and 20 columns takes 7 seconds instead of 12, 1.7 times as fast:
+// most of the rest goes into gofpdf compressing each page with a zlib
+// writer of its own, which cellWriter cannot change. Tables that must be
+// faster than that are for the direct engine, which renders this one in
+// 3 seconds; see `## The direct engine`. BenchmarkCellWriter and
+// BenchmarkTableGofpdf measure the difference.
+
+// cellWriter prints the plain cells of a table.
+type cellWriter struct {
+	pdf     Backend
+	enabled bool
+	utf8    bool
+
+	// first is set until the first cell of a row has been printed.
+	first bool
+
+	// color is the text color operator, if the text and fill colors
+	// differ, and colors the colors it is for.
+	color  string
+	colors [6]int
+
+	// runes are the characters that an embedded font has printed, by
+	// font style; gofpdf embeds only these.
+	runes map[string]map[rune]bool
+
+	// widths are the widths of texts, by font style and size.
+	widths map[widthKey]float64
+
+	buf []byte
+}
+
+type widthKey struct {
+	style string
+	size  float64
+	text  string
+}
+
+// maxWidths limits the number of remembered widths. Tables of mostly
+// distinct values would otherwise keep one for every cell.
+const maxWidths = 50000
+
+// newCellWriter returns a cellWriter for the table cells of a report
+// with configuration cfg.
+func newCellWriter(pdf Backend, cfg *Config) *cellWriter {
+	return &cellWriter{
+		pdf:     pdf,
+		enabled: fastCells && cfg.fallback == nil,
+		utf8:    cfg.fonts()[""] != "",
+		runes:   map[string]map[rune]bool{},
+		widths:  map[widthKey]float64{},
+	}
+}
+
+// row starts a row of cells.
+func (cw *cellWriter) row() {
+	cw.first = true
+	cw.color = ""
+	cw.colors = [6]int{-1}
+}
+
+// cell prints a cell like CellFormat with ln 0, and reports whether it
+// did. If it did not, the caller prints the cell with CellFormat.
+func (cw *cellWriter) cell(style string, w, h float64, text, border, align string, fill bool) bool {
+	pdf := cw.pdf
+	if !cw.enabled {
+		return false
+	}
+	if cw.first || w == 0 || strings.ContainsAny(style, "US") || pdf.Err() {
+		cw.first = false
+		cw.register(style, text)
+		return false
+	}
+	switch align {
+	case "", "L", "C", "R":
+	default:
+		return false
+	}
+	if !cw.register(style, text) {
+		return false
+	}
+	x, y := pdf.GetXY()
+	_, ph := pdf.GetPageSize()
+	if auto, margin := pdf.GetAutoPageBreak(); auto && y+h > ph-margin {
+		return false
+	}
+	k := pdf.GetConversionRatio()
+
+	b := cw.buf[:0]
+	if fill || border == "1" {
+		op := "S"
+		if fill && border == "1" {
+			op = "B"
+		} else if fill {
+			op = "f"
+		}
+		b = appendNumbers(b, x*k, (ph-y)*k, w*k, -h*k)
+		b = append(b, "re "...)
+		b = append(b, op...)
+		b = append(b, ' ')
+	}
+	if border != "" && border != "1" {
+		border = strings.ToUpper(border)
+		left, top := x*k, (ph-y)*k
+		right, bottom := (x+w)*k, (ph-(y+h))*k
+		for _, side := range []struct {
+			name           string
+			x1, y1, x2, y2 float64
+		}{
+			{"L", left, top, left, bottom},
+			{"T", left, top, right, top},
+			{"R", right, top, right, bottom},
+			{"B", left, bottom, right, bottom},
+		} {
+			if strings.Contains(border, side.name) {
+				b = appendNumbers(b, side.x1, side.y1)
+				b = append(b, "m "...)
+				b = appendNumbers(b, side.x2, side.y2)
+				b = append(b, "l S "...)
+			}
+		}
+	}
+	if text != "" {
+		_, fontSize := pdf.GetFontSize()
+		var dx float64
+		switch align {
+		case "R":
+			dx = w - pdf.GetCellMargin() - cw.width(style, text)
+		case "C":
+			dx = (w - cw.width(style, text)) / 2
+		default:
+			dx = pdf.GetCellMargin()
+		}
+		color := cw.textColor()
+		if color != "" {
+			b = append(b, "q "...)
+			b = append(b, color...)
+			b = append(b, ' ')
+		}
+		b = append(b, "BT "...)
+		b = appendNumbers(b, (x+dx)*k, (ph-(y+.5*h+.3*fontSize))*k)
+		b = append(b, "Td ("...)
+		if cw.utf8 {
+			b = appendUTF16(b, text)
+		} else {
+			b = appendEscaped(b, text, false)
+		}
+		b = append(b, ")Tj ET"...)
+		if color != "" {
+			b = append(b, " Q"...)
+		}
+	}
+	if len(b) > 0 {
+		pdf.RawWriteStr(string(b))
+	}
+	cw.buf = b
+	pdf.SetX(x + w)
+	return true
+}
+
+// register notes the characters of text as printed in the given font
+// style, and reports whether they all were before. Only embedded fonts
+// need to know them.
+func (cw *cellWriter) register(style, text string) bool {
+	if !cw.utf8 {
+		return true
+	}
+	seen := cw.runes[style]
+	if seen == nil {
+		seen = map[rune]bool{}
+		cw.runes[style] = seen
+	}
+	known := utf8.ValidString(text)
+	for _, r := range text {
+		if r > 0xffff {
+			// gofpdf encodes only the Basic Multilingual Plane.
+			known = false
+		} else if !seen[r] {
+			seen[r] = true
+			known = false
+		}
+	}
+	return known
+}
+
+// width returns the width of text in the current font.
+func (cw *cellWriter) width(style, text string) float64 {
+	size, _ := cw.pdf.GetFontSize()
+	key := widthKey{style, size, text}
+	if w, ok := cw.widths[key]; ok {
+		return w
+	}
+	w := cw.pdf.GetStringWidth(text)
+	if len(cw.widths) >= maxWidths {
+		cw.widths = map[widthKey]float64{}
+	}
+	cw.widths[key] = w
+	return w
+}
+
+// textColor returns the operator that sets the text color, or "" if the
+// text is printed in the fill color, which is the current color anyway.
+func (cw *cellWriter) textColor() string {
+	var c [6]int
+	c[0], c[1], c[2] = cw.pdf.GetTextColor()
+	c[3], c[4], c[5] = cw.pdf.GetFillColor()
+	if c == cw.colors {
+		return cw.color
+	}
+	cw.colors = c
+	cw.color = ""
+	if c[0] != c[3] || c[1] != c[4] || c[2] != c[5] {
+		var b []byte
+		if c[0] == c[1] && c[0] == c[2] {
+			b = strconv.AppendFloat(b, float64(c[0])/255, 'f', 3, 64)
+			b = append(b, " g"...)
+		} else {
+			for i := 0; i < 3; i++ {
+				b = strconv.AppendFloat(b, float64(c[i])/255, 'f', 3, 64)
+				b = append(b, ' ')
+			}
+			b = append(b, "rg"...)
+		}
+		cw.color = string(b)
+	}
+	return cw.color
+}
+
+// appendNumbers appends numbers with two decimals, each followed by a
+// space, as gofpdf writes coordinates.
+func appendNumbers(b []byte, nums ...float64) []byte {
+	for _, n := range nums {
+		b = strconv.AppendFloat(b, n, 'f', 2, 64)
+		b = append(b, ' ')
+	}
+	return b
+}
+
+// appendEscaped appends text with the characters escaped that end or
+// break a PDF string; carriage returns only if cr is set.
+func appendEscaped(b []byte, text string, cr bool) []byte {
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\\' || c == '(' || c == ')':
+			b = append(b, '\\', c)
+		case c == '\r' && cr:
+			b = append(b, '\\', 'r')
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// appendUTF16 appends text as an escaped UTF-16BE string, as gofpdf
+// writes text in embedded fonts.
+func appendUTF16(b []byte, text string) []byte {
+	var enc []byte
+	for _, r := range text {
+		enc = append(enc, byte(r>>8), byte(r))
+	}
+	return appendEscaped(b, string(enc), true)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// cellPDF prints rows of cells over several pages, with cellWriter if
+// fast is true, and returns the uncompressed document and the number of
+// cells that cellWriter printed.
+func cellPDF(t *testing.T, fast bool) ([]byte, int) {
+	t.Helper()
+	pdf := newPDF("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(testTime)
+	pdf.SetModificationDate(testTime)
+	pdf.SetFont("Times", "", 12)
+	pdf.AddPage()
+	cw := newCellWriter(pdf, &Config{})
+	texts := []string{"Apples", "1,234.56", "", "(a) \\ b", "2024-03-15", "x"}
+	aligns := []string{"L", "R", "C", "L", "C", "R"}
+	borders := []string{"1", "", "L", "LB", "TR", "1"}
+	written := 0
+	for r := 0; r < 90; r++ {
+		cw.row()
+		// Fills and colors change from row to row, and within some.
+		fill := r%3 == 0
+		pdf.SetFillColor(240, 240, 240-r%2*40)
+		pdf.SetTextColor(0, 0, r%4*50)
+		for c := range texts {
+			style := ""
+			if r%5 == 0 && c == 1 {
+				style = "B"
+				pdf.SetFontStyle(style)
+			}
+			if r%7 == 0 && c == 4 {
+				pdf.SetTextColor(200, 0, 0)
+			}
+			if fast && cw.cell(style, 30, 7, texts[c], borders[c], aligns[c], fill) {
+				written++
+			} else {
+				pdf.CellFormat(30, 7, texts[c], borders[c], 0, aligns[c], fill, 0, "")
+			}
+			if style != "" {
+				pdf.SetFontStyle("")
+			}
+		}
+		pdf.Ln(7)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), written
+}
+
+func TestCellWriterOutput(t *testing.T) {
+	slow, _ := cellPDF(t, false)
+	fast, written := cellPDF(t, true)
+	if fastCells && written == 0 {
+		t.Fatal("cellWriter printed no cell")
+	}
+	if bytes.Equal(slow, fast) {
+		return
+	}
+	// Show where the content streams part.
+	n := 0
+	for n < len(slow) && n < len(fast) && slow[n] == fast[n] {
+		n++
+	}
+	from := n - 80
+	if from < 0 {
+		from = 0
+	}
+	t.Errorf("cellWriter and CellFormat differ at byte %d:\nCellFormat: %q\ncellWriter: %q",
+		n, slow[from:minInt(n+80, len(slow))], fast[from:minInt(n+80, len(fast))])
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ## Tagged PDF
+
+// Public-sector customers accept only accessible documents, following
+// PDF/UA: a screen reader must find the title, the paragraphs, and a
+// table whose cells know their column headers. A tagged report has a
+// structure tree that says so:
+//
+//	"tagged": {"alt": "Bar chart of the daily totals"}
+//
+// The title is a heading, the date and the narrative are paragraphs,
+// the table has header cells for its columns and a row for every row
+// of data, and the logo is a figure with the alternative text given.
+// Callouts, notes, and the appendices are tagged as sections of their
+// own. Everything else -- borders, fills, markers, and decorations of
+// render hooks -- is marked as an artifact, which screen readers skip.
+// The document gets the language of the report and shows its title
+// instead of its file name.
+//
+// PDF/UA requires embedded fonts, like PDF/A, and the two can be
+// combined. gofpdf knows nothing of tags, so the report writes the
+// marked content into the pages itself and adds the structure tree to
+// the finished document. Subtotal rows of groups, header groups, and
+// links are not tagged; contact sheets, which cannot be tagged, are not
+// available, and neither is the direct engine.
+
+// TaggedConfig makes the report a tagged PDF.
+type TaggedConfig struct {
+	// Alt is the alternative text of the logo. Default: "Logo".
+	Alt string `json:"alt"`
+}
+
+func (tc *TaggedConfig) prepare(c *Config) error {
+	if c.fonts()[""] == "" {
+		return errors.New("PDF/UA requires embedded fonts; configure at least a regular (\"\") font")
+	}
+	if c.ContactSheet != nil {
+		return errors.New("contact sheets cannot be tagged")
+	}
+	if c.Archive != nil {
+		c.Archive.xmpExtension += pdfuaXMP
+	}
+	return nil
+}
+
+// setup sets the title and the metadata that PDF/UA requires. Archival
+// mode sets them itself.
+func (tc *TaggedConfig) setup(pdf *Fpdf, cfg *Config) {
+	if cfg.Archive != nil {
+		return
+	}
+	title := cfg.locale().msg("title")
+	pdf.SetTitle(title, true)
+	var esc bytes.Buffer
+	xmlEscape(&esc, title)
+	pdf.SetXmpMetadata([]byte(`<?xpacket begin="` + "\xef\xbb\xbf" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + esc.String() + `</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+` + pdfuaXMP + cfg.manifest.xmp() + `</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`))
+}
+
+// pdfuaXMP claims conformance to PDF/UA-1, and describes the claim for
+// PDF/A.
+const pdfuaXMP = `<rdf:Description rdf:about="" xmlns:pdfuaid="http://www.aiim.org/pdfua/ns/id/">
+<pdfuaid:part>1</pdfuaid:part>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>PDF/UA Universal Accessibility Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>http://www.aiim.org/pdfua/ns/id/</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>pdfuaid</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq><rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>part</pdfaProperty:name>
+<pdfaProperty:valueType>Integer</pdfaProperty:valueType>
+<pdfaProperty:category>internal</pdfaProperty:category>
+<pdfaProperty:description>Indicates, which part of ISO 14289 standard is followed</pdfaProperty:description>
+</rdf:li></rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+`
+
+// structElem is an element of the structure tree.
+type structElem struct {
+	role  string
+	attrs string // further entries of its dictionary
+	kids  []structKid
+	empty bool // a section that printed nothing
+}
+
+// structKid is a child element or, if elem is nil, marked content.
+type structKid struct {
+	elem       *structElem
+	page, mcid int
+}
+
+// tagger writes the marked content of a report and builds its structure
+// tree. Outside of tagged content, the pages are in an artifact.
+type tagger struct {
+	pdf  *Fpdf
+	rtl  bool
+	alt  string
+	lang string
+
+	root        *structElem // the document
+	body, row   *structElem // the body of the current table and its current row
+	open        *structElem // of the open marked content; nil in an artifact
+	section     *structElem // the open section, if any
+	sectionPage int         // where the section started
+	sectionX    float64
+	sectionY    float64
+
+	parents map[int][]*structElem // the elements of each page by MCID
+}
+
+// sectionRoles are the structure types of the sections of render that
+// are tagged as a whole. The title and the table are tagged in detail.
+var sectionRoles = map[string]string{
+	"narrative":  "P",
+	"no data":    "P",
+	"dashboard":  "Div",
+	"truncation": "P",
+	"callouts":   "Div",
+	"notes":      "Div",
+	"sign-off":   "Sect",
+	"image":      "Figure",
+	"appendix":   "Sect",
+	"changes":    "Sect",
+	"raw data":   "Sect",
+}
+
+// newTagger returns a tagger for cfg, or nil if the report is not
+// tagged.
+func newTagger(cfg *Config) *tagger {
+	if cfg.Tagged == nil {
+		return nil
+	}
+	return &tagger{
+		rtl:     cfg.rtl(),
+		alt:     orDefault(cfg.Tagged.Alt, "Logo"),
+		lang:    orDefault(cfg.Locale, "en"),
+		root:    &structElem{role: "Document"},
+		parents: map[int][]*structElem{},
+	}
+}
+
+// mark starts marked content for e on the current page.
+func (tg *tagger) mark(e *structElem) {
+	page := tg.pdf.PageNo()
+	mcid := len(tg.parents[page])
+	tg.parents[page] = append(tg.parents[page], e)
+	e.kids = append(e.kids, structKid{page: page, mcid: mcid})
+	tg.pdf.RawWriteStr(fmt.Sprintf("EMC /%s <</MCID %d>> BDC", e.role, mcid))
+	tg.open = e
+}
+
+// begin adds an element to parent and starts its content.
+func (tg *tagger) begin(parent *structElem, role, attrs string) {
+	e := &structElem{role: role, attrs: attrs}
+	parent.kids = append(parent.kids, structKid{elem: e})
+	tg.mark(e)
+}
+
+// block starts a top-level element, such as the title. It does nothing
+// if tg is nil.
+func (tg *tagger) block(role string) {
+	if tg != nil {
+		tg.begin(tg.root, role, "")
+	}
+}
+
+// end ends the content that block, cell, or a section started.
+func (tg *tagger) end() {
+	if tg == nil || tg.open == nil {
+		return
+	}
+	tg.pdf.RawWriteStr("EMC /Artifact BMC")
+	tg.open = nil
+}
+
+// enter ends the open section, and starts the section of render with
+// the given name if it is tagged as a whole.
+func (tg *tagger) enter(name string) {
+	if tg == nil {
+		return
+	}
+	if s := tg.section; s != nil {
+		x, y := tg.pdf.GetXY()
+		s.empty = s.role != "Figure" && tg.pdf.PageNo() == tg.sectionPage && x == tg.sectionX && y == tg.sectionY
+		tg.section = nil
+		tg.end()
+	}
+	role, ok := sectionRoles[name]
+	if !ok {
+		return
+	}
+	attrs := ""
+	if role == "Figure" {
+		attrs = "/Alt " + pdfTextString(tg.alt)
+	}
+	tg.begin(tg.root, role, attrs)
+	tg.section = tg.open
+	tg.sectionPage = tg.pdf.PageNo()
+	tg.sectionX, tg.sectionY = tg.pdf.GetXY()
+}
+
+// table starts a table and its header row.
+func (tg *tagger) table() {
+	if tg == nil {
+		return
+	}
+	table := &structElem{role: "Table"}
+	head := &structElem{role: "THead"}
+	tg.body = &structElem{role: "TBody"}
+	tg.row = &structElem{role: "TR"}
+	head.kids = []structKid{{elem: tg.row}}
+	table.kids = []structKid{{elem: head}, {elem: tg.body}}
+	tg.root.kids = append(tg.root.kids, structKid{elem: table})
+}
+
+// tableRow starts a row of the table body.
+func (tg *tagger) tableRow() {
+	if tg == nil || tg.body == nil {
+		return
+	}
+	tg.row = &structElem{role: "TR"}
+	tg.body.kids = append(tg.body.kids, structKid{elem: tg.row})
+}
+
+// cell starts a cell of the current row, "TH" or "TD". The cells of
+// right-to-left tables are printed from the last to the first.
+func (tg *tagger) cell(role string) {
+	if tg == nil || tg.row == nil {
+		return
+	}
+	e := &structElem{role: role}
+	if role == "TH" {
+		e.attrs = "/A << /O /Table /Scope /Column >>"
+	}
+	if tg.rtl {
+		tg.row.kids = append([]structKid{{elem: e}}, tg.row.kids...)
+	} else {
+		tg.row.kids = append(tg.row.kids, structKid{elem: e})
+	}
+	tg.mark(e)
+}
+
+// The content of a page is in an artifact, except for tagged content.
+// Content that continues on the next page is marked anew there, after
+// the running headers and footers, which are artifacts, too.
+
+// start puts the first page of pdf into an artifact.
+func (tg *tagger) start(pdf *Fpdf) {
+	if tg != nil {
+		tg.pdf = pdf
+		pdf.RawWriteStr("/Artifact BMC")
+	}
+}
+
+// pageStart runs first when a page was added.
+func (tg *tagger) pageStart() {
+	if tg != nil {
+		tg.pdf.RawWriteStr("/Artifact BMC")
+	}
+}
+
+// resume runs after the other functions of pageStart. It continues
+// content that was cut by the page break.
+func (tg *tagger) resume() {
+	if tg != nil && tg.open != nil {
+		tg.mark(tg.open)
+	}
+}
+
+// suspend runs first when a page is complete. The open content, if
+// any, stays open for the next page.
+func (tg *tagger) suspend() {
+	if tg != nil && tg.open != nil {
+		tg.pdf.RawWriteStr("EMC /Artifact BMC")
+	}
+}
+
+// pageEnd runs last when a page is complete.
+func (tg *tagger) pageEnd() {
+	if tg != nil {
+		tg.pdf.RawWriteStr("EMC")
+	}
+}
+
+// finisher returns the post-processing step for savePDF that adds the
+// structure tree to the document. It must run before the steps of
+// archival mode.
+func (tg *tagger) finisher() func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		data, err := tg.addStructure(data)
+		if err != nil {
+			return nil, fmt.Errorf("tagged PDF: %s", err)
+		}
+		return data, nil
+	}
+}
+
+// addStructure appends an incremental update with the structure tree,
+// pages that refer to it, and a catalog that declares the document as
+// tagged.
+func (tg *tagger) addStructure(data []byte) ([]byte, error) {
+	m := reStartXref.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("cannot find cross-reference table")
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	root := reRoot.FindSubmatch(trailer)
+	info := reInfo.FindSubmatch(trailer)
+	sizeM := reSize.FindSubmatch(trailer)
+	if root == nil || info == nil || sizeM == nil {
+		return nil, errors.New("cannot parse trailer")
+	}
+	size, _ := strconv.Atoi(string(sizeM[1]))
+	catalog := pdfObject(data, string(root[1]))
+	pagesRef := rePages.FindSubmatch(catalog)
+	if pagesRef == nil {
+		return nil, errors.New("cannot find the page tree")
+	}
+	kids := reKids.FindSubmatch(pdfObject(data, string(pagesRef[1])))
+	if kids == nil {
+		return nil, errors.New("cannot parse the page tree")
+	}
+	var pages []string
+	for _, ref := range reRef.FindAllSubmatch(kids[1], -1) {
+		pages = append(pages, string(ref[1]))
+	}
+
+	// Elements are numbered from size on, in the order of the tree.
+	treeRoot, parentTree := size, size+1
+	nums := map[*structElem]int{}
+	var order []*structElem
+	var number func(e *structElem)
+	number = func(e *structElem) {
+		nums[e] = size + 2 + len(order)
+		order = append(order, e)
+		for _, k := range e.kids {
+			if k.elem != nil && !k.elem.empty {
+				number(k.elem)
+			}
+		}
+	}
+	number(tg.root)
+	parent := map[*structElem]int{tg.root: treeRoot}
+	for _, e := range order {
+		for _, k := range e.kids {
+			if k.elem != nil {
+				parent[k.elem] = nums[e]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	var offsets []int // of the new objects, numbered from size on
+	newObj := func() {
+		offsets = append(offsets, buf.Len())
+	}
+	newObj()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /StructTreeRoot /K %d 0 R /ParentTree %d 0 R /ParentTreeNextKey %d >>\nendobj\n",
+		treeRoot, nums[tg.root], parentTree, len(pages))
+	newObj()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Nums [", parentTree)
+	for i := range pages {
+		fmt.Fprintf(&buf, " %d [", i)
+		for _, e := range tg.parents[i+1] {
+			if e.empty {
+				buf.WriteString(" null")
+			} else {
+				fmt.Fprintf(&buf, " %d 0 R", nums[e])
+			}
+		}
+		buf.WriteString(" ]")
+	}
+	buf.WriteString(" ] >>\nendobj\n")
+	for _, e := range order {
+		var k []string
+		for _, kid := range e.kids {
+			switch {
+			case kid.elem == nil:
+				if kid.page < 1 || kid.page > len(pages) {
+					return nil, fmt.Errorf("marked content on missing page %d", kid.page)
+				}
+				k = append(k, fmt.Sprintf("<< /Type /MCR /Pg %s 0 R /MCID %d >>", pages[kid.page-1], kid.mcid))
+			case !kid.elem.empty:
+				k = append(k, fmt.Sprintf("%d 0 R", nums[kid.elem]))
+			}
+		}
+		attrs := ""
+		if e.attrs != "" {
+			attrs = " " + e.attrs
+		}
+		newObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /StructElem /S /%s /P %d 0 R /K [%s]%s >>\nendobj\n",
+			nums[e], e.role, parent[e], strings.Join(k, " "), attrs)
+	}
+
+	// The pages refer to their entries in the parent tree, and tab
+	// through their annotations in the order of the structure.
+	var updated []int // numbers and offsets of replaced objects
+	for i, num := range pages {
+		obj := pdfObject(data, num)
+		end := bytes.LastIndex(obj, []byte(">>"))
+		start := bytes.Index(obj, []byte("<<"))
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("cannot parse page object %s", num)
+		}
+		n, _ := strconv.Atoi(num)
+		updated = append(updated, n, buf.Len())
+		fmt.Fprintf(&buf, "%s 0 obj\n%s /StructParents %d /Tabs /S >>\nendobj\n", num, obj[start:end], i)
+	}
+
+	start := bytes.Index(catalog, []byte("<<"))
+	end := bytes.LastIndex(catalog, []byte(">>"))
+	if start < 0 || end < start {
+		return nil, errors.New("cannot parse catalog")
+	}
+	dict := string(catalog[start+2 : end])
+	if meta := reMetadata.FindSubmatch(data); meta != nil && !strings.Contains(dict, "/Metadata") {
+		dict += fmt.Sprintf("/Metadata %s 0 R\n", meta[1])
+	}
+	rootNum, _ := strconv.Atoi(string(root[1]))
+	updated = append(updated, rootNum, buf.Len())
+	fmt.Fprintf(&buf, "%d 0 obj\n<<%s/StructTreeRoot %d 0 R\n/MarkInfo << /Marked true >>\n/Lang %s\n/ViewerPreferences << /DisplayDocTitle true >>\n>>\nendobj\n",
+		rootNum, dict, treeRoot, pdfTextString(tg.lang))
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(updated); i += 2 {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", updated[i], updated[i+1])
+	}
+	fmt.Fprintf(&buf, "%d %d\n", size, len(offsets))
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<<\n/Size %d\n/Root %s 0 R\n/Info %s 0 R\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		size+len(offsets), root[1], info[1], m[1], xref)
+	return buf.Bytes(), nil
+}
+
+// pdfTextString returns s as a PDF text string: a literal string if s
+// is ASCII, UTF-16 with a byte order mark otherwise.
+func pdfTextString(s string) string {
+	for _, r := range s {
+		if r > 127 {
+			var b strings.Builder
+			b.WriteString("<FEFF")
+			for _, u := range utf16.Encode([]rune(s)) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">")
+			return b.String()
+		}
+	}
+	return pdfString(s)
+}
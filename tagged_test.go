@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaggedConfig(t *testing.T) {
+	tests := []struct {
+		cfg Config
+		err string
+	}{
+		{Config{Fonts: map[string]string{"": "font.ttf"}}, ""},
+		{Config{Fonts: map[string]string{"B": "font.ttf"}}, "PDF/UA requires embedded fonts"},
+		{Config{}, "PDF/UA requires embedded fonts"},
+		{Config{Fonts: map[string]string{"": "font.ttf"}, ContactSheet: &ContactSheetConfig{}}, "contact sheets cannot be tagged"},
+	}
+	for _, tt := range tests {
+		err := (&TaggedConfig{}).prepare(&tt.cfg)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", tt.cfg, err)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%+v: got error %v, want %q", tt.cfg, err, tt.err)
+		}
+	}
+}
+
+func TestPdfTextString(t *testing.T) {
+	for in, want := range map[string]string{
+		"Logo":      "(Logo)",
+		"(a)":       `(\(a\))`,
+		"Übersicht": "<FEFF00DC00620065007200730069006300680074>",
+		"€ 😀":       "<FEFF20AC0020D83DDE00>",
+	} {
+		if got := pdfTextString(in); got != want {
+			t.Errorf("pdfTextString(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestTagged(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\nApples,10\nPears,2\n",
+		"font.ttf": testFont(t, "DejaVuSansCondensed.ttf"),
+		"cfg.json": `{"fonts": {"": "font.ttf", "B": "font.ttf"}, "tagged": {"alt": "Logo of Ä"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	data := testFile(t, env, "out.pdf")
+	// The updated objects keep the document readable.
+	pageObjects(t, []byte(data))
+	for _, s := range []string{
+		"/StructTreeRoot 37 0 R\n/MarkInfo << /Marked true >>\n/Lang (en)\n/ViewerPreferences << /DisplayDocTitle true >>\n",
+		"/StructParents 0 /Tabs /S",
+		"<< /Type /StructElem /S /Document /P 37 0 R /K [40 0 R 41 0 R 42 0 R 54 0 R] >>",
+		"<< /Type /StructElem /S /TH /P 44 0 R /K [<< /Type /MCR /Pg 3 0 R /MCID 4 >>] /A << /O /Table /Scope /Column >> >>",
+		"<< /Type /StructElem /S /TR /P 47 0 R /K [52 0 R 53 0 R] >>",
+		"<< /Type /StructElem /S /TD /P 51 0 R /K [<< /Type /MCR /Pg 3 0 R /MCID 9 >>] >>",
+		"/S /Figure /P 39 0 R /K [<< /Type /MCR /Pg 3 0 R /MCID 14 >>] /Alt <FEFF004C006F0067006F0020006F0066002000C4>",
+		// Marked content without a structure element, like the borders
+		// between the cells, has no entry in the parent tree.
+		"<< /Nums [ 0 [ 40 0 R 41 0 R null null 45 0 R 46 0 R 49 0 R 50 0 R 52 0 R 53 0 R null null null null 54 0 R null null null ] ] >>",
+	} {
+		if !strings.Contains(data, s) {
+			t.Errorf("missing %q", s)
+		}
+	}
+	content := pageContents(t, []byte(data))
+	for _, s := range []string{"/Artifact BMC", "/H1 <</MCID 0>> BDC", "/TD <</MCID 9>> BDC"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("missing %q in the content", s)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// ## Template gallery
+
+// The configuration can do a lot, but nobody reads all of it before the
+// first report. The `templates` subcommand lists ready-made starting
+// points and writes one out for editing:
+//
+//	pdf templates                    list the templates
+//	pdf templates exceptions         print a template
+//	pdf templates -o my.json daily   write a template to a file
+
+// reportTemplate is a built-in starting point.
+type reportTemplate struct {
+	name        string
+	description string
+	file        string // suggested file name
+	usage       string // how to run the result
+	content     string
+}
+
+var reportTemplates = []reportTemplate{
+	{
+		name:        "daily",
+		description: "Daily table: the classic report with formatted, highlighted columns",
+		file:        "daily.json",
+		usage:       "pdf -config daily.json ordersReport.csv",
+		content: `{
+  "columns": [
+    {"name": "Date", "date": {"format": "Jan 2, 2006"}},
+    {"name": "Total", "align": "R", "highlight": "bold"}
+  ],
+  "autoWidth": {"lock": "daily.widths.json"}
+}
+`,
+	},
+	{
+		name:        "summary",
+		description: "Executive summary: narrative, group subtotals, and a share of the total",
+		file:        "summary.json",
+		usage:       "pdf -config summary.json ordersReport.csv",
+		content: `{
+  "narrative": "{{pluralize .Rows \"order\" \"orders\"}} worth {{.Sum \"Total\" | currency \"$\"}}, {{.Avg \"Total\" | currency \"$\"}} on average.",
+  "computed": [
+    {"name": "Share %", "expr": "pct(Total)", "decimals": 1}
+  ],
+  "group": {"column": "Date", "sum": ["Total"]},
+  "autoWidth": {}
+}
+`,
+	},
+	{
+		name:        "invoice",
+		description: "Invoice: an invoice document with line items, tax, and totals",
+		file:        "invoice.yaml",
+		usage:       "pdf -invoice invoice.yaml -output invoice.pdf",
+		content: `number: INV-0001
+dueDate: "2030-01-31"
+currency: "$"
+from:
+  name: Your Company
+  lines: ["1 Main Street", "Springfield"]
+billTo:
+  name: Customer Inc.
+  lines: ["Attn: Accounts Payable", "42 Market Street", "Shelbyville"]
+items:
+  - {description: Consulting, quantity: 8, unitPrice: 120}
+  - {description: Travel expenses, quantity: 1, unitPrice: 250, taxExempt: true}
+taxRate: 8.5
+terms: Payment due within 30 days.
+`,
+	},
+	{
+		name:        "labels",
+		description: "Label sheet: address labels on Avery 5160 sheets",
+		file:        "labels.json",
+		usage:       "pdf -config labels.json -output labels.pdf addresses.csv",
+		content: `{
+  "labels": {
+    "format": "avery-5160",
+    "template": "# {{.Name}}\n{{.Street}}\n{{.City}}",
+    "border": false
+  }
+}
+`,
+	},
+	{
+		name:        "exceptions",
+		description: "Exception report: validates rows and lists the problems in an appendix",
+		file:        "exceptions.json",
+		usage:       "pdf -config exceptions.json ordersReport.csv",
+		content: `{
+  "schema": {
+    "columns": [
+      {"name": "Date", "type": "date", "required": true},
+      {"name": "Quantity", "type": "int", "required": true},
+      {"name": "Total", "type": "float", "required": true}
+    ],
+    "onError": "appendix"
+  },
+  "columns": [
+    {"name": "Total", "align": "R", "highlight": "outline"}
+  ]
+}
+`,
+	},
+}
+
+// templatesCommand runs the `templates` subcommand.
+func templatesCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("templates", flag.ContinueOnError)
+	out := fs.String("o", "", "write the template to this file instead of printing it")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, t := range reportTemplates {
+			fmt.Fprintf(tw, "%s\t%s\n", t.name, t.description)
+		}
+		tw.Flush()
+		fmt.Fprintln(w, "\nRun 'pdf templates -o FILE NAME' to write a template to a file.")
+		return nil
+	}
+
+	name := fs.Arg(0)
+	var tmpl *reportTemplate
+	for i := range reportTemplates {
+		if reportTemplates[i].name == name {
+			tmpl = &reportTemplates[i]
+		}
+	}
+	if tmpl == nil {
+		return fmt.Errorf("unknown template %q; run 'pdf templates' for a list", name)
+	}
+	if *out == "" {
+		_, err := io.WriteString(w, tmpl.content)
+		return err
+	}
+
+	// The file must be of the template's kind, which its extension tells
+	// the loaders.
+	if ext := strings.ToLower(filepath.Ext(*out)); !sameKind(ext, filepath.Ext(tmpl.file)) {
+		return fmt.Errorf("%s is a %s template; name the file *%s", tmpl.name, strings.ToUpper(filepath.Ext(tmpl.file)[1:]), filepath.Ext(tmpl.file))
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*out, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s exists; use -force to overwrite it", *out)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, tmpl.content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	usage := strings.Replace(tmpl.usage, tmpl.file, *out, 1)
+	fmt.Fprintf(w, "Wrote %s. Try:\n  %s\n", *out, usage)
+	return nil
+}
+
+// sameKind reports whether two file extensions stand for the same format.
+func sameKind(a, b string) bool {
+	if a == ".yml" {
+		a = ".yaml"
+	}
+	return a == b
+}
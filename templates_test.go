@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReportTemplates makes sure that every built-in template works as
+// it is.
+func TestReportTemplates(t *testing.T) {
+	for _, tmpl := range reportTemplates {
+		env := testEnv(map[string]string{
+			"in.csv":  "Date,Quantity,Total,Name,Street,City\n2024-03-14,2,10.50,Ada Lovelace,1 Main Street,Springfield\n2024-03-15,1,4.25,Alan Turing,2 Elm Street,Shelbyville\n",
+			tmpl.file: tmpl.content,
+		})
+		job := &Job{Input: "in.csv", Config: tmpl.file, Output: "out.pdf"}
+		if strings.HasSuffix(tmpl.file, ".yaml") {
+			job = &Job{Invoice: tmpl.file, Output: "out.pdf"}
+		}
+		if err := generate(env, job); err != nil {
+			t.Errorf("%s: %v", tmpl.name, err)
+			continue
+		}
+		if !strings.HasPrefix(testFile(t, env, "out.pdf"), "%PDF-") {
+			t.Errorf("%s: no PDF document", tmpl.name)
+		}
+	}
+}
+
+func TestTemplatesCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := templatesCommand(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, tmpl := range reportTemplates {
+		if !strings.Contains(out.String(), tmpl.name+"  ") || !strings.Contains(out.String(), tmpl.description) {
+			t.Errorf("the list lacks %s:\n%s", tmpl.name, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := templatesCommand(&out, []string{"labels"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != reportTemplates[3].content {
+		t.Errorf("printed template:\n%s\nwant the labels template", out.String())
+	}
+
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "my.yml")
+	out.Reset()
+	if err := templatesCommand(&out, []string{"-o", file, "invoice"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Wrote " + file + ". Try:\n  pdf -invoice " + file + " -output invoice.pdf\n"; out.String() != want {
+		t.Errorf("output %q, want %q", out.String(), want)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != reportTemplates[2].content {
+		t.Errorf("written template %q, %v", b, err)
+	}
+	if err := templatesCommand(&out, []string{"-o", file, "invoice"}); err == nil || !strings.Contains(err.Error(), "exists; use -force to overwrite it") {
+		t.Errorf("existing file: %v", err)
+	}
+	if err := templatesCommand(&out, []string{"-o", file, "-force", "invoice"}); err != nil {
+		t.Errorf("-force: %v", err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"weekly"}, `unknown template "weekly"`},
+		{[]string{"-o", filepath.Join(dir, "daily.yaml"), "daily"}, "daily is a JSON template; name the file *.json"},
+		{[]string{"-o", filepath.Join(dir, "inv.json"), "invoice"}, "invoice is a YAML template; name the file *.yaml"},
+	} {
+		if err := templatesCommand(&out, tt.args); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: %v, want an error with %q", tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ## Text versions
+
+// A PDF without tags is a closed book for screen readers, and grep does
+// not look into PDF files at all. A text version of the report goes
+// next to it, with the same sections and the same table:
+//
+//	"textVersion": {"format": "html"}
+//
+// report.pdf gets report.html, a plain page with headings and a table
+// that screen readers can navigate, or, with the format "text",
+// report.txt, with the table in aligned columns. Both are written from
+// the content of the report, not from its pages: the title, the date,
+// the narrative, the table with its values formatted as in the PDF,
+// the callouts, the data errors, and the changes. Charts, logos, and the
+// raw data appendix are left out, and limits do not cut the table short.
+
+// TextVersionConfig writes a text version of the report.
+type TextVersionConfig struct {
+	// Format is "html" (default) or "text".
+	Format string `json:"format"`
+}
+
+func (tv *TextVersionConfig) prepare() error {
+	switch tv.Format {
+	case "":
+		tv.Format = "html"
+	case "html", "text":
+	default:
+		return fmt.Errorf("unknown format %q; use html or text", tv.Format)
+	}
+	return nil
+}
+
+// textVersionPath returns the path of the text version for a PDF path.
+func textVersionPath(pdfPath, format string) string {
+	ext := ".html"
+	if format == "text" {
+		ext = ".txt"
+	}
+	return strings.TrimSuffix(pdfPath, ".pdf") + ext
+}
+
+// textDocument is the content of a report, without its layout.
+type textDocument struct {
+	lang     string
+	rtl      bool
+	title    string
+	lines    []string // the date and the narrative
+	header   []string
+	rows     [][]string
+	numeric  []bool // columns whose values are all numbers
+	sections []textSection
+}
+
+// textSection is a part of the report after the table.
+type textSection struct {
+	heading    string
+	paragraphs []string
+}
+
+// reNote finds notes in the narrative; see writeNoted.
+var reNote = regexp.MustCompile(`\[\^([^\]]*)\]`)
+
+// newTextDocument collects the content of the report of data.
+func newTextDocument(env *Env, cfg *Config, data *reportData) (*textDocument, error) {
+	loc := cfg.locale()
+	doc := &textDocument{lang: orDefault(cfg.Locale, "en"), rtl: cfg.rtl(), title: loc.msg("title")}
+	doc.lines = append(doc.lines, loc.date(env.Clock.Now(), loc.longDate))
+	if f := cfg.Freshness; f != nil {
+		doc.lines = append(doc.lines, f.text(f.data))
+	}
+	if cfg.Narrative != "" {
+		nd := narrativeData{Date: env.Clock.Now(), Rows: len(data.rows), hdr: data.hdr, rows: data.rows}
+		str, err := execTemplateFuncs("narrative", cfg.Narrative, nd, loc.funcs())
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Footnotes != nil {
+			str = reNote.ReplaceAllString(str, " ($1)")
+		}
+		doc.lines = append(doc.lines, str)
+	}
+
+	if len(data.rows) == 0 {
+		doc.lines = append(doc.lines, noDataMessage(cfg))
+	} else if err := doc.table(cfg, data); err != nil {
+		return nil, err
+	}
+
+	var notes []string
+	for k := range cfg.Callouts {
+		if text, ok := cfg.Callouts[k].message(loc, data.rows); ok {
+			notes = append(notes, text)
+		}
+	}
+	doc.section("", notes)
+	var errs []string
+	for _, is := range data.issues {
+		errs = append(errs, loc.msg("row", is.Row+1)+": "+strings.Join(is.Messages, "; "))
+	}
+	doc.section(loc.msg("dataErrors"), errs)
+	if dr := cfg.Diff.report(loc, data.hdr, data.rows); dr != nil {
+		doc.section(loc.msg("changes"), []string{dr.counts})
+		doc.section(loc.msg("changedValues"), dr.values)
+		doc.section(loc.msg("removedRows"), dr.removed)
+	}
+	return doc, nil
+}
+
+// table collects the header and the formatted rows of the table.
+func (doc *textDocument) table(cfg *Config, data *reportData) error {
+	loc := cfg.locale()
+	var ranks []string
+	if cfg.Rank != nil {
+		var err error
+		if ranks, err = computeRanks(data.rows, cfg.Rank); err != nil {
+			return err
+		}
+		doc.header = append(doc.header, cfg.Rank.title(loc))
+		doc.numeric = append(doc.numeric, true)
+	}
+	doc.header = append(doc.header, data.hdr...)
+	for i := range data.hdr {
+		numeric := true
+		for _, line := range data.rows {
+			if _, ok := cellNumber(line, i); !ok && cellAt(line, i) != "" {
+				numeric = false
+				break
+			}
+		}
+		doc.numeric = append(doc.numeric, numeric)
+	}
+	for r, line := range data.rows {
+		var row []string
+		if ranks != nil {
+			row = append(row, ranks[r])
+		}
+		for i := range data.hdr {
+			cc := cfg.column(i)
+			str := formatText(cellAt(line, i), cc, loc)
+			if b, ok := cc.Badges[cellAt(line, i)]; ok && b.Label != "" {
+				str = b.Label
+			}
+			row = append(row, str)
+		}
+		doc.rows = append(doc.rows, row)
+	}
+	return nil
+}
+
+// section adds a section, unless it has no paragraphs.
+func (doc *textDocument) section(heading string, paragraphs []string) {
+	if len(paragraphs) > 0 {
+		doc.sections = append(doc.sections, textSection{heading, paragraphs})
+	}
+}
+
+// html returns the document as an HTML page.
+func (doc *textDocument) html() []byte {
+	var b bytes.Buffer
+	esc := html.EscapeString
+	dir := "ltr"
+	if doc.rtl {
+		dir = "rtl"
+	}
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"%s\" dir=\"%s\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n",
+		esc(doc.lang), dir, esc(doc.title), esc(doc.title))
+	for _, l := range doc.lines {
+		fmt.Fprintf(&b, "<p>%s</p>\n", esc(l))
+	}
+	if doc.header != nil {
+		fmt.Fprintf(&b, "<table>\n<caption>%s</caption>\n<thead>\n<tr>", esc(doc.title))
+		for _, h := range doc.header {
+			fmt.Fprintf(&b, "<th scope=\"col\">%s</th>", esc(h))
+		}
+		b.WriteString("</tr>\n</thead>\n<tbody>\n")
+		for _, row := range doc.rows {
+			b.WriteString("<tr>")
+			for _, v := range row {
+				fmt.Fprintf(&b, "<td>%s</td>", esc(v))
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</tbody>\n</table>\n")
+	}
+	for _, s := range doc.sections {
+		if s.heading != "" {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", esc(s.heading))
+		}
+		for _, p := range s.paragraphs {
+			fmt.Fprintf(&b, "<p>%s</p>\n", esc(p))
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.Bytes()
+}
+
+// text returns the document as plain text, with the table in aligned
+// columns.
+func (doc *textDocument) text() []byte {
+	var b bytes.Buffer
+	heading := func(s, underline string) {
+		fmt.Fprintf(&b, "%s\n%s\n\n", s, strings.Repeat(underline, utf8.RuneCountInString(s)))
+	}
+	heading(doc.title, "=")
+	for _, l := range doc.lines {
+		fmt.Fprintf(&b, "%s\n\n", l)
+	}
+	if doc.header != nil {
+		widths := make([]int, len(doc.header))
+		for _, row := range append([][]string{doc.header}, doc.rows...) {
+			for i, v := range row {
+				widths[i] = maxInt(widths[i], utf8.RuneCountInString(v))
+			}
+		}
+		line := func(row []string) {
+			var cells []string
+			for i, v := range row {
+				pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v))
+				if doc.numeric[i] {
+					cells = append(cells, pad+v)
+				} else {
+					cells = append(cells, v+pad)
+				}
+			}
+			fmt.Fprintf(&b, "%s\n", strings.TrimRight(strings.Join(cells, "  "), " "))
+		}
+		line(doc.header)
+		var rule []string
+		for _, w := range widths {
+			rule = append(rule, strings.Repeat("-", w))
+		}
+		fmt.Fprintf(&b, "%s\n", strings.Join(rule, "  "))
+		for _, row := range doc.rows {
+			line(row)
+		}
+		b.WriteString("\n")
+	}
+	for _, s := range doc.sections {
+		if s.heading != "" {
+			heading(s.heading, "-")
+		}
+		for _, p := range s.paragraphs {
+			fmt.Fprintf(&b, "%s\n\n", p)
+		}
+	}
+	return b.Bytes()
+}
+
+// write writes the text version of the report of data to the path for
+// part p.
+func (tv *TextVersionConfig) write(env *Env, cfg *Config, data *reportData, p *part) error {
+	doc, err := newTextDocument(env, cfg, data)
+	if err != nil {
+		return fmt.Errorf("cannot create text version: %w", err)
+	}
+	out := doc.html()
+	if tv.Format == "text" {
+		out = doc.text()
+	}
+	if err := writeOutput(env.FS, textVersionPath(p.output, tv.Format), out); err != nil {
+		return fmt.Errorf("cannot save text version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextVersion(t *testing.T) {
+	files := func(format string) map[string]string {
+		return map[string]string{
+			"in.csv":   "Item,Total\nApples & pears,1200\nPlums,-3.5\n",
+			"prev.csv": "Item,Total\nPlums,2\nFigs,1\n",
+			"cfg.json": `{"narrative": "{{.Rows}} rows[^From the shop]", "footnotes": {}, "diff": {"key": ["Item"]},
+				"textVersion": {"format": "` + format + `"}}`,
+		}
+	}
+	tests := []struct {
+		format, path, want string
+	}{
+		{"text", "out.txt", `Daily Report
+============
+
+Fri Mar 15, 2024
+
+2 rows (From the shop)
+
+Item            Total
+--------------  -----
+Apples & pears   1200
+Plums            -3.5
+
+Changes
+-------
+
+Since the previous data, 1 rows were added, 1 changed, and 1 removed.
+
+Changed values
+--------------
+
+Plums: Total -3.5 (was 2)
+
+Removed rows
+------------
+
+Item: Figs, Total: 1
+
+`},
+		{"", "out.html", `<!DOCTYPE html>
+<html lang="en" dir="ltr">
+<head>
+<meta charset="utf-8">
+<title>Daily Report</title>
+</head>
+<body>
+<h1>Daily Report</h1>
+<p>Fri Mar 15, 2024</p>
+<p>2 rows (From the shop)</p>
+<table>
+<caption>Daily Report</caption>
+<thead>
+<tr><th scope="col">Item</th><th scope="col">Total</th></tr>
+</thead>
+<tbody>
+<tr><td>Apples &amp; pears</td><td>1200</td></tr>
+<tr><td>Plums</td><td>-3.5</td></tr>
+</tbody>
+</table>
+<h2>Changes</h2>
+<p>Since the previous data, 1 rows were added, 1 changed, and 1 removed.</p>
+<h2>Changed values</h2>
+<p>Plums: Total -3.5 (was 2)</p>
+<h2>Removed rows</h2>
+<p>Item: Figs, Total: 1</p>
+</body>
+</html>
+`},
+	}
+	for _, tt := range tests {
+		env := testEnv(files(tt.format))
+		if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf", Previous: "prev.csv"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := testFile(t, env, tt.path); got != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTextVersionNoData(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Total\n",
+		"cfg.json": `{"textVersion": {"format": "text"}, "empty": {"message": "Nothing sold today."}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testFile(t, env, "out.txt"); !strings.Contains(got, "\n\nNothing sold today.\n") || strings.Contains(got, "Item") {
+		t.Errorf("text version of an empty report:\n%s", got)
+	}
+
+	tv := &TextVersionConfig{Format: "markdown"}
+	if err := tv.prepare(); err == nil || err.Error() != `unknown format "markdown"; use html or text` {
+		t.Errorf("prepare = %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ## Text transformations
+
+// Cosmetic cleanup -- stray whitespace, inconsistent capitalization,
+// missing units -- does not need a preprocessing script. A column can
+// list transformations that are applied to each value at render time,
+// in order, after number and date formatting:
+//
+//	"transform": ["trim", "title", {"op": "suffix", "value": " kg"}]
+//
+// A "fetch" transformation looks the value up in a JSON API -- a
+// geocoder, an exchange rate service, a customer database:
+//
+//	{"op": "fetch", "url": "https://geo.example.com/v1?q={value}", "path": "results.0.country"}
+//
+// Lookups are slow, so their results are cached; see TransformCache.
+
+// TextTransform is one transformation. In JSON, transformations without
+// arguments can be written as a plain string.
+type TextTransform struct {
+	// Op is "upper", "lower", "title", "trim", "prefix", "suffix",
+	// "replace", or "fetch".
+	Op string `json:"op"`
+
+	// Value is the text to add for "prefix" and "suffix".
+	Value string `json:"value"`
+
+	// Pattern and With are the regular expression and its replacement
+	// for "replace". With can refer to submatches as $1 or ${name}.
+	Pattern string `json:"pattern"`
+	With    string `json:"with"`
+
+	// URL, Path, and Headers are for "fetch". {value} in URL is replaced
+	// with the escaped value; the result is the JSON value at Path, as
+	// in RESTSource.
+	URL     string            `json:"url"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+
+	re *regexp.Regexp
+}
+
+// UnmarshalJSON accepts an op name or an object.
+func (t *TextTransform) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &t.Op)
+	}
+	type plain TextTransform
+	return json.Unmarshal(b, (*plain)(t))
+}
+
+// prepare checks the op and compiles the pattern.
+func (t *TextTransform) prepare() error {
+	switch t.Op {
+	case "upper", "lower", "title", "trim", "prefix", "suffix":
+		return nil
+	case "replace":
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("transform pattern: %s", err)
+		}
+		t.re = re
+		return nil
+	case "fetch":
+		if !strings.Contains(t.URL, "{value}") {
+			return fmt.Errorf("transform url %q lacks {value}", t.URL)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown transform %q", t.Op)
+}
+
+// apply returns the transformed str. Only "fetch" can fail.
+func (t *TextTransform) apply(str string) (string, error) {
+	switch t.Op {
+	case "upper":
+		return strings.ToUpper(str), nil
+	case "lower":
+		return strings.ToLower(str), nil
+	case "title":
+		return titleCase(str), nil
+	case "trim":
+		return strings.TrimSpace(str), nil
+	case "prefix":
+		return t.Value + str, nil
+	case "suffix":
+		return str + t.Value, nil
+	case "replace":
+		return t.re.ReplaceAllString(str, t.With), nil
+	case "fetch":
+		return t.fetch(str)
+	}
+	return str, nil
+}
+
+// fetch looks str up. Empty values are not looked up. Lookups happen
+// while rows are rendered, which stops when the job is canceled, so a
+// lookup itself is bounded only by the timeout of restClient.
+func (t *TextTransform) fetch(str string) (string, error) {
+	if str == "" {
+		return str, nil
+	}
+	src := RESTSource{Headers: t.Headers}
+	v, err := src.fetch(context.Background(), strings.Replace(t.URL, "{value}", url.QueryEscape(str), -1))
+	if err != nil {
+		return str, err
+	}
+	v, ok := jsonLookup(v, t.Path)
+	if !ok {
+		return str, fmt.Errorf("path %q not found in response", t.Path)
+	}
+	return jsonString(v), nil
+}
+
+// transformText applies all transformations in order. If one fails, it
+// returns str unchanged.
+func transformText(str string, ts []TextTransform) (string, error) {
+	out := str
+	for i := range ts {
+		var err error
+		if out, err = ts[i].apply(out); err != nil {
+			return str, err
+		}
+	}
+	return out, nil
+}
+
+// titleCase capitalizes the first letter of each word and lowercases the
+// rest.
+func titleCase(s string) string {
+	start := true
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' {
+			start = true
+			return r
+		}
+		if start {
+			start = false
+			return unicode.ToTitle(r)
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTextTransform(t *testing.T) {
+	tests := []struct {
+		transforms string
+		in, want   string
+	}{
+		{`["upper"]`, "Äpfel", "ÄPFEL"},
+		{`["lower"]`, "ÄPFEL", "äpfel"},
+		{`["title"]`, "o'neil-SMITH and 3rd street", "O'neil-Smith And 3rd Street"},
+		{`["trim"]`, "  Apples\t", "Apples"},
+		{`[{"op": "prefix", "value": "#"}, {"op": "suffix", "value": " kg"}]`, "12", "#12 kg"},
+		{`[{"op": "replace", "pattern": "^(\\w+)@(?P<host>.+)$", "with": "${host}: $1"}]`, "ann@example.com", "example.com: ann"},
+		{`["trim", "title", {"op": "suffix", "value": "!"}]`, "  new york ", "New York!"},
+		{`[{"op": "suffix", "value": " kg"}, "upper"]`, "12", "12 KG"},
+		{`[]`, " x ", " x "},
+	}
+	for _, tt := range tests {
+		var ts []TextTransform
+		if err := json.Unmarshal([]byte(tt.transforms), &ts); err != nil {
+			t.Fatalf("%s: %v", tt.transforms, err)
+		}
+		for i := range ts {
+			if err := ts[i].prepare(); err != nil {
+				t.Fatalf("%s: %v", tt.transforms, err)
+			}
+		}
+		if got, err := transformText(tt.in, ts); err != nil || got != tt.want {
+			t.Errorf("%s: transformText(%q) = %q, %v; want %q", tt.transforms, tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestTextTransformErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`{"columns": [{"name": "Item", "transform": ["reverse"]}]}`, `unknown transform "reverse"`},
+		{`{"columns": [{"name": "Item", "transform": [{"op": "replace", "pattern": "("}]}]}`, "transform pattern: error parsing regexp"},
+		{`{"columns": [{"name": "Item", "transform": [{"op": "fetch", "url": "https://geo.example.com"}]}]}`,
+			`transform url "https://geo.example.com" lacks {value}`},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(NewMemFS(map[string][]byte{"cfg.json": []byte(tt.config)}), "cfg.json")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want %q", tt.config, err, tt.err)
+		}
+	}
+}
+
+func TestTransformReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "Item,Weight\n  apples ,12\npears,3\n",
+		"cfg.json": `{"columns": [{"name": "Item", "transform": ["trim", "upper"]},
+			{"name": "Weight", "transform": [{"op": "suffix", "value": " kg"}]}],
+			"textVersion": {"format": "text"}}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	text := testFile(t, env, "out.txt")
+	for _, want := range []string{"APPLES   12 kg", "PEARS     3 kg"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text version lacks %q:\n%s", want, text)
+		}
+	}
+}
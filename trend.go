@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ## Trends
+
+// Our analysts mark every KPI of the monthly report by hand: improving
+// if it is more than 5% better than the average of the previous months,
+// deteriorating if it is more than 5% worse, stable otherwise. A trend
+// column applies the rule to every row:
+//
+//	"computed": [{"name": "Trend", "trend": {
+//	  "current": "March", "history": ["January", "February"],
+//	  "threshold": 5, "better": "higher"}}]
+//
+// The cells hold "improving", "stable", or "deteriorating" and print as
+// green, gray, and red badges, labeled in the language of the report,
+// unless the column's configuration has badges of its own. For metrics
+// such as costs or churn, lower values are better. A baseline of zero
+// makes any increase or decrease a change. Rows without a current value
+// or without any historical value are left empty.
+
+// TrendConfig classifies the trend of a metric.
+type TrendConfig struct {
+	// Current is the column of the current values.
+	Current ColumnRef `json:"current"`
+
+	// History lists the columns of the earlier values. Their average is
+	// the baseline.
+	History []ColumnRef `json:"history"`
+
+	// Threshold is the change in percent of the baseline from which a
+	// metric is not stable. Default: 5.
+	Threshold float64 `json:"threshold"`
+
+	// Better is "higher" (default) or "lower".
+	Better string `json:"better"`
+}
+
+// trendClasses are the values of trend columns, with their badge colors.
+var trendClasses = []struct{ value, color string }{
+	{"improving", "#2e7d32"},
+	{"stable", "#757575"},
+	{"deteriorating", "#c62828"},
+}
+
+// resolve checks the settings and resolves the columns in hdr.
+func (tc *TrendConfig) resolve(hdr []string) error {
+	switch tc.Better {
+	case "", "higher", "lower":
+	default:
+		return fmt.Errorf("unknown value %q for better; use higher or lower", tc.Better)
+	}
+	if tc.Threshold < 0 {
+		return fmt.Errorf("threshold must not be negative")
+	}
+	if tc.Threshold == 0 {
+		tc.Threshold = 5
+	}
+	if len(tc.History) == 0 {
+		return fmt.Errorf("history is required")
+	}
+	if err := tc.Current.resolve(hdr); err != nil {
+		return err
+	}
+	for k := range tc.History {
+		if err := tc.History[k].resolve(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// classify returns the trend of line.
+func (tc *TrendConfig) classify(line []string) string {
+	current, ok := cellNumber(line, tc.Current.Index)
+	if !ok {
+		return ""
+	}
+	var sum float64
+	n := 0
+	for _, ref := range tc.History {
+		if v, ok := cellNumber(line, ref.Index); ok {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	baseline := sum / float64(n)
+	change := math.Inf(1)
+	switch {
+	case current == baseline:
+		change = 0
+	case baseline != 0:
+		change = math.Abs(current-baseline) / math.Abs(baseline) * 100
+	}
+	if change <= tc.Threshold {
+		return "stable"
+	}
+	if (current > baseline) == (tc.Better != "lower") {
+		return "improving"
+	}
+	return "deteriorating"
+}
+
+// trendBadges gives trend columns without badges the default ones.
+// hdr includes the computed columns.
+func (c *Config) trendBadges(hdr []string) error {
+	base := len(hdr) - len(c.Computed)
+	loc := c.locale()
+	for k, cc := range c.Computed {
+		if cc.Trend == nil {
+			continue
+		}
+		col := -1
+		for i := range c.Columns {
+			if c.Columns[i].Name == cc.Name || c.Columns[i].Name == "" && c.Columns[i].Index == base+k {
+				col = i
+			}
+		}
+		if col < 0 {
+			c.Columns = append(c.Columns, ColumnConfig{Name: cc.Name})
+			col = len(c.Columns) - 1
+		}
+		if c.Columns[col].Badges != nil {
+			continue
+		}
+		badges := map[string]Badge{}
+		for _, class := range trendClasses {
+			b := Badge{Color: class.color, Label: loc.text(class.value)}
+			if err := b.prepare(); err != nil {
+				return err
+			}
+			badges[class.value] = b
+		}
+		c.Columns[col].Badges = badges
+	}
+	return nil
+}
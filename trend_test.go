@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrendClassify(t *testing.T) {
+	hdr := []string{"KPI", "January", "February", "March"}
+	tests := []struct {
+		line   []string
+		better string
+		want   string
+	}{
+		{[]string{"Sales", "100", "100", "106"}, "", "improving"},
+		{[]string{"Sales", "100", "100", "105"}, "", "stable"},
+		{[]string{"Sales", "90", "110", "94"}, "", "deteriorating"},
+		{[]string{"Sales", "100", "n/a", "94"}, "", "deteriorating"},
+		{[]string{"Costs", "100", "100", "94"}, "lower", "improving"},
+		{[]string{"Costs", "100", "100", "106"}, "lower", "deteriorating"},
+		{[]string{"Churn", "0", "0", "0"}, "lower", "stable"},
+		{[]string{"Churn", "0", "0", "0.1"}, "lower", "deteriorating"},
+		{[]string{"Loss", "-100", "-100", "-90"}, "", "improving"},
+		{[]string{"Sales", "100", "100", ""}, "", ""},
+		{[]string{"Sales", "", "x", "106"}, "", ""},
+	}
+	for _, tt := range tests {
+		tc := &TrendConfig{Current: ColumnRef{Name: "March"}, History: []ColumnRef{{Name: "January"}, {Name: "February"}}, Better: tt.better}
+		if err := tc.resolve(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if got := tc.classify(tt.line); got != tt.want {
+			t.Errorf("classify(%q), better %q = %q, want %q", tt.line, tt.better, got, tt.want)
+		}
+	}
+
+	tc := &TrendConfig{Current: ColumnRef{Index: 3}, History: []ColumnRef{{Index: 1}}, Threshold: 10}
+	if err := tc.resolve(hdr); err != nil || tc.classify([]string{"Sales", "100", "", "109"}) != "stable" {
+		t.Errorf("a change within a threshold of 10%% is not stable: %v", err)
+	}
+}
+
+func TestTrendResolveErrors(t *testing.T) {
+	hdr := []string{"KPI", "January", "March"}
+	for _, tt := range []struct {
+		tc  TrendConfig
+		err string
+	}{
+		{TrendConfig{Current: ColumnRef{Name: "March"}, History: []ColumnRef{{Name: "January"}}, Better: "up"},
+			`unknown value "up" for better; use higher or lower`},
+		{TrendConfig{Current: ColumnRef{Name: "March"}, History: []ColumnRef{{Name: "January"}}, Threshold: -1},
+			"threshold must not be negative"},
+		{TrendConfig{Current: ColumnRef{Name: "March"}}, "history is required"},
+		{TrendConfig{Current: ColumnRef{Name: "April"}, History: []ColumnRef{{Name: "January"}}}, `column "April" not found in header`},
+		{TrendConfig{Current: ColumnRef{Name: "March"}, History: []ColumnRef{{Name: "February"}}}, `column "February" not found in header`},
+	} {
+		tc := tt.tc
+		if err := tc.resolve(hdr); err == nil || err.Error() != tt.err {
+			t.Errorf("%+v: resolve = %v, want %q", tt.tc, err, tt.err)
+		}
+	}
+}
+
+func TestTrendReport(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv": "KPI,January,February,March\nSales,100,100,120\nCosts,100,100,120\n",
+		"cfg.json": `{"locale": "de", "computed": [
+			{"name": "Sales trend", "trend": {"current": "March", "history": ["January", "February"]}},
+			{"name": "Costs trend", "trend": {"current": "March", "history": ["January", "February"], "better": "lower"}}]}`,
+	})
+	if err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	content := pageContents(t, []byte(testFile(t, env, "out.pdf")))
+	// The badges are labeled in German.
+	for _, want := range []string{"(verbessert)", "(verschlechtert)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("the report lacks the badge %s", want)
+		}
+	}
+}
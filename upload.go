@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ## Cloud storage outputs
+
+// An output path like `s3://bucket/reports/{date}/report.pdf` uploads
+// the report to cloud storage instead of writing a local file. Uploads
+// go through the providers' command line tools, so credentials come
+// from the usual places (environment, config files, instance roles):
+//
+//   - s3://bucket/key        uses `aws s3 cp`
+//   - gs://bucket/object     uses `gcloud storage cp`
+//   - az://account/container/blob uses `az storage blob upload`
+
+// isRemote reports whether path is a cloud storage URL.
+func isRemote(path string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "az://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// outputPlaceholders are the placeholders of output paths, with the
+// layouts of the times that replace them. Both layouts sort by time.
+var outputPlaceholders = []struct{ name, layout string }{
+	{"{date}", "2006-01-02"},
+	{timePlaceholder, "20060102-150405"},
+}
+
+// expandOutput replaces the placeholders {date} and {time} in an output
+// path with the given time.
+func expandOutput(path string, now time.Time) string {
+	for _, p := range outputPlaceholders {
+		path = strings.Replace(path, p.name, now.Format(p.layout), -1)
+	}
+	return path
+}
+
+// outputGlob returns a pattern that matches the paths that expandOutput
+// makes of path, at any time, and whether path has placeholders at all.
+// The digits of the layouts become character classes, so that other
+// files of similar names do not match.
+func outputGlob(path string) (string, bool) {
+	pattern := path
+	for _, p := range outputPlaceholders {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return '#'
+			}
+			return r
+		}, p.layout)
+		pattern = strings.Replace(pattern, p.name, strings.Replace(digits, "#", "[0-9]", -1), -1)
+	}
+	return pattern, pattern != path
+}
+
+// writeOutput stores data at path, which is either a file name or a
+// cloud storage URL. Files are written under a temporary name and then
+// renamed, so that a failed write, such as on a full disk, leaves
+// neither a half-written file nor a damaged earlier version behind.
+func writeOutput(fsys FileSystem, path string, data []byte) error {
+	if isRemote(path) {
+		return upload(fsys, path, data)
+	}
+	tmp, err := writeTemp(fsys, path, data)
+	if err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, path); err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTemp writes data to the temporary name of path and returns the
+// name. Files are synced to disk, so that the rename that follows does
+// not publish a file whose contents a crash may still lose.
+func writeTemp(fsys FileSystem, path string, data []byte) (string, error) {
+	tmp := tempPath(path)
+	w, err := fsys.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	_, err = w.Write(data)
+	if s, ok := w.(interface{ Sync() error }); ok && err == nil {
+		err = s.Sync()
+	}
+	if cErr := w.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// tempPath returns the temporary name of the file path while it is
+// written: a hidden file in the same directory, because renames across
+// file systems are not atomic.
+func tempPath(path string) string {
+	dir, file := filepath.Split(path)
+	return fmt.Sprintf("%s.%s.%d.tmp", dir, file, os.Getpid())
+}
+
+// uploads counts the uploads that go through temp files, so that the
+// files of concurrent uploads get different names.
+var uploads int64
+
+// upload copies data to a cloud storage URL. Temp files, where a tool
+// needs them, go through fsys.
+func upload(fsys FileSystem, dest string, data []byte) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	contentType := "application/octet-stream"
+	if strings.HasSuffix(u.Path, ".pdf") {
+		contentType = "application/pdf"
+	} else if strings.HasSuffix(u.Path, ".json") {
+		contentType = "application/json"
+	} else if strings.HasSuffix(u.Path, ".png") {
+		contentType = "image/png"
+	} else if strings.HasSuffix(u.Path, ".jpg") {
+		contentType = "image/jpeg"
+	} else if strings.HasSuffix(u.Path, ".html") {
+		contentType = "text/html; charset=utf-8"
+	} else if strings.HasSuffix(u.Path, ".txt") {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	var cmd *exec.Cmd
+	switch u.Scheme {
+	case "s3":
+		cmd = exec.Command("aws", "s3", "cp", "-", dest, "--content-type", contentType)
+	case "gs":
+		cmd = exec.Command("gcloud", "storage", "cp", "-", dest, "--content-type="+contentType)
+	case "az":
+		// az cannot read from stdin, so the data goes through a temp file.
+		// The file system of the run writes and removes it, like any other
+		// file of the report.
+		parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("%s: expected az://account/container/blob", dest)
+		}
+		name := fmt.Sprintf("upload-%d", atomic.AddInt64(&uploads, 1))
+		tmp, err := writeTemp(fsys, filepath.Join(os.TempDir(), name), data)
+		if err != nil {
+			return err
+		}
+		defer fsys.Remove(tmp)
+		cmd = exec.Command("az", "storage", "blob", "upload",
+			"--auth-mode", "login", "--overwrite",
+			"--account-name", u.Host, "--container-name", parts[0], "--name", parts[1],
+			"--file", tmp, "--content-type", contentType)
+		data = nil
+	default:
+		return fmt.Errorf("unsupported storage URL %q", dest)
+	}
+
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("upload to %s: %s: %s", dest, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeTool puts a shell script of the given name first on PATH, until
+// the returned function is called.
+func fakeTool(t *testing.T, name, script string) func() {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	dir, err := ioutil.TempDir("", "bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+// uploadTemps returns the temp files of uploads that fsys holds.
+func uploadTemps(t *testing.T, fsys FileSystem) []string {
+	t.Helper()
+	names, err := fsys.Glob(filepath.Join(os.TempDir(), ".upload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestUploadAzure(t *testing.T) {
+	out, err := ioutil.TempDir("", "az")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+	// The fake az copies the file it is given and records its arguments.
+	defer fakeTool(t, "az", `
+while [ $# -gt 0 ]; do
+	[ "$1" = --file ] && cp "$2" "`+out+`/blob"
+	echo "$1" >> "`+out+`/args"
+	shift
+done
+`)()
+
+	fsys := osFileSystem{}
+	if err := upload(fsys, "az://acct/reports/2024/sales.pdf", []byte("%PDF-1.4")); err != nil {
+		t.Fatal(err)
+	}
+	if blob, _ := ioutil.ReadFile(filepath.Join(out, "blob")); string(blob) != "%PDF-1.4" {
+		t.Errorf("az read %q from the temp file", blob)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(out, "args"))
+	for _, want := range []string{"--account-name\nacct\n", "--container-name\nreports\n", "--name\n2024/sales.pdf\n", "--content-type\napplication/pdf\n"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("az arguments lack %q:\n%s", want, args)
+		}
+	}
+	if left := uploadTemps(t, fsys); len(left) != 0 {
+		t.Errorf("temp files left after the upload: %q", left)
+	}
+}
+
+func TestUploadAzureErrors(t *testing.T) {
+	defer fakeTool(t, "az", "echo 'not logged in' >&2\nexit 1\n")()
+	fsys := NewMemFS(nil)
+	tests := []struct {
+		dest, err string
+	}{
+		{"az://acct/reports/sales.pdf", "upload to az://acct/reports/sales.pdf: exit status 1: not logged in"},
+		{"az://acct/reports", "az://acct/reports: expected az://account/container/blob"},
+		{"ftp://host/sales.pdf", `unsupported storage URL "ftp://host/sales.pdf"`},
+	}
+	for _, tt := range tests {
+		err := upload(fsys, tt.dest, []byte("%PDF-1.4"))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("upload to %s = %v, want %q", tt.dest, err, tt.err)
+		}
+	}
+	if left := uploadTemps(t, fsys); len(left) != 0 {
+		t.Errorf("temp files left after failed uploads: %q", left)
+	}
+}
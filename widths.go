@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ## Automatic column widths
+
+// Instead of the fixed default width, columns can be as wide as their
+// longest value. Fitting the widths anew every day makes the table
+// jiggle, though, as the data changes. So the fitted widths can be
+// locked in a sidecar file and reused until a re-fit is requested.
+
+// AutoWidthConfig fits the widths of all columns that have no explicit
+// width.
+type AutoWidthConfig struct {
+	// Lock is the path of a JSON file that stores the fitted widths.
+	// If the file exists, its widths are used instead of fitting anew.
+	Lock string `json:"lock"`
+
+	// Min and Max limit the fitted widths in mm. Default: 10 and 100.
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// widthLock is the content of the lock file: column names and widths.
+type widthLock struct {
+	Columns map[string]float64 `json:"columns"`
+}
+
+// fit computes the widths of all columns and stores them in cfg. With a
+// lock file, locked widths take precedence unless refit is true; new
+// columns are fitted and added to the lock file, except in a dry run.
+func (aw *AutoWidthConfig) fit(env *Env, cfg *Config, hdr []string, rows [][]string, refit, dryRun bool) error {
+	lock := widthLock{Columns: map[string]float64{}}
+	if aw.Lock != "" && !refit {
+		if err := loadWidthLock(env.FS, cfg.artifactKey, aw.Lock, &lock); err != nil {
+			return err
+		}
+	}
+	fitted := measureColumns(env, cfg, hdr, rows)
+	cfg.widths = make([]float64, len(hdr))
+	changed := false
+	for i, h := range hdr {
+		w, ok := lock.Columns[h]
+		if !ok {
+			w = math.Min(math.Max(fitted[i], orDefaultFloat(aw.Min, 10)), orDefaultFloat(aw.Max, 100))
+			// Rounding up to tenths of a millimeter keeps the lock file
+			// readable.
+			w = math.Ceil(w*10) / 10
+			lock.Columns[h] = w
+			changed = true
+		}
+		cfg.widths[i] = w
+	}
+	if aw.Lock == "" || !changed || dryRun {
+		return nil
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeArtifact(env.FS, cfg.artifactKey, aw.Lock, data); err != nil {
+		return fmt.Errorf("cannot write width lock: %w", err)
+	}
+	return nil
+}
+
+// loadWidthLock reads the lock file. A missing file is not an error.
+func loadWidthLock(fsys FileSystem, key []byte, path string, lock *widthLock) error {
+	data, err := readArtifact(fsys, key, path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read width lock '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return fmt.Errorf("cannot read width lock '%s': %w", path, err)
+	}
+	if lock.Columns == nil {
+		lock.Columns = map[string]float64{}
+	}
+	return nil
+}
+
+// measureColumns returns the width each column needs for its header and
+// its formatted values, measured in the fonts the table uses.
+func measureColumns(env *Env, cfg *Config, hdr []string, rows [][]string) []float64 {
+	widths := make([]float64, len(hdr))
+	measureCells(env, cfg, hdr, rows, func(col int, w float64) {
+		widths[col] = math.Max(widths[col], w)
+	})
+	return widths
+}
+
+// measureCells calls fn with the width that each header, value, and
+// subtotal label of column col needs.
+func measureCells(env *Env, cfg *Config, hdr []string, rows [][]string, fn func(col int, w float64)) {
+	pdf := newPDF("L", "mm", "Letter", "")
+	setupDocument(pdf, env, cfg)
+	pad := 2*cfg.CellStyle.padding(pdf.GetCellMargin()) + 1
+
+	pdf.SetFont("Times", "B", 16)
+	for i, h := range hdr {
+		if cfg.RotateHeader.listed(i) {
+			// A rotated name needs the height of a line.
+			_, size := pdf.GetFontSize()
+			fn(i, size+pad)
+			continue
+		}
+		fn(i, pdf.GetStringWidth(cfg.locale().print(h))+pad)
+	}
+	for _, line := range rows {
+		for i, str := range line {
+			if i >= len(hdr) {
+				break
+			}
+			cc := cfg.column(i)
+			// Highlighted extremes may be printed in bold.
+			style := ""
+			if cc.Highlight == "bold" {
+				style = "B"
+			}
+			pdf.SetFont("Times", style, 16)
+			fn(i, pdf.GetStringWidth(formatCell(str, cc, cfg.locale()))+pad)
+		}
+		// Subtotal rows label the group in bold.
+		if g := cfg.Group; g != nil && g.Column.Index < len(hdr) {
+			pdf.SetFont("Times", "B", 16)
+			fn(g.Column.Index, pdf.GetStringWidth(cfg.locale().text("subtotal", cellAt(line, g.Column.Index)))+pad)
+		}
+	}
+}
+
+func orDefaultFloat(v, def float64) float64 {
+	if v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWidthLock(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":   "Item,Qty,Note\nApples,10,ok\n",
+		"cfg.json": `{"autoWidth": {"lock": "widths.json", "min": 15}, "columns": [{"name": "Note", "width": 50}]}`,
+	})
+	lock := func() map[string]float64 {
+		t.Helper()
+		var wl widthLock
+		if err := json.Unmarshal([]byte(testFile(t, env, "widths.json")), &wl); err != nil {
+			t.Fatal(err)
+		}
+		return wl.Columns
+	}
+	run := func(csv string, job Job) {
+		t.Helper()
+		f, err := env.FS.Create("in.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(csv))
+		f.Close()
+		job.Input, job.Config, job.Output = "in.csv", "cfg.json", "out.pdf"
+		if err := generate(env, &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("Item,Qty,Note\nApples,10,ok\n", Job{})
+	first := lock()
+	if first["Qty"] != 15 || first["Item"] <= 15 {
+		t.Fatalf("fitted widths %v, want Qty at the minimum and a wider Item", first)
+	}
+
+	// Longer values do not change the locked widths.
+	run("Item,Qty,Note\nPassion fruit from far away,1234567890,ok\n", Job{})
+	if got := lock(); got["Item"] != first["Item"] || got["Qty"] != first["Qty"] {
+		t.Errorf("locked widths changed from %v to %v", first, got)
+	}
+
+	// A dry run fits anew but leaves the lock file alone.
+	run("Item,Qty,Note\nPassion fruit from far away,1234567890,ok\n", Job{RefitWidths: true, DryRun: true})
+	if got := lock(); got["Item"] != first["Item"] {
+		t.Errorf("a dry run changed the locked widths from %v to %v", first, got)
+	}
+
+	run("Item,Qty,Note\nPassion fruit from far away,1234567890,ok\n", Job{RefitWidths: true})
+	refit := lock()
+	if refit["Item"] <= first["Item"] || refit["Qty"] <= first["Qty"] {
+		t.Errorf("refitted widths %v, want wider than %v", refit, first)
+	}
+	if w := refit["Item"]; math.Abs(w*10-math.Round(w*10)) > 1e-9 {
+		t.Errorf("width %v is not rounded to tenths", w)
+	}
+
+	cfg := &Config{Columns: []ColumnConfig{{Name: "Note", Index: 2, Width: 50}}, widths: []float64{20, 30, 99}}
+	if w := cfg.width(2); w != 50 {
+		t.Errorf("explicit width overridden by the fitted %v", w)
+	}
+}
+
+func TestWidthLockErrors(t *testing.T) {
+	env := testEnv(map[string]string{
+		"in.csv":      "Item,Total\nApples,10\n",
+		"cfg.json":    `{"autoWidth": {"lock": "widths.json"}}`,
+		"widths.json": `{"columns": [1, 2]}`,
+	})
+	err := generate(env, &Job{Input: "in.csv", Config: "cfg.json", Output: "out.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "cannot read width lock 'widths.json'") {
+		t.Errorf("generate = %v, want an error for the width lock", err)
+	}
+}